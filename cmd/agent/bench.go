@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/agent"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/bench"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// runBench generates load against a listener and prints the throughput and
+// latencies it measured. Without -target it loads the local listener of the
+// configuration the agent last applied.
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	config := fs.String("config", "/etc/vpsie-lb/agent.yaml", "Agent configuration, to find the local listener when -target is not set")
+	target := fs.String("target", "", "URL (http mode) or host:port (tcp mode) to load; default: the local listener")
+	mode := fs.String("mode", "", "Load to generate: http or tcp; default: from the listener protocol, or the -target form")
+	concurrency := fs.Int("c", 10, "Parallel connections")
+	duration := fs.Duration("d", 10*time.Second, "How long to generate load")
+	requests := fs.Int("n", 0, "Stop after this many requests (0 for no limit)")
+	timeout := fs.Duration("timeout", 5*time.Second, "Timeout of each request")
+	keepAlive := fs.Bool("keepalive", true, "Reuse HTTP connections between requests")
+	insecure := fs.Bool("insecure", false, "Skip TLS certificate verification")
+	payload := fs.String("payload", "", "Data written to each TCP connection; the first reply is awaited")
+	asJSON := fs.Bool("json", false, "Print the results as JSON")
+	_ = fs.Parse(args)
+
+	opts := bench.Options{
+		Mode:        bench.Mode(*mode),
+		Target:      *target,
+		Concurrency: *concurrency,
+		Duration:    *duration,
+		Requests:    *requests,
+		Timeout:     *timeout,
+		KeepAlive:   *keepAlive,
+		Insecure:    *insecure,
+		Payload:     []byte(*payload),
+	}
+	if opts.Target == "" {
+		cfg, err := agent.LoadConfig(*config)
+		if err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+		lb, err := agent.AppliedLoadBalancer(cfg)
+		if err != nil {
+			log.Fatalf("Failed to find the local listener, set -target: %v", err)
+		}
+		listenerMode, listenerTarget := localListener(lb)
+		opts.Target = listenerTarget
+		if opts.Mode == "" {
+			opts.Mode = listenerMode
+		}
+	}
+	if opts.Mode == "" {
+		opts.Mode = bench.ModeTCP
+		if strings.Contains(opts.Target, "://") {
+			opts.Mode = bench.ModeHTTP
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	log.Printf("Generating %s load against %s with %d connections", opts.Mode, opts.Target, opts.Concurrency)
+	result, err := bench.Run(ctx, opts)
+	if err != nil {
+		log.Fatalf("Benchmark failed: %v", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(result); err != nil {
+			log.Fatalf("Failed to write results: %v", err)
+		}
+	} else {
+		result.Report(os.Stdout)
+	}
+	if result.Requests > 0 && result.Errors == result.Requests {
+		os.Exit(1)
+	}
+}
+
+// localListener returns the load to generate against the first address and
+// port lb listens on, reached over loopback when it listens on every address
+func localListener(lb *models.LoadBalancer) (bench.Mode, string) {
+	host := lb.ListenAddresses()[0]
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+		if ip.To4() == nil {
+			host = "::1"
+		}
+	}
+	port := lb.Port
+	if lb.PortRange != nil {
+		port = lb.PortRange.From
+	}
+	hostPort := net.JoinHostPort(host, strconv.Itoa(port))
+	switch lb.Protocol {
+	case models.ProtocolHTTP, models.ProtocolHTTPS:
+		return bench.ModeHTTP, fmt.Sprintf("%s://%s/", lb.Protocol, hostPort)
+	default:
+		return bench.ModeTCP, hostPort
+	}
+}
@@ -2,23 +2,58 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/vpsie/vpsie-loadbalancer/pkg/agent"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
 )
 
+// Version is set at build time with -ldflags "-X main.Version=..."
+var Version = "dev"
+
 var (
-	configPath = flag.String("config", "/etc/vpsie-lb/agent.yaml", "Path to agent configuration file")
+	configPath  = flag.String("config", "/etc/vpsie-lb/agent.yaml", "Path to agent configuration file")
+	describeFmt = flag.String("describe", "", "Print a summary of the load balancer configuration (markdown or html) and exit")
+	printSchema = flag.Bool("schema", false, "Print the JSON Schema of the load balancer definition and exit")
+	validateLB  = flag.String("validate", "", "Strictly validate a JSON load balancer definition file (- for stdin) and exit")
+	printBoot   = flag.Bool("bootstrap", false, "Print the Envoy bootstrap configuration for the agent configuration and exit")
 )
 
 func main() {
+	// Timestamps come from the agent log writer (RFC3339 UTC, nanoseconds, sequence)
+	log.SetFlags(log.Lshortfile)
+	log.SetOutput(agent.NewLogWriter(os.Stderr))
+
+	// Load testing has its own flags
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		runBench(os.Args[2:])
+		return
+	}
+
 	flag.Parse()
+	agent.Version = Version
+
+	// Offline tooling for load balancer definitions; no agent configuration needed
+	if *printSchema {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(models.Schema()); err != nil {
+			log.Fatalf("Failed to write schema: %v", err)
+		}
+		return
+	}
+	if *validateLB != "" {
+		validateDefinition(*validateLB)
+		return
+	}
 
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.Println("VPSie Load Balancer Agent starting...")
 
 	// Load configuration
@@ -26,6 +61,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	if err = config.Validate(); err != nil {
+		log.Fatalf("Invalid configuration in %s:\n%v", *configPath, err)
+	}
 
 	// Create agent
 	agentInstance, err := agent.NewAgent(config)
@@ -33,6 +71,19 @@ func main() {
 		log.Fatalf("Failed to create agent: %v", err)
 	}
 
+	if *describeFmt != "" {
+		describeConfig(agentInstance)
+		return
+	}
+	if *printBoot {
+		bootstrap, bootErr := agentInstance.Bootstrap()
+		if bootErr != nil {
+			log.Fatalf("Failed to render bootstrap: %v", bootErr)
+		}
+		fmt.Print(string(bootstrap))
+		return
+	}
+
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -41,6 +92,10 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// Handle configuration reload signal
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+
 	// Start agent in goroutine
 	errChan := make(chan error, 1)
 	go func() {
@@ -48,23 +103,107 @@ func main() {
 	}()
 
 	// Wait for signal or error
-	select {
-	case <-sigChan:
-		log.Println("Received shutdown signal")
-		cancel()
-		agentInstance.Stop()
-
-		// Wait for agent goroutine to finish to prevent goroutine leak
-		log.Println("Waiting for agent to finish...")
-		if agentErr := <-errChan; agentErr != nil {
-			log.Printf("Agent exited with error: %v", agentErr)
-		}
+	for {
+		select {
+		case <-hupChan:
+			log.Printf("Received SIGHUP, reloading configuration from %s", *configPath)
+			reloadConfig(agentInstance)
+			continue
 
-	case agentErr := <-errChan:
-		if agentErr != nil {
-			log.Fatalf("Agent error: %v", agentErr)
+		case <-sigChan:
+			log.Println("Received shutdown signal")
+
+			// Drain Envoy first when configured; a second signal cuts it short
+			drainCtx, stopDrain := context.WithCancel(context.Background())
+			go func() {
+				select {
+				case <-sigChan:
+					stopDrain()
+				case <-drainCtx.Done():
+				}
+			}()
+			agentInstance.Drain(drainCtx)
+			stopDrain()
+
+			cancel()
+			agentInstance.Stop()
+
+			// Wait for agent goroutine to finish to prevent goroutine leak
+			log.Println("Waiting for agent to finish...")
+			if agentErr := <-errChan; agentErr != nil {
+				log.Printf("Agent exited with error: %v", agentErr)
+			}
+
+		case agentErr := <-errChan:
+			if agentErr != nil {
+				log.Fatalf("Agent error: %v", agentErr)
+			}
 		}
+		break
 	}
 
 	log.Println("VPSie Load Balancer Agent stopped")
 }
+
+// reloadConfig re-reads the agent configuration file and applies it to the
+// running agent. Errors are logged and the previous configuration stays active.
+func reloadConfig(agentInstance *agent.Agent) {
+	newConfig, err := agent.LoadConfig(*configPath)
+	if err != nil {
+		log.Printf("Configuration reload failed, keeping current configuration: %v", err)
+		return
+	}
+	if err = newConfig.Validate(); err != nil {
+		log.Printf("Configuration reload rejected, keeping current configuration:\n%v", err)
+		return
+	}
+	if err = agentInstance.ReloadConfig(newConfig); err != nil {
+		log.Printf("Configuration reload failed, keeping current configuration: %v", err)
+		return
+	}
+	log.Println("Configuration reloaded")
+}
+
+// describeConfig prints a human-readable summary of the load balancer
+// configuration from the configured source
+func describeConfig(agentInstance *agent.Agent) {
+	summary, err := agentInstance.Describe(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to fetch configuration: %v", err)
+	}
+
+	switch *describeFmt {
+	case "html":
+		page, htmlErr := summary.HTML()
+		if htmlErr != nil {
+			log.Fatalf("Failed to render summary: %v", htmlErr)
+		}
+		fmt.Print(page)
+	case "markdown", "md":
+		fmt.Print(summary.Markdown())
+	default:
+		log.Fatalf("Unsupported describe format %q: use markdown or html", *describeFmt)
+	}
+}
+
+// validateDefinition strictly validates a load balancer definition file and
+// exits non-zero if it is invalid
+func validateDefinition(path string) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		// #nosec G304 -- path comes from a command-line flag
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", path, err)
+	}
+
+	if _, err = models.ParseLoadBalancer(data); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: invalid: %v\n", path, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: valid\n", path)
+}
@@ -0,0 +1,97 @@
+// Command vpsie-ccm runs the Kubernetes Service controller that provisions
+// VPSie load balancers for Services of type LoadBalancer.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/agent"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ccm"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/k8s"
+)
+
+var (
+	apiURL        = flag.String("vpsie-api-url", "https://api.vpsie.com/v1", "VPSie API URL")
+	apiKeyFile    = flag.String("vpsie-api-key-file", "/etc/vpsie-ccm/api-key", "Path to the VPSie API key")
+	kubeServer    = flag.String("kube-server", "", "Kubernetes API server URL (default: in-cluster configuration)")
+	kubeTokenFile = flag.String("kube-token-file", "", "Bearer token file for -kube-server")
+	kubeCAFile    = flag.String("kube-ca-file", "", "CA bundle for -kube-server (default: system roots)")
+	resync        = flag.Duration("resync", 5*time.Minute, "Full reconcile interval")
+	workers       = flag.Int("workers", ccm.DefaultWorkers, "Services reconciled concurrently")
+)
+
+// watchedCollections trigger a reconcile whenever they change
+var watchedCollections = []string{
+	"/api/v1/services",
+	"/api/v1/nodes",
+	"/apis/discovery.k8s.io/v1/endpointslices",
+}
+
+func main() {
+	flag.Parse()
+
+	log.SetFlags(log.Lshortfile)
+	log.SetOutput(agent.NewLogWriter(os.Stderr))
+	log.Println("VPSie cloud controller manager starting...")
+
+	// #nosec G304 -- path comes from a command-line flag
+	apiKey, err := os.ReadFile(*apiKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to read VPSie API key: %v", err)
+	}
+	vpsieClient, err := agent.NewVPSieClient(strings.TrimSpace(string(apiKey)), *apiURL, "")
+	if err != nil {
+		log.Fatalf("Failed to create VPSie client: %v", err)
+	}
+
+	kubeClient, err := newKubeClient()
+	if err != nil {
+		log.Fatalf("Failed to create Kubernetes client: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	controller := ccm.NewController(kubeClient, vpsieClient)
+	controller.SetWorkers(*workers)
+	for _, path := range watchedCollections {
+		go kubeClient.WatchLoop(ctx, path, controller.Trigger)
+	}
+
+	controller.Run(ctx, *resync)
+	log.Println("VPSie cloud controller manager stopped")
+}
+
+// newKubeClient connects in-cluster unless -kube-server is set
+func newKubeClient() (*k8s.Client, error) {
+	if *kubeServer == "" {
+		return k8s.NewInClusterClient()
+	}
+
+	var token string
+	if *kubeTokenFile != "" {
+		// #nosec G304 -- path comes from a command-line flag
+		data, err := os.ReadFile(*kubeTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	var caPEM []byte
+	if *kubeCAFile != "" {
+		var err error
+		// #nosec G304 -- path comes from a command-line flag
+		if caPEM, err = os.ReadFile(*kubeCAFile); err != nil {
+			return nil, err
+		}
+	}
+	return k8s.NewClient(*kubeServer, token, caPEM)
+}
@@ -1,5 +1,10 @@
 module github.com/vpsie/vpsie-loadbalancer
 
-go 1.23
+go 1.24
 
-require gopkg.in/yaml.v3 v3.0.1
+require (
+	github.com/fsnotify/fsnotify v1.7.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.4.0 // indirect
@@ -20,6 +20,8 @@ apt-get install -y \
     vim \
     htop \
     net-tools \
+    iproute2 \
+    iputils-arping \
     iptables \
     systemd \
     dbus \
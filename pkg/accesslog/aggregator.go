@@ -0,0 +1,171 @@
+// Package accesslog receives the access logs Envoy streams over its gRPC
+// Access Log Service (ALS) and aggregates them into per-route request,
+// error and latency metrics. Messages are decoded from the protobuf wire
+// format directly, so the agent does not depend on a gRPC stack.
+package accesslog
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultRoute is the route name of requests served by the load balancer's
+// default route, which Envoy logs without a name
+const DefaultRoute = "default"
+
+// DefaultSampleSize is the number of recent entries kept for forwarding when
+// the aggregator is created without a sample size
+const DefaultSampleSize = 100
+
+// latencyBuckets are the upper bounds, in milliseconds, of the latency
+// histogram; slower requests fall in a final overflow bucket
+var latencyBuckets = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Entry is one HTTP request logged by Envoy
+type Entry struct {
+	Time          time.Time `json:"time"`
+	Route         string    `json:"route"`
+	Cluster       string    `json:"cluster,omitempty"`
+	ClientIP      string    `json:"client_ip,omitempty"` // after X-Forwarded-For handling
+	Method        string    `json:"method,omitempty"`
+	Authority     string    `json:"authority,omitempty"`
+	Path          string    `json:"path,omitempty"`
+	Status        int       `json:"status"` // 0 when Envoy sent no response, e.g. the client went away
+	DurationMs    float64   `json:"duration_ms"`
+	UpstreamHost  string    `json:"upstream_host,omitempty"` // ip:port of the backend host that served the request
+	UpstreamMs    float64   `json:"upstream_ms,omitempty"`   // until the last byte of the backend's response
+	BytesReceived uint64    `json:"bytes_received"`          // request headers and body
+	BytesSent     uint64    `json:"bytes_sent"`              // response headers and body
+}
+
+// IsError reports whether the request failed on the server side: a 5xx
+// response or no response at all
+func (e *Entry) IsError() bool {
+	return e.Status == 0 || e.Status >= 500
+}
+
+// RouteStats are the cumulative metrics of one route. Latency percentiles
+// are estimated from a histogram and reported as the upper bound of the
+// bucket they fall in.
+type RouteStats struct {
+	Route        string  `json:"route"`
+	Requests     uint64  `json:"requests"`
+	Errors       uint64  `json:"errors"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	P50LatencyMs float64 `json:"p50_latency_ms"`
+	P99LatencyMs float64 `json:"p99_latency_ms"`
+}
+
+// routeStats accumulates the metrics of one route
+type routeStats struct {
+	requests  uint64
+	errors    uint64
+	totalMs   float64
+	maxMs     float64
+	histogram []uint64 // one count per latency bucket plus overflow
+}
+
+// percentile returns the estimated latency below which q of the requests fall
+func (r *routeStats) percentile(q float64) float64 {
+	rank := uint64(math.Ceil(q * float64(r.requests)))
+	var seen uint64
+	for i, count := range r.histogram {
+		seen += count
+		if seen >= rank && count > 0 {
+			if i == len(latencyBuckets) {
+				return r.maxMs
+			}
+			return latencyBuckets[i]
+		}
+	}
+	return r.maxMs
+}
+
+// Aggregator keeps per-route metrics and the most recent entries. Metrics
+// are held in memory and start from zero when the agent restarts.
+type Aggregator struct {
+	mu         sync.Mutex
+	routes     map[string]*routeStats
+	samples    []Entry // ring buffer of the latest entries
+	next       int     // position of the next sample in samples
+	sampled    int     // entries in samples
+	sampleSize int
+}
+
+// NewAggregator creates an aggregator keeping up to sampleSize recent
+// entries for forwarding (DefaultSampleSize when 0)
+func NewAggregator(sampleSize int) *Aggregator {
+	if sampleSize <= 0 {
+		sampleSize = DefaultSampleSize
+	}
+	return &Aggregator{
+		routes:     make(map[string]*routeStats),
+		samples:    make([]Entry, sampleSize),
+		sampleSize: sampleSize,
+	}
+}
+
+// Record adds entries to the metrics of their routes and keeps them as samples
+func (a *Aggregator) Record(entries []Entry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, e := range entries {
+		if e.Route == "" {
+			e.Route = DefaultRoute
+		}
+		r, ok := a.routes[e.Route]
+		if !ok {
+			r = &routeStats{histogram: make([]uint64, len(latencyBuckets)+1)}
+			a.routes[e.Route] = r
+		}
+		r.requests++
+		if e.IsError() {
+			r.errors++
+		}
+		r.totalMs += e.DurationMs
+		r.maxMs = max(r.maxMs, e.DurationMs)
+		r.histogram[sort.SearchFloat64s(latencyBuckets, e.DurationMs)]++
+
+		a.samples[a.next] = e
+		a.next = (a.next + 1) % a.sampleSize
+		a.sampled = min(a.sampled+1, a.sampleSize)
+	}
+}
+
+// Stats returns the metrics of every route, ordered by route
+func (a *Aggregator) Stats() []RouteStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stats := make([]RouteStats, 0, len(a.routes))
+	for name, r := range a.routes {
+		stats = append(stats, RouteStats{
+			Route:        name,
+			Requests:     r.requests,
+			Errors:       r.errors,
+			AvgLatencyMs: r.totalMs / float64(r.requests),
+			P50LatencyMs: r.percentile(0.5),
+			P99LatencyMs: r.percentile(0.99),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Route < stats[j].Route })
+	return stats
+}
+
+// TakeSamples returns the entries recorded since the last call, oldest
+// first, up to the sample size, and forgets them
+func (a *Aggregator) TakeSamples() []Entry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	samples := make([]Entry, 0, a.sampled)
+	start := (a.next - a.sampled + a.sampleSize) % a.sampleSize
+	for i := range a.sampled {
+		samples = append(samples, a.samples[(start+i)%a.sampleSize])
+	}
+	a.sampled = 0
+	return samples
+}
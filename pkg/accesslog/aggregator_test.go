@@ -0,0 +1,51 @@
+package accesslog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAggregator_Stats(t *testing.T) {
+	a := NewAggregator(0)
+	var entries []Entry
+	for i := range 100 {
+		entries = append(entries, Entry{Route: "api", Status: 200, DurationMs: float64(i%10 + 1)})
+	}
+	entries[0].Status = 502
+	entries[1].Status = 0
+	entries[2].DurationMs = 12000
+	a.Record(entries)
+	a.Record([]Entry{{Status: 404, DurationMs: 3}, {Route: "export", Status: 200, DurationMs: 30000}})
+
+	want := []RouteStats{
+		{Route: "api", Requests: 100, Errors: 2, AvgLatencyMs: 125.47, P50LatencyMs: 10, P99LatencyMs: 10},
+		{Route: DefaultRoute, Requests: 1, AvgLatencyMs: 3, P50LatencyMs: 5, P99LatencyMs: 5},
+		{Route: "export", Requests: 1, AvgLatencyMs: 30000, P50LatencyMs: 30000, P99LatencyMs: 30000}, // beyond the last bucket
+	}
+	if got := a.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestAggregator_TakeSamples(t *testing.T) {
+	a := NewAggregator(3)
+	if got := a.TakeSamples(); len(got) != 0 {
+		t.Errorf("TakeSamples() = %+v, want none before any request", got)
+	}
+
+	a.Record([]Entry{{Path: "/1"}, {Path: "/2"}})
+	a.Record([]Entry{{Path: "/3"}, {Path: "/4"}})
+	want := []Entry{
+		{Route: DefaultRoute, Path: "/2"},
+		{Route: DefaultRoute, Path: "/3"},
+		{Route: DefaultRoute, Path: "/4"},
+	}
+	if got := a.TakeSamples(); !reflect.DeepEqual(got, want) {
+		t.Errorf("TakeSamples() = %+v, want the latest 3 %+v", got, want)
+	}
+
+	a.Record([]Entry{{Path: "/5"}})
+	if got := a.TakeSamples(); len(got) != 1 || got[0].Path != "/5" {
+		t.Errorf("TakeSamples() = %+v, want only the entry since the last call", got)
+	}
+}
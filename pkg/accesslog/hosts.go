@@ -0,0 +1,80 @@
+package accesslog
+
+import (
+	"sort"
+	"sync"
+)
+
+// HostLatency is the upstream latency of one backend host over a sampling
+// interval. The percentile is the upper bound of its latency bucket.
+type HostLatency struct {
+	Cluster  string  `json:"cluster"`
+	Host     string  `json:"host"` // ip:port
+	Requests uint64  `json:"requests"`
+	P95Ms    float64 `json:"p95_latency_ms"`
+}
+
+// hostKey identifies a backend host
+type hostKey struct {
+	cluster string
+	host    string
+}
+
+// HostLatencies accumulates the upstream latency of each backend host until
+// it is taken. Requests Envoy sent to no backend host are skipped.
+type HostLatencies struct {
+	mu    sync.Mutex
+	hosts map[hostKey]*routeStats
+}
+
+// NewHostLatencies creates an empty per-host latency recorder
+func NewHostLatencies() *HostLatencies {
+	return &HostLatencies{hosts: make(map[hostKey]*routeStats)}
+}
+
+// Record adds entries to the latency of their backend hosts
+func (h *HostLatencies) Record(entries []Entry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, e := range entries {
+		if e.UpstreamHost == "" || e.Cluster == "" {
+			continue
+		}
+		key := hostKey{cluster: e.Cluster, host: e.UpstreamHost}
+		r, ok := h.hosts[key]
+		if !ok {
+			r = &routeStats{histogram: make([]uint64, len(latencyBuckets)+1)}
+			h.hosts[key] = r
+		}
+		r.requests++
+		r.maxMs = max(r.maxMs, e.UpstreamMs)
+		r.histogram[sort.SearchFloat64s(latencyBuckets, e.UpstreamMs)]++
+	}
+}
+
+// Take returns the latency of every host recorded since the last call,
+// ordered by cluster and host, and starts over
+func (h *HostLatencies) Take() []HostLatency {
+	h.mu.Lock()
+	hosts := h.hosts
+	h.hosts = make(map[hostKey]*routeStats)
+	h.mu.Unlock()
+
+	latencies := make([]HostLatency, 0, len(hosts))
+	for key, r := range hosts {
+		latencies = append(latencies, HostLatency{
+			Cluster:  key.cluster,
+			Host:     key.host,
+			Requests: r.requests,
+			P95Ms:    r.percentile(0.95),
+		})
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		if latencies[i].Cluster != latencies[j].Cluster {
+			return latencies[i].Cluster < latencies[j].Cluster
+		}
+		return latencies[i].Host < latencies[j].Host
+	})
+	return latencies
+}
@@ -0,0 +1,30 @@
+package accesslog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHostLatencies_Take(t *testing.T) {
+	h := NewHostLatencies()
+	var entries []Entry
+	for i := range 100 {
+		entries = append(entries, Entry{Cluster: "cluster_lb-1", UpstreamHost: "10.0.0.1:80", UpstreamMs: float64(i%20 + 1)})
+	}
+	entries = append(entries,
+		Entry{Cluster: "cluster_lb-1", UpstreamHost: "10.0.0.2:80", UpstreamMs: 400},
+		Entry{Cluster: "cluster_lb-1", Status: 503}, // no backend host
+	)
+	h.Record(entries)
+
+	want := []HostLatency{
+		{Cluster: "cluster_lb-1", Host: "10.0.0.1:80", Requests: 100, P95Ms: 25},
+		{Cluster: "cluster_lb-1", Host: "10.0.0.2:80", Requests: 1, P95Ms: 500},
+	}
+	if got := h.Take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Take() = %+v, want %+v", got, want)
+	}
+	if got := h.Take(); len(got) != 0 {
+		t.Errorf("Take() = %+v, want nothing since the last call", got)
+	}
+}
@@ -0,0 +1,270 @@
+package accesslog
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+// errMalformed is returned for messages that are not valid protobuf
+var errMalformed = errors.New("malformed protobuf message")
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Field numbers of the Envoy access log messages that are decoded; the rest
+// of each message is skipped. See envoy/service/accesslog/v3/als.proto and
+// envoy/data/accesslog/v3/accesslog.proto.
+const (
+	fieldStreamHTTPLogs = 2 // StreamAccessLogsMessage.http_logs
+	fieldLogEntry       = 1 // HTTPAccessLogEntries.log_entry
+
+	fieldEntryCommon   = 1 // HTTPAccessLogEntry.common_properties
+	fieldEntryRequest  = 3 // HTTPAccessLogEntry.request
+	fieldEntryResponse = 4 // HTTPAccessLogEntry.response
+
+	fieldCommonRemoteAddress   = 2  // AccessLogCommon.downstream_remote_address
+	fieldCommonStartTime       = 5  // AccessLogCommon.start_time
+	fieldCommonUpstreamRxByte  = 10 // AccessLogCommon.time_to_last_upstream_rx_byte
+	fieldCommonLastTxByte      = 12 // AccessLogCommon.time_to_last_downstream_tx_byte
+	fieldCommonUpstreamAddress = 13 // AccessLogCommon.upstream_remote_address
+	fieldCommonUpstreamCluster = 15 // AccessLogCommon.upstream_cluster
+	fieldCommonRouteName       = 19 // AccessLogCommon.route_name
+	fieldCommonDuration        = 23 // AccessLogCommon.duration, Envoy 1.28+
+
+	fieldRequestMethod    = 1  // HTTPRequestProperties.request_method
+	fieldRequestAuthority = 3  // HTTPRequestProperties.authority
+	fieldRequestPath      = 5  // HTTPRequestProperties.path
+	fieldRequestHeaders   = 11 // HTTPRequestProperties.request_headers_bytes
+	fieldRequestBody      = 12 // HTTPRequestProperties.request_body_bytes
+
+	fieldResponseCode    = 1 // HTTPResponseProperties.response_code
+	fieldResponseHeaders = 2 // HTTPResponseProperties.response_headers_bytes
+	fieldResponseBody    = 3 // HTTPResponseProperties.response_body_bytes
+
+	fieldAddressSocket = 1 // Address.socket_address
+	fieldSocketAddress = 2 // SocketAddress.address
+	fieldSocketPort    = 3 // SocketAddress.port_value
+)
+
+// requestMethods names the values of envoy.config.core.v3.RequestMethod
+var requestMethods = []string{"", "GET", "HEAD", "POST", "PUT", "DELETE", "CONNECT", "OPTIONS", "TRACE", "PATCH"}
+
+// field is one decoded protobuf field: value for varint and fixed types,
+// data for length-delimited ones
+type field struct {
+	num   int
+	wire  int
+	value uint64
+	data  []byte
+}
+
+// eachField calls fn for every field of an encoded message
+func eachField(msg []byte, fn func(f field) error) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errMalformed
+		}
+		msg = msg[n:]
+		f := field{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			f.value, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return errMalformed
+			}
+			msg = msg[n:]
+		case wireFixed64:
+			if len(msg) < 8 {
+				return errMalformed
+			}
+			f.value, msg = binary.LittleEndian.Uint64(msg), msg[8:]
+		case wireFixed32:
+			if len(msg) < 4 {
+				return errMalformed
+			}
+			f.value, msg = uint64(binary.LittleEndian.Uint32(msg)), msg[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || size > uint64(len(msg)-n) {
+				return errMalformed
+			}
+			f.data, msg = msg[n:n+int(size)], msg[n+int(size):]
+		default:
+			return errMalformed
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeStreamMessage returns the HTTP access log entries of a
+// StreamAccessLogsMessage; TCP entries are ignored
+func decodeStreamMessage(msg []byte) ([]Entry, error) {
+	var entries []Entry
+	err := eachField(msg, func(f field) error {
+		if f.num != fieldStreamHTTPLogs || f.wire != wireBytes {
+			return nil
+		}
+		return eachField(f.data, func(f field) error {
+			if f.num != fieldLogEntry || f.wire != wireBytes {
+				return nil
+			}
+			entry, err := decodeHTTPEntry(f.data)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	return entries, err
+}
+
+// decodeHTTPEntry decodes an HTTPAccessLogEntry
+func decodeHTTPEntry(msg []byte) (Entry, error) {
+	var e Entry
+	var lastTxByte, duration time.Duration
+	err := eachField(msg, func(f field) error {
+		if f.wire != wireBytes {
+			return nil
+		}
+		switch f.num {
+		case fieldEntryCommon:
+			return eachField(f.data, func(f field) error {
+				if f.wire != wireBytes {
+					return nil
+				}
+				var err error
+				switch f.num {
+				case fieldCommonStartTime:
+					var seconds, nanos int64
+					seconds, nanos, err = decodeSecondsNanos(f.data)
+					e.Time = time.Unix(seconds, nanos).UTC()
+				case fieldCommonLastTxByte:
+					lastTxByte, err = decodeDuration(f.data)
+				case fieldCommonUpstreamRxByte:
+					var upstream time.Duration
+					upstream, err = decodeDuration(f.data)
+					e.UpstreamMs = float64(upstream) / float64(time.Millisecond)
+				case fieldCommonUpstreamAddress:
+					var ip string
+					var port uint64
+					if ip, port, err = decodeSocketAddress(f.data); ip != "" {
+						e.UpstreamHost = net.JoinHostPort(ip, strconv.FormatUint(port, 10))
+					}
+				case fieldCommonDuration:
+					duration, err = decodeDuration(f.data)
+				case fieldCommonUpstreamCluster:
+					e.Cluster = string(f.data)
+				case fieldCommonRouteName:
+					e.Route = string(f.data)
+				case fieldCommonRemoteAddress:
+					e.ClientIP, err = decodeAddress(f.data)
+				}
+				return err
+			})
+		case fieldEntryRequest:
+			return eachField(f.data, func(f field) error {
+				switch {
+				case f.num == fieldRequestMethod && f.wire == wireVarint:
+					if f.value < uint64(len(requestMethods)) {
+						e.Method = requestMethods[f.value]
+					}
+				case f.num == fieldRequestAuthority && f.wire == wireBytes:
+					e.Authority = string(f.data)
+				case f.num == fieldRequestPath && f.wire == wireBytes:
+					e.Path = string(f.data)
+				case (f.num == fieldRequestHeaders || f.num == fieldRequestBody) && f.wire == wireVarint:
+					e.BytesReceived += f.value
+				}
+				return nil
+			})
+		case fieldEntryResponse:
+			return eachField(f.data, func(f field) error {
+				switch {
+				case (f.num == fieldResponseHeaders || f.num == fieldResponseBody) && f.wire == wireVarint:
+					e.BytesSent += f.value
+				case f.num == fieldResponseCode && f.wire == wireBytes:
+					// google.protobuf.UInt32Value
+					return eachField(f.data, func(f field) error {
+						if f.num == 1 && f.wire == wireVarint {
+							e.Status = int(f.value)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+
+	// The total duration is only sent by newer Envoy releases
+	if duration == 0 {
+		duration = lastTxByte
+	}
+	e.DurationMs = float64(duration) / float64(time.Millisecond)
+	return e, err
+}
+
+// decodeAddress returns the IP of an envoy.config.core.v3.Address, or ""
+// for pipes and internal addresses
+func decodeAddress(msg []byte) (string, error) {
+	ip, _, err := decodeSocketAddress(msg)
+	return ip, err
+}
+
+// decodeSocketAddress returns the IP and port of an
+// envoy.config.core.v3.Address, or "" for pipes and internal addresses
+func decodeSocketAddress(msg []byte) (ip string, port uint64, err error) {
+	err = eachField(msg, func(f field) error {
+		if f.num != fieldAddressSocket || f.wire != wireBytes {
+			return nil
+		}
+		return eachField(f.data, func(f field) error {
+			switch {
+			case f.num == fieldSocketAddress && f.wire == wireBytes:
+				ip = string(f.data)
+			case f.num == fieldSocketPort && f.wire == wireVarint:
+				port = f.value
+			}
+			return nil
+		})
+	})
+	return ip, port, err
+}
+
+// decodeDuration decodes a google.protobuf.Duration
+func decodeDuration(msg []byte) (time.Duration, error) {
+	seconds, nanos, err := decodeSecondsNanos(msg)
+	return time.Duration(seconds)*time.Second + time.Duration(nanos), err
+}
+
+// decodeSecondsNanos decodes the fields shared by google.protobuf.Duration
+// and google.protobuf.Timestamp
+func decodeSecondsNanos(msg []byte) (seconds, nanos int64, err error) {
+	err = eachField(msg, func(f field) error {
+		if f.wire != wireVarint {
+			return nil
+		}
+		switch f.num {
+		case 1:
+			seconds = int64(f.value)
+		case 2:
+			nanos = int64(int32(f.value))
+		}
+		return nil
+	})
+	return seconds, nanos, err
+}
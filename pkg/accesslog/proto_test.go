@@ -0,0 +1,146 @@
+package accesslog
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// message encodes protobuf fields for tests
+type message []byte
+
+func (m message) key(num, wire int) message {
+	return binary.AppendUvarint(m, uint64(num<<3|wire))
+}
+
+func (m message) varint(num int, v uint64) message {
+	return binary.AppendUvarint(m.key(num, wireVarint), v)
+}
+
+func (m message) bytes(num int, data []byte) message {
+	m = binary.AppendUvarint(m.key(num, wireBytes), uint64(len(data)))
+	return append(m, data...)
+}
+
+func (m message) str(num int, s string) message {
+	return m.bytes(num, []byte(s))
+}
+
+// secondsNanos encodes a google.protobuf.Duration or Timestamp
+func secondsNanos(seconds, nanos uint64) []byte {
+	return message{}.varint(1, seconds).varint(2, nanos)
+}
+
+// testEntry describes an HTTPAccessLogEntry to encode
+type testEntry struct {
+	route, cluster, authority, path, clientIP, upstreamIP string
+	method, status                                        uint64
+	duration, lastTxByte, upstreamRxByte                  time.Duration
+	bytesReceived, bytesSent                              uint64 // split evenly over headers and body
+}
+
+func (e testEntry) encode() []byte {
+	common := message{}.
+		bytes(fieldCommonStartTime, secondsNanos(1767225600, 500)).
+		str(fieldCommonUpstreamCluster, e.cluster).
+		str(fieldCommonRouteName, e.route).
+		varint(99, 7) // unknown fields are skipped
+	if e.clientIP != "" {
+		socket := message{}.varint(1, 0).str(2, e.clientIP).varint(3, 51234)
+		common = common.bytes(fieldCommonRemoteAddress, message{}.bytes(fieldAddressSocket, socket))
+	}
+	if e.upstreamIP != "" {
+		socket := message{}.str(2, e.upstreamIP).varint(3, 8080)
+		common = common.bytes(fieldCommonUpstreamAddress, message{}.bytes(fieldAddressSocket, socket))
+	}
+	if e.upstreamRxByte > 0 {
+		common = common.bytes(fieldCommonUpstreamRxByte, secondsNanos(uint64(e.upstreamRxByte/time.Second), uint64(e.upstreamRxByte%time.Second)))
+	}
+	if e.duration > 0 {
+		common = common.bytes(fieldCommonDuration, secondsNanos(uint64(e.duration/time.Second), uint64(e.duration%time.Second)))
+	}
+	if e.lastTxByte > 0 {
+		common = common.bytes(fieldCommonLastTxByte, secondsNanos(uint64(e.lastTxByte/time.Second), uint64(e.lastTxByte%time.Second)))
+	}
+	request := message{}.varint(fieldRequestMethod, e.method).str(fieldRequestAuthority, e.authority).str(fieldRequestPath, e.path).
+		varint(fieldRequestHeaders, e.bytesReceived/2).varint(fieldRequestBody, e.bytesReceived-e.bytesReceived/2)
+	response := message{}.varint(fieldResponseHeaders, e.bytesSent/2).varint(fieldResponseBody, e.bytesSent-e.bytesSent/2)
+	if e.status > 0 {
+		response = response.bytes(fieldResponseCode, message{}.varint(1, e.status))
+	}
+	return message{}.bytes(fieldEntryCommon, common).bytes(fieldEntryRequest, request).bytes(fieldEntryResponse, response)
+}
+
+// streamMessage encodes a StreamAccessLogsMessage with an identifier, a
+// TCP entry and the given HTTP entries
+func streamMessage(entries ...testEntry) []byte {
+	httpLogs := message{}
+	for _, e := range entries {
+		httpLogs = httpLogs.bytes(fieldLogEntry, e.encode())
+	}
+	return message{}.
+		bytes(1, message{}.str(2, "listener_http_80")).
+		bytes(fieldStreamHTTPLogs, httpLogs).
+		bytes(3, message{}.bytes(1, message{}.bytes(1, nil)))
+}
+
+func TestDecodeStreamMessage(t *testing.T) {
+	start := time.Unix(1767225600, 500).UTC()
+	tests := []struct {
+		name    string
+		msg     []byte
+		want    []Entry
+		wantErr bool
+	}{
+		{
+			name: "http entries",
+			msg: streamMessage(
+				testEntry{route: "api", cluster: "cluster_lb-1_api", method: 3, authority: "shop.example.com", path: "/api/cart", status: 201, duration: 42 * time.Millisecond,
+					clientIP: "203.0.113.7", bytesReceived: 731, bytesSent: 2048},
+				testEntry{status: 503, method: 1, path: "/", duration: 1500 * time.Millisecond},
+			),
+			want: []Entry{
+				{Time: start, Route: "api", Cluster: "cluster_lb-1_api", ClientIP: "203.0.113.7", Method: "POST", Authority: "shop.example.com", Path: "/api/cart",
+					Status: 201, DurationMs: 42, BytesReceived: 731, BytesSent: 2048},
+				{Time: start, Method: "GET", Path: "/", Status: 503, DurationMs: 1500},
+			},
+		},
+		{
+			name: "upstream host",
+			msg:  streamMessage(testEntry{cluster: "cluster_lb-1", method: 1, status: 200, duration: 30 * time.Millisecond, upstreamIP: "10.0.0.1", upstreamRxByte: 25 * time.Millisecond}),
+			want: []Entry{{Time: start, Cluster: "cluster_lb-1", Method: "GET", Status: 200, DurationMs: 30, UpstreamHost: "10.0.0.1:8080", UpstreamMs: 25}},
+		},
+		{
+			name: "duration falls back to the last byte sent",
+			msg:  streamMessage(testEntry{route: "api", method: 1, status: 200, lastTxByte: 8 * time.Millisecond}),
+			want: []Entry{{Time: start, Route: "api", Method: "GET", Status: 200, DurationMs: 8}},
+		},
+		{
+			name: "no response",
+			msg:  streamMessage(testEntry{route: "api", method: 9, duration: time.Millisecond}),
+			want: []Entry{{Time: start, Route: "api", Method: "PATCH", DurationMs: 1}},
+		},
+		{
+			name: "identifier only",
+			msg:  message{}.bytes(1, message{}.str(2, "listener_http_80")),
+		},
+		{
+			name:    "truncated",
+			msg:     streamMessage(testEntry{route: "api"})[:25],
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeStreamMessage(tt.msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeStreamMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeStreamMessage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package accesslog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// StreamAccessLogsPath is the gRPC method Envoy streams access logs to
+const StreamAccessLogsPath = "/envoy.service.accesslog.v3.AccessLogService/StreamAccessLogs"
+
+// maxMessageSize bounds a single access log message, as gRPC does by default
+const maxMessageSize = 4 << 20
+
+// gRPC status codes sent in the grpc-status trailer
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcUnimplemented   = 12
+)
+
+// Recorder consumes decoded access log entries
+type Recorder interface {
+	Record(entries []Entry)
+}
+
+// Receiver is the gRPC Access Log Service. It serves the StreamAccessLogs
+// client stream over HTTP/2 and hands every batch of HTTP entries to the
+// recorder; TCP entries are ignored.
+type Receiver struct {
+	recorder Recorder
+}
+
+// NewReceiver creates a receiver recording into recorder
+func NewReceiver(recorder Recorder) *Receiver {
+	return &Receiver{recorder: recorder}
+}
+
+// ServeHTTP reads length-prefixed messages until Envoy closes the stream.
+// gRPC needs HTTP/2, so the server must accept it, also without TLS.
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost || req.URL.Path != StreamAccessLogsPath {
+		writeStatus(w, grpcUnimplemented, "unknown method "+req.URL.Path)
+		return
+	}
+
+	body := bufio.NewReader(req.Body)
+	var prefix [5]byte
+	for {
+		if _, err := io.ReadFull(body, prefix[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				writeStatus(w, grpcOK, "")
+			} else if req.Context().Err() == nil {
+				log.Printf("Warning: Access log stream from %s ended: %v", req.RemoteAddr, err)
+			}
+			return
+		}
+		// Compressed messages are never sent as no compression was negotiated
+		if prefix[0] != 0 {
+			writeStatus(w, grpcUnimplemented, "compressed messages are not supported")
+			return
+		}
+		size := binary.BigEndian.Uint32(prefix[1:])
+		if size > maxMessageSize {
+			writeStatus(w, grpcInvalidArgument, fmt.Sprintf("message of %d bytes exceeds %d", size, maxMessageSize))
+			return
+		}
+		msg := make([]byte, size)
+		if _, err := io.ReadFull(body, msg); err != nil {
+			log.Printf("Warning: Access log stream from %s ended: %v", req.RemoteAddr, err)
+			return
+		}
+
+		entries, err := decodeStreamMessage(msg)
+		if err != nil {
+			writeStatus(w, grpcInvalidArgument, err.Error())
+			return
+		}
+		if len(entries) > 0 {
+			r.recorder.Record(entries)
+		}
+	}
+}
+
+// writeStatus ends the gRPC call with a trailers-only response
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", message)
+	}
+	w.WriteHeader(http.StatusOK)
+}
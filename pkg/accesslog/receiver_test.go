@@ -0,0 +1,72 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// frame prefixes msg with the gRPC message header
+func frame(msg []byte) []byte {
+	header := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(header[1:], uint32(len(msg)))
+	return append(header, msg...)
+}
+
+func TestReceiver_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		body        []byte
+		wantStatus  string
+		wantEntries int
+	}{
+		{
+			name:        "stream of messages",
+			path:        StreamAccessLogsPath,
+			body:        append(frame(streamMessage(testEntry{route: "api", status: 200})), frame(streamMessage(testEntry{}, testEntry{}))...),
+			wantStatus:  "0",
+			wantEntries: 3,
+		},
+		{
+			name:       "empty stream",
+			path:       StreamAccessLogsPath,
+			wantStatus: "0",
+		},
+		{
+			name:       "compressed message",
+			path:       StreamAccessLogsPath,
+			body:       append([]byte{1}, frame(nil)[1:]...),
+			wantStatus: "12",
+		},
+		{
+			name:       "malformed message",
+			path:       StreamAccessLogsPath,
+			body:       frame([]byte{0xff}),
+			wantStatus: "3",
+		},
+		{
+			name:       "unknown method",
+			path:       "/envoy.service.accesslog.v3.AccessLogService/Other",
+			wantStatus: "12",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregator := NewAggregator(10)
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			NewReceiver(aggregator).ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Grpc-Status"); got != tt.wantStatus {
+				t.Errorf("grpc-status = %q, want %q (%s)", got, tt.wantStatus, rec.Header().Get("Grpc-Message"))
+			}
+			if got := len(aggregator.TakeSamples()); got != tt.wantEntries {
+				t.Errorf("recorded %d entries, want %d", got, tt.wantEntries)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package accesslog
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Top talker defaults
+const (
+	// DefaultTalkersWindow is the sliding window clients are ranked over
+	DefaultTalkersWindow = 5 * time.Minute
+	// DefaultMaxClients bounds the clients tracked per time slot, so a flood
+	// of spoofed or distinct addresses cannot exhaust memory
+	DefaultMaxClients = 10000
+)
+
+// talkerSlots is the number of time slots the window is divided into; the
+// window slides by one slot at a time
+const talkerSlots = 10
+
+// Orderings of the top talkers
+const (
+	ByRequests = "requests"
+	ByBytes    = "bytes"
+)
+
+// ClientStats is the traffic of one client address within the window
+type ClientStats struct {
+	ClientIP      string `json:"client_ip"`
+	Requests      uint64 `json:"requests"`
+	Errors        uint64 `json:"errors"`
+	BytesReceived uint64 `json:"bytes_received"`
+	BytesSent     uint64 `json:"bytes_sent"`
+}
+
+// Bytes is the traffic in both directions
+func (c *ClientStats) Bytes() uint64 {
+	return c.BytesReceived + c.BytesSent
+}
+
+// talkerSlot counts the clients seen during one slot of the window
+type talkerSlot struct {
+	start    time.Time
+	clients  map[string]*ClientStats
+	untraced uint64 // requests of clients over the limit
+}
+
+// Talkers ranks client addresses by requests and bandwidth over a sliding
+// window. Requests without a client address (e.g. over a Unix socket) are
+// not counted.
+type Talkers struct {
+	mu         sync.Mutex
+	window     time.Duration
+	slotWidth  time.Duration
+	maxClients int
+	slots      [talkerSlots]talkerSlot
+	now        func() time.Time
+}
+
+// NewTalkers creates a tracker over window (DefaultTalkersWindow when 0)
+// following up to maxClients addresses per slot (DefaultMaxClients when 0)
+func NewTalkers(window time.Duration, maxClients int) *Talkers {
+	if window <= 0 {
+		window = DefaultTalkersWindow
+	}
+	if maxClients <= 0 {
+		maxClients = DefaultMaxClients
+	}
+	return &Talkers{
+		window:     window,
+		slotWidth:  window / talkerSlots,
+		maxClients: maxClients,
+		now:        time.Now,
+	}
+}
+
+// Window returns the duration clients are ranked over
+func (t *Talkers) Window() time.Duration {
+	return t.window
+}
+
+// Record counts entries towards their client's traffic in the current slot
+func (t *Talkers) Record(entries []Entry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	start := t.now().Truncate(t.slotWidth)
+	slot := &t.slots[start.UnixNano()/int64(t.slotWidth)%talkerSlots]
+	if !slot.start.Equal(start) {
+		*slot = talkerSlot{start: start, clients: make(map[string]*ClientStats)}
+	}
+
+	for _, e := range entries {
+		if e.ClientIP == "" {
+			continue
+		}
+		c, ok := slot.clients[e.ClientIP]
+		if !ok {
+			if len(slot.clients) >= t.maxClients {
+				slot.untraced++
+				continue
+			}
+			c = &ClientStats{ClientIP: e.ClientIP}
+			slot.clients[e.ClientIP] = c
+		}
+		c.Requests++
+		if e.IsError() {
+			c.Errors++
+		}
+		c.BytesReceived += e.BytesReceived
+		c.BytesSent += e.BytesSent
+	}
+}
+
+// Top returns up to n clients of the window with the most requests, or the
+// most bytes with ByBytes, and the number of requests from clients that
+// were over the tracking limit
+func (t *Talkers) Top(n int, by string) ([]ClientStats, uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	since := t.now().Add(-t.window)
+	totals := make(map[string]*ClientStats)
+	var untraced uint64
+	for i := range t.slots {
+		slot := &t.slots[i]
+		if slot.clients == nil || !slot.start.After(since) {
+			continue
+		}
+		untraced += slot.untraced
+		for ip, c := range slot.clients {
+			total, ok := totals[ip]
+			if !ok {
+				total = &ClientStats{ClientIP: ip}
+				totals[ip] = total
+			}
+			total.Requests += c.Requests
+			total.Errors += c.Errors
+			total.BytesReceived += c.BytesReceived
+			total.BytesSent += c.BytesSent
+		}
+	}
+
+	clients := make([]ClientStats, 0, len(totals))
+	for _, c := range totals {
+		clients = append(clients, *c)
+	}
+	key := func(c *ClientStats) uint64 { return c.Requests }
+	if by == ByBytes {
+		key = (*ClientStats).Bytes
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		if ki, kj := key(&clients[i]), key(&clients[j]); ki != kj {
+			return ki > kj
+		}
+		return clients[i].ClientIP < clients[j].ClientIP
+	})
+	if len(clients) > n {
+		clients = clients[:n]
+	}
+	return clients, untraced
+}
+
+// Recorders hands entries to every recorder in turn
+type Recorders []Recorder
+
+// Record records entries with every recorder
+func (r Recorders) Record(entries []Entry) {
+	for _, recorder := range r {
+		recorder.Record(entries)
+	}
+}
@@ -0,0 +1,70 @@
+package accesslog
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTalkers_Top(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	talkers := NewTalkers(time.Minute, 3)
+	talkers.now = func() time.Time { return now }
+
+	// A client seen only before the window slides out of it
+	talkers.Record([]Entry{{ClientIP: "198.51.100.1", Status: 200}})
+	now = now.Add(50 * time.Second)
+	talkers.Record([]Entry{
+		{ClientIP: "203.0.113.7", Status: 200, BytesReceived: 100, BytesSent: 100},
+		{ClientIP: "203.0.113.7", Status: 503, BytesReceived: 100, BytesSent: 100},
+		{ClientIP: "203.0.113.9", Status: 200, BytesReceived: 500, BytesSent: 50000},
+		{Status: 200}, // no client address
+	})
+	now = now.Add(20 * time.Second)
+	talkers.Record([]Entry{
+		{ClientIP: "203.0.113.7", Status: 200, BytesReceived: 100, BytesSent: 100},
+		{ClientIP: "192.0.2.1", Status: 200},
+		{ClientIP: "192.0.2.2", Status: 200},
+		{ClientIP: "192.0.2.3", Status: 200}, // over the limit of 3 per slot
+	})
+
+	tests := []struct {
+		by           string
+		n            int
+		want         []ClientStats
+		wantUntraced uint64
+	}{
+		{
+			by: ByRequests,
+			n:  2,
+			want: []ClientStats{
+				{ClientIP: "203.0.113.7", Requests: 3, Errors: 1, BytesReceived: 300, BytesSent: 300},
+				{ClientIP: "192.0.2.1", Requests: 1},
+			},
+			wantUntraced: 1,
+		},
+		{
+			by: ByBytes,
+			n:  1,
+			want: []ClientStats{
+				{ClientIP: "203.0.113.9", Requests: 1, BytesReceived: 500, BytesSent: 50000},
+			},
+			wantUntraced: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			got, untraced := talkers.Top(tt.n, tt.by)
+			if !reflect.DeepEqual(got, tt.want) || untraced != tt.wantUntraced {
+				t.Errorf("Top(%d, %s) = %+v, %d untraced, want %+v, %d", tt.n, tt.by, got, untraced, tt.want, tt.wantUntraced)
+			}
+		})
+	}
+
+	// Everything slides out of the window
+	now = now.Add(2 * time.Minute)
+	if got, _ := talkers.Top(10, ByRequests); len(got) != 0 {
+		t.Errorf("Top() after the window = %+v, want none", got)
+	}
+}
@@ -0,0 +1,263 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/accesslog"
+)
+
+// AccessLogServiceConfig configures the gRPC access log service Envoy
+// streams the access logs of HTTP listeners to
+type AccessLogServiceConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	ListenAddress   string        `yaml:"listen_address"`   // default 127.0.0.1:9903
+	ForwardInterval time.Duration `yaml:"forward_interval"` // how often samples are sent to VPSie; 0 keeps them local
+	SampleSize      int           `yaml:"sample_size"`      // latest requests kept per forward interval (default 100)
+	TalkersWindow   time.Duration `yaml:"talkers_window"`   // window top talkers are ranked over (default 5m)
+	TopTalkers      int           `yaml:"top_talkers"`      // clients per ranking in reports and by default on the admin API (default 10)
+}
+
+// Default access log service settings applied by LoadConfig
+const (
+	defaultAccessLogServiceAddress = "127.0.0.1:9903"
+	defaultTopTalkers              = 10
+)
+
+// Access log service bounds enforced by Validate
+const (
+	minAccessLogForwardInterval = 10 * time.Second
+	maxAccessLogForwardInterval = time.Hour
+	maxAccessLogSampleSize      = 10000
+	minTalkersWindow            = time.Minute
+	maxTalkersWindow            = time.Hour
+	maxTopTalkers               = 1000
+)
+
+// setDefaults fills in unset access log service settings
+func (c *AccessLogServiceConfig) setDefaults() {
+	if c.ListenAddress == "" {
+		c.ListenAddress = defaultAccessLogServiceAddress
+	}
+	if c.SampleSize == 0 {
+		c.SampleSize = accesslog.DefaultSampleSize
+	}
+	if c.TalkersWindow == 0 {
+		c.TalkersWindow = accesslog.DefaultTalkersWindow
+	}
+	if c.TopTalkers == 0 {
+		c.TopTalkers = defaultTopTalkers
+	}
+}
+
+// validate checks the access log service settings
+func (c *AccessLogServiceConfig) validate() []error {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []error
+	if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
+		errs = append(errs, fmt.Errorf("access_log_service.listen_address %q must be host:port: %w", c.ListenAddress, err))
+	}
+	if c.ForwardInterval != 0 && (c.ForwardInterval < minAccessLogForwardInterval || c.ForwardInterval > maxAccessLogForwardInterval) {
+		errs = append(errs, fmt.Errorf("access_log_service.forward_interval %s is out of range: must be 0 or between %s and %s",
+			c.ForwardInterval, minAccessLogForwardInterval, maxAccessLogForwardInterval))
+	}
+	if c.SampleSize < 1 || c.SampleSize > maxAccessLogSampleSize {
+		errs = append(errs, fmt.Errorf("access_log_service.sample_size %d is out of range: must be between 1 and %d",
+			c.SampleSize, maxAccessLogSampleSize))
+	}
+	if c.TalkersWindow < minTalkersWindow || c.TalkersWindow > maxTalkersWindow {
+		errs = append(errs, fmt.Errorf("access_log_service.talkers_window %s is out of range: must be between %s and %s",
+			c.TalkersWindow, minTalkersWindow, maxTalkersWindow))
+	}
+	if c.TopTalkers < 1 || c.TopTalkers > maxTopTalkers {
+		errs = append(errs, fmt.Errorf("access_log_service.top_talkers %d is out of range: must be between 1 and %d",
+			c.TopTalkers, maxTopTalkers))
+	}
+	return errs
+}
+
+// envoyAddress returns the address Envoy connects to: the listen address,
+// with loopback in place of an unspecified host
+func (c *AccessLogServiceConfig) envoyAddress() string {
+	return loopbackAddress(c.ListenAddress)
+}
+
+// loopbackAddress returns address with loopback in place of an unspecified
+// host, for node-local services Envoy connects to
+func loopbackAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// AccessLogReport is a batch of per-route metrics, recent requests and the
+// clients sending the most traffic
+type AccessLogReport struct {
+	Routes     []accesslog.RouteStats `json:"routes"`
+	Samples    []accesslog.Entry      `json:"samples"`
+	TopClients *TopTalkersReport      `json:"top_clients,omitempty"`
+	HARole     string                 `json:"ha_role,omitempty"`
+}
+
+// TopTalkersReport ranks the clients of the talkers window
+type TopTalkersReport struct {
+	WindowSeconds int                     `json:"window_seconds"`
+	ByRequests    []accesslog.ClientStats `json:"by_requests"`
+	ByBytes       []accesslog.ClientStats `json:"by_bytes"`
+	Untracked     uint64                  `json:"untracked_requests,omitempty"` // from clients over the tracking limit
+}
+
+// topTalkers ranks the n clients with the most requests and the most bytes
+func (a *Agent) topTalkers(n int) *TopTalkersReport {
+	byRequests, untracked := a.talkers.Top(n, accesslog.ByRequests)
+	byBytes, _ := a.talkers.Top(n, accesslog.ByBytes)
+	return &TopTalkersReport{
+		WindowSeconds: int(a.talkers.Window().Seconds()),
+		ByRequests:    byRequests,
+		ByBytes:       byBytes,
+		Untracked:     untracked,
+	}
+}
+
+// accessLogReporter is implemented by event reporters that accept access log reports
+type accessLogReporter interface {
+	ReportAccessLogs(ctx context.Context, report *AccessLogReport) error
+}
+
+// ReportAccessLogs sends per-route metrics and sampled requests to VPSie
+func (c *VPSieClient) ReportAccessLogs(ctx context.Context, report *AccessLogReport) error {
+	reqURL := fmt.Sprintf("%s/loadbalancers/%s/access-logs", c.baseURL, sanitizeID(c.loadBalancerID))
+	return c.doJSON(ctx, http.MethodPost, reqURL, report, nil)
+}
+
+// accessLogRecorders returns everything the access logs are recorded into
+func (a *Agent) accessLogRecorders() accesslog.Recorders {
+	recorders := accesslog.Recorders{a.accessLogs, a.talkers}
+	if a.hostLatency != nil {
+		recorders = append(recorders, a.hostLatency)
+	}
+	return recorders
+}
+
+// runAccessLogService serves the gRPC access log service until ctx is
+// cancelled and forwards samples to VPSie when configured
+func (a *Agent) runAccessLogService(ctx context.Context, cfg AccessLogServiceConfig) {
+	// Envoy speaks gRPC over cleartext HTTP/2 with prior knowledge
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	server := &http.Server{
+		Addr:              cfg.ListenAddress,
+		Handler:           accesslog.NewReceiver(a.accessLogRecorders()),
+		Protocols:         protocols,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	// Envoy keeps its log streams open, so they are closed rather than drained
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	if cfg.ForwardInterval > 0 {
+		if reporter, ok := a.events.(accessLogReporter); ok {
+			go a.forwardAccessLogs(ctx, reporter, cfg.ForwardInterval, cfg.TopTalkers)
+		} else {
+			log.Printf("Warning: Access log samples are only forwarded in %s source mode", SourceModeAPI)
+		}
+	}
+
+	log.Printf("Access log service listening on %s", cfg.ListenAddress)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Warning: Access log service stopped: %v", err)
+	}
+}
+
+// forwardAccessLogs sends the route metrics, the requests sampled since the
+// previous report and the top talkers every interval. Intervals without
+// requests are skipped.
+func (a *Agent) forwardAccessLogs(ctx context.Context, reporter accessLogReporter, interval time.Duration, topTalkers int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		samples := a.accessLogs.TakeSamples()
+		if len(samples) == 0 {
+			continue
+		}
+		report := &AccessLogReport{
+			Routes:     a.accessLogs.Stats(),
+			Samples:    samples,
+			TopClients: a.topTalkers(topTalkers),
+			HARole:     string(a.Role()),
+		}
+		if err := reporter.ReportAccessLogs(ctx, report); err != nil && ctx.Err() == nil {
+			log.Printf("Warning: Failed to forward access logs: %v", err)
+		}
+	}
+}
+
+// handleAccessLogStats serves the per-route metrics of the access log service
+func (a *Agent) handleAccessLogStats(w http.ResponseWriter, _ *http.Request) {
+	if a.accessLogs == nil {
+		http.Error(w, "the access log service is not enabled", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"routes": a.accessLogs.Stats()})
+}
+
+// handleAccessLogTalkers serves the clients with the most requests
+// (?by=requests, default) or bytes (?by=bytes) within the talkers window;
+// ?limit sets how many (default access_log_service.top_talkers)
+func (a *Agent) handleAccessLogTalkers(w http.ResponseWriter, r *http.Request) {
+	if a.talkers == nil {
+		http.Error(w, "the access log service is not enabled", http.StatusNotFound)
+		return
+	}
+	by := r.URL.Query().Get("by")
+	switch by {
+	case "":
+		by = accesslog.ByRequests
+	case accesslog.ByRequests, accesslog.ByBytes:
+	default:
+		http.Error(w, "unsupported ordering: use requests or bytes", http.StatusBadRequest)
+		return
+	}
+	limit := a.currentConfig().AccessLogService.TopTalkers
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxTopTalkers {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxTopTalkers), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	clients, untracked := a.talkers.Top(limit, by)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"window_seconds":     int(a.talkers.Window().Seconds()),
+		"by":                 by,
+		"clients":            clients,
+		"untracked_requests": untracked,
+	})
+}
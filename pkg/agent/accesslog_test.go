@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/accesslog"
+)
+
+// accessLogMessage is a gRPC-framed StreamAccessLogsMessage with one HTTP
+// entry for route "api" from 203.0.113.7 answered with 200
+var accessLogMessage = []byte{
+	0, 0, 0, 0, 36, // uncompressed, 36 bytes
+	0x12, 0x22, // http_logs
+	0x0a, 0x20, // log_entry
+	0x0a, 0x17, // common_properties
+	0x9a, 0x01, 0x03, 'a', 'p', 'i', // route_name
+	0x12, 0x0f, 0x0a, 0x0d, 0x12, 0x0b, '2', '0', '3', '.', '0', '.', '1', '1', '3', '.', '7', // downstream_remote_address
+	0x22, 0x05, 0x0a, 0x03, 0x08, 0xc8, 0x01, // response.response_code 200
+}
+
+func TestAgent_AccessLogService(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	a := &Agent{
+		config:     &Config{AccessLogService: AccessLogServiceConfig{TopTalkers: 10}},
+		events:     logEventReporter{},
+		accessLogs: accesslog.NewAggregator(10),
+		talkers:    accesslog.NewTalkers(time.Minute, 100),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.runAccessLogService(ctx, AccessLogServiceConfig{Enabled: true, ListenAddress: addr})
+
+	// Envoy streams over cleartext HTTP/2
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}, Timeout: 5 * time.Second}
+
+	var resp *http.Response
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		req, _ := http.NewRequest(http.MethodPost, "http://"+addr+accesslog.StreamAccessLogsPath, bytes.NewReader(accessLogMessage))
+		req.Header.Set("Content-Type", "application/grpc")
+		if resp, err = client.Do(req); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("streaming access logs: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 || resp.Header.Get("Grpc-Status") != "0" {
+		t.Fatalf("response %s grpc-status %q, want HTTP/2 with status 0", resp.Proto, resp.Header.Get("Grpc-Status"))
+	}
+
+	rec := httptest.NewRecorder()
+	a.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/accesslog/stats", nil))
+	var body struct {
+		Routes []accesslog.RouteStats `json:"routes"`
+	}
+	if err = json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid stats %q: %v", rec.Body.String(), err)
+	}
+	if len(body.Routes) != 1 || body.Routes[0].Route != "api" || body.Routes[0].Requests != 1 || body.Routes[0].Errors != 0 {
+		t.Errorf("routes = %+v, want one successful request on api", body.Routes)
+	}
+
+	rec = httptest.NewRecorder()
+	a.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/accesslog/talkers?by=bytes", nil))
+	if want := `"clients":[{"client_ip":"203.0.113.7","requests":1`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("talkers missing %s:\n%s", want, rec.Body.String())
+	}
+}
+
+func TestAgent_HandleAccessLogTalkers(t *testing.T) {
+	a := &Agent{
+		config:  &Config{AccessLogService: AccessLogServiceConfig{TopTalkers: 1}},
+		talkers: accesslog.NewTalkers(time.Minute, 100),
+	}
+	a.talkers.Record([]accesslog.Entry{
+		{ClientIP: "203.0.113.7", Status: 200, BytesSent: 10},
+		{ClientIP: "203.0.113.7", Status: 200, BytesSent: 10},
+		{ClientIP: "203.0.113.9", Status: 200, BytesSent: 1 << 20},
+	})
+
+	tests := []struct {
+		query    string
+		wantCode int
+		want     []string
+	}{
+		{query: "", wantCode: http.StatusOK, want: []string{`"by":"requests"`, `"client_ip":"203.0.113.7"`}},
+		{query: "?by=bytes", wantCode: http.StatusOK, want: []string{`"by":"bytes"`, `"client_ip":"203.0.113.9"`}},
+		{query: "?limit=2", wantCode: http.StatusOK, want: []string{`"client_ip":"203.0.113.7"`, `"client_ip":"203.0.113.9"`}},
+		{query: "?by=errors", wantCode: http.StatusBadRequest},
+		{query: "?limit=0", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			a.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/accesslog/talkers"+tt.query, nil))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("body missing %s:\n%s", want, rec.Body.String())
+				}
+			}
+			if tt.query == "" && strings.Contains(rec.Body.String(), "203.0.113.9") {
+				t.Errorf("body lists more than top_talkers clients:\n%s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAgent_HandleAccessLogStats_Disabled(t *testing.T) {
+	a := &Agent{}
+	rec := httptest.NewRecorder()
+	a.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/accesslog/stats", nil))
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "not enabled") {
+		t.Errorf("status = %d %q, want 404 while disabled", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAccessLogServiceConfig_EnvoyAddress(t *testing.T) {
+	tests := []struct {
+		listen string
+		want   string
+	}{
+		{listen: "127.0.0.1:9903", want: "127.0.0.1:9903"},
+		{listen: "0.0.0.0:9903", want: "127.0.0.1:9903"},
+		{listen: ":9903", want: "127.0.0.1:9903"},
+		{listen: "10.0.0.5:9903", want: "10.0.0.5:9903"},
+	}
+
+	for _, tt := range tests {
+		c := AccessLogServiceConfig{ListenAddress: tt.listen}
+		if got := c.envoyAddress(); got != tt.want {
+			t.Errorf("envoyAddress(%s) = %s, want %s", tt.listen, got, tt.want)
+		}
+	}
+}
+
+// validAccessLogService returns an enabled access log service with defaults
+func validAccessLogService() AccessLogServiceConfig {
+	c := AccessLogServiceConfig{Enabled: true}
+	c.setDefaults()
+	return c
+}
@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// interfaceAddrs lists the addresses of the local network interfaces
+var interfaceAddrs = net.InterfaceAddrs
+
+// checkListenAddresses refuses a configuration whose listener addresses are
+// not assigned to a local interface, so a mistyped VIP fails the sync
+// instead of Envoy's listener. The HA floating IP is accepted on both nodes:
+// the listener binds it with freebind before the node becomes active.
+func (a *Agent) checkListenAddresses(lb *models.LoadBalancer) error {
+	// The addresses of a remote Envoy's host are not known here
+	if len(lb.Addresses) == 0 || a.currentConfig().Envoy.Remote.enabled() {
+		return nil
+	}
+
+	local := make(map[string]bool)
+	addrs, err := interfaceAddrs()
+	if err != nil {
+		return fmt.Errorf("failed to list local addresses: %w", err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			local[ipNet.IP.String()] = true
+		}
+	}
+	if ha := a.currentConfig().HA; ha.Enabled && ha.FloatingIP.Address != "" {
+		if ip := net.ParseIP(ha.FloatingIP.Address); ip != nil {
+			local[ip.String()] = true
+		}
+	}
+
+	var missing []string
+	for _, addr := range lb.Addresses {
+		ip := net.ParseIP(addr)
+		if ip == nil || (!ip.IsUnspecified() && !local[ip.String()]) {
+			missing = append(missing, addr)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("listen addresses %s are not assigned to a local interface", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package agent
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestAgent_CheckListenAddresses(t *testing.T) {
+	original := interfaceAddrs
+	defer func() { interfaceAddrs = original }()
+	interfaceAddrs = func() ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+			&net.IPNet{IP: net.ParseIP("10.0.0.5"), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.ParseIP("2001:db8::5"), Mask: net.CIDRMask(64, 128)},
+		}, nil
+	}
+
+	ha := HAConfig{Enabled: true, FloatingIP: FloatingIPConfig{Address: "203.0.113.10"}}
+
+	tests := []struct {
+		name      string
+		addresses []string
+		ha        HAConfig
+		wantErr   bool
+	}{
+		{name: "default wildcard"},
+		{name: "explicit wildcard", addresses: []string{"::"}},
+		{name: "local addresses", addresses: []string{"10.0.0.5", "2001:db8:0::5"}},
+		{name: "floating IP", addresses: []string{"203.0.113.10"}, ha: ha},
+		{name: "floating IP without HA", addresses: []string{"203.0.113.10"}, wantErr: true},
+		{name: "foreign address", addresses: []string{"10.0.0.5", "10.0.0.6"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Agent{config: &Config{HA: tt.ha}}
+			err := a.checkListenAddresses(&models.LoadBalancer{Addresses: tt.addresses})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkListenAddresses() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/describe"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// AdminConfig contains the agent admin API configuration
+type AdminConfig struct {
+	ListenAddress string `yaml:"listen_address"` // e.g. 127.0.0.1:9902; empty disables the admin API
+	TokenFile     string `yaml:"token_file"`     // bearer token for the Envoy admin proxy, the configuration endpoints and the endpoints changing state; empty disables them
+}
+
+// adminHandler builds the admin API routes
+func (a *Agent) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /config/summary", a.requireAdminToken(a.handleConfigSummary))
+	mux.HandleFunc("GET /config/diff", a.requireAdminToken(a.handleConfigDiff))
+	mux.HandleFunc("POST /sync", a.requireAdminToken(a.handleSync))
+	mux.HandleFunc("GET /reconcile/status", a.handleReconcileStatus)
+	mux.HandleFunc("POST /reconcile/pause", a.requireAdminToken(a.handlePause))
+	mux.HandleFunc("POST /reconcile/resume", a.requireAdminToken(a.handleResume))
+	mux.HandleFunc("GET /approval/status", a.handleApprovalStatus)
+	mux.HandleFunc("POST /approval/approve", a.requireAdminToken(a.handleApprove))
+	mux.HandleFunc("POST /approval/reject", a.requireAdminToken(a.handleReject))
+	mux.HandleFunc("GET /stats/mapping", a.handleStatsMapping)
+	mux.HandleFunc("GET /ha/status", a.handleHAStatus)
+	mux.HandleFunc("GET /canary/status", a.handleCanaryStatus)
+	mux.HandleFunc("GET /autoscale/status", a.handleAutoscaleStatus)
+	mux.HandleFunc("GET /slow-backends/status", a.handleSlowBackendStatus)
+	mux.HandleFunc("GET /ddos/status", a.handleDDoSStatus)
+	mux.HandleFunc("GET /dns/status", a.handleHealthDNSStatus)
+	mux.HandleFunc("GET /gslb/status", a.handleGSLBStatus)
+	mux.HandleFunc("GET /accesslog/stats", a.handleAccessLogStats)
+	mux.HandleFunc("GET /accesslog/talkers", a.handleAccessLogTalkers)
+	mux.HandleFunc("GET /envoy/status", a.handleEnvoyStatus)
+	mux.HandleFunc("GET /backends", a.handleBackends)
+	mux.HandleFunc("GET /probe/status", a.handleProbeStatus)
+	mux.HandleFunc("GET /metrics", a.handleMetrics)
+	mux.HandleFunc("GET /envoy/admin/", a.handleEnvoyAdmin)
+	mux.HandleFunc("GET /schema", handleSchema)
+	mux.HandleFunc("POST /validate", handleValidate)
+	return mux
+}
+
+// requireAdminToken guards an endpoint that changes the agent's state or
+// shows its configuration: it needs the bearer token in admin.token_file, and
+// is forbidden without one
+func (a *Agent) requireAdminToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.authorizeAdmin(w, r, http.StatusForbidden, "this endpoint is disabled: set admin.token_file") {
+			next(w, r)
+		}
+	}
+}
+
+// runAdminServer serves the admin API until ctx is cancelled
+func (a *Agent) runAdminServer(ctx context.Context, addr string) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           a.adminHandler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Admin API listening on %s", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Warning: Admin API stopped: %v", err)
+	}
+}
+
+// handleConfigSummary renders the active load balancer configuration as
+// Markdown (default) or HTML (?format=html)
+func (a *Agent) handleConfigSummary(w http.ResponseWriter, r *http.Request) {
+	lb := a.lastApplied.Load()
+	if lb == nil {
+		http.Error(w, "no configuration has been applied yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	summary := describe.Summarize(lb)
+	switch r.URL.Query().Get("format") {
+	case "html":
+		page, err := summary.HTML()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(page))
+	case "", "markdown", "md":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		_, _ = w.Write([]byte(summary.Markdown()))
+	default:
+		http.Error(w, "unsupported format: use markdown or html", http.StatusBadRequest)
+	}
+}
+
+// Manual sync limits
+const (
+	// minManualSyncInterval rate limits POST /sync, so repeated calls cannot
+	// keep the agent fetching the configuration and reloading Envoy
+	minManualSyncInterval = 10 * time.Second
+	// manualSyncWait bounds how long POST /sync?wait=true waits for the sync
+	manualSyncWait = 30 * time.Second
+)
+
+// manualSyncPollInterval is how often a waiting POST /sync checks for the
+// outcome of the sync
+var manualSyncPollInterval = 100 * time.Millisecond
+
+// syncResult is the response of POST /sync
+type syncResult struct {
+	Triggered bool        `json:"triggered"`
+	Sync      *SyncStatus `json:"sync,omitempty"` // outcome of the triggered sync with ?wait=true
+}
+
+// handleSync syncs the configuration now instead of at the next poll, e.g.
+// right after a load balancer was edited in the VPSie panel. Calls less than
+// minManualSyncInterval apart are answered with 429. The sync runs in the
+// background (202) unless ?wait=true waits for its outcome: 200 when it
+// succeeded, 500 when it failed.
+func (a *Agent) handleSync(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	last := a.lastManualSync.Load()
+	retry := minManualSyncInterval
+	if last != 0 {
+		retry = time.Unix(0, last).Add(minManualSyncInterval).Sub(now)
+	}
+	// A concurrent request may have won the swap
+	if (last != 0 && retry > 0) || !a.lastManualSync.CompareAndSwap(last, now.UnixNano()) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(max(retry, time.Second).Seconds()))))
+		http.Error(w, fmt.Sprintf("a sync was requested less than %s ago", minManualSyncInterval), http.StatusTooManyRequests)
+		return
+	}
+
+	log.Printf("Configuration sync requested through the admin API by %s", r.RemoteAddr)
+	a.TriggerSync()
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Query().Get("wait") != "true" {
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(syncResult{Triggered: true})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), manualSyncWait)
+	defer cancel()
+	ticker := time.NewTicker(manualSyncPollInterval)
+	defer ticker.Stop()
+	for {
+		if status := a.lastSync.Load(); status != nil && !status.Time.Before(now) {
+			code := http.StatusOK
+			if !status.Success {
+				code = http.StatusInternalServerError
+			}
+			w.WriteHeader(code)
+			_ = json.NewEncoder(w).Encode(syncResult{Triggered: true, Sync: status})
+			return
+		}
+		select {
+		case <-ctx.Done():
+			// Still running; the outcome is reported with the next heartbeat
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(syncResult{Triggered: true})
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleStatsMapping serves the names of the statistics Envoy emits for the
+// active load balancer
+func (a *Agent) handleStatsMapping(w http.ResponseWriter, _ *http.Request) {
+	lb := a.lastApplied.Load()
+	if lb == nil {
+		http.Error(w, "no configuration has been applied yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(envoy.NewStatsMapping(lb))
+}
+
+// handleSchema serves the JSON Schema of the load balancer model
+func handleSchema(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(models.Schema())
+}
+
+// validationResult is the response of POST /validate
+type validationResult struct {
+	Error string `json:"error,omitempty"`
+	Valid bool   `json:"valid"`
+}
+
+// handleValidate strictly validates the load balancer definition in the
+// request body. Invalid definitions are answered with 422.
+func handleValidate(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxResponseSize))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	result := validationResult{Valid: true}
+	status := http.StatusOK
+	if _, err = models.ParseLoadBalancer(data); err != nil {
+		result = validationResult{Error: err.Error()}
+		status = http.StatusUnprocessableEntity
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// Describe fetches the configuration from the configured source and returns its summary
+func (a *Agent) Describe(ctx context.Context) (*describe.Summary, error) {
+	lb, err := a.source.GetLoadBalancerConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return describe.Summarize(lb), nil
+}
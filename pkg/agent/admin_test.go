@@ -0,0 +1,484 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestAgent_HandleConfigSummary(t *testing.T) {
+	a := &Agent{config: &Config{Admin: AdminConfig{TokenFile: writeAdminTestToken(t)}}}
+	handler := a.adminHandler()
+
+	// Nothing applied yet
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, authorizedRequest(http.MethodGet, "/config/summary"))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	a.lastApplied.Store(&models.LoadBalancer{
+		ID: "lb-1", Name: "web", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+		Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}},
+	})
+
+	tests := []struct {
+		name     string
+		query    string
+		wantType string
+		wantBody string
+		wantCode int
+	}{
+		{name: "markdown default", query: "", wantCode: http.StatusOK, wantType: "text/markdown", wantBody: "# Load Balancer web (lb-1)"},
+		{name: "html", query: "?format=html", wantCode: http.StatusOK, wantType: "text/html", wantBody: "<h1>Load Balancer web (lb-1)</h1>"},
+		{name: "unsupported format", query: "?format=pdf", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, authorizedRequest(http.MethodGet, "/config/summary"+tt.query))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			if !strings.HasPrefix(rec.Header().Get("Content-Type"), tt.wantType) {
+				t.Errorf("Content-Type = %q, want %s", rec.Header().Get("Content-Type"), tt.wantType)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body missing %q:\n%s", tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+// adminTestToken is the bearer token written by writeAdminTestToken
+const adminTestToken = "s3cret"
+
+// writeAdminTestToken writes adminTestToken to a token file and returns its
+// path, for admin.token_file
+func writeAdminTestToken(t *testing.T) string {
+	t.Helper()
+	tokenFile := filepath.Join(t.TempDir(), "admin-token")
+	if err := os.WriteFile(tokenFile, []byte(adminTestToken+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+	return tokenFile
+}
+
+// authorizedRequest returns an admin API request carrying adminTestToken
+func authorizedRequest(method, path string) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+adminTestToken)
+	return req
+}
+
+func TestAgent_AdminEndpointsNeedToken(t *testing.T) {
+	endpoints := []struct{ method, path string }{
+		{http.MethodGet, "/config/summary"},
+		{http.MethodGet, "/config/diff"},
+		{http.MethodPost, "/sync"},
+		{http.MethodPost, "/reconcile/pause"},
+		{http.MethodPost, "/reconcile/resume"},
+		{http.MethodPost, "/approval/approve?config_hash=hash-1"},
+		{http.MethodPost, "/approval/reject?config_hash=hash-1"},
+	}
+
+	a := &Agent{config: &Config{}, syncCh: make(chan struct{}, 1)}
+	for _, e := range endpoints {
+		rec := httptest.NewRecorder()
+		a.adminHandler().ServeHTTP(rec, authorizedRequest(e.method, e.path))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s without admin.token_file: status = %d, want %d", e.method, e.path, rec.Code, http.StatusForbidden)
+		}
+	}
+
+	a.config.Admin.TokenFile = writeAdminTestToken(t)
+	for _, e := range endpoints {
+		for name, token := range map[string]string{"missing token": "", "wrong token": "guess"} {
+			req := httptest.NewRequest(e.method, e.path, nil)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			a.adminHandler().ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("%s %s with %s: status = %d, want %d", e.method, e.path, name, rec.Code, http.StatusUnauthorized)
+			}
+		}
+	}
+	select {
+	case <-a.syncCh:
+		t.Error("an unauthorized request triggered a sync")
+	default:
+	}
+	if a.paused.Load() != nil {
+		t.Error("an unauthorized request paused reconciliation")
+	}
+}
+
+func TestAgent_HandleSync(t *testing.T) {
+	a := &Agent{
+		config: &Config{Admin: AdminConfig{TokenFile: writeAdminTestToken(t)}},
+		syncCh: make(chan struct{}, 1),
+	}
+	handler := a.adminHandler()
+	post := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, authorizedRequest(http.MethodPost, path))
+		return rec
+	}
+
+	if rec := post("/sync"); rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+	select {
+	case <-a.syncCh:
+	default:
+		t.Fatal("POST /sync did not trigger a sync")
+	}
+
+	// A second request within the interval is rate limited
+	rec := post("/sync")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if retry := rec.Header().Get("Retry-After"); retry != "10" {
+		t.Errorf("Retry-After = %q, want 10", retry)
+	}
+
+	// Waiting returns the outcome of the triggered sync
+	defer func(interval time.Duration) { manualSyncPollInterval = interval }(manualSyncPollInterval)
+	manualSyncPollInterval = time.Millisecond
+	a.lastManualSync.Store(time.Now().Add(-minManualSyncInterval).UnixNano())
+	go func() {
+		<-a.syncCh
+		a.recordSync(errors.New("failed to fetch config: API returned status 503"))
+	}()
+	rec = post("/sync?wait=true")
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if want := `"success":false`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("body missing %s:\n%s", want, rec.Body.String())
+	}
+}
+
+func TestAgent_HandleStatsMapping(t *testing.T) {
+	a := &Agent{}
+	handler := a.adminHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/mapping", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	a.lastApplied.Store(&models.LoadBalancer{
+		ID: "lb-1", Name: "web", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+		Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}},
+	})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/mapping", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	want := `"stat_prefix":"http_80_lb_1","prometheus_label":{"envoy_http_conn_manager_prefix":"http_80_lb_1"},"clusters":{"cluster_lb-1":""}`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("body missing %s:\n%s", want, rec.Body.String())
+	}
+}
+
+func TestAgent_HandleSchemaAndValidate(t *testing.T) {
+	handler := (&Agent{}).adminHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/schema", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"$defs"`) {
+		t.Errorf("GET /schema = %d:\n%s", rec.Code, rec.Body.String())
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		wantBody string
+		wantCode int
+	}{
+		{
+			name:     "valid",
+			body:     `{"id": "lb-1", "name": "web", "protocol": "tcp", "algorithm": "random", "port": 5432, "backends": [{"id": "db-1", "address": "10.0.0.5", "port": 5432, "enabled": true}]}`,
+			wantCode: http.StatusOK,
+			wantBody: `"valid":true`,
+		},
+		{
+			name:     "unknown field",
+			body:     `{"id": "lb-1", "listen": 80}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `unknown field`,
+		},
+		{
+			name:     "invalid",
+			body:     `{"id": "lb-1", "name": "web", "protocol": "udp", "algorithm": "random", "port": 53, "backends": []}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"valid":false`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(tt.body)))
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body missing %q:\n%s", tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAgent_HandleCanaryStatus(t *testing.T) {
+	a := &Agent{events: logEventReporter{}}
+	a.canary = a.newCanaryController(envoy.NewAdminClient("127.0.0.1:9901"))
+
+	backend := models.Backend{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}
+	a.canary.Apply(context.Background(), &models.LoadBalancer{
+		ID: "lb-1",
+		Pools: []models.BackendPool{
+			{Name: "stable", Backends: []models.Backend{backend}},
+			{Name: "canary", Backends: []models.Backend{backend}},
+		},
+		Routes: []models.Route{{Name: "web", Path: "/", Split: &models.TrafficSplit{
+			Targets: []models.SplitTarget{{Pool: "stable", Weight: 90}, {Pool: "canary", Weight: 10}},
+			Rollout: &models.Rollout{Canary: "canary", StepWeight: 10, MaxErrorRate: 1},
+		}}},
+	})
+
+	rec := httptest.NewRecorder()
+	a.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/canary/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	for _, want := range []string{`"route":"web"`, `"phase":"progressing"`, `"canary_weight":10`} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("body missing %s:\n%s", want, rec.Body.String())
+		}
+	}
+}
+
+func TestAgent_HandleAutoscaleStatus(t *testing.T) {
+	a := &Agent{events: logEventReporter{}}
+	a.autoscale = a.newAutoscaleController(envoy.NewAdminClient("127.0.0.1:9901"))
+	a.autoscale.Apply(&models.LoadBalancer{
+		ID:          "lb-1",
+		Backends:    []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+		Autoscaling: &models.Autoscaling{Group: "web-asg", MaxRPSPerBackend: 100},
+	})
+
+	rec := httptest.NewRecorder()
+	a.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/autoscale/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if want := `"group":"web-asg"`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("body missing %s:\n%s", want, rec.Body.String())
+	}
+}
+
+func TestAgent_HandleEnvoyStatus(t *testing.T) {
+	envoyAdmin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/server_info" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"version": "abc/1.31.0/Clean/RELEASE/BoringSSL", "state": "LIVE",
+			"uptime_current_epoch": "60s", "uptime_all_epochs": "3600s",
+			"command_line_options": {"restart_epoch": 4}}`))
+	}))
+	defer envoyAdmin.Close()
+
+	pidFile := filepath.Join(t.TempDir(), "envoy.pid")
+	if err := os.WriteFile(pidFile, []byte("4242\n"), 0600); err != nil {
+		t.Fatalf("failed to write PID file: %v", err)
+	}
+	reloader, err := envoy.NewReloader("/usr/bin/envoy", "/tmp/envoy.yaml", pidFile, "")
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		address  string
+		wantCode int
+		want     []string
+	}{
+		{
+			name:     "running",
+			address:  strings.TrimPrefix(envoyAdmin.URL, "http://"),
+			wantCode: http.StatusOK,
+			want:     []string{`"running":true`, `"state":"LIVE"`, `"restart_epoch":4`, `"pid":4242`, `"uptime_all_epochs_seconds":3600`},
+		},
+		{
+			name:     "unreachable",
+			address:  "127.0.0.1:1",
+			wantCode: http.StatusServiceUnavailable,
+			want:     []string{`"running":false`, `"error":`, `"pid":4242`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Agent{envoyReloader: reloader, envoyAdmin: envoy.NewAdminClient(tt.address)}
+			rec := httptest.NewRecorder()
+			a.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/envoy/status", nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("body missing %s:\n%s", want, rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestAgent_HandleEnvoyAdmin(t *testing.T) {
+	envoyAdmin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(r.URL.Path + "?" + r.URL.RawQuery))
+	}))
+	defer envoyAdmin.Close()
+
+	tokenFile := writeAdminTestToken(t)
+
+	tests := []struct {
+		name      string
+		tokenFile string
+		path      string
+		token     string
+		wantCode  int
+		wantBody  string
+	}{
+		{name: "disabled without token file", path: "/envoy/admin/stats", token: "s3cret", wantCode: http.StatusNotFound},
+		{name: "missing token", tokenFile: tokenFile, path: "/envoy/admin/stats", wantCode: http.StatusUnauthorized},
+		{name: "wrong token", tokenFile: tokenFile, path: "/envoy/admin/stats", token: "guess", wantCode: http.StatusUnauthorized},
+		{name: "stats", tokenFile: tokenFile, path: "/envoy/admin/stats?filter=upstream_rq&format=json", token: "s3cret", wantCode: http.StatusOK, wantBody: "/stats?filter=upstream_rq&format=json"},
+		{name: "unknown parameters dropped", tokenFile: tokenFile, path: "/envoy/admin/config_dump?resource=dynamic_listeners&x=1", token: "s3cret", wantCode: http.StatusOK, wantBody: "/config_dump?resource=dynamic_listeners"},
+		{name: "endpoint not allowed", tokenFile: tokenFile, path: "/envoy/admin/quitquitquit", token: "s3cret", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Agent{
+				config:     &Config{Admin: AdminConfig{TokenFile: tt.tokenFile}},
+				envoyAdmin: envoy.NewAdminClient(strings.TrimPrefix(envoyAdmin.URL, "http://")),
+			}
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			a.adminHandler().ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	// Only GET is proxied
+	a := &Agent{config: &Config{Admin: AdminConfig{TokenFile: tokenFile}}}
+	rec := httptest.NewRecorder()
+	a.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/envoy/admin/stats", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestAgent_HandleBackends(t *testing.T) {
+	healthy := true
+	envoyAdmin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api := `"failed_active_health_check": true`
+		if healthy {
+			api = `"eds_health_status": "HEALTHY"`
+		}
+		_, _ = w.Write([]byte(`{"cluster_statuses": [
+			{"name": "cluster_lb-1", "host_statuses": [
+				{"address": {"socket_address": {"address": "10.0.0.1", "port_value": 8080}}, "health_status": {"eds_health_status": "HEALTHY"}}]},
+			{"name": "cluster_lb-1_api", "host_statuses": [
+				{"address": {"socket_address": {"address": "10.0.1.1", "port_value": 9000}}, "hostname": "api.internal", "health_status": {` + api + `}}]}]}`))
+	}))
+	defer envoyAdmin.Close()
+
+	a := &Agent{config: &Config{}, envoyAdmin: envoy.NewAdminClient(strings.TrimPrefix(envoyAdmin.URL, "http://"))}
+	rec := httptest.NewRecorder()
+	a.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/backends", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status before apply = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	a.lastApplied.Store(&models.LoadBalancer{
+		ID: "lb-1", Name: "web", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+		Backends: []models.Backend{
+			{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true, Status: "up"},
+			{ID: "be-2", Address: "10.0.0.2", Port: 8080, Enabled: true},
+			{ID: "be-3", Address: "10.0.0.3", Port: 8080},
+		},
+		Pools: []models.BackendPool{{Name: "api", Backends: []models.Backend{{ID: "api-1", Address: "api.internal", Port: 9000, Enabled: true}}}},
+	})
+
+	get := func() map[string]backendView {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		a.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/backends", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var response backendsResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		views := make(map[string]backendView)
+		for _, view := range response.Backends {
+			views[view.ID] = view
+		}
+		return views
+	}
+
+	views := get()
+	for id, want := range map[string]string{"be-1": "healthy", "be-2": "absent", "be-3": "disabled", "api-1": "healthy"} {
+		if views[id].Health != want {
+			t.Errorf("%s health = %q, want %q", id, views[id].Health, want)
+		}
+	}
+	if views["be-1"].Status != "up" || views["api-1"].Pool != "api" || views["api-1"].Since == nil {
+		t.Errorf("unexpected views: %+v", views)
+	}
+	firstSince := *views["api-1"].Since
+
+	time.Sleep(10 * time.Millisecond)
+	healthy = false
+	views = get()
+	if views["api-1"].Health != "unhealthy" || !views["api-1"].Since.After(firstSince) {
+		t.Errorf("api-1 = %+v, want a transition to unhealthy", views["api-1"])
+	}
+	if !views["be-1"].Since.Equal(*get()["be-1"].Since) {
+		t.Error("be-1 transition time changed without a health change")
+	}
+}
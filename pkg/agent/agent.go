@@ -5,75 +5,316 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
+	"path/filepath"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/vpsie/vpsie-loadbalancer/pkg/accesslog"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/autoscale"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/canary"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/discovery"
 	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/firewall"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/gslb"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ha"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/healthdns"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ipvs"
 	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/network"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/notify"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/slowbackend"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/waf"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/wasm"
 )
 
+// ConfigSource provides the desired load balancer configuration
+type ConfigSource interface {
+	GetLoadBalancerConfig(ctx context.Context) (*models.LoadBalancer, error)
+}
+
+// EventReporter receives agent lifecycle events
+type EventReporter interface {
+	SendEvent(ctx context.Context, event Event) error
+}
+
+// watchingSource is implemented by sources that can push change notifications
+type watchingSource interface {
+	Watch(ctx context.Context, onChange func()) error
+}
+
+// logEventReporter reports events to the local log when no VPSie API is available
+type logEventReporter struct{}
+
+// SendEvent logs the event
+func (logEventReporter) SendEvent(_ context.Context, event Event) error {
+	ts := NextTimestamp()
+	log.Printf("Event [%s] %s/%s at %s (seq %d): %s %v", event.Type, event.Category, event.Severity, ts, ts.Seq, event.Message, event.Metadata)
+	return nil
+}
+
 // Agent is the main control plane agent
 type Agent struct {
-	config         *Config
-	vpsieClient    *VPSieClient
-	envoyGenerator *envoy.Generator
-	envoyManager   *envoy.ConfigManager
-	envoyValidator *envoy.Validator
-	envoyReloader  *envoy.Reloader
-	lastConfigHash atomic.Value // stores string
-	running        atomic.Bool
-	cancel         context.CancelFunc
+	config            *Config
+	configMu          sync.RWMutex // Protects config, which is replaced on reload
+	source            ConfigSource
+	node              *NodeMetadata               // nil unless fetched from VPSie at startup
+	plan              atomic.Pointer[models.Plan] // last plan fetched; nil when unknown or unlimited
+	events            EventReporter
+	envoyGenerator    *envoy.Generator
+	envoyManager      *envoy.ConfigManager
+	envoyValidator    *envoy.Validator
+	envoyReloader     *envoy.Reloader
+	envoyRuntime      envoy.Runtime
+	proxy             ProxyDriver // nil while Envoy serves the load balancer
+	envoyAdmin        *envoy.AdminClient
+	lastConfigHash    atomic.Value // stores string
+	lastApplied       atomic.Pointer[models.LoadBalancer]
+	lastDiff          atomic.Pointer[configDiff]
+	lastSync          atomic.Pointer[SyncStatus]
+	lastManualSync    atomic.Int64                 // unix nanoseconds of the last sync requested through the admin API
+	lastReload        atomic.Int64                 // unix nanoseconds of the last Envoy reload
+	paused            atomic.Pointer[PauseStatus]  // nil while configuration changes are applied
+	staged            atomic.Pointer[StagedChange] // last change staged for approval
+	stateMu           sync.Mutex                   // Serializes writes to the state directory
+	certFingerprint   atomic.Value                 // stores string; certificate files of the applied configuration
+	ticketFingerprint atomic.Value                 // stores string; session ticket keys of the applied configuration
+	backendHealth     hostHealthTracker
+	flaps             flapTracker // health transitions and quarantine of backend hosts
+	prober            prober      // data plane probe results
+	startedAt         time.Time
+	role              atomic.Value // stores ha.Role; unset when HA is disabled
+	floatingIP        *network.FloatingIP
+	canary            *canary.Controller
+	autoscale         *autoscale.Controller
+	slowBackends      *slowbackend.Controller  // nil when slow backend detection is disabled
+	hostLatency       *accesslog.HostLatencies // nil when slow backend detection is disabled
+	discovery         *discovery.Resolver
+	dnsPins           *discovery.Pinner     // addresses of backend hostnames, for load balancers with dns.pin
+	accessLogs        *accesslog.Aggregator // nil when the access log service is disabled
+	talkers           *accesslog.Talkers    // nil when the access log service is disabled
+	waf               *waf.Sidecar          // nil when the WAF sidecar is disabled
+	wasm              *wasm.Fetcher         // nil without a WASM module directory
+	ddos              *firewall.Guard       // nil without a firewall backend
+	fastPath          *ipvs.IPVS            // nil when the fast path is disabled
+	fastPathMu        sync.Mutex            // Serializes fast path updates
+	fastPathState     string                // "engaged", or why the fast path cannot serve the load balancer
+	healthDNS         *healthdns.Responder  // nil when the health DNS responder is disabled
+	gslb              *gslb.Coordinator     // nil when GSLB coordination is disabled
+	notifier          *notify.Notifier      // nil without notification targets
+	running           atomic.Bool
+	bootstrapPending  atomic.Bool  // bootstrap changed since Envoy last started
+	sourceFailing     atomic.Bool  // the last configuration fetch failed
+	draining          atomic.Bool  // shutting down: configuration changes are no longer applied
+	statusMu          sync.Mutex   // Serializes status reports
+	status            StatusReport // last status reported to VPSie
+	cancel            context.CancelFunc
+	syncCh            chan struct{}
+	certCh            chan struct{} // certificate files changed
+	ticketCh          chan struct{} // session ticket keys rotated
+	intervalCh        chan time.Duration
 }
 
 // NewAgent creates a new agent instance
 func NewAgent(cfg *Config) (*Agent, error) {
-	// Load API key
-	apiKey, err := cfg.VPSie.LoadAPIKey()
-	if err != nil {
-		return nil, fmt.Errorf("failed to load API key: %w", err)
-	}
+	applyLogging(cfg.Logging)
 
-	// Create VPSie client with URL validation
-	vpsieClient, err := NewVPSieClient(
-		apiKey,
-		cfg.VPSie.APIURL,
-		cfg.VPSie.LoadBalancerID,
-	)
+	source, events, err := newSource(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create VPSie client: %w", err)
+		return nil, err
 	}
 
+	// Region, zone and plan limits VPSie knows about fill in agent.yaml
+	node := fetchNodeMetadata(context.Background(), cfg, source)
+	locality := node.locality(cfg)
+
 	// Create Envoy components
 	envoyGenerator := envoy.NewGenerator(
 		cfg.VPSie.LoadBalancerID,
-		cfg.Envoy.ConfigPath,
+		cfg.Envoy.dynamicDir(cfg.VPSie.LoadBalancerID),
 		cfg.Envoy.AdminAddress,
 		cfg.Envoy.AdminPort,
-		cfg.Envoy.MaxConnections,
+		node.maxConnections(cfg),
 	)
+	envoyGenerator.SetOverload(cfg.Envoy.Overload.envoyConfig())
+	envoyGenerator.SetLegacyTemplates(cfg.Envoy.LegacyTemplates)
+	envoyGenerator.SetXDSEndpoints(cfg.Envoy.XDSEndpoints)
+	envoyGenerator.SetLocality(envoy.Locality{Region: locality.Region, Zone: locality.Zone})
+	envoyGenerator.SetStatsTags(cfg.Envoy.StatsTags)
+	if cfg.AccessLogService.Enabled {
+		envoyGenerator.SetAccessLogService(cfg.AccessLogService.envoyAddress())
+	}
+	if cfg.WAF.Enabled {
+		envoyGenerator.SetWAFService(cfg.WAF.envoyAddress())
+	}
+	if cfg.WASM.ModuleDir != "" {
+		envoyGenerator.SetWASMModuleDir(cfg.WASM.ModuleDir)
+	}
+	if cfg.SessionTickets.Enabled {
+		envoyGenerator.SetSessionTicketKeys(cfg.SessionTickets.keyPaths())
+	}
 
+	runtime := envoyRuntime(cfg)
 	envoyValidator := envoy.NewValidator(cfg.Envoy.BinaryPath)
-	envoyManager, err := envoy.NewConfigManager(cfg.Envoy.ConfigPath, envoyValidator)
+	envoyValidator.SetRuntime(runtime)
+	envoyManager, err := envoy.NewConfigManager(cfg.Envoy.dynamicDir(cfg.VPSie.LoadBalancerID), envoyValidator)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create config manager: %w", err)
 	}
-	envoyReloader := envoy.NewReloader(
+	envoyReloader, err := envoy.NewReloader(
 		cfg.Envoy.BinaryPath,
-		cfg.Envoy.ConfigPath+"/bootstrap.yaml",
+		envoyManager.BootstrapPath(),
 		cfg.Envoy.PidFile,
+		cfg.Envoy.EpochFile,
 	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reloader: %w", err)
+	}
+	envoyAdmin := envoy.NewAdminClient(cfg.Envoy.AdminAddress)
+	envoyReloader.SetServerInfoSource(envoyAdmin)
+	if remote, ok := runtime.(*envoy.Remote); ok {
+		envoyReloader.SetRemote(remote)
+	} else {
+		envoyReloader.SetRuntime(runtime)
+	}
+
+	if client, ok := events.(*VPSieClient); ok && cfg.State.Dir != "" {
+		queue, err := newEventQueue(filepath.Join(cfg.State.Dir, eventsFileName), cfg.State.MaxQueuedEvents)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load event queue: %w", err)
+		}
+		client.SetEventQueue(queue)
+	}
+
+	resolver, err := newResolver(&cfg.Discovery, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery resolver: %w", err)
+	}
 
-	return &Agent{
+	a := &Agent{
 		config:         cfg,
-		vpsieClient:    vpsieClient,
+		source:         source,
+		events:         events,
 		envoyGenerator: envoyGenerator,
 		envoyManager:   envoyManager,
 		envoyValidator: envoyValidator,
 		envoyReloader:  envoyReloader,
+		envoyRuntime:   runtime,
+		proxy:          newProxyDriver(cfg, node.maxConnections(cfg)),
+		envoyAdmin:     envoyAdmin,
+		discovery:      resolver,
+		node:           node,
+		syncCh:         make(chan struct{}, 1),
+		certCh:         make(chan struct{}, 1),
+		ticketCh:       make(chan struct{}, 1),
+		intervalCh:     make(chan time.Duration, 1),
 		// running defaults to false (zero value of atomic.Bool)
-	}, nil
+	}
+	if node != nil {
+		a.plan.Store(&node.Plan)
+	}
+	a.canary = a.newCanaryController(envoyAdmin)
+	a.autoscale = a.newAutoscaleController(envoyAdmin)
+	a.dnsPins = a.newDNSPinner()
+	if cfg.AccessLogService.Enabled {
+		a.accessLogs = accesslog.NewAggregator(cfg.AccessLogService.SampleSize)
+		a.talkers = accesslog.NewTalkers(cfg.AccessLogService.TalkersWindow, accesslog.DefaultMaxClients)
+	}
+	if cfg.SlowBackends.Enabled {
+		a.hostLatency = accesslog.NewHostLatencies()
+		a.slowBackends = a.newSlowBackendController(&cfg.SlowBackends, a.hostLatency)
+	}
+	if cfg.WAF.Enabled {
+		a.waf = newWAFSidecar(&cfg.WAF)
+	}
+	if cfg.WASM.ModuleDir != "" {
+		a.wasm = newWASMFetcher(&cfg.WASM)
+	}
+	if cfg.Firewall.Backend != "" {
+		if a.ddos, err = a.newDDoSGuard(&cfg.Firewall); err != nil {
+			return nil, fmt.Errorf("failed to create firewall guard: %w", err)
+		}
+	}
+	if cfg.FastPath.Enabled {
+		if a.fastPath, err = ipvs.New(ipvs.Method(cfg.FastPath.Method)); err != nil {
+			return nil, fmt.Errorf("failed to create fast path: %w", err)
+		}
+	}
+	if cfg.HealthDNS.Enabled {
+		a.healthDNS = newHealthDNS(&cfg.HealthDNS)
+	}
+	if cfg.GSLB.Enabled {
+		if a.gslb, err = a.newGSLBCoordinator(cfg); err != nil {
+			return nil, fmt.Errorf("failed to create GSLB coordinator: %w", err)
+		}
+	}
+	if cfg.Notifications.enabled() {
+		if a.notifier, err = newNotifier(&cfg.Notifications); err != nil {
+			return nil, fmt.Errorf("failed to create notifier: %w", err)
+		}
+	}
+	return a, nil
+}
+
+// newSource creates the configuration source and event reporter for the configured mode
+func newSource(cfg *Config) (ConfigSource, EventReporter, error) {
+	switch cfg.Source.Mode {
+	case SourceModeFile:
+		fileSource, err := NewFileSource(cfg.Source.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create file source: %w", err)
+		}
+		return fileSource, logEventReporter{}, nil
+
+	case SourceModeKubernetesIngress:
+		ingressSource, err := newIngressSource(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create kubernetes ingress source: %w", err)
+		}
+		return ingressSource, logEventReporter{}, nil
+
+	case SourceModeAPI, "":
+		// Load API key from the configured file or secret manager
+		apiKey, err := cfg.VPSie.ResolveAPIKey(context.Background())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load API key: %w", err)
+		}
+
+		// Create VPSie client with URL validation
+		vpsieClient, err := NewVPSieClient(
+			apiKey,
+			cfg.VPSie.APIURL,
+			cfg.VPSie.LoadBalancerID,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create VPSie client: %w", err)
+		}
+		return vpsieClient, vpsieClient, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported source mode: %s", cfg.Source.Mode)
+	}
+}
+
+// currentConfig returns the active agent configuration
+func (a *Agent) currentConfig() *Config {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return a.config
+}
+
+// TriggerSync requests an immediate configuration sync. It never blocks;
+// requests made while a sync is already pending are coalesced.
+func (a *Agent) TriggerSync() {
+	select {
+	case a.syncCh <- struct{}{}:
+	default:
+	}
 }
 
 // Start starts the agent's reconciliation loop
@@ -86,50 +327,242 @@ func (a *Agent) Start(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	a.cancel = cancel
 
-	log.Printf("Starting VPSie Load Balancer Agent...")
-	log.Printf("Load Balancer ID: %s", a.config.VPSie.LoadBalancerID)
-	log.Printf("Poll Interval: %s", a.config.VPSie.PollInterval)
+	a.startedAt = time.Now()
+	cfg := a.currentConfig()
+	log.Printf("Starting VPSie Load Balancer Agent %s...", Version)
+	log.Printf("Configuration source: %s", cfg.Source.Mode)
+	log.Printf("Load Balancer ID: %s", cfg.VPSie.LoadBalancerID)
+	log.Printf("Poll Interval: %s", cfg.VPSie.PollInterval)
+
+	if cfg.Admin.ListenAddress != "" {
+		go a.runAdminServer(ctx, cfg.Admin.ListenAddress)
+	}
+	go a.runBackendHealth(ctx)
+
+	if cfg.HA.Enabled {
+		elector, err := a.newElector(&cfg.HA)
+		if err != nil {
+			cancel()
+			a.running.Store(false)
+			return fmt.Errorf("failed to create HA elector: %w", err)
+		}
+		a.floatingIP, err = a.newFloatingIP(&cfg.HA)
+		if err != nil {
+			cancel()
+			a.running.Store(false)
+			return fmt.Errorf("failed to create floating IP manager: %w", err)
+		}
+		log.Printf("HA enabled (mode: %s, node: %s)", cfg.HA.Mode, cfg.HA.NodeID)
+		a.role.Store(ha.RoleUnknown)
+		go a.runHA(ctx, elector)
+	}
+
+	go a.runCanary(ctx)
+	go a.runAutoscale(ctx)
+	if a.slowBackends != nil {
+		go a.runSlowBackends(ctx, cfg.SlowBackends.Interval)
+	}
+	if a.ddos != nil {
+		go a.runDDoSGuard(ctx)
+	}
+	if a.healthDNS != nil {
+		go a.runHealthDNS(ctx, cfg.HealthDNS)
+	}
+	if a.gslb != nil {
+		go a.runGSLB(ctx, cfg.GSLB)
+	}
+	if a.notifier != nil {
+		go a.notifier.Run(ctx)
+	}
+	go a.runDiscovery(ctx, cfg.Discovery.RefreshInterval)
+	go a.dnsPins.Run(ctx)
+	if cfg.AccessLogService.Enabled {
+		go a.runAccessLogService(ctx, cfg.AccessLogService)
+	}
+
+	// Report liveness to VPSie when the event reporter supports it
+	if reporter, ok := a.events.(heartbeatReporter); ok {
+		go a.runHeartbeat(ctx, reporter, cfg.VPSie.HeartbeatInterval)
+	}
+
+	if runner, ok := a.proxy.(proxyRunner); ok {
+		go runner.Run(ctx)
+	}
+
+	// The agent runs Envoy and owns its bootstrap only when it manages Envoy itself
+	if cfg.Envoy.OutputMode == OutputModeFiles && cfg.Proxy.envoy() {
+		a.pullEnvoyImage(ctx)
+		a.logEnvoyVersion(ctx)
+		a.reconcileBootstrap(ctx)
+	}
+
+	// Watch the source for changes if it supports push notifications
+	if ws, ok := a.source.(watchingSource); ok {
+		go func() {
+			if err := ws.Watch(ctx, a.TriggerSync); err != nil {
+				log.Printf("Warning: Configuration watch stopped: %v", err)
+			}
+		}()
+	}
+
+	// Envoy must find the session ticket keys before the first configuration
+	// referencing them is applied
+	if cfg.SessionTickets.Enabled {
+		a.updateSessionTickets(ctx, &cfg.SessionTickets, time.Now())
+		go a.runSessionTickets(ctx, cfg.SessionTickets)
+	}
+
+	if cfg.Probe.Enabled {
+		go a.runProbe(ctx, cfg.Probe)
+	}
+
+	// Resume where the previous agent left off
+	a.restoreState()
+	if cfg.Pause.Enabled {
+		a.Pause(ctx, cfg.Pause.Reason, pausedByConfig)
+	}
 
 	// Initial sync
 	if err := a.syncConfiguration(ctx); err != nil {
 		log.Printf("Warning: Initial configuration sync failed: %v", err)
 		// Don't fail on initial sync error, continue and retry
 	}
+	a.flushEvents(ctx)
+
+	// Reload Envoy when renewed certificates are dropped in place, including
+	// renewals while the agent was down
+	if cfg.CertWatch.Enabled {
+		go a.runCertWatch(ctx, cfg.CertWatch)
+		a.checkCertificates()
+	}
 
 	// Start reconciliation loop
-	ticker := time.NewTicker(a.config.VPSie.PollInterval)
+	ticker := time.NewTicker(cfg.VPSie.PollInterval)
 	defer ticker.Stop()
+	debouncer := newSyncDebouncer()
+	defer debouncer.clear()
 
 	for {
 		select {
 		case <-ctx.Done():
 			log.Println("Agent stopping...")
+			a.releaseFloatingIP()
+			if a.waf != nil {
+				a.waf.Stop()
+			}
 			a.running.Store(false)
 			return nil
 
 		case <-ticker.C:
+			// The periodic sync covers triggers still being debounced
+			debouncer.clear()
 			if err := a.syncConfiguration(ctx); err != nil {
 				log.Printf("Error syncing configuration: %v", err)
 			}
+			a.applyPendingBootstrap(ctx)
+			a.flushEvents(ctx)
+
+		case <-a.syncCh:
+			if debouncer.postpone(time.Now(), a.currentConfig().Envoy.ReloadLimit) {
+				continue
+			}
+			if err := a.syncConfiguration(ctx); err != nil {
+				log.Printf("Error syncing configuration: %v", err)
+			}
+
+		case <-debouncer.C():
+			debouncer.clear()
+			if err := a.syncConfiguration(ctx); err != nil {
+				log.Printf("Error syncing configuration: %v", err)
+			}
+
+		case <-a.certCh:
+			a.reloadCertificates(ctx)
+
+		case <-a.ticketCh:
+			a.reloadSessionTickets(ctx)
+
+		case interval := <-a.intervalCh:
+			ticker.Reset(interval)
 		}
 	}
 }
 
-// syncConfiguration fetches config from VPSie and applies it to Envoy
-func (a *Agent) syncConfiguration(ctx context.Context) error {
-	log.Println("Syncing configuration from VPSie API...")
+// syncConfiguration fetches config from the configured source and applies it to Envoy
+func (a *Agent) syncConfiguration(ctx context.Context) (err error) {
+	defer func() {
+		a.recordSync(err)
+		a.reportStatus(ctx)
+	}()
+
+	if a.standingBy() {
+		log.Println("Standing by: another agent holds the HA lease")
+		return nil
+	}
+	if a.draining.Load() {
+		log.Println("Draining for shutdown: configuration changes are no longer applied")
+		return nil
+	}
+
+	sourceMode := a.currentConfig().Source.Mode
+	log.Printf("Syncing configuration (source: %s)...", sourceMode)
+
+	// Events of this sync share a correlation ID
+	ctx = withCorrelationID(ctx)
 
 	// Fetch current configuration
-	lb, err := a.vpsieClient.GetLoadBalancerConfig(ctx)
+	lb, err := a.source.GetLoadBalancerConfig(ctx)
 	if err != nil {
+		a.recordSourceFailure(ctx, err)
 		return fmt.Errorf("failed to fetch config: %w", err)
 	}
+	a.recordSourceRecovery(ctx)
+
+	// Fill in the variables of this node
+	if err = a.expandVariables(lb); err != nil {
+		return fmt.Errorf("invalid configuration from %s source: %w", sourceMode, err)
+	}
 
 	// Validate configuration
 	if err = lb.Validate(); err != nil {
-		return fmt.Errorf("invalid configuration from VPSie: %w", err)
+		return fmt.Errorf("invalid configuration from %s source: %w", sourceMode, err)
+	}
+
+	// Faults are only injected on staging nodes
+	a.stripFaultInjection(lb)
+
+	// Add backends discovered through VPSie tags or Consul
+	if err = a.resolveDiscovery(ctx, lb); err != nil {
+		return err
+	}
+
+	// Pools with a selector take the backends whose labels match
+	lb.SelectBackends()
+
+	// Refuse what the plan of the load balancer does not include
+	if err = a.enforcePlan(ctx, lb); err != nil {
+		return err
 	}
 
+	// A listener limit above the global limit never takes effect
+	if global := a.node.maxConnections(a.currentConfig()); lb.MaxConnections > global {
+		log.Printf("Warning: max_connections %d of load balancer %s exceeds the global limit of %d (envoy.max_connections or the node's plan)", lb.MaxConnections, lb.ID, global)
+	}
+
+	// Canary rollouts override the configured split weights
+	a.canary.Apply(ctx, lb)
+
+	// Track the load of backend pools with an autoscaling policy
+	a.autoscale.Apply(lb)
+
+	// Slow backends keep a reduced share of the traffic
+	if a.slowBackends != nil {
+		a.slowBackends.Apply(lb)
+	}
+
+	// Keep chronically flapping backends out of rotation
+	a.applyQuarantine(lb)
+
 	// Check if configuration has changed
 	configHash := a.computeConfigHash(lb)
 	lastHash, ok := a.lastConfigHash.Load().(string)
@@ -141,13 +574,72 @@ func (a *Agent) syncConfiguration(ctx context.Context) error {
 		return nil
 	}
 
+	// Paused: report what would change, apply nothing
+	if a.paused.Load() != nil {
+		return a.holdConfiguration(ctx, lb, configHash)
+	}
+
+	// Change control: stage the change until it is approved
+	if a.currentConfig().Approval.Enabled {
+		var approved bool
+		if approved, err = a.awaitApproval(ctx, lb, configHash); err != nil || !approved {
+			return err
+		}
+	}
+
 	log.Printf("Configuration changed, applying new config (hash: %s)", configHash)
 
+	// Program the host firewall for per-source connection limits
+	if a.ddos != nil {
+		if err = a.ddos.Apply(ctx, lb); err != nil {
+			return err
+		}
+	} else if lb.DDoS != nil && lb.DDoS.NeedsFirewall() {
+		log.Printf("Warning: ddos_protection of load balancer %s needs firewall rules but no firewall.backend is configured", lb.ID)
+	}
+
+	// Run the WAF sidecar the new configuration sends requests to
+	if a.waf != nil {
+		if err = a.waf.Apply(lb.WAF); err != nil {
+			return err
+		}
+	}
+
+	// Store the WASM modules the new configuration loads
+	if a.wasm != nil {
+		if err = a.wasm.Fetch(ctx, lb.CustomFilters); err != nil {
+			return err
+		}
+	}
+
+	// HAProxy or Nginx serves the load balancer instead of Envoy
+	if a.proxy != nil {
+		return a.applyProxy(ctx, lb, configHash)
+	}
+
+	// External control plane mode: export the snapshot, leave Envoy alone
+	if a.currentConfig().Envoy.OutputMode == OutputModeXDSSnapshot {
+		return a.exportSnapshot(ctx, lb, configHash)
+	}
+
+	// Refuse features the installed Envoy does not support
+	if err = a.checkEnvoyVersion(ctx, lb); err != nil {
+		return err
+	}
+
+	// Refuse listen addresses Envoy cannot bind
+	if err = a.checkListenAddresses(lb); err != nil {
+		return err
+	}
+
 	// Backup current configuration
 	if err = a.envoyManager.BackupConfig(); err != nil {
 		log.Printf("Warning: Failed to backup config: %v", err)
 	}
 
+	// Refresh TLS private keys held in secret managers
+	a.materializeTLSKeys(ctx)
+
 	// Generate new Envoy configuration
 	var envoyConfig *envoy.EnvoyConfig
 	envoyConfig, err = a.envoyGenerator.GenerateFullConfig(lb)
@@ -155,14 +647,72 @@ func (a *Agent) syncConfiguration(ctx context.Context) error {
 		return fmt.Errorf("failed to generate Envoy config: %w", err)
 	}
 
+	// Show what the new configuration changes
+	a.recordDiff(ctx, configHash, envoyConfig)
+
+	// Changes to clusters only are loaded by the running Envoy from the file
+	class := a.classifyChange(lb, envoyConfig)
+	var cds envoy.CDSUpdates
+	if class != changeFull {
+		if cds, err = a.cdsUpdates(ctx); err != nil {
+			log.Printf("Envoy statistics unavailable, reloading instead of a live update: %v", err)
+			class = changeFull
+		}
+	}
+
 	// Apply configuration
 	if err = a.envoyManager.ApplyConfig(envoyConfig); err != nil {
 		return fmt.Errorf("failed to apply config: %w", err)
 	}
 
-	// Reload Envoy (hot restart)
+	if class == changeClusters {
+		if err = a.awaitLiveClusters(ctx, cds); err != nil {
+			log.Printf("Live cluster update failed, reloading: %v", err)
+			class = changeFull
+		} else {
+			log.Println("Envoy loaded the new clusters without a reload")
+		}
+	}
+
+	// Reload Envoy with the configured strategy
+	if class == changeFull {
+		err = a.reloadWithRollback(ctx, configHash)
+	} else if class == changeNone {
+		log.Println("Envoy configuration unchanged, not reloading")
+	}
+	if err != nil {
+		return err
+	}
+
+	// Update last config hash
+	a.lastConfigHash.Store(configHash)
+	a.lastApplied.Store(lb)
+	a.markChangeApplied(configHash)
+	a.recordCertificates(lb)
+	a.recordSessionTickets()
+	a.saveState(ctx)
+	a.refreshFastPath(ctx)
+
+	// Notify VPSie of successful update
+	a.sendEvent(ctx, NewEvent(EventConfigUpdated, "Configuration successfully updated", map[string]interface{}{
+		"config_hash": configHash,
+		"epoch":       a.envoyReloader.GetCurrentEpoch(),
+		"change":      string(class),
+	}))
+
+	// Catch reloads Envoy accepted without loading the new files
+	a.verifyApplied(ctx, configHash, envoyConfig)
+
+	log.Println("Configuration sync completed successfully")
+	return nil
+}
+
+// reloadWithRollback reloads Envoy with the configured strategy, and restores
+// the previous configuration files when the reload fails
+func (a *Agent) reloadWithRollback(ctx context.Context, configHash string) error {
 	log.Println("Reloading Envoy with new configuration...")
-	if err = a.reloadEnvoy(); err != nil {
+	err := a.reloadEnvoy(ctx)
+	if err != nil {
 		// Restore backup on failure
 		log.Printf("Reload failed, restoring backup: %v", err)
 		if restoreErr := a.envoyManager.RestoreConfig(); restoreErr != nil {
@@ -171,63 +721,185 @@ func (a *Agent) syncConfiguration(ctx context.Context) error {
 			log.Printf("CRITICAL: Load balancer may be in inconsistent state")
 
 			// Notify VPSie API of critical failure
-			criticalErr := a.vpsieClient.SendEvent(ctx, "critical_failure",
+			a.sendEvent(ctx, NewEvent(EventCriticalFailure,
 				"Config reload failed and restore failed - system may be inconsistent",
 				map[string]interface{}{
 					"reload_error":  err.Error(),
 					"restore_error": restoreErr.Error(),
 					"config_hash":   configHash,
 					"epoch":         a.envoyReloader.GetCurrentEpoch(),
-				})
-			if criticalErr != nil {
-				log.Printf("Failed to send critical failure event: %v", criticalErr)
-			}
+				}))
 
 			// Return combined error with both failures
 			return fmt.Errorf("CRITICAL: reload failed (%w) and restore failed (%v)", err, restoreErr)
 		}
+		if deliverErr := a.deliverEnvoyConfig(ctx); deliverErr != nil {
+			log.Printf("Warning: Restored configuration not delivered: %v", deliverErr)
+		}
+		a.sendEvent(ctx, NewEvent(EventConfigRolledBack, "Config reload failed, previous configuration restored", map[string]interface{}{
+			"reload_error": err.Error(),
+			"config_hash":  configHash,
+		}))
 		return fmt.Errorf("failed to reload Envoy: %w", err)
 	}
+	return nil
+}
 
-	// Update last config hash
-	a.lastConfigHash.Store(configHash)
+// recordSourceFailure reports the first of a run of failures to fetch the
+// configuration; later failures are only logged
+func (a *Agent) recordSourceFailure(ctx context.Context, err error) {
+	if a.sourceFailing.Swap(true) {
+		return
+	}
+	a.sendEvent(ctx, NewEvent(EventConfigSourceFailed, fmt.Sprintf("Failed to fetch configuration: %v", err), map[string]interface{}{
+		"source": a.currentConfig().Source.Mode,
+		"error":  err.Error(),
+	}))
+}
 
-	// Notify VPSie of successful update
-	if err = a.vpsieClient.SendEvent(ctx, "config_updated", "Configuration successfully updated", map[string]interface{}{
-		"config_hash": configHash,
-		"epoch":       a.envoyReloader.GetCurrentEpoch(),
-	}); err != nil {
-		log.Printf("Warning: Failed to send update event: %v", err)
+// recordSourceRecovery reports that the configuration could be fetched
+// again after a failure
+func (a *Agent) recordSourceRecovery(ctx context.Context) {
+	if !a.sourceFailing.Swap(false) {
+		return
 	}
+	a.sendEvent(ctx, NewEvent(EventConfigSourceRecovered, "Configuration fetched again", map[string]interface{}{
+		"source": a.currentConfig().Source.Mode,
+	}))
+}
 
-	log.Println("Configuration sync completed successfully")
+// materializeTLSKeys writes TLS private keys from secret sources to disk.
+// Failures are logged; Envoy keeps using the previously written key.
+func (a *Agent) materializeTLSKeys(ctx context.Context) {
+	keys := a.currentConfig().TLSKeys
+	for i := range keys {
+		changed, err := keys[i].materialize(ctx)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		if changed {
+			log.Printf("TLS private key updated: %s", keys[i].Path)
+		}
+	}
+}
+
+// exportSnapshot writes the configuration as an xDS snapshot for an external control plane
+func (a *Agent) exportSnapshot(ctx context.Context, lb *models.LoadBalancer, configHash string) error {
+	snapshot, err := a.envoyGenerator.GenerateSnapshot(lb, configHash)
+	if err != nil {
+		return fmt.Errorf("failed to generate xDS snapshot: %w", err)
+	}
+
+	// The delta is written first, so it is in place when the snapshot changes
+	previous, err := a.envoyManager.ReadSnapshot()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Warning: Failed to read the previous xDS snapshot, the delta holds every resource: %v", err)
+	}
+	delta := snapshot.Delta(previous)
+	if err = a.envoyManager.WriteSnapshotDelta(delta); err != nil {
+		return fmt.Errorf("failed to write xDS snapshot delta: %w", err)
+	}
+	if err = a.envoyManager.WriteSnapshot(snapshot); err != nil {
+		return fmt.Errorf("failed to write xDS snapshot: %w", err)
+	}
+	changed, removed := delta.Changes()
+
+	a.lastConfigHash.Store(configHash)
+	a.lastApplied.Store(lb)
+	a.markChangeApplied(configHash)
+	a.recordCertificates(lb)
+	a.recordSessionTickets()
+	a.saveState(ctx)
+
+	a.sendEvent(ctx, NewEvent(EventSnapshotExported, "xDS snapshot exported", map[string]interface{}{
+		"config_hash":       configHash,
+		"resources_changed": changed,
+		"resources_removed": removed,
+	}))
+
+	log.Printf("xDS snapshot exported (version: %s, %d resources changed, %d removed)", configHash, changed, removed)
 	return nil
 }
 
-// reloadEnvoy performs a hot reload of Envoy
-func (a *Agent) reloadEnvoy() error {
-	// Use Envoy's hot restart mechanism with epoch tracking
-	log.Printf("Initiating Envoy hot restart (epoch: %d -> %d)",
-		a.envoyReloader.GetCurrentEpoch(),
-		a.envoyReloader.GetCurrentEpoch()+1)
+// reloadEnvoy reloads Envoy with the configured strategy and reports the
+// outcome as an event. Nothing is reloaded while the node drains for shutdown.
+func (a *Agent) reloadEnvoy(ctx context.Context) error {
+	if a.draining.Load() {
+		return errDraining
+	}
+	if err := a.awaitReloadInterval(ctx); err != nil {
+		return err
+	}
+	// A failed reload may still have started a process, so it counts too
+	defer func() { a.lastReload.Store(time.Now().UnixNano()) }()
+	strategy := a.currentConfig().Envoy.ReloadStrategy
+	if err := a.restartEnvoy(ctx); err != nil {
+		a.sendEvent(ctx, NewEvent(EventEnvoyReloadFailed, err.Error(), map[string]interface{}{
+			"strategy": strategy,
+			"epoch":    a.envoyReloader.GetCurrentEpoch(),
+		}))
+		return err
+	}
+	a.sendEvent(ctx, NewEvent(EventEnvoyReloaded, "Envoy reloaded", map[string]interface{}{
+		"strategy": strategy,
+		"epoch":    a.envoyReloader.GetCurrentEpoch(),
+	}))
+	return nil
+}
 
-	if err := a.envoyReloader.Reload(); err != nil {
-		return fmt.Errorf("envoy hot restart failed: %w", err)
+// restartEnvoy performs a hot reload of Envoy
+func (a *Agent) restartEnvoy(ctx context.Context) error {
+	cfg := a.currentConfig().Envoy
+	if err := a.deliverEnvoyConfig(ctx); err != nil {
+		return err
 	}
 
-	log.Printf("Envoy hot restart completed successfully (epoch: %d)",
-		a.envoyReloader.GetCurrentEpoch())
+	switch cfg.ReloadStrategy {
+	case envoy.StrategySIGHUP:
+		if err := a.envoyReloader.ReloadGraceful(); err != nil {
+			return fmt.Errorf("envoy SIGHUP reload failed: %w", err)
+		}
+		log.Println("Envoy signalled to reload")
+	case envoy.StrategySystemd:
+		if err := a.envoyReloader.ReloadSystemd(ctx, cfg.SystemdUnit); err != nil {
+			return fmt.Errorf("envoy systemd reload failed: %w", err)
+		}
+		log.Printf("Envoy reloaded through systemd unit %s", cfg.SystemdUnit)
+	case envoy.StrategyDrainRestart:
+		log.Printf("Draining Envoy listeners for %s before restart", cfg.DrainTime)
+		if err := a.envoyReloader.DrainAndRestart(ctx, a.envoyAdmin, cfg.DrainTime); err != nil {
+			return fmt.Errorf("envoy drain and restart failed: %w", err)
+		}
+		a.bootstrapPending.Store(false)
+		log.Println("Envoy restarted after draining")
+	default:
+		// Use Envoy's hot restart mechanism with epoch tracking
+		log.Printf("Initiating Envoy hot restart (epoch: %d -> %d)",
+			a.envoyReloader.GetCurrentEpoch(),
+			a.envoyReloader.GetCurrentEpoch()+1)
+
+		if err := a.envoyReloader.Reload(); err != nil {
+			return fmt.Errorf("envoy hot restart failed: %w", err)
+		}
+		a.bootstrapPending.Store(false)
+
+		log.Printf("Envoy hot restart completed successfully (epoch: %d)",
+			a.envoyReloader.GetCurrentEpoch())
+	}
 	return nil
 }
 
-// computeConfigHash computes a cryptographic hash of the configuration for change detection
+// computeConfigHash computes a cryptographic hash of the configuration for
+// change detection. Only material fields are hashed: timestamps and the
+// backend health reported by the API change without changing what Envoy is
+// given, and would otherwise trigger a reload on every status flap.
 func (a *Agent) computeConfigHash(lb *models.LoadBalancer) string {
-	// Marshal the entire configuration to JSON to capture all changes
-	data, err := json.Marshal(lb)
+	data, err := json.Marshal(materialConfig(lb))
 	if err != nil {
 		// Fallback to a timestamp-based hash if marshaling fails
 		log.Printf("Warning: Failed to marshal config for hashing: %v", err)
-		return fmt.Sprintf("%s-%d-%d", lb.UpdatedAt.Format(time.RFC3339), len(lb.Backends), lb.Port)
+		return fmt.Sprintf("%s-%d-%d", lb.UpdatedAt.Format(time.RFC3339), len(lb.Backends), lb.ListenPort())
 	}
 
 	// Compute SHA-256 hash of the JSON representation
@@ -235,6 +907,28 @@ func (a *Agent) computeConfigHash(lb *models.LoadBalancer) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// materialConfig returns a copy of lb without its volatile fields: the
+// creation and update times and the status of the backends
+func materialConfig(lb *models.LoadBalancer) *models.LoadBalancer {
+	material := *lb
+	material.CreatedAt, material.UpdatedAt = time.Time{}, time.Time{}
+	material.Backends = withoutStatus(lb.Backends)
+	material.Pools = slices.Clone(lb.Pools)
+	for i := range material.Pools {
+		material.Pools[i].Backends = withoutStatus(material.Pools[i].Backends)
+	}
+	return &material
+}
+
+// withoutStatus returns a copy of backends with their status cleared
+func withoutStatus(backends []models.Backend) []models.Backend {
+	backends = slices.Clone(backends)
+	for i := range backends {
+		backends[i].Status = ""
+	}
+	return backends
+}
+
 // IsRunning returns true if the agent is running
 func (a *Agent) IsRunning() bool {
 	return a.running.Load()
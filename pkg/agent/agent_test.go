@@ -112,6 +112,42 @@ func TestAgent_computeConfigHash(t *testing.T) {
 		}
 	})
 
+	t.Run("timestamps and backend status do not change the hash", func(t *testing.T) {
+		hash1 := agent.computeConfigHash(lb1)
+
+		flapped := *lb1
+		flapped.CreatedAt = baseTime.Add(-time.Hour)
+		flapped.UpdatedAt = baseTime.Add(time.Minute)
+		flapped.Backends = []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true, Status: "down"}}
+		flapped.Pools = []models.BackendPool{{Name: "api", Backends: []models.Backend{{ID: "be-2", Address: "10.0.0.2", Port: 8080, Enabled: true, Status: "up"}}}}
+		pooled := *lb1
+		pooled.Pools = []models.BackendPool{{Name: "api", Backends: []models.Backend{{ID: "be-2", Address: "10.0.0.2", Port: 8080, Enabled: true, Status: "down"}}}}
+
+		if hash := agent.computeConfigHash(&flapped); hash != agent.computeConfigHash(&pooled) {
+			t.Error("Expected a backend status flap in a pool not to change the hash")
+		}
+		flapped.Pools = nil
+		if hash := agent.computeConfigHash(&flapped); hash != hash1 {
+			t.Error("Expected timestamps and backend status not to change the hash")
+		}
+		if lb1.Backends[0].Status != "" || flapped.Backends[0].Status != "down" {
+			t.Error("computeConfigHash() modified the configuration")
+		}
+	})
+
+	t.Run("backend weight and enabled state change the hash", func(t *testing.T) {
+		hash1 := agent.computeConfigHash(lb1)
+
+		weighted := *lb1
+		weighted.Backends = []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true, Weight: 5}}
+		disabled := *lb1
+		disabled.Backends = []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080}}
+
+		if agent.computeConfigHash(&weighted) == hash1 || agent.computeConfigHash(&disabled) == hash1 {
+			t.Error("Expected material backend changes to change the hash")
+		}
+	})
+
 	t.Run("hash is non-empty and reasonable length", func(t *testing.T) {
 		hash := agent.computeConfigHash(lb1)
 
@@ -216,3 +252,46 @@ func TestAgent_Stop(t *testing.T) {
 		t.Error("Expected agent to be stopped after Stop()")
 	}
 }
+
+func TestAgent_TriggerSync(t *testing.T) {
+	agent := &Agent{syncCh: make(chan struct{}, 1)}
+
+	// Multiple triggers must not block and are coalesced into one pending sync
+	agent.TriggerSync()
+	agent.TriggerSync()
+
+	select {
+	case <-agent.syncCh:
+	default:
+		t.Fatal("Expected a pending sync after TriggerSync()")
+	}
+
+	select {
+	case <-agent.syncCh:
+		t.Error("Expected triggers to be coalesced")
+	default:
+	}
+}
+
+func TestNewSource_FileMode(t *testing.T) {
+	cfg := &Config{Source: SourceConfig{Mode: SourceModeFile, Path: t.TempDir()}}
+
+	source, events, err := newSource(cfg)
+	if err != nil {
+		t.Fatalf("newSource() error = %v", err)
+	}
+	if _, ok := source.(*FileSource); !ok {
+		t.Errorf("source = %T, want *FileSource", source)
+	}
+	if _, ok := events.(logEventReporter); !ok {
+		t.Errorf("events = %T, want logEventReporter", events)
+	}
+}
+
+func TestNewSource_UnsupportedMode(t *testing.T) {
+	cfg := &Config{Source: SourceConfig{Mode: "carrier-pigeon"}}
+
+	if _, _, err := newSource(cfg); err == nil {
+		t.Error("Expected error for unsupported source mode")
+	}
+}
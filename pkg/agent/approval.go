@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// ApprovalConfig makes the agent stage every configuration change and apply
+// it only once it is approved, for customers that need change control
+type ApprovalConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// States of a staged change
+const (
+	ChangePending  = "pending"
+	ChangeApproved = "approved"
+	ChangeRejected = "rejected"
+	ChangeApplied  = "applied"
+)
+
+// Who decided on a staged change
+const (
+	decidedByAdminAPI = "admin_api"
+	decidedByVPSie    = "vpsie"
+)
+
+// StagedChange is a configuration change waiting for approval
+type StagedChange struct {
+	ConfigHash string    `json:"config_hash"`
+	StagedAt   time.Time `json:"staged_at"`
+	Diff       string    `json:"diff"` // change to the Envoy configuration files, empty in xDS snapshot mode
+	State      string    `json:"state"`
+	DecidedBy  string    `json:"decided_by,omitempty"` // admin_api or vpsie
+	Reported   bool      `json:"reported"`             // reported to VPSie for review
+}
+
+// changeApprover is implemented by event reporters that take part in change
+// control: they receive staged changes and return the decision on them
+type changeApprover interface {
+	StageChange(ctx context.Context, change *StagedChange) error
+	ChangeApproval(ctx context.Context, configHash string) (string, error)
+}
+
+// StageChange reports a staged configuration change to VPSie for review
+func (c *VPSieClient) StageChange(ctx context.Context, change *StagedChange) error {
+	reqURL := fmt.Sprintf("%s/loadbalancers/%s/changes/%s", c.baseURL, sanitizeID(c.loadBalancerID), sanitizeID(change.ConfigHash))
+	payload := *change
+	payload.Diff = truncateErrorMessage(change.Diff, maxEventDiffSize)
+	return c.doJSON(ctx, http.MethodPut, reqURL, payload, nil)
+}
+
+// ChangeApproval returns the state of a staged change in VPSie: pending,
+// approved or rejected
+func (c *VPSieClient) ChangeApproval(ctx context.Context, configHash string) (string, error) {
+	reqURL := fmt.Sprintf("%s/loadbalancers/%s/changes/%s", c.baseURL, sanitizeID(c.loadBalancerID), sanitizeID(configHash))
+	var decision struct {
+		State string `json:"state"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, reqURL, nil, &decision); err != nil {
+		return "", err
+	}
+	return decision.State, nil
+}
+
+// awaitApproval stages the change lb makes and reports whether it has been
+// approved. A new change is diffed and reported once; while it is pending,
+// every sync asks VPSie for a decision.
+func (a *Agent) awaitApproval(ctx context.Context, lb *models.LoadBalancer, configHash string) (bool, error) {
+	staged := a.staged.Load()
+	if staged == nil || staged.ConfigHash != configHash {
+		var err error
+		if staged, err = a.stageChange(ctx, lb, configHash); err != nil {
+			return false, err
+		}
+	}
+	switch staged.State {
+	case ChangeApproved:
+		return true, nil
+	case ChangeRejected, ChangeApplied:
+		return false, nil
+	}
+
+	approver, ok := a.events.(changeApprover)
+	if !ok {
+		return false, nil
+	}
+	if !staged.Reported {
+		if err := approver.StageChange(ctx, staged); err != nil {
+			log.Printf("Warning: Failed to report staged change %s: %v", configHash, err)
+			return false, nil
+		}
+		reported := *staged
+		reported.Reported = true
+		if a.staged.CompareAndSwap(staged, &reported) {
+			a.saveState(ctx)
+		}
+	}
+	state, err := approver.ChangeApproval(ctx, configHash)
+	if err != nil {
+		log.Printf("Warning: Failed to fetch the approval of change %s: %v", configHash, err)
+		return false, nil
+	}
+	if state != ChangeApproved && state != ChangeRejected {
+		return false, nil
+	}
+	return a.decideChange(ctx, configHash, state, decidedByVPSie) && state == ChangeApproved, nil
+}
+
+// stageChange records the change lb makes as pending approval
+func (a *Agent) stageChange(ctx context.Context, lb *models.LoadBalancer, configHash string) (*StagedChange, error) {
+	change := &StagedChange{ConfigHash: configHash, StagedAt: time.Now().UTC(), State: ChangePending}
+	if a.currentConfig().Envoy.OutputMode == OutputModeFiles {
+		envoyConfig, err := a.envoyGenerator.GenerateFullConfig(lb)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate Envoy config: %w", err)
+		}
+		a.recordDiff(ctx, configHash, envoyConfig)
+		if diff := a.lastDiff.Load(); diff != nil && diff.ConfigHash == configHash {
+			change.Diff = diff.Diff
+		}
+	}
+	a.staged.Store(change)
+	a.saveState(ctx)
+
+	log.Printf("Configuration change staged, waiting for approval (hash: %s)", configHash)
+	a.sendEvent(ctx, NewEvent(EventConfigStaged, "Configuration change waiting for approval", map[string]interface{}{
+		"config_hash": configHash,
+	}))
+	return change, nil
+}
+
+// decideChange approves or rejects the pending change with configHash. It
+// returns false when no such change is pending.
+func (a *Agent) decideChange(ctx context.Context, configHash, state, by string) bool {
+	staged := a.staged.Load()
+	if staged == nil || staged.ConfigHash != configHash || staged.State != ChangePending {
+		return false
+	}
+	decided := *staged
+	decided.State, decided.DecidedBy = state, by
+	if !a.staged.CompareAndSwap(staged, &decided) {
+		return false
+	}
+	a.saveState(ctx)
+
+	log.Printf("Configuration change %s %s by %s", configHash, state, by)
+	a.sendEvent(ctx, NewEvent(EventType("config_"+state), fmt.Sprintf("Configuration change %s", state), map[string]interface{}{
+		"config_hash": configHash,
+		"by":          by,
+	}))
+	return true
+}
+
+// markChangeApplied records that the approved change with configHash was applied
+func (a *Agent) markChangeApplied(configHash string) {
+	staged := a.staged.Load()
+	if staged == nil || staged.ConfigHash != configHash {
+		return
+	}
+	applied := *staged
+	applied.State = ChangeApplied
+	a.staged.CompareAndSwap(staged, &applied)
+}
+
+// handleApprovalStatus serves the change waiting for approval, or the last
+// decided one
+func (a *Agent) handleApprovalStatus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"enabled": a.currentConfig().Approval.Enabled, "change": a.staged.Load()})
+}
+
+// handleApprove approves the pending change named by ?config_hash= and
+// applies it right away
+func (a *Agent) handleApprove(w http.ResponseWriter, r *http.Request) {
+	a.handleDecision(w, r, ChangeApproved)
+}
+
+// handleReject rejects the pending change named by ?config_hash=; it is not
+// applied, and the next change to the configuration is staged instead
+func (a *Agent) handleReject(w http.ResponseWriter, r *http.Request) {
+	a.handleDecision(w, r, ChangeRejected)
+}
+
+// handleDecision decides on the pending change. The hash must name the
+// reviewed change, so a change staged in the meantime is not approved
+// unseen. It answers 409 when no change with that hash is pending.
+func (a *Agent) handleDecision(w http.ResponseWriter, r *http.Request, state string) {
+	configHash := r.URL.Query().Get("config_hash")
+	if configHash == "" {
+		http.Error(w, "config_hash is required", http.StatusBadRequest)
+		return
+	}
+	if !a.decideChange(r.Context(), configHash, state, decidedByAdminAPI) {
+		http.Error(w, fmt.Sprintf("no change with hash %s is pending approval", configHash), http.StatusConflict)
+		return
+	}
+	if state == ChangeApproved {
+		a.TriggerSync()
+	}
+	a.handleApprovalStatus(w, r)
+}
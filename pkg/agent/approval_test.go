@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// fakeApprover records staged changes and answers with a fixed decision
+type fakeApprover struct {
+	recordingReporter
+	staged []string
+	state  string
+}
+
+func (f *fakeApprover) StageChange(_ context.Context, change *StagedChange) error {
+	f.staged = append(f.staged, change.ConfigHash)
+	return nil
+}
+
+func (f *fakeApprover) ChangeApproval(context.Context, string) (string, error) {
+	return f.state, nil
+}
+
+func newApprovalTestAgent(t *testing.T, events EventReporter) *Agent {
+	t.Helper()
+	dir := t.TempDir()
+	manager, err := envoy.NewConfigManager(filepath.Join(dir, "dynamic"), nil)
+	if err != nil {
+		t.Fatalf("NewConfigManager() error = %v", err)
+	}
+	return &Agent{
+		config:         &Config{Envoy: EnvoySettings{OutputMode: OutputModeFiles}, Approval: ApprovalConfig{Enabled: true}},
+		events:         events,
+		envoyGenerator: envoy.NewGenerator("lb-1", dir, "127.0.0.1:9901", 9901, 50000),
+		envoyManager:   manager,
+		syncCh:         make(chan struct{}, 1),
+	}
+}
+
+var approvalTestLB = &models.LoadBalancer{
+	ID: "lb-1", Name: "web", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+	Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}},
+}
+
+func TestAgent_ApprovalThroughAdminAPI(t *testing.T) {
+	reporter := &recordingReporter{}
+	a := newApprovalTestAgent(t, reporter)
+	a.config.Admin.TokenFile = writeAdminTestToken(t)
+	handler := a.adminHandler()
+	post := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, authorizedRequest(http.MethodPost, path))
+		return rec
+	}
+	ctx := context.Background()
+
+	// The change is staged and diffed once, however often it is synced
+	for i := 0; i < 2; i++ {
+		if approved, err := a.awaitApproval(ctx, approvalTestLB, "hash-1"); err != nil || approved {
+			t.Fatalf("awaitApproval() = %t, %v, want a pending change", approved, err)
+		}
+	}
+	if staged := a.staged.Load(); staged.State != ChangePending || !strings.Contains(staged.Diff, "+++ b/clusters.yaml") {
+		t.Errorf("staged = %+v, want a pending change with its diff", staged)
+	}
+
+	tests := []struct {
+		path     string
+		wantCode int
+	}{
+		{path: "/approval/approve", wantCode: http.StatusBadRequest},
+		{path: "/approval/approve?config_hash=hash-0", wantCode: http.StatusConflict},
+		{path: "/approval/approve?config_hash=hash-1", wantCode: http.StatusOK},
+		{path: "/approval/reject?config_hash=hash-1", wantCode: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		if rec := post(tt.path); rec.Code != tt.wantCode {
+			t.Errorf("POST %s: status = %d, want %d", tt.path, rec.Code, tt.wantCode)
+		}
+	}
+	select {
+	case <-a.syncCh:
+	default:
+		t.Error("approving did not trigger a sync")
+	}
+
+	if approved, err := a.awaitApproval(ctx, approvalTestLB, "hash-1"); err != nil || !approved {
+		t.Errorf("awaitApproval() = %t, %v, want approved", approved, err)
+	}
+	a.markChangeApplied("hash-1")
+	if staged := a.staged.Load(); staged.State != ChangeApplied || staged.DecidedBy != decidedByAdminAPI {
+		t.Errorf("staged = %+v, want applied after approval through the admin API", staged)
+	}
+	if got := strings.Join(reporter.events, ","); got != "config_diff,config_staged,config_approved" {
+		t.Errorf("events = %s, want config_diff,config_staged,config_approved", got)
+	}
+}
+
+func TestAgent_ApprovalThroughVPSie(t *testing.T) {
+	approver := &fakeApprover{state: ChangePending}
+	a := newApprovalTestAgent(t, approver)
+	ctx := context.Background()
+
+	if approved, _ := a.awaitApproval(ctx, approvalTestLB, "hash-1"); approved {
+		t.Fatal("awaitApproval() approved a pending change")
+	}
+	approver.state = ChangeRejected
+	if approved, _ := a.awaitApproval(ctx, approvalTestLB, "hash-1"); approved {
+		t.Fatal("awaitApproval() approved a rejected change")
+	}
+	if staged := a.staged.Load(); staged.State != ChangeRejected || staged.DecidedBy != decidedByVPSie {
+		t.Errorf("staged = %+v, want rejected by vpsie", staged)
+	}
+
+	// A new change is staged and reported again
+	approver.state = ChangeApproved
+	if approved, _ := a.awaitApproval(ctx, approvalTestLB, "hash-2"); !approved {
+		t.Error("awaitApproval() did not apply a change approved in VPSie")
+	}
+	if got := strings.Join(approver.staged, ","); got != "hash-1,hash-2" {
+		t.Errorf("reported changes = %s, want each change once", got)
+	}
+}
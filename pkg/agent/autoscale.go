@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/autoscale"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ha"
+)
+
+// autoscaleEvaluateInterval is how often backend pool load is sampled
+const autoscaleEvaluateInterval = 15 * time.Second
+
+// scaleRequest is the body of a VPSie scaling group resize request
+type scaleRequest struct {
+	*autoscale.Request
+	LoadBalancerID string `json:"loadbalancer_id"`
+}
+
+// Scale asks VPSie to resize a scaling group
+func (c *VPSieClient) Scale(ctx context.Context, request *autoscale.Request) error {
+	reqURL := fmt.Sprintf("%s/scaling-groups/%s/scale", c.baseURL, sanitizeID(request.Group))
+	return c.doJSON(ctx, http.MethodPost, reqURL, scaleRequest{Request: request, LoadBalancerID: c.loadBalancerID}, nil)
+}
+
+// newAutoscaleController creates the autoscaling controller. Scaling requests
+// go to VPSie when the event reporter can send them; otherwise scaling
+// decisions are only reported as events.
+func (a *Agent) newAutoscaleController(stats autoscale.StatsSource) *autoscale.Controller {
+	var scaler autoscale.Scaler
+	if s, ok := a.events.(autoscale.Scaler); ok {
+		scaler = s
+	}
+	return autoscale.NewController(stats, scaler, a.eventFunc())
+}
+
+// runAutoscale evaluates autoscaling policies while this node is active
+func (a *Agent) runAutoscale(ctx context.Context) {
+	a.autoscale.Run(ctx, autoscaleEvaluateInterval, func() bool { return a.Role() == ha.RoleActive })
+}
+
+// handleAutoscaleStatus serves the autoscaling state of the backend pools
+func (a *Agent) handleAutoscaleStatus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"pools": a.autoscale.Statuses()})
+}
@@ -0,0 +1,325 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// backendHealthInterval is how often host health is sampled from Envoy, so
+// transitions between GET /backends requests are timed too
+const backendHealthInterval = 5 * time.Second
+
+// Backend health in GET /backends besides the Envoy host states
+const (
+	backendDisabled    = "disabled"    // enabled: false, not given to Envoy
+	backendQuarantined = "quarantined" // taken out of rotation for flapping
+	backendAbsent      = "absent"      // enabled, but Envoy has no host for it
+	backendDegraded    = "degraded"    // hosts of a discover_all backend disagree
+	backendUnknown     = "unknown"     // Envoy's admin interface did not answer
+)
+
+// hostHealth is the last health of an Envoy host and when it was entered
+type hostHealth struct {
+	Health string
+	Since  time.Time
+}
+
+// hostHealthTracker remembers when Envoy hosts last changed health. The
+// zero value is ready to use.
+type hostHealthTracker struct {
+	mu    sync.Mutex
+	hosts map[string]hostHealth // keyed by cluster and address
+}
+
+// observe records the current host health and returns it by host key.
+// Hosts seen for the first time count as having entered their state now.
+func (t *hostHealthTracker) observe(statuses []envoy.HostStatus, now time.Time) map[string]hostHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hosts := make(map[string]hostHealth, len(statuses))
+	for _, status := range statuses {
+		key := status.Cluster + "/" + status.Address
+		health, ok := t.hosts[key]
+		if !ok || health.Health != status.Health {
+			health = hostHealth{Health: status.Health, Since: now}
+		}
+		hosts[key] = health
+	}
+	t.hosts = hosts
+	return hosts
+}
+
+// hostCounts counts the hosts of a cluster and those that serve
+type hostCounts struct {
+	healthy, total int
+}
+
+// clusters counts the hosts of every cluster of the last sample
+func (t *hostHealthTracker) clusters() map[string]hostCounts {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clusters := make(map[string]hostCounts)
+	for key, health := range t.hosts {
+		cluster := clusterOf(key)
+		counts := clusters[cluster]
+		counts.total++
+		if !hostFailing(health.Health) {
+			counts.healthy++
+		}
+		clusters[cluster] = counts
+	}
+	return clusters
+}
+
+// runBackendHealth samples host health until ctx is cancelled and reports
+// hosts that fail or recover
+func (a *Agent) runBackendHealth(ctx context.Context) {
+	ticker := time.NewTicker(backendHealthInterval)
+	defer ticker.Stop()
+	var last map[string]string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Envoy may be restarting; the next sample catches up
+			if statuses, err := a.envoyAdmin.HostStatuses(ctx); err == nil {
+				a.backendHealth.observe(statuses, time.Now())
+				a.updateFastPath(ctx, statuses)
+				last = a.reportHealthChanges(ctx, last, statuses)
+				a.reportStatus(ctx)
+			}
+			a.releaseQuarantines(ctx, time.Now())
+		}
+	}
+}
+
+// hostFailing reports whether Envoy sends no traffic to a host in health
+func hostFailing(health string) bool {
+	return health == envoy.HostUnhealthy || health == envoy.HostEjected
+}
+
+// reportHealthChanges sends an event for every host that failed since the
+// last sample, or became healthy again after failing, and for every cluster
+// all of whose hosts failed or that recovered from that. Host transitions
+// count towards flap detection. It returns the health of the hosts by key for
+// the next sample. Hosts and clusters seen for the first time are not
+// reported.
+func (a *Agent) reportHealthChanges(ctx context.Context, last map[string]string, statuses []envoy.HostStatus) map[string]string {
+	current := make(map[string]string, len(statuses))
+	for _, status := range statuses {
+		key := status.Cluster + "/" + status.Address
+		current[key] = status.Health
+		previous, ok := last[key]
+		if !ok || previous == status.Health {
+			continue
+		}
+
+		eventType := EventBackendUnhealthy
+		switch {
+		case hostFailing(status.Health) && !hostFailing(previous):
+		case status.Health == envoy.HostHealthy && hostFailing(previous):
+			eventType = EventBackendHealthy
+		default:
+			continue
+		}
+		log.Printf("Backend %s of cluster %s is %s (was %s)", status.Address, status.Cluster, status.Health, previous)
+		a.sendEvent(ctx, NewEvent(eventType, fmt.Sprintf("Backend %s of cluster %s is %s", status.Address, status.Cluster, status.Health), map[string]interface{}{
+			"cluster":  status.Cluster,
+			"address":  status.Address,
+			"health":   status.Health,
+			"previous": previous,
+		}))
+		a.recordFlap(ctx, key, time.Now())
+	}
+
+	wasDown, down := clustersDown(last), clustersDown(current)
+	clusters := make([]string, 0, len(down))
+	for cluster := range down {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+	for _, cluster := range clusters {
+		previous, ok := wasDown[cluster]
+		if !ok || previous == down[cluster] {
+			continue
+		}
+		eventType, message := EventBackendPoolRecovered, fmt.Sprintf("Cluster %s has a healthy backend again", cluster)
+		if down[cluster] {
+			eventType, message = EventBackendPoolDown, fmt.Sprintf("All backends of cluster %s are down", cluster)
+		}
+		log.Print(message)
+		a.sendEvent(ctx, NewEvent(eventType, message, map[string]interface{}{
+			"cluster": cluster,
+		}))
+	}
+	return current
+}
+
+// clustersDown reports for the clusters of hosts, keyed by cluster and
+// address, whether all their hosts fail
+func clustersDown(hosts map[string]string) map[string]bool {
+	down := make(map[string]bool)
+	for key, health := range hosts {
+		cluster := key[:strings.LastIndex(key, "/")]
+		failing, seen := down[cluster]
+		down[cluster] = (failing || !seen) && hostFailing(health)
+	}
+	return down
+}
+
+// backendHost is an Envoy host of a backend
+type backendHost struct {
+	Since          time.Time `json:"since"`
+	Address        string    `json:"address"`
+	Health         string    `json:"health"`
+	Flaps          int       `json:"flaps"`           // health transitions within the flap detection window
+	StabilityScore int       `json:"stability_score"` // 100 without flaps
+}
+
+// backendView is a backend of GET /backends
+type backendView struct {
+	Since       *time.Time    `json:"last_transition,omitempty"`
+	Quarantined *time.Time    `json:"quarantined_until,omitempty"`
+	ID          string        `json:"id"`
+	Pool        string        `json:"pool,omitempty"`
+	Address     string        `json:"address"`
+	Status      string        `json:"status,omitempty"` // as configured in VPSie
+	Health      string        `json:"health"`
+	Hosts       []backendHost `json:"hosts,omitempty"`
+	Port        int           `json:"port"`
+	Weight      int           `json:"weight,omitempty"`
+	Priority    int           `json:"priority,omitempty"`
+	Enabled     bool          `json:"enabled"`
+}
+
+// backendsResponse is the response of GET /backends
+type backendsResponse struct {
+	Error    string        `json:"error,omitempty"`
+	Backends []backendView `json:"backends"`
+}
+
+// handleBackends lists every backend of the applied configuration with its
+// configured state, the health of its Envoy hosts and when that health last
+// changed. It answers 503 with the configured state only when Envoy's admin
+// interface is unreachable.
+func (a *Agent) handleBackends(w http.ResponseWriter, r *http.Request) {
+	lb := a.lastApplied.Load()
+	if lb == nil {
+		http.Error(w, "no configuration has been applied yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	code := http.StatusOK
+	var response backendsResponse
+	var hosts map[string]hostHealth
+	statuses, err := a.envoyAdmin.HostStatuses(r.Context())
+	if err != nil {
+		response.Error = err.Error()
+		code = http.StatusServiceUnavailable
+	} else {
+		hosts = a.backendHealth.observe(statuses, time.Now())
+	}
+
+	response.Backends = backendViews(lb, "", lb.Backends, statuses, hosts)
+	for _, pool := range lb.Pools {
+		response.Backends = append(response.Backends, backendViews(lb, pool.Name, pool.Backends, statuses, hosts)...)
+	}
+	a.addStability(lb, response.Backends)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// addStability adds the flapping of their hosts to backend views and marks
+// quarantined backends
+func (a *Agent) addStability(lb *models.LoadBalancer, views []backendView) {
+	stability := make(map[string]BackendStability)
+	for _, s := range a.flaps.stability(time.Now(), &a.currentConfig().FlapDetection) {
+		stability[s.Cluster+"/"+s.Address] = s
+	}
+	for i := range views {
+		view := &views[i]
+		cluster := envoy.ClusterName(lb, view.Pool)
+		for j := range view.Hosts {
+			host := &view.Hosts[j]
+			host.StabilityScore = 100
+			if s, ok := stability[cluster+"/"+host.Address]; ok {
+				host.Flaps, host.StabilityScore = s.Flaps, s.StabilityScore
+			}
+		}
+		// Quarantined backends are disabled, so Envoy has no hosts for them
+		address := net.JoinHostPort(view.Address, strconv.Itoa(view.Port))
+		if s, ok := stability[cluster+"/"+address]; ok && s.QuarantinedUntil != nil {
+			view.Health, view.Quarantined = backendQuarantined, s.QuarantinedUntil
+		}
+	}
+}
+
+// backendViews merges the backends of a pool with the health of their hosts
+func backendViews(lb *models.LoadBalancer, pool string, backends []models.Backend, statuses []envoy.HostStatus, hosts map[string]hostHealth) []backendView {
+	cluster := envoy.ClusterName(lb, pool)
+	views := make([]backendView, 0, len(backends))
+	for _, backend := range backends {
+		view := backendView{
+			ID:       backend.ID,
+			Pool:     pool,
+			Address:  backend.Address,
+			Status:   backend.Status,
+			Port:     backend.Port,
+			Weight:   backend.Weight,
+			Priority: backend.Priority,
+			Enabled:  backend.Enabled,
+		}
+		port := strconv.Itoa(backend.Port)
+		for _, status := range statuses {
+			// Hosts resolved from a hostname carry it
+			if status.Cluster != cluster || (status.Address != net.JoinHostPort(backend.Address, port) &&
+				(status.Hostname != backend.Address || !strings.HasSuffix(status.Address, ":"+port))) {
+				continue
+			}
+			health := hosts[status.Cluster+"/"+status.Address]
+			view.Hosts = append(view.Hosts, backendHost{Address: status.Address, Health: health.Health, Since: health.Since})
+		}
+		view.Health, view.Since = backendHealth(&view, statuses != nil)
+		views = append(views, view)
+	}
+	return views
+}
+
+// backendHealth sums up the hosts of a backend: their common health, or
+// degraded when they differ, and the latest transition
+func backendHealth(view *backendView, known bool) (string, *time.Time) {
+	switch {
+	case !view.Enabled:
+		return backendDisabled, nil
+	case !known:
+		return backendUnknown, nil
+	case len(view.Hosts) == 0:
+		return backendAbsent, nil
+	}
+	health := view.Hosts[0].Health
+	since := view.Hosts[0].Since
+	for _, host := range view.Hosts[1:] {
+		if host.Health != health {
+			health = backendDegraded
+		}
+		if host.Since.After(since) {
+			since = host.Since
+		}
+	}
+	return health, &since
+}
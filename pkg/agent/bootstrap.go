@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+)
+
+// restartWindow is a daily UTC time range, written "HH:MM-HH:MM". A window
+// whose end is before its start spans midnight.
+type restartWindow struct {
+	start, end time.Duration // offsets from midnight
+}
+
+// parseRestartWindow parses an envoy.restart_window value
+func parseRestartWindow(s string) (restartWindow, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return restartWindow{}, fmt.Errorf("must be HH:MM-HH:MM")
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return restartWindow{}, fmt.Errorf("invalid start %q: must be HH:MM", from)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return restartWindow{}, fmt.Errorf("invalid end %q: must be HH:MM", to)
+	}
+	if start.Equal(end) {
+		return restartWindow{}, fmt.Errorf("start and end must differ")
+	}
+	return restartWindow{
+		start: time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+		end:   time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute,
+	}, nil
+}
+
+// contains reports whether t falls inside the window
+func (w restartWindow) contains(t time.Time) bool {
+	t = t.UTC()
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if w.start < w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
+// reconcileBootstrap regenerates the Envoy bootstrap from the agent
+// settings (node ID, admin address, connection limit, overload protection)
+// and replaces the bootstrap file when it differs. Envoy reads the bootstrap
+// only when it starts, so a change schedules a restart; see
+// applyPendingBootstrap.
+func (a *Agent) reconcileBootstrap(ctx context.Context) {
+	bootstrap, err := a.envoyGenerator.GenerateBootstrap()
+	if err != nil {
+		log.Printf("Warning: Failed to generate bootstrap: %v", err)
+		return
+	}
+	changed, err := a.envoyManager.UpdateBootstrap(bootstrap)
+	if err != nil {
+		log.Printf("Warning: Bootstrap not updated: %v", err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	a.bootstrapPending.Store(true)
+	log.Printf("Bootstrap %s updated from the agent settings; Envoy restart scheduled", a.envoyManager.BootstrapPath())
+	a.sendEvent(ctx, NewEvent(EventBootstrapUpdated, "Envoy bootstrap updated, restart scheduled", map[string]interface{}{
+		"path":           a.envoyManager.BootstrapPath(),
+		"restart_window": a.currentConfig().Envoy.RestartWindow,
+	}))
+}
+
+// applyPendingBootstrap restarts Envoy for an updated bootstrap once the
+// restart window is open. Hot restarts made for configuration changes load
+// the new bootstrap too and clear the pending restart.
+func (a *Agent) applyPendingBootstrap(ctx context.Context) {
+	if !a.bootstrapPending.Load() || a.draining.Load() {
+		return
+	}
+
+	cfg := a.currentConfig().Envoy
+	if cfg.RestartWindow != "" {
+		window, err := parseRestartWindow(cfg.RestartWindow)
+		if err != nil || !window.contains(time.Now()) {
+			return
+		}
+	}
+
+	log.Printf("Restarting Envoy to load the updated bootstrap (strategy: %s)", cfg.ReloadStrategy)
+	var err error
+	switch cfg.ReloadStrategy {
+	case envoy.StrategySIGHUP:
+		// SIGHUP does not make Envoy read its bootstrap again
+		log.Printf("Warning: Restart Envoy to load the updated bootstrap; the %s strategy cannot restart it", envoy.StrategySIGHUP)
+		a.bootstrapPending.Store(false)
+		return
+	case envoy.StrategySystemd:
+		// A remote Envoy, always run by systemd, needs the new bootstrap first
+		if err = a.deliverEnvoyConfig(ctx); err == nil {
+			err = a.envoyReloader.RestartSystemd(ctx, cfg.SystemdUnit)
+		}
+	case envoy.StrategyDrainRestart:
+		err = a.envoyReloader.DrainAndRestart(ctx, a.envoyAdmin, cfg.DrainTime)
+	default:
+		err = a.envoyReloader.Reload()
+	}
+	if err != nil {
+		log.Printf("Error restarting Envoy for the updated bootstrap: %v", err)
+		a.sendEvent(ctx, NewEvent(EventEnvoyReloadFailed, err.Error(), map[string]interface{}{
+			"strategy": cfg.ReloadStrategy,
+			"epoch":    a.envoyReloader.GetCurrentEpoch(),
+			"reason":   "bootstrap",
+		}))
+		return
+	}
+	a.bootstrapPending.Store(false)
+	a.sendEvent(ctx, NewEvent(EventEnvoyReloaded, "Envoy restarted with the updated bootstrap", map[string]interface{}{
+		"strategy": cfg.ReloadStrategy,
+		"epoch":    a.envoyReloader.GetCurrentEpoch(),
+		"reason":   "bootstrap",
+	}))
+}
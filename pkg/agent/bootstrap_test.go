@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+)
+
+func TestRestartWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2026, 1, 1, hour, minute, 0, 0, time.UTC) }
+
+	tests := []struct {
+		window  string
+		wantErr bool
+		inside  []time.Time
+		outside []time.Time
+	}{
+		{window: "02:00-04:00", inside: []time.Time{at(2, 0), at(3, 59)}, outside: []time.Time{at(1, 59), at(4, 0)}},
+		{window: "23:30-01:00", inside: []time.Time{at(23, 30), at(0, 30)}, outside: []time.Time{at(1, 0), at(12, 0)}},
+		{window: "02:00", wantErr: true},
+		{window: "2am-4am", wantErr: true},
+		{window: "03:00-03:00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.window, func(t *testing.T) {
+			w, err := parseRestartWindow(tt.window)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRestartWindow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, ts := range tt.inside {
+				if !w.contains(ts) {
+					t.Errorf("%s not inside %s", ts.Format("15:04"), tt.window)
+				}
+			}
+			for _, ts := range tt.outside {
+				if w.contains(ts) {
+					t.Errorf("%s inside %s", ts.Format("15:04"), tt.window)
+				}
+			}
+		})
+	}
+}
+
+func TestAgent_ReconcileBootstrap(t *testing.T) {
+	baseDir := t.TempDir()
+	validator := filepath.Join(baseDir, "envoy")
+	if err := os.WriteFile(validator, []byte("#!/bin/sh\nexit 0\n"), 0700); err != nil {
+		t.Fatalf("failed to write fake envoy: %v", err)
+	}
+	manager, err := envoy.NewConfigManager(filepath.Join(baseDir, "dynamic"), envoy.NewValidator(validator))
+	if err != nil {
+		t.Fatalf("NewConfigManager() error = %v", err)
+	}
+	newAgent := func(maxConnections int) *Agent {
+		cfg := &Config{Envoy: EnvoySettings{ReloadStrategy: envoy.StrategySIGHUP}}
+		return &Agent{
+			config:         cfg,
+			events:         logEventReporter{},
+			envoyManager:   manager,
+			envoyGenerator: envoy.NewGenerator("lb-1", filepath.Join(baseDir, "dynamic"), "127.0.0.1:9901", 9901, maxConnections),
+		}
+	}
+
+	a := newAgent(50000)
+	a.reconcileBootstrap(context.Background())
+	if !a.bootstrapPending.Load() {
+		t.Fatal("a new bootstrap must schedule a restart")
+	}
+
+	// Outside the window the restart waits; inside it the SIGHUP strategy can
+	// only warn, which settles the pending restart
+	closed := time.Now().UTC().Add(2 * time.Hour)
+	a.config.Envoy.RestartWindow = closed.Format("15:04") + "-" + closed.Add(time.Hour).Format("15:04")
+	a.applyPendingBootstrap(context.Background())
+	if !a.bootstrapPending.Load() {
+		t.Error("restart applied outside the restart window")
+	}
+	a.config.Envoy.RestartWindow = ""
+	a.applyPendingBootstrap(context.Background())
+	if a.bootstrapPending.Load() {
+		t.Error("pending restart not settled")
+	}
+
+	// Unchanged settings leave the bootstrap alone
+	a = newAgent(50000)
+	a.reconcileBootstrap(context.Background())
+	if a.bootstrapPending.Load() {
+		t.Error("unchanged bootstrap scheduled a restart")
+	}
+
+	a = newAgent(1000)
+	a.reconcileBootstrap(context.Background())
+	if !a.bootstrapPending.Load() {
+		t.Error("changed max_connections did not schedule a restart")
+	}
+}
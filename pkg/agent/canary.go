@@ -0,0 +1,31 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/canary"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ha"
+)
+
+// canaryEvaluateInterval is how often rollouts are checked for a due step
+const canaryEvaluateInterval = 5 * time.Second
+
+// newCanaryController creates the canary controller. Rollout events go to the
+// agent's event reporter and every weight change triggers a sync.
+func (a *Agent) newCanaryController(stats canary.StatsSource) *canary.Controller {
+	return canary.NewController(stats, a.eventFunc(), a.TriggerSync)
+}
+
+// runCanary evaluates canary rollouts while this node is active
+func (a *Agent) runCanary(ctx context.Context) {
+	a.canary.Run(ctx, canaryEvaluateInterval, func() bool { return a.Role() == ha.RoleActive })
+}
+
+// handleCanaryStatus serves the state of the canary rollouts
+func (a *Agent) handleCanaryStatus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"rollouts": a.canary.Statuses()})
+}
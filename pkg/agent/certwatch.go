@@ -0,0 +1,259 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// CertWatchConfig makes the agent watch the certificate directory and reload
+// Envoy when external tooling (certbot, cert-manager, ...) replaces the
+// certificate or key of the applied configuration. Envoy reads certificate
+// files only when it loads a listener, so a renewal otherwise goes unnoticed
+// until the next configuration change.
+type CertWatchConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Dir      string        `yaml:"dir"`      // watched with its subdirectories, default /etc/vpsie-lb/certs
+	Debounce time.Duration `yaml:"debounce"` // quiet time before reloading, so the certificate and key are both replaced, default 2s
+}
+
+// Default certificate watch settings applied by LoadConfig
+const (
+	defaultCertWatchDir      = "/etc/vpsie-lb/certs"
+	defaultCertWatchDebounce = 2 * time.Second
+)
+
+// Certificate watch debounce bounds enforced by validate
+const (
+	minCertWatchDebounce = 100 * time.Millisecond
+	maxCertWatchDebounce = time.Minute
+)
+
+// setDefaults fills in unset certificate watch settings
+func (c *CertWatchConfig) setDefaults() {
+	if c.Dir == "" {
+		c.Dir = defaultCertWatchDir
+	}
+	if c.Debounce == 0 {
+		c.Debounce = defaultCertWatchDebounce
+	}
+}
+
+// validate checks the certificate watch settings
+func (c *CertWatchConfig) validate() []error {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []error
+	if !filepath.IsAbs(c.Dir) {
+		errs = append(errs, fmt.Errorf("cert_watch.dir %q must be absolute", c.Dir))
+	}
+	if c.Debounce < minCertWatchDebounce || c.Debounce > maxCertWatchDebounce {
+		errs = append(errs, fmt.Errorf("cert_watch.debounce %s must be between %s and %s", c.Debounce, minCertWatchDebounce, maxCertWatchDebounce))
+	}
+	return errs
+}
+
+// runCertWatch watches the certificate directory and asks the main loop to
+// check the certificates after each (debounced) change
+func (a *Agent) runCertWatch(ctx context.Context, cfg CertWatchConfig) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("Warning: Failed to create certificate watcher: %v", err)
+		return
+	}
+	defer func() { _ = watcher.Close() }()
+
+	if err = watchTree(watcher, cfg.Dir); err != nil {
+		log.Printf("Warning: Failed to watch certificates in %s: %v", cfg.Dir, err)
+		return
+	}
+	log.Printf("Watching certificates in %s", cfg.Dir)
+
+	debounce := time.NewTimer(cfg.Debounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+				continue
+			}
+			// Renewal tools often write into new directories and switch symlinks
+			if event.Op&fsnotify.Create != 0 {
+				if info, statErr := os.Stat(event.Name); statErr == nil && info.IsDir() {
+					if err = watchTree(watcher, event.Name); err != nil {
+						log.Printf("Warning: Failed to watch certificates in %s: %v", event.Name, err)
+					}
+				}
+			}
+			debounce.Reset(cfg.Debounce)
+
+		case watchErr, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Warning: Certificate watcher error: %v", watchErr)
+
+		case <-debounce.C:
+			a.checkCertificates()
+		}
+	}
+}
+
+// checkCertificates asks the main loop to check the certificate files
+func (a *Agent) checkCertificates() {
+	select {
+	case a.certCh <- struct{}{}:
+	default:
+		// A check is already pending
+	}
+}
+
+// watchTree adds dir and its subdirectories to watcher
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		return watcher.Add(path)
+	})
+}
+
+// reloadCertificates reloads Envoy when the certificate files of the applied
+// configuration changed. The new certificate must match its key and be
+// valid; otherwise Envoy keeps serving the old one and the check is repeated
+// on the next change.
+func (a *Agent) reloadCertificates(ctx context.Context) {
+	lb := a.lastApplied.Load()
+	if lb == nil || lb.TLSConfig == nil {
+		return
+	}
+	fingerprint, err := certificateFingerprint(lb.TLSConfig)
+	if err != nil {
+		log.Printf("Warning: Failed to read certificates: %v", err)
+		a.sendEvent(ctx, NewEvent(EventCertificateInvalid, "Certificate files could not be read", map[string]interface{}{
+			"certificate_path": lb.TLSConfig.CertificatePath,
+			"error":            err.Error(),
+		}))
+		return
+	}
+	previous, _ := a.certFingerprint.Load().(string)
+	if fingerprint == previous {
+		return
+	}
+
+	// The reload events share a correlation ID
+	ctx = withCorrelationID(ctx)
+
+	if err = validateCertificates(lb.TLSConfig, time.Now()); err != nil {
+		log.Printf("Warning: Not reloading replaced certificate: %v", err)
+		a.sendEvent(ctx, NewEvent(EventCertificateInvalid, "Replaced certificate was not loaded", map[string]interface{}{
+			"certificate_path": lb.TLSConfig.CertificatePath,
+			"error":            err.Error(),
+		}))
+		return
+	}
+
+	configHash, _ := a.lastConfigHash.Load().(string)
+	log.Printf("Certificate %s replaced, reloading", lb.TLSConfig.CertificatePath)
+	if a.currentConfig().Envoy.OutputMode == OutputModeXDSSnapshot {
+		// A new version makes the external control plane push the secrets again
+		var snapshot *envoy.Snapshot
+		if snapshot, err = a.envoyGenerator.GenerateSnapshot(lb, configHash+"-"+fingerprint[:12]); err == nil {
+			err = a.envoyManager.WriteSnapshot(snapshot)
+		}
+	} else {
+		err = a.reloadEnvoy(ctx)
+	}
+	if err != nil {
+		log.Printf("Error reloading certificates: %v", err)
+		return
+	}
+	a.certFingerprint.Store(fingerprint)
+
+	a.sendEvent(ctx, NewEvent(EventCertificateReloaded, "Replaced certificate loaded", map[string]interface{}{
+		"certificate_path": lb.TLSConfig.CertificatePath,
+		"config_hash":      configHash,
+	}))
+}
+
+// recordCertificates remembers the certificate files lb was applied with, so
+// only later replacements cause a reload
+func (a *Agent) recordCertificates(lb *models.LoadBalancer) {
+	var fingerprint string
+	if lb.TLSConfig != nil {
+		// Unreadable files count as changed once they can be read
+		fingerprint, _ = certificateFingerprint(lb.TLSConfig)
+	}
+	a.certFingerprint.Store(fingerprint)
+}
+
+// certificateFingerprint hashes the certificate, key and CA files of cfg
+func certificateFingerprint(cfg *models.TLSConfig) (string, error) {
+	h := sha256.New()
+	for _, path := range []string{cfg.CertificatePath, cfg.PrivateKeyPath, cfg.CACertPath} {
+		if path == "" {
+			continue
+		}
+		// #nosec G304 -- paths are validated to be inside the certificate directory
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(data)
+		h.Write(sum[:])
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// validateCertificates checks that the certificate matches its private key
+// and is valid at now, and that the CA file holds certificates
+func validateCertificates(cfg *models.TLSConfig, now time.Time) error {
+	pair, err := tls.LoadX509KeyPair(cfg.CertificatePath, cfg.PrivateKeyPath)
+	if err != nil {
+		return fmt.Errorf("certificate %s does not match key %s: %w", cfg.CertificatePath, cfg.PrivateKeyPath, err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate %s: %w", cfg.CertificatePath, err)
+	}
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return fmt.Errorf("certificate %s is only valid from %s to %s", cfg.CertificatePath,
+			leaf.NotBefore.Format(time.RFC3339), leaf.NotAfter.Format(time.RFC3339))
+	}
+	if cfg.CACertPath != "" {
+		// #nosec G304 -- path is validated to be inside the certificate directory
+		data, err := os.ReadFile(cfg.CACertPath)
+		if err != nil {
+			return err
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(data) {
+			return fmt.Errorf("CA file %s holds no certificates", cfg.CACertPath)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// writeTestCertificate writes a self-signed certificate valid until notAfter
+// and its key to dir, and returns the key PEM
+func writeTestCertificate(t *testing.T, dir string, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "shop.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error = %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err = os.WriteFile(filepath.Join(dir, "cert.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "key.pem"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return keyPEM
+}
+
+func TestAgent_ReloadCertificates(t *testing.T) {
+	certDir := t.TempDir()
+
+	// A stand-in for Envoy that the SIGHUP strategy signals
+	process := exec.Command("sleep", "60")
+	if err := process.Start(); err != nil {
+		t.Skipf("cannot start sleep: %v", err)
+	}
+	defer func() { _ = process.Process.Kill(); _ = process.Wait() }()
+	pidFile := filepath.Join(t.TempDir(), "envoy.pid")
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(process.Process.Pid)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	reloader, err := envoy.NewReloader("/usr/bin/envoy", "/tmp/envoy.yaml", pidFile, "")
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	reporter := &recordingReporter{}
+	a := &Agent{
+		config:        &Config{Envoy: EnvoySettings{OutputMode: OutputModeFiles, ReloadStrategy: envoy.StrategySIGHUP}},
+		events:        reporter,
+		envoyReloader: reloader,
+	}
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "shop", Protocol: models.ProtocolHTTPS, Algorithm: models.AlgoRoundRobin, Port: 443,
+		Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}},
+		TLSConfig: &models.TLSConfig{
+			CertificatePath: filepath.Join(certDir, "cert.pem"),
+			PrivateKeyPath:  filepath.Join(certDir, "key.pem"),
+			MinVersion:      "TLSv1.2",
+		},
+	}
+	oldKey := writeTestCertificate(t, certDir, time.Now().Add(24*time.Hour))
+	a.lastConfigHash.Store("hash-1")
+	a.lastApplied.Store(lb)
+	a.recordCertificates(lb)
+
+	// Unchanged certificates are not reloaded
+	a.reloadCertificates(context.Background())
+	if len(reporter.events) != 0 {
+		t.Errorf("events for unchanged certificates = %v", reporter.events)
+	}
+
+	// A renewed certificate whose key was not replaced yet is refused
+	writeTestCertificate(t, certDir, time.Now().Add(48*time.Hour))
+	renewedKey, _ := os.ReadFile(lb.TLSConfig.PrivateKeyPath)
+	if err = os.WriteFile(lb.TLSConfig.PrivateKeyPath, oldKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+	a.reloadCertificates(context.Background())
+
+	// Once the key matches, Envoy is reloaded, once
+	if err = os.WriteFile(lb.TLSConfig.PrivateKeyPath, renewedKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+	a.reloadCertificates(context.Background())
+	a.reloadCertificates(context.Background())
+	if got := strings.Join(reporter.events, ","); got != "certificate_invalid,envoy_reloaded,certificate_reloaded" {
+		t.Errorf("events = %s, want certificate_invalid,envoy_reloaded,certificate_reloaded", got)
+	}
+	if reloaded := reporter.sent[1:]; reloaded[0].CorrelationID == "" || reloaded[0].CorrelationID != reloaded[1].CorrelationID {
+		t.Errorf("reload events not correlated: %q, %q", reloaded[0].CorrelationID, reloaded[1].CorrelationID)
+	}
+}
+
+func TestValidateCertificates(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &models.TLSConfig{CertificatePath: filepath.Join(dir, "cert.pem"), PrivateKeyPath: filepath.Join(dir, "key.pem")}
+
+	writeTestCertificate(t, dir, time.Now().Add(time.Hour))
+	if err := validateCertificates(cfg, time.Now()); err != nil {
+		t.Errorf("validateCertificates() error = %v", err)
+	}
+	if err := validateCertificates(cfg, time.Now().Add(2*time.Hour)); err == nil || !strings.Contains(err.Error(), "only valid") {
+		t.Errorf("validateCertificates() for an expired certificate error = %v", err)
+	}
+
+	cfg.CACertPath = filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(cfg.CACertPath, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateCertificates(cfg, time.Now()); err == nil || !strings.Contains(err.Error(), "holds no certificates") {
+		t.Errorf("validateCertificates() for an invalid CA file error = %v", err)
+	}
+}
@@ -2,36 +2,173 @@ package agent
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
 )
 
 // Config represents the agent configuration
 type Config struct {
-	Envoy   EnvoySettings `yaml:"envoy"`
-	VPSie   VPSieConfig   `yaml:"vpsie"`
-	Logging LoggingConfig `yaml:"logging"`
+	Environment      string                 `yaml:"environment"` // production (default) or staging; only staging nodes inject faults
+	Envoy            EnvoySettings          `yaml:"envoy"`
+	Proxy            ProxyConfig            `yaml:"proxy"`
+	VPSie            VPSieConfig            `yaml:"vpsie"`
+	Source           SourceConfig           `yaml:"source"`
+	Logging          LoggingConfig          `yaml:"logging"`
+	Admin            AdminConfig            `yaml:"admin"`
+	HA               HAConfig               `yaml:"ha"`
+	Discovery        DiscoveryConfig        `yaml:"discovery"`
+	AccessLogService AccessLogServiceConfig `yaml:"access_log_service"`
+	WAF              WAFConfig              `yaml:"waf"`
+	WASM             WASMConfig             `yaml:"wasm"`
+	Firewall         FirewallConfig         `yaml:"firewall"`
+	FastPath         FastPathConfig         `yaml:"fast_path"`
+	HealthDNS        HealthDNSConfig        `yaml:"health_dns"`
+	GSLB             GSLBConfig             `yaml:"gslb"`
+	Pause            PauseConfig            `yaml:"pause"`
+	Approval         ApprovalConfig         `yaml:"approval"`
+	State            StateConfig            `yaml:"state"`
+	CertWatch        CertWatchConfig        `yaml:"cert_watch"`
+	SessionTickets   SessionTicketConfig    `yaml:"session_tickets"`
+	Probe            ProbeConfig            `yaml:"probe"`
+	Notifications    NotificationsConfig    `yaml:"notifications"`
+	FlapDetection    FlapDetectionConfig    `yaml:"flap_detection"`
+	SlowBackends     SlowBackendConfig      `yaml:"slow_backends"`
+	Shutdown         ShutdownConfig         `yaml:"shutdown"`
+	Variables        VariablesConfig        `yaml:"variables"`
+	TLSKeys          []TLSKeySecret         `yaml:"tls_keys"`
+}
+
+// Configuration source modes
+const (
+	// SourceModeAPI fetches load balancer configuration from the VPSie API
+	SourceModeAPI = "api"
+	// SourceModeFile reads load balancer configuration from a local file
+	SourceModeFile = "file"
+	// SourceModeKubernetesIngress translates Kubernetes Ingresses into the load balancer configuration
+	SourceModeKubernetesIngress = "kubernetes_ingress"
+)
+
+// SourceConfig selects where the load balancer configuration comes from
+type SourceConfig struct {
+	Mode       string                 `yaml:"mode"`       // api (default), file or kubernetes_ingress
+	Path       string                 `yaml:"path"`       // loadbalancer.yaml, or a directory containing it (file mode only)
+	Kubernetes KubernetesSourceConfig `yaml:"kubernetes"` // kubernetes_ingress mode only
+}
+
+// KubernetesSourceConfig configures the kubernetes_ingress source
+type KubernetesSourceConfig struct {
+	Server        string `yaml:"server"`         // API server URL; empty uses the in-cluster service account
+	TokenFile     string `yaml:"token_file"`     // bearer token for server
+	CAFile        string `yaml:"ca_file"`        // CA bundle for server (default: system roots)
+	IngressClass  string `yaml:"ingress_class"`  // default "vpsie"
+	BackendTarget string `yaml:"backend_target"` // node_port (default) or pod
+	Port          int    `yaml:"port"`           // HTTP listener port, default 80
 }
 
 // VPSieConfig contains VPSie API configuration
 type VPSieConfig struct {
-	APIURL         string        `yaml:"api_url"`
-	APIKeyFile     string        `yaml:"api_key_file"`
-	LoadBalancerID string        `yaml:"loadbalancer_id"`
-	PollInterval   time.Duration `yaml:"poll_interval"`
+	APIKeySource      *SecretSource `yaml:"api_key_source"` // overrides api_key_file when set
+	APIURL            string        `yaml:"api_url"`
+	APIKeyFile        string        `yaml:"api_key_file"`
+	LoadBalancerID    string        `yaml:"loadbalancer_id"`
+	PollInterval      time.Duration `yaml:"poll_interval"`
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"` // how often the node reports that it is alive
+	NodeMetadata      bool          `yaml:"node_metadata"`      // fetch the region, zone, VIPs and plan limits of the node at startup
 }
 
+// Envoy output modes
+const (
+	// OutputModeFiles writes listener/cluster files and hot restarts the local Envoy
+	OutputModeFiles = "files"
+	// OutputModeXDSSnapshot writes an xDS snapshot for an external control plane
+	OutputModeXDSSnapshot = "xds_snapshot"
+)
+
 // EnvoySettings contains Envoy-specific configuration
 type EnvoySettings struct {
-	ConfigPath     string `yaml:"config_path"`
-	AdminAddress   string `yaml:"admin_address"`
-	BinaryPath     string `yaml:"binary_path"`
-	PidFile        string `yaml:"pid_file"`
-	AdminPort      int    `yaml:"admin_port"`
-	MaxConnections int    `yaml:"max_connections"`
+	ConfigPath      string              `yaml:"config_path"`
+	AdminAddress    string              `yaml:"admin_address"`
+	BinaryPath      string              `yaml:"binary_path"`
+	Runtime         string              `yaml:"runtime"`   // binary (default), docker or podman
+	Container       ContainerSettings   `yaml:"container"` // Envoy container of the docker and podman runtimes
+	Remote          RemoteSettings      `yaml:"remote"`    // run Envoy on another host, reached over SSH
+	PidFile         string              `yaml:"pid_file"`
+	EpochFile       string              `yaml:"epoch_file"`       // last hot restart epoch, restored on agent start
+	OutputMode      string              `yaml:"output_mode"`      // files (default) or xds_snapshot
+	XDSEndpoints    bool                `yaml:"xds_endpoints"`    // xds_snapshot: backends as EDS resources, updated without touching their cluster
+	ReloadStrategy  string              `yaml:"reload_strategy"`  // hot-restart (default), sighup, systemd or admin-drain+restart
+	SystemdUnit     string              `yaml:"systemd_unit"`     // unit reloaded by the systemd strategy
+	DrainTime       time.Duration       `yaml:"drain_time"`       // connection drain time of the admin-drain+restart strategy
+	RestartWindow   string              `yaml:"restart_window"`   // daily UTC window for bootstrap restarts, e.g. 02:00-04:00; empty restarts right away
+	LegacyTemplates bool                `yaml:"legacy_templates"` // render configuration with the text templates instead of the structured builders
+	LiveClusters    bool                `yaml:"live_clusters"`    // apply changes to clusters only (backends, weights) without reloading Envoy
+	ReloadLimit     ReloadLimitSettings `yaml:"reload_limit"`     // debounce triggered syncs and space Envoy reloads apart
+	AdminPort       int                 `yaml:"admin_port"`
+	MaxConnections  int                 `yaml:"max_connections"` // global downstream connection limit
+	Overload        OverloadSettings    `yaml:"overload"`
+	Locality        LocalitySettings    `yaml:"locality"`
+	Verify          VerifySettings      `yaml:"verify"`     // compare Envoy's config dump with each applied configuration
+	StatsTags       map[string]string   `yaml:"stats_tags"` // fixed tags added to every Envoy statistic
+	Isolate         bool                `yaml:"isolate"`    // keep the files of this load balancer in config_path/<loadbalancer_id>
+}
+
+// isolationStatsTag is the Envoy statistics tag holding the load balancer ID
+// of isolated load balancers
+const isolationStatsTag = "loadbalancer_id"
+
+// dynamicDir returns the directory of the dynamic Envoy configuration; the
+// bootstrap is written to its parent. With envoy.isolate each load balancer
+// on the host gets its own tree, config_path/<loadbalancer_id> with the
+// bootstrap and the dynamic directory, so its configuration, validation and
+// backups never touch those of another.
+func (e *EnvoySettings) dynamicDir(loadBalancerID string) string {
+	if !e.Isolate {
+		return e.ConfigPath
+	}
+	return filepath.Join(e.ConfigPath, loadBalancerID, "dynamic")
+}
+
+// setIsolationDefaults gives an isolated load balancer its own Envoy PID
+// file, and its own epoch file without a state directory, when they are not
+// set. Its Envoy statistics are tagged with its ID.
+func (e *EnvoySettings) setIsolationDefaults(loadBalancerID, stateDir string) {
+	if !e.Isolate || !idPattern.MatchString(loadBalancerID) {
+		return
+	}
+	if _, ok := e.StatsTags[isolationStatsTag]; !ok {
+		if e.StatsTags == nil {
+			e.StatsTags = make(map[string]string)
+		}
+		e.StatsTags[isolationStatsTag] = loadBalancerID
+	}
+	if e.PidFile == "" {
+		e.PidFile = fmt.Sprintf("/var/run/envoy-%s.pid", loadBalancerID)
+	}
+	if e.EpochFile == "" && stateDir == "" {
+		e.EpochFile = fmt.Sprintf("/var/run/envoy-%s.epoch", loadBalancerID)
+	}
+}
+
+// LocalitySettings is the region and zone of this load balancer node. Envoy
+// prefers backends in the same zone, then the same region.
+type LocalitySettings struct {
+	Region string `yaml:"region"`
+	Zone   string `yaml:"zone"`
 }
 
 // LoggingConfig contains logging configuration
@@ -56,6 +193,9 @@ func LoadConfig(path string) (*Config, error) {
 	if config.VPSie.PollInterval == 0 {
 		config.VPSie.PollInterval = 30 * time.Second
 	}
+	if config.VPSie.HeartbeatInterval == 0 {
+		config.VPSie.HeartbeatInterval = time.Minute
+	}
 	if config.Envoy.AdminAddress == "" {
 		config.Envoy.AdminAddress = "127.0.0.1:9901"
 	}
@@ -65,12 +205,64 @@ func LoadConfig(path string) (*Config, error) {
 	if config.Envoy.MaxConnections == 0 {
 		config.Envoy.MaxConnections = 50000
 	}
+	config.Envoy.setIsolationDefaults(config.VPSie.LoadBalancerID, config.State.Dir)
 	if config.Envoy.PidFile == "" {
 		config.Envoy.PidFile = "/var/run/envoy.pid"
 	}
+	if config.Envoy.EpochFile == "" && config.State.Dir != "" {
+		config.Envoy.EpochFile = filepath.Join(config.State.Dir, epochFileName)
+	}
+	if config.Envoy.EpochFile == "" {
+		config.Envoy.EpochFile = "/var/run/envoy.epoch"
+	}
 	if config.Envoy.BinaryPath == "" {
 		config.Envoy.BinaryPath = "/usr/bin/envoy"
 	}
+	if config.Envoy.Runtime == "" {
+		config.Envoy.Runtime = envoy.RuntimeBinary
+	}
+	config.Envoy.Container.setDefaults()
+	if config.Envoy.OutputMode == "" {
+		config.Envoy.OutputMode = OutputModeFiles
+	}
+	if config.Envoy.ReloadStrategy == "" {
+		config.Envoy.ReloadStrategy = envoy.StrategyHotRestart
+	}
+	if config.Envoy.SystemdUnit == "" {
+		config.Envoy.SystemdUnit = "envoy.service"
+	}
+	if config.Envoy.DrainTime == 0 {
+		config.Envoy.DrainTime = 15 * time.Second
+	}
+	if config.Source.Mode == "" {
+		config.Source.Mode = SourceModeAPI
+	}
+	if config.Source.Mode == SourceModeKubernetesIngress {
+		config.Source.Kubernetes.setDefaults()
+	}
+	config.Envoy.Overload.setDefaults()
+	config.Proxy.setDefaults()
+	config.Envoy.Verify.setDefaults()
+	config.Envoy.ReloadLimit.setDefaults()
+	config.HA.setDefaults()
+	config.Discovery.setDefaults()
+	config.AccessLogService.setDefaults()
+	config.WAF.setDefaults()
+	config.WASM.setDefaults()
+	config.FastPath.setDefaults()
+	config.HealthDNS.setDefaults()
+	config.GSLB.setDefaults(config.Envoy.Locality.Region)
+	config.State.setDefaults()
+	config.CertWatch.setDefaults()
+	config.SessionTickets.setDefaults()
+	config.Probe.setDefaults()
+	config.Notifications.setDefaults()
+	config.FlapDetection.setDefaults()
+	config.SlowBackends.setDefaults()
+	config.Shutdown.setDefaults()
+	if config.Environment == "" {
+		config.Environment = EnvironmentProduction
+	}
 	if config.Logging.Level == "" {
 		config.Logging.Level = "info"
 	}
@@ -81,6 +273,342 @@ func LoadConfig(path string) (*Config, error) {
 	return &config, nil
 }
 
+// Poll and heartbeat interval bounds enforced by Validate
+const (
+	minPollInterval      = 5 * time.Second
+	maxPollInterval      = time.Hour
+	minHeartbeatInterval = 10 * time.Second
+	maxHeartbeatInterval = time.Hour
+)
+
+var (
+	validLogLevels  = map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
+	validLogFormats = map[string]bool{"json": true, "text": true}
+)
+
+// Validate checks the configuration for errors that would otherwise only
+// surface at runtime. All problems found are returned together so they can be
+// fixed in one pass.
+func (c *Config) Validate() error {
+	var errs []error
+
+	switch c.Source.Mode {
+	case SourceModeAPI:
+		errs = append(errs, c.VPSie.validate()...)
+	case SourceModeFile:
+		if c.Source.Path == "" {
+			errs = append(errs, fmt.Errorf("source.path is required when source.mode is %q", SourceModeFile))
+		}
+	case SourceModeKubernetesIngress:
+		errs = append(errs, c.Source.Kubernetes.validate()...)
+	default:
+		errs = append(errs, fmt.Errorf("source.mode %q is invalid: must be %q, %q or %q",
+			c.Source.Mode, SourceModeAPI, SourceModeFile, SourceModeKubernetesIngress))
+	}
+
+	if c.VPSie.PollInterval < minPollInterval || c.VPSie.PollInterval > maxPollInterval {
+		errs = append(errs, fmt.Errorf("vpsie.poll_interval %s is out of range: must be between %s and %s",
+			c.VPSie.PollInterval, minPollInterval, maxPollInterval))
+	}
+
+	if c.Proxy.envoy() {
+		errs = append(errs, c.Envoy.validate()...)
+	}
+	errs = append(errs, c.Proxy.validate(c)...)
+	if c.Envoy.Isolate && !idPattern.MatchString(c.VPSie.LoadBalancerID) {
+		errs = append(errs, fmt.Errorf("envoy.isolate requires vpsie.loadbalancer_id of letters, digits, '-' or '_', got %q", c.VPSie.LoadBalancerID))
+	}
+
+	switch c.Environment {
+	case "", EnvironmentProduction, EnvironmentStaging:
+	default:
+		errs = append(errs, fmt.Errorf("environment %q is invalid: must be %q or %q", c.Environment, EnvironmentProduction, EnvironmentStaging))
+	}
+
+	if c.Admin.ListenAddress != "" {
+		if _, _, err := net.SplitHostPort(c.Admin.ListenAddress); err != nil {
+			errs = append(errs, fmt.Errorf("admin.listen_address %q must be host:port: %w", c.Admin.ListenAddress, err))
+		}
+	}
+	if c.Admin.TokenFile != "" {
+		if err := checkSecretFile(c.Admin.TokenFile); err != nil {
+			errs = append(errs, fmt.Errorf("admin.token_file: %w", err))
+		}
+	}
+
+	errs = append(errs, c.HA.validate()...)
+	errs = append(errs, c.HA.SessionSync.validate(c)...)
+	if c.HA.Enabled && c.HA.Mode == HAModeLease && c.Source.Mode != SourceModeAPI {
+		errs = append(errs, fmt.Errorf("ha.mode %q requires source.mode %q", HAModeLease, SourceModeAPI))
+	}
+	if c.HA.Enabled && c.HA.FloatingIP.Assign == FloatingIPAssignAPI && c.Source.Mode != SourceModeAPI {
+		errs = append(errs, fmt.Errorf("ha.floating_ip.assign %q requires source.mode %q", FloatingIPAssignAPI, SourceModeAPI))
+	}
+
+	errs = append(errs, c.Discovery.validate()...)
+	errs = append(errs, c.AccessLogService.validate()...)
+	errs = append(errs, c.WAF.validate()...)
+	errs = append(errs, c.WASM.validate()...)
+	errs = append(errs, c.Firewall.validate()...)
+	errs = append(errs, c.FastPath.validate(c)...)
+	errs = append(errs, c.HealthDNS.validate()...)
+	errs = append(errs, c.GSLB.validate()...)
+	if c.VPSie.NodeMetadata && c.Source.Mode != SourceModeAPI {
+		errs = append(errs, fmt.Errorf("vpsie.node_metadata requires source.mode %q", SourceModeAPI))
+	}
+	if c.GSLB.Enabled && c.Source.Mode != SourceModeAPI {
+		errs = append(errs, fmt.Errorf("gslb requires source.mode %q", SourceModeAPI))
+	}
+	errs = append(errs, c.Pause.validate()...)
+	errs = append(errs, c.State.validate()...)
+	errs = append(errs, c.CertWatch.validate()...)
+	errs = append(errs, c.SessionTickets.validate()...)
+	errs = append(errs, c.Probe.validate()...)
+	errs = append(errs, c.Notifications.validate()...)
+	errs = append(errs, c.FlapDetection.validate()...)
+	errs = append(errs, c.SlowBackends.validate()...)
+	errs = append(errs, c.Shutdown.validate()...)
+	errs = append(errs, c.Variables.validate()...)
+	if c.SlowBackends.Enabled && !c.AccessLogService.Enabled {
+		errs = append(errs, errors.New("slow_backends requires access_log_service.enabled"))
+	}
+	if c.SessionTickets.Enabled && c.SessionTickets.Sync && (!c.HA.Enabled || c.Source.Mode != SourceModeAPI) {
+		errs = append(errs, fmt.Errorf("session_tickets.sync requires ha.enabled and source.mode %q", SourceModeAPI))
+	}
+
+	for i := range c.TLSKeys {
+		key := &c.TLSKeys[i]
+		if !filepath.IsAbs(key.Path) {
+			errs = append(errs, fmt.Errorf("tls_keys[%d].path %q must be absolute", i, key.Path))
+		}
+		if err := key.Source.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("tls_keys[%d].source: %w", i, err))
+		}
+	}
+
+	if !validLogLevels[c.Logging.Level] {
+		errs = append(errs, fmt.Errorf("logging.level %q is invalid: must be debug, info, warn or error", c.Logging.Level))
+	}
+	if !validLogFormats[c.Logging.Format] {
+		errs = append(errs, fmt.Errorf("logging.format %q is invalid: must be json or text", c.Logging.Format))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate checks the VPSie API settings used in API source mode
+func (c *VPSieConfig) validate() []error {
+	var errs []error
+
+	parsedURL, err := url.Parse(c.APIURL)
+	switch {
+	case c.APIURL == "":
+		errs = append(errs, fmt.Errorf("vpsie.api_url is required"))
+	case err != nil:
+		errs = append(errs, fmt.Errorf("vpsie.api_url is not a valid URL: %w", err))
+	case parsedURL.Scheme != httpsScheme && parsedURL.Scheme != httpScheme:
+		errs = append(errs, fmt.Errorf("vpsie.api_url %q must use http:// or https://", c.APIURL))
+	case parsedURL.Hostname() == "":
+		errs = append(errs, fmt.Errorf("vpsie.api_url %q has no host", c.APIURL))
+	}
+
+	if c.HeartbeatInterval < minHeartbeatInterval || c.HeartbeatInterval > maxHeartbeatInterval {
+		errs = append(errs, fmt.Errorf("vpsie.heartbeat_interval %s is out of range: must be between %s and %s",
+			c.HeartbeatInterval, minHeartbeatInterval, maxHeartbeatInterval))
+	}
+
+	if c.LoadBalancerID == "" {
+		errs = append(errs, fmt.Errorf("vpsie.loadbalancer_id is required"))
+	} else if !idPattern.MatchString(c.LoadBalancerID) {
+		errs = append(errs, fmt.Errorf("vpsie.loadbalancer_id %q may only contain letters, digits, '-' and '_'", c.LoadBalancerID))
+	}
+
+	if c.APIKeySource != nil {
+		if err = c.APIKeySource.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("vpsie.api_key_source: %w", err))
+		}
+	} else if c.APIKeyFile == "" {
+		errs = append(errs, fmt.Errorf("vpsie.api_key_file or vpsie.api_key_source is required"))
+	} else if err = checkSecretFile(c.APIKeyFile); err != nil {
+		errs = append(errs, fmt.Errorf("vpsie.api_key_file: %w", err))
+	}
+
+	return errs
+}
+
+// systemdUnitPattern matches systemd unit names
+var systemdUnitPattern = regexp.MustCompile(`^[a-zA-Z0-9:_.@\-]+$`)
+
+// maxDrainTime bounds envoy.drain_time; listeners stay closed while draining
+const maxDrainTime = 10 * time.Minute
+
+// validate checks the Envoy settings
+func (e *EnvoySettings) validate() []error {
+	var errs []error
+
+	if e.ConfigPath == "" {
+		errs = append(errs, fmt.Errorf("envoy.config_path is required"))
+	} else if err := checkWritableDir(e.ConfigPath); err != nil {
+		errs = append(errs, fmt.Errorf("envoy.config_path: %w", err))
+	}
+
+	if e.OutputMode != OutputModeFiles && e.OutputMode != OutputModeXDSSnapshot {
+		errs = append(errs, fmt.Errorf("envoy.output_mode %q is invalid: must be %q or %q",
+			e.OutputMode, OutputModeFiles, OutputModeXDSSnapshot))
+	}
+	if e.LiveClusters && (e.OutputMode != OutputModeFiles || e.Remote.Host != "") {
+		errs = append(errs, fmt.Errorf("envoy.live_clusters requires envoy.output_mode %q and a local Envoy", OutputModeFiles))
+	}
+	if e.XDSEndpoints && e.OutputMode != OutputModeXDSSnapshot {
+		errs = append(errs, fmt.Errorf("envoy.xds_endpoints requires envoy.output_mode %q", OutputModeXDSSnapshot))
+	}
+
+	if !slices.Contains(envoy.Strategies, e.ReloadStrategy) {
+		errs = append(errs, fmt.Errorf("envoy.reload_strategy %q is invalid: must be one of %s",
+			e.ReloadStrategy, strings.Join(envoy.Strategies, ", ")))
+	}
+	if !systemdUnitPattern.MatchString(e.SystemdUnit) {
+		errs = append(errs, fmt.Errorf("envoy.systemd_unit %q is not a valid unit name", e.SystemdUnit))
+	}
+	if e.RestartWindow != "" {
+		if _, err := parseRestartWindow(e.RestartWindow); err != nil {
+			errs = append(errs, fmt.Errorf("envoy.restart_window %q: %w", e.RestartWindow, err))
+		}
+	}
+	if e.DrainTime < 0 || e.DrainTime > maxDrainTime {
+		errs = append(errs, fmt.Errorf("envoy.drain_time must be between 0 and %s, got %s", maxDrainTime, e.DrainTime))
+	}
+
+	// The Envoy binary is only executed when the agent starts Envoy itself
+	runsEnvoy := e.OutputMode == OutputModeFiles && (e.ReloadStrategy == envoy.StrategyHotRestart || e.ReloadStrategy == envoy.StrategyDrainRestart)
+	switch {
+	case e.Runtime != "" && !slices.Contains(envoy.Runtimes, e.Runtime):
+		errs = append(errs, fmt.Errorf("envoy.runtime %q is invalid: must be one of %s",
+			e.Runtime, strings.Join(envoy.Runtimes, ", ")))
+	case e.usesContainer() && !runsEnvoy:
+		errs = append(errs, fmt.Errorf("envoy.runtime %s requires envoy.output_mode %s and envoy.reload_strategy %s or %s",
+			e.Runtime, OutputModeFiles, envoy.StrategyHotRestart, envoy.StrategyDrainRestart))
+	case e.usesContainer():
+		errs = append(errs, e.Container.validate(e.Runtime)...)
+	case runsEnvoy:
+		if err := checkExecutable(e.BinaryPath); err != nil {
+			errs = append(errs, fmt.Errorf("envoy.binary_path: %w", err))
+		}
+	}
+
+	if _, port, err := net.SplitHostPort(e.AdminAddress); err != nil {
+		errs = append(errs, fmt.Errorf("envoy.admin_address %q must be host:port: %w", e.AdminAddress, err))
+	} else if port != fmt.Sprint(e.AdminPort) {
+		errs = append(errs, fmt.Errorf("envoy.admin_port %d does not match envoy.admin_address %q", e.AdminPort, e.AdminAddress))
+	}
+
+	if e.AdminPort <= 0 || e.AdminPort > 65535 {
+		errs = append(errs, fmt.Errorf("envoy.admin_port %d is out of range", e.AdminPort))
+	}
+	if e.MaxConnections <= 0 {
+		errs = append(errs, fmt.Errorf("envoy.max_connections must be positive, got %d", e.MaxConnections))
+	}
+	errs = append(errs, e.Overload.validate()...)
+	errs = append(errs, e.Verify.validate()...)
+	errs = append(errs, e.ReloadLimit.validate()...)
+	errs = append(errs, e.Remote.validate(e)...)
+
+	if e.Locality.Region != "" && !models.LocalityRegex.MatchString(e.Locality.Region) {
+		errs = append(errs, fmt.Errorf("envoy.locality.region %q is invalid: must be letters, digits, '.', '_' or '-'", e.Locality.Region))
+	}
+	if e.Locality.Zone != "" && !models.LocalityRegex.MatchString(e.Locality.Zone) {
+		errs = append(errs, fmt.Errorf("envoy.locality.zone %q is invalid: must be letters, digits, '.', '_' or '-'", e.Locality.Zone))
+	}
+	names := make([]string, 0, len(e.StatsTags))
+	for name := range e.StatsTags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := e.StatsTags[name]
+		if !models.StatsNameRegex.MatchString(name) || name == envoy.RouteStatsTag {
+			errs = append(errs, fmt.Errorf("envoy.stats_tags name %q is invalid: must start with a letter, contain only letters, digits or '_', and not be %q", name, envoy.RouteStatsTag))
+		}
+		if !models.LocalityRegex.MatchString(value) {
+			errs = append(errs, fmt.Errorf("envoy.stats_tags.%s value %q is invalid: must be letters, digits, '.', '_' or '-'", name, value))
+		}
+	}
+
+	return errs
+}
+
+// checkSecretFile verifies a secret file exists, is readable and is not accessible by other users
+func checkSecretFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("cannot access %s: %w", path, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	if info.Mode().Perm()&0007 != 0 {
+		return fmt.Errorf("%s is accessible by other users (mode %04o): run chmod 600 %s", path, info.Mode().Perm(), path)
+	}
+	// #nosec G304 -- path comes from the agent configuration file
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// checkExecutable verifies a file exists and has an executable bit set
+func checkExecutable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("cannot access %s: %w", path, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("%s is not executable", path)
+	}
+	return nil
+}
+
+// checkWritableDir verifies the agent can create files in dir. A missing
+// directory is accepted if its parent is writable, since it is created on
+// first write.
+func checkWritableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return checkWritableDir(filepath.Dir(dir))
+	}
+	if err != nil {
+		return fmt.Errorf("cannot access %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	f, err := os.CreateTemp(dir, ".vpsie-lb-write-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	name := f.Name()
+	_ = f.Close()
+	return os.Remove(name)
+}
+
+// ResolveAPIKey returns the API key from api_key_source if configured,
+// otherwise from api_key_file
+func (c *VPSieConfig) ResolveAPIKey(ctx context.Context) (string, error) {
+	if c.APIKeySource != nil {
+		apiKey, err := c.APIKeySource.Fetch(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch API key: %w", err)
+		}
+		return apiKey, nil
+	}
+	return c.LoadAPIKey()
+}
+
 // LoadAPIKey reads the API key from the configured file
 func (c *VPSieConfig) LoadAPIKey() (string, error) {
 	data, err := os.ReadFile(c.APIKeyFile)
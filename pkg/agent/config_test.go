@@ -3,8 +3,12 @@ package agent
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -64,6 +68,22 @@ envoy:
 				if c.VPSie.PollInterval != 30*time.Second {
 					t.Errorf("PollInterval = %v, want default 30s", c.VPSie.PollInterval)
 				}
+				if c.VPSie.HeartbeatInterval != time.Minute {
+					t.Errorf("HeartbeatInterval = %v, want default 1m", c.VPSie.HeartbeatInterval)
+				}
+				if c.Discovery.RefreshInterval != 30*time.Second || c.Discovery.Consul.Address != "http://127.0.0.1:8500" {
+					t.Errorf("Discovery = %+v, want default 30s refresh from http://127.0.0.1:8500", c.Discovery)
+				}
+				if als := c.AccessLogService; als.Enabled || als.ListenAddress != "127.0.0.1:9903" || als.SampleSize != 100 ||
+					als.TalkersWindow != 5*time.Minute || als.TopTalkers != 10 {
+					t.Errorf("AccessLogService = %+v, want disabled on 127.0.0.1:9903 with 100 samples and top 10 talkers over 5m", als)
+				}
+				if w := c.WAF; w.Enabled || w.ListenAddress != "127.0.0.1:9904" || w.BinaryPath != "/usr/bin/vpsie-lb-waf" {
+					t.Errorf("WAF = %+v, want disabled on 127.0.0.1:9904", w)
+				}
+				if w := c.WASM; w.ModuleDir != "/var/lib/vpsie-lb/wasm" || !reflect.DeepEqual(w.AllowedHosts, []string{"*.vpsie.com"}) {
+					t.Errorf("WASM = %+v, want modules from *.vpsie.com in /var/lib/vpsie-lb/wasm", w)
+				}
 				if c.Envoy.AdminAddress != "127.0.0.1:9901" {
 					t.Errorf("AdminAddress = %v, want default 127.0.0.1:9901", c.Envoy.AdminAddress)
 				}
@@ -76,6 +96,50 @@ envoy:
 				if c.Logging.Format != "json" {
 					t.Errorf("Logging Format = %v, want default json", c.Logging.Format)
 				}
+				if c.Source.Mode != SourceModeAPI {
+					t.Errorf("Source Mode = %v, want default %s", c.Source.Mode, SourceModeAPI)
+				}
+				if c.Envoy.ReloadStrategy != envoy.StrategyHotRestart || c.Envoy.SystemdUnit != "envoy.service" {
+					t.Errorf("reload strategy = %s on %s, want default hot-restart on envoy.service", c.Envoy.ReloadStrategy, c.Envoy.SystemdUnit)
+				}
+			},
+		},
+		{
+			name: "state directory",
+			configYAML: `
+vpsie:
+  loadbalancer_id: "lb-12345"
+state:
+  dir: /var/lib/vpsie-lb
+`,
+			validate: func(t *testing.T, c *Config) {
+				if c.Envoy.EpochFile != "/var/lib/vpsie-lb/envoy.epoch" {
+					t.Errorf("EpochFile = %v, want the state directory", c.Envoy.EpochFile)
+				}
+				if c.State.MaxQueuedEvents != 1000 {
+					t.Errorf("MaxQueuedEvents = %d, want default 1000", c.State.MaxQueuedEvents)
+				}
+			},
+		},
+		{
+			name: "isolated load balancer",
+			configYAML: `
+vpsie:
+  loadbalancer_id: "lb-12345"
+envoy:
+  config_path: /etc/envoy
+  isolate: true
+`,
+			validate: func(t *testing.T, c *Config) {
+				if c.Envoy.PidFile != "/var/run/envoy-lb-12345.pid" || c.Envoy.EpochFile != "/var/run/envoy-lb-12345.epoch" {
+					t.Errorf("PidFile = %v, EpochFile = %v, want files of lb-12345", c.Envoy.PidFile, c.Envoy.EpochFile)
+				}
+				if c.Envoy.StatsTags["loadbalancer_id"] != "lb-12345" {
+					t.Errorf("StatsTags = %v, want the load balancer ID", c.Envoy.StatsTags)
+				}
+				if dir := c.Envoy.dynamicDir(c.VPSie.LoadBalancerID); dir != "/etc/envoy/lb-12345/dynamic" {
+					t.Errorf("dynamicDir() = %v, want /etc/envoy/lb-12345/dynamic", dir)
+				}
 			},
 		},
 		{
@@ -200,3 +264,531 @@ func TestVPSieConfig_LoadAPIKey_FileNotFound(t *testing.T) {
 		t.Error("Expected error when loading non-existent API key file")
 	}
 }
+
+func TestConfig_Validate(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	keyFile := filepath.Join(tmpDir, "api-key")
+	if err := os.WriteFile(keyFile, []byte("secret"), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	openKeyFile := filepath.Join(tmpDir, "api-key-open")
+	if err := os.WriteFile(openKeyFile, []byte("secret"), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	if err := os.Chmod(openKeyFile, 0644); err != nil {
+		t.Fatalf("Failed to chmod key file: %v", err)
+	}
+	envoyBinary := filepath.Join(tmpDir, "envoy")
+	// #nosec G306 -- test binary must be executable
+	if err := os.WriteFile(envoyBinary, []byte("#!/bin/sh\n"), 0700); err != nil {
+		t.Fatalf("Failed to write envoy binary: %v", err)
+	}
+
+	validConfig := func() *Config {
+		return &Config{
+			VPSie: VPSieConfig{
+				APIURL:            "https://api.vpsie.com/v1",
+				APIKeyFile:        keyFile,
+				LoadBalancerID:    "lb-12345",
+				PollInterval:      30 * time.Second,
+				HeartbeatInterval: time.Minute,
+			},
+			Envoy: EnvoySettings{
+				ConfigPath:     filepath.Join(tmpDir, "dynamic"),
+				AdminAddress:   "127.0.0.1:9901",
+				BinaryPath:     envoyBinary,
+				OutputMode:     OutputModeFiles,
+				ReloadStrategy: envoy.StrategyHotRestart,
+				SystemdUnit:    "envoy.service",
+				DrainTime:      15 * time.Second,
+				AdminPort:      9901,
+				MaxConnections: 50000,
+			},
+			Source:    SourceConfig{Mode: SourceModeAPI},
+			Logging:   LoggingConfig{Level: "info", Format: "json"},
+			Discovery: DiscoveryConfig{RefreshInterval: 30 * time.Second, Consul: ConsulDiscoveryConfig{Address: defaultConsulAddress}},
+		}
+	}
+
+	tests := []struct {
+		modify  func(*Config)
+		name    string
+		wantErr string
+	}{
+		{
+			name:   "valid config",
+			modify: func(c *Config) {},
+		},
+		{
+			name:    "invalid URL scheme",
+			modify:  func(c *Config) { c.VPSie.APIURL = "ftp://api.vpsie.com" },
+			wantErr: "must use http:// or https://",
+		},
+		{
+			name:   "plain HTTP API URL for local development",
+			modify: func(c *Config) { c.VPSie.APIURL = "http://api.vpsie.com" },
+		},
+		{
+			name:    "missing load balancer ID",
+			modify:  func(c *Config) { c.VPSie.LoadBalancerID = "" },
+			wantErr: "vpsie.loadbalancer_id is required",
+		},
+		{
+			name: "isolation without a usable load balancer ID",
+			modify: func(c *Config) {
+				c.Envoy.Isolate = true
+				c.VPSie.LoadBalancerID = "../lb-1"
+			},
+			wantErr: "envoy.isolate requires vpsie.loadbalancer_id",
+		},
+		{
+			name:    "missing key file",
+			modify:  func(c *Config) { c.VPSie.APIKeyFile = filepath.Join(tmpDir, "missing") },
+			wantErr: "vpsie.api_key_file",
+		},
+		{
+			name:    "world-readable key file",
+			modify:  func(c *Config) { c.VPSie.APIKeyFile = openKeyFile },
+			wantErr: "chmod 600",
+		},
+		{
+			name:    "missing envoy binary",
+			modify:  func(c *Config) { c.Envoy.BinaryPath = filepath.Join(tmpDir, "no-envoy") },
+			wantErr: "envoy.binary_path",
+		},
+		{
+			name:    "envoy binary not executable",
+			modify:  func(c *Config) { c.Envoy.BinaryPath = keyFile },
+			wantErr: "not executable",
+		},
+		{
+			name:    "config path is a file",
+			modify:  func(c *Config) { c.Envoy.ConfigPath = keyFile },
+			wantErr: "envoy.config_path",
+		},
+		{
+			name:    "poll interval too short",
+			modify:  func(c *Config) { c.VPSie.PollInterval = time.Second },
+			wantErr: "vpsie.poll_interval",
+		},
+		{
+			name:    "poll interval too long",
+			modify:  func(c *Config) { c.VPSie.PollInterval = 2 * time.Hour },
+			wantErr: "vpsie.poll_interval",
+		},
+		{
+			name:    "heartbeat interval too short",
+			modify:  func(c *Config) { c.VPSie.HeartbeatInterval = time.Second },
+			wantErr: "vpsie.heartbeat_interval",
+		},
+		{
+			name:    "discovery refresh interval too short",
+			modify:  func(c *Config) { c.Discovery.RefreshInterval = time.Second },
+			wantErr: "discovery.refresh_interval",
+		},
+		{
+			name:    "invalid consul address",
+			modify:  func(c *Config) { c.Discovery.Consul.Address = "consul:8500" },
+			wantErr: "discovery.consul.address",
+		},
+		{
+			name: "invalid access log service address",
+			modify: func(c *Config) {
+				c.AccessLogService = AccessLogServiceConfig{Enabled: true, ListenAddress: "9903", SampleSize: 100}
+			},
+			wantErr: "access_log_service.listen_address",
+		},
+		{
+			name: "access log forward interval too short",
+			modify: func(c *Config) {
+				c.AccessLogService = validAccessLogService()
+				c.AccessLogService.ForwardInterval = time.Second
+			},
+			wantErr: "access_log_service.forward_interval",
+		},
+		{
+			name: "access log sample size too large",
+			modify: func(c *Config) {
+				c.AccessLogService = validAccessLogService()
+				c.AccessLogService.SampleSize = 100000
+			},
+			wantErr: "access_log_service.sample_size",
+		},
+		{
+			name: "talkers window too long",
+			modify: func(c *Config) {
+				c.AccessLogService = validAccessLogService()
+				c.AccessLogService.TalkersWindow = 2 * time.Hour
+			},
+			wantErr: "access_log_service.talkers_window",
+		},
+		{
+			name: "relative waf rule set path",
+			modify: func(c *Config) {
+				c.WAF = WAFConfig{Enabled: true}
+				c.WAF.setDefaults()
+				c.WAF.CRSPath = "coreruleset"
+			},
+			wantErr: "waf.crs_path",
+		},
+		{
+			name: "wildcard in the middle of a wasm host",
+			modify: func(c *Config) {
+				c.WASM = WASMConfig{ModuleDir: "/var/lib/vpsie-lb/wasm", AllowedHosts: []string{"objects.*.vpsie.com"}}
+			},
+			wantErr: "wasm.allowed_hosts[0]",
+		},
+		{
+			name:    "unknown firewall backend",
+			modify:  func(c *Config) { c.Firewall.Backend = "pf" },
+			wantErr: "firewall.backend",
+		},
+		{
+			name: "health dns name not fully qualified",
+			modify: func(c *Config) {
+				c.HealthDNS = HealthDNSConfig{Enabled: true, Name: "loadbalancer"}
+				c.HealthDNS.setDefaults()
+			},
+			wantErr: "health_dns.name",
+		},
+		{
+			name: "health dns address is not an IP",
+			modify: func(c *Config) {
+				c.HealthDNS = HealthDNSConfig{Enabled: true, Name: "lb.eu-west.example.com", Addresses: []string{"lb.example.com"}}
+				c.HealthDNS.setDefaults()
+			},
+			wantErr: "health_dns.addresses[0]",
+		},
+		{
+			name: "gslb without a region",
+			modify: func(c *Config) {
+				c.GSLB = GSLBConfig{Enabled: true, Group: "shop", Interval: 15 * time.Second, Rise: 3, Fall: 2}
+			},
+			wantErr: "gslb.region is required",
+		},
+		{
+			name: "gslb in file mode",
+			modify: func(c *Config) {
+				c.Source = SourceConfig{Mode: SourceModeFile, Path: "/etc/vpsie-lb"}
+				c.GSLB = GSLBConfig{Enabled: true, Group: "shop"}
+				c.GSLB.setDefaults("eu-west")
+			},
+			wantErr: "gslb requires source.mode",
+		},
+		{
+			name: "pause reason too long",
+			modify: func(c *Config) {
+				c.Pause = PauseConfig{Enabled: true, Reason: strings.Repeat("x", maxPauseReasonLength+1)}
+			},
+			wantErr: "pause.reason",
+		},
+		{
+			name:    "relative state directory",
+			modify:  func(c *Config) { c.State = StateConfig{Dir: "state", MaxQueuedEvents: 1000} },
+			wantErr: "state.dir",
+		},
+		{
+			name: "cert watch debounce too short",
+			modify: func(c *Config) {
+				c.CertWatch = CertWatchConfig{Enabled: true, Dir: "/etc/vpsie-lb/certs", Debounce: time.Millisecond}
+			},
+			wantErr: "cert_watch.debounce",
+		},
+		{
+			name: "probe timeout longer than interval",
+			modify: func(c *Config) {
+				c.Probe = ProbeConfig{Enabled: true, Timeout: time.Minute}
+				c.Probe.setDefaults()
+			},
+			wantErr: "probe.timeout",
+		},
+		{
+			name:    "verify timeout too long",
+			modify:  func(c *Config) { c.Envoy.Verify = VerifySettings{Enabled: true, Timeout: time.Hour} },
+			wantErr: "envoy.verify.timeout",
+		},
+		{
+			name:    "admin token file accessible by other users",
+			modify:  func(c *Config) { c.Admin.TokenFile = openKeyFile },
+			wantErr: "admin.token_file",
+		},
+		{
+			name: "session ticket rotation too short",
+			modify: func(c *Config) {
+				c.SessionTickets = SessionTicketConfig{Enabled: true, Dir: "/var/lib/vpsie-lb/session-tickets", Rotation: time.Minute, Keys: 3}
+			},
+			wantErr: "session_tickets.rotation",
+		},
+		{
+			name: "session ticket sync without HA",
+			modify: func(c *Config) {
+				c.SessionTickets = SessionTicketConfig{Enabled: true, Sync: true}
+				c.SessionTickets.setDefaults()
+			},
+			wantErr: "session_tickets.sync requires ha.enabled",
+		},
+		{
+			name:    "invalid locality zone",
+			modify:  func(c *Config) { c.Envoy.Locality = LocalitySettings{Region: "eu-west", Zone: "eu west 1a"} },
+			wantErr: "envoy.locality.zone",
+		},
+		{
+			name:    "reserved stats tag name",
+			modify:  func(c *Config) { c.Envoy.StatsTags = map[string]string{"route": "checkout"} },
+			wantErr: "envoy.stats_tags name",
+		},
+		{
+			name:    "invalid stats tag value",
+			modify:  func(c *Config) { c.Envoy.StatsTags = map[string]string{"region": "eu west"} },
+			wantErr: "envoy.stats_tags.region",
+		},
+		{
+			name:    "unparseable admin address",
+			modify:  func(c *Config) { c.Envoy.AdminAddress = "localhost" },
+			wantErr: "envoy.admin_address",
+		},
+		{
+			name:    "admin port mismatch",
+			modify:  func(c *Config) { c.Envoy.AdminPort = 9902 },
+			wantErr: "does not match",
+		},
+		{
+			name: "overload protection",
+			modify: func(c *Config) {
+				c.Envoy.Overload = OverloadSettings{MaxHeapBytes: 1 << 30}
+				c.Envoy.Overload.setDefaults()
+			},
+		},
+		{
+			name:    "overload heap too small",
+			modify:  func(c *Config) { c.Envoy.Overload = OverloadSettings{MaxHeapBytes: 1 << 20} },
+			wantErr: "envoy.overload.max_heap_bytes",
+		},
+		{
+			name:    "overload threshold out of range",
+			modify:  func(c *Config) { c.Envoy.Overload = OverloadSettings{MaxHeapBytes: 1 << 30, ShrinkHeapPercent: 120} },
+			wantErr: "envoy.overload.shrink_heap_percent",
+		},
+		{
+			name: "systemd strategy does not need envoy binary",
+			modify: func(c *Config) {
+				c.Envoy.ReloadStrategy = envoy.StrategySystemd
+				c.Envoy.BinaryPath = filepath.Join(tmpDir, "no-envoy")
+			},
+		},
+		{
+			name: "live clusters in snapshot mode",
+			modify: func(c *Config) {
+				c.Envoy.OutputMode = OutputModeXDSSnapshot
+				c.Envoy.LiveClusters = true
+			},
+			wantErr: "envoy.live_clusters requires envoy.output_mode",
+		},
+		{
+			name:    "xds endpoints without snapshot mode",
+			modify:  func(c *Config) { c.Envoy.XDSEndpoints = true },
+			wantErr: "envoy.xds_endpoints requires envoy.output_mode",
+		},
+		{
+			name:    "unknown reload strategy",
+			modify:  func(c *Config) { c.Envoy.ReloadStrategy = "restart" },
+			wantErr: "envoy.reload_strategy",
+		},
+		{
+			name:    "invalid systemd unit",
+			modify:  func(c *Config) { c.Envoy.SystemdUnit = "envoy; reboot" },
+			wantErr: "envoy.systemd_unit",
+		},
+		{
+			name:    "drain time too long",
+			modify:  func(c *Config) { c.Envoy.DrainTime = time.Hour },
+			wantErr: "envoy.drain_time",
+		},
+		{
+			name:    "invalid log level",
+			modify:  func(c *Config) { c.Logging.Level = "verbose" },
+			wantErr: "logging.level",
+		},
+		{
+			name: "file mode does not need API settings",
+			modify: func(c *Config) {
+				c.Source = SourceConfig{Mode: SourceModeFile, Path: tmpDir}
+				c.VPSie.APIURL = ""
+				c.VPSie.APIKeyFile = ""
+			},
+		},
+		{
+			name:    "file mode requires path",
+			modify:  func(c *Config) { c.Source = SourceConfig{Mode: SourceModeFile} },
+			wantErr: "source.path is required",
+		},
+		{
+			name: "kubernetes ingress mode does not need API settings",
+			modify: func(c *Config) {
+				c.Source = SourceConfig{Mode: SourceModeKubernetesIngress}
+				c.Source.Kubernetes.setDefaults()
+				c.VPSie.APIURL = ""
+				c.VPSie.APIKeyFile = ""
+			},
+		},
+		{
+			name: "kubernetes ingress mode rejects unknown backend target",
+			modify: func(c *Config) {
+				c.Source = SourceConfig{Mode: SourceModeKubernetesIngress}
+				c.Source.Kubernetes.setDefaults()
+				c.Source.Kubernetes.BackendTarget = "cluster_ip"
+			},
+			wantErr: "source.kubernetes.backend_target",
+		},
+		{
+			name: "kubernetes token file requires server",
+			modify: func(c *Config) {
+				c.Source = SourceConfig{Mode: SourceModeKubernetesIngress}
+				c.Source.Kubernetes.setDefaults()
+				c.Source.Kubernetes.TokenFile = keyFile
+			},
+			wantErr: "require source.kubernetes.server",
+		},
+		{
+			name:    "unknown environment",
+			modify:  func(c *Config) { c.Environment = "qa" },
+			wantErr: "environment \"qa\" is invalid",
+		},
+		{
+			name: "slow backends without access log service",
+			modify: func(c *Config) {
+				c.SlowBackends = SlowBackendConfig{Enabled: true}
+				c.SlowBackends.setDefaults()
+			},
+			wantErr: "slow_backends requires access_log_service.enabled",
+		},
+		{
+			name:    "flap threshold too low",
+			modify:  func(c *Config) { c.FlapDetection.Threshold = 1 },
+			wantErr: "flap_detection.threshold 1 must be between 2",
+		},
+		{
+			name: "snapshot mode does not need envoy binary",
+			modify: func(c *Config) {
+				c.Envoy.OutputMode = OutputModeXDSSnapshot
+				c.Envoy.BinaryPath = filepath.Join(tmpDir, "no-envoy")
+			},
+		},
+		{
+			name: "remote envoy",
+			modify: func(c *Config) {
+				c.Envoy.ReloadStrategy = envoy.StrategySystemd
+				c.Envoy.BinaryPath = "/usr/bin/envoy"
+				c.Envoy.Remote = RemoteSettings{Host: "10.0.0.5", User: "vpsie-lb", IdentityFile: keyFile, KnownHostsFile: keyFile}
+			},
+		},
+		{
+			name: "remote envoy needs the systemd strategy",
+			modify: func(c *Config) {
+				c.Envoy.Remote = RemoteSettings{Host: "10.0.0.5", IdentityFile: keyFile, KnownHostsFile: keyFile}
+			},
+			wantErr: "envoy.remote requires envoy.output_mode files and envoy.reload_strategy systemd",
+		},
+		{
+			name: "remote envoy needs known hosts",
+			modify: func(c *Config) {
+				c.Envoy.ReloadStrategy = envoy.StrategySystemd
+				c.Envoy.Remote = RemoteSettings{Host: "10.0.0.5", IdentityFile: keyFile}
+			},
+			wantErr: "envoy.remote.known_hosts_file is required",
+		},
+		{
+			name: "haproxy driver",
+			modify: func(c *Config) {
+				c.Proxy = ProxyConfig{Driver: ProxyDriverHAProxy, ConfigPath: filepath.Join(tmpDir, "haproxy.cfg"), BinaryPath: envoyBinary, SystemdUnit: "haproxy.service"}
+				c.Envoy.BinaryPath = filepath.Join(tmpDir, "no-envoy")
+			},
+		},
+		{
+			name: "ipvs driver with an unknown method",
+			modify: func(c *Config) {
+				c.Proxy = ProxyConfig{Driver: ProxyDriverIPVS, ConfigPath: filepath.Join(tmpDir, "ipvs.json"), BinaryPath: envoyBinary, Method: "fullnat"}
+			},
+			wantErr: "proxy.method \"fullnat\" must be",
+		},
+		{
+			name: "nginx driver with an envoy-only feature",
+			modify: func(c *Config) {
+				c.Proxy = ProxyConfig{Driver: ProxyDriverNginx, ConfigPath: filepath.Join(tmpDir, "nginx.conf"), BinaryPath: envoyBinary, SystemdUnit: "nginx.service"}
+				c.CertWatch = CertWatchConfig{Enabled: true, Dir: tmpDir, Debounce: defaultCertWatchDebounce}
+			},
+			wantErr: "cert_watch requires proxy.driver envoy",
+		},
+		{
+			name: "session sync without ipvs",
+			modify: func(c *Config) {
+				c.HA.Enabled = true
+				c.HA.SessionSync = SessionSyncConfig{Enabled: true, Interface: "eth0", SyncID: 1}
+			},
+			wantErr: "ha.session_sync requires fast_path or proxy.driver ipvs",
+		},
+		{
+			name: "fast path with an unknown method",
+			modify: func(c *Config) {
+				c.FastPath = FastPathConfig{Enabled: true, Method: "maglev"}
+			},
+			wantErr: "fast_path.method \"maglev\" must be",
+		},
+		{
+			name: "unknown envoy runtime",
+			modify: func(c *Config) {
+				c.Envoy.Runtime = "lxc"
+			},
+			wantErr: "envoy.runtime \"lxc\" is invalid",
+		},
+		{
+			name: "container runtime needs a pinned image",
+			modify: func(c *Config) {
+				c.Envoy.Runtime = envoy.RuntimePodman
+				c.Envoy.Container = ContainerSettings{Image: "envoyproxy/envoy:latest", Name: defaultContainerName}
+			},
+			wantErr: "must be pinned",
+		},
+		{
+			name: "container runtime needs the agent to run envoy",
+			modify: func(c *Config) {
+				c.Envoy.Runtime = envoy.RuntimeDocker
+				c.Envoy.ReloadStrategy = envoy.StrategySystemd
+			},
+			wantErr: "envoy.runtime docker requires",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_ReportsAllErrors(t *testing.T) {
+	cfg := &Config{Source: SourceConfig{Mode: SourceModeAPI}}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors for empty config")
+	}
+	for _, want := range []string{"vpsie.api_url", "vpsie.loadbalancer_id", "envoy.config_path", "logging.level"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error missing %q: %v", want, err)
+		}
+	}
+}
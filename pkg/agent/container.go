@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+)
+
+// ContainerSettings configures Envoy containers when envoy.runtime is docker
+// or podman, for hosts where Envoy cannot be installed such as immutable
+// operating systems
+type ContainerSettings struct {
+	Image     string   `yaml:"image"`      // pinned Envoy image, e.g. envoyproxy/envoy:v1.31.2
+	Name      string   `yaml:"name"`       // prefix of container names, default vpsie-envoy
+	Mounts    []string `yaml:"mounts"`     // extra host directories Envoy reads, such as certificates
+	LogDriver string   `yaml:"log_driver"` // engine log driver, e.g. journald; empty uses the engine's default
+}
+
+// defaultContainerName prefixes the names of Envoy containers
+const defaultContainerName = "vpsie-envoy"
+
+// containerNamePattern matches names accepted by Docker and Podman
+var containerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,62}$`)
+
+// setDefaults fills in unset container settings
+func (c *ContainerSettings) setDefaults() {
+	if c.Name == "" {
+		c.Name = defaultContainerName
+	}
+}
+
+// validate checks the container settings of container runtime engine
+func (c *ContainerSettings) validate(engine string) []error {
+	var errs []error
+	if _, err := exec.LookPath(engine); err != nil {
+		errs = append(errs, fmt.Errorf("envoy.runtime %s: %w", engine, err))
+	}
+	if c.Image == "" {
+		errs = append(errs, fmt.Errorf("envoy.container.image is required with envoy.runtime %s", engine))
+	} else if !envoy.Pinned(c.Image) {
+		errs = append(errs, fmt.Errorf("envoy.container.image %q must be pinned to a tag other than latest or to a digest", c.Image))
+	}
+	if !containerNamePattern.MatchString(c.Name) {
+		errs = append(errs, fmt.Errorf("envoy.container.name %q is invalid: must be letters, digits, '_', '.' or '-'", c.Name))
+	}
+	for _, dir := range c.Mounts {
+		if !filepath.IsAbs(dir) || filepath.Clean(dir) != dir {
+			errs = append(errs, fmt.Errorf("envoy.container.mounts %q must be a clean absolute path", dir))
+		}
+	}
+	return errs
+}
+
+// usesContainer reports whether the agent runs Envoy in a container
+func (e *EnvoySettings) usesContainer() bool {
+	return e.Runtime == envoy.RuntimeDocker || e.Runtime == envoy.RuntimePodman
+}
+
+// envoyRuntime returns the runtime running Envoy: on a remote host, in a
+// container or on this host. Containers see the Envoy configuration and every
+// other directory the agent writes for Envoy at the same path as the host,
+// next to the mounts of envoy.container.
+func envoyRuntime(cfg *Config) envoy.Runtime {
+	if r := cfg.Envoy.Remote; r.enabled() {
+		return envoy.NewRemote(r.Host, r.Port, r.User, r.IdentityFile, r.KnownHostsFile, cfg.Envoy.BinaryPath)
+	}
+	if !cfg.Envoy.usesContainer() {
+		return envoy.Binary(cfg.Envoy.BinaryPath)
+	}
+	mounts := []string{cfg.Envoy.ConfigPath}
+	if cfg.WASM.ModuleDir != "" {
+		mounts = append(mounts, cfg.WASM.ModuleDir)
+	}
+	if cfg.SessionTickets.Enabled {
+		mounts = append(mounts, cfg.SessionTickets.Dir)
+	}
+	if cfg.CertWatch.Enabled {
+		mounts = append(mounts, cfg.CertWatch.Dir)
+	}
+	for _, dir := range cfg.Envoy.Container.Mounts {
+		if !slices.Contains(mounts, dir) {
+			mounts = append(mounts, dir)
+		}
+	}
+	c := cfg.Envoy.Container
+	return envoy.NewContainer(cfg.Envoy.Runtime, c.Image, c.Name, c.LogDriver, mounts)
+}
+
+// pullEnvoyImage pulls the Envoy image before Envoy is first started, so the
+// first start does not wait for the download. A failed pull is retried by
+// the engine when Envoy starts.
+func (a *Agent) pullEnvoyImage(ctx context.Context) {
+	container, ok := a.envoyRuntime.(*envoy.Container)
+	if !ok {
+		return
+	}
+	if err := container.Pull(ctx); err != nil {
+		log.Printf("Warning: Failed to pull the Envoy image: %v", err)
+		return
+	}
+	log.Printf("Envoy runs in %s", container)
+}
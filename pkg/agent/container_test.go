@@ -0,0 +1,32 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+)
+
+func TestEnvoyRuntime(t *testing.T) {
+	cfg := &Config{Envoy: EnvoySettings{ConfigPath: "/etc/envoy", BinaryPath: "/usr/bin/envoy", Runtime: envoy.RuntimeBinary}}
+	if got := envoyRuntime(cfg); got != envoy.Binary("/usr/bin/envoy") {
+		t.Errorf("envoyRuntime() = %v, want the host binary", got)
+	}
+
+	// Containers see every directory the agent writes for Envoy, once
+	cfg.Envoy.Runtime = envoy.RuntimeDocker
+	cfg.Envoy.Container = ContainerSettings{
+		Image:  "envoyproxy/envoy:v1.31.2",
+		Name:   defaultContainerName,
+		Mounts: []string{"/etc/letsencrypt", "/etc/envoy"},
+	}
+	cfg.SessionTickets = SessionTicketConfig{Enabled: true, Dir: "/var/lib/vpsie-lb/session-tickets"}
+	container, ok := envoyRuntime(cfg).(*envoy.Container)
+	if !ok {
+		t.Fatalf("envoyRuntime() = %v, want a container", envoyRuntime(cfg))
+	}
+	wantMounts := []string{"/etc/envoy", "/var/lib/vpsie-lb/session-tickets", "/etc/letsencrypt"}
+	if container.Engine != envoy.RuntimeDocker || container.Image != "envoyproxy/envoy:v1.31.2" || !reflect.DeepEqual(container.Mounts, wantMounts) {
+		t.Errorf("envoyRuntime() = %+v, want docker running the image with mounts %v", container, wantMounts)
+	}
+}
@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+)
+
+// maxEventDiffSize limits the diff sent with the config_diff event
+const maxEventDiffSize = 64 * 1024
+
+// configDiff is the change to the Envoy configuration files computed before
+// the last apply
+type configDiff struct {
+	ConfigHash string
+	ComputedAt time.Time
+	Diff       string // unified diff, empty when the generated files are unchanged
+}
+
+// recordDiff computes the change envoyConfig makes to the listeners and
+// clusters on disk, logs it and reports it with a config_diff event
+func (a *Agent) recordDiff(ctx context.Context, configHash string, envoyConfig *envoy.EnvoyConfig) {
+	diff, err := a.envoyManager.Diff(envoyConfig)
+	if err != nil {
+		log.Printf("Warning: Failed to diff Envoy configuration: %v", err)
+		return
+	}
+	a.lastDiff.Store(&configDiff{ConfigHash: configHash, ComputedAt: time.Now(), Diff: diff})
+
+	if diff == "" {
+		log.Println("Generated Envoy configuration is unchanged")
+		return
+	}
+	log.Printf("Envoy configuration changes (hash: %s):\n%s", configHash, diff)
+	a.sendEvent(ctx, NewEvent(EventConfigDiff, "Envoy configuration changes", map[string]interface{}{
+		"config_hash": configHash,
+		"diff":        truncateErrorMessage(diff, maxEventDiffSize),
+	}))
+}
+
+// handleConfigDiff serves the unified diff computed before the last apply.
+// The X-Config-Hash header names the configuration it led to.
+func (a *Agent) handleConfigDiff(w http.ResponseWriter, _ *http.Request) {
+	diff := a.lastDiff.Load()
+	if diff == nil {
+		http.Error(w, "no configuration has been applied yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	w.Header().Set("X-Config-Hash", diff.ConfigHash)
+	w.Header().Set("Last-Modified", diff.ComputedAt.UTC().Format(http.TimeFormat))
+	_, _ = w.Write([]byte(diff.Diff))
+}
@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+)
+
+func TestAgent_RecordDiff(t *testing.T) {
+	manager, err := envoy.NewConfigManager(filepath.Join(t.TempDir(), "dynamic"), nil)
+	if err != nil {
+		t.Fatalf("NewConfigManager() error = %v", err)
+	}
+	reporter := &recordingReporter{}
+	a := &Agent{config: &Config{Admin: AdminConfig{TokenFile: writeAdminTestToken(t)}}, events: reporter, envoyManager: manager}
+	handler := a.adminHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, authorizedRequest(http.MethodGet, "/config/diff"))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status before any apply = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	if err = manager.ApplyConfig(&envoy.EnvoyConfig{Listeners: []byte("- name: old\n"), Clusters: []byte("- name: c\n")}); err != nil {
+		t.Fatal(err)
+	}
+	a.recordDiff(context.Background(), "hash-1", &envoy.EnvoyConfig{Listeners: []byte("- name: new\n"), Clusters: []byte("- name: c\n")})
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, authorizedRequest(http.MethodGet, "/config/diff"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("X-Config-Hash"); got != "hash-1" {
+		t.Errorf("X-Config-Hash = %q, want hash-1", got)
+	}
+	want := "--- a/listeners.yaml\n+++ b/listeners.yaml\n@@ -1 +1 @@\n-- name: old\n+- name: new\n"
+	if rec.Body.String() != want {
+		t.Errorf("diff =\n%s\nwant\n%s", rec.Body.String(), want)
+	}
+	if strings.Join(reporter.events, ",") != "config_diff" {
+		t.Errorf("events = %v, want config_diff", reporter.events)
+	}
+
+	// An unchanged configuration has an empty diff and no event
+	a.recordDiff(context.Background(), "hash-2", &envoy.EnvoyConfig{Listeners: []byte("- name: old\n"), Clusters: []byte("- name: c\n")})
+	if diff := a.lastDiff.Load(); diff.ConfigHash != "hash-2" || diff.Diff != "" {
+		t.Errorf("last diff = %+v, want an empty diff for hash-2", diff)
+	}
+	if len(reporter.events) != 1 {
+		t.Errorf("events = %v, want no event for an unchanged configuration", reporter.events)
+	}
+}
@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/discovery"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// DiscoveryConfig configures backend discovery for load balancers that use it
+type DiscoveryConfig struct {
+	RefreshInterval time.Duration         `yaml:"refresh_interval"` // how often discovery queries are repeated
+	Consul          ConsulDiscoveryConfig `yaml:"consul"`
+}
+
+// ConsulDiscoveryConfig locates the Consul agent queried for services
+type ConsulDiscoveryConfig struct {
+	Address   string `yaml:"address"`    // default http://127.0.0.1:8500
+	TokenFile string `yaml:"token_file"` // ACL token, empty for none
+}
+
+// Default discovery settings applied by LoadConfig
+const (
+	defaultDiscoveryRefreshInterval = 30 * time.Second
+	defaultConsulAddress            = "http://127.0.0.1:8500"
+)
+
+// Discovery refresh interval bounds enforced by Validate
+const (
+	minDiscoveryRefreshInterval = 5 * time.Second
+	maxDiscoveryRefreshInterval = time.Hour
+)
+
+// setDefaults fills in unset discovery settings
+func (d *DiscoveryConfig) setDefaults() {
+	if d.RefreshInterval == 0 {
+		d.RefreshInterval = defaultDiscoveryRefreshInterval
+	}
+	if d.Consul.Address == "" {
+		d.Consul.Address = defaultConsulAddress
+	}
+}
+
+// validate checks the discovery settings
+func (d *DiscoveryConfig) validate() []error {
+	var errs []error
+	if d.RefreshInterval < minDiscoveryRefreshInterval || d.RefreshInterval > maxDiscoveryRefreshInterval {
+		errs = append(errs, fmt.Errorf("discovery.refresh_interval %s is out of range: must be between %s and %s",
+			d.RefreshInterval, minDiscoveryRefreshInterval, maxDiscoveryRefreshInterval))
+	}
+	if _, err := discovery.NewConsulProvider(d.Consul.Address, ""); err != nil {
+		errs = append(errs, fmt.Errorf("discovery.consul.address: %w", err))
+	}
+	if d.Consul.TokenFile != "" {
+		if err := checkSecretFile(d.Consul.TokenFile); err != nil {
+			errs = append(errs, fmt.Errorf("discovery.consul.token_file: %w", err))
+		}
+	}
+	return errs
+}
+
+// Server is a VPSie server as returned by the server list
+type Server struct {
+	ID        string `json:"id"`
+	Hostname  string `json:"hostname"`
+	PrivateIP string `json:"private_ip,omitempty"`
+	PublicIP  string `json:"public_ip,omitempty"`
+	Status    string `json:"status"` // running, stopped, ...
+}
+
+// ListServersByTag lists the account's servers carrying tag
+func (c *VPSieClient) ListServersByTag(ctx context.Context, tag string) ([]Server, error) {
+	reqURL := fmt.Sprintf("%s/servers?tag=%s", c.baseURL, url.QueryEscape(tag))
+	var servers []Server
+	if err := c.doJSON(ctx, http.MethodGet, reqURL, nil, &servers); err != nil {
+		return nil, err
+	}
+	return servers, nil
+}
+
+// serverLister is implemented by sources that can list VPSie servers
+type serverLister interface {
+	ListServersByTag(ctx context.Context, tag string) ([]Server, error)
+}
+
+// tagProvider discovers the running VPSie servers carrying a tag. Servers are
+// reached on their private address when they have one.
+func tagProvider(servers serverLister) discovery.Provider {
+	return discovery.ProviderFunc(func(ctx context.Context, query *models.Discovery) ([]models.Backend, error) {
+		list, err := servers.ListServersByTag(ctx, query.Tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list servers tagged %s: %w", query.Tag, err)
+		}
+		backends := make([]models.Backend, 0, len(list))
+		for _, server := range list {
+			if server.Status != "running" {
+				continue
+			}
+			address := server.PrivateIP
+			if address == "" {
+				address = server.PublicIP
+			}
+			backends = append(backends, models.Backend{
+				ID:      "vpsie-" + server.ID,
+				Address: address,
+				Port:    query.Port,
+				Enabled: true,
+			})
+		}
+		return backends, nil
+	})
+}
+
+// newResolver creates the discovery resolver. VPSie tag queries need the
+// VPSie API, so they are only answered in API source mode.
+func newResolver(cfg *DiscoveryConfig, source ConfigSource) (*discovery.Resolver, error) {
+	var token string
+	if cfg.Consul.TokenFile != "" {
+		// #nosec G304 -- path comes from the agent configuration file
+		data, err := os.ReadFile(cfg.Consul.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Consul token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	consul, err := discovery.NewConsulProvider(cfg.Consul.Address, token)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := map[models.DiscoveryType]discovery.Provider{models.DiscoveryConsul: consul}
+	if servers, ok := source.(serverLister); ok {
+		providers[models.DiscoveryVPSieTag] = tagProvider(servers)
+	}
+	return discovery.NewResolver(providers), nil
+}
+
+// runDiscovery re-syncs at the discovery refresh interval while the applied
+// configuration discovers backends, so membership changes are picked up
+// sooner than the poll interval
+func (a *Agent) runDiscovery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if discovery.Uses(a.lastApplied.Load()) {
+				a.TriggerSync()
+			}
+		}
+	}
+}
+
+// resolveDiscovery adds discovered backends to lb and pins the addresses of
+// backend hostnames when lb asks for it
+func (a *Agent) resolveDiscovery(ctx context.Context, lb *models.LoadBalancer) error {
+	if discovery.Uses(lb) {
+		if err := a.discovery.Resolve(ctx, lb); err != nil {
+			return fmt.Errorf("failed to discover backends: %w", err)
+		}
+	}
+	if err := a.dnsPins.Apply(ctx, lb); err != nil {
+		return fmt.Errorf("failed to pin backend addresses: %w", err)
+	}
+	return nil
+}
+
+// newDNSPinner creates the pinner of backend hostnames. Changed addresses are
+// reported as events and applied with a sync.
+func (a *Agent) newDNSPinner() *discovery.Pinner {
+	return discovery.NewPinner(net.DefaultResolver.LookupIPAddr, a.eventFunc(), a.TriggerSync)
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// fakeServers lists fixed servers for any tag
+type fakeServers []Server
+
+func (f fakeServers) ListServersByTag(context.Context, string) ([]Server, error) {
+	return f, nil
+}
+
+func TestTagProvider(t *testing.T) {
+	provider := tagProvider(fakeServers{
+		{ID: "101", PrivateIP: "10.0.0.1", PublicIP: "203.0.113.1", Status: "running"},
+		{ID: "102", PublicIP: "203.0.113.2", Status: "running"},
+		{ID: "103", PrivateIP: "10.0.0.3", Status: "stopped"},
+	})
+
+	backends, err := provider.Discover(context.Background(), &models.Discovery{Type: models.DiscoveryVPSieTag, Tag: "web", Port: 8080})
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	want := []models.Backend{
+		{ID: "vpsie-101", Address: "10.0.0.1", Port: 8080, Enabled: true},
+		{ID: "vpsie-102", Address: "203.0.113.2", Port: 8080, Enabled: true},
+	}
+	if len(backends) != len(want) {
+		t.Fatalf("Discover() = %+v, want %+v", backends, want)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(backends[i], want[i]) {
+			t.Errorf("backend %d = %+v, want %+v", i, backends[i], want[i])
+		}
+	}
+}
+
+func TestNewResolver_TagDiscoveryNeedsAPI(t *testing.T) {
+	cfg := &DiscoveryConfig{Consul: ConsulDiscoveryConfig{Address: defaultConsulAddress}}
+	resolver, err := newResolver(cfg, &FileSource{})
+	if err != nil {
+		t.Fatalf("newResolver() error = %v", err)
+	}
+	lb := &models.LoadBalancer{Discovery: &models.Discovery{Type: models.DiscoveryVPSieTag, Tag: "web", Port: 80}}
+	if err = resolver.Resolve(context.Background(), lb); err == nil {
+		t.Error("Resolve() error = nil, want vpsie_tag discovery to be unavailable outside API mode")
+	}
+}
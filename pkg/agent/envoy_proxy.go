@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// envoyAdminEndpoints are the read-only Envoy admin endpoints served under
+// /envoy/admin, with the query parameters passed on to Envoy
+var envoyAdminEndpoints = map[string][]string{
+	"/stats":       {"format", "filter", "usedonly", "histogram_buckets"},
+	"/clusters":    {"format"},
+	"/config_dump": {"resource", "mask", "name_regex", "include_eds"},
+}
+
+// maxEnvoyAdminResponseSize bounds a proxied response; a config dump of a
+// large configuration is a few MiB
+const maxEnvoyAdminResponseSize = 32 << 20
+
+// handleEnvoyAdmin proxies GET requests for the endpoints in
+// envoyAdminEndpoints to Envoy's admin interface, so operators can debug
+// without exposing the admin port. Requests need the bearer token in
+// admin.token_file; without one the proxy answers 404.
+func (a *Agent) handleEnvoyAdmin(w http.ResponseWriter, r *http.Request) {
+	if !a.authorizeAdmin(w, r, http.StatusNotFound, "the Envoy admin proxy is disabled: set admin.token_file") {
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/envoy/admin")
+	params, ok := envoyAdminEndpoints[path]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unsupported Envoy admin endpoint %s", path), http.StatusNotFound)
+		return
+	}
+	query := url.Values{}
+	for _, name := range params {
+		if values, set := r.URL.Query()[name]; set {
+			query[name] = values
+		}
+	}
+
+	resp, err := a.envoyAdmin.Get(r.Context(), path, query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("envoy admin interface unreachable: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, io.LimitReader(resp.Body, maxEnvoyAdminResponseSize))
+}
+
+// authorizeAdmin reports whether r carries the bearer token in
+// admin.token_file, and answers the request when it does not: with
+// disabledCode and disabledMessage when no token file is configured, 401 when
+// the token is missing or wrong.
+func (a *Agent) authorizeAdmin(w http.ResponseWriter, r *http.Request, disabledCode int, disabledMessage string) bool {
+	tokenFile := a.currentConfig().Admin.TokenFile
+	if tokenFile == "" {
+		http.Error(w, disabledMessage, disabledCode)
+		return false
+	}
+	token, err := loadAdminToken(tokenFile)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		http.Error(w, "admin token unavailable", http.StatusInternalServerError)
+		return false
+	}
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), token) != 1 {
+		log.Printf("Warning: Unauthorized admin request %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="vpsie-lb-agent"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// loadAdminToken reads the bearer token of the admin API
+func loadAdminToken(path string) ([]byte, error) {
+	// #nosec G304 -- path comes from the agent configuration file
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admin token file: %w", err)
+	}
+	token := bytes.TrimSpace(data)
+	if len(token) == 0 {
+		return nil, fmt.Errorf("admin token file %s is empty", path)
+	}
+	return token, nil
+}
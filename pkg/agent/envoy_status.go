@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// envoyStatus is the response of GET /envoy/status
+type envoyStatus struct {
+	Error              string `json:"error,omitempty"`
+	Version            string `json:"version,omitempty"`
+	State              string `json:"state,omitempty"`
+	PID                int    `json:"pid,omitempty"`
+	RestartEpoch       int    `json:"restart_epoch"`
+	AgentEpoch         int    `json:"agent_epoch"`
+	UptimeCurrentEpoch int64  `json:"uptime_current_epoch_seconds"`
+	UptimeAllEpochs    int64  `json:"uptime_all_epochs_seconds"`
+	Running            bool   `json:"running"`
+}
+
+// handleEnvoyStatus reports the running Envoy as seen by its admin interface,
+// next to the restart epoch the agent will build on. It answers 503 when
+// Envoy's admin interface is unreachable.
+func (a *Agent) handleEnvoyStatus(w http.ResponseWriter, r *http.Request) {
+	status := envoyStatus{AgentEpoch: a.envoyReloader.GetCurrentEpoch()}
+	if pid, err := a.envoyReloader.PID(); err == nil {
+		status.PID = pid
+	}
+
+	code := http.StatusOK
+	info, err := a.envoyAdmin.ServerInfo(r.Context())
+	if err != nil {
+		status.Error = err.Error()
+		code = http.StatusServiceUnavailable
+	} else {
+		status.Running = true
+		status.Version = info.Version
+		status.State = info.State
+		status.RestartEpoch = info.RestartEpoch
+		status.UptimeCurrentEpoch = int64(info.UptimeCurrentEpoch.Seconds())
+		status.UptimeAllEpochs = int64(info.UptimeAllEpochs.Seconds())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// logEnvoyVersion reports the installed Envoy release at startup and warns
+// when it is older than the generated configuration needs
+func (a *Agent) logEnvoyVersion(ctx context.Context) {
+	version, err := a.envoyValidator.Version(ctx)
+	if err != nil {
+		log.Printf("Warning: Cannot determine the Envoy version: %v", err)
+		return
+	}
+	log.Printf("Envoy version: %s", version)
+	if version.Less(envoy.MinVersion) {
+		log.Printf("Warning: Envoy %s is older than %s, the oldest release the agent supports", version, envoy.MinVersion)
+	}
+}
+
+// checkEnvoyVersion runs `envoy --version` before each apply and refuses a
+// configuration that uses features the installed Envoy lacks, so an old
+// binary fails with a clear error instead of a validation failure. When the
+// version cannot be determined the configuration is left to Envoy's own
+// validation.
+func (a *Agent) checkEnvoyVersion(ctx context.Context, lb *models.LoadBalancer) error {
+	version, err := a.envoyValidator.Version(ctx)
+	if err != nil {
+		log.Printf("Warning: Cannot determine the Envoy version, skipping the compatibility check: %v", err)
+		return nil
+	}
+
+	err = envoy.CheckCompatibility(lb, version)
+	var incompatible *envoy.IncompatibleError
+	if !errors.As(err, &incompatible) {
+		return err
+	}
+	a.sendEvent(ctx, NewEvent(EventEnvoyIncompatible, err.Error(), map[string]interface{}{
+		"envoy_version": version.String(),
+		"features":      incompatible.Features,
+	}))
+	return err
+}
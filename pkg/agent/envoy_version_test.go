@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// fakeEnvoyBinary writes a script that prints an `envoy --version` line
+func fakeEnvoyBinary(t *testing.T, version string) string {
+	t.Helper()
+	binary := filepath.Join(t.TempDir(), "envoy")
+	script := "#!/bin/sh\necho 'envoy  version: 816188b/" + version + "/Clean/RELEASE/BoringSSL'\n"
+	if err := os.WriteFile(binary, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return binary
+}
+
+func TestAgent_CheckEnvoyVersion(t *testing.T) {
+	lb := &models.LoadBalancer{
+		Protocol: models.ProtocolHTTP,
+		ClientIP: &models.ClientIP{TrustedCIDRs: []string{"10.0.0.0/8"}},
+	}
+
+	tests := []struct {
+		name      string
+		binary    string
+		wantErr   bool
+		wantEvent bool
+	}{
+		{name: "supported", binary: fakeEnvoyBinary(t, "1.30.1")},
+		{name: "feature unsupported", binary: fakeEnvoyBinary(t, "1.27.0"), wantErr: true, wantEvent: true},
+		{name: "version unknown", binary: "/nonexistent/envoy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reporter := &recordingReporter{}
+			a := &Agent{events: reporter, envoyValidator: envoy.NewValidator(tt.binary)}
+
+			err := a.checkEnvoyVersion(context.Background(), lb)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkEnvoyVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := len(reporter.events) == 1 && reporter.events[0] == "envoy_incompatible"; got != tt.wantEvent {
+				t.Errorf("events = %v, want envoy_incompatible: %v", reporter.events, tt.wantEvent)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// eventQueue keeps the events the VPSie API did not accept, in order, and
+// persists them so they are resent after an agent restart
+type eventQueue struct {
+	path string
+	max  int
+
+	mu     sync.Mutex
+	events []json.RawMessage
+}
+
+// newEventQueue creates a queue persisted at path, holding the events a
+// previous agent left undelivered
+func newEventQueue(path string, max int) (*eventQueue, error) {
+	q := &eventQueue{path: path, max: max}
+	// #nosec G304 -- path is inside the configured state directory
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return q, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &q.events)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queued events from %s: %w", path, err)
+	}
+	if len(q.events) > 0 {
+		log.Printf("%d undelivered events queued for resending", len(q.events))
+	}
+	return q, nil
+}
+
+// send delivers the queued events and then event through post, in order.
+// Events that could not be delivered are queued; events the API rejects as
+// invalid are dropped, since resending cannot succeed.
+func (q *eventQueue) send(event json.RawMessage, post func(json.RawMessage) error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queued := len(q.events)
+	err := q.flushLocked(post)
+	if event != nil {
+		if err == nil {
+			err = post(event)
+			if err != nil && !retryableEventError(err) {
+				return err
+			}
+		}
+		if err != nil {
+			q.events = append(q.events, event)
+			if len(q.events) > q.max {
+				log.Printf("Warning: Event queue is full, dropping %d oldest events", len(q.events)-q.max)
+				q.events = q.events[len(q.events)-q.max:]
+			}
+			err = fmt.Errorf("%w (queued for resending)", err)
+		}
+	}
+	if queued > 0 || len(q.events) > 0 {
+		q.saveLocked()
+	}
+	return err
+}
+
+// flushLocked resends queued events until one fails. The caller holds the lock.
+func (q *eventQueue) flushLocked(post func(json.RawMessage) error) error {
+	for len(q.events) > 0 {
+		err := post(q.events[0])
+		if err != nil && retryableEventError(err) {
+			return err
+		}
+		if err != nil {
+			log.Printf("Warning: Dropping queued event rejected by the API: %v", err)
+		}
+		q.events = q.events[1:]
+	}
+	return nil
+}
+
+// saveLocked persists the queue. The caller holds the lock.
+func (q *eventQueue) saveLocked() {
+	data, err := json.Marshal(q.events)
+	if err == nil {
+		err = writeFileAtomic(q.path, data)
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to save queued events: %v", err)
+	}
+}
+
+// size returns the number of queued events
+func (q *eventQueue) size() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.events)
+}
+
+// retryableEventError reports whether an event that failed with err may be
+// accepted later: the API was unreachable, overloaded or failing
+func retryableEventError(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	return apiErr.StatusCode >= http.StatusInternalServerError || apiErr.StatusCode == http.StatusTooManyRequests
+}
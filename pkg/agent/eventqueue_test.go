@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestVPSieClient_SendEvent_Queue(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		status   = http.StatusServiceUnavailable
+		received []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event struct {
+			Type string `json:"type"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		defer mu.Unlock()
+		if status == http.StatusOK {
+			received = append(received, event.Type)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	setStatus := func(code int) {
+		mu.Lock()
+		status = code
+		mu.Unlock()
+	}
+
+	path := filepath.Join(t.TempDir(), eventsFileName)
+	newClient := func() (*VPSieClient, *eventQueue) {
+		queue, err := newEventQueue(path, 2)
+		if err != nil {
+			t.Fatalf("newEventQueue() error = %v", err)
+		}
+		client, _ := NewVPSieClient("test-key", server.URL, "lb-123")
+		client.SetEventQueue(queue)
+		return client, queue
+	}
+	ctx := context.Background()
+
+	// The API is down: events are queued, the oldest beyond the limit dropped
+	client, queue := newClient()
+	for _, eventType := range []string{"first", "second", "third"} {
+		if err := client.SendEvent(ctx, Event{Type: EventType(eventType)}); err == nil {
+			t.Errorf("SendEvent(%s) error = nil, want queued", eventType)
+		}
+	}
+	if queue.size() != 2 {
+		t.Errorf("queued = %d, want 2", queue.size())
+	}
+
+	// A restarted agent resends them in order before the next event
+	client, queue = newClient()
+	if queue.size() != 2 {
+		t.Fatalf("queued after restart = %d, want 2", queue.size())
+	}
+	setStatus(http.StatusOK)
+	if err := client.SendEvent(ctx, Event{Type: "fourth"}); err != nil {
+		t.Fatalf("SendEvent() error = %v", err)
+	}
+	if len(received) != 3 || received[0] != "second" || received[1] != "third" || received[2] != "fourth" {
+		t.Errorf("received = %v, want [second third fourth]", received)
+	}
+	if queue.size() != 0 {
+		t.Errorf("queued = %d, want 0", queue.size())
+	}
+
+	// Events the API rejects are not queued
+	setStatus(http.StatusBadRequest)
+	if err := client.SendEvent(ctx, Event{Type: "invalid"}); err == nil {
+		t.Error("SendEvent() error = nil, want the rejection")
+	}
+	if queue.size() != 0 {
+		t.Errorf("queued after rejection = %d, want 0", queue.size())
+	}
+	if err := client.FlushEvents(ctx); err != nil {
+		t.Errorf("FlushEvents() error = %v", err)
+	}
+}
+
+func TestRetryableEventError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unreachable", context.DeadlineExceeded, true},
+		{"server error", &APIError{StatusCode: http.StatusBadGateway}, true},
+		{"rate limited", &APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{"bad request", &APIError{StatusCode: http.StatusBadRequest}, false},
+		{"not found", &APIError{StatusCode: http.StatusNotFound}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryableEventError(tt.err); got != tt.want {
+				t.Errorf("retryableEventError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
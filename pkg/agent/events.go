@@ -0,0 +1,241 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/events"
+)
+
+// EventType identifies what an event reports. Event types of the subsystems
+// are defined by pkg/events and named here as well.
+type EventType = events.Type
+
+// Event types
+const (
+	// Configuration
+	EventConfigUpdated         EventType = "config_updated"
+	EventConfigDiff            EventType = "config_diff"
+	EventConfigDivergence      EventType = "config_divergence"
+	EventConfigRolledBack      EventType = "config_rolled_back"
+	EventConfigStaged          EventType = "config_staged"
+	EventConfigApproved        EventType = "config_approved"
+	EventConfigRejected        EventType = "config_rejected"
+	EventSnapshotExported      EventType = "snapshot_exported"
+	EventReconciliationPaused  EventType = "reconciliation_paused"
+	EventReconciliationResumed EventType = "reconciliation_resumed"
+	EventCriticalFailure       EventType = "critical_failure"
+	EventPlanLimitExceeded     EventType = "plan_limit_exceeded"
+
+	// Envoy
+	EventEnvoyReloaded     EventType = "envoy_reloaded"
+	EventEnvoyReloadFailed EventType = "envoy_reload_failed"
+	EventEnvoyIncompatible EventType = "envoy_incompatible"
+	EventBootstrapUpdated  EventType = "bootstrap_updated"
+
+	// HAProxy and Nginx
+	EventProxyReloaded     EventType = "proxy_reloaded"
+	EventProxyReloadFailed EventType = "proxy_reload_failed"
+	EventProxyUnsupported  EventType = "proxy_unsupported"
+
+	// Health
+	EventBackendHealthy       EventType = "backend_healthy"
+	EventBackendUnhealthy     EventType = "backend_unhealthy"
+	EventBackendPoolDown      EventType = "backend_pool_down"
+	EventBackendPoolRecovered EventType = "backend_pool_recovered"
+	EventBackendQuarantined   EventType = "backend_quarantined"
+	EventBackendReleased      EventType = "backend_released"
+	EventDataPlaneAvailable   EventType = "data_plane_available"
+	EventDataPlaneUnavailable EventType = "data_plane_unavailable"
+	EventHealthDNSChanged     EventType = "health_dns_changed"
+	EventBackendDNSChanged              = events.BackendDNSChanged
+
+	// Certificates and TLS
+	EventCertificateReloaded   EventType = "certificate_reloaded"
+	EventCertificateInvalid    EventType = "certificate_invalid"
+	EventSessionTicketsRotated EventType = "session_tickets_rotated"
+
+	// High availability
+	EventHAFailover        EventType = "ha_failover"
+	EventFloatingIPFailed  EventType = "floating_ip_failed"
+	EventGSLBRegionChanged           = events.GSLBRegionChanged
+
+	// Configuration source (VPSie API, file or Kubernetes)
+	EventConfigSourceFailed    EventType = "config_source_failed"
+	EventConfigSourceRecovered EventType = "config_source_recovered"
+
+	// Traffic management
+	EventCanaryStarted              = events.CanaryStarted
+	EventCanaryStep                 = events.CanaryStep
+	EventCanaryPromoted             = events.CanaryPromoted
+	EventCanaryRolledBack           = events.CanaryRolledBack
+	EventAutoscaleOut               = events.AutoscaleOut
+	EventAutoscaleIn                = events.AutoscaleIn
+	EventAutoscaleFailed            = events.AutoscaleFailed
+	EventWeightReduced              = events.WeightReduced
+	EventWeightRestored             = events.WeightRestored
+	EventFastPathEngaged  EventType = "fast_path_engaged"
+	EventFastPathDown     EventType = "fast_path_unavailable"
+	EventAttackStarted              = events.AttackStarted
+	EventAttackEnded                = events.AttackEnded
+)
+
+// Severity is how urgently an event needs attention
+type Severity string
+
+// Event severities
+const (
+	SeverityInfo     Severity = "info"     // expected operation
+	SeverityWarning  Severity = "warning"  // degraded, handled by the agent
+	SeverityError    Severity = "error"    // a change or component failed
+	SeverityCritical Severity = "critical" // the load balancer may be in an inconsistent state
+)
+
+// EventCategory groups events by the part of the system they concern
+type EventCategory string
+
+// Event categories
+const (
+	CategoryConfig      EventCategory = "config"
+	CategoryEnvoy       EventCategory = "envoy"
+	CategoryHealth      EventCategory = "health"
+	CategoryCertificate EventCategory = "certificate"
+	CategoryHA          EventCategory = "ha"
+	CategoryAPI         EventCategory = "api"
+	CategoryTraffic     EventCategory = "traffic"
+	CategorySecurity    EventCategory = "security"
+)
+
+// eventClass is the severity and category of an event type
+type eventClass struct {
+	severity Severity
+	category EventCategory
+}
+
+// eventTaxonomy classifies every event type the agent sends
+var eventTaxonomy = map[EventType]eventClass{
+	EventConfigUpdated:         {SeverityInfo, CategoryConfig},
+	EventConfigDiff:            {SeverityInfo, CategoryConfig},
+	EventConfigDivergence:      {SeverityError, CategoryConfig},
+	EventConfigRolledBack:      {SeverityError, CategoryConfig},
+	EventConfigStaged:          {SeverityInfo, CategoryConfig},
+	EventConfigApproved:        {SeverityInfo, CategoryConfig},
+	EventConfigRejected:        {SeverityWarning, CategoryConfig},
+	EventSnapshotExported:      {SeverityInfo, CategoryConfig},
+	EventReconciliationPaused:  {SeverityWarning, CategoryConfig},
+	EventReconciliationResumed: {SeverityInfo, CategoryConfig},
+	EventCriticalFailure:       {SeverityCritical, CategoryConfig},
+	EventPlanLimitExceeded:     {SeverityError, CategoryConfig},
+
+	EventEnvoyReloaded:     {SeverityInfo, CategoryEnvoy},
+	EventEnvoyReloadFailed: {SeverityError, CategoryEnvoy},
+	EventEnvoyIncompatible: {SeverityError, CategoryEnvoy},
+	EventProxyReloaded:     {SeverityInfo, CategoryEnvoy},
+	EventProxyReloadFailed: {SeverityError, CategoryEnvoy},
+	EventProxyUnsupported:  {SeverityError, CategoryEnvoy},
+	EventBootstrapUpdated:  {SeverityInfo, CategoryEnvoy},
+
+	EventBackendHealthy:       {SeverityInfo, CategoryHealth},
+	EventBackendUnhealthy:     {SeverityWarning, CategoryHealth},
+	EventBackendPoolDown:      {SeverityCritical, CategoryHealth},
+	EventBackendPoolRecovered: {SeverityInfo, CategoryHealth},
+	EventBackendQuarantined:   {SeverityWarning, CategoryHealth},
+	EventBackendReleased:      {SeverityInfo, CategoryHealth},
+	EventDataPlaneAvailable:   {SeverityInfo, CategoryHealth},
+	EventDataPlaneUnavailable: {SeverityError, CategoryHealth},
+	EventHealthDNSChanged:     {SeverityWarning, CategoryHealth},
+	EventBackendDNSChanged:    {SeverityInfo, CategoryHealth},
+
+	EventCertificateReloaded:   {SeverityInfo, CategoryCertificate},
+	EventCertificateInvalid:    {SeverityError, CategoryCertificate},
+	EventSessionTicketsRotated: {SeverityInfo, CategoryCertificate},
+
+	EventHAFailover:        {SeverityWarning, CategoryHA},
+	EventFloatingIPFailed:  {SeverityError, CategoryHA},
+	EventGSLBRegionChanged: {SeverityWarning, CategoryHA},
+
+	EventConfigSourceFailed:    {SeverityError, CategoryAPI},
+	EventConfigSourceRecovered: {SeverityInfo, CategoryAPI},
+
+	EventCanaryStarted:    {SeverityInfo, CategoryTraffic},
+	EventCanaryStep:       {SeverityInfo, CategoryTraffic},
+	EventCanaryPromoted:   {SeverityInfo, CategoryTraffic},
+	EventCanaryRolledBack: {SeverityWarning, CategoryTraffic},
+	EventAutoscaleOut:     {SeverityInfo, CategoryTraffic},
+	EventAutoscaleIn:      {SeverityInfo, CategoryTraffic},
+	EventAutoscaleFailed:  {SeverityError, CategoryTraffic},
+	EventWeightReduced:    {SeverityWarning, CategoryTraffic},
+	EventWeightRestored:   {SeverityInfo, CategoryTraffic},
+	EventFastPathEngaged:  {SeverityInfo, CategoryTraffic},
+	EventFastPathDown:     {SeverityWarning, CategoryTraffic},
+
+	EventAttackStarted: {SeverityWarning, CategorySecurity},
+	EventAttackEnded:   {SeverityInfo, CategorySecurity},
+}
+
+// Event is an agent lifecycle event
+type Event struct {
+	Metadata      map[string]interface{} `json:"metadata"`
+	Type          EventType              `json:"type"`
+	Severity      Severity               `json:"severity"`
+	Category      EventCategory          `json:"category"`
+	Message       string                 `json:"message"`
+	CorrelationID string                 `json:"correlation_id,omitempty"` // shared by the events of one sync or reload
+}
+
+// NewEvent creates an event classified by the event taxonomy. Types missing
+// from it are reported as warnings of the config category.
+func NewEvent(eventType EventType, message string, metadata map[string]interface{}) Event {
+	class, ok := eventTaxonomy[eventType]
+	if !ok {
+		class = eventClass{SeverityWarning, CategoryConfig}
+	}
+	return Event{
+		Type:     eventType,
+		Severity: class.severity,
+		Category: class.category,
+		Message:  message,
+		Metadata: metadata,
+	}
+}
+
+// correlationKey is the context key of the correlation ID
+type correlationKey struct{}
+
+// withCorrelationID returns a context whose events share a new correlation ID
+func withCorrelationID(ctx context.Context) context.Context {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationKey{}, hex.EncodeToString(id))
+}
+
+// correlationID returns the correlation ID of ctx, if any
+func correlationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// sendEvent reports event, tagged with the correlation ID of ctx, and
+// notifies the configured webhooks whether or not the report succeeds.
+// Events are best effort: a failure is logged and does not fail the caller.
+func (a *Agent) sendEvent(ctx context.Context, event Event) {
+	if event.CorrelationID == "" {
+		event.CorrelationID = correlationID(ctx)
+	}
+	a.notify(&event)
+	if err := a.events.SendEvent(ctx, event); err != nil {
+		log.Printf("Warning: Failed to send %s event: %v", event.Type, err)
+	}
+}
+
+// eventFunc adapts sendEvent to the event callbacks of the discovery,
+// canary, autoscale, slow backend, firewall and GSLB packages
+func (a *Agent) eventFunc() events.Func {
+	return func(ctx context.Context, eventType events.Type, message string, metadata map[string]interface{}) {
+		a.sendEvent(ctx, NewEvent(eventType, message, metadata))
+	}
+}
@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/events"
+)
+
+func TestNewEvent(t *testing.T) {
+	event := NewEvent(EventCriticalFailure, "restore failed", map[string]interface{}{"epoch": 3})
+	if event.Severity != SeverityCritical || event.Category != CategoryConfig || event.Message != "restore failed" {
+		t.Errorf("NewEvent() = %+v, want a critical config event", event)
+	}
+
+	// Types missing from the taxonomy still get a class
+	if event = NewEvent("something_new", "", nil); event.Severity != SeverityWarning || event.Category != CategoryConfig {
+		t.Errorf("NewEvent(unknown) = %+v, want a warning of the config category", event)
+	}
+
+	// Approval events are named after the change state
+	for _, state := range []string{ChangeApproved, ChangeRejected} {
+		if _, ok := eventTaxonomy[EventType("config_"+state)]; !ok {
+			t.Errorf("config_%s is missing from the event taxonomy", state)
+		}
+	}
+
+	// Every event type of the subsystems is classified
+	for _, eventType := range []events.Type{
+		events.BackendDNSChanged, events.GSLBRegionChanged,
+		events.CanaryStarted, events.CanaryStep, events.CanaryPromoted, events.CanaryRolledBack,
+		events.AutoscaleOut, events.AutoscaleIn, events.AutoscaleFailed,
+		events.WeightReduced, events.WeightRestored, events.AttackStarted, events.AttackEnded,
+	} {
+		if _, ok := eventTaxonomy[eventType]; !ok {
+			t.Errorf("%s is missing from the event taxonomy", eventType)
+		}
+	}
+}
+
+func TestAgent_SendEvent_Correlation(t *testing.T) {
+	reporter := &recordingReporter{}
+	a := &Agent{events: reporter}
+
+	a.sendEvent(context.Background(), NewEvent(EventConfigUpdated, "", nil))
+	ctx := withCorrelationID(context.Background())
+	a.sendEvent(ctx, NewEvent(EventEnvoyReloaded, "", nil))
+	a.sendEvent(ctx, NewEvent(EventConfigUpdated, "", nil))
+
+	if reporter.sent[0].CorrelationID != "" {
+		t.Errorf("CorrelationID without a correlated context = %q, want none", reporter.sent[0].CorrelationID)
+	}
+	if id := reporter.sent[1].CorrelationID; id == "" || id != reporter.sent[2].CorrelationID || id != correlationID(ctx) {
+		t.Errorf("correlation IDs = %q, %q, want the ID of the context", id, reporter.sent[2].CorrelationID)
+	}
+}
+
+func TestAgent_ReportHealthChanges(t *testing.T) {
+	reporter := &recordingReporter{}
+	a := &Agent{config: &Config{}, events: reporter}
+	sample := func(health ...string) []envoy.HostStatus {
+		statuses := make([]envoy.HostStatus, len(health))
+		for i, h := range health {
+			statuses[i] = envoy.HostStatus{Cluster: "lb-1", Address: "10.0.0." + string(rune('1'+i)) + ":80", Health: h}
+		}
+		return statuses
+	}
+
+	var last map[string]string
+	for _, step := range [][]string{
+		{envoy.HostPending, envoy.HostHealthy},   // first sample: nothing to compare
+		{envoy.HostHealthy, envoy.HostUnhealthy}, // second host fails
+		{envoy.HostHealthy, envoy.HostEjected},   // still failing
+		{envoy.HostHealthy, envoy.HostHealthy},   // second host recovers
+		{envoy.HostDraining, envoy.HostHealthy},  // draining is no failure
+	} {
+		last = a.reportHealthChanges(context.Background(), last, sample(step...))
+	}
+
+	if got := strings.Join(reporter.events, ","); got != "backend_unhealthy,backend_healthy" {
+		t.Errorf("events = %s, want backend_unhealthy,backend_healthy", got)
+	}
+	if address := reporter.sent[0].Metadata["address"]; address != "10.0.0.2:80" {
+		t.Errorf("address = %v, want 10.0.0.2:80", address)
+	}
+}
+
+func TestAgent_ReportHealthChanges_PoolDown(t *testing.T) {
+	reporter := &recordingReporter{}
+	a := &Agent{config: &Config{}, events: reporter}
+	hosts := func(cluster string, health ...string) []envoy.HostStatus {
+		statuses := make([]envoy.HostStatus, len(health))
+		for i, h := range health {
+			statuses[i] = envoy.HostStatus{Cluster: cluster, Address: "10.0.0." + string(rune('1'+i)) + ":80", Health: h}
+		}
+		return statuses
+	}
+
+	var last map[string]string
+	for _, step := range [][]envoy.HostStatus{
+		append(hosts("lb-1", envoy.HostHealthy, envoy.HostHealthy), hosts("lb-1-api", envoy.HostUnhealthy)...),
+		append(hosts("lb-1", envoy.HostUnhealthy, envoy.HostEjected), hosts("lb-1-api", envoy.HostUnhealthy)...),
+		append(hosts("lb-1", envoy.HostUnhealthy, envoy.HostHealthy), hosts("lb-1-api", envoy.HostUnhealthy)...),
+	} {
+		last = a.reportHealthChanges(context.Background(), last, step)
+	}
+
+	var pools []string
+	for _, event := range reporter.sent {
+		if event.Type == EventBackendPoolDown || event.Type == EventBackendPoolRecovered {
+			pools = append(pools, string(event.Type)+":"+event.Metadata["cluster"].(string))
+		}
+	}
+	// lb-1-api was down from the first sample on: not reported
+	if got := strings.Join(pools, ","); got != "backend_pool_down:lb-1,backend_pool_recovered:lb-1" {
+		t.Errorf("pool events = %s, want lb-1 down and recovered", got)
+	}
+	if reporter.sent[2].Severity != SeverityCritical {
+		t.Errorf("pool down severity = %s, want critical", reporter.sent[2].Severity)
+	}
+}
+
+func TestAgent_RecordSourceFailure(t *testing.T) {
+	reporter := &recordingReporter{}
+	a := &Agent{config: &Config{Source: SourceConfig{Mode: SourceModeAPI}}, events: reporter}
+	ctx := context.Background()
+
+	a.recordSourceRecovery(ctx) // nothing failed yet
+	a.recordSourceFailure(ctx, errors.New("API returned status 503"))
+	a.recordSourceFailure(ctx, errors.New("API returned status 503"))
+	a.recordSourceRecovery(ctx)
+	a.recordSourceRecovery(ctx)
+
+	if got := strings.Join(reporter.events, ","); got != "config_source_failed,config_source_recovered" {
+		t.Errorf("events = %s, want config_source_failed,config_source_recovered", got)
+	}
+	if reporter.sent[0].Category != CategoryAPI || reporter.sent[0].Severity != SeverityError {
+		t.Errorf("failure event = %+v, want an api error", reporter.sent[0])
+	}
+}
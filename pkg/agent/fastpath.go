@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"slices"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ipvs"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/proxy"
+)
+
+// FastPathConfig configures the kernel fast path of plain TCP load
+// balancers: IPVS forwards their connections to the backends, and Envoy only
+// health checks the backends, whose health decides where IPVS sends new
+// connections. Load balancers using features IPVS lacks stay on Envoy.
+type FastPathConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Method  string `yaml:"method"` // nat (default), dr or tunnel
+}
+
+// setDefaults fills in unset fast path settings
+func (c *FastPathConfig) setDefaults() {
+	if c.Method == "" {
+		c.Method = string(ipvs.MethodNAT)
+	}
+}
+
+// validate checks the fast path settings. The fast path programs the kernel
+// of the agent's host from the health Envoy reports, so it needs a local
+// Envoy.
+func (c *FastPathConfig) validate(cfg *Config) []error {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []error
+	if !slices.Contains(ipvs.Methods, ipvs.Method(c.Method)) {
+		errs = append(errs, fmt.Errorf("fast_path.method %q must be %s, %s or %s", c.Method, ipvs.MethodNAT, ipvs.MethodDirect, ipvs.MethodTunnel))
+	}
+	if _, err := exec.LookPath("ipvsadm"); err != nil {
+		errs = append(errs, fmt.Errorf("fast_path: %w", err))
+	}
+	if !cfg.Proxy.envoy() {
+		errs = append(errs, fmt.Errorf("fast_path requires proxy.driver %s", ProxyDriverEnvoy))
+	}
+	if cfg.Envoy.Remote.enabled() {
+		errs = append(errs, errors.New("fast_path cannot be used with envoy.remote"))
+	}
+	return errs
+}
+
+// fastPathFailing returns whether Envoy finds a backend of lb failing in
+// statuses, by host:port
+func fastPathFailing(lb *models.LoadBalancer, statuses []envoy.HostStatus) func(string) bool {
+	cluster := envoy.ClusterName(lb, "")
+	failing := make(map[string]bool)
+	for _, status := range statuses {
+		if status.Cluster == cluster && hostFailing(status.Health) {
+			failing[status.Address] = true
+		}
+	}
+	return func(hostPort string) bool { return failing[hostPort] }
+}
+
+// refreshFastPath programs the fast path of the applied load balancer with
+// the current health of its backends
+func (a *Agent) refreshFastPath(ctx context.Context) {
+	if a.fastPath == nil {
+		return
+	}
+	// Without Envoy's view every backend counts as healthy until the next
+	// health sample
+	statuses, _ := a.envoyAdmin.HostStatuses(ctx)
+	a.updateFastPath(ctx, statuses)
+}
+
+// updateFastPath programs the fast path of the applied load balancer from
+// the backend health in statuses, and reports when the load balancer moves
+// onto the fast path or off it. A load balancer IPVS cannot serve has its
+// IPVS services removed and is served by Envoy.
+func (a *Agent) updateFastPath(ctx context.Context, statuses []envoy.HostStatus) {
+	lb := a.lastApplied.Load()
+	if a.fastPath == nil || lb == nil {
+		return
+	}
+	a.fastPathMu.Lock()
+	defer a.fastPathMu.Unlock()
+
+	services, err := ipvs.Services(lb, ipvs.Method(a.currentConfig().FastPath.Method))
+	if applyErr := a.fastPath.Apply(ctx, services, fastPathFailing(lb, statuses)); applyErr != nil {
+		log.Printf("Warning: Failed to program the fast path: %v", applyErr)
+		return
+	}
+
+	state := "engaged"
+	if err != nil {
+		state = err.Error()
+	}
+	if state == a.fastPathState {
+		return
+	}
+	a.fastPathState = state
+
+	var unsupported *proxy.UnsupportedError
+	if errors.As(err, &unsupported) {
+		log.Printf("Load balancer %s is served by Envoy: %v", lb.ID, err)
+		a.sendEvent(ctx, NewEvent(EventFastPathDown, err.Error(), map[string]interface{}{
+			"features": unsupported.Features,
+		}))
+		return
+	}
+	log.Printf("Load balancer %s is served by the IPVS fast path", lb.ID)
+	a.sendEvent(ctx, NewEvent(EventFastPathEngaged, "Connections are forwarded by IPVS", map[string]interface{}{
+		"services": len(services),
+		"method":   a.currentConfig().FastPath.Method,
+	}))
+}
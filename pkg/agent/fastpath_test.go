@@ -0,0 +1,31 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestFastPathFailing(t *testing.T) {
+	lb := &models.LoadBalancer{ID: "lb-1"}
+	cluster := envoy.ClusterName(lb, "")
+	failing := fastPathFailing(lb, []envoy.HostStatus{
+		{Cluster: cluster, Address: "192.168.1.10:5432", Health: envoy.HostUnhealthy},
+		{Cluster: cluster, Address: "192.168.1.11:5432", Health: envoy.HostEjected},
+		{Cluster: cluster, Address: "192.168.1.12:5432", Health: envoy.HostHealthy},
+		{Cluster: "cluster_lb-2", Address: "192.168.1.13:5432", Health: envoy.HostUnhealthy},
+	})
+
+	for address, want := range map[string]bool{
+		"192.168.1.10:5432": true,
+		"192.168.1.11:5432": true,
+		"192.168.1.12:5432": false,
+		"192.168.1.13:5432": false, // another load balancer's cluster
+		"192.168.1.14:5432": false, // unknown to Envoy
+	} {
+		if got := failing(address); got != want {
+			t.Errorf("failing(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
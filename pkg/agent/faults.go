@@ -0,0 +1,32 @@
+package agent
+
+import (
+	"log"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// Node environments
+const (
+	// EnvironmentProduction never applies fault injection (default)
+	EnvironmentProduction = "production"
+	// EnvironmentStaging applies the fault injection of routes
+	EnvironmentStaging = "staging"
+)
+
+// stripFaultInjection removes the fault injection of lb's routes unless this
+// node is a staging node, so a load balancer definition shared with staging
+// never degrades production traffic. The configuration hash then covers the
+// change, and faults already applied are removed when a node is switched
+// back to production.
+func (a *Agent) stripFaultInjection(lb *models.LoadBalancer) {
+	if !lb.HasFaultInjection() || a.currentConfig().Environment == EnvironmentStaging {
+		return
+	}
+	for i := range lb.Routes {
+		if lb.Routes[i].FaultInjection != nil {
+			log.Printf("Warning: Ignoring fault_injection of route %s: environment is %s, not %s", lb.Routes[i].Name, a.currentConfig().Environment, EnvironmentStaging)
+			lb.Routes[i].FaultInjection = nil
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestStripFaultInjection(t *testing.T) {
+	tests := []struct {
+		environment string
+		wantFaults  bool
+	}{
+		{EnvironmentProduction, false},
+		{"", false},
+		{EnvironmentStaging, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.environment, func(t *testing.T) {
+			a := &Agent{config: &Config{Environment: tt.environment}}
+			lb := &models.LoadBalancer{Routes: []models.Route{
+				{Name: "api", FaultInjection: &models.FaultInjection{AbortPercent: 5, AbortStatus: 503}},
+				{Name: "web"},
+			}}
+
+			a.stripFaultInjection(lb)
+			if lb.HasFaultInjection() != tt.wantFaults {
+				t.Errorf("fault injection kept = %v, want %v", lb.HasFaultInjection(), tt.wantFaults)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// defaultLoadBalancerFile is the file read when the source path is a directory
+	defaultLoadBalancerFile = "loadbalancer.yaml"
+
+	// fileWatchDebounce coalesces bursts of filesystem events (editors often write several times)
+	fileWatchDebounce = 500 * time.Millisecond
+)
+
+// FileSource reads the load balancer configuration from a local YAML file
+// instead of the VPSie API. It is intended for development, CI and on-prem
+// installs without the VPSie control plane.
+type FileSource struct {
+	path string
+}
+
+// NewFileSource creates a file-backed configuration source. If path is a
+// directory, the configuration is read from loadbalancer.yaml inside it.
+func NewFileSource(path string) (*FileSource, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file source path must not be empty")
+	}
+
+	cleanPath, err := filepath.Abs(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("invalid file source path: %w", err)
+	}
+
+	info, err := os.Stat(cleanPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to stat file source path: %w", err)
+	}
+	if err == nil && info.IsDir() {
+		cleanPath = filepath.Join(cleanPath, defaultLoadBalancerFile)
+	}
+
+	return &FileSource{path: cleanPath}, nil
+}
+
+// Path returns the resolved path of the load balancer configuration file
+func (s *FileSource) Path() string {
+	return s.path
+}
+
+// GetLoadBalancerConfig reads and decodes the load balancer configuration file
+func (s *FileSource) GetLoadBalancerConfig(ctx context.Context) (*models.LoadBalancer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// #nosec G304 -- path is set from agent configuration, not from remote input
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var lb models.LoadBalancer
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&lb); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", s.path, err)
+	}
+
+	return &lb, nil
+}
+
+// Watch watches the configuration file for changes and calls onChange after
+// each (debounced) modification. The parent directory is watched so that
+// atomic replace-by-rename, as done by most editors, is detected too.
+// Watch blocks until ctx is cancelled.
+func (s *FileSource) Watch(ctx context.Context, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	defer func() { _ = watcher.Close() }()
+
+	if err = watcher.Add(filepath.Dir(s.path)); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", filepath.Dir(s.path), err)
+	}
+
+	debounce := time.NewTimer(fileWatchDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) != s.path {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+				continue
+			}
+			debounce.Reset(fileWatchDebounce)
+
+		case watchErr, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("Warning: File watcher error: %v", watchErr)
+
+		case <-debounce.C:
+			onChange()
+		}
+	}
+}
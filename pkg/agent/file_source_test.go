@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testLoadBalancerYAML = `
+id: lb-local
+name: local-lb
+protocol: http
+algorithm: round_robin
+port: 8080
+backends:
+  - id: be-1
+    address: 10.0.0.1
+    port: 80
+    enabled: true
+`
+
+func TestNewFileSource(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "lb.yaml")
+	if err := os.WriteFile(filePath, []byte(testLoadBalancerYAML), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantPath string
+		wantErr  bool
+	}{
+		{
+			name:     "file path",
+			path:     filePath,
+			wantPath: filePath,
+		},
+		{
+			name:     "directory path resolves to loadbalancer.yaml",
+			path:     tmpDir,
+			wantPath: filepath.Join(tmpDir, "loadbalancer.yaml"),
+		},
+		{
+			name:    "empty path",
+			path:    "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewFileSource(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewFileSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && source.Path() != tt.wantPath {
+				t.Errorf("Path() = %v, want %v", source.Path(), tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestFileSource_GetLoadBalancerConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name:    "valid config",
+			content: testLoadBalancerYAML,
+		},
+		{
+			name:    "invalid YAML",
+			content: "id: [unterminated",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field rejected",
+			content: testLoadBalancerYAML + "\nbogus_field: true\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(tmpDir, "loadbalancer.yaml"), []byte(tt.content), 0600); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+
+			source, err := NewFileSource(tmpDir)
+			if err != nil {
+				t.Fatalf("NewFileSource() error = %v", err)
+			}
+
+			lb, err := source.GetLoadBalancerConfig(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetLoadBalancerConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if lb.ID != "lb-local" || len(lb.Backends) != 1 {
+				t.Errorf("unexpected config: %+v", lb)
+			}
+			if err = lb.Validate(); err != nil {
+				t.Errorf("loaded config failed validation: %v", err)
+			}
+		})
+	}
+}
+
+func TestFileSource_GetLoadBalancerConfig_Missing(t *testing.T) {
+	source, err := NewFileSource(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err != nil {
+		t.Fatalf("NewFileSource() error = %v", err)
+	}
+
+	if _, err = source.GetLoadBalancerConfig(context.Background()); err == nil {
+		t.Error("Expected error for missing config file")
+	}
+}
+
+func TestFileSource_Watch(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "loadbalancer.yaml")
+	if err := os.WriteFile(filePath, []byte(testLoadBalancerYAML), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	source, err := NewFileSource(tmpDir)
+	if err != nil {
+		t.Fatalf("NewFileSource() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- source.Watch(ctx, func() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+	}()
+
+	// Give the watcher time to register before modifying the file
+	time.Sleep(100 * time.Millisecond)
+	if err = os.WriteFile(filePath, []byte(testLoadBalancerYAML+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected change notification after file write")
+	}
+
+	cancel()
+	if err = <-done; err != nil {
+		t.Errorf("Watch() error = %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/firewall"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ha"
+)
+
+// FirewallConfig configures the host firewall rules that enforce the
+// per-source connection limits of load balancers with DDoS protection
+type FirewallConfig struct {
+	Backend string `yaml:"backend"` // nftables or iptables, empty leaves the host firewall alone
+}
+
+// ddosEvaluateInterval is how often the connection rate is sampled for attack detection
+const ddosEvaluateInterval = 5 * time.Second
+
+// validate checks the firewall settings
+func (c *FirewallConfig) validate() []error {
+	switch firewall.Backend(c.Backend) {
+	case "", firewall.BackendNFTables, firewall.BackendIPTables:
+		return nil
+	}
+	return []error{fmt.Errorf("firewall.backend %q must be %s or %s", c.Backend, firewall.BackendNFTables, firewall.BackendIPTables)}
+}
+
+// newDDoSGuard creates the guard programming the host firewall. Attack mode
+// changes are reported as events.
+func (a *Agent) newDDoSGuard(cfg *FirewallConfig) (*firewall.Guard, error) {
+	fw, err := firewall.New(firewall.Backend(cfg.Backend))
+	if err != nil {
+		return nil, err
+	}
+	return firewall.NewGuard(fw, a.eventFunc()), nil
+}
+
+// runDDoSGuard detects connection floods while this node is active
+func (a *Agent) runDDoSGuard(ctx context.Context) {
+	a.ddos.Run(ctx, ddosEvaluateInterval, func() bool { return a.Role() == ha.RoleActive })
+}
+
+// handleDDoSStatus serves the connection flood protection state
+func (a *Agent) handleDDoSStatus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if a.ddos == nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"enabled": false})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"enabled": true, "status": a.ddos.Status()})
+}
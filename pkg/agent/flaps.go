@@ -0,0 +1,312 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// FlapDetectionConfig configures how backend hosts moving between serving and
+// failing are scored, and whether chronically flapping ones are quarantined
+type FlapDetectionConfig struct {
+	Window             time.Duration `yaml:"window"`              // transitions counted for the score, default 1h
+	Threshold          int           `yaml:"threshold"`           // transitions in window that score 0, default 6
+	Quarantine         bool          `yaml:"quarantine"`          // take hosts reaching threshold out of rotation
+	QuarantineDuration time.Duration `yaml:"quarantine_duration"` // default 30m
+}
+
+// Default flap detection settings applied by LoadConfig
+const (
+	defaultFlapWindow             = time.Hour
+	defaultFlapThreshold          = 6
+	defaultFlapQuarantineDuration = 30 * time.Minute
+)
+
+// Flap detection bounds enforced by validate
+const (
+	minFlapWindow     = time.Minute
+	maxFlapWindow     = 24 * time.Hour
+	maxFlapThreshold  = 1000
+	maxFlapQuarantine = 24 * time.Hour
+)
+
+// setDefaults fills in unset flap detection settings
+func (c *FlapDetectionConfig) setDefaults() {
+	if c.Window == 0 {
+		c.Window = defaultFlapWindow
+	}
+	if c.Threshold == 0 {
+		c.Threshold = defaultFlapThreshold
+	}
+	if c.QuarantineDuration == 0 {
+		c.QuarantineDuration = defaultFlapQuarantineDuration
+	}
+}
+
+// validate checks the flap detection settings that are set
+func (c *FlapDetectionConfig) validate() []error {
+	var errs []error
+	if c.Window != 0 && c.Window < minFlapWindow || c.Window > maxFlapWindow {
+		errs = append(errs, fmt.Errorf("flap_detection.window %s is out of range: must be between %s and %s", c.Window, minFlapWindow, maxFlapWindow))
+	}
+	if c.Threshold != 0 && c.Threshold < 2 || c.Threshold > maxFlapThreshold {
+		errs = append(errs, fmt.Errorf("flap_detection.threshold %d must be between 2 and %d", c.Threshold, maxFlapThreshold))
+	}
+	if c.QuarantineDuration != 0 && c.QuarantineDuration < time.Minute || c.QuarantineDuration > maxFlapQuarantine {
+		errs = append(errs, fmt.Errorf("flap_detection.quarantine_duration %s is out of range: must be between 1m and %s", c.QuarantineDuration, maxFlapQuarantine))
+	}
+	return errs
+}
+
+// BackendStability is the flapping of a backend host
+type BackendStability struct {
+	QuarantinedUntil *time.Time `json:"quarantined_until,omitempty"`
+	Cluster          string     `json:"cluster"`
+	Address          string     `json:"address"`
+	Transitions      uint64     `json:"transitions_total"` // since the agent started
+	Flaps            int        `json:"flaps"`             // transitions within the window
+	StabilityScore   int        `json:"stability_score"`   // 100 without flaps, 0 at the threshold
+}
+
+// hostFlaps is the transition history of a host
+type hostFlaps struct {
+	quarantinedUntil time.Time
+	recent           []time.Time // transitions within the window
+	total            uint64
+}
+
+// flapTracker counts host transitions between serving and failing. The zero
+// value is ready to use.
+type flapTracker struct {
+	mu    sync.Mutex
+	hosts map[string]*hostFlaps // keyed by cluster and address
+}
+
+// record counts a transition of the host with key and returns its flaps
+// within window
+func (t *flapTracker) record(key string, now time.Time, window time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hosts == nil {
+		t.hosts = make(map[string]*hostFlaps)
+	}
+	host := t.hosts[key]
+	if host == nil {
+		host = &hostFlaps{}
+		t.hosts[key] = host
+	}
+	host.total++
+	host.recent = append(prune(host.recent, now.Add(-window)), now)
+	return len(host.recent)
+}
+
+// prune drops the times before since
+func prune(times []time.Time, since time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(since) {
+		i++
+	}
+	return times[i:]
+}
+
+// quarantine takes the host with key out of rotation until until. Its
+// history starts over, so it is not quarantined again as soon as it is back.
+func (t *flapTracker) quarantine(key string, until time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if host := t.hosts[key]; host != nil {
+		host.quarantinedUntil = until
+		host.recent = nil
+	}
+}
+
+// quarantined returns the hosts in quarantine at now
+func (t *flapTracker) quarantined(now time.Time) map[string]time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hosts := make(map[string]time.Time)
+	for key, host := range t.hosts {
+		if now.Before(host.quarantinedUntil) {
+			hosts[key] = host.quarantinedUntil
+		}
+	}
+	return hosts
+}
+
+// release ends the quarantines that are over at now and returns their hosts
+func (t *flapTracker) release(now time.Time) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var released []string
+	for key, host := range t.hosts {
+		if !host.quarantinedUntil.IsZero() && !now.Before(host.quarantinedUntil) {
+			host.quarantinedUntil = time.Time{}
+			released = append(released, key)
+		}
+	}
+	sort.Strings(released)
+	return released
+}
+
+// stability returns the flapping of every host that transitioned since the
+// agent started, sorted by cluster and address
+func (t *flapTracker) stability(now time.Time, cfg *FlapDetectionConfig) []BackendStability {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stability := make([]BackendStability, 0, len(t.hosts))
+	for key, host := range t.hosts {
+		host.recent = prune(host.recent, now.Add(-cfg.Window))
+		cluster, address := splitHostKey(key)
+		s := BackendStability{
+			Cluster:        cluster,
+			Address:        address,
+			Transitions:    host.total,
+			Flaps:          len(host.recent),
+			StabilityScore: stabilityScore(len(host.recent), cfg.Threshold),
+		}
+		if now.Before(host.quarantinedUntil) {
+			until := host.quarantinedUntil
+			s.QuarantinedUntil = &until
+		}
+		stability = append(stability, s)
+	}
+	sort.Slice(stability, func(i, j int) bool {
+		if stability[i].Cluster != stability[j].Cluster {
+			return stability[i].Cluster < stability[j].Cluster
+		}
+		return stability[i].Address < stability[j].Address
+	})
+	return stability
+}
+
+// stabilityScore scores flaps within the window from 100 (none) down to 0
+// (threshold or more)
+func stabilityScore(flaps, threshold int) int {
+	if flaps >= threshold {
+		return 0
+	}
+	return 100 - 100*flaps/threshold
+}
+
+// splitHostKey splits a host key into cluster and address
+func splitHostKey(key string) (cluster, address string) {
+	i := strings.LastIndex(key, "/")
+	return key[:i], key[i+1:]
+}
+
+// recordFlap counts a transition of a host and quarantines it when it flaps
+// too often and quarantine is enabled
+func (a *Agent) recordFlap(ctx context.Context, key string, now time.Time) {
+	cfg := a.currentConfig().FlapDetection
+	flaps := a.flaps.record(key, now, cfg.Window)
+	if !cfg.Quarantine || flaps < cfg.Threshold {
+		return
+	}
+
+	cluster, address := splitHostKey(key)
+	if err := a.canQuarantine(key, now); err != nil {
+		log.Printf("Warning: Not quarantining flapping backend %s of cluster %s: %v", address, cluster, err)
+		return
+	}
+	until := now.Add(cfg.QuarantineDuration)
+	a.flaps.quarantine(key, until)
+	message := fmt.Sprintf("Backend %s of cluster %s quarantined until %s after %d health transitions within %s", address, cluster, until.UTC().Format(time.RFC3339), flaps, cfg.Window)
+	log.Print(message)
+	a.sendEvent(ctx, NewEvent(EventBackendQuarantined, message, map[string]interface{}{
+		"cluster":           cluster,
+		"address":           address,
+		"flaps":             flaps,
+		"quarantined_until": until.UTC().Format(time.RFC3339),
+	}))
+	a.TriggerSync()
+}
+
+// canQuarantine checks that the host with key is a backend of the applied
+// configuration, and that its cluster keeps another backend in rotation
+// without it. Hosts resolved from a hostname are not backends by themselves.
+func (a *Agent) canQuarantine(key string, now time.Time) error {
+	lb := a.lastApplied.Load()
+	if lb == nil {
+		return errors.New("no configuration has been applied yet")
+	}
+	quarantined := a.flaps.quarantined(now)
+	found, others := false, 0
+	forEachBackend(lb, func(backendKey string, backend *models.Backend) {
+		switch {
+		case backendKey == key:
+			found = true
+		case backend.Enabled && strings.HasPrefix(backendKey, clusterOf(key)+"/"):
+			if _, ok := quarantined[backendKey]; !ok {
+				others++
+			}
+		}
+	})
+	switch {
+	case !found:
+		return errors.New("it is not a backend address of the applied configuration")
+	case others == 0:
+		return errors.New("it is the last backend of its cluster in rotation")
+	}
+	return nil
+}
+
+// clusterOf returns the cluster of a host key
+func clusterOf(key string) string {
+	cluster, _ := splitHostKey(key)
+	return cluster
+}
+
+// forEachBackend calls fn with the host key of every backend of lb, in the
+// load balancer's own pool and in the named pools
+func forEachBackend(lb *models.LoadBalancer, fn func(key string, backend *models.Backend)) {
+	visit := func(pool string, backends []models.Backend) {
+		cluster := envoy.ClusterName(lb, pool)
+		for i := range backends {
+			address := net.JoinHostPort(backends[i].Address, fmt.Sprint(backends[i].Port))
+			fn(cluster+"/"+address, &backends[i])
+		}
+	}
+	visit("", lb.Backends)
+	for i := range lb.Pools {
+		visit(lb.Pools[i].Name, lb.Pools[i].Backends)
+	}
+}
+
+// applyQuarantine disables the backends of lb that are in quarantine
+func (a *Agent) applyQuarantine(lb *models.LoadBalancer) {
+	quarantined := a.flaps.quarantined(time.Now())
+	if len(quarantined) == 0 {
+		return
+	}
+	forEachBackend(lb, func(key string, backend *models.Backend) {
+		if _, ok := quarantined[key]; ok && backend.Enabled {
+			backend.Enabled = false
+		}
+	})
+}
+
+// releaseQuarantines puts hosts whose quarantine is over back into rotation
+func (a *Agent) releaseQuarantines(ctx context.Context, now time.Time) {
+	released := a.flaps.release(now)
+	for _, key := range released {
+		cluster, address := splitHostKey(key)
+		message := fmt.Sprintf("Backend %s of cluster %s released from quarantine", address, cluster)
+		log.Print(message)
+		a.sendEvent(ctx, NewEvent(EventBackendReleased, message, map[string]interface{}{
+			"cluster": cluster,
+			"address": address,
+		}))
+	}
+	if len(released) > 0 {
+		a.TriggerSync()
+	}
+}
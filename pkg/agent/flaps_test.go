@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestFlapTracker_Stability(t *testing.T) {
+	cfg := &FlapDetectionConfig{Window: time.Hour, Threshold: 4}
+	var tracker flapTracker
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		tracker.record("lb-1/10.0.0.1:80", start.Add(time.Duration(i)*time.Minute), cfg.Window)
+	}
+	tracker.record("lb-1/10.0.0.2:80", start, cfg.Window)
+
+	stability := tracker.stability(start.Add(10*time.Minute), cfg)
+	if len(stability) != 2 || stability[0].Address != "10.0.0.1:80" || stability[0].Cluster != "lb-1" {
+		t.Fatalf("stability = %+v, want both hosts sorted by address", stability)
+	}
+	if s := stability[0]; s.Flaps != 3 || s.Transitions != 3 || s.StabilityScore != 25 {
+		t.Errorf("10.0.0.1:80 = %+v, want 3 flaps scoring 25", s)
+	}
+	if s := stability[1]; s.StabilityScore != 75 {
+		t.Errorf("10.0.0.2:80 score = %d, want 75", s.StabilityScore)
+	}
+
+	// Flaps leave the window, the total stays
+	stability = tracker.stability(start.Add(2*time.Hour), cfg)
+	if s := stability[0]; s.Flaps != 0 || s.Transitions != 3 || s.StabilityScore != 100 {
+		t.Errorf("10.0.0.1:80 after the window = %+v, want a score of 100 and 3 transitions", s)
+	}
+}
+
+func TestAgent_Quarantine(t *testing.T) {
+	reporter := &recordingReporter{}
+	a := &Agent{
+		config: &Config{FlapDetection: FlapDetectionConfig{Window: time.Hour, Threshold: 3, Quarantine: true, QuarantineDuration: time.Minute}},
+		events: reporter,
+		syncCh: make(chan struct{}, 1),
+	}
+	lb := func() *models.LoadBalancer {
+		return &models.LoadBalancer{
+			ID: "lb-1",
+			Backends: []models.Backend{
+				{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true},
+				{ID: "be-2", Address: "10.0.0.2", Port: 80, Enabled: true},
+			},
+		}
+	}
+	a.lastApplied.Store(lb())
+	cluster := envoy.ClusterName(lb(), "")
+	quarantines := func() int {
+		n := 0
+		for _, event := range reporter.events {
+			if event == string(EventBackendQuarantined) {
+				n++
+			}
+		}
+		return n
+	}
+	// flap moves address between healthy and unhealthy n times, next to a
+	// healthy host
+	flap := func(address string, n int) {
+		var last map[string]string
+		for i := 0; i <= n; i++ {
+			health := envoy.HostHealthy
+			if i%2 == 1 {
+				health = envoy.HostUnhealthy
+			}
+			last = a.reportHealthChanges(context.Background(), last, []envoy.HostStatus{
+				{Cluster: cluster, Address: address, Health: health},
+				{Cluster: cluster, Address: "10.0.0.9:80", Health: envoy.HostHealthy},
+			})
+		}
+	}
+
+	flap("10.0.0.1:80", 3)
+	if !strings.HasSuffix(strings.Join(reporter.events, ","), "backend_healthy,backend_unhealthy,backend_quarantined") {
+		t.Fatalf("events = %v, want the host quarantined on the third transition", reporter.events)
+	}
+	if len(a.syncCh) != 1 {
+		t.Error("quarantine did not trigger a sync")
+	}
+
+	applied := lb()
+	a.applyQuarantine(applied)
+	if applied.Backends[0].Enabled || !applied.Backends[1].Enabled {
+		t.Errorf("backends = %+v, want only be-1 disabled", applied.Backends)
+	}
+
+	// The last backend in rotation stays
+	a.lastApplied.Store(applied)
+	flap("10.0.0.2:80", 3)
+	if quarantines() != 1 {
+		t.Error("the last backend in rotation was quarantined")
+	}
+
+	var metrics strings.Builder
+	a.writeFlapMetrics(&metrics)
+	if want := `vpsie_lb_backend_quarantined{cluster="` + cluster + `",address="10.0.0.1:80"} 1`; !strings.Contains(metrics.String(), want) {
+		t.Errorf("metrics do not contain %s:\n%s", want, metrics.String())
+	}
+
+	// Released once the quarantine is over
+	a.releaseQuarantines(context.Background(), time.Now().Add(2*time.Minute))
+	if got := reporter.events[len(reporter.events)-1]; got != string(EventBackendReleased) {
+		t.Errorf("last event = %s, want backend_released", got)
+	}
+	applied = lb()
+	a.applyQuarantine(applied)
+	if !applied.Backends[0].Enabled {
+		t.Error("be-1 is still disabled after its release")
+	}
+}
@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/gslb"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ha"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// GSLBConfig configures the exchange of region health summaries with the
+// load balancers of other regions behind the same name, for VPSie DNS
+// steering
+type GSLBConfig struct {
+	Enabled           bool          `yaml:"enabled"`
+	Group             string        `yaml:"group"`               // GSLB group shared by the load balancers of all regions
+	Region            string        `yaml:"region"`              // default envoy.locality.region
+	Interval          time.Duration `yaml:"interval"`            // how often the region is checked and published, default 15s
+	Rise              int           `yaml:"rise"`                // passed checks in a row that mark a degraded region healthy, default 3
+	Fall              int           `yaml:"fall"`                // failed checks in a row that mark a healthy region degraded, default 2
+	MinHealthyPercent int           `yaml:"min_healthy_percent"` // percent of backends that must be healthy, 0 = any one
+}
+
+// Default GSLB settings applied by LoadConfig
+const (
+	defaultGSLBInterval = 15 * time.Second
+	defaultGSLBRise     = 3
+	defaultGSLBFall     = 2
+)
+
+// GSLB bounds enforced by validate
+const (
+	minGSLBInterval = 5 * time.Second
+	maxGSLBInterval = 5 * time.Minute
+	maxGSLBChecks   = 10
+)
+
+// setDefaults fills in unset GSLB settings; the region defaults to the
+// locality region of this node
+func (c *GSLBConfig) setDefaults(localityRegion string) {
+	if c.Region == "" {
+		c.Region = localityRegion
+	}
+	if c.Interval == 0 {
+		c.Interval = defaultGSLBInterval
+	}
+	if c.Rise == 0 {
+		c.Rise = defaultGSLBRise
+	}
+	if c.Fall == 0 {
+		c.Fall = defaultGSLBFall
+	}
+}
+
+// validate checks the GSLB settings
+func (c *GSLBConfig) validate() []error {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []error
+	if !idPattern.MatchString(c.Group) {
+		errs = append(errs, fmt.Errorf("gslb.group %q is required and may only contain letters, digits, '-' and '_'", c.Group))
+	}
+	if c.Region == "" {
+		errs = append(errs, fmt.Errorf("gslb.region is required when envoy.locality.region is not set"))
+	} else if !models.LocalityRegex.MatchString(c.Region) {
+		errs = append(errs, fmt.Errorf("gslb.region %q is invalid: must be letters, digits, '.', '_' or '-'", c.Region))
+	}
+	if c.Interval < minGSLBInterval || c.Interval > maxGSLBInterval {
+		errs = append(errs, fmt.Errorf("gslb.interval %s is out of range: must be between %s and %s", c.Interval, minGSLBInterval, maxGSLBInterval))
+	}
+	if c.Rise < 1 || c.Rise > maxGSLBChecks {
+		errs = append(errs, fmt.Errorf("gslb.rise %d must be between 1 and %d", c.Rise, maxGSLBChecks))
+	}
+	if c.Fall < 1 || c.Fall > maxGSLBChecks {
+		errs = append(errs, fmt.Errorf("gslb.fall %d must be between 1 and %d", c.Fall, maxGSLBChecks))
+	}
+	if c.MinHealthyPercent < 0 || c.MinHealthyPercent > 100 {
+		errs = append(errs, fmt.Errorf("gslb.min_healthy_percent %d must be between 0 and 100", c.MinHealthyPercent))
+	}
+	return errs
+}
+
+// PublishRegionHealth publishes the health summary of this region to the GSLB group
+func (c *VPSieClient) PublishRegionHealth(ctx context.Context, group string, summary *gslb.Summary) error {
+	reqURL := fmt.Sprintf("%s/gslb/%s/regions/%s", c.baseURL, sanitizeID(group), sanitizeID(summary.Region))
+	return c.doJSON(ctx, http.MethodPut, reqURL, summary, nil)
+}
+
+// RegionHealth returns the health summaries published by the regions of the GSLB group
+func (c *VPSieClient) RegionHealth(ctx context.Context, group string) ([]gslb.Summary, error) {
+	reqURL := fmt.Sprintf("%s/gslb/%s/regions", c.baseURL, sanitizeID(group))
+	var summaries []gslb.Summary
+	if err := c.doJSON(ctx, http.MethodGet, reqURL, nil, &summaries); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// newGSLBCoordinator creates the coordinator publishing region health
+// through the VPSie API. Status changes are reported as events.
+func (a *Agent) newGSLBCoordinator(cfg *Config) (*gslb.Coordinator, error) {
+	client, ok := a.source.(*VPSieClient)
+	if !ok {
+		return nil, fmt.Errorf("gslb requires the VPSie API source")
+	}
+	return gslb.NewCoordinator(gslb.Settings{
+		Group:          cfg.GSLB.Group,
+		Region:         cfg.GSLB.Region,
+		LoadBalancerID: cfg.VPSie.LoadBalancerID,
+		Rise:           cfg.GSLB.Rise,
+		Fall:           cfg.GSLB.Fall,
+	}, client, a.eventFunc()), nil
+}
+
+// runGSLB publishes the health of this region while this node is active
+func (a *Agent) runGSLB(ctx context.Context, cfg GSLBConfig) {
+	log.Printf("GSLB enabled (group: %s, region: %s)", cfg.Group, cfg.Region)
+	a.gslb.Run(ctx, cfg.Interval, func() bool { return a.Role() == ha.RoleActive }, func(ctx context.Context) gslb.Observation {
+		var obs gslb.Observation
+		obs.Weight, obs.Reason = a.checkHealth(ctx, a.lastApplied.Load()).Evaluate(cfg.MinHealthyPercent)
+		return obs
+	})
+}
+
+// handleGSLBStatus serves the published status of this region and the
+// statuses of the other regions
+func (a *Agent) handleGSLBStatus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if a.gslb == nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"enabled": false})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"enabled": true, "status": a.gslb.Status()})
+}
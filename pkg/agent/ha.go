@@ -0,0 +1,292 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ha"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/network"
+)
+
+// HA modes
+const (
+	// HAModeVRRP follows the VRRP state reported by keepalived
+	HAModeVRRP = "vrrp"
+	// HAModeLease elects the holder of a lease in the VPSie API; the other
+	// agent stands by without reconciling
+	HAModeLease = "lease"
+)
+
+// HAConfig configures the active/passive pair
+type HAConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	Mode         string        `yaml:"mode"`          // vrrp (default) or lease
+	StateFile    string        `yaml:"state_file"`    // written by the keepalived notify script (vrrp mode)
+	PollInterval time.Duration `yaml:"poll_interval"` // how often the state is checked (vrrp mode)
+	LeaseTTL     time.Duration `yaml:"lease_ttl"`     // lease duration, renewed every third (lease mode)
+	NodeID       string        `yaml:"node_id"`       // lease holder and node in failover events; defaults to the hostname
+
+	FloatingIP  FloatingIPConfig  `yaml:"floating_ip"`
+	SessionSync SessionSyncConfig `yaml:"session_sync"`
+}
+
+// Floating IP assignment modes
+const (
+	// FloatingIPAssignLocal only binds the address; the network already routes it to both nodes
+	FloatingIPAssignLocal = "local"
+	// FloatingIPAssignAPI asks VPSie to route the address to the active node before binding it
+	FloatingIPAssignAPI = "api"
+)
+
+// FloatingIPConfig configures the floating IP owned by the active node
+type FloatingIPConfig struct {
+	Address   string `yaml:"address"`   // empty disables floating IP management
+	Interface string `yaml:"interface"` // defaults to eth0
+	Assign    string `yaml:"assign"`    // local (default) or api
+}
+
+// Default HA settings applied by LoadConfig
+const (
+	defaultHAStateFile    = "/var/run/vpsie-lb/vrrp-state"
+	defaultHAPollInterval = time.Second
+	defaultHALeaseTTL     = 15 * time.Second
+
+	defaultFloatingIPInterface = "eth0"
+)
+
+// setDefaults fills in unset HA settings
+func (h *HAConfig) setDefaults() {
+	if h.Mode == "" {
+		h.Mode = HAModeVRRP
+	}
+	if h.StateFile == "" {
+		h.StateFile = defaultHAStateFile
+	}
+	if h.PollInterval == 0 {
+		h.PollInterval = defaultHAPollInterval
+	}
+	if h.LeaseTTL == 0 {
+		h.LeaseTTL = defaultHALeaseTTL
+	}
+	if h.FloatingIP.Address != "" {
+		if h.FloatingIP.Interface == "" {
+			h.FloatingIP.Interface = defaultFloatingIPInterface
+		}
+		if h.FloatingIP.Assign == "" {
+			h.FloatingIP.Assign = FloatingIPAssignLocal
+		}
+	}
+	h.SessionSync.setDefaults(h.FloatingIP.Interface)
+	if h.NodeID == "" {
+		if hostname, err := os.Hostname(); err == nil {
+			h.NodeID = hostname
+		}
+	}
+}
+
+// validate checks the HA settings
+func (h *HAConfig) validate() []error {
+	if !h.Enabled {
+		return nil
+	}
+
+	var errs []error
+	switch h.Mode {
+	case HAModeVRRP:
+		if h.StateFile == "" {
+			errs = append(errs, fmt.Errorf("ha.state_file is required when ha.mode is %q", HAModeVRRP))
+		}
+	case HAModeLease:
+		if h.LeaseTTL < 3*time.Second {
+			errs = append(errs, fmt.Errorf("ha.lease_ttl %s is too short: must be at least 3s", h.LeaseTTL))
+		}
+		if h.NodeID == "" {
+			errs = append(errs, fmt.Errorf("ha.node_id is required when ha.mode is %q", HAModeLease))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("ha.mode %q is invalid: must be %q or %q", h.Mode, HAModeVRRP, HAModeLease))
+	}
+	if h.PollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("ha.poll_interval must be positive, got %s", h.PollInterval))
+	}
+
+	if fip := h.FloatingIP; fip.Address != "" {
+		if _, err := network.NewFloatingIP(fip.Address, fip.Interface, nil); err != nil {
+			errs = append(errs, fmt.Errorf("ha.floating_ip: %w", err))
+		}
+		if fip.Assign != FloatingIPAssignLocal && fip.Assign != FloatingIPAssignAPI {
+			errs = append(errs, fmt.Errorf("ha.floating_ip.assign %q is invalid: must be %q or %q",
+				fip.Assign, FloatingIPAssignLocal, FloatingIPAssignAPI))
+		}
+	}
+	return errs
+}
+
+// newElector creates the elector for the configured HA mode
+func (a *Agent) newElector(cfg *HAConfig) (ha.Elector, error) {
+	switch cfg.Mode {
+	case HAModeVRRP:
+		return ha.NewVRRPElector(cfg.StateFile, cfg.PollInterval)
+	case HAModeLease:
+		client, ok := a.source.(ha.LeaseClient)
+		if !ok {
+			return nil, fmt.Errorf("HA mode %q requires the VPSie API source", HAModeLease)
+		}
+		return ha.NewLeaseElector(client, cfg.NodeID, cfg.LeaseTTL)
+	default:
+		return nil, fmt.Errorf("unsupported HA mode: %s", cfg.Mode)
+	}
+}
+
+// Role returns the HA role of this node. Without HA the node is always active.
+func (a *Agent) Role() ha.Role {
+	if role, ok := a.role.Load().(ha.Role); ok {
+		return role
+	}
+	return ha.RoleActive
+}
+
+// floatingIPAssigner routes the floating IP to this node through the VPSie API
+type floatingIPAssigner struct {
+	client *VPSieClient
+	nodeID string
+}
+
+// AssignFloatingIP implements network.Assigner
+func (f floatingIPAssigner) AssignFloatingIP(ctx context.Context, address string) error {
+	return f.client.AssignFloatingIP(ctx, address, f.nodeID)
+}
+
+// newFloatingIP creates the floating IP manager, or nil when none is configured
+func (a *Agent) newFloatingIP(cfg *HAConfig) (*network.FloatingIP, error) {
+	fip := cfg.FloatingIP
+	if fip.Address == "" {
+		return nil, nil
+	}
+
+	var assigner network.Assigner
+	if fip.Assign == FloatingIPAssignAPI {
+		client, ok := a.source.(*VPSieClient)
+		if !ok {
+			return nil, fmt.Errorf("floating IP assignment %q requires the VPSie API source", FloatingIPAssignAPI)
+		}
+		assigner = floatingIPAssigner{client: client, nodeID: cfg.NodeID}
+	}
+	return network.NewFloatingIP(fip.Address, fip.Interface, assigner)
+}
+
+// releaseFloatingIP unbinds the floating IP on shutdown
+func (a *Agent) releaseFloatingIP() {
+	if a.floatingIP == nil || !a.floatingIP.Held() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.floatingIP.Release(ctx); err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	log.Printf("Floating IP %s released", a.floatingIP.Address())
+}
+
+// updateFloatingIP binds the floating IP when this node becomes active and
+// releases it when it stops being active
+func (a *Agent) updateFloatingIP(ctx context.Context, role ha.Role) {
+	if a.floatingIP == nil {
+		return
+	}
+
+	cfg := a.currentConfig()
+	if role == ha.RoleActive {
+		if err := a.floatingIP.Acquire(ctx); err != nil {
+			log.Printf("Warning: %v", err)
+			a.sendEvent(ctx, NewEvent(EventFloatingIPFailed, err.Error(), map[string]interface{}{
+				"node_id": cfg.HA.NodeID,
+				"address": a.floatingIP.Address(),
+			}))
+			return
+		}
+		log.Printf("Floating IP %s bound on %s", a.floatingIP.Address(), cfg.HA.FloatingIP.Interface)
+		return
+	}
+
+	if a.floatingIP.Held() {
+		if err := a.floatingIP.Release(ctx); err != nil {
+			log.Printf("Warning: %v", err)
+			return
+		}
+		log.Printf("Floating IP %s released", a.floatingIP.Address())
+	}
+}
+
+// standingBy reports whether this node must not reconcile. In lease mode
+// only the lease holder touches Envoy; in VRRP mode the passive node keeps
+// its configuration in sync for a fast takeover.
+func (a *Agent) standingBy() bool {
+	cfg := a.currentConfig()
+	return cfg.HA.Enabled && cfg.HA.Mode == HAModeLease && a.Role() != ha.RoleActive
+}
+
+// runHA follows the elector until ctx is cancelled
+func (a *Agent) runHA(ctx context.Context, elector ha.Elector) {
+	if err := elector.Run(ctx, func(role ha.Role) { a.setRole(ctx, role) }); err != nil {
+		log.Printf("Warning: HA elector stopped: %v", err)
+	}
+}
+
+// setRole records a role change, reports it to VPSie and claims the active
+// status when this node takes over
+func (a *Agent) setRole(ctx context.Context, role ha.Role) {
+	previous, ok := a.role.Load().(ha.Role)
+	if !ok {
+		previous = ha.RoleUnknown
+	}
+	a.role.Store(role)
+	if previous == role {
+		return
+	}
+
+	cfg := a.currentConfig()
+	log.Printf("HA role changed: %s -> %s", previous, role)
+
+	a.updateFloatingIP(ctx, role)
+	a.updateSessionSync(ctx, role)
+
+	a.sendEvent(ctx, NewEvent(EventHAFailover, fmt.Sprintf("HA role changed from %s to %s", previous, role), map[string]interface{}{
+		"node_id":  cfg.HA.NodeID,
+		"previous": string(previous),
+		"role":     string(role),
+	}))
+
+	// Only the active node reports status; the passive node stays silent so
+	// the pair never reports conflicting states
+	if role != ha.RoleActive {
+		return
+	}
+
+	// A node taking over the lease reconciles right away instead of waiting
+	// for the next poll
+	if cfg.HA.Mode == HAModeLease {
+		a.TriggerSync()
+	}
+
+	// The other node may have reported a status of its own
+	a.forgetStatus()
+	a.reportStatus(ctx)
+}
+
+// handleHAStatus reports the HA role of this node
+func (a *Agent) handleHAStatus(w http.ResponseWriter, _ *http.Request) {
+	cfg := a.currentConfig()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled": cfg.HA.Enabled,
+		"node_id": cfg.HA.NodeID,
+		"role":    string(a.Role()),
+	})
+}
@@ -0,0 +1,190 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ha"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// recordingReporter records events and status updates
+type recordingReporter struct {
+	mu       sync.Mutex
+	events   []string
+	sent     []Event
+	statuses []LoadBalancerStatus
+	reports  []StatusReport
+}
+
+func (r *recordingReporter) SendEvent(_ context.Context, event Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, string(event.Type))
+	r.sent = append(r.sent, event)
+	return nil
+}
+
+func (r *recordingReporter) UpdateLoadBalancerStatus(_ context.Context, report StatusReport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses = append(r.statuses, report.Status)
+	r.reports = append(r.reports, report)
+	return nil
+}
+
+func TestAgent_SetRole(t *testing.T) {
+	reporter := &recordingReporter{}
+	a := &Agent{config: &Config{HA: HAConfig{Enabled: true, NodeID: "lb-a"}}, events: reporter}
+	a.lastApplied.Store(&models.LoadBalancer{ID: "lb-1"})
+
+	a.setRole(context.Background(), ha.RolePassive)
+	a.setRole(context.Background(), ha.RolePassive) // unchanged: no event
+	a.setRole(context.Background(), ha.RoleActive)
+	a.setRole(context.Background(), ha.RoleFault)
+
+	if a.Role() != ha.RoleFault {
+		t.Errorf("Role() = %v, want %v", a.Role(), ha.RoleFault)
+	}
+	if len(reporter.events) != 3 {
+		t.Errorf("events = %v, want 3 failover events", reporter.events)
+	}
+	for _, e := range reporter.events {
+		if e != "ha_failover" {
+			t.Errorf("event type = %q, want ha_failover", e)
+		}
+	}
+	if len(reporter.statuses) != 1 || reporter.statuses[0] != "active" {
+		t.Errorf("statuses = %v, want only [active]", reporter.statuses)
+	}
+}
+
+func TestAgent_Role_HADisabled(t *testing.T) {
+	a := &Agent{}
+	if a.Role() != ha.RoleActive {
+		t.Errorf("Role() = %v, want %v without HA", a.Role(), ha.RoleActive)
+	}
+}
+
+func TestAgent_HandleHAStatus(t *testing.T) {
+	a := &Agent{config: &Config{HA: HAConfig{Enabled: true, NodeID: "lb-a"}}, events: &recordingReporter{}}
+	a.setRole(context.Background(), ha.RolePassive)
+
+	rec := httptest.NewRecorder()
+	a.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ha/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if body["role"] != "passive" || body["node_id"] != "lb-a" {
+		t.Errorf("body = %v", body)
+	}
+}
+
+func TestHAConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     HAConfig
+		wantErr bool
+	}{
+		{name: "disabled", cfg: HAConfig{Mode: "bogus"}, wantErr: false},
+		{name: "vrrp", cfg: HAConfig{Enabled: true, Mode: HAModeVRRP, StateFile: "/run/state", PollInterval: 1}, wantErr: false},
+		{name: "unknown mode", cfg: HAConfig{Enabled: true, Mode: "bogus", PollInterval: 1}, wantErr: true},
+		{name: "missing state file", cfg: HAConfig{Enabled: true, Mode: HAModeVRRP, PollInterval: 1}, wantErr: true},
+		{name: "zero poll interval", cfg: HAConfig{Enabled: true, Mode: HAModeVRRP, StateFile: "/run/state"}, wantErr: true},
+		{name: "lease", cfg: HAConfig{Enabled: true, Mode: HAModeLease, LeaseTTL: 15 * time.Second, NodeID: "lb-a", PollInterval: 1}, wantErr: false},
+		{name: "lease ttl too short", cfg: HAConfig{Enabled: true, Mode: HAModeLease, LeaseTTL: time.Second, NodeID: "lb-a", PollInterval: 1}, wantErr: true},
+		{name: "floating ip", cfg: HAConfig{Enabled: true, Mode: HAModeVRRP, StateFile: "/run/state", PollInterval: 1,
+			FloatingIP: FloatingIPConfig{Address: "203.0.113.10", Interface: "eth0", Assign: FloatingIPAssignAPI}}, wantErr: false},
+		{name: "invalid floating ip", cfg: HAConfig{Enabled: true, Mode: HAModeVRRP, StateFile: "/run/state", PollInterval: 1,
+			FloatingIP: FloatingIPConfig{Address: "203.0.113.10/32", Interface: "eth0", Assign: FloatingIPAssignLocal}}, wantErr: true},
+		{name: "invalid floating ip assign", cfg: HAConfig{Enabled: true, Mode: HAModeVRRP, StateFile: "/run/state", PollInterval: 1,
+			FloatingIP: FloatingIPConfig{Address: "203.0.113.10", Interface: "eth0", Assign: "bgp"}}, wantErr: true},
+		{name: "lease without node id", cfg: HAConfig{Enabled: true, Mode: HAModeLease, LeaseTTL: 15 * time.Second, PollInterval: 1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := tt.cfg.validate()
+			if (len(errs) > 0) != tt.wantErr {
+				t.Errorf("validate() = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAgent_StandingBy(t *testing.T) {
+	tests := []struct {
+		name string
+		ha   HAConfig
+		role ha.Role
+		want bool
+	}{
+		{name: "HA disabled", ha: HAConfig{}, role: "", want: false},
+		{name: "lease holder", ha: HAConfig{Enabled: true, Mode: HAModeLease}, role: ha.RoleActive, want: false},
+		{name: "lease standby", ha: HAConfig{Enabled: true, Mode: HAModeLease}, role: ha.RolePassive, want: true},
+		{name: "lease undecided", ha: HAConfig{Enabled: true, Mode: HAModeLease}, role: ha.RoleUnknown, want: true},
+		{name: "vrrp passive keeps syncing", ha: HAConfig{Enabled: true, Mode: HAModeVRRP}, role: ha.RolePassive, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Agent{config: &Config{HA: tt.ha}}
+			if tt.role != "" {
+				a.role.Store(tt.role)
+			}
+			if got := a.standingBy(); got != tt.want {
+				t.Errorf("standingBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAgent_NewElector_LeaseRequiresAPI(t *testing.T) {
+	a := &Agent{source: &FileSource{path: "/tmp/lb.yaml"}}
+	if _, err := a.newElector(&HAConfig{Mode: HAModeLease, NodeID: "lb-a", LeaseTTL: 15 * time.Second}); err == nil {
+		t.Error("Expected error for lease mode with a file source")
+	}
+}
+
+func TestAgent_NewFloatingIP(t *testing.T) {
+	apiClient, _ := NewVPSieClient("test-key", "https://api.test.com", "lb-123")
+
+	tests := []struct {
+		name    string
+		source  ConfigSource
+		fip     FloatingIPConfig
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "not configured", source: apiClient, wantNil: true},
+		{name: "local", source: &FileSource{path: "/tmp/lb.yaml"},
+			fip: FloatingIPConfig{Address: "203.0.113.10", Interface: "eth0", Assign: FloatingIPAssignLocal}},
+		{name: "api", source: apiClient,
+			fip: FloatingIPConfig{Address: "203.0.113.10", Interface: "eth0", Assign: FloatingIPAssignAPI}},
+		{name: "api without API source", source: &FileSource{path: "/tmp/lb.yaml"},
+			fip: FloatingIPConfig{Address: "203.0.113.10", Interface: "eth0", Assign: FloatingIPAssignAPI}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Agent{source: tt.source}
+			fip, err := a.newFloatingIP(&HAConfig{NodeID: "lb-a", FloatingIP: tt.fip})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newFloatingIP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (fip == nil) != tt.wantNil {
+				t.Errorf("newFloatingIP() = %v, wantNil %v", fip, tt.wantNil)
+			}
+		})
+	}
+}
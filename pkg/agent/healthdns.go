@@ -0,0 +1,217 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ha"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/healthdns"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// HealthDNSConfig configures the DNS responder that answers with the load
+// balancer addresses only while the load balancer is healthy, for GSLB and
+// DNS failover across regions
+type HealthDNSConfig struct {
+	Enabled           bool          `yaml:"enabled"`
+	ListenAddress     string        `yaml:"listen_address"`      // UDP and TCP, default :53
+	Name              string        `yaml:"name"`                // name answered, e.g. lb.eu-west.example.com
+	TTL               time.Duration `yaml:"ttl"`                 // TTL of the answers, default 10s
+	Addresses         []string      `yaml:"addresses"`           // answered while healthy; default the HA floating IP, else the load balancer addresses
+	MinHealthyPercent int           `yaml:"min_healthy_percent"` // percent of backends that must be healthy, 0 = any one
+	CheckInterval     time.Duration `yaml:"check_interval"`      // default 5s
+}
+
+// Default health DNS settings applied by LoadConfig
+const (
+	defaultHealthDNSListenAddress = ":53"
+	defaultHealthDNSTTL           = 10 * time.Second
+	defaultHealthDNSCheckInterval = 5 * time.Second
+)
+
+// Health DNS bounds enforced by validate
+const (
+	maxHealthDNSTTL         = time.Hour
+	minHealthDNSCheckPeriod = time.Second
+)
+
+// dnsNamePattern matches a fully qualified domain name, with an optional
+// trailing dot
+var dnsNamePattern = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]{2,63}\.?$`)
+
+// setDefaults fills in unset health DNS settings
+func (c *HealthDNSConfig) setDefaults() {
+	if c.ListenAddress == "" {
+		c.ListenAddress = defaultHealthDNSListenAddress
+	}
+	if c.TTL == 0 {
+		c.TTL = defaultHealthDNSTTL
+	}
+	if c.CheckInterval == 0 {
+		c.CheckInterval = defaultHealthDNSCheckInterval
+	}
+}
+
+// validate checks the health DNS settings
+func (c *HealthDNSConfig) validate() []error {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []error
+	if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
+		errs = append(errs, fmt.Errorf("health_dns.listen_address %q must be host:port: %w", c.ListenAddress, err))
+	}
+	if len(c.Name) > 253 || !dnsNamePattern.MatchString(c.Name) {
+		errs = append(errs, fmt.Errorf("health_dns.name %q must be a fully qualified domain name", c.Name))
+	}
+	if c.TTL < time.Second || c.TTL > maxHealthDNSTTL {
+		errs = append(errs, fmt.Errorf("health_dns.ttl %s is out of range: must be between 1s and %s", c.TTL, maxHealthDNSTTL))
+	}
+	if len(c.Addresses) > models.MaxListenAddresses {
+		errs = append(errs, fmt.Errorf("health_dns.addresses has more than %d addresses", models.MaxListenAddresses))
+	}
+	for i, addr := range c.Addresses {
+		if ip, err := netip.ParseAddr(addr); err != nil || ip.IsUnspecified() {
+			errs = append(errs, fmt.Errorf("health_dns.addresses[%d] %q must be an IP address", i, addr))
+		}
+	}
+	if c.MinHealthyPercent < 0 || c.MinHealthyPercent > 100 {
+		errs = append(errs, fmt.Errorf("health_dns.min_healthy_percent %d must be between 0 and 100", c.MinHealthyPercent))
+	}
+	if c.CheckInterval < minHealthDNSCheckPeriod {
+		errs = append(errs, fmt.Errorf("health_dns.check_interval %s must be at least %s", c.CheckInterval, minHealthDNSCheckPeriod))
+	}
+	return errs
+}
+
+// newHealthDNS creates the health DNS responder
+func newHealthDNS(cfg *HealthDNSConfig) *healthdns.Responder {
+	return healthdns.NewResponder(cfg.Name, cfg.TTL, cfg.MinHealthyPercent)
+}
+
+// runHealthDNS serves the health DNS responder and checks the health of the
+// load balancer every check interval until ctx is cancelled
+func (a *Agent) runHealthDNS(ctx context.Context, cfg HealthDNSConfig) {
+	go func() {
+		log.Printf("Health DNS answering %s on %s", cfg.Name, cfg.ListenAddress)
+		if err := a.healthDNS.Serve(ctx, cfg.ListenAddress); err != nil {
+			log.Printf("Warning: Health DNS stopped: %v", err)
+		}
+	}()
+
+	ticker := time.NewTicker(cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		a.updateHealthDNS(ctx, &cfg)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// updateHealthDNS checks the health of the load balancer and reports changes
+func (a *Agent) updateHealthDNS(ctx context.Context, cfg *HealthDNSConfig) {
+	lb := a.lastApplied.Load()
+	check := a.checkHealth(ctx, lb)
+	status, changed := a.healthDNS.Update(check, healthDNSAddresses(cfg, a.currentConfig().HA.FloatingIP.Address, lb))
+	if !changed {
+		return
+	}
+
+	message := fmt.Sprintf("load balancer is healthy, answering %s with %v", cfg.Name, status.Addresses)
+	if !status.Healthy {
+		message = fmt.Sprintf("load balancer is unhealthy (%s), answering %s without addresses", status.Reason, cfg.Name)
+	}
+	log.Printf("Health DNS: %s", message)
+	a.sendEvent(ctx, NewEvent(EventHealthDNSChanged, message, map[string]interface{}{
+		"name":    cfg.Name,
+		"healthy": status.Healthy,
+		"weight":  status.Weight,
+		"reason":  status.Reason,
+	}))
+}
+
+// checkHealth checks that this node serves lb: it is the active node, Envoy
+// is live and the backends of lb are healthy
+func (a *Agent) checkHealth(ctx context.Context, lb *models.LoadBalancer) healthdns.Check {
+	if role := a.Role(); role != ha.RoleActive {
+		return healthdns.Check{Problem: fmt.Sprintf("node is %s", role)}
+	}
+	if lb == nil {
+		return healthdns.Check{Problem: "no configuration applied"}
+	}
+	info, err := a.envoyAdmin.ServerInfo(ctx)
+	if err != nil {
+		return healthdns.Check{Problem: "Envoy is unreachable"}
+	}
+	if info.State != "LIVE" {
+		return healthdns.Check{Problem: fmt.Sprintf("Envoy is %s", info.State)}
+	}
+
+	var check healthdns.Check
+	pools := make([]string, 0, len(lb.Pools)+1)
+	if lb.HasDefaultPool() {
+		pools = append(pools, "")
+	}
+	for i := range lb.Pools {
+		pools = append(pools, lb.Pools[i].Name)
+	}
+	for _, pool := range pools {
+		stats, err := a.envoyAdmin.ClusterStats(ctx, envoy.ClusterName(lb, pool))
+		if err != nil {
+			return healthdns.Check{Problem: "backend health is unavailable"}
+		}
+		check.HealthyBackends += stats.HealthyMembers
+		check.TotalBackends += stats.TotalMembers
+	}
+	return check
+}
+
+// healthDNSAddresses returns the addresses answered while the load balancer
+// is healthy: the configured addresses, else the floating IP, else the IP
+// addresses the load balancer listens on
+func healthDNSAddresses(cfg *HealthDNSConfig, floatingIP string, lb *models.LoadBalancer) []netip.Addr {
+	candidates := cfg.Addresses
+	if len(candidates) == 0 && floatingIP != "" {
+		candidates = []string{floatingIP}
+	}
+	if len(candidates) == 0 && lb != nil {
+		candidates = lb.Addresses
+	}
+
+	addrs := make([]netip.Addr, 0, len(candidates))
+	for _, candidate := range candidates {
+		addr, err := netip.ParseAddr(candidate)
+		if err != nil || addr.IsUnspecified() {
+			continue
+		}
+		addrs = append(addrs, addr.Unmap())
+	}
+	return addrs
+}
+
+// handleHealthDNSStatus serves the health signal answered by the health DNS
+// responder. It answers 503 while the load balancer is unhealthy, so HTTP
+// health checks of a GSLB can use it as well.
+func (a *Agent) handleHealthDNSStatus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if a.healthDNS == nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"enabled": false})
+		return
+	}
+	status := a.healthDNS.Status()
+	if !status.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"enabled": true, "status": status})
+}
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ha"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestAgent_HealthDNS(t *testing.T) {
+	state, healthy := "LIVE", 2
+	envoyAdmin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/server_info":
+			fmt.Fprintf(w, `{"state": %q}`, state)
+		case "/stats":
+			fmt.Fprintf(w, `{"stats": [
+				{"name": "cluster.cluster_lb-1.membership_healthy", "value": %d},
+				{"name": "cluster.cluster_lb-1.membership_total", "value": 4}
+			]}`, healthy)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer envoyAdmin.Close()
+
+	cfg := &Config{HealthDNS: HealthDNSConfig{Enabled: true, Name: "lb.eu-west.example.com", MinHealthyPercent: 50}}
+	cfg.HealthDNS.setDefaults()
+	a := &Agent{
+		config:     cfg,
+		events:     logEventReporter{},
+		envoyAdmin: envoy.NewAdminClient(strings.TrimPrefix(envoyAdmin.URL, "http://")),
+		healthDNS:  newHealthDNS(&cfg.HealthDNS),
+	}
+	a.lastApplied.Store(&models.LoadBalancer{
+		ID: "lb-1", Addresses: []string{"203.0.113.10"},
+		Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+	})
+
+	tests := []struct {
+		name     string
+		setup    func()
+		wantCode int
+		want     string
+	}{
+		{
+			name:     "healthy",
+			setup:    func() {},
+			wantCode: http.StatusOK,
+			want:     `"healthy":true,"weight":50,"addresses":["203.0.113.10"]`,
+		},
+		{
+			name:     "too few healthy backends",
+			setup:    func() { healthy = 1 },
+			wantCode: http.StatusServiceUnavailable,
+			want:     `"reason":"25% of backends healthy, below 50%"`,
+		},
+		{
+			name:     "envoy draining",
+			setup:    func() { healthy, state = 4, "DRAINING" },
+			wantCode: http.StatusServiceUnavailable,
+			want:     `"reason":"Envoy is DRAINING"`,
+		},
+		{
+			name:     "passive node",
+			setup:    func() { state = "LIVE"; a.role.Store(ha.RolePassive) },
+			wantCode: http.StatusServiceUnavailable,
+			want:     `"reason":"node is passive"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+			a.updateHealthDNS(context.Background(), &cfg.HealthDNS)
+
+			rec := httptest.NewRecorder()
+			a.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dns/status", nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("body missing %s:\n%s", tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHealthDNSAddresses(t *testing.T) {
+	lb := &models.LoadBalancer{Addresses: []string{"0.0.0.0", "198.51.100.7", "::ffff:198.51.100.8"}}
+	tests := []struct {
+		name       string
+		cfg        HealthDNSConfig
+		floatingIP string
+		want       string
+	}{
+		{name: "configured addresses", cfg: HealthDNSConfig{Addresses: []string{"203.0.113.10", "2001:db8::10"}}, floatingIP: "203.0.113.1", want: "203.0.113.10 2001:db8::10"},
+		{name: "floating IP", floatingIP: "203.0.113.1", want: "203.0.113.1"},
+		{name: "load balancer addresses", want: "198.51.100.7 198.51.100.8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, addr := range healthDNSAddresses(&tt.cfg, tt.floatingIP, lb) {
+				got = append(got, addr.String())
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("healthDNSAddresses() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+	if got := healthDNSAddresses(&HealthDNSConfig{}, "", nil); len(got) != 0 {
+		t.Errorf("healthDNSAddresses() without a configuration = %v, want none", got)
+	}
+}
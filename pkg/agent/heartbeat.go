@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the agent version reported in heartbeats, set by the binary
+var Version = "dev"
+
+// procDir is where node statistics are read from; replaced in tests
+var procDir = "/proc"
+
+// heartbeatReporter is implemented by event reporters that accept heartbeats
+type heartbeatReporter interface {
+	SendHeartbeat(ctx context.Context, heartbeat *Heartbeat) error
+}
+
+// Heartbeat tells VPSie that this node is alive and what it is running
+type Heartbeat struct {
+	LastSync      *SyncStatus        `json:"last_sync,omitempty"`
+	Paused        *PauseStatus       `json:"paused,omitempty"` // nil while configuration changes are applied
+	Node          *NodeStats         `json:"node,omitempty"`
+	DataPlane     *ProbeStatus       `json:"data_plane,omitempty"`        // synthetic probe through the listener, nil without probe.enabled
+	Stability     []BackendStability `json:"backend_stability,omitempty"` // backend hosts that changed health since the agent started
+	Status        LoadBalancerStatus `json:"status"`
+	AgentVersion  string             `json:"agent_version"`
+	EnvoyVersion  string             `json:"envoy_version,omitempty"`
+	EnvoyState    string             `json:"envoy_state,omitempty"` // unreachable when Envoy's admin interface does not answer
+	Hostname      string             `json:"hostname,omitempty"`
+	HARole        string             `json:"ha_role,omitempty"`
+	Region        string             `json:"region,omitempty"`
+	Zone          string             `json:"zone,omitempty"`
+	VIPs          []string           `json:"vips,omitempty"` // from the node metadata
+	UptimeSeconds int64              `json:"uptime_seconds"`
+}
+
+// SyncStatus is the outcome of the last configuration sync
+type SyncStatus struct {
+	Time       time.Time `json:"time"`
+	Error      string    `json:"error,omitempty"`
+	ConfigHash string    `json:"config_hash,omitempty"`      // last applied configuration
+	HeldHash   string    `json:"held_config_hash,omitempty"` // configuration held back while reconciliation is paused
+	Success    bool      `json:"success"`
+}
+
+// NodeStats are resource statistics of the node
+type NodeStats struct {
+	Load1                float64 `json:"load1"`
+	Load5                float64 `json:"load5"`
+	Load15               float64 `json:"load15"`
+	MemoryTotalBytes     uint64  `json:"memory_total_bytes"`
+	MemoryAvailableBytes uint64  `json:"memory_available_bytes"`
+	CPUs                 int     `json:"cpus"`
+}
+
+// recordSync stores the outcome of a configuration sync for heartbeats
+func (a *Agent) recordSync(err error) {
+	status := &SyncStatus{Time: time.Now().UTC(), Success: err == nil}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	if hash, ok := a.lastConfigHash.Load().(string); ok {
+		status.ConfigHash = hash
+	}
+	if paused := a.paused.Load(); paused != nil {
+		status.HeldHash = paused.PendingConfigHash
+	}
+	a.lastSync.Store(status)
+}
+
+// runHeartbeat sends a heartbeat right away and then every interval until
+// ctx is cancelled
+func (a *Agent) runHeartbeat(ctx context.Context, reporter heartbeatReporter, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := reporter.SendHeartbeat(ctx, a.heartbeat(ctx)); err != nil && ctx.Err() == nil {
+			log.Printf("Warning: Failed to send heartbeat: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// heartbeat collects the current heartbeat
+func (a *Agent) heartbeat(ctx context.Context) *Heartbeat {
+	hb := &Heartbeat{
+		AgentVersion:  Version,
+		UptimeSeconds: int64(time.Since(a.startedAt).Seconds()),
+		Status:        a.computeStatus(a.poolHealth()),
+		LastSync:      a.lastSync.Load(),
+		Paused:        a.paused.Load(),
+		DataPlane:     a.prober.Status(),
+		Stability:     a.flaps.stability(time.Now(), &a.currentConfig().FlapDetection),
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		hb.Hostname = hostname
+	}
+	locality := a.node.locality(a.currentConfig())
+	hb.Region, hb.Zone = locality.Region, locality.Zone
+	if a.node != nil {
+		hb.VIPs = a.node.VIPs
+	}
+	if a.currentConfig().HA.Enabled {
+		hb.HARole = string(a.Role())
+	}
+
+	// Envoy does not run under HAProxy and Nginx, which have no admin interface
+	if a.proxy == nil {
+		if info, err := a.envoyAdmin.ServerInfo(ctx); err != nil {
+			hb.EnvoyState = "unreachable"
+		} else {
+			hb.EnvoyVersion = info.Version
+			hb.EnvoyState = info.State
+		}
+	}
+
+	stats, err := readNodeStats()
+	if err != nil {
+		log.Printf("Warning: Failed to read node statistics: %v", err)
+	} else {
+		hb.Node = stats
+	}
+	return hb
+}
+
+// readNodeStats reads the load averages and memory of the node from procDir
+func readNodeStats() (*NodeStats, error) {
+	stats := &NodeStats{CPUs: runtime.NumCPU()}
+
+	loadavg, err := os.ReadFile(procDir + "/loadavg")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read load average: %w", err)
+	}
+	fields := strings.Fields(string(loadavg))
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("unexpected load average %q", strings.TrimSpace(string(loadavg)))
+	}
+	for i, load := range []*float64{&stats.Load1, &stats.Load5, &stats.Load15} {
+		if *load, err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return nil, fmt.Errorf("unexpected load average %q: %w", fields[i], err)
+		}
+	}
+
+	meminfo, err := os.Open(procDir + "/meminfo")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory info: %w", err)
+	}
+	defer func() { _ = meminfo.Close() }()
+
+	// Lines look like "MemAvailable:   123456 kB"
+	scanner := bufio.NewScanner(meminfo)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		var target *uint64
+		switch name {
+		case "MemTotal":
+			target = &stats.MemoryTotalBytes
+		case "MemAvailable":
+			target = &stats.MemoryAvailableBytes
+		default:
+			continue
+		}
+		kb, parseErr := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if parseErr != nil {
+			return nil, fmt.Errorf("unexpected %s value %q: %w", name, strings.TrimSpace(value), parseErr)
+		}
+		*target = kb * 1024
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read memory info: %w", err)
+	}
+	return stats, nil
+}
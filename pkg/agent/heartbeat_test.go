@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+)
+
+// fakeProc points procDir at a directory with the given loadavg and meminfo
+func fakeProc(t *testing.T, loadavg, meminfo string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{"loadavg": loadavg, "meminfo": meminfo} {
+		if content == "" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := procDir
+	procDir = dir
+	t.Cleanup(func() { procDir = old })
+}
+
+func TestReadNodeStats(t *testing.T) {
+	tests := []struct {
+		name    string
+		loadavg string
+		meminfo string
+		want    NodeStats
+		wantErr string
+	}{
+		{
+			name:    "valid",
+			loadavg: "0.52 0.58 0.59 2/1234 5678\n",
+			meminfo: "MemTotal:        2048000 kB\nMemFree:          100000 kB\nMemAvailable:    1024000 kB\n",
+			want:    NodeStats{Load1: 0.52, Load5: 0.58, Load15: 0.59, MemoryTotalBytes: 2048000 * 1024, MemoryAvailableBytes: 1024000 * 1024},
+		},
+		{name: "missing loadavg", meminfo: "MemTotal: 1 kB\n", wantErr: "load average"},
+		{name: "short loadavg", loadavg: "0.52\n", meminfo: "MemTotal: 1 kB\n", wantErr: "unexpected load average"},
+		{name: "bad memory value", loadavg: "0 0 0 1/1 1\n", meminfo: "MemTotal: lots kB\n", wantErr: "MemTotal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeProc(t, tt.loadavg, tt.meminfo)
+			stats, err := readNodeStats()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readNodeStats() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readNodeStats() error = %v", err)
+			}
+			tt.want.CPUs = stats.CPUs
+			if *stats != tt.want || stats.CPUs < 1 {
+				t.Errorf("readNodeStats() = %+v, want %+v", *stats, tt.want)
+			}
+		})
+	}
+}
+
+func TestAgent_Heartbeat(t *testing.T) {
+	fakeProc(t, "1.00 0.50 0.25 1/100 42\n", "MemTotal: 4 kB\nMemAvailable: 2 kB\n")
+	envoyAdmin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"version": "abc/1.31.0/Clean/RELEASE/BoringSSL", "state": "LIVE",
+			"command_line_options": {"restart_epoch": 1}}`))
+	}))
+	defer envoyAdmin.Close()
+
+	a := &Agent{
+		config:     &Config{},
+		envoyAdmin: envoy.NewAdminClient(strings.TrimPrefix(envoyAdmin.URL, "http://")),
+		startedAt:  time.Now().Add(-90 * time.Second),
+		node:       &NodeMetadata{Region: "ams", Zone: "ams-1", VIPs: []string{"203.0.113.10"}},
+	}
+	a.lastConfigHash.Store("hash-1")
+	a.recordSync(errors.New("backend unreachable"))
+
+	hb := a.heartbeat(context.Background())
+	if hb.AgentVersion != Version || hb.EnvoyVersion != "abc/1.31.0/Clean/RELEASE/BoringSSL" || hb.EnvoyState != "LIVE" {
+		t.Errorf("heartbeat versions = %+v", hb)
+	}
+	if hb.UptimeSeconds < 90 {
+		t.Errorf("UptimeSeconds = %d, want at least 90", hb.UptimeSeconds)
+	}
+	if sync := hb.LastSync; sync == nil || sync.Success || sync.Error != "backend unreachable" || sync.ConfigHash != "hash-1" {
+		t.Errorf("LastSync = %+v, want the failed sync", sync)
+	}
+	if hb.Node == nil || hb.Node.Load1 != 1 || hb.Node.MemoryAvailableBytes != 2048 {
+		t.Errorf("Node = %+v", hb.Node)
+	}
+	if hb.Region != "ams" || hb.Zone != "ams-1" || len(hb.VIPs) != 1 {
+		t.Errorf("heartbeat locality = %q/%q, VIPs %v, want the node metadata", hb.Region, hb.Zone, hb.VIPs)
+	}
+	if hb.HARole != "" {
+		t.Errorf("HARole = %q without HA, want none", hb.HARole)
+	}
+
+	// Envoy down is reported, not an error
+	a.envoyAdmin = envoy.NewAdminClient("127.0.0.1:1")
+	if hb = a.heartbeat(context.Background()); hb.EnvoyState != "unreachable" || hb.EnvoyVersion != "" {
+		t.Errorf("heartbeat with Envoy down = %+v, want unreachable", hb)
+	}
+}
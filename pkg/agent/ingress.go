@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ingress"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/k8s"
+)
+
+// setDefaults fills in unset kubernetes_ingress source settings
+func (c *KubernetesSourceConfig) setDefaults() {
+	if c.IngressClass == "" {
+		c.IngressClass = ingress.DefaultIngressClass
+	}
+	if c.BackendTarget == "" {
+		c.BackendTarget = ingress.BackendTargetNodePort
+	}
+	if c.Port == 0 {
+		c.Port = 80
+	}
+}
+
+// validate checks the kubernetes_ingress source settings
+func (c *KubernetesSourceConfig) validate() []error {
+	var errs []error
+	if c.Server == "" && (c.TokenFile != "" || c.CAFile != "") {
+		errs = append(errs, fmt.Errorf("source.kubernetes.token_file and ca_file require source.kubernetes.server"))
+	}
+	if c.BackendTarget != ingress.BackendTargetNodePort && c.BackendTarget != ingress.BackendTargetPod {
+		errs = append(errs, fmt.Errorf("source.kubernetes.backend_target %q is invalid: must be %q or %q",
+			c.BackendTarget, ingress.BackendTargetNodePort, ingress.BackendTargetPod))
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("source.kubernetes.port %d is out of range", c.Port))
+	}
+	return errs
+}
+
+// newIngressSource creates the kubernetes_ingress configuration source. The
+// load balancer ID defaults to "ingress-<class>" unless vpsie.loadbalancer_id is set.
+func newIngressSource(cfg *Config) (*ingress.Source, error) {
+	kc := cfg.Source.Kubernetes
+
+	var client *k8s.Client
+	var err error
+	if kc.Server == "" {
+		client, err = k8s.NewInClusterClient()
+	} else {
+		var token string
+		if kc.TokenFile != "" {
+			// #nosec G304 -- path comes from the agent configuration
+			data, readErr := os.ReadFile(kc.TokenFile)
+			if readErr != nil {
+				return nil, fmt.Errorf("failed to read token file: %w", readErr)
+			}
+			token = strings.TrimSpace(string(data))
+		}
+
+		var caPEM []byte
+		if kc.CAFile != "" {
+			// #nosec G304 -- path comes from the agent configuration
+			if caPEM, err = os.ReadFile(kc.CAFile); err != nil {
+				return nil, fmt.Errorf("failed to read CA file: %w", err)
+			}
+		}
+		client, err = k8s.NewClient(kc.Server, token, caPEM)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ingress.NewSource(client, ingress.Options{
+		LoadBalancerID: cfg.VPSie.LoadBalancerID,
+		IngressClass:   kc.IngressClass,
+		Port:           kc.Port,
+		BackendTarget:  kc.BackendTarget,
+	}), nil
+}
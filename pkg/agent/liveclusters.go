@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// changeClass is what a configuration change touches in the generated Envoy
+// configuration, which decides how it is applied
+type changeClass string
+
+const (
+	// changeNone leaves the generated files as they are: nothing to reload
+	changeNone changeClass = "none"
+	// changeClusters touches the clusters only, such as backends, weights
+	// and health checks: Envoy loads clusters.yaml again when it is replaced
+	changeClusters changeClass = "clusters"
+	// changeFull touches the listeners, the bootstrap or files Envoy only
+	// reads at startup: the reload strategy applies it
+	changeFull changeClass = "full"
+)
+
+// Timing of live cluster updates
+const (
+	// liveClustersTimeout bounds the wait for Envoy to load clusters.yaml
+	liveClustersTimeout = 5 * time.Second
+	// liveClustersPoll is how often Envoy's statistics are checked meanwhile
+	liveClustersPoll = 100 * time.Millisecond
+)
+
+// classifyChange returns how the change from the files on disk to
+// envoyConfig can be applied. Without envoy.live_clusters every change is
+// applied with the reload strategy.
+func (a *Agent) classifyChange(lb *models.LoadBalancer, envoyConfig *envoy.EnvoyConfig) changeClass {
+	if !a.currentConfig().Envoy.LiveClusters || a.bootstrapPending.Load() || a.secretsChanged(lb) {
+		return changeFull
+	}
+	listeners, clusters, err := a.envoyManager.Changed(envoyConfig)
+	switch {
+	case err != nil:
+		log.Printf("Warning: Failed to compare the Envoy configuration, reloading: %v", err)
+		return changeFull
+	case listeners:
+		return changeFull
+	case clusters:
+		return changeClusters
+	default:
+		return changeNone
+	}
+}
+
+// secretsChanged reports whether the certificate or session ticket key files
+// changed since they were last loaded; Envoy only reads them when the
+// listeners are loaded
+func (a *Agent) secretsChanged(lb *models.LoadBalancer) bool {
+	var fingerprint string
+	if lb.TLSConfig != nil {
+		fingerprint, _ = certificateFingerprint(lb.TLSConfig)
+	}
+	if previous, _ := a.certFingerprint.Load().(string); fingerprint != previous {
+		return true
+	}
+	cfg := a.currentConfig().SessionTickets
+	if !cfg.Enabled || !usesSessionTickets(lb) {
+		return false
+	}
+	keys, err := loadSessionTicketKeys(&cfg)
+	previous, _ := a.ticketFingerprint.Load().(string)
+	return err != nil || keys.fingerprint() != previous
+}
+
+// cdsUpdates returns Envoy's cluster update counters before a live update
+func (a *Agent) cdsUpdates(ctx context.Context) (envoy.CDSUpdates, error) {
+	if a.envoyAdmin == nil {
+		return envoy.CDSUpdates{}, errors.New("no Envoy admin client")
+	}
+	return a.envoyAdmin.CDSUpdates(ctx)
+}
+
+// awaitLiveClusters waits for Envoy to load the replaced clusters.yaml,
+// counted from the update counters before it was written
+func (a *Agent) awaitLiveClusters(ctx context.Context, before envoy.CDSUpdates) error {
+	ctx, cancel := context.WithTimeout(ctx, liveClustersTimeout)
+	defer cancel()
+	ticker := time.NewTicker(liveClustersPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("envoy did not load the clusters within %s", liveClustersTimeout)
+		case <-ticker.C:
+		}
+		updates, err := a.envoyAdmin.CDSUpdates(ctx)
+		if err != nil {
+			continue
+		}
+		if updates.Rejected > before.Rejected {
+			return errors.New("envoy rejected the clusters")
+		}
+		if updates.Success > before.Success {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestAgent_ClassifyChange(t *testing.T) {
+	a := newStateTestAgent(t, t.TempDir(), t.TempDir())
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "web", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+		Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}},
+	}
+	applied, err := a.envoyGenerator.GenerateFullConfig(lb)
+	if err != nil {
+		t.Fatalf("GenerateFullConfig() error = %v", err)
+	}
+	if err = a.envoyManager.ApplyConfig(applied); err != nil {
+		t.Fatalf("ApplyConfig() error = %v", err)
+	}
+
+	weighted := *lb
+	weighted.Backends = []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true, Weight: 3}}
+	moved := *lb
+	moved.Port = 8081
+
+	for _, tt := range []struct {
+		name string
+		lb   *models.LoadBalancer
+		live bool
+		want changeClass
+	}{
+		{"live clusters disabled", &weighted, false, changeFull},
+		{"unchanged", lb, true, changeNone},
+		{"backend weight", &weighted, true, changeClusters},
+		{"listener port", &moved, true, changeFull},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a.config.Envoy.LiveClusters = tt.live
+			config, err := a.envoyGenerator.GenerateFullConfig(tt.lb)
+			if err != nil {
+				t.Fatalf("GenerateFullConfig() error = %v", err)
+			}
+			if got := a.classifyChange(tt.lb, config); got != tt.want {
+				t.Errorf("classifyChange() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// A bootstrap waiting for a restart needs the reload strategy
+	a.bootstrapPending.Store(true)
+	config, _ := a.envoyGenerator.GenerateFullConfig(&weighted)
+	if got := a.classifyChange(&weighted, config); got != changeFull {
+		t.Errorf("classifyChange() with a pending bootstrap = %s, want full", got)
+	}
+}
+
+func TestAgent_AwaitLiveClusters(t *testing.T) {
+	var success, rejected atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, `{"stats": [{"name": "cluster_manager.cds.update_success", "value": %d}, {"name": "cluster_manager.cds.update_rejected", "value": %d}]}`,
+			success.Load(), rejected.Load())
+	}))
+	defer server.Close()
+	a := &Agent{envoyAdmin: envoy.NewAdminClient(strings.TrimPrefix(server.URL, "http://"))}
+	ctx := context.Background()
+
+	before, err := a.cdsUpdates(ctx)
+	if err != nil {
+		t.Fatalf("cdsUpdates() error = %v", err)
+	}
+	success.Add(1)
+	if err = a.awaitLiveClusters(ctx, before); err != nil {
+		t.Errorf("awaitLiveClusters() error = %v, want the update loaded", err)
+	}
+
+	before, _ = a.cdsUpdates(ctx)
+	rejected.Add(1)
+	if err = a.awaitLiveClusters(ctx, before); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("awaitLiveClusters() error = %v, want the update rejected", err)
+	}
+}
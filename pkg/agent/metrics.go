@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// metricsContentType is the Prometheus text exposition format
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// handleMetrics exposes agent metrics in the Prometheus text format. Envoy's
+// own metrics are served by its admin interface at /stats/prometheus.
+func (a *Agent) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metricsContentType)
+	a.writeStatusMetrics(w)
+	a.writeFlapMetrics(w)
+	a.writeSessionMetrics(r.Context(), w)
+}
+
+// writeStatusMetrics writes the load balancer status and the backend health
+// of its pools
+func (a *Agent) writeStatusMetrics(w io.Writer) {
+	report := a.currentStatus()
+
+	fmt.Fprintln(w, "# HELP vpsie_lb_status Load balancer status: 1 for the current one, 0 for the others.")
+	fmt.Fprintln(w, "# TYPE vpsie_lb_status gauge")
+	for _, status := range loadBalancerStatuses {
+		current := 0
+		if status == report.Status {
+			current = 1
+		}
+		fmt.Fprintf(w, "vpsie_lb_status{status=\"%s\"} %d\n", status, current)
+	}
+	fmt.Fprintln(w, "# HELP vpsie_lb_pool_backends_healthy Envoy hosts of a backend pool that serve.")
+	fmt.Fprintln(w, "# TYPE vpsie_lb_pool_backends_healthy gauge")
+	for _, p := range report.Pools {
+		fmt.Fprintf(w, "vpsie_lb_pool_backends_healthy{%s} %d\n", poolLabels(p), p.Healthy)
+	}
+	fmt.Fprintln(w, "# HELP vpsie_lb_pool_backends_total Envoy hosts of a backend pool.")
+	fmt.Fprintln(w, "# TYPE vpsie_lb_pool_backends_total gauge")
+	for _, p := range report.Pools {
+		fmt.Fprintf(w, "vpsie_lb_pool_backends_total{%s} %d\n", poolLabels(p), p.Total)
+	}
+}
+
+// writeFlapMetrics writes the flapping of backend hosts
+func (a *Agent) writeFlapMetrics(w io.Writer) {
+	stability := a.flaps.stability(time.Now(), &a.currentConfig().FlapDetection)
+
+	fmt.Fprintln(w, "# HELP vpsie_lb_backend_health_transitions_total Health transitions of a backend host between serving and failing.")
+	fmt.Fprintln(w, "# TYPE vpsie_lb_backend_health_transitions_total counter")
+	for _, s := range stability {
+		fmt.Fprintf(w, "vpsie_lb_backend_health_transitions_total{%s} %d\n", hostLabels(s), s.Transitions)
+	}
+	fmt.Fprintln(w, "# HELP vpsie_lb_backend_stability_score Stability of a backend host from 100 (no flaps within the window) to 0.")
+	fmt.Fprintln(w, "# TYPE vpsie_lb_backend_stability_score gauge")
+	for _, s := range stability {
+		fmt.Fprintf(w, "vpsie_lb_backend_stability_score{%s} %d\n", hostLabels(s), s.StabilityScore)
+	}
+	fmt.Fprintln(w, "# HELP vpsie_lb_backend_quarantined Whether a backend host is quarantined for flapping.")
+	fmt.Fprintln(w, "# TYPE vpsie_lb_backend_quarantined gauge")
+	for _, s := range stability {
+		quarantined := 0
+		if s.QuarantinedUntil != nil {
+			quarantined = 1
+		}
+		fmt.Fprintf(w, "vpsie_lb_backend_quarantined{%s} %d\n", hostLabels(s), quarantined)
+	}
+}
+
+// hostLabels returns the Prometheus labels of a backend host
+func hostLabels(s BackendStability) string {
+	return fmt.Sprintf(`cluster="%s",address="%s"`, labelValue(s.Cluster), labelValue(s.Address))
+}
+
+// poolLabels returns the Prometheus labels of a backend pool
+func poolLabels(p PoolHealth) string {
+	return fmt.Sprintf(`cluster="%s",pool="%s"`, labelValue(p.Cluster), labelValue(p.Pool))
+}
+
+// labelValue escapes a Prometheus label value
+func labelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
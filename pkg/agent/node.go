@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// NodeMetadata is what VPSie knows about the node running the agent
+type NodeMetadata struct {
+	Region string      `json:"region,omitempty"`
+	Zone   string      `json:"zone,omitempty"`
+	VIPs   []string    `json:"vips,omitempty"` // virtual IPs served by the node
+	Plan   models.Plan `json:"plan"`
+}
+
+// NodeMetadata returns the metadata of node nodeID, nil when VPSie has none
+func (c *VPSieClient) NodeMetadata(ctx context.Context, nodeID string) (*NodeMetadata, error) {
+	reqURL := fmt.Sprintf("%s/loadbalancers/%s/nodes/%s", c.baseURL, sanitizeID(c.loadBalancerID), url.PathEscape(nodeID))
+	var metadata NodeMetadata
+	if err := c.doJSON(ctx, http.MethodGet, reqURL, nil, &metadata); err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+// validate checks the metadata before the agent relies on it
+func (m *NodeMetadata) validate() error {
+	if m.Region != "" && !models.LocalityRegex.MatchString(m.Region) {
+		return fmt.Errorf("region %q is invalid", m.Region)
+	}
+	if m.Zone != "" && !models.LocalityRegex.MatchString(m.Zone) {
+		return fmt.Errorf("zone %q is invalid", m.Zone)
+	}
+	for _, vip := range m.VIPs {
+		if net.ParseIP(vip) == nil {
+			return fmt.Errorf("VIP %q is not an IP address", vip)
+		}
+	}
+	if m.Plan.MaxConnections < 0 {
+		return fmt.Errorf("plan max_connections %d is negative", m.Plan.MaxConnections)
+	}
+	return nil
+}
+
+// fetchNodeMetadata fetches the metadata of this node when vpsie.node_metadata
+// is set. The agent starts without it, from agent.yaml alone, when VPSie
+// cannot be asked or has none.
+func fetchNodeMetadata(ctx context.Context, cfg *Config, source ConfigSource) *NodeMetadata {
+	client, ok := source.(*VPSieClient)
+	if !cfg.VPSie.NodeMetadata || !ok {
+		return nil
+	}
+	metadata, err := client.NodeMetadata(ctx, cfg.HA.NodeID)
+	if err == nil && metadata != nil {
+		err = metadata.validate()
+	}
+	switch {
+	case err != nil:
+		log.Printf("Warning: Failed to fetch the metadata of node %s, using agent.yaml only: %v", cfg.HA.NodeID, err)
+		return nil
+	case metadata == nil:
+		log.Printf("Warning: VPSie has no metadata for node %s, using agent.yaml only", cfg.HA.NodeID)
+		return nil
+	}
+	log.Printf("Node metadata: region=%q zone=%q vips=%v plan=%q max_connections=%d",
+		metadata.Region, metadata.Zone, metadata.VIPs, metadata.Plan.Name, metadata.Plan.MaxConnections)
+	return metadata
+}
+
+// locality returns the locality of the node: envoy.locality where set,
+// otherwise the region and zone known to VPSie
+func (m *NodeMetadata) locality(cfg *Config) LocalitySettings {
+	locality := cfg.Envoy.Locality
+	if m != nil && locality.Region == "" {
+		locality.Region = m.Region
+	}
+	if m != nil && locality.Zone == "" {
+		locality.Zone = m.Zone
+	}
+	return locality
+}
+
+// maxConnections returns the global downstream connection limit: the lower
+// of envoy.max_connections and the limit of the node's plan
+func (m *NodeMetadata) maxConnections(cfg *Config) int {
+	if m != nil && m.Plan.MaxConnections > 0 {
+		return min(cfg.Envoy.MaxConnections, m.Plan.MaxConnections)
+	}
+	return cfg.Envoy.MaxConnections
+}
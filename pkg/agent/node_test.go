@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestFetchNodeMetadata(t *testing.T) {
+	responses := map[string]string{
+		"lb-a": `{"region":"ams","zone":"ams-1","vips":["203.0.113.10"],"plan":{"name":"lb-large","max_connections":20000}}`,
+		"lb-b": `{"region":"ams","vips":["not-an-ip"]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for node, body := range responses {
+			if r.Method == http.MethodGet && r.URL.Path == "/loadbalancers/lb-123/nodes/"+node {
+				_, _ = w.Write([]byte(body))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	client, _ := NewVPSieClient("test-key", server.URL, "lb-123")
+
+	cfg := &Config{VPSie: VPSieConfig{NodeMetadata: true}, HA: HAConfig{NodeID: "lb-a"}}
+	metadata := fetchNodeMetadata(context.Background(), cfg, client)
+	want := &NodeMetadata{Region: "ams", Zone: "ams-1", VIPs: []string{"203.0.113.10"}, Plan: models.Plan{Name: "lb-large", MaxConnections: 20000}}
+	if !reflect.DeepEqual(metadata, want) {
+		t.Errorf("fetchNodeMetadata() = %+v, want %+v", metadata, want)
+	}
+
+	// Invalid, unknown or not requested metadata leaves agent.yaml alone
+	for _, node := range []string{"lb-b", "lb-c"} {
+		cfg.HA.NodeID = node
+		if metadata := fetchNodeMetadata(context.Background(), cfg, client); metadata != nil {
+			t.Errorf("fetchNodeMetadata() for %s = %+v, want nil", node, metadata)
+		}
+	}
+	cfg.VPSie.NodeMetadata, cfg.HA.NodeID = false, "lb-a"
+	if metadata := fetchNodeMetadata(context.Background(), cfg, client); metadata != nil {
+		t.Errorf("fetchNodeMetadata() without vpsie.node_metadata = %+v, want nil", metadata)
+	}
+}
+
+func TestNodeMetadata_Settings(t *testing.T) {
+	cfg := &Config{Envoy: EnvoySettings{MaxConnections: 50000, Locality: LocalitySettings{Zone: "ams-2"}}}
+	var none *NodeMetadata
+	if got := none.locality(cfg); got != cfg.Envoy.Locality {
+		t.Errorf("locality() without metadata = %+v, want envoy.locality", got)
+	}
+	if got := none.maxConnections(cfg); got != 50000 {
+		t.Errorf("maxConnections() without metadata = %d, want envoy.max_connections", got)
+	}
+
+	// agent.yaml wins; the plan only lowers the connection limit
+	node := &NodeMetadata{Region: "ams", Zone: "ams-1", Plan: models.Plan{MaxConnections: 20000}}
+	if got := node.locality(cfg); got != (LocalitySettings{Region: "ams", Zone: "ams-2"}) {
+		t.Errorf("locality() = %+v, want the region from VPSie and the zone from agent.yaml", got)
+	}
+	if got := node.maxConnections(cfg); got != 20000 {
+		t.Errorf("maxConnections() = %d, want the plan limit", got)
+	}
+	node.Plan.MaxConnections = 100000
+	if got := node.maxConnections(cfg); got != 50000 {
+		t.Errorf("maxConnections() = %d, want envoy.max_connections below the plan limit", got)
+	}
+}
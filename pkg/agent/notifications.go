@@ -0,0 +1,337 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/notify"
+)
+
+// NotificationsConfig configures notifications sent to operators directly,
+// independent of the VPSie API
+type NotificationsConfig struct {
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	Email    EmailConfig     `yaml:"email"`
+}
+
+// WebhookConfig configures a webhook notifications are posted to
+type WebhookConfig struct {
+	Name           string        `yaml:"name"`
+	Type           string        `yaml:"type"`             // generic (default), slack or pagerduty
+	URL            string        `yaml:"url"`              // endpoint; PagerDuty defaults to its Events API
+	URLFile        string        `yaml:"url_file"`         // file holding the URL, for URLs carrying a token
+	RoutingKeyFile string        `yaml:"routing_key_file"` // file holding the PagerDuty integration key
+	MinSeverity    string        `yaml:"min_severity"`     // info, warning, error (default) or critical
+	Events         []string      `yaml:"events"`           // event types sent; empty sends all of min_severity and above
+	Timeout        time.Duration `yaml:"timeout"`          // per request, default 10s
+}
+
+// EmailConfig configures notifications sent by SMTP, for operators without
+// a webhook receiver
+type EmailConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	Server       string        `yaml:"server"`        // SMTP server host:port
+	Security     string        `yaml:"security"`      // starttls (default), tls or none
+	Username     string        `yaml:"username"`      // empty sends without authentication
+	PasswordFile string        `yaml:"password_file"` // file holding the SMTP password
+	From         string        `yaml:"from"`
+	To           []string      `yaml:"to"`
+	MinSeverity  string        `yaml:"min_severity"` // info, warning, error (default) or critical
+	Events       []string      `yaml:"events"`       // event types sent; empty sends all of min_severity and above
+	Timeout      time.Duration `yaml:"timeout"`      // per message, default 30s
+}
+
+// Default notification settings applied by LoadConfig
+const (
+	defaultWebhookTimeout = 10 * time.Second
+	defaultEmailTimeout   = 30 * time.Second
+)
+
+// maxEmailRecipients bounds the recipients of email notifications
+const maxEmailRecipients = 20
+
+// maxNotificationTimeout bounds how long sending a notification may take
+const maxNotificationTimeout = time.Minute
+
+// setDefaults fills in unset notification settings
+func (c *NotificationsConfig) setDefaults() {
+	for i := range c.Webhooks {
+		webhook := &c.Webhooks[i]
+		if webhook.Type == "" {
+			webhook.Type = notify.WebhookGeneric
+		}
+		if webhook.MinSeverity == "" {
+			webhook.MinSeverity = notify.SeverityError
+		}
+		if webhook.Timeout == 0 {
+			webhook.Timeout = defaultWebhookTimeout
+		}
+	}
+	if c.Email.Security == "" {
+		c.Email.Security = notify.EmailSTARTTLS
+	}
+	if c.Email.MinSeverity == "" {
+		c.Email.MinSeverity = notify.SeverityError
+	}
+	if c.Email.Timeout == 0 {
+		c.Email.Timeout = defaultEmailTimeout
+	}
+}
+
+// enabled reports whether any notification target is configured
+func (c *NotificationsConfig) enabled() bool {
+	return len(c.Webhooks) > 0 || c.Email.Enabled
+}
+
+// validate checks the notification settings
+func (c *NotificationsConfig) validate() []error {
+	var errs []error
+	names := make(map[string]bool, len(c.Webhooks))
+	for i := range c.Webhooks {
+		webhook := &c.Webhooks[i]
+		field := fmt.Sprintf("notifications.webhooks[%d]", i)
+		if webhook.Name == "" {
+			errs = append(errs, fmt.Errorf("%s.name is required", field))
+		} else if names[webhook.Name] {
+			errs = append(errs, fmt.Errorf("%s.name %q is used by another webhook", field, webhook.Name))
+		}
+		names[webhook.Name] = true
+
+		switch webhook.Type {
+		case notify.WebhookGeneric, notify.WebhookSlack:
+			if (webhook.URL == "") == (webhook.URLFile == "") {
+				errs = append(errs, fmt.Errorf("%s needs either url or url_file", field))
+			}
+			if webhook.RoutingKeyFile != "" {
+				errs = append(errs, fmt.Errorf("%s.routing_key_file is only used by pagerduty webhooks", field))
+			}
+		case notify.WebhookPagerDuty:
+			if webhook.URLFile != "" {
+				errs = append(errs, fmt.Errorf("%s.url_file is not used by pagerduty webhooks, use routing_key_file", field))
+			}
+			if webhook.RoutingKeyFile == "" {
+				errs = append(errs, fmt.Errorf("%s.routing_key_file is required for pagerduty webhooks", field))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s.type %q is invalid: must be %s, %s or %s", field, webhook.Type, notify.WebhookGeneric, notify.WebhookSlack, notify.WebhookPagerDuty))
+		}
+		if webhook.URL != "" {
+			if err := validateWebhookURL(webhook.URL, webhook.Type); err != nil {
+				errs = append(errs, fmt.Errorf("%s.url: %w", field, err))
+			}
+		}
+		for _, path := range []string{webhook.URLFile, webhook.RoutingKeyFile} {
+			if path == "" {
+				continue
+			}
+			if err := checkSecretFile(path); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", field, err))
+			}
+		}
+
+		errs = append(errs, validateNotificationFilter(field, webhook.MinSeverity, webhook.Events)...)
+		if webhook.Timeout < time.Second || webhook.Timeout > maxNotificationTimeout {
+			errs = append(errs, fmt.Errorf("%s.timeout %s is out of range: must be between 1s and %s", field, webhook.Timeout, maxNotificationTimeout))
+		}
+	}
+	errs = append(errs, c.Email.validate()...)
+	return errs
+}
+
+// validate checks the email notification settings
+func (c *EmailConfig) validate() []error {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []error
+	if host, _, err := net.SplitHostPort(c.Server); err != nil || host == "" {
+		errs = append(errs, fmt.Errorf("notifications.email.server %q must be host:port", c.Server))
+	}
+	switch c.Security {
+	case notify.EmailSTARTTLS, notify.EmailTLS:
+	case notify.EmailPlain:
+		// Go's SMTP client only sends credentials in the clear to localhost
+		if c.Username != "" && !isLoopbackServer(c.Server) {
+			errs = append(errs, fmt.Errorf("notifications.email.username needs security starttls or tls unless the server is on localhost"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("notifications.email.security %q is invalid: must be %s, %s or %s", c.Security, notify.EmailSTARTTLS, notify.EmailTLS, notify.EmailPlain))
+	}
+	if c.Username != "" {
+		if c.PasswordFile == "" {
+			errs = append(errs, fmt.Errorf("notifications.email.password_file is required with a username"))
+		} else if err := checkSecretFile(c.PasswordFile); err != nil {
+			errs = append(errs, fmt.Errorf("notifications.email.password_file: %w", err))
+		}
+	}
+	if err := validateMailAddress(c.From); err != nil {
+		errs = append(errs, fmt.Errorf("notifications.email.from: %w", err))
+	}
+	if len(c.To) == 0 || len(c.To) > maxEmailRecipients {
+		errs = append(errs, fmt.Errorf("notifications.email.to must list between 1 and %d recipients", maxEmailRecipients))
+	}
+	for i, to := range c.To {
+		if err := validateMailAddress(to); err != nil {
+			errs = append(errs, fmt.Errorf("notifications.email.to[%d]: %w", i, err))
+		}
+	}
+	errs = append(errs, validateNotificationFilter("notifications.email", c.MinSeverity, c.Events)...)
+	if c.Timeout < time.Second || c.Timeout > maxNotificationTimeout {
+		errs = append(errs, fmt.Errorf("notifications.email.timeout %s is out of range: must be between 1s and %s", c.Timeout, maxNotificationTimeout))
+	}
+	return errs
+}
+
+// validateNotificationFilter checks the severity threshold and event types
+// of a notification target
+func validateNotificationFilter(field, minSeverity string, events []string) []error {
+	var errs []error
+	if !notify.ValidSeverity(minSeverity) {
+		errs = append(errs, fmt.Errorf("%s.min_severity %q is invalid: must be info, warning, error or critical", field, minSeverity))
+	}
+	for _, eventType := range events {
+		if _, ok := eventTaxonomy[EventType(eventType)]; !ok {
+			errs = append(errs, fmt.Errorf("%s.events: unknown event type %q", field, eventType))
+		}
+	}
+	return errs
+}
+
+// validateMailAddress checks that address is a bare email address, as SMTP
+// MAIL FROM and RCPT TO take them
+func validateMailAddress(address string) error {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address {
+		return fmt.Errorf("%q is not an email address", address)
+	}
+	return nil
+}
+
+// isLoopbackServer reports whether the host:port server is this host
+func isLoopbackServer(server string) bool {
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validateWebhookURL checks a webhook URL. Slack and PagerDuty are only
+// reached over HTTPS; generic webhooks may be plain HTTP on a private network.
+func validateWebhookURL(rawURL, kind string) error {
+	parsed, err := url.Parse(rawURL)
+	switch {
+	case err != nil:
+		return fmt.Errorf("not a valid URL: %w", err)
+	case parsed.Hostname() == "":
+		return fmt.Errorf("%q has no host", rawURL)
+	case parsed.Scheme == httpsScheme:
+		return nil
+	case parsed.Scheme == httpScheme && kind == notify.WebhookGeneric:
+		return nil
+	}
+	return fmt.Errorf("%q must use https://", rawURL)
+}
+
+// newNotifier creates the notifier for the configured webhooks and email,
+// reading the URLs, routing keys and passwords kept in files
+func newNotifier(cfg *NotificationsConfig) (*notify.Notifier, error) {
+	targets := make([]notify.Target, 0, len(cfg.Webhooks))
+	for i := range cfg.Webhooks {
+		webhook := &cfg.Webhooks[i]
+		webhookURL := webhook.URL
+		if webhook.URLFile != "" {
+			secret, err := readSecret(webhook.URLFile)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %s: %w", webhook.Name, err)
+			}
+			if err = validateWebhookURL(secret, webhook.Type); err != nil {
+				// Not quoted: the URL is secret
+				return nil, fmt.Errorf("webhook %s: URL in %s is invalid", webhook.Name, webhook.URLFile)
+			}
+			webhookURL = secret
+		}
+		var routingKey string
+		if webhook.RoutingKeyFile != "" {
+			var err error
+			if routingKey, err = readSecret(webhook.RoutingKeyFile); err != nil {
+				return nil, fmt.Errorf("webhook %s: %w", webhook.Name, err)
+			}
+		}
+		targets = append(targets, notify.Target{
+			Sink:        notify.NewWebhook(webhook.Name, webhook.Type, webhookURL, routingKey, webhook.Timeout),
+			MinSeverity: webhook.MinSeverity,
+			Events:      webhook.Events,
+		})
+	}
+
+	if email := &cfg.Email; email.Enabled {
+		var password string
+		if email.Username != "" {
+			var err error
+			if password, err = readSecret(email.PasswordFile); err != nil {
+				return nil, fmt.Errorf("email: %w", err)
+			}
+		}
+		targets = append(targets, notify.Target{
+			Sink: notify.NewEmail(notify.EmailSettings{
+				Server:   email.Server,
+				Security: email.Security,
+				Username: email.Username,
+				Password: password,
+				From:     email.From,
+				To:       email.To,
+				Timeout:  email.Timeout,
+			}),
+			MinSeverity: email.MinSeverity,
+			Events:      email.Events,
+		})
+	}
+	return notify.NewNotifier(targets), nil
+}
+
+// readSecret reads a secret file, without surrounding whitespace
+func readSecret(path string) (string, error) {
+	// #nosec G304 -- path comes from the agent configuration file
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return secret, nil
+}
+
+// notify sends event to the notification targets, if any
+func (a *Agent) notify(event *Event) {
+	if a.notifier == nil {
+		return
+	}
+	cfg := a.currentConfig()
+	node := cfg.HA.NodeID
+	if node == "" {
+		node, _ = os.Hostname()
+	}
+	a.notifier.Notify(&notify.Notification{
+		Time:           time.Now().UTC(),
+		Type:           string(event.Type),
+		Severity:       string(event.Severity),
+		Category:       string(event.Category),
+		Message:        event.Message,
+		CorrelationID:  event.CorrelationID,
+		Metadata:       event.Metadata,
+		LoadBalancerID: cfg.VPSie.LoadBalancerID,
+		Node:           node,
+	})
+}
@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/notify"
+)
+
+func TestNotificationsConfig_Validate(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "pagerduty-key")
+	if err := os.WriteFile(keyFile, []byte("key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	slack := WebhookConfig{Name: "ops", Type: notify.WebhookSlack, URL: "https://hooks.slack.com/services/T/B/x", MinSeverity: notify.SeverityError, Timeout: 10 * time.Second}
+	tests := []struct {
+		name    string
+		modify  func(*WebhookConfig)
+		wantErr bool
+	}{
+		{name: "slack", modify: func(*WebhookConfig) {}},
+		{name: "pagerduty", modify: func(w *WebhookConfig) { w.Type, w.URL, w.RoutingKeyFile = notify.WebhookPagerDuty, "", keyFile }},
+		{name: "generic over http", modify: func(w *WebhookConfig) { w.Type, w.URL = notify.WebhookGeneric, "http://10.0.0.5/alerts" }},
+		{name: "slack over http", modify: func(w *WebhookConfig) { w.URL = "http://hooks.slack.com/services/T/B/x" }, wantErr: true},
+		{name: "url and url file", modify: func(w *WebhookConfig) { w.URLFile = keyFile }, wantErr: true},
+		{name: "pagerduty without routing key", modify: func(w *WebhookConfig) { w.Type, w.URL = notify.WebhookPagerDuty, "" }, wantErr: true},
+		{name: "unknown type", modify: func(w *WebhookConfig) { w.Type = "teams" }, wantErr: true},
+		{name: "unknown severity", modify: func(w *WebhookConfig) { w.MinSeverity = "fatal" }, wantErr: true},
+		{name: "unknown event", modify: func(w *WebhookConfig) { w.Events = []string{"config_updated", "reload_failed"} }, wantErr: true},
+		{name: "timeout too long", modify: func(w *WebhookConfig) { w.Timeout = 2 * time.Minute }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook := slack
+			tt.modify(&webhook)
+			cfg := NotificationsConfig{Webhooks: []WebhookConfig{webhook}}
+			if errs := cfg.validate(); (len(errs) > 0) != tt.wantErr {
+				t.Errorf("validate() = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+
+	duplicate := NotificationsConfig{Webhooks: []WebhookConfig{slack, slack}}
+	if errs := duplicate.validate(); len(errs) != 1 {
+		t.Errorf("validate() of duplicate names = %v, want one error", errs)
+	}
+}
+
+func TestEmailConfig_Validate(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "smtp-password")
+	if err := os.WriteFile(passwordFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	valid := EmailConfig{
+		Enabled: true, Server: "smtp.example.com:587", Security: notify.EmailSTARTTLS,
+		Username: "lb-agent", PasswordFile: passwordFile,
+		From: "lb-agent@example.com", To: []string{"ops@example.com"},
+		MinSeverity: notify.SeverityError, Timeout: 30 * time.Second,
+	}
+	tests := []struct {
+		name    string
+		modify  func(*EmailConfig)
+		wantErr bool
+	}{
+		{name: "starttls with credentials", modify: func(*EmailConfig) {}},
+		{name: "disabled", modify: func(c *EmailConfig) { c.Enabled, c.Server = false, "" }},
+		{name: "local relay without credentials", modify: func(c *EmailConfig) { c.Server, c.Security, c.Username = "10.0.0.25:25", notify.EmailPlain, "" }},
+		{name: "credentials to localhost in the clear", modify: func(c *EmailConfig) { c.Server, c.Security = "localhost:25", notify.EmailPlain }},
+		{name: "credentials in the clear", modify: func(c *EmailConfig) { c.Security = notify.EmailPlain }, wantErr: true},
+		{name: "server without port", modify: func(c *EmailConfig) { c.Server = "smtp.example.com" }, wantErr: true},
+		{name: "unknown security", modify: func(c *EmailConfig) { c.Security = "ssl" }, wantErr: true},
+		{name: "username without password", modify: func(c *EmailConfig) { c.PasswordFile = "" }, wantErr: true},
+		{name: "display name in from", modify: func(c *EmailConfig) { c.From = "LB <lb-agent@example.com>" }, wantErr: true},
+		{name: "no recipients", modify: func(c *EmailConfig) { c.To = nil }, wantErr: true},
+		{name: "invalid recipient", modify: func(c *EmailConfig) { c.To = []string{"ops"} }, wantErr: true},
+		{name: "unknown severity", modify: func(c *EmailConfig) { c.MinSeverity = "page" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+			if errs := cfg.validate(); (len(errs) > 0) != tt.wantErr {
+				t.Errorf("validate() = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+// failingReporter fails every event, like an unreachable VPSie API
+type failingReporter struct{}
+
+func (failingReporter) SendEvent(context.Context, Event) error {
+	return errors.New("connection refused")
+}
+
+func TestAgent_SendEvent_Notifies(t *testing.T) {
+	received := make(chan notify.Notification, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n notify.Notification
+		_ = json.NewDecoder(r.Body).Decode(&n)
+		received <- n
+	}))
+	defer server.Close()
+
+	urlFile := filepath.Join(t.TempDir(), "webhook-url")
+	if err := os.WriteFile(urlFile, []byte(server.URL+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{
+		VPSie: VPSieConfig{LoadBalancerID: "lb-123"},
+		HA:    HAConfig{NodeID: "lb-a"},
+		Notifications: NotificationsConfig{Webhooks: []WebhookConfig{
+			{Name: "ops", Type: notify.WebhookGeneric, URLFile: urlFile},
+		}},
+	}
+	cfg.Notifications.setDefaults()
+	notifier, err := newNotifier(&cfg.Notifications)
+	if err != nil {
+		t.Fatalf("newNotifier() error = %v", err)
+	}
+	a := &Agent{config: cfg, events: failingReporter{}, notifier: notifier}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+
+	// Below the default threshold of error: not sent
+	a.sendEvent(ctx, NewEvent(EventConfigUpdated, "Configuration successfully updated", nil))
+	a.sendEvent(ctx, NewEvent(EventConfigRolledBack, "Config reload failed, previous configuration restored", nil))
+
+	select {
+	case n := <-received:
+		if n.Type != string(EventConfigRolledBack) || n.LoadBalancerID != "lb-123" || n.Node != "lb-a" || n.Severity != notify.SeverityError {
+			t.Errorf("notification = %+v, want the rollback of lb-123 on lb-a", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification while the VPSie API is unreachable")
+	}
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+)
+
+// minOverloadHeapBytes is the smallest heap limit that leaves Envoy room to run
+const minOverloadHeapBytes = 64 << 20
+
+// OverloadSettings configures how Envoy sheds load as its heap fills up,
+// instead of growing until the kernel OOM-kills it. Thresholds are percent
+// of max_heap_bytes.
+type OverloadSettings struct {
+	MaxHeapBytes                    uint64  `yaml:"max_heap_bytes"`                     // 0 disables heap protection (default)
+	ShrinkHeapPercent               float64 `yaml:"shrink_heap_percent"`                // release free memory to the OS (default 90)
+	DisableKeepalivePercent         float64 `yaml:"disable_keepalive_percent"`          // close HTTP connections after the current request (default 95)
+	StopAcceptingRequestsPercent    float64 `yaml:"stop_accepting_requests_percent"`    // answer new requests with 503 (default 98)
+	StopAcceptingConnectionsPercent float64 `yaml:"stop_accepting_connections_percent"` // stop accepting connections (default 99)
+}
+
+// setDefaults fills in unset thresholds when heap protection is enabled
+func (o *OverloadSettings) setDefaults() {
+	if o.MaxHeapBytes == 0 {
+		return
+	}
+	if o.ShrinkHeapPercent == 0 {
+		o.ShrinkHeapPercent = 90
+	}
+	if o.DisableKeepalivePercent == 0 {
+		o.DisableKeepalivePercent = 95
+	}
+	if o.StopAcceptingRequestsPercent == 0 {
+		o.StopAcceptingRequestsPercent = 98
+	}
+	if o.StopAcceptingConnectionsPercent == 0 {
+		o.StopAcceptingConnectionsPercent = 99
+	}
+}
+
+// validate checks the overload settings
+func (o *OverloadSettings) validate() []error {
+	if o.MaxHeapBytes == 0 {
+		return nil
+	}
+
+	var errs []error
+	if o.MaxHeapBytes < minOverloadHeapBytes {
+		errs = append(errs, fmt.Errorf("envoy.overload.max_heap_bytes %d is too small: must be at least %d", o.MaxHeapBytes, minOverloadHeapBytes))
+	}
+	for _, threshold := range []struct {
+		name    string
+		percent float64
+	}{
+		{"shrink_heap_percent", o.ShrinkHeapPercent},
+		{"disable_keepalive_percent", o.DisableKeepalivePercent},
+		{"stop_accepting_requests_percent", o.StopAcceptingRequestsPercent},
+		{"stop_accepting_connections_percent", o.StopAcceptingConnectionsPercent},
+	} {
+		if threshold.percent < 0 || threshold.percent > 100 {
+			errs = append(errs, fmt.Errorf("envoy.overload.%s %g is out of range: must be between 0 and 100", threshold.name, threshold.percent))
+		}
+	}
+	return errs
+}
+
+// envoyConfig converts the settings for the bootstrap generator
+func (o *OverloadSettings) envoyConfig() envoy.OverloadConfig {
+	return envoy.OverloadConfig{
+		MaxHeapBytes:                    o.MaxHeapBytes,
+		ShrinkHeapPercent:               o.ShrinkHeapPercent,
+		DisableKeepalivePercent:         o.DisableKeepalivePercent,
+		StopAcceptingRequestsPercent:    o.StopAcceptingRequestsPercent,
+		StopAcceptingConnectionsPercent: o.StopAcceptingConnectionsPercent,
+	}
+}
+
+// Bootstrap renders the Envoy bootstrap configuration for the agent
+// settings, including the connection limit and overload protection
+func (a *Agent) Bootstrap() ([]byte, error) {
+	return a.envoyGenerator.GenerateBootstrap()
+}
@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// PauseConfig holds configuration changes back, e.g. so that an edit made
+// elsewhere does not land in the middle of an incident. The agent keeps
+// fetching and diffing the configuration but applies nothing until
+// reconciliation is resumed.
+type PauseConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Reason  string `yaml:"reason"` // reported with the paused state
+}
+
+// Who paused reconciliation
+const (
+	pausedByConfig   = "config"
+	pausedByAdminAPI = "admin_api"
+)
+
+// maxPauseReasonLength bounds the reason reported in events and heartbeats
+const maxPauseReasonLength = 256
+
+// validate checks the pause settings
+func (c *PauseConfig) validate() []error {
+	if len(c.Reason) > maxPauseReasonLength {
+		return []error{fmt.Errorf("pause.reason is longer than %d characters", maxPauseReasonLength)}
+	}
+	return nil
+}
+
+// PauseStatus describes paused reconciliation
+type PauseStatus struct {
+	Since             time.Time `json:"since"`
+	Reason            string    `json:"reason,omitempty"`
+	By                string    `json:"by"`                            // config or admin_api
+	PendingConfigHash string    `json:"pending_config_hash,omitempty"` // configuration held back, empty while the source is unchanged
+}
+
+// Pause stops applying configuration changes. It returns false when
+// reconciliation is already paused.
+func (a *Agent) Pause(ctx context.Context, reason, by string) bool {
+	status := &PauseStatus{Since: time.Now().UTC(), Reason: reason, By: by}
+	if !a.paused.CompareAndSwap(nil, status) {
+		return false
+	}
+	a.saveState(ctx)
+
+	message := "Reconciliation paused: configuration changes are held"
+	if reason != "" {
+		message += " (" + reason + ")"
+	}
+	log.Println(message)
+	a.sendEvent(ctx, NewEvent(EventReconciliationPaused, message, map[string]interface{}{
+		"reason": reason,
+		"by":     by,
+	}))
+	return true
+}
+
+// Resume applies configuration changes again, starting with the one held
+// while paused. It returns false when reconciliation is not paused.
+func (a *Agent) Resume(ctx context.Context, by string) bool {
+	status := a.paused.Swap(nil)
+	if status == nil {
+		return false
+	}
+	a.saveState(ctx)
+
+	message := fmt.Sprintf("Reconciliation resumed after %s", time.Since(status.Since).Round(time.Second))
+	log.Println(message)
+	a.sendEvent(ctx, NewEvent(EventReconciliationResumed, message, map[string]interface{}{
+		"by":                  by,
+		"pending_config_hash": status.PendingConfigHash,
+	}))
+	a.TriggerSync()
+	return true
+}
+
+// applyPauseConfig pauses or resumes reconciliation when the pause setting
+// of the agent configuration changed
+func (a *Agent) applyPauseConfig(ctx context.Context, oldCfg, newCfg PauseConfig) {
+	switch {
+	case newCfg.Enabled && !oldCfg.Enabled:
+		a.Pause(ctx, newCfg.Reason, pausedByConfig)
+	case !newCfg.Enabled && oldCfg.Enabled:
+		a.Resume(ctx, pausedByConfig)
+	}
+}
+
+// holdConfiguration reports the change lb would make while reconciliation is
+// paused, without applying it. Each held configuration is reported once.
+func (a *Agent) holdConfiguration(ctx context.Context, lb *models.LoadBalancer, configHash string) error {
+	status := a.paused.Load()
+	if status == nil || status.PendingConfigHash == configHash {
+		return nil
+	}
+
+	log.Printf("Reconciliation paused, holding configuration change (hash: %s)", configHash)
+	if a.currentConfig().Envoy.OutputMode == OutputModeFiles {
+		envoyConfig, err := a.envoyGenerator.GenerateFullConfig(lb)
+		if err != nil {
+			return fmt.Errorf("failed to generate Envoy config: %w", err)
+		}
+		a.recordDiff(ctx, configHash, envoyConfig)
+	}
+
+	held := *status
+	held.PendingConfigHash = configHash
+	// Resumed in the meantime: the next sync applies the change
+	if a.paused.CompareAndSwap(status, &held) {
+		a.saveState(ctx)
+	}
+	return nil
+}
+
+// handleReconcileStatus serves whether configuration changes are applied
+func (a *Agent) handleReconcileStatus(w http.ResponseWriter, _ *http.Request) {
+	status := a.paused.Load()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"paused": status != nil, "status": status, "last_sync": a.lastSync.Load()})
+}
+
+// handlePause pauses reconciliation; ?reason= is reported with the paused
+// state. It answers 409 when reconciliation is already paused.
+func (a *Agent) handlePause(w http.ResponseWriter, r *http.Request) {
+	reason := r.URL.Query().Get("reason")
+	if len(reason) > maxPauseReasonLength {
+		http.Error(w, fmt.Sprintf("reason is longer than %d characters", maxPauseReasonLength), http.StatusBadRequest)
+		return
+	}
+	if !a.Pause(r.Context(), reason, pausedByAdminAPI) {
+		http.Error(w, "reconciliation is already paused", http.StatusConflict)
+		return
+	}
+	a.handleReconcileStatus(w, r)
+}
+
+// handleResume resumes reconciliation and applies the held configuration.
+// It answers 409 when reconciliation is not paused.
+func (a *Agent) handleResume(w http.ResponseWriter, r *http.Request) {
+	if !a.Resume(r.Context(), pausedByAdminAPI) {
+		http.Error(w, "reconciliation is not paused", http.StatusConflict)
+		return
+	}
+	a.handleReconcileStatus(w, r)
+}
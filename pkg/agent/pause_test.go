@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestAgent_PauseAndResume(t *testing.T) {
+	dir := t.TempDir()
+	manager, err := envoy.NewConfigManager(filepath.Join(dir, "dynamic"), nil)
+	if err != nil {
+		t.Fatalf("NewConfigManager() error = %v", err)
+	}
+	reporter := &recordingReporter{}
+	a := &Agent{
+		config:         &Config{Envoy: EnvoySettings{OutputMode: OutputModeFiles}, Admin: AdminConfig{TokenFile: writeAdminTestToken(t)}},
+		events:         reporter,
+		envoyGenerator: envoy.NewGenerator("lb-1", dir, "127.0.0.1:9901", 9901, 50000),
+		envoyManager:   manager,
+		syncCh:         make(chan struct{}, 1),
+	}
+	handler := a.adminHandler()
+	request := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, authorizedRequest(method, path))
+		return rec
+	}
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "web", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+		Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}},
+	}
+
+	if rec := request(http.MethodPost, "/reconcile/resume"); rec.Code != http.StatusConflict {
+		t.Errorf("resume while running: status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	rec := request(http.MethodPost, "/reconcile/pause?reason=incident+42")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"reason":"incident 42","by":"admin_api"`) {
+		t.Fatalf("pause: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if rec := request(http.MethodPost, "/reconcile/pause"); rec.Code != http.StatusConflict {
+		t.Errorf("pause while paused: status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	// A held configuration is diffed and reported once
+	for i := 0; i < 2; i++ {
+		if err = a.holdConfiguration(context.Background(), lb, "hash-1"); err != nil {
+			t.Fatalf("holdConfiguration() error = %v", err)
+		}
+	}
+	if diff := a.lastDiff.Load(); diff == nil || diff.ConfigHash != "hash-1" || diff.Diff == "" {
+		t.Errorf("last diff = %+v, want the held change", diff)
+	}
+	a.recordSync(nil)
+	if status := a.lastSync.Load(); status.HeldHash != "hash-1" {
+		t.Errorf("sync status = %+v, want hash-1 held", status)
+	}
+	if rec := request(http.MethodGet, "/reconcile/status"); !strings.Contains(rec.Body.String(), `"pending_config_hash":"hash-1"`) {
+		t.Errorf("status body missing the held configuration:\n%s", rec.Body.String())
+	}
+
+	if rec := request(http.MethodPost, "/reconcile/resume"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"paused":false`) {
+		t.Fatalf("resume: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	select {
+	case <-a.syncCh:
+	default:
+		t.Error("resume did not trigger a sync of the held configuration")
+	}
+	if got := strings.Join(reporter.events, ","); got != "reconciliation_paused,config_diff,reconciliation_resumed" {
+		t.Errorf("events = %s, want reconciliation_paused,config_diff,reconciliation_resumed", got)
+	}
+}
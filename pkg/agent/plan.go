@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// planSource is implemented by configuration sources that know the plan of
+// the load balancer
+type planSource interface {
+	Plan(ctx context.Context) (*models.Plan, error)
+}
+
+// Plan returns the plan of the load balancer, nil when VPSie has none
+func (c *VPSieClient) Plan(ctx context.Context) (*models.Plan, error) {
+	reqURL := fmt.Sprintf("%s/loadbalancers/%s/plan", c.baseURL, sanitizeID(c.loadBalancerID))
+	var plan models.Plan
+	if err := c.doJSON(ctx, http.MethodGet, reqURL, nil, &plan); err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// currentPlan fetches the plan of the load balancer. When VPSie cannot be
+// asked the last plan known is used, from an earlier sync or the node
+// metadata.
+func (a *Agent) currentPlan(ctx context.Context) *models.Plan {
+	source, ok := a.source.(planSource)
+	if !ok {
+		return a.plan.Load()
+	}
+	plan, err := source.Plan(ctx)
+	if err != nil {
+		log.Printf("Warning: Failed to fetch the plan of the load balancer, using the last one known: %v", err)
+		return a.plan.Load()
+	}
+	a.plan.Store(plan)
+	return plan
+}
+
+// enforcePlan refuses a configuration exceeding the limits of the plan of
+// the load balancer, and reports why. Listeners without a connection limit
+// get the limit of the plan.
+func (a *Agent) enforcePlan(ctx context.Context, lb *models.LoadBalancer) error {
+	plan := a.currentPlan(ctx)
+	if plan == nil {
+		return nil
+	}
+
+	err := plan.Check(lb)
+	var exceeded *models.PlanError
+	if errors.As(err, &exceeded) {
+		a.sendEvent(ctx, NewEvent(EventPlanLimitExceeded, err.Error(), map[string]interface{}{
+			"plan":       plan.Name,
+			"violations": exceeded.Violations,
+		}))
+		return err
+	}
+	if lb.MaxConnections == 0 {
+		lb.MaxConnections = plan.MaxConnections
+	}
+	return nil
+}
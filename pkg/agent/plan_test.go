@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// planStoreSource answers plan requests with plan, or fails with err
+type planStoreSource struct {
+	ConfigSource
+	plan *models.Plan
+	err  error
+}
+
+func (s *planStoreSource) Plan(context.Context) (*models.Plan, error) {
+	return s.plan, s.err
+}
+
+func TestAgent_EnforcePlan(t *testing.T) {
+	reporter := &recordingReporter{}
+	source := &planStoreSource{plan: &models.Plan{Name: "basic", MaxBackends: 1, MaxConnections: 1000, DisabledFeatures: []string{models.FeatureWAF}}}
+	a := &Agent{config: &Config{}, source: source, events: reporter}
+
+	lb := &models.LoadBalancer{ID: "lb-1", Backends: []models.Backend{{ID: "web-1", Enabled: true}}}
+	if err := a.enforcePlan(context.Background(), lb); err != nil {
+		t.Fatalf("enforcePlan() error = %v", err)
+	}
+	if lb.MaxConnections != 1000 {
+		t.Errorf("MaxConnections = %d, want the plan limit", lb.MaxConnections)
+	}
+
+	// Over the limits: refused and reported
+	lb.Backends = append(lb.Backends, models.Backend{ID: "web-2", Enabled: true})
+	lb.WAF = &models.WAF{}
+	err := a.enforcePlan(context.Background(), lb)
+	var exceeded *models.PlanError
+	if !errors.As(err, &exceeded) || len(exceeded.Violations) != 2 {
+		t.Fatalf("enforcePlan() error = %v, want the backend limit and waf refused", err)
+	}
+	if len(reporter.events) != 1 || reporter.events[0] != string(EventPlanLimitExceeded) {
+		t.Errorf("events = %v, want plan_limit_exceeded", reporter.events)
+	}
+
+	// The last plan known applies while VPSie cannot be asked
+	source.err = errors.New("connection refused")
+	if err := a.enforcePlan(context.Background(), lb); err == nil {
+		t.Error("enforcePlan() succeeded without VPSie, want the last plan enforced")
+	}
+
+	// No plan, no limits
+	source.plan, source.err = nil, nil
+	if err := a.enforcePlan(context.Background(), lb); err != nil {
+		t.Errorf("enforcePlan() without a plan = %v", err)
+	}
+}
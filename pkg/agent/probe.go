@@ -0,0 +1,329 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// ProbeConfig configures the synthetic probe that sends requests through
+// the load balancer's own listener. A live Envoy with healthy clusters can
+// still fail to serve traffic, for example when a listener did not bind;
+// the probe measures what clients see.
+type ProbeConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	Address          string        `yaml:"address"`           // IP the probe connects to, e.g. the floating IP; default loopback or the first listen address
+	Path             string        `yaml:"path"`              // health route requested from HTTP and HTTPS listeners, default /
+	Host             string        `yaml:"host"`              // Host header and TLS server name
+	Interval         time.Duration `yaml:"interval"`          // default 10s
+	Timeout          time.Duration `yaml:"timeout"`           // default 2s
+	ExpectedStatus   []int         `yaml:"expected_status"`   // default any 2xx or 3xx
+	FailureThreshold int           `yaml:"failure_threshold"` // failed probes in a row before the data plane counts as unavailable, default 3
+}
+
+// Default probe settings applied by LoadConfig
+const (
+	defaultProbePath             = "/"
+	defaultProbeInterval         = 10 * time.Second
+	defaultProbeTimeout          = 2 * time.Second
+	defaultProbeFailureThreshold = 3
+)
+
+// Probe bounds enforced by validate
+const (
+	minProbeInterval = time.Second
+	maxProbeInterval = 10 * time.Minute
+)
+
+// probeWindow is how many recent probes the availability and average
+// latency are computed over
+const probeWindow = 100
+
+// setDefaults fills in unset probe settings
+func (c *ProbeConfig) setDefaults() {
+	if c.Path == "" {
+		c.Path = defaultProbePath
+	}
+	if c.Interval == 0 {
+		c.Interval = defaultProbeInterval
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultProbeTimeout
+	}
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = defaultProbeFailureThreshold
+	}
+}
+
+// validate checks the probe settings
+func (c *ProbeConfig) validate() []error {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []error
+	if c.Address != "" {
+		if _, err := netip.ParseAddr(c.Address); err != nil {
+			errs = append(errs, fmt.Errorf("probe.address %q must be an IP address", c.Address))
+		}
+	}
+	if !strings.HasPrefix(c.Path, "/") {
+		errs = append(errs, fmt.Errorf("probe.path %q must start with /", c.Path))
+	}
+	if c.Host != "" && !models.HostnameRegex.MatchString(c.Host) {
+		errs = append(errs, fmt.Errorf("probe.host %q must be a hostname", c.Host))
+	}
+	if c.Interval < minProbeInterval || c.Interval > maxProbeInterval {
+		errs = append(errs, fmt.Errorf("probe.interval %s is out of range: must be between %s and %s", c.Interval, minProbeInterval, maxProbeInterval))
+	}
+	if c.Timeout <= 0 || c.Timeout > c.Interval {
+		errs = append(errs, fmt.Errorf("probe.timeout %s must be positive and at most probe.interval", c.Timeout))
+	}
+	for _, status := range c.ExpectedStatus {
+		if status < 100 || status > 599 {
+			errs = append(errs, fmt.Errorf("probe.expected_status %d is not an HTTP status", status))
+		}
+	}
+	if c.FailureThreshold < 1 {
+		errs = append(errs, fmt.Errorf("probe.failure_threshold %d must be at least 1", c.FailureThreshold))
+	}
+	return errs
+}
+
+// ProbeStatus is the data plane health measured by the synthetic probe, as
+// reported in heartbeats and by GET /probe/status
+type ProbeStatus struct {
+	LastCheck           time.Time `json:"last_check"`
+	Since               time.Time `json:"since"` // when the data plane became available or unavailable
+	Target              string    `json:"target"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastLatencyMs       float64   `json:"last_latency_ms"`
+	AvgLatencyMs        float64   `json:"avg_latency_ms"`       // of the successful probes in the window
+	AvailabilityPercent float64   `json:"availability_percent"` // successful probes in the window
+	Probes              int       `json:"probes"`               // probes in the window, up to 100
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Available           bool      `json:"available"`
+}
+
+// probeResult is the outcome of one probe
+type probeResult struct {
+	err     error
+	latency time.Duration
+}
+
+// prober keeps the recent probe results
+type prober struct {
+	mu      sync.Mutex
+	results []probeResult // oldest first, at most probeWindow
+	status  *ProbeStatus  // nil until the first probe
+}
+
+// record adds a probe result and returns the status, and whether the data
+// plane became available or unavailable with it
+func (p *prober) record(target string, result probeResult, threshold int, now time.Time) (ProbeStatus, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.results = append(p.results, result)
+	if len(p.results) > probeWindow {
+		p.results = p.results[len(p.results)-probeWindow:]
+	}
+
+	// The data plane counts as available until threshold probes in a row fail
+	status := ProbeStatus{LastCheck: now, Since: now, Target: target, Probes: len(p.results), Available: true}
+	if p.status != nil {
+		status.Since = p.status.Since
+		status.Available = p.status.Available
+		status.ConsecutiveFailures = p.status.ConsecutiveFailures
+	}
+	status.LastLatencyMs = float64(result.latency.Microseconds()) / 1000
+	if result.err != nil {
+		status.LastError = result.err.Error()
+		status.ConsecutiveFailures++
+	} else {
+		status.ConsecutiveFailures = 0
+	}
+
+	var succeeded int
+	var total time.Duration
+	for _, r := range p.results {
+		if r.err == nil {
+			succeeded++
+			total += r.latency
+		}
+	}
+	status.AvailabilityPercent = float64(succeeded) * 100 / float64(len(p.results))
+	if succeeded > 0 {
+		status.AvgLatencyMs = float64(total.Microseconds()) / 1000 / float64(succeeded)
+	}
+
+	available := status.ConsecutiveFailures < threshold
+	changed := available != status.Available
+	if changed {
+		status.Available = available
+		status.Since = now
+	}
+	p.status = &status
+	return status, changed
+}
+
+// Status returns the last probe status, nil before the first probe
+func (p *prober) Status() *ProbeStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.status == nil {
+		return nil
+	}
+	status := *p.status
+	return &status
+}
+
+// runProbe probes the data plane every interval until ctx is cancelled
+func (a *Agent) runProbe(ctx context.Context, cfg ProbeConfig) {
+	log.Printf("Data plane probe every %s (path: %s)", cfg.Interval, cfg.Path)
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.probeDataPlane(ctx, &cfg)
+		}
+	}
+}
+
+// probeDataPlane sends one probe through the listener of the applied
+// configuration and reports when the data plane becomes available or
+// unavailable. The passive node of an HA pair runs the same listener, so it
+// is probed too.
+func (a *Agent) probeDataPlane(ctx context.Context, cfg *ProbeConfig) {
+	lb := a.lastApplied.Load()
+	if lb == nil {
+		return
+	}
+	target := probeTarget(cfg, lb)
+	start := time.Now()
+	err := probe(ctx, cfg, lb, target)
+	status, changed := a.prober.record(target, probeResult{err: err, latency: time.Since(start)}, cfg.FailureThreshold, time.Now().UTC())
+	if !changed {
+		return
+	}
+
+	eventType, message := EventDataPlaneAvailable, fmt.Sprintf("Data plane probe of %s succeeds again", target)
+	if !status.Available {
+		eventType = EventDataPlaneUnavailable
+		message = fmt.Sprintf("Data plane probe of %s failed %d times in a row: %s", target, status.ConsecutiveFailures, status.LastError)
+	}
+	log.Print(message)
+	a.sendEvent(ctx, NewEvent(eventType, message, map[string]interface{}{
+		"target":               target,
+		"error":                status.LastError,
+		"availability_percent": status.AvailabilityPercent,
+	}))
+	a.reportStatus(ctx)
+}
+
+// probeTarget returns the host:port the probe connects to: the configured
+// address, else the first address the listener binds, loopback for a
+// wildcard, on the first port of the listener
+func probeTarget(cfg *ProbeConfig, lb *models.LoadBalancer) string {
+	host := cfg.Address
+	if host == "" {
+		host = lb.ListenAddresses()[0]
+		if ip, err := netip.ParseAddr(host); err == nil && ip.IsUnspecified() {
+			host = "127.0.0.1"
+			if ip.Is6() {
+				host = "::1"
+			}
+		}
+	}
+	port := lb.Port
+	if lb.PortRange != nil {
+		port = lb.PortRange.From
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// probe connects to a TCP listener, or requests cfg.Path from an HTTP or
+// HTTPS listener and checks the status
+func probe(ctx context.Context, cfg *ProbeConfig, lb *models.LoadBalancer, target string) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	if lb.Protocol == models.ProtocolTCP {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", target)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	scheme := "http"
+	if lb.Protocol == models.ProtocolHTTPS {
+		scheme = "https"
+	}
+	host := cfg.Host
+	if host == "" {
+		host = target
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+host+cfg.Path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "vpsie-lb-agent-probe/"+Version)
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, target)
+			},
+			// #nosec G402 -- the probe checks that the listener serves, the certificate is not its concern
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true, ServerName: cfg.Host},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		_ = resp.Body.Close()
+	}()
+	if len(cfg.ExpectedStatus) > 0 {
+		if !slices.Contains(cfg.ExpectedStatus, resp.StatusCode) {
+			return fmt.Errorf("status %d, want one of %v", resp.StatusCode, cfg.ExpectedStatus)
+		}
+	} else if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// handleProbeStatus serves the data plane health measured by the probe. It
+// answers 503 while the data plane is unavailable.
+func (a *Agent) handleProbeStatus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !a.currentConfig().Probe.Enabled {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"enabled": false})
+		return
+	}
+	status := a.prober.Status()
+	if status != nil && !status.Available {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"enabled": true, "status": status})
+}
@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestProber_Record(t *testing.T) {
+	var p prober
+	now := time.Now()
+	failure := probeResult{err: errors.New("connection refused"), latency: time.Millisecond}
+	success := probeResult{latency: 4 * time.Millisecond}
+
+	steps := []struct {
+		result        probeResult
+		wantAvailable bool
+		wantChanged   bool
+	}{
+		{success, true, false},
+		{failure, true, false},
+		{failure, false, true}, // threshold reached
+		{failure, false, false},
+		{success, true, true},
+	}
+	for i, step := range steps {
+		status, changed := p.record("127.0.0.1:80", step.result, 2, now.Add(time.Duration(i)*time.Second))
+		if status.Available != step.wantAvailable || changed != step.wantChanged {
+			t.Fatalf("step %d: available = %v, changed = %v, want %v, %v", i, status.Available, changed, step.wantAvailable, step.wantChanged)
+		}
+	}
+
+	status := p.Status()
+	if status.AvailabilityPercent != 40 || status.AvgLatencyMs != 4 || status.Probes != 5 {
+		t.Errorf("status = %+v, want 40%% available with 4ms average over 5 probes", status)
+	}
+	if !status.Since.Equal(now.Add(4 * time.Second)) {
+		t.Errorf("Since = %v, want the last transition", status.Since)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || r.Host != "shop.example.com" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	host, portText, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	port, _ := strconv.Atoi(portText)
+
+	tests := []struct {
+		name     string
+		protocol models.Protocol
+		path     string
+		expected []int
+		wantErr  string
+	}{
+		{name: "http health route", protocol: models.ProtocolHTTP, path: "/healthz"},
+		{name: "http wrong route", protocol: models.ProtocolHTTP, path: "/missing", wantErr: "status 404"},
+		{name: "http unexpected status", protocol: models.ProtocolHTTP, path: "/healthz", expected: []int{200}, wantErr: "status 204"},
+		{name: "tcp connect", protocol: models.ProtocolTCP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &ProbeConfig{Address: host, Path: tt.path, Host: "shop.example.com", Timeout: time.Second, ExpectedStatus: tt.expected}
+			lb := &models.LoadBalancer{Protocol: tt.protocol, Port: port}
+			err := probe(context.Background(), cfg, lb, probeTarget(cfg, lb))
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("probe() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("probe() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProbeTarget(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ProbeConfig
+		lb   models.LoadBalancer
+		want string
+	}{
+		{name: "wildcard", lb: models.LoadBalancer{Port: 80}, want: "127.0.0.1:80"},
+		{name: "ipv6 wildcard", lb: models.LoadBalancer{Port: 80, Addresses: []string{"::"}}, want: "[::1]:80"},
+		{name: "listen address", lb: models.LoadBalancer{Port: 443, Addresses: []string{"10.0.0.5"}}, want: "10.0.0.5:443"},
+		{name: "configured address", cfg: ProbeConfig{Address: "192.0.2.10"}, lb: models.LoadBalancer{Port: 80}, want: "192.0.2.10:80"},
+		{name: "port range", lb: models.LoadBalancer{PortRange: &models.PortRange{From: 5000, To: 5010}}, want: "127.0.0.1:5000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := probeTarget(&tt.cfg, &tt.lb); got != tt.want {
+				t.Errorf("probeTarget() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAgent_ProbeDataPlane(t *testing.T) {
+	reporter := &recordingReporter{}
+	a := &Agent{config: &Config{Probe: ProbeConfig{Enabled: true}}, events: reporter}
+	cfg := ProbeConfig{Address: "127.0.0.1", Path: "/", Timeout: 100 * time.Millisecond, FailureThreshold: 1}
+	// Port 1 refuses connections
+	a.lastApplied.Store(&models.LoadBalancer{Protocol: models.ProtocolTCP, Port: 1})
+
+	a.probeDataPlane(context.Background(), &cfg)
+	a.probeDataPlane(context.Background(), &cfg)
+	if len(reporter.events) != 1 || reporter.events[0] != "data_plane_unavailable" {
+		t.Fatalf("events = %v, want one data_plane_unavailable", reporter.events)
+	}
+
+	rec := httptest.NewRecorder()
+	a.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/probe/status", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"available":false`) {
+		t.Errorf("GET /probe/status = %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,226 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/haproxy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ipvs"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/nginx"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/proxy"
+)
+
+// ProxyDriver generates and applies the configuration of a proxy other than
+// Envoy. Envoy, the default, keeps its own richer pipeline: bootstrap, hot
+// restart, rollback and verification through the admin interface.
+type ProxyDriver interface {
+	Name() string
+	ConfigPath() string
+	// Generate returns the configuration serving lb, or a
+	// *proxy.UnsupportedError when lb uses features the proxy lacks
+	Generate(lb *models.LoadBalancer) ([]byte, error)
+	// Validate checks a configuration file with the proxy
+	Validate(ctx context.Context, path string) error
+	// Reload makes the proxy load its configuration file again
+	Reload(ctx context.Context) error
+}
+
+// proxyRunner is a proxy driver with work of its own while the agent runs,
+// such as health checking the backends
+type proxyRunner interface {
+	Run(ctx context.Context)
+}
+
+// Proxy drivers
+const (
+	ProxyDriverEnvoy   = "envoy"
+	ProxyDriverHAProxy = haproxy.Name
+	ProxyDriverNginx   = nginx.Name
+	ProxyDriverIPVS    = ipvs.Name
+)
+
+// ProxyConfig selects the proxy serving the load balancer. The envoy
+// section only applies to the envoy driver.
+type ProxyConfig struct {
+	Driver      string `yaml:"driver"`       // envoy (default), haproxy, nginx or ipvs
+	ConfigPath  string `yaml:"config_path"`  // configuration file owned by the agent
+	BinaryPath  string `yaml:"binary_path"`  // checks configuration files; ipvsadm for ipvs
+	SystemdUnit string `yaml:"systemd_unit"` // reloaded to apply the configuration; not used by ipvs
+	Method      string `yaml:"method"`       // ipvs forwarding method: nat (default), dr or tunnel
+}
+
+// proxyDefaults holds the default paths and unit of each proxy
+var proxyDefaults = map[string]ProxyConfig{
+	ProxyDriverHAProxy: {ConfigPath: "/etc/haproxy/haproxy.cfg", BinaryPath: "/usr/sbin/haproxy", SystemdUnit: "haproxy.service"},
+	ProxyDriverNginx:   {ConfigPath: "/etc/nginx/nginx.conf", BinaryPath: "/usr/sbin/nginx", SystemdUnit: "nginx.service"},
+	ProxyDriverIPVS:    {ConfigPath: "/etc/vpsie-lb/ipvs.json", BinaryPath: "/usr/sbin/ipvsadm", Method: string(ipvs.MethodNAT)},
+}
+
+// setDefaults fills in unset proxy settings
+func (p *ProxyConfig) setDefaults() {
+	if p.Driver == "" {
+		p.Driver = ProxyDriverEnvoy
+	}
+	defaults := proxyDefaults[p.Driver]
+	if p.ConfigPath == "" {
+		p.ConfigPath = defaults.ConfigPath
+	}
+	if p.BinaryPath == "" {
+		p.BinaryPath = defaults.BinaryPath
+	}
+	if p.SystemdUnit == "" {
+		p.SystemdUnit = defaults.SystemdUnit
+	}
+	if p.Method == "" {
+		p.Method = defaults.Method
+	}
+}
+
+// envoy reports whether Envoy serves the load balancer
+func (p *ProxyConfig) envoy() bool {
+	return p.Driver == "" || p.Driver == ProxyDriverEnvoy
+}
+
+// validate checks the proxy settings, and refuses agent features that need
+// Envoy's admin interface when another proxy serves the load balancer
+func (p *ProxyConfig) validate(c *Config) []error {
+	if p.envoy() {
+		return nil
+	}
+	if _, ok := proxyDefaults[p.Driver]; !ok {
+		return []error{fmt.Errorf("proxy.driver %q is invalid: must be %q, %q, %q or %q",
+			p.Driver, ProxyDriverEnvoy, ProxyDriverHAProxy, ProxyDriverNginx, ProxyDriverIPVS)}
+	}
+
+	var errs []error
+	if !filepath.IsAbs(p.ConfigPath) {
+		errs = append(errs, fmt.Errorf("proxy.config_path %q must be an absolute path", p.ConfigPath))
+	} else if err := checkWritableDir(filepath.Dir(p.ConfigPath)); err != nil {
+		errs = append(errs, fmt.Errorf("proxy.config_path: %w", err))
+	}
+	if err := checkExecutable(p.BinaryPath); err != nil {
+		errs = append(errs, fmt.Errorf("proxy.binary_path: %w", err))
+	}
+	if p.Driver == ProxyDriverIPVS {
+		if !slices.Contains(ipvs.Methods, ipvs.Method(p.Method)) {
+			errs = append(errs, fmt.Errorf("proxy.method %q must be %s, %s or %s", p.Method, ipvs.MethodNAT, ipvs.MethodDirect, ipvs.MethodTunnel))
+		}
+	} else if !systemdUnitPattern.MatchString(p.SystemdUnit) {
+		errs = append(errs, fmt.Errorf("proxy.systemd_unit %q is not a valid unit name", p.SystemdUnit))
+	}
+
+	for _, envoyOnly := range []struct {
+		name string
+		used bool
+	}{
+		{"cert_watch", c.CertWatch.Enabled},
+		{"session_tickets", c.SessionTickets.Enabled},
+		{"health_dns", c.HealthDNS.Enabled},
+		{"envoy.verify", c.Envoy.Verify.Enabled},
+	} {
+		if envoyOnly.used {
+			errs = append(errs, fmt.Errorf("%s requires proxy.driver %s", envoyOnly.name, ProxyDriverEnvoy))
+		}
+	}
+	return errs
+}
+
+// newProxyDriver returns the driver of the configured proxy, nil for Envoy
+func newProxyDriver(cfg *Config, maxConnections int) ProxyDriver {
+	p := cfg.Proxy
+	switch p.Driver {
+	case ProxyDriverHAProxy:
+		return haproxy.NewDriver(p.BinaryPath, p.SystemdUnit, p.ConfigPath, maxConnections)
+	case ProxyDriverNginx:
+		return nginx.NewDriver(p.BinaryPath, p.SystemdUnit, p.ConfigPath, maxConnections)
+	case ProxyDriverIPVS:
+		return ipvs.NewDriver(p.BinaryPath, p.ConfigPath, ipvs.Method(p.Method))
+	}
+	return nil
+}
+
+// writeProxyConfig writes a proxy configuration file the proxy can read
+// after dropping its privileges
+func writeProxyConfig(path string, data []byte) error {
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+	// #nosec G302 -- the configuration holds no secrets, only key file paths
+	return os.Chmod(path, 0644)
+}
+
+// applyProxy applies lb with the proxy driver. The new configuration is
+// checked by the proxy before it replaces the current file, and the current
+// file is put back when the proxy fails to reload.
+func (a *Agent) applyProxy(ctx context.Context, lb *models.LoadBalancer, configHash string) error {
+	driver := a.proxy
+	data, err := driver.Generate(lb)
+	var unsupported *proxy.UnsupportedError
+	if errors.As(err, &unsupported) {
+		a.sendEvent(ctx, NewEvent(EventProxyUnsupported, err.Error(), map[string]interface{}{
+			"proxy":    driver.Name(),
+			"features": unsupported.Features,
+		}))
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to generate %s config: %w", driver.Name(), err)
+	}
+
+	path := driver.ConfigPath()
+	current, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	candidate := path + ".new"
+	if err = writeProxyConfig(candidate, data); err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(candidate) }()
+	if err = driver.Validate(ctx, candidate); err != nil {
+		return fmt.Errorf("%s rejected the configuration: %w", driver.Name(), err)
+	}
+	if err = writeProxyConfig(path, data); err != nil {
+		return err
+	}
+
+	log.Printf("Reloading %s with new configuration...", driver.Name())
+	if err = driver.Reload(ctx); err != nil {
+		a.sendEvent(ctx, NewEvent(EventProxyReloadFailed, err.Error(), map[string]interface{}{
+			"proxy": driver.Name(),
+		}))
+		if current != nil {
+			if restoreErr := writeProxyConfig(path, current); restoreErr != nil {
+				log.Printf("CRITICAL: Failed to restore %s: %v", path, restoreErr)
+				return fmt.Errorf("CRITICAL: reload failed (%w) and restore failed (%v)", err, restoreErr)
+			}
+			a.sendEvent(ctx, NewEvent(EventConfigRolledBack, "Config reload failed, previous configuration restored", map[string]interface{}{
+				"reload_error": err.Error(),
+				"config_hash":  configHash,
+			}))
+		}
+		return fmt.Errorf("failed to reload %s: %w", driver.Name(), err)
+	}
+	a.sendEvent(ctx, NewEvent(EventProxyReloaded, driver.Name()+" reloaded", map[string]interface{}{
+		"proxy": driver.Name(),
+	}))
+
+	a.lastConfigHash.Store(configHash)
+	a.lastApplied.Store(lb)
+	a.markChangeApplied(configHash)
+	a.saveState(ctx)
+
+	a.sendEvent(ctx, NewEvent(EventConfigUpdated, "Configuration successfully updated", map[string]interface{}{
+		"config_hash": configHash,
+		"proxy":       driver.Name(),
+	}))
+	log.Println("Configuration sync completed successfully")
+	return nil
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// fakeProxy generates the load balancer ID as configuration and fails
+// validation or reloads on demand
+type fakeProxy struct {
+	path                   string
+	validateErr, reloadErr error
+	reloads                int
+}
+
+func (p *fakeProxy) Name() string       { return "fake" }
+func (p *fakeProxy) ConfigPath() string { return p.path }
+
+func (p *fakeProxy) Generate(lb *models.LoadBalancer) ([]byte, error) {
+	return []byte(lb.ID), nil
+}
+
+func (p *fakeProxy) Validate(context.Context, string) error { return p.validateErr }
+
+func (p *fakeProxy) Reload(context.Context) error {
+	p.reloads++
+	return p.reloadErr
+}
+
+func TestAgent_ApplyProxy(t *testing.T) {
+	driver := &fakeProxy{path: filepath.Join(t.TempDir(), "haproxy.cfg")}
+	reporter := &recordingReporter{}
+	a := &Agent{config: &Config{}, events: reporter, proxy: driver}
+
+	if err := a.applyProxy(context.Background(), &models.LoadBalancer{ID: "lb-1"}, "hash-1"); err != nil {
+		t.Fatalf("applyProxy() error = %v", err)
+	}
+	if data, _ := os.ReadFile(driver.path); string(data) != "lb-1" || driver.reloads != 1 {
+		t.Fatalf("config = %q after %d reloads, want lb-1 after one", data, driver.reloads)
+	}
+
+	// A configuration the proxy rejects never replaces the current one
+	driver.validateErr = errors.New("parsing error")
+	if err := a.applyProxy(context.Background(), &models.LoadBalancer{ID: "lb-2"}, "hash-2"); err == nil {
+		t.Fatal("applyProxy() succeeded with an invalid configuration")
+	}
+	if data, _ := os.ReadFile(driver.path); string(data) != "lb-1" || driver.reloads != 1 {
+		t.Errorf("config = %q after %d reloads, want lb-1 untouched", data, driver.reloads)
+	}
+
+	// A failed reload puts the previous configuration back
+	driver.validateErr, driver.reloadErr = nil, errors.New("unit not found")
+	if err := a.applyProxy(context.Background(), &models.LoadBalancer{ID: "lb-3"}, "hash-3"); err == nil {
+		t.Fatal("applyProxy() succeeded although the reload failed")
+	}
+	if data, _ := os.ReadFile(driver.path); string(data) != "lb-1" {
+		t.Errorf("config = %q, want lb-1 restored", data)
+	}
+	if a.lastConfigHash.Load() != "hash-1" {
+		t.Errorf("lastConfigHash = %v, want hash-1", a.lastConfigHash.Load())
+	}
+}
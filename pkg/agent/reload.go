@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+)
+
+// ReloadConfig applies a re-read agent configuration to the running agent.
+// Settings that are safe to change live (poll interval, logging, pause,
+// approval, variables, flap detection, shutdown drain, live cluster updates,
+// reload limits, admin token file) take effect immediately; changes to
+// settings that are bound at startup (API endpoint, load balancer ID, Envoy
+// paths and admin address, source) are ignored and reported so the operator
+// knows a restart is required.
+func (a *Agent) ReloadConfig(newCfg *Config) error {
+	if newCfg == nil {
+		return fmt.Errorf("new configuration must not be nil")
+	}
+	if newCfg.VPSie.PollInterval <= 0 {
+		return fmt.Errorf("poll interval must be positive, got %s", newCfg.VPSie.PollInterval)
+	}
+
+	a.configMu.Lock()
+	oldCfg := a.config
+	updated := *oldCfg
+
+	// Live-reloadable settings
+	updated.VPSie.PollInterval = newCfg.VPSie.PollInterval
+	updated.Logging = newCfg.Logging
+	updated.Pause = newCfg.Pause
+	updated.Approval = newCfg.Approval
+	updated.Variables = newCfg.Variables
+	updated.FlapDetection = newCfg.FlapDetection
+	updated.Shutdown = newCfg.Shutdown
+	updated.Envoy.LiveClusters = newCfg.Envoy.LiveClusters
+	updated.Envoy.ReloadLimit = newCfg.Envoy.ReloadLimit
+	updated.Admin.TokenFile = newCfg.Admin.TokenFile
+	a.config = &updated
+	a.configMu.Unlock()
+
+	if newCfg.VPSie.PollInterval != oldCfg.VPSie.PollInterval {
+		log.Printf("Poll interval changed: %s -> %s", oldCfg.VPSie.PollInterval, newCfg.VPSie.PollInterval)
+		select {
+		case a.intervalCh <- newCfg.VPSie.PollInterval:
+		default:
+			// A previous change is still pending; replace it with the latest value
+			select {
+			case <-a.intervalCh:
+			default:
+			}
+			a.intervalCh <- newCfg.VPSie.PollInterval
+		}
+	}
+	if newCfg.Logging != oldCfg.Logging {
+		applyLogging(newCfg.Logging)
+		log.Printf("Logging changed: level=%s format=%s", newCfg.Logging.Level, newCfg.Logging.Format)
+	}
+	a.applyPauseConfig(context.Background(), oldCfg.Pause, newCfg.Pause)
+	if newCfg.Approval != oldCfg.Approval {
+		log.Printf("Change approval changed: enabled=%t", newCfg.Approval.Enabled)
+	}
+	if !reflect.DeepEqual(newCfg.Variables, oldCfg.Variables) {
+		log.Printf("Variables changed: allow=%v", newCfg.Variables.Allow)
+		a.TriggerSync()
+	}
+	if newCfg.FlapDetection != oldCfg.FlapDetection {
+		log.Printf("Flap detection changed: window=%s threshold=%d quarantine=%t", newCfg.FlapDetection.Window, newCfg.FlapDetection.Threshold, newCfg.FlapDetection.Quarantine)
+	}
+	if newCfg.Shutdown != oldCfg.Shutdown {
+		log.Printf("Shutdown changed: drain=%t drain_period=%s", newCfg.Shutdown.Drain, newCfg.Shutdown.DrainPeriod)
+	}
+	if newCfg.Envoy.LiveClusters != oldCfg.Envoy.LiveClusters {
+		log.Printf("Live cluster updates changed: enabled=%t", newCfg.Envoy.LiveClusters)
+	}
+	if newCfg.Envoy.ReloadLimit != oldCfg.Envoy.ReloadLimit {
+		limit := newCfg.Envoy.ReloadLimit
+		log.Printf("Reload limit changed: debounce=%s max_delay=%s min_interval=%s", limit.Debounce, limit.MaxDelay, limit.MinInterval)
+	}
+	if newCfg.Admin.TokenFile != oldCfg.Admin.TokenFile {
+		log.Printf("Admin token file changed: %q", newCfg.Admin.TokenFile)
+	}
+
+	if changed := restartRequiredChanges(oldCfg, newCfg); len(changed) > 0 {
+		log.Printf("Warning: Changes to %v require an agent restart and were not applied", changed)
+	}
+
+	return nil
+}
+
+// restartRequiredChanges lists settings that differ between old and new but
+// cannot be applied without restarting the agent
+func restartRequiredChanges(oldCfg, newCfg *Config) []string {
+	var changed []string
+	check := func(name string, differs bool) {
+		if differs {
+			changed = append(changed, name)
+		}
+	}
+
+	check("environment", oldCfg.Environment != newCfg.Environment)
+	check("vpsie.api_url", oldCfg.VPSie.APIURL != newCfg.VPSie.APIURL)
+	check("vpsie.heartbeat_interval", oldCfg.VPSie.HeartbeatInterval != newCfg.VPSie.HeartbeatInterval)
+	check("vpsie.node_metadata", oldCfg.VPSie.NodeMetadata != newCfg.VPSie.NodeMetadata)
+	check("vpsie.api_key_file", oldCfg.VPSie.APIKeyFile != newCfg.VPSie.APIKeyFile)
+	check("vpsie.api_key_source", !reflect.DeepEqual(oldCfg.VPSie.APIKeySource, newCfg.VPSie.APIKeySource))
+	check("admin.listen_address", oldCfg.Admin.ListenAddress != newCfg.Admin.ListenAddress)
+	check("ha", oldCfg.HA != newCfg.HA)
+	check("discovery", oldCfg.Discovery != newCfg.Discovery)
+	check("access_log_service", oldCfg.AccessLogService != newCfg.AccessLogService)
+	check("waf", oldCfg.WAF != newCfg.WAF)
+	check("wasm", !reflect.DeepEqual(oldCfg.WASM, newCfg.WASM))
+	check("firewall", oldCfg.Firewall != newCfg.Firewall)
+	check("fast_path", oldCfg.FastPath != newCfg.FastPath)
+	check("gslb", oldCfg.GSLB != newCfg.GSLB)
+	check("health_dns", !reflect.DeepEqual(oldCfg.HealthDNS, newCfg.HealthDNS))
+	check("tls_keys", !reflect.DeepEqual(oldCfg.TLSKeys, newCfg.TLSKeys))
+	check("vpsie.loadbalancer_id", oldCfg.VPSie.LoadBalancerID != newCfg.VPSie.LoadBalancerID)
+	check("source", oldCfg.Source != newCfg.Source)
+	check("state", oldCfg.State != newCfg.State)
+	check("cert_watch", oldCfg.CertWatch != newCfg.CertWatch)
+	check("session_tickets", oldCfg.SessionTickets != newCfg.SessionTickets)
+	check("probe", !reflect.DeepEqual(oldCfg.Probe, newCfg.Probe))
+	check("slow_backends", oldCfg.SlowBackends != newCfg.SlowBackends)
+	check("notifications", !reflect.DeepEqual(oldCfg.Notifications, newCfg.Notifications))
+	check("proxy", oldCfg.Proxy != newCfg.Proxy)
+	check("envoy.config_path", oldCfg.Envoy.ConfigPath != newCfg.Envoy.ConfigPath)
+	check("envoy.isolate", oldCfg.Envoy.Isolate != newCfg.Envoy.Isolate)
+	check("envoy.binary_path", oldCfg.Envoy.BinaryPath != newCfg.Envoy.BinaryPath)
+	check("envoy.runtime", oldCfg.Envoy.Runtime != newCfg.Envoy.Runtime)
+	check("envoy.container", !reflect.DeepEqual(oldCfg.Envoy.Container, newCfg.Envoy.Container))
+	check("envoy.remote", oldCfg.Envoy.Remote != newCfg.Envoy.Remote)
+	check("envoy.pid_file", oldCfg.Envoy.PidFile != newCfg.Envoy.PidFile)
+	check("envoy.epoch_file", oldCfg.Envoy.EpochFile != newCfg.Envoy.EpochFile)
+	check("envoy.admin_address", oldCfg.Envoy.AdminAddress != newCfg.Envoy.AdminAddress)
+	check("envoy.admin_port", oldCfg.Envoy.AdminPort != newCfg.Envoy.AdminPort)
+	check("envoy.output_mode", oldCfg.Envoy.OutputMode != newCfg.Envoy.OutputMode)
+	check("envoy.xds_endpoints", oldCfg.Envoy.XDSEndpoints != newCfg.Envoy.XDSEndpoints)
+	check("envoy.reload_strategy", oldCfg.Envoy.ReloadStrategy != newCfg.Envoy.ReloadStrategy)
+	check("envoy.systemd_unit", oldCfg.Envoy.SystemdUnit != newCfg.Envoy.SystemdUnit)
+	check("envoy.drain_time", oldCfg.Envoy.DrainTime != newCfg.Envoy.DrainTime)
+	check("envoy.restart_window", oldCfg.Envoy.RestartWindow != newCfg.Envoy.RestartWindow)
+	check("envoy.legacy_templates", oldCfg.Envoy.LegacyTemplates != newCfg.Envoy.LegacyTemplates)
+	check("envoy.max_connections", oldCfg.Envoy.MaxConnections != newCfg.Envoy.MaxConnections)
+	check("envoy.overload", oldCfg.Envoy.Overload != newCfg.Envoy.Overload)
+	check("envoy.verify", oldCfg.Envoy.Verify != newCfg.Envoy.Verify)
+	check("envoy.locality", oldCfg.Envoy.Locality != newCfg.Envoy.Locality)
+	check("envoy.stats_tags", !reflect.DeepEqual(oldCfg.Envoy.StatsTags, newCfg.Envoy.StatsTags))
+
+	return changed
+}
@@ -0,0 +1,258 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newReloadTestAgent() *Agent {
+	return &Agent{
+		config: &Config{
+			VPSie: VPSieConfig{
+				APIURL:         "https://api.vpsie.com/v1",
+				LoadBalancerID: "lb-1",
+				PollInterval:   30 * time.Second,
+			},
+			Envoy:   EnvoySettings{AdminAddress: "127.0.0.1:9901", AdminPort: 9901},
+			Logging: LoggingConfig{Level: "info", Format: "json"},
+		},
+		intervalCh: make(chan time.Duration, 1),
+	}
+}
+
+func TestAgent_ReloadConfig_LiveSettings(t *testing.T) {
+	a := newReloadTestAgent()
+
+	newCfg := *a.config
+	newCfg.VPSie.PollInterval = 10 * time.Second
+	newCfg.Logging.Level = "debug"
+
+	if err := a.ReloadConfig(&newCfg); err != nil {
+		t.Fatalf("ReloadConfig() error = %v", err)
+	}
+
+	cfg := a.currentConfig()
+	if cfg.VPSie.PollInterval != 10*time.Second {
+		t.Errorf("PollInterval = %v, want 10s", cfg.VPSie.PollInterval)
+	}
+	if cfg.Logging.Level != "debug" {
+		t.Errorf("Logging Level = %v, want debug", cfg.Logging.Level)
+	}
+
+	select {
+	case interval := <-a.intervalCh:
+		if interval != 10*time.Second {
+			t.Errorf("interval update = %v, want 10s", interval)
+		}
+	default:
+		t.Error("Expected poll interval update to be signalled")
+	}
+}
+
+func TestAgent_ReloadConfig_LatestIntervalWins(t *testing.T) {
+	a := newReloadTestAgent()
+
+	for _, d := range []time.Duration{10 * time.Second, 20 * time.Second} {
+		newCfg := *a.currentConfig()
+		newCfg.VPSie.PollInterval = d
+		if err := a.ReloadConfig(&newCfg); err != nil {
+			t.Fatalf("ReloadConfig() error = %v", err)
+		}
+	}
+
+	if interval := <-a.intervalCh; interval != 20*time.Second {
+		t.Errorf("interval update = %v, want 20s", interval)
+	}
+}
+
+func TestAgent_ReloadConfig_Pause(t *testing.T) {
+	a := newReloadTestAgent()
+	a.events = logEventReporter{}
+	a.syncCh = make(chan struct{}, 1)
+
+	newCfg := *a.config
+	newCfg.Pause = PauseConfig{Enabled: true, Reason: "change freeze"}
+	if err := a.ReloadConfig(&newCfg); err != nil {
+		t.Fatalf("ReloadConfig() error = %v", err)
+	}
+	if status := a.paused.Load(); status == nil || status.By != pausedByConfig || status.Reason != "change freeze" {
+		t.Fatalf("paused = %+v, want paused by config", status)
+	}
+
+	newCfg.Pause = PauseConfig{}
+	if err := a.ReloadConfig(&newCfg); err != nil {
+		t.Fatalf("ReloadConfig() error = %v", err)
+	}
+	if status := a.paused.Load(); status != nil {
+		t.Errorf("paused = %+v, want resumed", status)
+	}
+}
+
+func TestAgent_ReloadConfig_RestartRequiredIgnored(t *testing.T) {
+	a := newReloadTestAgent()
+
+	newCfg := *a.config
+	newCfg.VPSie.LoadBalancerID = "lb-2"
+	newCfg.Envoy.AdminAddress = "127.0.0.1:9902"
+
+	if err := a.ReloadConfig(&newCfg); err != nil {
+		t.Fatalf("ReloadConfig() error = %v", err)
+	}
+
+	cfg := a.currentConfig()
+	if cfg.VPSie.LoadBalancerID != "lb-1" {
+		t.Errorf("LoadBalancerID = %v, want unchanged lb-1", cfg.VPSie.LoadBalancerID)
+	}
+	if cfg.Envoy.AdminAddress != "127.0.0.1:9901" {
+		t.Errorf("AdminAddress = %v, want unchanged", cfg.Envoy.AdminAddress)
+	}
+}
+
+func TestAgent_ReloadConfig_Invalid(t *testing.T) {
+	a := newReloadTestAgent()
+
+	if err := a.ReloadConfig(nil); err == nil {
+		t.Error("Expected error for nil config")
+	}
+
+	newCfg := *a.config
+	newCfg.VPSie.PollInterval = -time.Second
+	if err := a.ReloadConfig(&newCfg); err == nil {
+		t.Error("Expected error for non-positive poll interval")
+	}
+}
+
+func TestRestartRequiredChanges(t *testing.T) {
+	oldCfg := &Config{VPSie: VPSieConfig{APIURL: "https://api.vpsie.com/v1"}}
+	newCfg := &Config{VPSie: VPSieConfig{APIURL: "https://api2.vpsie.com/v1", PollInterval: time.Minute}}
+
+	changed := restartRequiredChanges(oldCfg, newCfg)
+	if len(changed) != 1 || changed[0] != "vpsie.api_url" {
+		t.Errorf("restartRequiredChanges() = %v, want [vpsie.api_url]", changed)
+	}
+}
+
+func TestAgent_ReloadConfig_LiveClusters(t *testing.T) {
+	a := newReloadTestAgent()
+
+	newCfg := *a.config
+	newCfg.Envoy.LiveClusters = true
+	if err := a.ReloadConfig(&newCfg); err != nil {
+		t.Fatalf("ReloadConfig() error = %v", err)
+	}
+	if !a.currentConfig().Envoy.LiveClusters {
+		t.Error("LiveClusters = false after reload, want true")
+	}
+	if changed := restartRequiredChanges(a.config, &newCfg); len(changed) != 0 {
+		t.Errorf("restartRequiredChanges() = %v, want none", changed)
+	}
+}
+
+func TestAgent_ReloadConfig_ReloadLimit(t *testing.T) {
+	a := newReloadTestAgent()
+	a.lastReload.Store(time.Now().UnixNano())
+
+	newCfg := *a.config
+	newCfg.Envoy.ReloadLimit = ReloadLimitSettings{MaxDelay: time.Second, MinInterval: 50 * time.Millisecond}
+	if err := a.ReloadConfig(&newCfg); err != nil {
+		t.Fatalf("ReloadConfig() error = %v", err)
+	}
+
+	// The next reload is spaced by the reloaded interval
+	start := time.Now()
+	if err := a.awaitReloadInterval(context.Background()); err != nil {
+		t.Fatalf("awaitReloadInterval() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("awaitReloadInterval() returned after %s, want the reloaded min_interval", elapsed)
+	}
+}
+
+func TestAgent_ReloadConfig_FlapDetection(t *testing.T) {
+	a := newReloadTestAgent()
+
+	newCfg := *a.config
+	newCfg.FlapDetection = FlapDetectionConfig{Window: 10 * time.Minute, Threshold: 3, Quarantine: true, QuarantineDuration: time.Minute}
+	if err := a.ReloadConfig(&newCfg); err != nil {
+		t.Fatalf("ReloadConfig() error = %v", err)
+	}
+	if got := a.currentConfig().FlapDetection; got != newCfg.FlapDetection {
+		t.Errorf("FlapDetection = %+v, want %+v", got, newCfg.FlapDetection)
+	}
+}
+
+func TestAgent_ReloadConfig_Shutdown(t *testing.T) {
+	a := newReloadTestAgent()
+
+	newCfg := *a.config
+	newCfg.Shutdown = ShutdownConfig{Drain: true, DrainPeriod: 45 * time.Second}
+	if err := a.ReloadConfig(&newCfg); err != nil {
+		t.Fatalf("ReloadConfig() error = %v", err)
+	}
+	if got := a.currentConfig().Shutdown; got != newCfg.Shutdown {
+		t.Errorf("Shutdown = %+v, want %+v", got, newCfg.Shutdown)
+	}
+}
+
+func TestAgent_ReloadConfig_AdminTokenFile(t *testing.T) {
+	a := newReloadTestAgent()
+	a.config.Admin.TokenFile = writeAdminTestToken(t)
+
+	rotated := filepath.Join(t.TempDir(), "admin-token")
+	if err := os.WriteFile(rotated, []byte("rotated\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	newCfg := *a.config
+	newCfg.Admin.TokenFile = rotated
+	if err := a.ReloadConfig(&newCfg); err != nil {
+		t.Fatalf("ReloadConfig() error = %v", err)
+	}
+
+	// The old token is refused and the new one accepted right away
+	rec := httptest.NewRecorder()
+	a.adminHandler().ServeHTTP(rec, authorizedRequest(http.MethodGet, "/config/summary"))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status with the old token = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/config/summary", nil)
+	req.Header.Set("Authorization", "Bearer rotated")
+	rec = httptest.NewRecorder()
+	a.adminHandler().ServeHTTP(rec, req)
+	if rec.Code == http.StatusUnauthorized {
+		t.Errorf("status with the new token = %d, want it accepted", rec.Code)
+	}
+}
+
+func TestAgent_ReloadConfig_Logging(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf)
+	prevOut, prevFlags := log.Writer(), log.Flags()
+	log.SetOutput(w)
+	log.SetFlags(log.Lshortfile)
+	defer func() {
+		log.SetOutput(prevOut)
+		log.SetFlags(prevFlags)
+	}()
+
+	a := newReloadTestAgent()
+	newCfg := *a.config
+	newCfg.Logging = LoggingConfig{Level: "error", Format: "text"}
+	if err := a.ReloadConfig(&newCfg); err != nil {
+		t.Fatalf("ReloadConfig() error = %v", err)
+	}
+
+	buf.Reset()
+	log.Print("Warning: dropped at level error")
+	log.Print("Error: kept")
+	if got := buf.String(); strings.Contains(got, "dropped") || !strings.Contains(got, "Error: kept") {
+		t.Errorf("log output after reload = %q, want errors only", got)
+	}
+}
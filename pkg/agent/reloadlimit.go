@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ReloadLimitSettings protect Envoy against reload storms. A burst of
+// triggered syncs, such as a series of API changes, is coalesced into one
+// sync, and reloads are spaced apart so hot restart epochs and the file
+// descriptors of draining processes do not pile up.
+type ReloadLimitSettings struct {
+	Debounce    time.Duration `yaml:"debounce"`     // quiet period a triggered sync waits for, 0 syncs right away
+	MaxDelay    time.Duration `yaml:"max_delay"`    // longest a burst postpones a triggered sync, default 10s
+	MinInterval time.Duration `yaml:"min_interval"` // shortest time between two Envoy reloads, 0 for no limit
+}
+
+// Default and bounds of envoy.reload_limit
+const (
+	defaultReloadMaxDelay = 10 * time.Second
+	maxReloadDebounce     = time.Minute
+	maxReloadMaxDelay     = 5 * time.Minute
+	maxReloadMinInterval  = 10 * time.Minute
+)
+
+// setDefaults fills in unset reload limit settings
+func (r *ReloadLimitSettings) setDefaults() {
+	if r.MaxDelay == 0 {
+		r.MaxDelay = max(defaultReloadMaxDelay, r.Debounce)
+	}
+}
+
+// validate checks the reload limit settings
+func (r *ReloadLimitSettings) validate() []error {
+	var errs []error
+	if r.Debounce < 0 || r.Debounce > maxReloadDebounce {
+		errs = append(errs, fmt.Errorf("envoy.reload_limit.debounce must be between 0 and %s, got %s", maxReloadDebounce, r.Debounce))
+	}
+	if r.MaxDelay < r.Debounce || r.MaxDelay > maxReloadMaxDelay {
+		errs = append(errs, fmt.Errorf("envoy.reload_limit.max_delay must be between envoy.reload_limit.debounce and %s, got %s", maxReloadMaxDelay, r.MaxDelay))
+	}
+	if r.MinInterval < 0 || r.MinInterval > maxReloadMinInterval {
+		errs = append(errs, fmt.Errorf("envoy.reload_limit.min_interval must be between 0 and %s, got %s", maxReloadMinInterval, r.MinInterval))
+	}
+	return errs
+}
+
+// syncDelay returns how long a triggered sync waits at now, when the burst
+// of triggers it belongs to started at first
+func (r *ReloadLimitSettings) syncDelay(first, now time.Time) time.Duration {
+	return max(min(r.Debounce, first.Add(r.MaxDelay).Sub(now)), 0)
+}
+
+// reloadDelay returns how long a reload waits at now, when the previous
+// reload happened at last (unix nanoseconds, 0 for none)
+func (r *ReloadLimitSettings) reloadDelay(last int64, now time.Time) time.Duration {
+	if r.MinInterval <= 0 || last == 0 {
+		return 0
+	}
+	return max(time.Unix(0, last).Add(r.MinInterval).Sub(now), 0)
+}
+
+// syncDebouncer postpones triggered syncs until triggers stop arriving for
+// envoy.reload_limit.debounce, or the first of them waited max_delay. It is
+// owned by the reconciliation loop.
+type syncDebouncer struct {
+	timer *time.Timer
+	first time.Time // first trigger of the pending burst; zero when no sync is pending
+}
+
+// newSyncDebouncer returns a debouncer without a pending sync
+func newSyncDebouncer() *syncDebouncer {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	return &syncDebouncer{timer: timer}
+}
+
+// C receives when the postponed sync is due
+func (d *syncDebouncer) C() <-chan time.Time {
+	return d.timer.C
+}
+
+// postpone delays the pending sync for a trigger at now. It returns false
+// when debouncing is disabled and the sync should run right away.
+func (d *syncDebouncer) postpone(now time.Time, limit ReloadLimitSettings) bool {
+	if limit.Debounce <= 0 {
+		return false
+	}
+	if d.first.IsZero() {
+		d.first = now
+	}
+	d.timer.Reset(limit.syncDelay(d.first, now))
+	return true
+}
+
+// clear forgets the pending sync once a sync ran
+func (d *syncDebouncer) clear() {
+	d.timer.Stop()
+	d.first = time.Time{}
+}
+
+// awaitReloadInterval waits until envoy.reload_limit.min_interval has passed
+// since the previous reload. Triggers arriving meanwhile are coalesced into
+// the next sync.
+func (a *Agent) awaitReloadInterval(ctx context.Context) error {
+	limit := a.currentConfig().Envoy.ReloadLimit
+	wait := limit.reloadDelay(a.lastReload.Load(), time.Now())
+	if wait <= 0 {
+		return nil
+	}
+	log.Printf("Delaying Envoy reload by %s (envoy.reload_limit.min_interval %s)", wait.Round(time.Millisecond), limit.MinInterval)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
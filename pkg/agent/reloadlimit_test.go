@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReloadLimitSettings_Validate(t *testing.T) {
+	valid := ReloadLimitSettings{Debounce: time.Second}
+	valid.setDefaults()
+	if valid.MaxDelay != defaultReloadMaxDelay {
+		t.Errorf("default max_delay = %s, want %s", valid.MaxDelay, defaultReloadMaxDelay)
+	}
+	if errs := valid.validate(); len(errs) != 0 {
+		t.Errorf("validate() = %v", errs)
+	}
+	for name, limit := range map[string]ReloadLimitSettings{
+		"negative debounce":     {Debounce: -time.Second, MaxDelay: time.Second},
+		"max_delay < debounce":  {Debounce: 5 * time.Second, MaxDelay: time.Second},
+		"max_delay too long":    {MaxDelay: time.Hour},
+		"min_interval too long": {MaxDelay: time.Second, MinInterval: time.Hour},
+	} {
+		if errs := limit.validate(); len(errs) == 0 {
+			t.Errorf("%s: validate() accepted %+v", name, limit)
+		}
+	}
+}
+
+func TestReloadLimitSettings_SyncDelay(t *testing.T) {
+	limit := ReloadLimitSettings{Debounce: 2 * time.Second, MaxDelay: 5 * time.Second}
+	first := time.Now()
+	for _, tc := range []struct {
+		since time.Duration
+		want  time.Duration
+	}{
+		{0, 2 * time.Second},
+		{2 * time.Second, 2 * time.Second},
+		{4 * time.Second, time.Second}, // max_delay caps the quiet period
+		{6 * time.Second, 0},
+	} {
+		if got := limit.syncDelay(first, first.Add(tc.since)); got != tc.want {
+			t.Errorf("syncDelay() %s into the burst = %s, want %s", tc.since, got, tc.want)
+		}
+	}
+}
+
+func TestSyncDebouncer_CoalescesBurst(t *testing.T) {
+	d := newSyncDebouncer()
+	defer d.clear()
+	if d.postpone(time.Now(), ReloadLimitSettings{}) {
+		t.Fatal("postpone() without debounce = true, want an immediate sync")
+	}
+
+	limit := ReloadLimitSettings{Debounce: 30 * time.Millisecond, MaxDelay: time.Second}
+	for range 5 {
+		if !d.postpone(time.Now(), limit) {
+			t.Fatal("postpone() = false, want the sync postponed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	fired := 0
+	timeout := time.After(200 * time.Millisecond)
+	for done := false; !done; {
+		select {
+		case <-d.C():
+			fired++
+			d.clear()
+		case <-timeout:
+			done = true
+		}
+	}
+	if fired != 1 {
+		t.Errorf("a burst of 5 triggers ran %d syncs, want 1", fired)
+	}
+}
+
+func TestAgent_AwaitReloadInterval(t *testing.T) {
+	a := &Agent{config: &Config{Envoy: EnvoySettings{
+		ReloadLimit: ReloadLimitSettings{MinInterval: 50 * time.Millisecond},
+	}}}
+
+	// The first reload is never delayed
+	start := time.Now()
+	if err := a.awaitReloadInterval(context.Background()); err != nil || time.Since(start) > 20*time.Millisecond {
+		t.Errorf("first awaitReloadInterval() = %v after %s, want no wait", err, time.Since(start))
+	}
+
+	a.lastReload.Store(time.Now().UnixNano())
+	start = time.Now()
+	if err := a.awaitReloadInterval(context.Background()); err != nil {
+		t.Fatalf("awaitReloadInterval() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("awaitReloadInterval() returned after %s, want min_interval", elapsed)
+	}
+
+	a.config.Envoy.ReloadLimit.MinInterval = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := a.awaitReloadInterval(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("awaitReloadInterval() with a cancelled context = %v", err)
+	}
+}
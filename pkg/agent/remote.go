@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// RemoteSettings makes the agent manage an Envoy running on another host,
+// reached over SSH, so the agent can live off hardened data plane nodes.
+// The configuration is generated on the agent's host and copied to the same
+// paths on the remote host, where Envoy runs under systemd.
+type RemoteSettings struct {
+	Host           string `yaml:"host"`             // empty runs Envoy on the agent's host
+	Port           int    `yaml:"port"`             // SSH port, default 22
+	User           string `yaml:"user"`             // remote user, default the SSH default
+	IdentityFile   string `yaml:"identity_file"`    // SSH private key
+	KnownHostsFile string `yaml:"known_hosts_file"` // host key of the remote host
+}
+
+// Patterns of values passed to ssh and scp. Paths are not quoted for scp,
+// so they must not contain shell metacharacters.
+var (
+	remoteUserPattern = regexp.MustCompile(`^[a-z_][a-z0-9_.-]{0,31}$`)
+	remotePathPattern = regexp.MustCompile(`^/[A-Za-z0-9._/-]+$`)
+)
+
+// enabled reports whether Envoy runs on a remote host
+func (r *RemoteSettings) enabled() bool {
+	return r.Host != ""
+}
+
+// validate checks the remote settings together with the Envoy settings they
+// depend on
+func (r *RemoteSettings) validate(e *EnvoySettings) []error {
+	if !r.enabled() {
+		return nil
+	}
+	var errs []error
+	if net.ParseIP(r.Host) == nil && !models.HostnameRegex.MatchString(r.Host) {
+		errs = append(errs, fmt.Errorf("envoy.remote.host %q is not a host name or IP address", r.Host))
+	}
+	if r.Port < 0 || r.Port > 65535 {
+		errs = append(errs, fmt.Errorf("envoy.remote.port %d is out of range", r.Port))
+	}
+	if r.User != "" && !remoteUserPattern.MatchString(r.User) {
+		errs = append(errs, fmt.Errorf("envoy.remote.user %q is not a valid user name", r.User))
+	}
+	if r.IdentityFile == "" {
+		errs = append(errs, fmt.Errorf("envoy.remote.identity_file is required"))
+	} else if err := checkSecretFile(r.IdentityFile); err != nil {
+		errs = append(errs, fmt.Errorf("envoy.remote.identity_file: %w", err))
+	}
+	// Without known host keys the agent would send its configuration to
+	// whichever host answers
+	if r.KnownHostsFile == "" {
+		errs = append(errs, fmt.Errorf("envoy.remote.known_hosts_file is required"))
+	} else if _, err := os.Stat(r.KnownHostsFile); err != nil {
+		errs = append(errs, fmt.Errorf("envoy.remote.known_hosts_file: %w", err))
+	}
+	for _, tool := range []string{"ssh", "scp"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			errs = append(errs, fmt.Errorf("envoy.remote requires %s: %w", tool, err))
+		}
+	}
+
+	if e.OutputMode != OutputModeFiles || e.ReloadStrategy != envoy.StrategySystemd {
+		errs = append(errs, fmt.Errorf("envoy.remote requires envoy.output_mode %s and envoy.reload_strategy %s",
+			OutputModeFiles, envoy.StrategySystemd))
+	}
+	if e.usesContainer() {
+		errs = append(errs, fmt.Errorf("envoy.remote cannot be used with envoy.runtime %s", e.Runtime))
+	}
+	for _, path := range []struct{ name, value string }{
+		{"envoy.config_path", e.ConfigPath},
+		{"envoy.binary_path", e.BinaryPath},
+	} {
+		if !remotePathPattern.MatchString(path.value) {
+			errs = append(errs, fmt.Errorf("%s %q must be an absolute path of letters, digits, '.', '_', '-' or '/' with envoy.remote", path.name, path.value))
+		}
+	}
+	return errs
+}
+
+// deliverEnvoyConfig copies the Envoy configuration files to a remote Envoy
+// before it is reloaded. It does nothing when Envoy runs on this host.
+func (a *Agent) deliverEnvoyConfig(ctx context.Context) error {
+	remote, ok := a.envoyRuntime.(*envoy.Remote)
+	if !ok {
+		return nil
+	}
+	var files []string
+	for _, path := range a.envoyManager.Files() {
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	if err := remote.Put(ctx, files...); err != nil {
+		return fmt.Errorf("failed to deliver the Envoy configuration: %w", err)
+	}
+	log.Printf("Envoy configuration delivered to %s", remote.Host)
+	return nil
+}
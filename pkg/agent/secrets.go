@@ -0,0 +1,393 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Secret source types
+const (
+	SecretSourceFile  = "file"
+	SecretSourceVault = "vault"
+	SecretSourceAWS   = "aws_secrets_manager"
+	SecretSourceExec  = "exec"
+)
+
+const (
+	// maxSecretSize limits the size of a fetched secret
+	maxSecretSize = 64 * 1024
+
+	// defaultSecretTimeout bounds how long fetching a secret may take
+	defaultSecretTimeout = 10 * time.Second
+)
+
+// SecretSource describes where a secret (API key, TLS private key) is read from
+type SecretSource struct {
+	Type string `yaml:"type"` // file (default), vault, aws_secrets_manager, exec
+
+	// file
+	Path string `yaml:"path,omitempty"`
+
+	// vault (KV v1 or v2)
+	VaultAddress   string `yaml:"vault_address,omitempty"`
+	VaultPath      string `yaml:"vault_path,omitempty"` // e.g. secret/data/vpsie-lb
+	VaultTokenFile string `yaml:"vault_token_file,omitempty"`
+
+	// aws_secrets_manager
+	SecretID string `yaml:"secret_id,omitempty"`
+	Region   string `yaml:"region,omitempty"`
+	Endpoint string `yaml:"endpoint,omitempty"` // optional, e.g. a VPC endpoint
+
+	// exec: absolute path and arguments; the secret is read from stdout
+	Command []string `yaml:"command,omitempty"`
+
+	// Field selects a key when the secret is a JSON object (vault, aws_secrets_manager)
+	Field string `yaml:"field,omitempty"`
+
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// Validate checks that the fields required by the source type are set
+func (s *SecretSource) Validate() error {
+	switch s.Type {
+	case SecretSourceFile, "":
+		if s.Path == "" {
+			return fmt.Errorf("file secret source requires path")
+		}
+	case SecretSourceVault:
+		if s.VaultAddress == "" || s.VaultPath == "" || s.Field == "" {
+			return fmt.Errorf("vault secret source requires vault_address, vault_path and field")
+		}
+	case SecretSourceAWS:
+		if s.SecretID == "" || s.Region == "" {
+			return fmt.Errorf("aws_secrets_manager secret source requires secret_id and region")
+		}
+	case SecretSourceExec:
+		if len(s.Command) == 0 || !filepath.IsAbs(s.Command[0]) {
+			return fmt.Errorf("exec secret source requires a command with an absolute path")
+		}
+	default:
+		return fmt.Errorf("unsupported secret source type %q", s.Type)
+	}
+	return nil
+}
+
+// Fetch retrieves the secret value with surrounding whitespace trimmed
+func (s *SecretSource) Fetch(ctx context.Context) (string, error) {
+	if err := s.Validate(); err != nil {
+		return "", err
+	}
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultSecretTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var value string
+	var err error
+	switch s.Type {
+	case SecretSourceVault:
+		value, err = s.fetchVault(ctx)
+	case SecretSourceAWS:
+		value, err = s.fetchAWS(ctx)
+	case SecretSourceExec:
+		value, err = s.fetchExec(ctx)
+	default:
+		value, err = s.fetchFile()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("secret from %s source is empty", s.typeName())
+	}
+	return value, nil
+}
+
+func (s *SecretSource) typeName() string {
+	if s.Type == "" {
+		return SecretSourceFile
+	}
+	return s.Type
+}
+
+func (s *SecretSource) fetchFile() (string, error) {
+	// #nosec G304 -- path comes from the agent configuration file
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open secret file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxSecretSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return string(data), nil
+}
+
+func (s *SecretSource) fetchVault(ctx context.Context) (string, error) {
+	token := os.Getenv("VAULT_TOKEN")
+	if s.VaultTokenFile != "" {
+		tokenData, err := os.ReadFile(s.VaultTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read vault token file: %w", err)
+		}
+		token = strings.TrimSpace(string(tokenData))
+	}
+	if token == "" {
+		return "", fmt.Errorf("no vault token: set vault_token_file or VAULT_TOKEN")
+	}
+
+	reqURL := strings.TrimRight(s.VaultAddress, "/") + "/v1/" + strings.TrimLeft(s.VaultPath, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	body, err := doSecretRequest(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %w", err)
+	}
+
+	// KV v2 nests the secret under data.data
+	data := resp.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	value, ok := data[s.Field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no string field %q", s.VaultPath, s.Field)
+	}
+	return value, nil
+}
+
+func (s *SecretSource) fetchAWS(ctx context.Context) (string, error) {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return "", fmt.Errorf("AWS credentials not set: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required")
+	}
+
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", s.Region)
+	}
+	payload, err := json.Marshal(map[string]string{"SecretId": s.SecretID})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create AWS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signAWSRequestV4(req, payload, accessKey, secretKey, s.Region, "secretsmanager", time.Now().UTC())
+
+	body, err := doSecretRequest(req)
+	if err != nil {
+		return "", fmt.Errorf("AWS Secrets Manager request failed: %w", err)
+	}
+
+	var resp struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("failed to decode AWS response: %w", err)
+	}
+	if s.Field == "" {
+		return resp.SecretString, nil
+	}
+
+	var fields map[string]interface{}
+	if err = json.Unmarshal([]byte(resp.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object, cannot select field %q", s.SecretID, s.Field)
+	}
+	value, ok := fields[s.Field].(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s has no string field %q", s.SecretID, s.Field)
+	}
+	return value, nil
+}
+
+func (s *SecretSource) fetchExec(ctx context.Context) (string, error) {
+	// #nosec G204 -- command comes from the agent configuration file, not remote input
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	stdout := &limitedWriter{limit: maxSecretSize}
+	stderr := &limitedWriter{limit: maxSecretSize}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Don't wait for grandchildren holding stdout open after the command is killed
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if stdout.exceeded {
+		return "", fmt.Errorf("secret command output exceeds %d bytes", maxSecretSize)
+	}
+	if err != nil {
+		return "", fmt.Errorf("secret command failed: %w: %s", err, truncateErrorMessage(stderr.buf.String(), 200))
+	}
+	return stdout.buf.String(), nil
+}
+
+// errOutputLimit is returned once a limitedWriter is full
+var errOutputLimit = errors.New("output limit exceeded")
+
+// limitedWriter buffers at most limit bytes and fails writes beyond them, so
+// a misbehaving command cannot grow the agent's memory
+type limitedWriter struct {
+	buf      bytes.Buffer
+	limit    int
+	exceeded bool
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.buf.Len()+len(p) > w.limit {
+		w.exceeded = true
+		return 0, errOutputLimit
+	}
+	return w.buf.Write(p)
+}
+
+// doSecretRequest executes a secret manager request and returns the response body
+func doSecretRequest(req *http.Request) ([]byte, error) {
+	client := &http.Client{Timeout: defaultSecretTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSecretSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, truncateErrorMessage(string(body), 200))
+	}
+	return body, nil
+}
+
+// TLSKeySecret materializes a TLS private key from a secret source into a
+// file that Envoy reads. Referenced certificates' private_key_path should
+// point at Path.
+type TLSKeySecret struct {
+	Path   string       `yaml:"path"`
+	Source SecretSource `yaml:"source"`
+}
+
+// materialize fetches the key and writes it to Path (0600) if it changed
+func (k *TLSKeySecret) materialize(ctx context.Context) (bool, error) {
+	value, err := k.Source.Fetch(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch TLS key for %s: %w", k.Path, err)
+	}
+	data := []byte(value + "\n")
+
+	// #nosec G304 -- path comes from the agent configuration file
+	if current, readErr := os.ReadFile(k.Path); readErr == nil && bytes.Equal(current, data) {
+		return false, nil
+	}
+
+	if err = os.MkdirAll(filepath.Dir(k.Path), 0700); err != nil {
+		return false, fmt.Errorf("failed to create key directory: %w", err)
+	}
+	tmpPath := k.Path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err != nil {
+		return false, fmt.Errorf("failed to write TLS key: %w", err)
+	}
+	if err = os.Rename(tmpPath, k.Path); err != nil {
+		_ = os.Remove(tmpPath)
+		return false, fmt.Errorf("failed to install TLS key: %w", err)
+	}
+	return true, nil
+}
+
+// signAWSRequestV4 adds an AWS Signature Version 4 Authorization header
+func signAWSRequestV4(req *http.Request, payload []byte, accessKey, secretKey, region, service string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("Host", req.URL.Host)
+
+	// Canonical headers, sorted by lowercase name
+	headerNames := []string{"content-type", "host", "x-amz-date", "x-amz-target"}
+	if req.Header.Get("X-Amz-Security-Token") != "" {
+		headerNames = append(headerNames, "x-amz-security-token")
+		headerNames[3], headerNames[4] = headerNames[4], headerNames[3]
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{dateStamp, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), dateStamp)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
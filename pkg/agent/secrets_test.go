@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecretSource_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  SecretSource
+		wantErr bool
+	}{
+		{name: "file", source: SecretSource{Path: "/etc/vpsie-lb/api-key"}},
+		{name: "file without path", source: SecretSource{Type: SecretSourceFile}, wantErr: true},
+		{name: "vault", source: SecretSource{Type: SecretSourceVault, VaultAddress: "https://vault:8200", VaultPath: "secret/data/lb", Field: "api_key"}},
+		{name: "vault without field", source: SecretSource{Type: SecretSourceVault, VaultAddress: "https://vault:8200", VaultPath: "secret/data/lb"}, wantErr: true},
+		{name: "aws", source: SecretSource{Type: SecretSourceAWS, SecretID: "vpsie/api-key", Region: "eu-west-1"}},
+		{name: "aws without region", source: SecretSource{Type: SecretSourceAWS, SecretID: "vpsie/api-key"}, wantErr: true},
+		{name: "exec", source: SecretSource{Type: SecretSourceExec, Command: []string{"/usr/bin/pass", "vpsie"}}},
+		{name: "exec relative command", source: SecretSource{Type: SecretSourceExec, Command: []string{"pass"}}, wantErr: true},
+		{name: "unknown type", source: SecretSource{Type: "keychain"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.source.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSecretSource_FetchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("  file-secret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+
+	value, err := (&SecretSource{Path: path}).Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if value != "file-secret" {
+		t.Errorf("Fetch() = %q, want file-secret", value)
+	}
+}
+
+func TestSecretSource_FetchVault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/lb" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"data":{"api_key":"vault-secret"},"metadata":{"version":3}}}`))
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("vault-token\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token: %v", err)
+	}
+
+	source := &SecretSource{
+		Type:           SecretSourceVault,
+		VaultAddress:   server.URL,
+		VaultPath:      "secret/data/lb",
+		VaultTokenFile: tokenFile,
+		Field:          "api_key",
+	}
+	value, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if value != "vault-secret" {
+		t.Errorf("Fetch() = %q, want vault-secret", value)
+	}
+
+	source.Field = "missing"
+	if _, err = source.Fetch(context.Background()); err == nil {
+		t.Error("Expected error for missing field")
+	}
+}
+
+func TestSecretSource_FetchAWS(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+			t.Errorf("unexpected target %q", r.Header.Get("X-Amz-Target"))
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") ||
+			!strings.Contains(auth, "/eu-west-1/secretsmanager/aws4_request") {
+			t.Errorf("unexpected Authorization header %q", auth)
+		}
+		_, _ = w.Write([]byte(`{"SecretString":"{\"api_key\":\"aws-secret\"}"}`))
+	}))
+	defer server.Close()
+
+	source := &SecretSource{
+		Type:     SecretSourceAWS,
+		SecretID: "vpsie/lb",
+		Region:   "eu-west-1",
+		Endpoint: server.URL,
+		Field:    "api_key",
+	}
+	value, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if value != "aws-secret" {
+		t.Errorf("Fetch() = %q, want aws-secret", value)
+	}
+}
+
+func TestSecretSource_FetchExec(t *testing.T) {
+	value, err := (&SecretSource{Type: SecretSourceExec, Command: []string{"/bin/echo", "exec-secret"}}).Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if value != "exec-secret" {
+		t.Errorf("Fetch() = %q, want exec-secret", value)
+	}
+
+	source := &SecretSource{Type: SecretSourceExec, Command: []string{"/bin/sh", "-c", "sleep 5"}, Timeout: 100 * time.Millisecond}
+	if _, err = source.Fetch(context.Background()); err == nil {
+		t.Error("Expected timeout error")
+	}
+
+	// Output beyond the limit fails the command instead of being buffered
+	source = &SecretSource{Type: SecretSourceExec, Command: []string{"/bin/sh", "-c", "yes secret"}, Timeout: 5 * time.Second}
+	if _, err = source.Fetch(context.Background()); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("Fetch() of endless output error = %v, want the size limit", err)
+	}
+}
+
+func TestTLSKeySecret_Materialize(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := filepath.Join(tmpDir, "certs", "key.pem")
+	key := &TLSKeySecret{
+		Path:   keyPath,
+		Source: SecretSource{Type: SecretSourceExec, Command: []string{"/bin/echo", "PRIVATE KEY"}},
+	}
+
+	changed, err := key.materialize(context.Background())
+	if err != nil || !changed {
+		t.Fatalf("materialize() = %v, %v, want true, nil", changed, err)
+	}
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatalf("key file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %04o, want 0600", info.Mode().Perm())
+	}
+
+	// Unchanged key is not rewritten
+	changed, err = key.materialize(context.Background())
+	if err != nil || changed {
+		t.Errorf("materialize() = %v, %v, want false, nil", changed, err)
+	}
+}
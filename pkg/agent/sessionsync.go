@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ha"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ipvs"
+)
+
+// SessionSyncConfig synchronizes the connections forwarded by IPVS from the
+// active node to the passive one with the kernel's sync daemon, so clients
+// keep their connections through a failover. Only connections IPVS forwards
+// (fast_path, or proxy.driver ipvs) can be synchronized: connections
+// terminated by Envoy, HAProxy or Nginx live in the proxy process and are
+// reset by a failover.
+type SessionSyncConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Interface string `yaml:"interface"` // multicast interface, default ha.floating_ip.interface or eth0
+	SyncID    int    `yaml:"sync_id"`   // 0 to 255, the same on both nodes and unique on the network
+}
+
+// maxSyncID is the highest IPVS sync ID
+const maxSyncID = 255
+
+// setDefaults fills in unset session synchronization settings
+func (s *SessionSyncConfig) setDefaults(floatingIPInterface string) {
+	if s.Interface == "" {
+		s.Interface = floatingIPInterface
+	}
+	if s.Interface == "" {
+		s.Interface = defaultFloatingIPInterface
+	}
+}
+
+// validate checks the session synchronization settings
+func (s *SessionSyncConfig) validate(c *Config) []error {
+	if !s.Enabled {
+		return nil
+	}
+	var errs []error
+	if !c.HA.Enabled {
+		errs = append(errs, errors.New("ha.session_sync requires ha.enabled"))
+	}
+	if !c.FastPath.Enabled && c.Proxy.Driver != ProxyDriverIPVS {
+		errs = append(errs, fmt.Errorf("ha.session_sync requires fast_path or proxy.driver %s: connections terminated by a proxy cannot be synchronized", ProxyDriverIPVS))
+	}
+	if s.SyncID < 0 || s.SyncID > maxSyncID {
+		errs = append(errs, fmt.Errorf("ha.session_sync.sync_id %d must be between 0 and %d", s.SyncID, maxSyncID))
+	}
+	if strings.ContainsAny(s.Interface, " /") {
+		errs = append(errs, fmt.Errorf("ha.session_sync.interface %q is not a valid interface name", s.Interface))
+	}
+	if _, err := exec.LookPath("ipvsadm"); err != nil {
+		errs = append(errs, fmt.Errorf("ha.session_sync: %w", err))
+	}
+	return errs
+}
+
+// ipvsInUse returns the IPVS forwarding the load balancer's connections, nil when
+// a proxy forwards them
+func (a *Agent) ipvsInUse() *ipvs.IPVS {
+	if driver, ok := a.proxy.(*ipvs.Driver); ok {
+		return driver.IPVS()
+	}
+	return a.fastPath
+}
+
+// updateSessionSync makes the active node send its connections and the
+// passive node receive them. Nodes in fault or unknown state keep their
+// daemon, so a node recovering from a fault still has the connections.
+func (a *Agent) updateSessionSync(ctx context.Context, role ha.Role) {
+	cfg := a.currentConfig().HA.SessionSync
+	v := a.ipvsInUse()
+	if !cfg.Enabled || v == nil {
+		return
+	}
+	var state ipvs.SyncState
+	switch role {
+	case ha.RoleActive:
+		state = ipvs.SyncMaster
+	case ha.RolePassive:
+		state = ipvs.SyncBackup
+	default:
+		return
+	}
+	if err := v.Sync(ctx, state, cfg.Interface, cfg.SyncID); err != nil {
+		log.Printf("Warning: Failed to synchronize connections: %v", err)
+		return
+	}
+	log.Printf("IPVS connections synchronized as %s on %s (sync ID %d)", state, cfg.Interface, cfg.SyncID)
+}
+
+// writeSessionMetrics writes the connections IPVS forwards for the load
+// balancer and the state of the sync daemon
+func (a *Agent) writeSessionMetrics(ctx context.Context, w io.Writer) {
+	v := a.ipvsInUse()
+	if v == nil {
+		return
+	}
+	if conns, err := v.Connections(ctx); err == nil {
+		fmt.Fprintln(w, "# HELP vpsie_lb_ipvs_connections Connections IPVS forwards for the load balancer.")
+		fmt.Fprintln(w, "# TYPE vpsie_lb_ipvs_connections gauge")
+		fmt.Fprintf(w, "vpsie_lb_ipvs_connections{state=\"active\"} %d\n", conns.Active)
+		fmt.Fprintf(w, "vpsie_lb_ipvs_connections{state=\"inactive\"} %d\n", conns.Inactive)
+	}
+	if !a.currentConfig().HA.SessionSync.Enabled {
+		return
+	}
+	if states, err := v.SyncStates(ctx); err == nil {
+		fmt.Fprintln(w, "# HELP vpsie_lb_ipvs_sync_daemon Whether the IPVS connection sync daemon runs in a state.")
+		fmt.Fprintln(w, "# TYPE vpsie_lb_ipvs_sync_daemon gauge")
+		for _, state := range []ipvs.SyncState{ipvs.SyncMaster, ipvs.SyncBackup} {
+			running := 0
+			if slices.Contains(states, state) {
+				running = 1
+			}
+			fmt.Fprintf(w, "vpsie_lb_ipvs_sync_daemon{state=\"%s\"} %d\n", state, running)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ha"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// SessionTicketConfig makes the agent manage the TLS session ticket keys of
+// HTTPS listeners. Envoy otherwise generates keys per process, so every hot
+// restart and every failover to the other node of an HA pair makes clients
+// do a full handshake again.
+type SessionTicketConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Dir      string        `yaml:"dir"`      // key files read by Envoy, default /var/lib/vpsie-lb/session-tickets
+	Rotation time.Duration `yaml:"rotation"` // how often a new encryption key is generated, default 12h
+	Keys     int           `yaml:"keys"`     // keys kept: the newest encrypts, all decrypt, default 3
+	Sync     bool          `yaml:"sync"`     // share the active node's keys with the passive node through the VPSie API
+}
+
+// Default session ticket settings applied by LoadConfig
+const (
+	defaultSessionTicketDir      = "/var/lib/vpsie-lb/session-tickets"
+	defaultSessionTicketRotation = 12 * time.Hour
+	defaultSessionTicketKeys     = 3
+)
+
+// Session ticket bounds enforced by validate
+const (
+	minSessionTicketRotation = time.Hour
+	maxSessionTicketRotation = 7 * 24 * time.Hour
+	minSessionTicketKeys     = 2
+	maxSessionTicketKeys     = 8
+)
+
+// sessionTicketKeySize is the size of an Envoy session ticket key: 16 bytes
+// of key name, 32 of HMAC secret and 32 of AES key
+const sessionTicketKeySize = 80
+
+// sessionTicketCheckInterval is how often keys are checked for rotation, and
+// how often the passive node fetches the shared keys
+const sessionTicketCheckInterval = time.Minute
+
+// setDefaults fills in unset session ticket settings
+func (c *SessionTicketConfig) setDefaults() {
+	if c.Dir == "" {
+		c.Dir = defaultSessionTicketDir
+	}
+	if c.Rotation == 0 {
+		c.Rotation = defaultSessionTicketRotation
+	}
+	if c.Keys == 0 {
+		c.Keys = defaultSessionTicketKeys
+	}
+}
+
+// validate checks the session ticket settings
+func (c *SessionTicketConfig) validate() []error {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []error
+	if !filepath.IsAbs(c.Dir) {
+		errs = append(errs, fmt.Errorf("session_tickets.dir %q must be absolute", c.Dir))
+	}
+	if c.Rotation < minSessionTicketRotation || c.Rotation > maxSessionTicketRotation {
+		errs = append(errs, fmt.Errorf("session_tickets.rotation %s must be between %s and %s", c.Rotation, minSessionTicketRotation, maxSessionTicketRotation))
+	}
+	if c.Keys < minSessionTicketKeys || c.Keys > maxSessionTicketKeys {
+		errs = append(errs, fmt.Errorf("session_tickets.keys %d must be between %d and %d", c.Keys, minSessionTicketKeys, maxSessionTicketKeys))
+	}
+	return errs
+}
+
+// keyPaths returns the key files Envoy reads, newest first
+func (c *SessionTicketConfig) keyPaths() []string {
+	paths := make([]string, c.Keys)
+	for i := range paths {
+		paths[i] = filepath.Join(c.Dir, fmt.Sprintf("key-%d", i))
+	}
+	return paths
+}
+
+// SessionTicketKeys is the key set shared by the nodes of an HA pair
+type SessionTicketKeys struct {
+	Keys      [][]byte  `json:"keys"` // newest first, base64 encoded
+	RotatedAt time.Time `json:"rotated_at"`
+}
+
+// loadSessionTicketKeys reads the key files of cfg. The rotation time is the
+// modification time of the newest key; a missing or damaged set is empty.
+func loadSessionTicketKeys(cfg *SessionTicketConfig) (*SessionTicketKeys, error) {
+	set := &SessionTicketKeys{}
+	for i, path := range cfg.keyPaths() {
+		// #nosec G304 -- path is inside the configured session ticket directory
+		key, err := os.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return &SessionTicketKeys{}, nil
+			}
+			return nil, err
+		}
+		if len(key) != sessionTicketKeySize {
+			log.Printf("Warning: Session ticket key %s has %d bytes, generating new keys", path, len(key))
+			return &SessionTicketKeys{}, nil
+		}
+		if i == 0 {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			set.RotatedAt = info.ModTime()
+		}
+		set.Keys = append(set.Keys, key)
+	}
+	return set, nil
+}
+
+// writeSessionTicketKeys replaces the key files of cfg with set. The oldest
+// key is written first, so Envoy never reads a newest key it cannot pair
+// with the previous ones.
+func writeSessionTicketKeys(cfg *SessionTicketConfig, set *SessionTicketKeys) error {
+	paths := cfg.keyPaths()
+	if len(set.Keys) != len(paths) {
+		return fmt.Errorf("session ticket key set has %d keys, want %d", len(set.Keys), len(paths))
+	}
+	for i := len(paths) - 1; i >= 0; i-- {
+		if len(set.Keys[i]) != sessionTicketKeySize {
+			return fmt.Errorf("session ticket key %d has %d bytes, want %d", i, len(set.Keys[i]), sessionTicketKeySize)
+		}
+		if err := writeFileAtomic(paths[i], set.Keys[i]); err != nil {
+			return fmt.Errorf("failed to write session ticket key: %w", err)
+		}
+	}
+	if err := os.Chtimes(paths[0], set.RotatedAt, set.RotatedAt); err != nil {
+		return fmt.Errorf("failed to record session ticket rotation: %w", err)
+	}
+	return nil
+}
+
+// rotate returns set with a new encryption key in front, keeping n keys.
+// An incomplete set is filled up with new keys.
+func (set *SessionTicketKeys) rotate(n int, now time.Time) (*SessionTicketKeys, error) {
+	fresh := max(1, n-len(set.Keys))
+	rotated := &SessionTicketKeys{RotatedAt: now}
+	for len(rotated.Keys) < fresh {
+		key := make([]byte, sessionTicketKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate session ticket key: %w", err)
+		}
+		rotated.Keys = append(rotated.Keys, key)
+	}
+	for _, key := range set.Keys {
+		if len(rotated.Keys) == n {
+			break
+		}
+		rotated.Keys = append(rotated.Keys, key)
+	}
+	return rotated, nil
+}
+
+// equal reports whether set and other hold the same keys
+func (set *SessionTicketKeys) equal(other *SessionTicketKeys) bool {
+	if len(set.Keys) != len(other.Keys) {
+		return false
+	}
+	for i := range set.Keys {
+		if !bytes.Equal(set.Keys[i], other.Keys[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// fingerprint identifies the key set without revealing it
+func (set *SessionTicketKeys) fingerprint() string {
+	h := sha256.New()
+	for _, key := range set.Keys {
+		h.Write(key)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// PublishSessionTicketKeys shares the session ticket keys of the active node
+func (c *VPSieClient) PublishSessionTicketKeys(ctx context.Context, keys *SessionTicketKeys) error {
+	reqURL := fmt.Sprintf("%s/loadbalancers/%s/session-ticket-keys", c.baseURL, sanitizeID(c.loadBalancerID))
+	return c.doJSON(ctx, http.MethodPut, reqURL, keys, nil)
+}
+
+// SessionTicketKeys returns the session ticket keys published by the active
+// node, nil when none were published yet
+func (c *VPSieClient) SessionTicketKeys(ctx context.Context) (*SessionTicketKeys, error) {
+	reqURL := fmt.Sprintf("%s/loadbalancers/%s/session-ticket-keys", c.baseURL, sanitizeID(c.loadBalancerID))
+	var keys SessionTicketKeys
+	if err := c.doJSON(ctx, http.MethodGet, reqURL, nil, &keys); err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &keys, nil
+}
+
+// sessionTicketStore shares session ticket keys between the nodes of an HA pair
+type sessionTicketStore interface {
+	PublishSessionTicketKeys(ctx context.Context, keys *SessionTicketKeys) error
+	SessionTicketKeys(ctx context.Context) (*SessionTicketKeys, error)
+}
+
+// runSessionTickets rotates the session ticket keys, or follows the keys of
+// the active node, until ctx is cancelled
+func (a *Agent) runSessionTickets(ctx context.Context, cfg SessionTicketConfig) {
+	log.Printf("Session ticket keys in %s (rotation: %s, keys: %d, sync: %v)", cfg.Dir, cfg.Rotation, cfg.Keys, cfg.Sync)
+	ticker := time.NewTicker(sessionTicketCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if a.updateSessionTickets(ctx, &cfg, time.Now()) {
+				a.checkSessionTickets()
+			}
+		}
+	}
+}
+
+// updateSessionTickets brings the key files up to date and reports whether
+// they changed. The active node (every node without HA) rotates the keys
+// once they are older than the rotation interval and publishes them when
+// syncing; the passive node of a syncing pair takes the published keys.
+func (a *Agent) updateSessionTickets(ctx context.Context, cfg *SessionTicketConfig, now time.Time) bool {
+	current, err := loadSessionTicketKeys(cfg)
+	if err != nil {
+		log.Printf("Warning: Failed to read session ticket keys: %v", err)
+		return false
+	}
+
+	store, _ := a.source.(sessionTicketStore)
+	if cfg.Sync && store != nil && a.Role() != ha.RoleActive {
+		shared, err := store.SessionTicketKeys(ctx)
+		if err != nil {
+			log.Printf("Warning: Failed to fetch session ticket keys: %v", err)
+			return false
+		}
+		if shared == nil || shared.equal(current) {
+			return false
+		}
+		if err = writeSessionTicketKeys(cfg, shared); err != nil {
+			log.Printf("Warning: %v", err)
+			return false
+		}
+		log.Printf("Session ticket keys taken from the active node (rotated at %s)", shared.RotatedAt.Format(time.RFC3339))
+		return true
+	}
+
+	if len(current.Keys) == cfg.Keys && now.Sub(current.RotatedAt) < cfg.Rotation {
+		return false
+	}
+	rotated, err := current.rotate(cfg.Keys, now)
+	if err == nil {
+		err = writeSessionTicketKeys(cfg, rotated)
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to rotate session ticket keys: %v", err)
+		return false
+	}
+	log.Printf("Session ticket keys rotated")
+	if cfg.Sync && store != nil {
+		if err = store.PublishSessionTicketKeys(ctx, rotated); err != nil {
+			log.Printf("Warning: Failed to publish session ticket keys: %v", err)
+		}
+	}
+	return true
+}
+
+// checkSessionTickets asks the main loop to load the new session ticket keys
+func (a *Agent) checkSessionTickets() {
+	select {
+	case a.ticketCh <- struct{}{}:
+	default:
+		// A reload is already pending
+	}
+}
+
+// reloadSessionTickets reloads Envoy when the applied configuration uses
+// session ticket keys that changed since it was applied. Tickets encrypted
+// with a key that is still in the set stay valid across the reload.
+func (a *Agent) reloadSessionTickets(ctx context.Context) {
+	lb := a.lastApplied.Load()
+	if lb == nil || !usesSessionTickets(lb) {
+		return
+	}
+	cfg := a.currentConfig()
+	keys, err := loadSessionTicketKeys(&cfg.SessionTickets)
+	if err != nil {
+		log.Printf("Warning: Failed to read session ticket keys: %v", err)
+		return
+	}
+	fingerprint := keys.fingerprint()
+	if previous, _ := a.ticketFingerprint.Load().(string); fingerprint == previous {
+		return
+	}
+
+	// The reload events share a correlation ID
+	ctx = withCorrelationID(ctx)
+	configHash, _ := a.lastConfigHash.Load().(string)
+	if cfg.Envoy.OutputMode == OutputModeXDSSnapshot {
+		// A new version makes the external control plane push the listeners again
+		var snapshot *envoy.Snapshot
+		if snapshot, err = a.envoyGenerator.GenerateSnapshot(lb, configHash+"-"+fingerprint[:12]); err == nil {
+			err = a.envoyManager.WriteSnapshot(snapshot)
+		}
+	} else {
+		err = a.reloadEnvoy(ctx)
+	}
+	if err != nil {
+		log.Printf("Error loading session ticket keys: %v", err)
+		return
+	}
+	a.ticketFingerprint.Store(fingerprint)
+
+	a.sendEvent(ctx, NewEvent(EventSessionTicketsRotated, "Session ticket keys loaded", map[string]interface{}{
+		"rotated_at":  keys.RotatedAt.UTC().Format(time.RFC3339),
+		"config_hash": configHash,
+	}))
+}
+
+// recordSessionTickets remembers the session ticket keys the applied
+// configuration loaded, so only later rotations cause a reload
+func (a *Agent) recordSessionTickets() {
+	cfg := a.currentConfig().SessionTickets
+	if !cfg.Enabled {
+		return
+	}
+	if keys, err := loadSessionTicketKeys(&cfg); err == nil {
+		a.ticketFingerprint.Store(keys.fingerprint())
+	}
+}
+
+// usesSessionTickets reports whether lb has listeners with ticket keys
+func usesSessionTickets(lb *models.LoadBalancer) bool {
+	return lb.Protocol == models.ProtocolHTTPS && lb.TLSConfig != nil && !lb.TLSConfig.DisableSessionTickets
+}
@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ha"
+)
+
+// ticketStoreSource is a config source that shares session ticket keys
+type ticketStoreSource struct {
+	ConfigSource
+	shared    *SessionTicketKeys
+	published int
+}
+
+func (s *ticketStoreSource) PublishSessionTicketKeys(_ context.Context, keys *SessionTicketKeys) error {
+	s.shared = keys
+	s.published++
+	return nil
+}
+
+func (s *ticketStoreSource) SessionTicketKeys(context.Context) (*SessionTicketKeys, error) {
+	return s.shared, nil
+}
+
+func TestAgent_UpdateSessionTickets_Rotation(t *testing.T) {
+	cfg := SessionTicketConfig{Enabled: true, Dir: t.TempDir(), Rotation: time.Hour, Keys: 3}
+	a := &Agent{config: &Config{}}
+	start := time.Now().Truncate(time.Second)
+
+	if !a.updateSessionTickets(context.Background(), &cfg, start) {
+		t.Fatal("first update did not generate keys")
+	}
+	first, err := loadSessionTicketKeys(&cfg)
+	if err != nil {
+		t.Fatalf("loadSessionTicketKeys() error = %v", err)
+	}
+	if len(first.Keys) != 3 || !first.RotatedAt.Equal(start) {
+		t.Fatalf("keys = %d rotated at %v, want 3 rotated at %v", len(first.Keys), first.RotatedAt, start)
+	}
+
+	if a.updateSessionTickets(context.Background(), &cfg, start.Add(30*time.Minute)) {
+		t.Error("keys rotated before the rotation interval")
+	}
+
+	if !a.updateSessionTickets(context.Background(), &cfg, start.Add(time.Hour)) {
+		t.Fatal("keys not rotated after the rotation interval")
+	}
+	second, err := loadSessionTicketKeys(&cfg)
+	if err != nil {
+		t.Fatalf("loadSessionTicketKeys() error = %v", err)
+	}
+	if len(second.Keys) != 3 || second.equal(first) {
+		t.Fatal("rotation did not replace the key set")
+	}
+	// The previous encryption key still decrypts, the oldest is dropped
+	if string(second.Keys[1]) != string(first.Keys[0]) || string(second.Keys[2]) != string(first.Keys[1]) {
+		t.Error("rotation did not keep the previous keys in order")
+	}
+}
+
+func TestAgent_UpdateSessionTickets_Sync(t *testing.T) {
+	activeCfg := SessionTicketConfig{Enabled: true, Dir: t.TempDir(), Rotation: time.Hour, Keys: 2, Sync: true}
+	passiveCfg := activeCfg
+	passiveCfg.Dir = t.TempDir()
+	store := &ticketStoreSource{}
+	now := time.Now().Truncate(time.Second)
+
+	active := &Agent{config: &Config{HA: HAConfig{Enabled: true}}, source: store}
+	active.role.Store(ha.RoleActive)
+	passive := &Agent{config: &Config{HA: HAConfig{Enabled: true}}, source: store}
+	passive.role.Store(ha.RolePassive)
+
+	if passive.updateSessionTickets(context.Background(), &passiveCfg, now) {
+		t.Error("passive node changed keys before any were published")
+	}
+	if !active.updateSessionTickets(context.Background(), &activeCfg, now) {
+		t.Fatal("active node did not generate keys")
+	}
+	if store.published != 1 {
+		t.Fatalf("published = %d, want 1", store.published)
+	}
+	if !passive.updateSessionTickets(context.Background(), &passiveCfg, now.Add(2*time.Hour)) {
+		t.Fatal("passive node did not take the published keys")
+	}
+	if passive.updateSessionTickets(context.Background(), &passiveCfg, now.Add(2*time.Hour)) {
+		t.Error("passive node rewrote unchanged keys")
+	}
+
+	activeKeys, _ := loadSessionTicketKeys(&activeCfg)
+	passiveKeys, _ := loadSessionTicketKeys(&passiveCfg)
+	if !passiveKeys.equal(activeKeys) || !passiveKeys.RotatedAt.Equal(now) {
+		t.Error("passive node keys differ from the active node")
+	}
+}
+
+func TestVPSieClient_SessionTicketKeys(t *testing.T) {
+	var stored []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loadbalancers/lb-1/session-ticket-keys" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		switch r.Method {
+		case http.MethodPut:
+			var keys SessionTicketKeys
+			if err := json.NewDecoder(r.Body).Decode(&keys); err != nil {
+				t.Errorf("decode: %v", err)
+			}
+			stored, _ = json.Marshal(keys)
+		case http.MethodGet:
+			if stored == nil {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(stored)
+		}
+	}))
+	defer server.Close()
+	client, _ := NewVPSieClient("test-key", server.URL, "lb-1")
+
+	keys, err := client.SessionTicketKeys(context.Background())
+	if err != nil || keys != nil {
+		t.Fatalf("SessionTicketKeys() = %v, %v, want nil before publishing", keys, err)
+	}
+	published, err := (&SessionTicketKeys{}).rotate(2, time.Now().UTC().Truncate(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.PublishSessionTicketKeys(context.Background(), published); err != nil {
+		t.Fatalf("PublishSessionTicketKeys() error = %v", err)
+	}
+	keys, err = client.SessionTicketKeys(context.Background())
+	if err != nil {
+		t.Fatalf("SessionTicketKeys() error = %v", err)
+	}
+	if !keys.equal(published) || !keys.RotatedAt.Equal(published.RotatedAt) {
+		t.Error("fetched keys differ from the published keys")
+	}
+}
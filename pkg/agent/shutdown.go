@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ShutdownConfig configures what the agent does before it exits
+type ShutdownConfig struct {
+	Drain       bool          `yaml:"drain"`        // drain Envoy's listeners before exiting
+	DrainPeriod time.Duration `yaml:"drain_period"` // how long connections get to finish, default 30s
+}
+
+// Default shutdown settings applied by LoadConfig
+const defaultShutdownDrainPeriod = 30 * time.Second
+
+// maxShutdownDrainPeriod bounds shutdown.drain_period; systemd must wait at
+// least as long before killing the agent
+const maxShutdownDrainPeriod = 10 * time.Minute
+
+// errDraining is returned for Envoy reloads requested while the node drains
+var errDraining = errors.New("draining for shutdown, Envoy is not reloaded")
+
+// setDefaults fills in unset shutdown settings
+func (c *ShutdownConfig) setDefaults() {
+	if c.DrainPeriod == 0 {
+		c.DrainPeriod = defaultShutdownDrainPeriod
+	}
+}
+
+// validate checks the shutdown settings
+func (c *ShutdownConfig) validate() []error {
+	if !c.Drain {
+		return nil
+	}
+	if c.DrainPeriod < time.Second || c.DrainPeriod > maxShutdownDrainPeriod {
+		return []error{fmt.Errorf("shutdown.drain_period %s is out of range: must be between 1s and %s", c.DrainPeriod, maxShutdownDrainPeriod)}
+	}
+	return nil
+}
+
+// Drain prepares the node for shutdown when shutdown.drain is set: it stops
+// applying configuration changes, reports the load balancer as draining,
+// tells Envoy to drain its listeners and waits for the drain period or until
+// ctx is cancelled. Envoy keeps serving while it drains, but asks clients to
+// close their connections. Call it before Stop.
+func (a *Agent) Drain(ctx context.Context) {
+	cfg := a.currentConfig()
+	if !cfg.Shutdown.Drain || cfg.Envoy.OutputMode != OutputModeFiles || !cfg.Proxy.envoy() {
+		return
+	}
+	// A restart or reload would open the listeners again
+	a.draining.Store(true)
+	log.Printf("Draining Envoy listeners for %s before shutting down", cfg.Shutdown.DrainPeriod)
+
+	a.reportStatus(ctx)
+
+	if err := a.envoyAdmin.DrainListeners(ctx); err != nil {
+		log.Printf("Warning: Failed to drain Envoy listeners, shutting down right away: %v", err)
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+		log.Println("Draining cut short")
+	case <-time.After(cfg.Shutdown.DrainPeriod):
+		log.Println("Drain period over")
+	}
+}
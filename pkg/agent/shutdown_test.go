@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+)
+
+func TestAgent_Drain(t *testing.T) {
+	var drained []string
+	envoyAdmin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		drained = append(drained, r.Method+" "+r.URL.RequestURI())
+	}))
+	defer envoyAdmin.Close()
+
+	reporter := &recordingReporter{}
+	a := &Agent{
+		config: &Config{
+			Envoy:    EnvoySettings{OutputMode: OutputModeFiles},
+			Shutdown: ShutdownConfig{Drain: true, DrainPeriod: 50 * time.Millisecond},
+		},
+		events:     reporter,
+		envoyAdmin: envoy.NewAdminClient(strings.TrimPrefix(envoyAdmin.URL, "http://")),
+	}
+
+	start := time.Now()
+	a.Drain(context.Background())
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Drain() returned after %s, want the drain period", elapsed)
+	}
+	if len(drained) != 1 || drained[0] != "POST /drain_listeners?graceful" {
+		t.Errorf("Envoy admin requests = %v, want a graceful drain", drained)
+	}
+	if len(reporter.statuses) != 1 || reporter.statuses[0] != StatusDraining {
+		t.Errorf("statuses = %v, want draining", reporter.statuses)
+	}
+
+	// Nothing reopens the listeners
+	if err := a.reloadEnvoy(context.Background()); err != errDraining {
+		t.Errorf("reloadEnvoy() while draining = %v, want errDraining", err)
+	}
+	if err := a.syncConfiguration(context.Background()); err != nil {
+		t.Errorf("syncConfiguration() while draining = %v, want a skipped sync", err)
+	}
+
+	// A cancelled context cuts the drain period short
+	a = &Agent{config: a.config, events: reporter, envoyAdmin: a.envoyAdmin}
+	a.config.Shutdown.DrainPeriod = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	a.Drain(ctx)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Drain() with a cancelled context took %s", elapsed)
+	}
+}
+
+func TestAgent_Drain_Disabled(t *testing.T) {
+	reporter := &recordingReporter{}
+	a := &Agent{config: &Config{Envoy: EnvoySettings{OutputMode: OutputModeFiles}}, events: reporter}
+	a.Drain(context.Background())
+	if a.draining.Load() || len(reporter.statuses) != 0 {
+		t.Error("Drain() without shutdown.drain changed the node")
+	}
+}
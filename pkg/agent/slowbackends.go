@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/accesslog"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ha"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/slowbackend"
+)
+
+// SlowBackendConfig configures the lowering of the weight of backends that
+// are much slower than the other backends of their pool. Latency is measured
+// from the access logs, so the access log service must be enabled.
+type SlowBackendConfig struct {
+	Enabled           bool          `yaml:"enabled"`
+	Interval          time.Duration `yaml:"interval"`           // latency is judged per interval, default 30s
+	LatencyMultiple   float64       `yaml:"latency_multiple"`   // p95 above this multiple of the pool median is slow, default 3
+	MinLatency        time.Duration `yaml:"min_latency"`        // p95 at or below this is never slow, default 50ms
+	MinRequests       int           `yaml:"min_requests"`       // requests a backend needs in an interval to be judged, default 20
+	WeightPercent     int           `yaml:"weight_percent"`     // share of its weight a slow backend keeps, default 25
+	RecoveryIntervals int           `yaml:"recovery_intervals"` // intervals in a row a slow backend must keep up before its weight is restored, default 3
+}
+
+// Default slow backend settings applied by LoadConfig
+const (
+	defaultSlowBackendInterval  = 30 * time.Second
+	defaultSlowLatencyMultiple  = 3
+	defaultSlowMinLatency       = 50 * time.Millisecond
+	defaultSlowMinRequests      = 20
+	defaultSlowWeightPercent    = 25
+	defaultSlowRecoveryInterval = 3
+)
+
+// Slow backend bounds enforced by validate
+const (
+	minSlowBackendInterval = 10 * time.Second
+	maxSlowBackendInterval = 10 * time.Minute
+	maxSlowRecovery        = 100
+)
+
+// setDefaults fills in unset slow backend settings
+func (c *SlowBackendConfig) setDefaults() {
+	if c.Interval == 0 {
+		c.Interval = defaultSlowBackendInterval
+	}
+	if c.LatencyMultiple == 0 {
+		c.LatencyMultiple = defaultSlowLatencyMultiple
+	}
+	if c.MinLatency == 0 {
+		c.MinLatency = defaultSlowMinLatency
+	}
+	if c.MinRequests == 0 {
+		c.MinRequests = defaultSlowMinRequests
+	}
+	if c.WeightPercent == 0 {
+		c.WeightPercent = defaultSlowWeightPercent
+	}
+	if c.RecoveryIntervals == 0 {
+		c.RecoveryIntervals = defaultSlowRecoveryInterval
+	}
+}
+
+// validate checks the slow backend settings
+func (c *SlowBackendConfig) validate() []error {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []error
+	if c.Interval < minSlowBackendInterval || c.Interval > maxSlowBackendInterval {
+		errs = append(errs, fmt.Errorf("slow_backends.interval %s is out of range: must be between %s and %s",
+			c.Interval, minSlowBackendInterval, maxSlowBackendInterval))
+	}
+	if c.LatencyMultiple <= 1 {
+		errs = append(errs, fmt.Errorf("slow_backends.latency_multiple %g must be greater than 1", c.LatencyMultiple))
+	}
+	if c.MinLatency < 0 {
+		errs = append(errs, fmt.Errorf("slow_backends.min_latency %s must not be negative", c.MinLatency))
+	}
+	if c.MinRequests < 1 {
+		errs = append(errs, fmt.Errorf("slow_backends.min_requests %d must be at least 1", c.MinRequests))
+	}
+	if c.WeightPercent < 1 || c.WeightPercent > 99 {
+		errs = append(errs, fmt.Errorf("slow_backends.weight_percent %d is out of range: must be between 1 and 99", c.WeightPercent))
+	}
+	if c.RecoveryIntervals < 1 || c.RecoveryIntervals > maxSlowRecovery {
+		errs = append(errs, fmt.Errorf("slow_backends.recovery_intervals %d is out of range: must be between 1 and %d",
+			c.RecoveryIntervals, maxSlowRecovery))
+	}
+	return errs
+}
+
+// newSlowBackendController creates the slow backend controller. Adjustments
+// are reported as events and every weight change triggers a sync.
+func (a *Agent) newSlowBackendController(cfg *SlowBackendConfig, latency *accesslog.HostLatencies) *slowbackend.Controller {
+	return slowbackend.NewController(slowbackend.Settings{
+		LatencyMultiple:   cfg.LatencyMultiple,
+		MinLatency:        cfg.MinLatency,
+		MinRequests:       cfg.MinRequests,
+		WeightPercent:     cfg.WeightPercent,
+		RecoveryIntervals: cfg.RecoveryIntervals,
+	}, latency, a.eventFunc(), a.TriggerSync)
+}
+
+// runSlowBackends judges backend latency while this node is active
+func (a *Agent) runSlowBackends(ctx context.Context, interval time.Duration) {
+	a.slowBackends.Run(ctx, interval, func() bool { return a.Role() == ha.RoleActive })
+}
+
+// handleSlowBackendStatus serves the backends whose weight is reduced
+func (a *Agent) handleSlowBackendStatus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if a.slowBackends == nil {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"enabled": false})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"enabled": true, "reduced": a.slowBackends.Statuses()})
+}
@@ -0,0 +1,230 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// StateConfig configures the directory the agent keeps its state in, so a
+// restarted agent resumes where it left off: it does not re-apply an
+// unchanged configuration, keeps reconciliation paused and changes staged for
+// approval, and resends the events it could not deliver
+type StateConfig struct {
+	Dir             string `yaml:"dir"`               // e.g. /var/lib/vpsie-lb; empty keeps no state
+	MaxQueuedEvents int    `yaml:"max_queued_events"` // undelivered events kept for resending, default 1000
+}
+
+// Files in the state directory
+const (
+	stateFileName  = "state.json"
+	eventsFileName = "events.json"
+	epochFileName  = "envoy.epoch"
+)
+
+// Default state settings applied by LoadConfig
+const defaultMaxQueuedEvents = 1000
+
+// maxQueuedEventsLimit bounds the event queue kept in memory and on disk
+const maxQueuedEventsLimit = 100000
+
+// setDefaults fills in unset state settings
+func (c *StateConfig) setDefaults() {
+	if c.MaxQueuedEvents == 0 {
+		c.MaxQueuedEvents = defaultMaxQueuedEvents
+	}
+}
+
+// validate checks the state settings
+func (c *StateConfig) validate() []error {
+	if c.Dir == "" {
+		return nil
+	}
+	var errs []error
+	if !filepath.IsAbs(c.Dir) {
+		errs = append(errs, fmt.Errorf("state.dir %q must be absolute", c.Dir))
+	}
+	if c.MaxQueuedEvents < 1 || c.MaxQueuedEvents > maxQueuedEventsLimit {
+		errs = append(errs, fmt.Errorf("state.max_queued_events %d must be between 1 and %d", c.MaxQueuedEvents, maxQueuedEventsLimit))
+	}
+	return errs
+}
+
+// agentState is what the agent persists in the state directory
+type agentState struct {
+	ConfigHash      string               `json:"config_hash,omitempty"`
+	LoadBalancer    *models.LoadBalancer `json:"loadbalancer,omitempty"`     // last applied, as sent to Envoy
+	CertFingerprint string               `json:"cert_fingerprint,omitempty"` // certificate files Envoy loaded
+	Paused          *PauseStatus         `json:"paused,omitempty"`
+	Staged          *StagedChange        `json:"staged,omitempty"`
+	AgentVersion    string               `json:"agent_version"`
+	EnvoyVersion    string               `json:"envoy_version,omitempty"`
+	SavedAt         time.Time            `json:"saved_at"`
+}
+
+// saveState persists the applied configuration, the paused state and the
+// staged change. Failures are logged; the agent then starts from scratch
+// after a restart.
+func (a *Agent) saveState(ctx context.Context) {
+	dir := a.currentConfig().State.Dir
+	if dir == "" {
+		return
+	}
+	state := agentState{
+		LoadBalancer: a.lastApplied.Load(),
+		Paused:       a.paused.Load(),
+		Staged:       a.staged.Load(),
+		AgentVersion: Version,
+		SavedAt:      time.Now().UTC(),
+	}
+	if hash, ok := a.lastConfigHash.Load().(string); ok {
+		state.ConfigHash = hash
+	}
+	if fingerprint, ok := a.certFingerprint.Load().(string); ok {
+		state.CertFingerprint = fingerprint
+	}
+	if a.envoyValidator != nil {
+		if version, err := a.envoyValidator.Version(ctx); err == nil {
+			state.EnvoyVersion = version.String()
+		}
+	}
+
+	data, err := json.Marshal(state)
+	if err == nil {
+		a.stateMu.Lock()
+		err = writeFileAtomic(filepath.Join(dir, stateFileName), data)
+		a.stateMu.Unlock()
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to save agent state: %v", err)
+	}
+}
+
+// restoreState resumes from the state saved by the previous agent. The
+// applied configuration is only taken over when the Envoy configuration on
+// disk is still the one it generates; otherwise it is applied again.
+func (a *Agent) restoreState() {
+	cfg := a.currentConfig()
+	if cfg.State.Dir == "" {
+		return
+	}
+	path := filepath.Join(cfg.State.Dir, stateFileName)
+	// #nosec G304 -- the state directory comes from the agent configuration
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	var state agentState
+	if err == nil {
+		err = json.Unmarshal(data, &state)
+	}
+	if err != nil {
+		log.Printf("Warning: Ignoring agent state in %s: %v", path, err)
+		return
+	}
+
+	// A pause the configuration no longer asks for ends with the restart
+	if state.Paused != nil && (state.Paused.By != pausedByConfig || cfg.Pause.Enabled) {
+		a.paused.Store(state.Paused)
+		log.Printf("Resumed paused reconciliation (since %s, by %s)", state.Paused.Since.Format(time.RFC3339), state.Paused.By)
+	}
+	if state.Staged != nil {
+		a.staged.Store(state.Staged)
+	}
+	if state.ConfigHash == "" || state.LoadBalancer == nil {
+		return
+	}
+	if cfg.Envoy.OutputMode == OutputModeFiles {
+		envoyConfig, err := a.envoyGenerator.GenerateFullConfig(state.LoadBalancer)
+		if err == nil {
+			var diff string
+			if diff, err = a.envoyManager.Diff(envoyConfig); err == nil && diff != "" {
+				err = errors.New("the Envoy configuration on disk has changed")
+			}
+		}
+		if err != nil {
+			log.Printf("Not resuming configuration %s, it will be applied again: %v", state.ConfigHash, err)
+			return
+		}
+	}
+	a.lastConfigHash.Store(state.ConfigHash)
+	a.lastApplied.Store(state.LoadBalancer)
+	a.certFingerprint.Store(state.CertFingerprint)
+	log.Printf("Resumed configuration %s saved at %s by agent %s", state.ConfigHash, state.SavedAt.Format(time.RFC3339), state.AgentVersion)
+}
+
+// AppliedLoadBalancer returns the load balancer configuration the agent
+// last applied, as saved in the state directory of cfg, for tools running
+// beside the agent
+func AppliedLoadBalancer(cfg *Config) (*models.LoadBalancer, error) {
+	if cfg.State.Dir == "" {
+		return nil, errors.New("state.dir is not configured: the agent keeps no state")
+	}
+	path := filepath.Join(cfg.State.Dir, stateFileName)
+	// #nosec G304 -- the state directory comes from the agent configuration
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state agentState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid agent state in %s: %w", path, err)
+	}
+	if state.LoadBalancer == nil {
+		return nil, fmt.Errorf("no configuration applied yet in %s", path)
+	}
+	return state.LoadBalancer, nil
+}
+
+// eventFlusher is implemented by event reporters that queue undelivered
+// events for resending
+type eventFlusher interface {
+	FlushEvents(ctx context.Context) error
+}
+
+// flushEvents resends the events queued while the VPSie API was unavailable
+func (a *Agent) flushEvents(ctx context.Context) {
+	flusher, ok := a.events.(eventFlusher)
+	if !ok {
+		return
+	}
+	if err := flusher.FlushEvents(ctx); err != nil {
+		log.Printf("Warning: Failed to resend queued events: %v", err)
+	}
+}
+
+// writeFileAtomic replaces path with data through a synced temporary file,
+// so a crash leaves either the old or the new content
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	// #nosec G304 -- path is inside the configured state directory
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+	}
+	return err
+}
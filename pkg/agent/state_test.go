@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func newStateTestAgent(t *testing.T, stateDir, envoyDir string) *Agent {
+	t.Helper()
+	manager, err := envoy.NewConfigManager(filepath.Join(envoyDir, "dynamic"), nil)
+	if err != nil {
+		t.Fatalf("NewConfigManager() error = %v", err)
+	}
+	return &Agent{
+		config: &Config{
+			Envoy: EnvoySettings{OutputMode: OutputModeFiles},
+			State: StateConfig{Dir: stateDir},
+		},
+		events:         &recordingReporter{},
+		envoyGenerator: envoy.NewGenerator("lb-1", envoyDir, "127.0.0.1:9901", 9901, 50000),
+		envoyManager:   manager,
+		syncCh:         make(chan struct{}, 1),
+	}
+}
+
+func TestAgent_SaveAndRestoreState(t *testing.T) {
+	stateDir, envoyDir := t.TempDir(), t.TempDir()
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "web", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+		Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}},
+	}
+
+	a := newStateTestAgent(t, stateDir, envoyDir)
+	envoyConfig, err := a.envoyGenerator.GenerateFullConfig(lb)
+	if err != nil {
+		t.Fatalf("GenerateFullConfig() error = %v", err)
+	}
+	if err = a.envoyManager.WriteListeners(envoyConfig.Listeners); err != nil {
+		t.Fatalf("WriteListeners() error = %v", err)
+	}
+	if err = a.envoyManager.WriteClusters(envoyConfig.Clusters); err != nil {
+		t.Fatalf("WriteClusters() error = %v", err)
+	}
+	a.lastConfigHash.Store("hash-1")
+	a.lastApplied.Store(lb)
+	a.staged.Store(&StagedChange{ConfigHash: "hash-2", State: ChangePending})
+	if !a.Pause(context.Background(), "incident 42", pausedByAdminAPI) {
+		t.Fatal("Pause() = false")
+	}
+
+	// A restarted agent takes over the applied configuration and the paused state
+	restored := newStateTestAgent(t, stateDir, envoyDir)
+	restored.restoreState()
+	if hash, _ := restored.lastConfigHash.Load().(string); hash != "hash-1" {
+		t.Errorf("config hash = %q, want hash-1", hash)
+	}
+	if applied := restored.lastApplied.Load(); applied == nil || applied.ID != "lb-1" {
+		t.Errorf("last applied = %+v, want lb-1", applied)
+	}
+	if status := restored.paused.Load(); status == nil || status.Reason != "incident 42" {
+		t.Errorf("paused = %+v, want paused for incident 42", status)
+	}
+	if staged := restored.staged.Load(); staged == nil || staged.ConfigHash != "hash-2" {
+		t.Errorf("staged = %+v, want hash-2", staged)
+	}
+	if applied, appliedErr := AppliedLoadBalancer(a.config); appliedErr != nil || applied.Port != 80 {
+		t.Errorf("AppliedLoadBalancer() = %+v, %v, want lb-1", applied, appliedErr)
+	}
+
+	// Envoy's configuration changed since: the configuration is applied again
+	lb.Backends[0].Port = 9090
+	changed, err := a.envoyGenerator.GenerateFullConfig(lb)
+	if err != nil {
+		t.Fatalf("GenerateFullConfig() error = %v", err)
+	}
+	if err = a.envoyManager.WriteClusters(changed.Clusters); err != nil {
+		t.Fatalf("WriteClusters() error = %v", err)
+	}
+	restored = newStateTestAgent(t, stateDir, envoyDir)
+	restored.restoreState()
+	if hash, ok := restored.lastConfigHash.Load().(string); ok {
+		t.Errorf("config hash = %q, want none", hash)
+	}
+	if restored.paused.Load() == nil {
+		t.Error("paused state was not restored")
+	}
+}
+
+func TestAgent_RestoreState_ConfigPause(t *testing.T) {
+	stateDir := t.TempDir()
+	a := newStateTestAgent(t, stateDir, t.TempDir())
+	a.Pause(context.Background(), "", pausedByConfig)
+
+	// The configuration no longer pauses reconciliation
+	restored := newStateTestAgent(t, stateDir, t.TempDir())
+	restored.restoreState()
+	if status := restored.paused.Load(); status != nil {
+		t.Errorf("paused = %+v, want resumed", status)
+	}
+
+	restored = newStateTestAgent(t, stateDir, t.TempDir())
+	restored.config.Pause.Enabled = true
+	restored.restoreState()
+	if status := restored.paused.Load(); status == nil || status.Since.After(time.Now()) {
+		t.Errorf("paused = %+v, want the saved pause", status)
+	}
+}
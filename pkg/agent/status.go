@@ -0,0 +1,191 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ha"
+)
+
+// LoadBalancerStatus is the status of the load balancer reported to VPSie
+type LoadBalancerStatus string
+
+// Load balancer statuses
+const (
+	StatusProvisioning LoadBalancerStatus = "provisioning" // no configuration applied yet
+	StatusActive       LoadBalancerStatus = "active"       // configuration applied and the data plane serves
+	StatusDegraded     LoadBalancerStatus = "degraded"     // serving, but the last sync failed or some backends fail
+	StatusDraining     LoadBalancerStatus = "draining"     // draining before shutting down
+	StatusError        LoadBalancerStatus = "error"        // nothing could be applied, the data plane probe fails or every backend fails
+)
+
+// loadBalancerStatuses lists every status, in the order of their metrics
+var loadBalancerStatuses = []LoadBalancerStatus{StatusProvisioning, StatusActive, StatusDegraded, StatusDraining, StatusError}
+
+// statusTransitions lists the statuses each status may move to. Draining is
+// final: the node shuts down, and the next agent starts over. Nothing moves
+// back to provisioning once a configuration was applied.
+var statusTransitions = map[LoadBalancerStatus][]LoadBalancerStatus{
+	StatusProvisioning: {StatusActive, StatusDegraded, StatusError, StatusDraining},
+	StatusActive:       {StatusDegraded, StatusError, StatusDraining},
+	StatusDegraded:     {StatusActive, StatusError, StatusDraining},
+	StatusError:        {StatusActive, StatusDegraded, StatusDraining},
+	StatusDraining:     {},
+}
+
+// CanTransition reports whether the status may move to next. Any status may
+// be the first one reported.
+func (s LoadBalancerStatus) CanTransition(next LoadBalancerStatus) bool {
+	if s == "" {
+		return true
+	}
+	for _, allowed := range statusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// PoolHealth counts the Envoy hosts of a backend pool that serve
+type PoolHealth struct {
+	Cluster string `json:"cluster"`
+	Pool    string `json:"pool,omitempty"` // empty for the load balancer's own backends
+	Healthy int    `json:"healthy"`
+	Total   int    `json:"total"`
+}
+
+// StatusReport is the load balancer status with the backend health of its
+// pools, so partial outages can be told apart from full failures
+type StatusReport struct {
+	Status LoadBalancerStatus `json:"status"`
+	Pools  []PoolHealth       `json:"pools,omitempty"` // pools Envoy has hosts for
+}
+
+// StatusReporter updates the load balancer status in VPSie
+type StatusReporter interface {
+	UpdateLoadBalancerStatus(ctx context.Context, report StatusReport) error
+}
+
+// UpdateLoadBalancerStatus logs the status
+func (logEventReporter) UpdateLoadBalancerStatus(_ context.Context, report StatusReport) error {
+	log.Printf("Load balancer status: %s%s", report.Status, formatPoolHealth(report.Pools))
+	return nil
+}
+
+// formatPoolHealth formats the pools with failing hosts for the log
+func formatPoolHealth(pools []PoolHealth) string {
+	var failing []string
+	for _, p := range pools {
+		if p.Healthy < p.Total {
+			failing = append(failing, fmt.Sprintf("%s %d/%d", p.Cluster, p.Healthy, p.Total))
+		}
+	}
+	if len(failing) == 0 {
+		return ""
+	}
+	return " (healthy backends: " + strings.Join(failing, ", ") + ")"
+}
+
+// poolHealth counts the serving hosts of every pool of the applied
+// configuration. Pools Envoy has no hosts for, e.g. before the first health
+// sample, are left out.
+func (a *Agent) poolHealth() []PoolHealth {
+	lb := a.lastApplied.Load()
+	if lb == nil {
+		return nil
+	}
+	clusters := a.backendHealth.clusters()
+	var pools []PoolHealth
+	add := func(pool string) {
+		cluster := envoy.ClusterName(lb, pool)
+		if counts, ok := clusters[cluster]; ok {
+			pools = append(pools, PoolHealth{Cluster: cluster, Pool: pool, Healthy: counts.healthy, Total: counts.total})
+		}
+	}
+	add("")
+	for _, pool := range lb.Pools {
+		add(pool.Name)
+	}
+	return pools
+}
+
+// currentStatus returns the load balancer status with the health of its pools
+func (a *Agent) currentStatus() StatusReport {
+	pools := a.poolHealth()
+	return StatusReport{Status: a.computeStatus(pools), Pools: pools}
+}
+
+// computeStatus derives the load balancer status from the last sync, the
+// data plane probe and the health of the pools
+func (a *Agent) computeStatus(pools []PoolHealth) LoadBalancerStatus {
+	if a.draining.Load() {
+		return StatusDraining
+	}
+	sync := a.lastSync.Load()
+	syncFailed := sync != nil && !sync.Success
+	if a.lastApplied.Load() == nil {
+		if syncFailed {
+			return StatusError
+		}
+		return StatusProvisioning
+	}
+	if probe := a.prober.Status(); probe != nil && !probe.Available {
+		return StatusError
+	}
+	healthy, failing := 0, 0
+	for _, p := range pools {
+		healthy += p.Healthy
+		failing += p.Total - p.Healthy
+	}
+	switch {
+	case failing > 0 && healthy == 0:
+		return StatusError
+	case syncFailed || failing > 0:
+		return StatusDegraded
+	}
+	return StatusActive
+}
+
+// reportStatus reports the load balancer status when it, or the health of
+// the pools, changed since it was last reported. Only the active node reports, so an HA pair never reports
+// conflicting statuses. A status that cannot be reached from the last one is
+// logged and dropped; a failed report is retried on the next call.
+func (a *Agent) reportStatus(ctx context.Context) {
+	reporter, ok := a.events.(StatusReporter)
+	if !ok || a.Role() != ha.RoleActive {
+		return
+	}
+
+	a.statusMu.Lock()
+	defer a.statusMu.Unlock()
+	report := a.currentStatus()
+	last := a.status
+	if report.Status == last.Status && (report.Status == StatusDraining || slices.Equal(report.Pools, last.Pools)) {
+		return
+	}
+	if report.Status != last.Status && !last.Status.CanTransition(report.Status) {
+		log.Printf("Warning: Not reporting load balancer status %s: invalid transition from %s", report.Status, last.Status)
+		return
+	}
+	if err := reporter.UpdateLoadBalancerStatus(ctx, report); err != nil {
+		log.Printf("Warning: Failed to update load balancer status: %v", err)
+		return
+	}
+	log.Printf("Reported load balancer status %s%s", report.Status, formatPoolHealth(report.Pools))
+	a.status = report
+}
+
+// forgetStatus makes the next reportStatus report the status even if it did
+// not change, e.g. after the other node of an HA pair reported its own
+func (a *Agent) forgetStatus() {
+	a.statusMu.Lock()
+	defer a.statusMu.Unlock()
+	if a.status.Status != StatusDraining {
+		a.status = StatusReport{}
+	}
+}
@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/ha"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestLoadBalancerStatus_CanTransition(t *testing.T) {
+	tests := []struct {
+		from, to LoadBalancerStatus
+		want     bool
+	}{
+		{"", StatusProvisioning, true},
+		{"", StatusDraining, true},
+		{StatusProvisioning, StatusActive, true},
+		{StatusActive, StatusDegraded, true},
+		{StatusDegraded, StatusActive, true},
+		{StatusError, StatusActive, true},
+		{StatusActive, StatusDraining, true},
+		{StatusActive, StatusProvisioning, false},
+		{StatusDraining, StatusActive, false},
+		{StatusDraining, StatusError, false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanTransition(tt.to); got != tt.want {
+			t.Errorf("%q.CanTransition(%q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestAgent_ComputeStatus(t *testing.T) {
+	a := &Agent{}
+	if got := a.currentStatus().Status; got != StatusProvisioning {
+		t.Errorf("status before any sync = %s, want provisioning", got)
+	}
+	a.recordSync(errors.New("source unreachable"))
+	if got := a.currentStatus().Status; got != StatusError {
+		t.Errorf("status without an applied configuration = %s, want error", got)
+	}
+
+	lb := &models.LoadBalancer{ID: "lb-1", Pools: []models.BackendPool{{Name: "api"}}}
+	a.lastApplied.Store(lb)
+	if got := a.currentStatus().Status; got != StatusDegraded {
+		t.Errorf("status after a failed sync = %s, want degraded", got)
+	}
+	a.recordSync(nil)
+	if got := a.currentStatus().Status; got != StatusActive {
+		t.Errorf("status = %s, want active", got)
+	}
+
+	web, api := envoy.ClusterName(lb, ""), envoy.ClusterName(lb, "api")
+	observe := func(webHealth, apiHealth string) {
+		a.backendHealth.observe([]envoy.HostStatus{
+			{Cluster: web, Address: "10.0.0.1:80", Health: envoy.HostHealthy},
+			{Cluster: web, Address: "10.0.0.2:80", Health: webHealth},
+			{Cluster: api, Address: "10.0.1.1:80", Health: apiHealth},
+			{Cluster: "waf_sidecar", Address: "127.0.0.1:9000", Health: envoy.HostUnhealthy}, // not a backend pool
+		}, time.Now())
+	}
+	observe(envoy.HostHealthy, envoy.HostHealthy)
+	if got := a.currentStatus().Status; got != StatusActive {
+		t.Errorf("status with every backend healthy = %s, want active", got)
+	}
+
+	// Some backends fail: degraded, with the health of every pool
+	observe(envoy.HostEjected, envoy.HostUnhealthy)
+	report := a.currentStatus()
+	want := []PoolHealth{{Cluster: web, Healthy: 1, Total: 2}, {Cluster: api, Pool: "api", Healthy: 0, Total: 1}}
+	if report.Status != StatusDegraded || !reflect.DeepEqual(report.Pools, want) {
+		t.Errorf("currentStatus() with some backends failing = %+v, want degraded with %+v", report, want)
+	}
+	var metrics strings.Builder
+	a.writeStatusMetrics(&metrics)
+	for _, line := range []string{
+		`vpsie_lb_status{status="degraded"} 1`,
+		`vpsie_lb_status{status="active"} 0`,
+		`vpsie_lb_pool_backends_healthy{cluster="` + web + `",pool=""} 1`,
+		`vpsie_lb_pool_backends_total{cluster="` + api + `",pool="api"} 1`,
+	} {
+		if !strings.Contains(metrics.String(), line) {
+			t.Errorf("metrics do not contain %s:\n%s", line, metrics.String())
+		}
+	}
+
+	// Every backend fails
+	a.backendHealth.observe([]envoy.HostStatus{
+		{Cluster: web, Address: "10.0.0.1:80", Health: envoy.HostUnhealthy},
+		{Cluster: api, Address: "10.0.1.1:80", Health: envoy.HostUnhealthy},
+	}, time.Now())
+	if got := a.currentStatus().Status; got != StatusError {
+		t.Errorf("status with every backend failing = %s, want error", got)
+	}
+
+	observe(envoy.HostHealthy, envoy.HostHealthy)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		a.prober.record("127.0.0.1:80", probeResult{err: errors.New("connection refused")}, 3, now)
+	}
+	if got := a.currentStatus().Status; got != StatusError {
+		t.Errorf("status with the data plane unavailable = %s, want error", got)
+	}
+
+	a.draining.Store(true)
+	if got := a.currentStatus().Status; got != StatusDraining {
+		t.Errorf("status while draining = %s, want draining", got)
+	}
+}
+
+func TestAgent_ReportStatus(t *testing.T) {
+	reporter := &recordingReporter{}
+	a := &Agent{config: &Config{}, events: reporter}
+
+	a.reportStatus(context.Background())
+	a.reportStatus(context.Background()) // unchanged: not reported again
+	a.lastApplied.Store(&models.LoadBalancer{ID: "lb-1"})
+	a.recordSync(errors.New("envoy validation failed"))
+	a.reportStatus(context.Background())
+	a.recordSync(nil)
+	a.reportStatus(context.Background())
+
+	// A backend failing changes the pool health, and so does it recovering
+	cluster := envoy.ClusterName(a.lastApplied.Load(), "")
+	for _, health := range []string{envoy.HostUnhealthy, envoy.HostHealthy} {
+		a.backendHealth.observe([]envoy.HostStatus{
+			{Cluster: cluster, Address: "10.0.0.1:80", Health: envoy.HostHealthy},
+			{Cluster: cluster, Address: "10.0.0.2:80", Health: health},
+		}, time.Now())
+		a.reportStatus(context.Background())
+	}
+
+	// The passive node of an HA pair stays silent
+	a.role.Store(ha.RolePassive)
+	a.draining.Store(true)
+	a.reportStatus(context.Background())
+	a.role.Store(ha.RoleActive)
+	a.reportStatus(context.Background())
+
+	// Draining is final
+	a.draining.Store(false)
+	a.reportStatus(context.Background())
+
+	want := []LoadBalancerStatus{StatusProvisioning, StatusDegraded, StatusActive, StatusDegraded, StatusActive, StatusDraining}
+	if !reflect.DeepEqual(reporter.statuses, want) {
+		t.Errorf("statuses = %v, want %v", reporter.statuses, want)
+	}
+	if pools := reporter.reports[3].Pools; len(pools) != 1 || pools[0].Healthy != 1 || pools[0].Total != 2 {
+		t.Errorf("pools reported while degraded = %+v, want 1 of 2 healthy", pools)
+	}
+}
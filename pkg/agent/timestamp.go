@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimestampLayout is RFC3339 with fixed nanosecond precision. Timestamps are
+// always rendered in UTC so records from nodes in different local timezones
+// can be correlated directly.
+const TimestampLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// Timestamp is a UTC wall-clock time paired with the agent's monotonic
+// sequence number. The sequence orders records emitted by one agent even when
+// the wall clock steps backwards (NTP adjustments) or two records share a time.
+type Timestamp struct {
+	Time time.Time
+	Seq  uint64
+}
+
+var (
+	sequenceMu   sync.Mutex
+	sequenceLast uint64
+)
+
+// NextTimestamp returns the current UTC time and the next sequence number.
+// Sequence numbers are strictly increasing for the lifetime of the process.
+func NextTimestamp() Timestamp {
+	sequenceMu.Lock()
+	defer sequenceMu.Unlock()
+
+	sequenceLast++
+	return Timestamp{Time: time.Now().UTC(), Seq: sequenceLast}
+}
+
+// String formats the timestamp as RFC3339 UTC with nanosecond precision
+func (t Timestamp) String() string {
+	return t.Time.UTC().Format(TimestampLayout)
+}
+
+// LogWriter prefixes every line written through it with a Timestamp and its
+// sequence number. It is meant to be installed with log.SetOutput together
+// with log flags that omit the standard date and time. Lines below the
+// configured level are dropped; the level of a line comes from its message
+// prefix (see logLevel).
+type LogWriter struct {
+	out   io.Writer
+	mu    sync.Mutex
+	level slog.Level // lowest level written, info until configured
+	json  bool       // one JSON object per line instead of text
+}
+
+// NewLogWriter creates a LogWriter writing text lines of level info and
+// above to out
+func NewLogWriter(out io.Writer) *LogWriter {
+	return &LogWriter{out: out, level: slog.LevelInfo}
+}
+
+// Configure applies logging.level and logging.format. Settings that fail to
+// parse keep the current ones; LoadConfig validates them.
+func (w *LogWriter) Configure(cfg LoggingConfig) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err == nil {
+		w.level = level
+	}
+	if validLogFormats[cfg.Format] {
+		w.json = cfg.Format == "json"
+	}
+}
+
+// logRecord is a log line in the json format
+type logRecord struct {
+	Time   string `json:"time"`
+	Seq    uint64 `json:"seq"`
+	Level  string `json:"level"`
+	Source string `json:"source,omitempty"`
+	Msg    string `json:"msg"`
+}
+
+// Write writes p prefixed with the timestamp and sequence number, or as a
+// JSON record in the json format
+func (w *LogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	source, msg := splitLogSource(p)
+	level := logLevel(msg)
+	if level < w.level {
+		return len(p), nil
+	}
+
+	ts := NextTimestamp()
+	var line []byte
+	if w.json {
+		record, err := json.Marshal(logRecord{
+			Time:   ts.String(),
+			Seq:    ts.Seq,
+			Level:  strings.ToLower(level.String()),
+			Source: string(source),
+			Msg:    string(bytes.TrimRight(msg, "\n")),
+		})
+		if err != nil {
+			return 0, err
+		}
+		line = append(record, '\n')
+	} else {
+		line = make([]byte, 0, len(TimestampLayout)+24+len(p))
+		line = append(line, ts.String()...)
+		line = append(line, " seq="...)
+		line = strconv.AppendUint(line, ts.Seq, 10)
+		line = append(line, ' ')
+		line = append(line, p...)
+	}
+
+	if _, err := w.out.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// splitLogSource splits the file:line prefix written with log.Lshortfile from
+// a log line. Lines without one are returned whole as the message.
+func splitLogSource(p []byte) (source, msg []byte) {
+	i := bytes.Index(p, []byte(": "))
+	if i < 0 {
+		return nil, p
+	}
+	file, lineNo, ok := bytes.Cut(p[:i], []byte(":"))
+	if !ok || !bytes.HasSuffix(file, []byte(".go")) {
+		return nil, p
+	}
+	if _, err := strconv.Atoi(string(lineNo)); err != nil {
+		return nil, p
+	}
+	return p[:i], p[i+2:]
+}
+
+// logLevel returns the level of a log message from the prefix the agent's
+// messages use: "Debug:", "Warning:", and "Error", "Failed" or "CRITICAL"
+// for errors. Other messages are info.
+func logLevel(msg []byte) slog.Level {
+	switch {
+	case bytes.HasPrefix(msg, []byte("Debug:")):
+		return slog.LevelDebug
+	case bytes.HasPrefix(msg, []byte("Warning:")):
+		return slog.LevelWarn
+	case bytes.HasPrefix(msg, []byte("Error")), bytes.HasPrefix(msg, []byte("Failed")), bytes.HasPrefix(msg, []byte("CRITICAL")):
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// applyLogging configures the LogWriter installed with log.SetOutput, if any
+func applyLogging(cfg LoggingConfig) {
+	if w, ok := log.Writer().(*LogWriter); ok {
+		w.Configure(cfg)
+	}
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNextTimestamp_Monotonic(t *testing.T) {
+	prev := NextTimestamp()
+	for i := 0; i < 100; i++ {
+		ts := NextTimestamp()
+		if ts.Seq <= prev.Seq {
+			t.Fatalf("sequence not increasing: %d after %d", ts.Seq, prev.Seq)
+		}
+		prev = ts
+	}
+}
+
+func TestTimestamp_String(t *testing.T) {
+	loc := time.FixedZone("UTC+5", 5*60*60)
+	ts := Timestamp{Time: time.Date(2024, 3, 1, 17, 4, 5, 120, loc)}
+
+	got := ts.String()
+	want := "2024-03-01T12:04:05.000000120Z"
+	if got != want {
+		t.Errorf("String() = %v, want %v", got, want)
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, got); err != nil {
+		t.Errorf("String() is not valid RFC3339: %v", err)
+	}
+}
+
+func TestLogWriter_Write(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf)
+
+	n, err := w.Write([]byte("hello\n"))
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if n != len("hello\n") {
+		t.Errorf("Write() n = %d, want %d", n, len("hello\n"))
+	}
+
+	fields := strings.SplitN(buf.String(), " ", 3)
+	if len(fields) != 3 {
+		t.Fatalf("unexpected log line: %q", buf.String())
+	}
+	if _, err = time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+		t.Errorf("invalid timestamp prefix %q: %v", fields[0], err)
+	}
+	if !strings.HasPrefix(fields[1], "seq=") {
+		t.Errorf("missing sequence prefix, got %q", fields[1])
+	}
+	if fields[2] != "hello\n" {
+		t.Errorf("message = %q, want %q", fields[2], "hello\n")
+	}
+}
+
+func TestLogWriter_LevelAndFormat(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf)
+	w.Configure(LoggingConfig{Level: "warn", Format: "json"})
+
+	for _, line := range []string{
+		"agent.go:42: Configuration applied\n",
+		"agent.go:43: Warning: Failed to report status: timeout\n",
+		"Error syncing configuration: boom\n",
+	} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want the info line dropped: %q", len(lines), buf.String())
+	}
+	var records []logRecord
+	for _, line := range lines {
+		var r logRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", line, err)
+		}
+		records = append(records, r)
+	}
+	if r := records[0]; r.Level != "warn" || r.Source != "agent.go:43" || r.Msg != "Warning: Failed to report status: timeout" || r.Seq == 0 {
+		t.Errorf("record = %+v", r)
+	}
+	if r := records[1]; r.Level != "error" || r.Source != "" || r.Msg != "Error syncing configuration: boom" {
+		t.Errorf("record = %+v", r)
+	}
+
+	// Back to text, with info lines
+	buf.Reset()
+	w.Configure(LoggingConfig{Level: "info", Format: "text"})
+	_, _ = w.Write([]byte("agent.go:42: Configuration applied\n"))
+	if !strings.HasSuffix(buf.String(), " agent.go:42: Configuration applied\n") || strings.HasPrefix(buf.String(), "{") {
+		t.Errorf("text line = %q", buf.String())
+	}
+}
@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// VariablesConfig lets load balancer configurations reference variables of
+// the node as ${NAME}, so one definition can be deployed to several regions
+// or nodes. Only allow-listed variables are substituted; a reference to any
+// other fails the sync. $${NAME} stands for a literal ${NAME}.
+type VariablesConfig struct {
+	Allow  []string          `yaml:"allow"`  // variables configurations may reference; none disables substitution
+	Values map[string]string `yaml:"values"` // variables of this node besides the built-in ones
+}
+
+// Built-in variables, taken from the agent configuration of the node
+const (
+	VariableNodeRegion      = "NODE_REGION"      // envoy.locality.region, or the region known to VPSie
+	VariableNodeZone        = "NODE_ZONE"        // envoy.locality.zone, or the zone known to VPSie
+	VariableNodeID          = "NODE_ID"          // ha.node_id
+	VariableNodeHostname    = "NODE_HOSTNAME"    // the hostname
+	VariableNodeEnvironment = "NODE_ENVIRONMENT" // environment
+)
+
+var builtinVariables = []string{VariableNodeRegion, VariableNodeZone, VariableNodeID, VariableNodeHostname, VariableNodeEnvironment}
+
+// maxVariableValueLength bounds the values of variables.values
+const maxVariableValueLength = 1024
+
+var (
+	// variableNameRegex validates variable names such as NODE_REGION
+	variableNameRegex = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,63}$`)
+
+	// variableRefRegex matches ${NAME} references, and the $${NAME} escapes
+	// of literal ones
+	variableRefRegex = regexp.MustCompile(`\$?\$\{([^}]*)\}`)
+)
+
+// validate checks the variable settings
+func (c *VariablesConfig) validate() []error {
+	var errs []error
+	for _, name := range c.Allow {
+		_, defined := c.Values[name]
+		if !variableNameRegex.MatchString(name) {
+			errs = append(errs, fmt.Errorf("variables.allow name %q is invalid: must be upper case letters, digits or '_'", name))
+		} else if !defined && !slices.Contains(builtinVariables, name) {
+			errs = append(errs, fmt.Errorf("variables.allow name %s is neither built in nor set in variables.values", name))
+		}
+	}
+
+	names := make([]string, 0, len(c.Values))
+	for name := range c.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := c.Values[name]
+		switch {
+		case slices.Contains(builtinVariables, name):
+			errs = append(errs, fmt.Errorf("variables.values.%s is invalid: built-in variables cannot be overridden", name))
+		case !slices.Contains(c.Allow, name):
+			errs = append(errs, fmt.Errorf("variables.values.%s is not in variables.allow", name))
+		case len(value) > maxVariableValueLength || strings.ContainsFunc(value, unicode.IsControl) || strings.Contains(value, "${"):
+			errs = append(errs, fmt.Errorf("variables.values.%s is invalid: must be at most %d characters without control characters or variable references", name, maxVariableValueLength))
+		}
+	}
+	return errs
+}
+
+// variables returns the value of every allow-listed variable on this node
+func (a *Agent) variables() map[string]string {
+	cfg := a.currentConfig()
+	vars := make(map[string]string, len(cfg.Variables.Allow))
+	locality := a.node.locality(cfg)
+	for _, name := range cfg.Variables.Allow {
+		switch name {
+		case VariableNodeRegion:
+			vars[name] = locality.Region
+		case VariableNodeZone:
+			vars[name] = locality.Zone
+		case VariableNodeID:
+			vars[name] = cfg.HA.NodeID
+		case VariableNodeHostname:
+			vars[name], _ = os.Hostname()
+		case VariableNodeEnvironment:
+			vars[name] = cfg.Environment
+		default:
+			vars[name] = cfg.Variables.Values[name]
+		}
+	}
+	return vars
+}
+
+// expandVariables substitutes the variables of this node in every string of
+// lb. Escapes are unescaped and references to variables that are not
+// allow-listed fail even when no variable is allowed.
+func (a *Agent) expandVariables(lb *models.LoadBalancer) error {
+	return substituteVariables(reflect.ValueOf(lb).Elem(), a.variables())
+}
+
+// substituteVariables substitutes vars in every settable string reachable
+// from v
+func substituteVariables(v reflect.Value, vars map[string]string) error {
+	switch v.Kind() {
+	case reflect.String:
+		expanded, err := expandString(v.String(), vars)
+		if err != nil {
+			return err
+		}
+		if v.CanSet() {
+			v.SetString(expanded)
+		}
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			return substituteVariables(v.Elem(), vars)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			if err := substituteVariables(v.Field(i), vars); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := substituteVariables(v.Index(i), vars); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// Map values are not addressable: substitute in a copy
+			value := reflect.New(iter.Value().Type()).Elem()
+			value.Set(iter.Value())
+			if err := substituteVariables(value, vars); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), value)
+		}
+	}
+	return nil
+}
+
+// expandString substitutes vars in s. It fails for a reference to a variable
+// that is not allow-listed or has no value on this node.
+func expandString(s string, vars map[string]string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var err error
+	expanded := variableRefRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		name := ref[2 : len(ref)-1]
+		value, ok := vars[name]
+		switch {
+		case err != nil:
+		case !ok:
+			err = fmt.Errorf("variable ${%s} is not allowed on this node (variables.allow)", name)
+		case value == "":
+			err = fmt.Errorf("variable ${%s} has no value on this node", name)
+		}
+		return value
+	})
+	return expanded, err
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestVariablesConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     VariablesConfig
+		wantErr bool
+	}{
+		{name: "disabled", cfg: VariablesConfig{}, wantErr: false},
+		{name: "built-in", cfg: VariablesConfig{Allow: []string{"NODE_REGION", "NODE_ID"}}, wantErr: false},
+		{name: "custom", cfg: VariablesConfig{Allow: []string{"DB_VIP"}, Values: map[string]string{"DB_VIP": "10.0.5.10"}}, wantErr: false},
+		{name: "invalid name", cfg: VariablesConfig{Allow: []string{"db-vip"}}, wantErr: true},
+		{name: "allowed without value", cfg: VariablesConfig{Allow: []string{"DB_VIP"}}, wantErr: true},
+		{name: "value not allowed", cfg: VariablesConfig{Values: map[string]string{"DB_VIP": "10.0.5.10"}}, wantErr: true},
+		{name: "built-in overridden", cfg: VariablesConfig{Allow: []string{"NODE_REGION"}, Values: map[string]string{"NODE_REGION": "ams"}}, wantErr: true},
+		{name: "control character", cfg: VariablesConfig{Allow: []string{"DB_VIP"}, Values: map[string]string{"DB_VIP": "10.0.5.10\n"}}, wantErr: true},
+		{name: "nested reference", cfg: VariablesConfig{Allow: []string{"DB_VIP"}, Values: map[string]string{"DB_VIP": "${NODE_ID}"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := tt.cfg.validate()
+			if (len(errs) > 0) != tt.wantErr {
+				t.Errorf("validate() = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAgent_ExpandVariables(t *testing.T) {
+	a := &Agent{config: &Config{
+		Environment: EnvironmentStaging,
+		Envoy:       EnvoySettings{Locality: LocalitySettings{Region: "ams1"}},
+		Variables: VariablesConfig{
+			Allow:  []string{"NODE_REGION", "NODE_ENVIRONMENT", "NODE_ZONE", "DB_VIP"},
+			Values: map[string]string{"DB_VIP": "10.0.5.10"},
+		},
+	}}
+
+	lb := &models.LoadBalancer{
+		Name: "web-${NODE_REGION}",
+		Backends: []models.Backend{
+			{ID: "db", Address: "${DB_VIP}", Labels: map[string]string{"env": "${NODE_ENVIRONMENT}"}},
+		},
+		Pools:  []models.BackendPool{{Name: "api", Selector: "region=${NODE_REGION}"}},
+		Routes: []models.Route{{Name: "regional", Hosts: []string{"${NODE_REGION}.example.com"}, Path: "/$${NODE_REGION}"}},
+	}
+	if err := a.expandVariables(lb); err != nil {
+		t.Fatalf("expandVariables() error = %v", err)
+	}
+	if lb.Name != "web-ams1" || lb.Backends[0].Address != "10.0.5.10" || lb.Backends[0].Labels["env"] != EnvironmentStaging {
+		t.Errorf("expanded = %q, backend %+v", lb.Name, lb.Backends[0])
+	}
+	if lb.Pools[0].Selector != "region=ams1" {
+		t.Errorf("pool selector = %q, want region=ams1", lb.Pools[0].Selector)
+	}
+	if route := lb.Routes[0]; route.Hosts[0] != "ams1.example.com" || route.Path != "/${NODE_REGION}" {
+		t.Errorf("route = %+v, want the host expanded and the escaped path literal", route)
+	}
+
+	// Variables that are not allow-listed, or have no value here, fail
+	for _, name := range []string{"lb-${NODE_ID}", "lb-${NODE_ZONE}", "lb-${node_region}"} {
+		if err := a.expandVariables(&models.LoadBalancer{Name: name}); err == nil {
+			t.Errorf("expandVariables(%q) succeeded", name)
+		}
+	}
+
+	// Without allow-listed variables escapes still apply and references fail
+	a.config.Variables = VariablesConfig{}
+	lb = &models.LoadBalancer{Name: "web-$${NODE_REGION}"}
+	if err := a.expandVariables(lb); err != nil || lb.Name != "web-${NODE_REGION}" {
+		t.Errorf("expandVariables() without variables = %v, name %q", err, lb.Name)
+	}
+	if err := a.expandVariables(&models.LoadBalancer{Name: "web-${NODE_REGION}"}); err == nil {
+		t.Error("expandVariables() without variables succeeded for ${NODE_REGION}")
+	}
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+)
+
+// VerifySettings makes the agent check, after every apply, that Envoy runs
+// the listeners and cluster endpoints it was given. A reload can succeed
+// while Envoy rejects the new files, leaving the old configuration active.
+type VerifySettings struct {
+	Enabled bool          `yaml:"enabled"`
+	Timeout time.Duration `yaml:"timeout"` // how long Envoy gets to load the configuration, default 30s
+}
+
+// Default and bounds of envoy.verify.timeout
+const (
+	defaultVerifyTimeout = 30 * time.Second
+	minVerifyTimeout     = time.Second
+	maxVerifyTimeout     = 10 * time.Minute
+)
+
+// verifyPollInterval is how often the config dump is compared while Envoy
+// loads the configuration
+var verifyPollInterval = time.Second
+
+// setDefaults fills in unset verification settings
+func (v *VerifySettings) setDefaults() {
+	if v.Timeout == 0 {
+		v.Timeout = defaultVerifyTimeout
+	}
+}
+
+// validate checks the verification settings
+func (v *VerifySettings) validate() []error {
+	if !v.Enabled {
+		return nil
+	}
+	if v.Timeout < minVerifyTimeout || v.Timeout > maxVerifyTimeout {
+		return []error{fmt.Errorf("envoy.verify.timeout %s is out of range: must be between %s and %s", v.Timeout, minVerifyTimeout, maxVerifyTimeout)}
+	}
+	return nil
+}
+
+// verifyApplied compares Envoy's config dump with config until they match
+// or the verification timeout passes. A divergence that persists is logged
+// and reported with a config_divergence event; the sync itself stands, as
+// the files on disk are what the agent intended.
+func (a *Agent) verifyApplied(ctx context.Context, configHash string, config *envoy.EnvoyConfig) {
+	settings := a.currentConfig().Envoy.Verify
+	if !settings.Enabled {
+		return
+	}
+	want, err := config.ActiveConfig()
+	if err != nil {
+		log.Printf("Warning: Cannot verify the applied configuration: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, settings.Timeout)
+	defer cancel()
+	ticker := time.NewTicker(verifyPollInterval)
+	defer ticker.Stop()
+	var divergence []string
+	for {
+		running, err := a.envoyAdmin.ActiveConfig(ctx)
+		if err != nil {
+			divergence = []string{err.Error()}
+		} else if divergence = want.Divergence(running); len(divergence) == 0 {
+			log.Printf("Envoy runs the applied configuration (hash: %s)", configHash)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			a.reportDivergence(ctx, configHash, divergence)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reportDivergence logs and reports a configuration Envoy did not load
+func (a *Agent) reportDivergence(ctx context.Context, configHash string, divergence []string) {
+	log.Printf("Error: Envoy does not run the applied configuration (hash: %s): %s", configHash, strings.Join(divergence, "; "))
+	// ctx has expired; the event still has to go out
+	eventCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	a.sendEvent(eventCtx, NewEvent(EventConfigDivergence, "Envoy does not run the applied configuration", map[string]interface{}{
+		"config_hash": configHash,
+		"divergence":  divergence,
+		"epoch":       a.envoyReloader.GetCurrentEpoch(),
+	}))
+}
@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+)
+
+func TestAgent_VerifyApplied(t *testing.T) {
+	oldInterval := verifyPollInterval
+	verifyPollInterval = 10 * time.Millisecond
+	defer func() { verifyPollInterval = oldInterval }()
+
+	// Envoy loads the new listener on poll number loadAfter
+	var polls, loadAfter atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("resource") {
+		case "dynamic_active_listeners":
+			name := "listener_old"
+			if polls.Add(1) >= loadAfter.Load() {
+				name = "listener_new"
+			}
+			_, _ = w.Write([]byte(`{"configs": [{"name": "` + name + `", "active_state": {}}]}`))
+		default:
+			_, _ = w.Write([]byte(`{"configs": []}`))
+		}
+	}))
+	defer server.Close()
+
+	pidFile := filepath.Join(t.TempDir(), "envoy.pid")
+	if err := os.WriteFile(pidFile, []byte("4242\n"), 0600); err != nil {
+		t.Fatalf("failed to write PID file: %v", err)
+	}
+	reloader, err := envoy.NewReloader("/usr/bin/envoy", "/tmp/envoy.yaml", pidFile, "")
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	config := &envoy.EnvoyConfig{Listeners: []byte("- name: listener_new\n"), Clusters: []byte("[]\n")}
+
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		loadAfter  int32
+		wantEvents int
+	}{
+		{name: "loaded within the timeout", timeout: time.Second, loadAfter: 3},
+		{name: "still diverging at the timeout", timeout: 50 * time.Millisecond, loadAfter: 1000, wantEvents: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			polls.Store(0)
+			loadAfter.Store(tt.loadAfter)
+			reporter := &recordingReporter{}
+			a := &Agent{
+				config:        &Config{Envoy: EnvoySettings{Verify: VerifySettings{Enabled: true, Timeout: tt.timeout}}},
+				events:        reporter,
+				envoyAdmin:    envoy.NewAdminClient(strings.TrimPrefix(server.URL, "http://")),
+				envoyReloader: reloader,
+			}
+			a.verifyApplied(context.Background(), "hash-1", config)
+			if len(reporter.events) != tt.wantEvents {
+				t.Fatalf("events = %v, want %d", reporter.events, tt.wantEvents)
+			}
+			if tt.wantEvents > 0 && reporter.events[0] != "config_divergence" {
+				t.Errorf("event = %s, want config_divergence", reporter.events[0])
+			}
+		})
+	}
+}
@@ -32,6 +32,7 @@ type VPSieClient struct {
 	apiKey         string
 	baseURL        string
 	loadBalancerID string
+	eventQueue     *eventQueue // nil drops events the API does not accept
 }
 
 // isPrivateOrLocalhost checks if an IP or hostname is private or localhost
@@ -234,17 +235,14 @@ func (c *VPSieClient) GetLoadBalancerConfig(ctx context.Context) (*models.LoadBa
 }
 
 // UpdateLoadBalancerStatus updates the load balancer status in VPSie
-func (c *VPSieClient) UpdateLoadBalancerStatus(ctx context.Context, status string) error {
+func (c *VPSieClient) UpdateLoadBalancerStatus(ctx context.Context, report StatusReport) error {
 	// Add timeout to prevent hanging requests
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	url := fmt.Sprintf("%s/loadbalancers/%s/status", c.baseURL, sanitizeID(c.loadBalancerID))
 
-	payload := map[string]string{
-		"status": status,
-	}
-	jsonData, err := json.Marshal(payload)
+	jsonData, err := json.Marshal(report)
 	if err != nil {
 		return fmt.Errorf("failed to marshal status: %w", err)
 	}
@@ -280,25 +278,116 @@ func (c *VPSieClient) UpdateLoadBalancerStatus(ctx context.Context, status strin
 	return nil
 }
 
-// UpdateBackendStatus updates the status of a specific backend server
-func (c *VPSieClient) UpdateBackendStatus(ctx context.Context, backendID string, healthy bool) error {
-	// Add timeout to prevent hanging requests
+// AcquireLease acquires or renews the load balancer's reconciliation lease
+// for holder. It returns false when another agent holds the lease.
+func (c *VPSieClient) AcquireLease(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	url := fmt.Sprintf("%s/loadbalancers/%s/backends/%s/health", c.baseURL, sanitizeID(c.loadBalancerID), sanitizeID(backendID))
+	url := fmt.Sprintf("%s/loadbalancers/%s/lease", c.baseURL, sanitizeID(c.loadBalancerID))
 
-	status := "unhealthy"
-	if healthy {
-		status = "healthy"
+	payload := map[string]interface{}{
+		"holder":      holder,
+		"ttl_seconds": int(ttl.Seconds()),
+	}
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal lease: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute request: %w", err)
 	}
+	defer func() {
+		// Drain response body to enable HTTP connection reuse
+		//nolint:errcheck // Intentionally ignore - draining is best effort for connection reuse
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return true, nil
+	case http.StatusConflict:
+		return false, nil
+	default:
+		body, readErr := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		if readErr != nil {
+			return false, fmt.Errorf("API returned status %d (failed to read response body: %w)", resp.StatusCode, readErr)
+		}
+		errMsg := truncateErrorMessage(string(body), 200)
+		return false, fmt.Errorf("API returned status %d: %s", resp.StatusCode, errMsg)
+	}
+}
+
+// ReleaseLease releases the reconciliation lease if holder owns it
+func (c *VPSieClient) ReleaseLease(ctx context.Context, holder string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	url := fmt.Sprintf("%s/loadbalancers/%s/lease", c.baseURL, sanitizeID(c.loadBalancerID))
+
+	jsonData, err := json.Marshal(map[string]string{"holder": holder})
+	if err != nil {
+		return fmt.Errorf("failed to marshal lease: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer func() {
+		// Drain response body to enable HTTP connection reuse
+		//nolint:errcheck // Intentionally ignore - draining is best effort for connection reuse
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+	}()
+
+	// A lease that already expired or moved on is as good as released
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound, http.StatusConflict:
+		return nil
+	default:
+		body, readErr := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		if readErr != nil {
+			return fmt.Errorf("API returned status %d (failed to read response body: %w)", resp.StatusCode, readErr)
+		}
+		errMsg := truncateErrorMessage(string(body), 200)
+		return fmt.Errorf("API returned status %d: %s", resp.StatusCode, errMsg)
+	}
+}
+
+// AssignFloatingIP asks VPSie to route the load balancer's floating IP to nodeID
+func (c *VPSieClient) AssignFloatingIP(ctx context.Context, address, nodeID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	url := fmt.Sprintf("%s/loadbalancers/%s/floating-ip", c.baseURL, sanitizeID(c.loadBalancerID))
 
 	payload := map[string]string{
-		"status": status,
+		"address": address,
+		"node_id": nodeID,
 	}
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal backend status: %w", err)
+		return fmt.Errorf("failed to marshal floating IP assignment: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewBuffer(jsonData))
@@ -332,20 +421,28 @@ func (c *VPSieClient) UpdateBackendStatus(ctx context.Context, backendID string,
 	return nil
 }
 
-// ReportMetrics sends metrics data to VPSie API
-func (c *VPSieClient) ReportMetrics(ctx context.Context, metrics map[string]interface{}) error {
+// UpdateBackendStatus updates the status of a specific backend server
+func (c *VPSieClient) UpdateBackendStatus(ctx context.Context, backendID string, healthy bool) error {
 	// Add timeout to prevent hanging requests
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	url := fmt.Sprintf("%s/loadbalancers/%s/metrics", c.baseURL, sanitizeID(c.loadBalancerID))
+	url := fmt.Sprintf("%s/loadbalancers/%s/backends/%s/health", c.baseURL, sanitizeID(c.loadBalancerID), sanitizeID(backendID))
 
-	jsonData, err := json.Marshal(metrics)
+	status := "unhealthy"
+	if healthy {
+		status = "healthy"
+	}
+
+	payload := map[string]string{
+		"status": status,
+	}
+	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal metrics: %w", err)
+		return fmt.Errorf("failed to marshal backend status: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -364,7 +461,7 @@ func (c *VPSieClient) ReportMetrics(ctx context.Context, metrics map[string]inte
 		_ = resp.Body.Close()
 	}()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
 		body, readErr := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
 		if readErr != nil {
 			return fmt.Errorf("API returned status %d (failed to read response body: %w)", resp.StatusCode, readErr)
@@ -376,24 +473,26 @@ func (c *VPSieClient) ReportMetrics(ctx context.Context, metrics map[string]inte
 	return nil
 }
 
-// SendEvent sends an event notification to VPSie API
-func (c *VPSieClient) SendEvent(ctx context.Context, eventType, message string, metadata map[string]interface{}) error {
+// ReportMetrics sends metrics data to VPSie API
+func (c *VPSieClient) ReportMetrics(ctx context.Context, metrics map[string]interface{}) error {
 	// Add timeout to prevent hanging requests
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	url := fmt.Sprintf("%s/loadbalancers/%s/events", c.baseURL, sanitizeID(c.loadBalancerID))
+	url := fmt.Sprintf("%s/loadbalancers/%s/metrics", c.baseURL, sanitizeID(c.loadBalancerID))
 
-	payload := map[string]interface{}{
-		"type":      eventType,
-		"message":   message,
-		"metadata":  metadata,
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	// Stamp the report without mutating the caller's map
+	ts := NextTimestamp()
+	payload := make(map[string]interface{}, len(metrics)+2)
+	for k, v := range metrics {
+		payload[k] = v
 	}
+	payload["timestamp"] = ts.String()
+	payload["sequence"] = ts.Seq
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
+		return fmt.Errorf("failed to marshal metrics: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
@@ -426,3 +525,57 @@ func (c *VPSieClient) SendEvent(ctx context.Context, eventType, message string,
 
 	return nil
 }
+
+// SendEvent sends an event notification to VPSie API. With an event queue,
+// events the API cannot take now are queued and resent in order before the
+// next event.
+func (c *VPSieClient) SendEvent(ctx context.Context, event Event) error {
+	ts := NextTimestamp()
+	payload, err := json.Marshal(struct {
+		Event
+		Timestamp string `json:"timestamp"`
+		Sequence  uint64 `json:"sequence"`
+	}{Event: event, Timestamp: ts.String(), Sequence: ts.Seq})
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	post := func(event json.RawMessage) error {
+		reqURL := fmt.Sprintf("%s/loadbalancers/%s/events", c.baseURL, sanitizeID(c.loadBalancerID))
+		return c.doJSON(ctx, http.MethodPost, reqURL, event, nil)
+	}
+	if c.eventQueue == nil {
+		return post(payload)
+	}
+	return c.eventQueue.send(payload, post)
+}
+
+// SetEventQueue keeps the events the API does not accept in q for resending
+func (c *VPSieClient) SetEventQueue(q *eventQueue) {
+	c.eventQueue = q
+}
+
+// FlushEvents resends queued events, in order, until one fails
+func (c *VPSieClient) FlushEvents(ctx context.Context) error {
+	if c.eventQueue == nil {
+		return nil
+	}
+	return c.eventQueue.send(nil, func(event json.RawMessage) error {
+		reqURL := fmt.Sprintf("%s/loadbalancers/%s/events", c.baseURL, sanitizeID(c.loadBalancerID))
+		return c.doJSON(ctx, http.MethodPost, reqURL, event, nil)
+	})
+}
+
+// SendHeartbeat reports that this node is alive, with what it is running
+func (c *VPSieClient) SendHeartbeat(ctx context.Context, heartbeat *Heartbeat) error {
+	reqURL := fmt.Sprintf("%s/loadbalancers/%s/heartbeat", c.baseURL, sanitizeID(c.loadBalancerID))
+
+	ts := NextTimestamp()
+	payload := struct {
+		*Heartbeat
+		Timestamp string `json:"timestamp"`
+		Sequence  uint64 `json:"sequence"`
+	}{Heartbeat: heartbeat, Timestamp: ts.String(), Sequence: ts.Seq}
+
+	return c.doJSON(ctx, http.MethodPost, reqURL, payload, nil)
+}
@@ -6,9 +6,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/vpsie/vpsie-loadbalancer/pkg/autoscale"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/gslb"
 	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
 )
 
@@ -117,10 +120,13 @@ func TestVPSieClient_UpdateLoadBalancerStatus(t *testing.T) {
 				t.Errorf("Expected path /loadbalancers/lb-123/status, got %s", r.URL.Path)
 			}
 
-			var payload map[string]string
+			var payload StatusReport
 			json.NewDecoder(r.Body).Decode(&payload)
-			if payload["status"] != "active" {
-				t.Errorf("Expected status 'active', got %s", payload["status"])
+			if payload.Status != StatusDegraded {
+				t.Errorf("Expected status 'degraded', got %s", payload.Status)
+			}
+			if len(payload.Pools) != 1 || payload.Pools[0].Healthy != 1 || payload.Pools[0].Total != 2 {
+				t.Errorf("Expected pool health 1/2, got %+v", payload.Pools)
 			}
 
 			w.WriteHeader(http.StatusOK)
@@ -128,7 +134,10 @@ func TestVPSieClient_UpdateLoadBalancerStatus(t *testing.T) {
 		defer server.Close()
 
 		client, _ := NewVPSieClient("test-key", server.URL, "lb-123")
-		err := client.UpdateLoadBalancerStatus(context.Background(), "active")
+		err := client.UpdateLoadBalancerStatus(context.Background(), StatusReport{
+			Status: StatusDegraded,
+			Pools:  []PoolHealth{{Cluster: "lb-123", Healthy: 1, Total: 2}},
+		})
 
 		if err != nil {
 			t.Errorf("Unexpected error: %v", err)
@@ -143,7 +152,7 @@ func TestVPSieClient_UpdateLoadBalancerStatus(t *testing.T) {
 		defer server.Close()
 
 		client, _ := NewVPSieClient("test-key", server.URL, "lb-123")
-		err := client.UpdateLoadBalancerStatus(context.Background(), "active")
+		err := client.UpdateLoadBalancerStatus(context.Background(), StatusReport{Status: StatusActive})
 
 		if err == nil {
 			t.Error("Expected error for 500 response")
@@ -215,6 +224,9 @@ func TestVPSieClient_ReportMetrics(t *testing.T) {
 			if metrics["connections"] != float64(100) {
 				t.Errorf("Expected connections 100, got %v", metrics["connections"])
 			}
+			if _, ok := metrics["sequence"].(float64); !ok {
+				t.Errorf("Expected numeric sequence, got %v", metrics["sequence"])
+			}
 
 			w.WriteHeader(http.StatusOK)
 		}))
@@ -251,6 +263,16 @@ func TestVPSieClient_SendEvent(t *testing.T) {
 			if event["message"] != "Config applied" {
 				t.Errorf("Expected message 'Config applied', got %v", event["message"])
 			}
+			if event["severity"] != "info" || event["category"] != "config" || event["correlation_id"] != "abc123" {
+				t.Errorf("Expected info config event with correlation ID, got %v", event)
+			}
+			ts, _ := event["timestamp"].(string)
+			if _, err := time.Parse(time.RFC3339Nano, ts); err != nil || !strings.HasSuffix(ts, "Z") {
+				t.Errorf("Expected RFC3339 UTC timestamp, got %q", ts)
+			}
+			if _, ok := event["sequence"].(float64); !ok {
+				t.Errorf("Expected numeric sequence, got %v", event["sequence"])
+			}
 
 			w.WriteHeader(http.StatusCreated)
 		}))
@@ -258,10 +280,298 @@ func TestVPSieClient_SendEvent(t *testing.T) {
 
 		client, _ := NewVPSieClient("test-key", server.URL, "lb-123")
 		metadata := map[string]interface{}{"version": "1.0"}
-		err := client.SendEvent(context.Background(), "config_updated", "Config applied", metadata)
+		event := NewEvent(EventConfigUpdated, "Config applied", metadata)
+		event.CorrelationID = "abc123"
+		err := client.SendEvent(context.Background(), event)
 
 		if err != nil {
 			t.Errorf("Unexpected error: %v", err)
 		}
 	})
 }
+
+func TestVPSieClient_AcquireLease(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		wantHeld bool
+		wantErr  bool
+	}{
+		{name: "acquired", status: http.StatusOK, wantHeld: true},
+		{name: "created", status: http.StatusCreated, wantHeld: true},
+		{name: "held by another agent", status: http.StatusConflict, wantHeld: false},
+		{name: "server error", status: http.StatusInternalServerError, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != "POST" {
+					t.Errorf("Expected POST request, got %s", r.Method)
+				}
+				if r.URL.Path != "/loadbalancers/lb-123/lease" {
+					t.Errorf("Expected path /loadbalancers/lb-123/lease, got %s", r.URL.Path)
+				}
+				var payload map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					t.Errorf("Failed to decode payload: %v", err)
+				}
+				if payload["holder"] != "lb-a" || payload["ttl_seconds"] != float64(15) {
+					t.Errorf("payload = %v", payload)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			client, _ := NewVPSieClient("test-key", server.URL, "lb-123")
+			held, err := client.AcquireLease(context.Background(), "lb-a", 15*time.Second)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AcquireLease() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if held != tt.wantHeld {
+				t.Errorf("AcquireLease() = %v, want %v", held, tt.wantHeld)
+			}
+		})
+	}
+}
+
+func TestVPSieClient_ReleaseLease(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "released", status: http.StatusNoContent},
+		{name: "already expired", status: http.StatusNotFound},
+		{name: "server error", status: http.StatusInternalServerError, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != "DELETE" {
+					t.Errorf("Expected DELETE request, got %s", r.Method)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			client, _ := NewVPSieClient("test-key", server.URL, "lb-123")
+			err := client.ReleaseLease(context.Background(), "lb-a")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReleaseLease() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVPSieClient_AssignFloatingIP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Errorf("Expected PUT request, got %s", r.Method)
+		}
+		if r.URL.Path != "/loadbalancers/lb-123/floating-ip" {
+			t.Errorf("Expected path /loadbalancers/lb-123/floating-ip, got %s", r.URL.Path)
+		}
+		var payload map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		if payload["address"] != "203.0.113.10" || payload["node_id"] != "lb-a" {
+			t.Errorf("payload = %v", payload)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, _ := NewVPSieClient("test-key", server.URL, "lb-123")
+	if err := client.AssignFloatingIP(context.Background(), "203.0.113.10", "lb-a"); err != nil {
+		t.Errorf("AssignFloatingIP() error = %v", err)
+	}
+}
+
+func TestVPSieClient_ManageLoadBalancers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/loadbalancers":
+			if r.URL.Query().Get("name_prefix") != "k8s-uid-" {
+				t.Errorf("name_prefix = %q", r.URL.Query().Get("name_prefix"))
+			}
+			_, _ = w.Write([]byte(`[{"id":"lb-1","name":"k8s-uid-80","ip_address":"203.0.113.1"}]`))
+		case r.Method == "POST" && r.URL.Path == "/loadbalancers":
+			_, _ = w.Write([]byte(`{"id":"lb-2","name":"k8s-uid-443","ip_address":"203.0.113.2"}`))
+		case r.Method == "PUT" && r.URL.Path == "/loadbalancers/lb-1":
+			_, _ = w.Write([]byte(`{"id":"lb-1","name":"k8s-uid-80"}`))
+		case r.Method == "DELETE" && r.URL.Path == "/loadbalancers/lb-1":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "DELETE" && r.URL.Path == "/loadbalancers/lb-gone":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewVPSieClient("test-key", server.URL, "")
+	ctx := context.Background()
+
+	lbs, err := client.ListLoadBalancers(ctx, "k8s-uid-")
+	if err != nil || len(lbs) != 1 || lbs[0].IPAddress != "203.0.113.1" || lbs[0].ID != "lb-1" {
+		t.Errorf("ListLoadBalancers() = %+v, %v", lbs, err)
+	}
+
+	created, err := client.CreateLoadBalancer(ctx, &models.LoadBalancer{Name: "k8s-uid-443"})
+	if err != nil || created.ID != "lb-2" || created.IPAddress != "203.0.113.2" {
+		t.Errorf("CreateLoadBalancer() = %+v, %v", created, err)
+	}
+
+	if _, err = client.UpdateLoadBalancer(ctx, "lb-1", &models.LoadBalancer{Name: "k8s-uid-80"}); err != nil {
+		t.Errorf("UpdateLoadBalancer() error = %v", err)
+	}
+
+	if err = client.DeleteLoadBalancer(ctx, "lb-1"); err != nil {
+		t.Errorf("DeleteLoadBalancer() error = %v", err)
+	}
+	if err = client.DeleteLoadBalancer(ctx, "lb-gone"); err != nil {
+		t.Errorf("DeleteLoadBalancer() of a missing load balancer error = %v", err)
+	}
+	if err = client.DeleteLoadBalancer(ctx, "lb-broken"); err == nil {
+		t.Error("Expected error for server failure")
+	}
+}
+
+func TestVPSieClient_SendHeartbeat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Expected POST request, got %s", r.Method)
+		}
+		if r.URL.Path != "/loadbalancers/lb-123/heartbeat" {
+			t.Errorf("Expected path /loadbalancers/lb-123/heartbeat, got %s", r.URL.Path)
+		}
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		if payload["agent_version"] != "1.2.3" || payload["envoy_version"] != "abc/1.30.1" || payload["uptime_seconds"] != float64(90) {
+			t.Errorf("payload = %v", payload)
+		}
+		if _, ok := payload["sequence"].(float64); !ok {
+			t.Errorf("Expected numeric sequence, got %v", payload["sequence"])
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, _ := NewVPSieClient("test-key", server.URL, "lb-123")
+	heartbeat := &Heartbeat{AgentVersion: "1.2.3", EnvoyVersion: "abc/1.30.1", UptimeSeconds: 90}
+	if err := client.SendHeartbeat(context.Background(), heartbeat); err != nil {
+		t.Errorf("SendHeartbeat() error = %v", err)
+	}
+}
+
+func TestVPSieClient_Scale(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/scaling-groups/web-asg/scale" {
+			t.Errorf("request = %s %s, want POST /scaling-groups/web-asg/scale", r.Method, r.URL.Path)
+		}
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		if payload["direction"] != "out" || payload["loadbalancer_id"] != "lb-123" || payload["metrics"] == nil {
+			t.Errorf("payload = %v", payload)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client, _ := NewVPSieClient("test-key", server.URL, "lb-123")
+	err := client.Scale(context.Background(), &autoscale.Request{Group: "web-asg", Direction: autoscale.ScaleOut, Reason: "busy"})
+	if err != nil {
+		t.Errorf("Scale() error = %v", err)
+	}
+}
+
+func TestVPSieClient_ListServersByTag(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/servers" || r.URL.Query().Get("tag") != "web asg" {
+			t.Errorf("request = %s, want /servers?tag=web+asg", r.URL)
+		}
+		_, _ = w.Write([]byte(`[{"id": "101", "hostname": "web-1", "private_ip": "10.0.0.1", "status": "running"}]`))
+	}))
+	defer server.Close()
+
+	client, _ := NewVPSieClient("test-key", server.URL, "lb-123")
+	servers, err := client.ListServersByTag(context.Background(), "web asg")
+	if err != nil {
+		t.Fatalf("ListServersByTag() error = %v", err)
+	}
+	if len(servers) != 1 || servers[0].PrivateIP != "10.0.0.1" || servers[0].Status != "running" {
+		t.Errorf("ListServersByTag() = %+v", servers)
+	}
+}
+
+func TestVPSieClient_RegionHealth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/gslb/shop/regions/eu-west":
+			var payload map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				t.Errorf("Failed to decode payload: %v", err)
+			}
+			if payload["status"] != "degraded" || payload["loadbalancer_id"] != "lb-123" || payload["reason"] != "no healthy backends" {
+				t.Errorf("payload = %v", payload)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet && r.URL.Path == "/gslb/shop/regions":
+			_, _ = w.Write([]byte(`[{"region": "us-east", "loadbalancer_id": "lb-456", "status": "healthy", "weight": 100}]`))
+		default:
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewVPSieClient("test-key", server.URL, "lb-123")
+	summary := &gslb.Summary{Region: "eu-west", LoadBalancerID: "lb-123", Status: gslb.StateDegraded, Reason: "no healthy backends"}
+	if err := client.PublishRegionHealth(context.Background(), "shop", summary); err != nil {
+		t.Errorf("PublishRegionHealth() error = %v", err)
+	}
+	summaries, err := client.RegionHealth(context.Background(), "shop")
+	if err != nil {
+		t.Fatalf("RegionHealth() error = %v", err)
+	}
+	if len(summaries) != 1 || summaries[0].Region != "us-east" || summaries[0].Status != gslb.StateHealthy {
+		t.Errorf("RegionHealth() = %+v", summaries)
+	}
+}
+
+func TestVPSieClient_ChangeApproval(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loadbalancers/lb-123/changes/abc123" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		switch r.Method {
+		case http.MethodPut:
+			var payload map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				t.Errorf("Failed to decode payload: %v", err)
+			}
+			if payload["config_hash"] != "abc123" || payload["state"] != "pending" || payload["diff"] != "-a\n+b\n" {
+				t.Errorf("payload = %v", payload)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			_, _ = w.Write([]byte(`{"state": "approved"}`))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewVPSieClient("test-key", server.URL, "lb-123")
+	if err := client.StageChange(context.Background(), &StagedChange{ConfigHash: "abc123", State: ChangePending, Diff: "-a\n+b\n"}); err != nil {
+		t.Errorf("StageChange() error = %v", err)
+	}
+	state, err := client.ChangeApproval(context.Background(), "abc123")
+	if err != nil || state != ChangeApproved {
+		t.Errorf("ChangeApproval() = %q, %v, want approved", state, err)
+	}
+}
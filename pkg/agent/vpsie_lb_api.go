@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// ManagedLoadBalancer is a load balancer as returned by the VPSie management API
+type ManagedLoadBalancer struct {
+	models.LoadBalancer
+	IPAddress string `json:"ip_address,omitempty"`
+}
+
+// ListLoadBalancers lists the account's load balancers whose name starts with namePrefix
+func (c *VPSieClient) ListLoadBalancers(ctx context.Context, namePrefix string) ([]ManagedLoadBalancer, error) {
+	reqURL := fmt.Sprintf("%s/loadbalancers?name_prefix=%s", c.baseURL, url.QueryEscape(namePrefix))
+	var lbs []ManagedLoadBalancer
+	if err := c.doJSON(ctx, http.MethodGet, reqURL, nil, &lbs); err != nil {
+		return nil, err
+	}
+	return lbs, nil
+}
+
+// CreateLoadBalancer creates a load balancer; VPSie assigns its ID and IP address
+func (c *VPSieClient) CreateLoadBalancer(ctx context.Context, lb *models.LoadBalancer) (*ManagedLoadBalancer, error) {
+	var created ManagedLoadBalancer
+	if err := c.doJSON(ctx, http.MethodPost, c.baseURL+"/loadbalancers", lb, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateLoadBalancer replaces the configuration of load balancer id
+func (c *VPSieClient) UpdateLoadBalancer(ctx context.Context, id string, lb *models.LoadBalancer) (*ManagedLoadBalancer, error) {
+	reqURL := fmt.Sprintf("%s/loadbalancers/%s", c.baseURL, sanitizeID(id))
+	var updated ManagedLoadBalancer
+	if err := c.doJSON(ctx, http.MethodPut, reqURL, lb, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteLoadBalancer deletes load balancer id. Deleting a load balancer that
+// no longer exists is not an error.
+func (c *VPSieClient) DeleteLoadBalancer(ctx context.Context, id string) error {
+	reqURL := fmt.Sprintf("%s/loadbalancers/%s", c.baseURL, sanitizeID(id))
+	err := c.doJSON(ctx, http.MethodDelete, reqURL, nil, nil)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// APIError is a non-successful VPSie API response
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+// Error implements error
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// doJSON sends payload (if any) as JSON and decodes a successful response into out (if any)
+func (c *VPSieClient) doJSON(ctx context.Context, method, reqURL string, payload, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer func() {
+		// Drain response body to enable HTTP connection reuse
+		//nolint:errcheck // Intentionally ignore - draining is best effort for connection reuse
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, readErr := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		if readErr != nil {
+			return fmt.Errorf("API returned status %d (failed to read response body: %w)", resp.StatusCode, readErr)
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: truncateErrorMessage(string(data), 200)}
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/waf"
+)
+
+// WAFConfig configures the Coraza sidecar that inspects the requests of load
+// balancers with a WAF
+type WAFConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	BinaryPath     string `yaml:"binary_path"`     // default /usr/bin/vpsie-lb-waf
+	ListenAddress  string `yaml:"listen_address"`  // default 127.0.0.1:9904
+	DirectivesPath string `yaml:"directives_path"` // generated Coraza configuration (default /var/lib/vpsie-lb/waf/directives.conf)
+	CRSPath        string `yaml:"crs_path"`        // OWASP Core Rule Set directory (default /usr/share/coraza/coreruleset)
+}
+
+// Default WAF sidecar settings applied by LoadConfig
+const (
+	defaultWAFBinaryPath     = "/usr/bin/vpsie-lb-waf"
+	defaultWAFListenAddress  = "127.0.0.1:9904"
+	defaultWAFDirectivesPath = "/var/lib/vpsie-lb/waf/directives.conf"
+	defaultWAFCRSPath        = "/usr/share/coraza/coreruleset"
+)
+
+// setDefaults fills in unset WAF sidecar settings
+func (c *WAFConfig) setDefaults() {
+	if c.BinaryPath == "" {
+		c.BinaryPath = defaultWAFBinaryPath
+	}
+	if c.ListenAddress == "" {
+		c.ListenAddress = defaultWAFListenAddress
+	}
+	if c.DirectivesPath == "" {
+		c.DirectivesPath = defaultWAFDirectivesPath
+	}
+	if c.CRSPath == "" {
+		c.CRSPath = defaultWAFCRSPath
+	}
+}
+
+// validate checks the WAF sidecar settings
+func (c *WAFConfig) validate() []error {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []error
+	if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
+		errs = append(errs, fmt.Errorf("waf.listen_address %q must be host:port: %w", c.ListenAddress, err))
+	}
+	paths := []struct{ name, path string }{
+		{"binary_path", c.BinaryPath},
+		{"directives_path", c.DirectivesPath},
+		{"crs_path", c.CRSPath},
+	}
+	for _, p := range paths {
+		if !filepath.IsAbs(p.path) {
+			errs = append(errs, fmt.Errorf("waf.%s %q must be absolute", p.name, p.path))
+		}
+	}
+	return errs
+}
+
+// envoyAddress returns the address Envoy connects to: the listen address,
+// with loopback in place of an unspecified host
+func (c *WAFConfig) envoyAddress() string {
+	return loopbackAddress(c.ListenAddress)
+}
+
+// newWAFSidecar creates the supervisor of the WAF sidecar
+func newWAFSidecar(cfg *WAFConfig) *waf.Sidecar {
+	return waf.NewSidecar(cfg.BinaryPath, cfg.ListenAddress, cfg.DirectivesPath, cfg.CRSPath)
+}
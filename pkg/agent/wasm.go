@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/wasm"
+)
+
+// WASMConfig configures where the WASM modules of custom filters come from
+// and where they are kept for Envoy
+type WASMConfig struct {
+	ModuleDir    string   `yaml:"module_dir"`    // default /var/lib/vpsie-lb/wasm
+	AllowedHosts []string `yaml:"allowed_hosts"` // module hosts, "*.example.com" wildcards allowed (default *.vpsie.com)
+}
+
+// Default WASM module settings applied by LoadConfig
+const defaultWASMModuleDir = "/var/lib/vpsie-lb/wasm"
+
+// defaultWASMHosts is VPSie object storage
+var defaultWASMHosts = []string{"*.vpsie.com"}
+
+// setDefaults fills in unset WASM module settings
+func (c *WASMConfig) setDefaults() {
+	if c.ModuleDir == "" {
+		c.ModuleDir = defaultWASMModuleDir
+	}
+	if len(c.AllowedHosts) == 0 {
+		c.AllowedHosts = append([]string(nil), defaultWASMHosts...)
+	}
+}
+
+// validate checks the WASM module settings
+func (c *WASMConfig) validate() []error {
+	var errs []error
+	if c.ModuleDir != "" && !filepath.IsAbs(c.ModuleDir) {
+		errs = append(errs, fmt.Errorf("wasm.module_dir %q must be absolute", c.ModuleDir))
+	}
+	for i, host := range c.AllowedHosts {
+		if !models.HostnameRegex.MatchString(strings.TrimPrefix(host, "*.")) {
+			errs = append(errs, fmt.Errorf("wasm.allowed_hosts[%d] %q must be a hostname, optionally with a leading *.", i, host))
+		}
+	}
+	return errs
+}
+
+// newWASMFetcher creates the fetcher of custom filter modules
+func newWASMFetcher(cfg *WASMConfig) *wasm.Fetcher {
+	return wasm.NewFetcher(cfg.ModuleDir, cfg.AllowedHosts)
+}
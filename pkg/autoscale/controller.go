@@ -0,0 +1,319 @@
+// Package autoscale turns load balancer metrics into scaling requests: it
+// samples the Envoy statistics of each backend pool with an autoscaling
+// policy and asks for more backend servers when a threshold is crossed, or
+// fewer when the pool has been lightly loaded.
+package autoscale
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/events"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// defaultCooldown is used when a policy sets no cooldown
+const defaultCooldown = 300 * time.Second
+
+// Direction is the direction of a scaling request
+type Direction string
+
+const (
+	// ScaleOut asks for more backend servers
+	ScaleOut Direction = "out"
+	// ScaleIn asks for fewer backend servers
+	ScaleIn Direction = "in"
+)
+
+// StatsSource reads the statistics of an Envoy cluster
+type StatsSource interface {
+	ClusterStats(ctx context.Context, cluster string) (*envoy.ClusterStats, error)
+}
+
+// Scaler resizes a scaling group
+type Scaler interface {
+	Scale(ctx context.Context, request *Request) error
+}
+
+// Metrics is the load of a backend pool, per healthy backend
+type Metrics struct {
+	RPSPerBackend         float64 `json:"rps_per_backend"`
+	ConnectionsPerBackend float64 `json:"connections_per_backend"`
+	Saturation            float64 `json:"saturation"` // percent of the per-host connection limit, 0 without one
+	HealthyBackends       int     `json:"healthy_backends"`
+}
+
+// Request asks for a scaling group to be resized
+type Request struct {
+	Group     string    `json:"group"`
+	Pool      string    `json:"pool,omitempty"` // empty for the load balancer's own backends
+	Direction Direction `json:"direction"`
+	Reason    string    `json:"reason"`
+	Metrics   Metrics   `json:"metrics"`
+}
+
+// Status describes the autoscaling of one backend pool
+type Status struct {
+	LastActionAt time.Time `json:"last_action_at,omitempty"`
+	Metrics      *Metrics  `json:"metrics,omitempty"` // nil until two samples were taken
+	Pool         string    `json:"pool"`
+	Group        string    `json:"group,omitempty"`
+	LastAction   Direction `json:"last_action,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+}
+
+// target is the autoscaling state of one backend pool
+type target struct {
+	policy       models.Autoscaling
+	cluster      string
+	maxConnsHost int // connection_pool.max_connections_per_host
+	status       Status
+	sample       *envoy.ClusterStats // statistics at sampledAt
+	sampledAt    time.Time
+}
+
+// action is a scaling decision taken while the controller lock is held
+type action struct {
+	request  Request
+	metadata map[string]interface{}
+}
+
+// Controller tracks the autoscaling policies of the active load balancer
+// configuration. State is kept in memory, so a restarted agent starts with a
+// fresh sample and no cooldown.
+type Controller struct {
+	mu      sync.Mutex
+	targets map[string]*target // keyed by pool name, "" for the load balancer's own backends
+	stats   StatsSource
+	scaler  Scaler      // nil only reports events
+	events  events.Func // reports scaling decisions and failures
+	now     func() time.Time
+}
+
+// NewController creates an autoscaling controller. Without a scaler, scaling
+// decisions are only reported as events.
+func NewController(stats StatsSource, scaler Scaler, onEvent events.Func) *Controller {
+	return &Controller{
+		targets: make(map[string]*target),
+		stats:   stats,
+		scaler:  scaler,
+		events:  onEvent,
+		now:     time.Now,
+	}
+}
+
+// Apply registers the autoscaling policies of lb. Pools keep their samples
+// and cooldown while their policy is unchanged.
+func (c *Controller) Apply(lb *models.LoadBalancer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	policies := make(map[string]*models.Autoscaling)
+	limits := make(map[string]*models.ConnectionPool)
+	if lb.Autoscaling != nil && lb.HasDefaultPool() {
+		policies[""] = lb.Autoscaling
+		limits[""] = lb.ConnectionPool
+	}
+	for i := range lb.Pools {
+		if lb.Pools[i].Autoscaling != nil {
+			policies[lb.Pools[i].Name] = lb.Pools[i].Autoscaling
+			limits[lb.Pools[i].Name] = lb.PoolConnectionPool(&lb.Pools[i])
+		}
+	}
+
+	for pool, policy := range policies {
+		maxConnsHost := 0
+		if limits[pool] != nil {
+			maxConnsHost = limits[pool].MaxConnectionsPerHost
+		}
+		cluster := envoy.ClusterName(lb, pool)
+		t, ok := c.targets[pool]
+		if !ok || t.policy != *policy || t.cluster != cluster {
+			t = &target{cluster: cluster, status: Status{Pool: pool}}
+			c.targets[pool] = t
+		}
+		t.policy = *policy
+		t.maxConnsHost = maxConnsHost
+		t.status.Group = policy.Group
+	}
+	for pool := range c.targets {
+		if _, ok := policies[pool]; !ok {
+			delete(c.targets, pool)
+		}
+	}
+}
+
+// Run evaluates the policies every interval until ctx is cancelled. While
+// active returns false (e.g. on a passive HA node) nothing is scaled.
+func (c *Controller) Run(ctx context.Context, interval time.Duration, active func() bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if active() {
+				c.Evaluate(ctx)
+			}
+		}
+	}
+}
+
+// Evaluate samples every pool with a policy and requests scaling where a
+// threshold is crossed and the pool is not cooling down
+func (c *Controller) Evaluate(ctx context.Context) {
+	var actions []action
+	c.mu.Lock()
+	for _, t := range c.targets {
+		if a := c.evaluate(ctx, t); a != nil {
+			actions = append(actions, *a)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, a := range actions {
+		c.act(ctx, a)
+	}
+}
+
+// evaluate takes a sample of t and returns the scaling action it calls for,
+// or nil
+func (c *Controller) evaluate(ctx context.Context, t *target) *action {
+	stats, err := c.stats.ClusterStats(ctx, t.cluster)
+	if err != nil {
+		log.Printf("Warning: Autoscaling of %s: %v", t.cluster, err)
+		return nil
+	}
+	now := c.now()
+	previous, previousAt := t.sample, t.sampledAt
+	t.sample, t.sampledAt = stats, now
+
+	// Rates need two samples; counters only go down when Envoy was
+	// restarted from scratch
+	if previous == nil || stats.RequestsTotal < previous.RequestsTotal || !now.After(previousAt) {
+		return nil
+	}
+	if stats.HealthyMembers == 0 {
+		log.Printf("Autoscaling of %s: no healthy backends to judge the load by", t.cluster)
+		return nil
+	}
+
+	healthy := float64(stats.HealthyMembers)
+	metrics := Metrics{
+		RPSPerBackend:         float64(stats.RequestsTotal-previous.RequestsTotal) / now.Sub(previousAt).Seconds() / healthy,
+		ConnectionsPerBackend: float64(stats.ActiveConnections) / healthy,
+		HealthyBackends:       int(stats.HealthyMembers),
+	}
+	if t.maxConnsHost > 0 {
+		metrics.Saturation = metrics.ConnectionsPerBackend / float64(t.maxConnsHost) * 100
+	}
+	t.status.Metrics = &metrics
+
+	direction, reason := t.decide(metrics)
+	if direction == "" {
+		return nil
+	}
+	cooldown := defaultCooldown
+	if t.policy.Cooldown > 0 {
+		cooldown = time.Duration(t.policy.Cooldown) * time.Second
+	}
+	if !t.status.LastActionAt.IsZero() && now.Sub(t.status.LastActionAt) < cooldown {
+		return nil
+	}
+
+	t.status.LastAction = direction
+	t.status.LastActionAt = now
+	t.status.Reason = reason
+	return &action{
+		request: Request{
+			Group:     t.policy.Group,
+			Pool:      t.status.Pool,
+			Direction: direction,
+			Reason:    reason,
+			Metrics:   metrics,
+		},
+		metadata: map[string]interface{}{
+			"pool":                    t.status.Pool,
+			"group":                   t.policy.Group,
+			"direction":               string(direction),
+			"reason":                  reason,
+			"rps_per_backend":         metrics.RPSPerBackend,
+			"connections_per_backend": metrics.ConnectionsPerBackend,
+			"saturation":              metrics.Saturation,
+			"healthy_backends":        metrics.HealthyBackends,
+		},
+	}
+}
+
+// decide returns the scaling direction the metrics call for and why, or ""
+func (t *target) decide(m Metrics) (Direction, string) {
+	p := t.policy
+	if p.MaxRPSPerBackend > 0 && m.RPSPerBackend > p.MaxRPSPerBackend {
+		return ScaleOut, fmt.Sprintf("%.1f requests/s per backend exceeds %.1f", m.RPSPerBackend, p.MaxRPSPerBackend)
+	}
+	if p.MaxConnectionsPerBackend > 0 && m.ConnectionsPerBackend > float64(p.MaxConnectionsPerBackend) {
+		return ScaleOut, fmt.Sprintf("%.1f connections per backend exceeds %d", m.ConnectionsPerBackend, p.MaxConnectionsPerBackend)
+	}
+	if p.MaxSaturation > 0 && m.Saturation > float64(p.MaxSaturation) {
+		return ScaleOut, fmt.Sprintf("saturation %.0f%% exceeds %d%%", m.Saturation, p.MaxSaturation)
+	}
+
+	// Never scale in below one backend, nor while any metric is near its threshold
+	if p.ScaleInPercent == 0 || m.HealthyBackends < 2 {
+		return "", ""
+	}
+	fraction := float64(p.ScaleInPercent) / 100
+	if p.MaxRPSPerBackend > 0 && m.RPSPerBackend >= p.MaxRPSPerBackend*fraction {
+		return "", ""
+	}
+	if p.MaxConnectionsPerBackend > 0 && m.ConnectionsPerBackend >= float64(p.MaxConnectionsPerBackend)*fraction {
+		return "", ""
+	}
+	if p.MaxSaturation > 0 && m.Saturation >= float64(p.MaxSaturation)*fraction {
+		return "", ""
+	}
+	return ScaleIn, fmt.Sprintf("load below %d%% of every threshold", p.ScaleInPercent)
+}
+
+// act reports a scaling decision and sends the request to the scaler
+func (c *Controller) act(ctx context.Context, a action) {
+	r := a.request
+	pool := r.Pool
+	if pool == "" {
+		pool = "default"
+	}
+	eventType := events.AutoscaleOut
+	if r.Direction == ScaleIn {
+		eventType = events.AutoscaleIn
+	}
+	c.events(ctx, eventType, fmt.Sprintf("Backend pool %s needs scaling %s: %s", pool, r.Direction, r.Reason), a.metadata)
+
+	if r.Group == "" || c.scaler == nil {
+		return
+	}
+	if err := c.scaler.Scale(ctx, &r); err != nil {
+		log.Printf("Error requesting scale %s of group %s: %v", r.Direction, r.Group, err)
+		a.metadata["error"] = err.Error()
+		c.events(ctx, events.AutoscaleFailed, fmt.Sprintf("Scaling group %s could not be scaled %s", r.Group, r.Direction), a.metadata)
+	}
+}
+
+// Statuses returns the autoscaling state of every pool, ordered by pool
+func (c *Controller) Statuses() []Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := make([]Status, 0, len(c.targets))
+	for _, t := range c.targets {
+		statuses = append(statuses, t.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Pool < statuses[j].Pool })
+	return statuses
+}
@@ -0,0 +1,221 @@
+package autoscale
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/events"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// fakeStats returns the configured statistics for any cluster
+type fakeStats struct {
+	stats envoy.ClusterStats
+	err   error
+}
+
+func (f *fakeStats) ClusterStats(context.Context, string) (*envoy.ClusterStats, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	stats := f.stats
+	return &stats, nil
+}
+
+// fakeScaler records scaling requests
+type fakeScaler struct {
+	requests []Request
+	err      error
+}
+
+func (f *fakeScaler) Scale(_ context.Context, request *Request) error {
+	f.requests = append(f.requests, *request)
+	return f.err
+}
+
+// harness wires a controller to a fake clock, stats, scaler and recorded events
+type harness struct {
+	controller *Controller
+	stats      *fakeStats
+	scaler     *fakeScaler
+	now        time.Time
+	events     []events.Type
+}
+
+func newHarness(policy models.Autoscaling) *harness {
+	h := &harness{
+		stats:  &fakeStats{stats: envoy.ClusterStats{HealthyMembers: 2}},
+		scaler: &fakeScaler{},
+		now:    time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	h.controller = NewController(h.stats, h.scaler,
+		func(_ context.Context, eventType events.Type, _ string, _ map[string]interface{}) {
+			h.events = append(h.events, eventType)
+		})
+	h.controller.now = func() time.Time { return h.now }
+	h.controller.Apply(autoscaleLB(policy))
+	return h
+}
+
+// tick advances the clock by 10s, adds requests to the counter and evaluates
+func (h *harness) tick(requests uint64) {
+	h.now = h.now.Add(10 * time.Second)
+	h.stats.stats.RequestsTotal += requests
+	h.controller.Evaluate(context.Background())
+}
+
+func autoscaleLB(policy models.Autoscaling) *models.LoadBalancer {
+	return &models.LoadBalancer{
+		ID: "lb-1", Name: "web", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+		Backends:       []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+		ConnectionPool: &models.ConnectionPool{MaxConnectionsPerHost: 100},
+		Autoscaling:    &policy,
+	}
+}
+
+func TestController_Evaluate(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      models.Autoscaling
+		requests    uint64 // per 10s tick, over 2 healthy backends
+		connections uint64
+		want        []events.Type
+		wantScale   []Direction
+	}{
+		{
+			name:      "requests per backend above threshold",
+			policy:    models.Autoscaling{Group: "web-asg", MaxRPSPerBackend: 50},
+			requests:  1200, // 60 rps per backend
+			want:      []events.Type{events.AutoscaleOut},
+			wantScale: []Direction{ScaleOut},
+		},
+		{
+			name:        "connections per backend above threshold",
+			policy:      models.Autoscaling{Group: "web-asg", MaxConnectionsPerBackend: 20},
+			connections: 50,
+			want:        []events.Type{events.AutoscaleOut},
+			wantScale:   []Direction{ScaleOut},
+		},
+		{
+			name:        "saturation above threshold",
+			policy:      models.Autoscaling{Group: "web-asg", MaxSaturation: 80},
+			connections: 170, // 85 of 100 connections per host
+			want:        []events.Type{events.AutoscaleOut},
+			wantScale:   []Direction{ScaleOut},
+		},
+		{
+			name:     "within thresholds",
+			policy:   models.Autoscaling{Group: "web-asg", MaxRPSPerBackend: 50, ScaleInPercent: 20},
+			requests: 600, // 30 rps per backend
+		},
+		{
+			name:      "light load scales in",
+			policy:    models.Autoscaling{Group: "web-asg", MaxRPSPerBackend: 50, ScaleInPercent: 20},
+			requests:  100, // 5 rps per backend
+			want:      []events.Type{events.AutoscaleIn},
+			wantScale: []Direction{ScaleIn},
+		},
+		{
+			name:     "events only without a group",
+			policy:   models.Autoscaling{MaxRPSPerBackend: 50},
+			requests: 1200,
+			want:     []events.Type{events.AutoscaleOut},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(tt.policy)
+			h.stats.stats.ActiveConnections = tt.connections
+
+			// The first sample is only the baseline of the request rate
+			h.tick(tt.requests)
+			if len(h.events) != 0 {
+				t.Fatalf("events after the first sample = %v, want none", h.events)
+			}
+			h.tick(tt.requests)
+
+			if !reflect.DeepEqual(h.events, tt.want) {
+				t.Errorf("events = %v, want %v", h.events, tt.want)
+			}
+			var got []Direction
+			for _, r := range h.scaler.requests {
+				got = append(got, r.Direction)
+				if r.Group != tt.policy.Group || r.Metrics.HealthyBackends != 2 {
+					t.Errorf("request = %+v, want group %s with 2 healthy backends", r, tt.policy.Group)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.wantScale) {
+				t.Errorf("scale requests = %v, want %v", got, tt.wantScale)
+			}
+		})
+	}
+}
+
+func TestController_Cooldown(t *testing.T) {
+	h := newHarness(models.Autoscaling{Group: "web-asg", MaxRPSPerBackend: 50, Cooldown: 60})
+	for i := 0; i < 8; i++ {
+		h.tick(1200)
+	}
+
+	// Scaled out at 20s; the next request is due once 60s have passed, at 80s
+	if len(h.scaler.requests) != 2 {
+		t.Errorf("scale requests = %d, want 2 with a 60s cooldown over 80s", len(h.scaler.requests))
+	}
+
+	statuses := h.controller.Statuses()
+	if len(statuses) != 1 || statuses[0].LastAction != ScaleOut || statuses[0].Metrics == nil || statuses[0].Metrics.RPSPerBackend != 60 {
+		t.Errorf("Statuses() = %+v, want a scale out at 60 rps per backend", statuses)
+	}
+}
+
+func TestController_ScaleFailure(t *testing.T) {
+	h := newHarness(models.Autoscaling{Group: "web-asg", MaxRPSPerBackend: 50})
+	h.scaler.err = errors.New("scaling group at maximum size")
+	h.tick(1200)
+	h.tick(1200)
+
+	if want := []events.Type{events.AutoscaleOut, events.AutoscaleFailed}; !reflect.DeepEqual(h.events, want) {
+		t.Errorf("events = %v, want %v", h.events, want)
+	}
+}
+
+func TestController_StatsUnavailable(t *testing.T) {
+	h := newHarness(models.Autoscaling{Group: "web-asg", MaxRPSPerBackend: 50})
+	h.stats.err = errors.New("connection refused")
+	h.tick(1200)
+	h.tick(1200)
+	h.stats.stats.HealthyMembers = 0
+	h.stats.err = nil
+	h.tick(1200)
+	h.tick(1200)
+
+	if len(h.events) != 0 || len(h.scaler.requests) != 0 {
+		t.Errorf("events = %v, requests = %v, want nothing without statistics or healthy backends", h.events, h.scaler.requests)
+	}
+}
+
+func TestController_Apply(t *testing.T) {
+	h := newHarness(models.Autoscaling{Group: "web-asg", MaxRPSPerBackend: 50})
+	h.tick(0)
+
+	// Re-applying the same policy keeps the sample
+	h.controller.Apply(autoscaleLB(models.Autoscaling{Group: "web-asg", MaxRPSPerBackend: 50}))
+	h.tick(1200)
+	if len(h.scaler.requests) != 1 {
+		t.Errorf("scale requests = %d, want 1 from the kept sample", len(h.scaler.requests))
+	}
+
+	lb := autoscaleLB(models.Autoscaling{})
+	lb.Autoscaling = nil
+	lb.Pools = []models.BackendPool{{Name: "api", Autoscaling: &models.Autoscaling{MaxConnectionsPerBackend: 10}}}
+	h.controller.Apply(lb)
+	statuses := h.controller.Statuses()
+	if len(statuses) != 1 || statuses[0].Pool != "api" || statuses[0].Metrics != nil {
+		t.Errorf("Statuses() = %+v, want only a fresh api pool", statuses)
+	}
+}
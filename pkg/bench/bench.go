@@ -0,0 +1,314 @@
+// Package bench generates synthetic HTTP or TCP load against a load balancer
+// listener and measures the throughput and latency it sustains, to check a
+// node's sizing after provisioning.
+package bench
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Mode is the kind of load generated
+type Mode string
+
+const (
+	// ModeHTTP sends GET requests and reads the responses
+	ModeHTTP Mode = "http"
+	// ModeTCP opens a connection, optionally writes a payload and reads the
+	// first reply, then closes the connection
+	ModeTCP Mode = "tcp"
+)
+
+// Options describe a load test
+type Options struct {
+	Mode        Mode
+	Target      string        // URL in http mode, host:port in tcp mode
+	Concurrency int           // parallel workers
+	Duration    time.Duration // stop after, unless Requests is reached first
+	Requests    int           // stop after this many requests, 0 for no limit
+	Timeout     time.Duration // per request
+	KeepAlive   bool          // reuse HTTP connections between requests
+	Insecure    bool          // skip TLS certificate verification
+	Payload     []byte        // written to each TCP connection
+}
+
+// Validate checks the options
+func (o *Options) Validate() error {
+	if o.Concurrency <= 0 {
+		return errors.New("concurrency must be positive")
+	}
+	if o.Duration <= 0 && o.Requests <= 0 {
+		return errors.New("a duration or a number of requests is required")
+	}
+	if o.Timeout <= 0 {
+		return errors.New("timeout must be positive")
+	}
+	switch o.Mode {
+	case ModeHTTP:
+		u, err := url.Parse(o.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("target %q is not an http or https URL", o.Target)
+		}
+	case ModeTCP:
+		_, port, err := net.SplitHostPort(o.Target)
+		if err == nil {
+			_, err = strconv.ParseUint(port, 10, 16)
+		}
+		if err != nil {
+			return fmt.Errorf("target %q is not host:port: %w", o.Target, err)
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", o.Mode)
+	}
+	return nil
+}
+
+// Result summarizes a load test. Latencies cover successful requests only.
+type Result struct {
+	Requests    int           `json:"requests"`
+	Errors      int           `json:"errors"`
+	Duration    time.Duration `json:"duration"`
+	RPS         float64       `json:"rps"`
+	Bytes       int64         `json:"bytes"` // read from the target
+	Latency     Latency       `json:"latency"`
+	StatusCodes map[int]int   `json:"status_codes,omitempty"`
+	FirstError  string        `json:"first_error,omitempty"`
+}
+
+// Latency holds latency percentiles
+type Latency struct {
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P99  time.Duration `json:"p99"`
+	Max  time.Duration `json:"max"`
+}
+
+// sample is the outcome of one request
+type sample struct {
+	latency time.Duration
+	bytes   int64
+	status  int
+	err     error
+}
+
+// request performs one request against the target
+type request func(ctx context.Context) sample
+
+// Run generates load until the duration elapses, the requests are sent or
+// ctx is cancelled, and returns what was measured
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	var do request
+	switch opts.Mode {
+	case ModeHTTP:
+		client := newHTTPClient(opts)
+		defer client.CloseIdleConnections()
+		do = httpRequest(client, opts.Target)
+	case ModeTCP:
+		do = tcpRequest(opts.Target, opts.Payload)
+	}
+
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+
+	var sent atomic.Int64
+	samples := make([][]sample, opts.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range samples {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if opts.Requests > 0 && sent.Add(1) > int64(opts.Requests) {
+					return
+				}
+				reqCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+				s := do(reqCtx)
+				cancel()
+				// A request cut short by the end of the test is not an error
+				if s.err != nil && ended(ctx) {
+					return
+				}
+				samples[i] = append(samples[i], s)
+			}
+		}()
+	}
+	wg.Wait()
+	return summarize(slices.Concat(samples...), time.Since(start)), nil
+}
+
+// ended reports whether the test is over. The deadline is checked as well
+// as ctx, since connection deadlines can expire before ctx is cancelled.
+func ended(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	return ctx.Err() != nil || (ok && !time.Now().Before(deadline))
+}
+
+// summarize computes the result of a test that took elapsed
+func summarize(samples []sample, elapsed time.Duration) *Result {
+	r := &Result{Requests: len(samples), Duration: elapsed}
+	var latencies []time.Duration
+	var total time.Duration
+	for _, s := range samples {
+		r.Bytes += s.bytes
+		if s.status != 0 {
+			if r.StatusCodes == nil {
+				r.StatusCodes = make(map[int]int)
+			}
+			r.StatusCodes[s.status]++
+		}
+		if s.err != nil {
+			if r.Errors == 0 {
+				r.FirstError = s.err.Error()
+			}
+			r.Errors++
+			continue
+		}
+		latencies = append(latencies, s.latency)
+		total += s.latency
+	}
+	if elapsed > 0 {
+		r.RPS = float64(r.Requests-r.Errors) / elapsed.Seconds()
+	}
+	if len(latencies) > 0 {
+		slices.Sort(latencies)
+		r.Latency = Latency{
+			Mean: total / time.Duration(len(latencies)),
+			P50:  percentile(latencies, 50),
+			P90:  percentile(latencies, 90),
+			P99:  percentile(latencies, 99),
+			Max:  latencies[len(latencies)-1],
+		}
+	}
+	return r
+}
+
+// percentile returns the p-th percentile of sorted latencies, by the
+// nearest-rank method
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// newHTTPClient returns a client with enough idle connections for every worker
+func newHTTPClient(opts Options) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = opts.Concurrency
+	transport.MaxIdleConnsPerHost = opts.Concurrency
+	transport.DisableKeepAlives = !opts.KeepAlive
+	if opts.Insecure {
+		// #nosec G402 -- requested with -insecure, for self-signed listener certificates
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &http.Client{
+		Transport: transport,
+		// Measure the listener, not the target of its redirects
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+// httpRequest sends a GET request to target and reads the whole response.
+// Responses with a 5xx status count as errors.
+func httpRequest(client *http.Client, target string) request {
+	return func(ctx context.Context) sample {
+		start := time.Now()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return sample{err: err}
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return sample{err: err}
+		}
+		defer resp.Body.Close()
+		n, err := io.Copy(io.Discard, resp.Body)
+		s := sample{latency: time.Since(start), bytes: n, status: resp.StatusCode, err: err}
+		if s.err == nil && resp.StatusCode >= http.StatusInternalServerError {
+			s.err = fmt.Errorf("status %s", resp.Status)
+		}
+		return s
+	}
+}
+
+// tcpRequest connects to target and, with a payload, writes it and waits for
+// the first bytes of the reply
+func tcpRequest(target string, payload []byte) request {
+	var dialer net.Dialer
+	return func(ctx context.Context) sample {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", target)
+		if err != nil {
+			return sample{err: err}
+		}
+		defer conn.Close()
+		if len(payload) == 0 {
+			return sample{latency: time.Since(start)}
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		if _, err := conn.Write(payload); err != nil {
+			return sample{err: err}
+		}
+		buf := make([]byte, 4096)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return sample{bytes: int64(n), err: err}
+		}
+		return sample{latency: time.Since(start), bytes: int64(n)}
+	}
+}
+
+// Report writes a human-readable summary of r
+func (r *Result) Report(w io.Writer) {
+	fmt.Fprintf(w, "Requests:  %d in %s (%d errors)\n", r.Requests, r.Duration.Round(time.Millisecond), r.Errors)
+	fmt.Fprintf(w, "Rate:      %.1f requests/s\n", r.RPS)
+	fmt.Fprintf(w, "Received:  %d bytes\n", r.Bytes)
+	fmt.Fprintf(w, "Latency:   mean %s, p50 %s, p90 %s, p99 %s, max %s\n",
+		round(r.Latency.Mean), round(r.Latency.P50), round(r.Latency.P90), round(r.Latency.P99), round(r.Latency.Max))
+	if len(r.StatusCodes) > 0 {
+		codes := make([]int, 0, len(r.StatusCodes))
+		for code := range r.StatusCodes {
+			codes = append(codes, code)
+		}
+		slices.Sort(codes)
+		parts := make([]string, len(codes))
+		for i, code := range codes {
+			parts[i] = fmt.Sprintf("%d: %d", code, r.StatusCodes[code])
+		}
+		fmt.Fprintf(w, "Status:    %s\n", strings.Join(parts, ", "))
+	}
+	if r.FirstError != "" {
+		fmt.Fprintf(w, "First error: %s\n", r.FirstError)
+	}
+}
+
+// round shortens a latency for display
+func round(d time.Duration) time.Duration {
+	if d >= time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
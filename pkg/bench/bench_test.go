@@ -0,0 +1,115 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun_HTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	result, err := Run(context.Background(), Options{
+		Mode: ModeHTTP, Target: server.URL, Concurrency: 4, Requests: 50, Timeout: time.Second, KeepAlive: true,
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Requests != 50 || result.Errors != 0 || result.StatusCodes[200] != 50 || result.Bytes != 100 {
+		t.Errorf("Run() = %+v, want 50 successful requests", result)
+	}
+	if result.RPS <= 0 || result.Latency.P50 <= 0 || result.Latency.P99 < result.Latency.P50 || result.Latency.Max < result.Latency.P99 {
+		t.Errorf("Run() latency = %+v, rps = %v", result.Latency, result.RPS)
+	}
+
+	result, err = Run(context.Background(), Options{
+		Mode: ModeHTTP, Target: server.URL + "/fail", Concurrency: 2, Requests: 10, Timeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Errors != 10 || result.StatusCodes[502] != 10 || !strings.Contains(result.FirstError, "502") {
+		t.Errorf("Run() = %+v, want 10 failed requests", result)
+	}
+}
+
+func TestRun_TCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 16)
+				n, _ := conn.Read(buf)
+				_, _ = conn.Write(bytes.ToUpper(buf[:n]))
+			}()
+		}
+	}()
+
+	result, err := Run(context.Background(), Options{
+		Mode: ModeTCP, Target: listener.Addr().String(), Concurrency: 3, Duration: 200 * time.Millisecond,
+		Timeout: time.Second, Payload: []byte("ping"),
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Requests == 0 || result.Errors != 0 || result.Bytes != int64(4*result.Requests) {
+		t.Errorf("Run() = %+v, want echoed requests without errors", result)
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	valid := Options{Mode: ModeHTTP, Target: "http://127.0.0.1/", Concurrency: 1, Requests: 1, Timeout: time.Second}
+	for name, mutate := range map[string]func(*Options){
+		"no concurrency": func(o *Options) { o.Concurrency = 0 },
+		"no limit":       func(o *Options) { o.Requests = 0 },
+		"no timeout":     func(o *Options) { o.Timeout = 0 },
+		"not a URL":      func(o *Options) { o.Target = "127.0.0.1:80" },
+		"not host:port":  func(o *Options) { o.Mode = ModeTCP },
+		"unknown mode":   func(o *Options) { o.Mode = "udp" },
+	} {
+		opts := valid
+		mutate(&opts)
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%s: Validate() accepted %+v", name, opts)
+		}
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[int]time.Duration{50: 50 * time.Millisecond, 90: 90 * time.Millisecond, 99: 99 * time.Millisecond} {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("percentile(%d) = %v, want %v", p, got, want)
+		}
+	}
+	if got := percentile(sorted[:1], 99); got != time.Millisecond {
+		t.Errorf("percentile of one sample = %v", got)
+	}
+}
@@ -0,0 +1,327 @@
+// Package canary automates canary rollouts: it shifts the weight of a traffic
+// split towards the canary pool step by step, judges each step from the
+// canary cluster's Envoy statistics, and promotes or rolls back the canary.
+package canary
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/events"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// defaultStepInterval is used when a rollout sets no step_interval
+const defaultStepInterval = 60 * time.Second
+
+// Phase is the state of a rollout
+type Phase string
+
+const (
+	// PhaseProgressing means the canary weight is still being increased
+	PhaseProgressing Phase = "progressing"
+	// PhasePromoted means the canary receives all traffic
+	PhasePromoted Phase = "promoted"
+	// PhaseRolledBack means the canary failed and receives no traffic
+	PhaseRolledBack Phase = "rolled_back"
+)
+
+// StatsSource reads the statistics of an Envoy cluster
+type StatsSource interface {
+	ClusterStats(ctx context.Context, cluster string) (*envoy.ClusterStats, error)
+}
+
+// Status describes one rollout
+type Status struct {
+	LastStep     time.Time `json:"last_step"`
+	Route        string    `json:"route"`
+	Canary       string    `json:"canary"`
+	Phase        Phase     `json:"phase"`
+	Reason       string    `json:"reason,omitempty"`
+	CanaryWeight int       `json:"canary_weight"`
+}
+
+// event is a rollout event queued while the controller lock is held
+type event struct {
+	metadata  map[string]interface{}
+	eventType events.Type
+	message   string
+}
+
+// rollout is the state of the rollout of one route
+type rollout struct {
+	spec     string // serialized traffic split the state was created from
+	policy   models.Rollout
+	cluster  string
+	status   Status
+	baseline *envoy.ClusterStats // canary counters at the start of the current step
+}
+
+// Controller tracks the rollouts of the active load balancer configuration.
+// State is kept in memory, so a restarted agent starts rollouts over from
+// their configured weights.
+type Controller struct {
+	mu       sync.Mutex
+	rollouts map[string]*rollout // keyed by route name
+	stats    StatsSource
+	events   events.Func // reports rollout events
+	onChange func()
+	now      func() time.Time
+}
+
+// NewController creates a canary controller. onChange is called whenever a
+// weight changes and the configuration must be re-applied.
+func NewController(stats StatsSource, onEvent events.Func, onChange func()) *Controller {
+	return &Controller{
+		rollouts: make(map[string]*rollout),
+		stats:    stats,
+		events:   onEvent,
+		onChange: onChange,
+		now:      time.Now,
+	}
+}
+
+// Apply registers the rollouts of lb and rewrites their split weights to the
+// current rollout state. A rollout starts over when its traffic split is
+// changed in the configuration.
+func (c *Controller) Apply(ctx context.Context, lb *models.LoadBalancer) {
+	var pending []event
+	defer func() { c.send(ctx, pending) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seen := make(map[string]bool)
+	for i := range lb.Routes {
+		route := &lb.Routes[i]
+		if route.Split == nil || route.Split.Rollout == nil {
+			continue
+		}
+		seen[route.Name] = true
+
+		spec, err := json.Marshal(route.Split)
+		if err != nil {
+			log.Printf("Warning: Canary for route %s: %v", route.Name, err)
+			continue
+		}
+
+		r, ok := c.rollouts[route.Name]
+		if !ok || r.spec != string(spec) {
+			r = c.start(route, string(spec), envoy.ClusterName(lb, route.Split.Rollout.Canary))
+			c.rollouts[route.Name] = r
+			pending = append(pending, event{
+				eventType: events.CanaryStarted,
+				message:   fmt.Sprintf("Canary rollout started for route %s", route.Name),
+				metadata:  r.metadata(),
+			})
+		}
+
+		for j := range route.Split.Targets {
+			target := &route.Split.Targets[j]
+			if target.Pool == r.policy.Canary {
+				target.Weight = r.status.CanaryWeight
+			} else {
+				target.Weight = 100 - r.status.CanaryWeight
+			}
+		}
+	}
+
+	for name := range c.rollouts {
+		if !seen[name] {
+			delete(c.rollouts, name)
+		}
+	}
+}
+
+// start creates the state of a new rollout from the configured weights
+func (c *Controller) start(route *models.Route, spec, cluster string) *rollout {
+	policy := *route.Split.Rollout
+	weight := 0
+	for _, target := range route.Split.Targets {
+		if target.Pool == policy.Canary {
+			weight = target.Weight
+		}
+	}
+
+	phase := PhaseProgressing
+	if weight == 100 {
+		phase = PhasePromoted
+	}
+	return &rollout{
+		spec:    spec,
+		policy:  policy,
+		cluster: cluster,
+		status: Status{
+			Route:        route.Name,
+			Canary:       policy.Canary,
+			Phase:        phase,
+			CanaryWeight: weight,
+			LastStep:     c.now(),
+		},
+	}
+}
+
+// Run evaluates the rollouts every interval until ctx is cancelled. While
+// active returns false (e.g. on a passive HA node) rollouts are left alone.
+func (c *Controller) Run(ctx context.Context, interval time.Duration, active func() bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if active() {
+				c.Evaluate(ctx)
+			}
+		}
+	}
+}
+
+// Evaluate advances, promotes or rolls back every rollout whose step is due
+func (c *Controller) Evaluate(ctx context.Context) {
+	var pending []event
+	c.mu.Lock()
+	for _, r := range c.rollouts {
+		if r.status.Phase != PhaseProgressing {
+			continue
+		}
+		if e := c.evaluate(ctx, r); e != nil {
+			pending = append(pending, *e)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(pending) > 0 {
+		c.onChange()
+		c.send(ctx, pending)
+	}
+}
+
+// send reports queued events
+func (c *Controller) send(ctx context.Context, pending []event) {
+	for _, e := range pending {
+		c.events(ctx, e.eventType, e.message, e.metadata)
+	}
+}
+
+// evaluate judges the current step of r. It returns the event to report when
+// the canary weight changed, or nil.
+func (c *Controller) evaluate(ctx context.Context, r *rollout) *event {
+	// The first statistics read only establishes the baseline of the step
+	if r.baseline == nil {
+		stats, err := c.stats.ClusterStats(ctx, r.cluster)
+		if err != nil {
+			log.Printf("Warning: Canary for route %s: %v", r.status.Route, err)
+			return nil
+		}
+		r.baseline = stats
+		return nil
+	}
+
+	interval := defaultStepInterval
+	if r.policy.StepInterval > 0 {
+		interval = time.Duration(r.policy.StepInterval) * time.Second
+	}
+	if c.now().Sub(r.status.LastStep) < interval {
+		return nil
+	}
+
+	stats, err := c.stats.ClusterStats(ctx, r.cluster)
+	if err != nil {
+		log.Printf("Warning: Canary for route %s: %v", r.status.Route, err)
+		return nil
+	}
+
+	// Counters only go down when Envoy was restarted from scratch
+	requests, failed := stats.RequestsCompleted, stats.Requests5xx
+	if requests >= r.baseline.RequestsCompleted && failed >= r.baseline.Requests5xx {
+		requests -= r.baseline.RequestsCompleted
+		failed -= r.baseline.Requests5xx
+	}
+
+	// A canary without traffic cannot be judged; wait for enough requests
+	if r.status.CanaryWeight > 0 && requests < uint64(r.policy.MinRequests) {
+		log.Printf("Canary for route %s: %d of %d requests needed to judge the step", r.status.Route, requests, r.policy.MinRequests)
+		return nil
+	}
+
+	metadata := r.metadata()
+	metadata["requests"] = requests
+	metadata["errors_5xx"] = failed
+	metadata["p99_latency_ms"] = stats.P99LatencyMs
+
+	if reason := r.failure(requests, failed, stats.P99LatencyMs); reason != "" {
+		r.status.Phase = PhaseRolledBack
+		r.status.Reason = reason
+		r.status.CanaryWeight = 0
+		r.status.LastStep = c.now()
+		metadata["reason"] = reason
+		metadata["canary_weight"] = 0
+		return &event{
+			eventType: events.CanaryRolledBack,
+			message:   fmt.Sprintf("Canary for route %s rolled back: %s", r.status.Route, reason),
+			metadata:  metadata,
+		}
+	}
+
+	r.status.CanaryWeight += r.policy.StepWeight
+	if r.status.CanaryWeight >= 100 {
+		r.status.CanaryWeight = 100
+		r.status.Phase = PhasePromoted
+	}
+	r.status.LastStep = c.now()
+	r.baseline = stats
+	metadata["canary_weight"] = r.status.CanaryWeight
+
+	if r.status.Phase == PhasePromoted {
+		return &event{eventType: events.CanaryPromoted, message: fmt.Sprintf("Canary for route %s promoted", r.status.Route), metadata: metadata}
+	}
+	return &event{
+		eventType: events.CanaryStep,
+		message:   fmt.Sprintf("Canary for route %s at %d%%", r.status.Route, r.status.CanaryWeight),
+		metadata:  metadata,
+	}
+}
+
+// failure returns why the canary failed its step, or "" if it is healthy
+func (r *rollout) failure(requests, failed uint64, p99 float64) string {
+	if requests > 0 {
+		if rate := float64(failed) / float64(requests) * 100; rate > r.policy.MaxErrorRate {
+			return fmt.Sprintf("error rate %.1f%% exceeds %.1f%%", rate, r.policy.MaxErrorRate)
+		}
+	}
+	if r.policy.MaxLatencyMs > 0 && p99 > float64(r.policy.MaxLatencyMs) {
+		return fmt.Sprintf("p99 latency %.0fms exceeds %dms", p99, r.policy.MaxLatencyMs)
+	}
+	return ""
+}
+
+// metadata returns the event metadata shared by all events of r
+func (r *rollout) metadata() map[string]interface{} {
+	return map[string]interface{}{
+		"route":         r.status.Route,
+		"canary":        r.status.Canary,
+		"canary_weight": r.status.CanaryWeight,
+	}
+}
+
+// Statuses returns the state of every rollout, ordered by route
+func (c *Controller) Statuses() []Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := make([]Status, 0, len(c.rollouts))
+	for _, r := range c.rollouts {
+		statuses = append(statuses, r.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Route < statuses[j].Route })
+	return statuses
+}
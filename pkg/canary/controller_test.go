@@ -0,0 +1,212 @@
+package canary
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/events"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// fakeStats returns the configured counters for any cluster
+type fakeStats struct {
+	stats   envoy.ClusterStats
+	err     error
+	cluster string
+}
+
+func (f *fakeStats) ClusterStats(_ context.Context, cluster string) (*envoy.ClusterStats, error) {
+	f.cluster = cluster
+	if f.err != nil {
+		return nil, f.err
+	}
+	stats := f.stats
+	return &stats, nil
+}
+
+// harness wires a controller to a fake clock, fake stats and recorded events
+type harness struct {
+	controller *Controller
+	stats      *fakeStats
+	now        time.Time
+	events     []events.Type
+	changes    int
+	initial    int // configured canary weight
+}
+
+func newHarness() *harness {
+	h := &harness{stats: &fakeStats{}, now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h.controller = NewController(h.stats,
+		func(_ context.Context, eventType events.Type, _ string, _ map[string]interface{}) {
+			h.events = append(h.events, eventType)
+		},
+		func() { h.changes++ })
+	h.controller.now = func() time.Time { return h.now }
+	return h
+}
+
+// apply applies a configuration starting the canary at weight
+func (h *harness) apply(weight int) *models.LoadBalancer {
+	h.initial = weight
+	lb := canaryLB(weight)
+	h.controller.Apply(context.Background(), lb)
+	return lb
+}
+
+// tick advances the clock by one step and evaluates the rollouts
+func (h *harness) tick() {
+	h.now = h.now.Add(time.Minute)
+	h.controller.Evaluate(context.Background())
+}
+
+func canaryLB(canaryWeight int) *models.LoadBalancer {
+	backend := models.Backend{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}
+	return &models.LoadBalancer{
+		ID: "lb-1", Name: "web", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+		Pools: []models.BackendPool{
+			{Name: "stable", Backends: []models.Backend{backend}},
+			{Name: "canary", Backends: []models.Backend{backend}},
+		},
+		Routes: []models.Route{{Name: "web", Path: "/", Split: &models.TrafficSplit{
+			Targets: []models.SplitTarget{{Pool: "stable", Weight: 100 - canaryWeight}, {Pool: "canary", Weight: canaryWeight}},
+			Rollout: &models.Rollout{Canary: "canary", StepWeight: 40, StepInterval: 60, MaxErrorRate: 5, MaxLatencyMs: 500, MinRequests: 10},
+		}}},
+	}
+}
+
+// weights re-applies the configuration and returns the stable and canary weights
+func (h *harness) weights(t *testing.T) (int, int) {
+	t.Helper()
+	lb := h.apply(h.initial)
+	if err := lb.Validate(); err != nil {
+		t.Fatalf("rewritten configuration is invalid: %v", err)
+	}
+	targets := lb.Routes[0].Split.Targets
+	return targets[0].Weight, targets[1].Weight
+}
+
+func TestController_Promotes(t *testing.T) {
+	h := newHarness()
+	h.apply(0)
+
+	h.tick() // baseline
+	if h.stats.cluster != "cluster_lb-1_canary" {
+		t.Errorf("stats read from %q, want cluster_lb-1_canary", h.stats.cluster)
+	}
+
+	// At 0% the canary gets no traffic, so the first step is taken without judging
+	h.tick()
+	if stable, canary := h.weights(t); stable != 60 || canary != 40 {
+		t.Fatalf("weights after first step = %d/%d, want 60/40", stable, canary)
+	}
+
+	// Too few requests: hold
+	h.stats.stats = envoy.ClusterStats{RequestsCompleted: 5}
+	h.tick()
+	if _, canary := h.weights(t); canary != 40 {
+		t.Fatalf("canary weight = %d, want 40 while waiting for traffic", canary)
+	}
+
+	h.stats.stats = envoy.ClusterStats{RequestsCompleted: 100, Requests5xx: 1, P99LatencyMs: 120}
+	h.tick()
+	h.stats.stats = envoy.ClusterStats{RequestsCompleted: 200, Requests5xx: 2, P99LatencyMs: 120}
+	h.tick()
+
+	if stable, canary := h.weights(t); stable != 0 || canary != 100 {
+		t.Errorf("weights after promotion = %d/%d, want 0/100", stable, canary)
+	}
+	want := []events.Type{events.CanaryStarted, events.CanaryStep, events.CanaryStep, events.CanaryPromoted}
+	if len(h.events) != len(want) {
+		t.Fatalf("events = %v, want %v", h.events, want)
+	}
+	for i := range want {
+		if h.events[i] != want[i] {
+			t.Errorf("event %d = %s, want %s", i, h.events[i], want[i])
+		}
+	}
+	if h.changes != 3 {
+		t.Errorf("onChange called %d times, want 3", h.changes)
+	}
+
+	statuses := h.controller.Statuses()
+	if len(statuses) != 1 || statuses[0].Phase != PhasePromoted {
+		t.Errorf("Statuses() = %+v, want one promoted rollout", statuses)
+	}
+}
+
+func TestController_RollsBack(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats envoy.ClusterStats
+	}{
+		{name: "error rate", stats: envoy.ClusterStats{RequestsCompleted: 100, Requests5xx: 10}},
+		{name: "latency", stats: envoy.ClusterStats{RequestsCompleted: 100, P99LatencyMs: 900}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness()
+			h.apply(10)
+			h.tick() // baseline
+
+			h.stats.stats = tt.stats
+			h.tick()
+
+			if stable, canary := h.weights(t); stable != 100 || canary != 0 {
+				t.Errorf("weights after rollback = %d/%d, want 100/0", stable, canary)
+			}
+			if last := h.events[len(h.events)-1]; last != events.CanaryRolledBack {
+				t.Errorf("last event = %s, want canary_rolled_back", last)
+			}
+
+			// A rolled back canary stays at 0% until the configuration changes
+			h.stats.stats = envoy.ClusterStats{}
+			h.tick()
+			if _, canary := h.weights(t); canary != 0 {
+				t.Errorf("canary weight = %d after rollback, want 0", canary)
+			}
+			if status := h.controller.Statuses()[0]; status.Phase != PhaseRolledBack || status.Reason == "" {
+				t.Errorf("status = %+v, want rolled_back with a reason", status)
+			}
+		})
+	}
+}
+
+func TestController_RestartsOnConfigChange(t *testing.T) {
+	h := newHarness()
+	h.apply(0)
+	h.tick()
+	h.tick()
+	if _, canary := h.weights(t); canary != 40 {
+		t.Fatalf("canary weight = %d, want 40", canary)
+	}
+
+	// A new starting weight is a new rollout
+	lb := h.apply(20)
+	if canary := lb.Routes[0].Split.Targets[1].Weight; canary != 20 {
+		t.Errorf("canary weight after config change = %d, want 20", canary)
+	}
+
+	// Routes removed from the configuration are forgotten
+	lb = canaryLB(0)
+	lb.Routes[0].Split.Rollout = nil
+	h.controller.Apply(context.Background(), lb)
+	if statuses := h.controller.Statuses(); len(statuses) != 0 {
+		t.Errorf("Statuses() = %+v, want none", statuses)
+	}
+}
+
+func TestController_StatsErrorHolds(t *testing.T) {
+	h := newHarness()
+	h.apply(0)
+	h.stats.err = errors.New("connection refused")
+
+	h.tick()
+	h.tick()
+	if _, canary := h.weights(t); canary != 0 || h.changes != 0 {
+		t.Errorf("canary weight = %d with %d changes, want no progress without stats", canary, h.changes)
+	}
+}
@@ -0,0 +1,444 @@
+// Package ccm implements a cloud-controller-style Service controller: it
+// watches Kubernetes Services of type LoadBalancer and keeps one VPSie load
+// balancer per Service port in sync with the cluster's nodes.
+package ccm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/agent"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/k8s"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+const (
+	// Finalizer keeps a Service until its VPSie load balancers are deleted
+	Finalizer = "service.vpsie.com/load-balancer-cleanup"
+
+	// LoadBalancerClass selects this controller when spec.loadBalancerClass is set
+	LoadBalancerClass = "vpsie.com/load-balancer"
+
+	// AnnotationProtocol sets the load balancer protocol (tcp or http; default tcp)
+	AnnotationProtocol = "service.beta.kubernetes.io/vpsie-lb-protocol"
+	// AnnotationAlgorithm sets the load balancing algorithm (default round_robin)
+	AnnotationAlgorithm = "service.beta.kubernetes.io/vpsie-lb-algorithm"
+
+	// retryDelay is the wait after a failed reconcile before the next attempt
+	retryDelay = 10 * time.Second
+
+	// DefaultWorkers is how many Services are reconciled at once by default
+	DefaultWorkers = 4
+)
+
+// KubernetesAPI is the subset of the Kubernetes API used by the controller
+type KubernetesAPI interface {
+	ListServices(ctx context.Context) (*k8s.ServiceList, error)
+	ListNodes(ctx context.Context) (*k8s.NodeList, error)
+	ListEndpointSlices(ctx context.Context, namespace, service string) (*k8s.EndpointSliceList, error)
+	PatchService(ctx context.Context, namespace, name string, patch interface{}) error
+	PatchServiceStatus(ctx context.Context, namespace, name string, patch interface{}) error
+}
+
+// LoadBalancerAPI manages load balancers in the VPSie account
+type LoadBalancerAPI interface {
+	ListLoadBalancers(ctx context.Context, namePrefix string) ([]agent.ManagedLoadBalancer, error)
+	CreateLoadBalancer(ctx context.Context, lb *models.LoadBalancer) (*agent.ManagedLoadBalancer, error)
+	UpdateLoadBalancer(ctx context.Context, id string, lb *models.LoadBalancer) (*agent.ManagedLoadBalancer, error)
+	DeleteLoadBalancer(ctx context.Context, id string) error
+}
+
+// Controller reconciles Services of type LoadBalancer with VPSie load balancers
+type Controller struct {
+	kube    KubernetesAPI
+	vpsie   LoadBalancerAPI
+	trigger chan struct{}
+	workers int
+}
+
+// NewController creates a Service controller
+func NewController(kube KubernetesAPI, vpsie LoadBalancerAPI) *Controller {
+	return &Controller{kube: kube, vpsie: vpsie, trigger: make(chan struct{}, 1), workers: DefaultWorkers}
+}
+
+// SetWorkers sets how many Services are reconciled at once, so a Service
+// whose load balancer is slow to create or update does not hold up the
+// others. Values below 1 reconcile one Service at a time.
+func (c *Controller) SetWorkers(n int) {
+	c.workers = max(n, 1)
+}
+
+// Trigger requests a reconcile. It never blocks; requests made while one is
+// pending are coalesced.
+func (c *Controller) Trigger() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run reconciles on every trigger and at least every resync interval until
+// ctx is cancelled
+func (c *Controller) Run(ctx context.Context, resync time.Duration) {
+	ticker := time.NewTicker(resync)
+	defer ticker.Stop()
+
+	c.Trigger()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.trigger:
+		}
+
+		if err := c.Reconcile(ctx); err != nil {
+			log.Printf("Error reconciling services: %v", err)
+			// Retry failed services soon instead of waiting for the resync
+			time.AfterFunc(retryDelay, c.Trigger)
+		}
+	}
+}
+
+// Reconcile brings the VPSie load balancers of all Services up to date,
+// several Services at a time. Errors for individual Services are collected
+// so one broken Service does not block the others.
+func (c *Controller) Reconcile(ctx context.Context) error {
+	services, err := c.kube.ListServices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+	nodes, err := c.kube.ListNodes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	// Errors are kept in Service order, so the joined error is stable
+	errs := make([]error, len(services.Items))
+	sem := make(chan struct{}, max(c.workers, 1))
+	var wg sync.WaitGroup
+	for i := range services.Items {
+		svc := &services.Items[i]
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := c.reconcileService(ctx, svc, nodes.Items); err != nil {
+				errs[i] = fmt.Errorf("service %s/%s: %w", svc.Metadata.Namespace, svc.Metadata.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// reconcileService ensures or cleans up the load balancers of one Service
+func (c *Controller) reconcileService(ctx context.Context, svc *k8s.Service, nodes []k8s.Node) error {
+	if !wantsLoadBalancer(svc) {
+		if !svc.Metadata.HasFinalizer(Finalizer) {
+			return nil
+		}
+		return c.cleanup(ctx, svc)
+	}
+
+	if !svc.Metadata.HasFinalizer(Finalizer) {
+		if err := c.setFinalizers(ctx, svc, append(append([]string(nil), svc.Metadata.Finalizers...), Finalizer)); err != nil {
+			return err
+		}
+	}
+
+	backendNodes, err := c.backendNodes(ctx, svc, nodes)
+	if err != nil {
+		return err
+	}
+
+	existing, err := c.vpsie.ListLoadBalancers(ctx, namePrefix(svc))
+	if err != nil {
+		return fmt.Errorf("failed to list load balancers: %w", err)
+	}
+	byName := make(map[string]agent.ManagedLoadBalancer, len(existing))
+	for _, lb := range existing {
+		byName[lb.Name] = lb
+	}
+
+	var ingress []k8s.LoadBalancerIngress
+	desiredNames := make(map[string]bool)
+	for _, port := range svc.Spec.Ports {
+		if port.Protocol != "" && port.Protocol != "TCP" {
+			log.Printf("Skipping %s port %d of service %s/%s: only TCP is supported",
+				port.Protocol, port.Port, svc.Metadata.Namespace, svc.Metadata.Name)
+			continue
+		}
+
+		desired, buildErr := desiredLoadBalancer(svc, port, backendNodes)
+		if buildErr != nil {
+			return buildErr
+		}
+		desiredNames[desired.Name] = true
+
+		ip, ensureErr := c.ensureLoadBalancer(ctx, desired, byName)
+		if ensureErr != nil {
+			return ensureErr
+		}
+		if ip != "" && !containsIngressIP(ingress, ip) {
+			ingress = append(ingress, k8s.LoadBalancerIngress{IP: ip})
+		}
+	}
+
+	// Delete load balancers of ports that were removed from the Service
+	for name, lb := range byName {
+		if desiredNames[name] {
+			continue
+		}
+		log.Printf("Deleting load balancer %s (%s): port removed from service", lb.Name, lb.ID)
+		if err = c.vpsie.DeleteLoadBalancer(ctx, lb.ID); err != nil {
+			return fmt.Errorf("failed to delete load balancer %s: %w", lb.ID, err)
+		}
+	}
+
+	return c.setIngress(ctx, svc, ingress)
+}
+
+// ensureLoadBalancer creates or updates one load balancer and returns its IP
+func (c *Controller) ensureLoadBalancer(ctx context.Context, desired *models.LoadBalancer, byName map[string]agent.ManagedLoadBalancer) (string, error) {
+	current, ok := byName[desired.Name]
+	if !ok {
+		log.Printf("Creating load balancer %s (%d backends)", desired.Name, len(desired.Backends))
+		created, err := c.vpsie.CreateLoadBalancer(ctx, desired)
+		if err != nil {
+			return "", fmt.Errorf("failed to create load balancer %s: %w", desired.Name, err)
+		}
+		return created.IPAddress, nil
+	}
+
+	if upToDate(&current.LoadBalancer, desired) {
+		return current.IPAddress, nil
+	}
+
+	log.Printf("Updating load balancer %s (%s, %d backends)", desired.Name, current.ID, len(desired.Backends))
+	desired.ID = current.ID
+	updated, err := c.vpsie.UpdateLoadBalancer(ctx, current.ID, desired)
+	if err != nil {
+		return "", fmt.Errorf("failed to update load balancer %s: %w", current.ID, err)
+	}
+	if updated.IPAddress != "" {
+		return updated.IPAddress, nil
+	}
+	return current.IPAddress, nil
+}
+
+// cleanup deletes all load balancers of a Service and releases it
+func (c *Controller) cleanup(ctx context.Context, svc *k8s.Service) error {
+	existing, err := c.vpsie.ListLoadBalancers(ctx, namePrefix(svc))
+	if err != nil {
+		return fmt.Errorf("failed to list load balancers: %w", err)
+	}
+	for _, lb := range existing {
+		log.Printf("Deleting load balancer %s (%s) of service %s/%s", lb.Name, lb.ID, svc.Metadata.Namespace, svc.Metadata.Name)
+		if err = c.vpsie.DeleteLoadBalancer(ctx, lb.ID); err != nil {
+			return fmt.Errorf("failed to delete load balancer %s: %w", lb.ID, err)
+		}
+	}
+
+	// A Service being deleted has no status worth updating
+	if svc.Metadata.DeletionTimestamp == nil {
+		if err = c.setIngress(ctx, svc, nil); err != nil {
+			return err
+		}
+	}
+
+	var remaining []string
+	for _, f := range svc.Metadata.Finalizers {
+		if f != Finalizer {
+			remaining = append(remaining, f)
+		}
+	}
+	return c.setFinalizers(ctx, svc, remaining)
+}
+
+// setFinalizers replaces the Service's finalizers. The resourceVersion makes
+// the patch fail instead of overwriting a concurrent change.
+func (c *Controller) setFinalizers(ctx context.Context, svc *k8s.Service, finalizers []string) error {
+	if finalizers == nil {
+		finalizers = []string{}
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      finalizers,
+			"resourceVersion": svc.Metadata.ResourceVersion,
+		},
+	}
+	if err := c.kube.PatchService(ctx, svc.Metadata.Namespace, svc.Metadata.Name, patch); err != nil {
+		return fmt.Errorf("failed to update finalizers: %w", err)
+	}
+	return nil
+}
+
+// setIngress publishes the load balancer IPs in the Service status
+func (c *Controller) setIngress(ctx context.Context, svc *k8s.Service, ingress []k8s.LoadBalancerIngress) error {
+	if len(ingress) == 0 && len(svc.Status.LoadBalancer.Ingress) == 0 {
+		return nil
+	}
+	if reflect.DeepEqual(ingress, svc.Status.LoadBalancer.Ingress) {
+		return nil
+	}
+	if ingress == nil {
+		ingress = []k8s.LoadBalancerIngress{}
+	}
+	patch := map[string]interface{}{
+		"status": map[string]interface{}{
+			"loadBalancer": map[string]interface{}{"ingress": ingress},
+		},
+	}
+	if err := c.kube.PatchServiceStatus(ctx, svc.Metadata.Namespace, svc.Metadata.Name, patch); err != nil {
+		return fmt.Errorf("failed to update status: %w", err)
+	}
+	return nil
+}
+
+// backendNodes returns the nodes that should receive traffic for svc. With
+// externalTrafficPolicy Local only nodes running a ready endpoint qualify,
+// because kube-proxy drops traffic on the others.
+func (c *Controller) backendNodes(ctx context.Context, svc *k8s.Service, nodes []k8s.Node) ([]k8s.Node, error) {
+	var ready []k8s.Node
+	for _, node := range nodes {
+		if node.IsReady() && !node.Spec.Unschedulable && node.InternalIP() != "" {
+			ready = append(ready, node)
+		}
+	}
+
+	if svc.Spec.ExternalTrafficPolicy != k8s.ExternalTrafficPolicyLocal {
+		return ready, nil
+	}
+
+	slices, err := c.kube.ListEndpointSlices(ctx, svc.Metadata.Namespace, svc.Metadata.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list endpoint slices: %w", err)
+	}
+	hasEndpoint := make(map[string]bool)
+	for _, slice := range slices.Items {
+		for _, ep := range slice.Endpoints {
+			if ep.NodeName != nil && (ep.Conditions.Ready == nil || *ep.Conditions.Ready) {
+				hasEndpoint[*ep.NodeName] = true
+			}
+		}
+	}
+
+	var local []k8s.Node
+	for _, node := range ready {
+		if hasEndpoint[node.Metadata.Name] {
+			local = append(local, node)
+		}
+	}
+	return local, nil
+}
+
+// wantsLoadBalancer reports whether this controller should provision svc
+func wantsLoadBalancer(svc *k8s.Service) bool {
+	if svc.Metadata.DeletionTimestamp != nil || svc.Spec.Type != k8s.ServiceTypeLoadBalancer {
+		return false
+	}
+	return svc.Spec.LoadBalancerClass == nil || *svc.Spec.LoadBalancerClass == LoadBalancerClass
+}
+
+// namePrefix is shared by all load balancer names of a Service. The UID keeps
+// names unique across namespaces and re-created Services.
+func namePrefix(svc *k8s.Service) string {
+	return "k8s-" + svc.Metadata.UID + "-"
+}
+
+// desiredLoadBalancer builds the load balancer for one Service port
+func desiredLoadBalancer(svc *k8s.Service, port k8s.ServicePort, nodes []k8s.Node) (*models.LoadBalancer, error) {
+	protocol := models.ProtocolTCP
+	switch p := svc.Metadata.Annotations[AnnotationProtocol]; p {
+	case "", string(models.ProtocolTCP):
+	case string(models.ProtocolHTTP):
+		protocol = models.ProtocolHTTP
+	default:
+		return nil, fmt.Errorf("annotation %s: unsupported protocol %q (use tcp or http)", AnnotationProtocol, p)
+	}
+
+	algorithm := models.AlgoRoundRobin
+	if a := svc.Metadata.Annotations[AnnotationAlgorithm]; a != "" {
+		algorithm = models.LoadBalancingAlgo(a)
+	}
+
+	if port.NodePort == 0 {
+		return nil, fmt.Errorf("port %d has no node port allocated yet", port.Port)
+	}
+
+	lb := &models.LoadBalancer{
+		Name:      fmt.Sprintf("%s%d", namePrefix(svc), port.Port),
+		Protocol:  protocol,
+		Algorithm: algorithm,
+		Port:      port.Port,
+		HealthCheck: &models.HealthCheck{
+			Type:               models.HealthCheckTCP,
+			Interval:           10,
+			Timeout:            5,
+			UnhealthyThreshold: 3,
+			HealthyThreshold:   2,
+		},
+	}
+	for _, node := range nodes {
+		lb.Backends = append(lb.Backends, models.Backend{
+			ID:      "node-" + strings.ReplaceAll(node.Metadata.Name, ".", "-"),
+			Address: node.InternalIP(),
+			Port:    port.NodePort,
+			Weight:  1,
+			Enabled: true,
+		})
+	}
+	sort.Slice(lb.Backends, func(i, j int) bool { return lb.Backends[i].ID < lb.Backends[j].ID })
+
+	// Validate with a placeholder ID; VPSie assigns the real one
+	check := *lb
+	check.ID = "pending"
+	if err := check.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid load balancer for port %d: %w", port.Port, err)
+	}
+	return lb, nil
+}
+
+// upToDate reports whether current already matches the desired settings
+func upToDate(current, desired *models.LoadBalancer) bool {
+	if current.Protocol != desired.Protocol || current.Algorithm != desired.Algorithm || current.Port != desired.Port {
+		return false
+	}
+	if !reflect.DeepEqual(current.HealthCheck, desired.HealthCheck) {
+		return false
+	}
+	if len(current.Backends) != len(desired.Backends) {
+		return false
+	}
+
+	backends := append([]models.Backend(nil), current.Backends...)
+	sort.Slice(backends, func(i, j int) bool { return backends[i].ID < backends[j].ID })
+	for i := range backends {
+		got, want := backends[i], desired.Backends[i]
+		if got.ID != want.ID || got.Address != want.Address || got.Port != want.Port || got.Weight != want.Weight || got.Enabled != want.Enabled {
+			return false
+		}
+	}
+	return true
+}
+
+// containsIngressIP reports whether ingress already lists ip
+func containsIngressIP(ingress []k8s.LoadBalancerIngress, ip string) bool {
+	for _, in := range ingress {
+		if in.IP == ip {
+			return true
+		}
+	}
+	return false
+}
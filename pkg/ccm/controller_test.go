@@ -0,0 +1,390 @@
+package ccm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/agent"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/k8s"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// fakeKube serves fixed objects and records patches
+type fakeKube struct {
+	mu            sync.Mutex
+	services      []k8s.Service
+	nodes         []k8s.Node
+	slices        []k8s.EndpointSlice
+	patches       []interface{}
+	statusPatches []interface{}
+}
+
+func (f *fakeKube) ListServices(context.Context) (*k8s.ServiceList, error) {
+	return &k8s.ServiceList{Items: f.services}, nil
+}
+
+func (f *fakeKube) ListNodes(context.Context) (*k8s.NodeList, error) {
+	return &k8s.NodeList{Items: f.nodes}, nil
+}
+
+func (f *fakeKube) ListEndpointSlices(context.Context, string, string) (*k8s.EndpointSliceList, error) {
+	return &k8s.EndpointSliceList{Items: f.slices}, nil
+}
+
+func (f *fakeKube) PatchService(_ context.Context, _, _ string, patch interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.patches = append(f.patches, patch)
+	return nil
+}
+
+func (f *fakeKube) PatchServiceStatus(_ context.Context, _, _ string, patch interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statusPatches = append(f.statusPatches, patch)
+	return nil
+}
+
+// fakeVPSie is an in-memory VPSie account
+type fakeVPSie struct {
+	mu      sync.Mutex
+	lbs     map[string]agent.ManagedLoadBalancer
+	nextID  int
+	created int
+	updated int
+	deleted []string
+}
+
+func newFakeVPSie() *fakeVPSie {
+	return &fakeVPSie{lbs: make(map[string]agent.ManagedLoadBalancer)}
+}
+
+func (f *fakeVPSie) ListLoadBalancers(_ context.Context, prefix string) ([]agent.ManagedLoadBalancer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []agent.ManagedLoadBalancer
+	for _, lb := range f.lbs {
+		if len(lb.Name) >= len(prefix) && lb.Name[:len(prefix)] == prefix {
+			out = append(out, lb)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeVPSie) CreateLoadBalancer(_ context.Context, lb *models.LoadBalancer) (*agent.ManagedLoadBalancer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	f.created++
+	m := agent.ManagedLoadBalancer{LoadBalancer: *lb, IPAddress: fmt.Sprintf("203.0.113.%d", f.nextID)}
+	m.ID = fmt.Sprintf("lb-%d", f.nextID)
+	f.lbs[m.ID] = m
+	return &m, nil
+}
+
+func (f *fakeVPSie) UpdateLoadBalancer(_ context.Context, id string, lb *models.LoadBalancer) (*agent.ManagedLoadBalancer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updated++
+	m := agent.ManagedLoadBalancer{LoadBalancer: *lb, IPAddress: f.lbs[id].IPAddress}
+	f.lbs[id] = m
+	return &m, nil
+}
+
+func (f *fakeVPSie) DeleteLoadBalancer(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.lbs, id)
+	f.deleted = append(f.deleted, id)
+	return nil
+}
+
+func testNode(name, ip string, ready bool) k8s.Node {
+	status := "False"
+	if ready {
+		status = "True"
+	}
+	return k8s.Node{
+		Metadata: k8s.ObjectMeta{Name: name},
+		Status: k8s.NodeStatus{
+			Addresses:  []k8s.NodeAddress{{Type: k8s.NodeInternalIP, Address: ip}},
+			Conditions: []k8s.NodeCondition{{Type: k8s.NodeReady, Status: status}},
+		},
+	}
+}
+
+func testService() k8s.Service {
+	return k8s.Service{
+		Metadata: k8s.ObjectMeta{Name: "web", Namespace: "default", UID: "uid-1", ResourceVersion: "7"},
+		Spec: k8s.ServiceSpec{
+			Type:  k8s.ServiceTypeLoadBalancer,
+			Ports: []k8s.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30080}},
+		},
+	}
+}
+
+func TestController_CreatesLoadBalancer(t *testing.T) {
+	svc := testService()
+	kube := &fakeKube{
+		services: []k8s.Service{svc},
+		nodes:    []k8s.Node{testNode("n1", "10.0.0.1", true), testNode("n2", "10.0.0.2", true), testNode("n3", "10.0.0.3", false)},
+	}
+	vpsie := newFakeVPSie()
+	c := NewController(kube, vpsie)
+
+	if err := c.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if vpsie.created != 1 {
+		t.Fatalf("created = %d, want 1", vpsie.created)
+	}
+	lb := vpsie.lbs["lb-1"]
+	if lb.Name != "k8s-uid-1-80" || lb.Port != 80 || lb.Protocol != models.ProtocolTCP {
+		t.Errorf("load balancer = %+v", lb.LoadBalancer)
+	}
+	if len(lb.Backends) != 2 {
+		t.Fatalf("backends = %+v, want the two ready nodes", lb.Backends)
+	}
+	if lb.Backends[0].Address != "10.0.0.1" || lb.Backends[0].Port != 30080 {
+		t.Errorf("backend = %+v", lb.Backends[0])
+	}
+	if len(kube.patches) != 1 {
+		t.Errorf("patches = %v, want the finalizer patch", kube.patches)
+	}
+	if len(kube.statusPatches) != 1 {
+		t.Errorf("status patches = %v, want the ingress IP", kube.statusPatches)
+	}
+
+	// A second pass with the status applied changes nothing
+	kube.services[0].Metadata.Finalizers = []string{Finalizer}
+	kube.services[0].Status.LoadBalancer.Ingress = []k8s.LoadBalancerIngress{{IP: "203.0.113.1"}}
+	if err := c.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if vpsie.created != 1 || vpsie.updated != 0 || len(kube.patches) != 1 || len(kube.statusPatches) != 1 {
+		t.Errorf("second reconcile was not a no-op: created=%d updated=%d patches=%d status=%d",
+			vpsie.created, vpsie.updated, len(kube.patches), len(kube.statusPatches))
+	}
+}
+
+// concurrentVPSie counts the load balancers created at once and refuses to
+// create those of one Service
+type concurrentVPSie struct {
+	*fakeVPSie
+	failPrefix string
+	workers    int32
+	inFlight   atomic.Int32
+	peak       atomic.Int32
+}
+
+func (f *concurrentVPSie) CreateLoadBalancer(ctx context.Context, lb *models.LoadBalancer) (*agent.ManagedLoadBalancer, error) {
+	n := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	for {
+		p := f.peak.Load()
+		if n <= p || f.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+	// Wait for the other workers, so the peak shows how many run at once
+	for deadline := time.Now().Add(time.Second); f.peak.Load() < f.workers && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if strings.HasPrefix(lb.Name, f.failPrefix) {
+		return nil, errors.New("quota exceeded")
+	}
+	return f.fakeVPSie.CreateLoadBalancer(ctx, lb)
+}
+
+func TestController_ReconcilesServicesConcurrently(t *testing.T) {
+	kube := &fakeKube{nodes: []k8s.Node{testNode("n1", "10.0.0.1", true)}}
+	for i := range 6 {
+		svc := testService()
+		svc.Metadata.Name = fmt.Sprintf("web-%d", i)
+		svc.Metadata.UID = fmt.Sprintf("uid-%d", i)
+		kube.services = append(kube.services, svc)
+	}
+	vpsie := &concurrentVPSie{fakeVPSie: newFakeVPSie(), failPrefix: "k8s-uid-2-", workers: 2}
+	c := NewController(kube, vpsie)
+	c.SetWorkers(2)
+
+	err := c.Reconcile(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "service default/web-2: ") {
+		t.Fatalf("Reconcile() error = %v, want web-2 to fail", err)
+	}
+	// The failing Service does not stop the others
+	if vpsie.created != 5 {
+		t.Errorf("created = %d, want the load balancers of the other 5 services", vpsie.created)
+	}
+	if peak := vpsie.peak.Load(); peak != 2 {
+		t.Errorf("%d services reconciled at once, want 2", peak)
+	}
+}
+
+func TestController_UpdatesBackendsOnNodeChange(t *testing.T) {
+	svc := testService()
+	svc.Metadata.Finalizers = []string{Finalizer}
+	kube := &fakeKube{services: []k8s.Service{svc}, nodes: []k8s.Node{testNode("n1", "10.0.0.1", true)}}
+	vpsie := newFakeVPSie()
+	c := NewController(kube, vpsie)
+
+	if err := c.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	kube.nodes = append(kube.nodes, testNode("n2", "10.0.0.2", true))
+	if err := c.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if vpsie.updated != 1 {
+		t.Errorf("updated = %d, want 1", vpsie.updated)
+	}
+	if got := len(vpsie.lbs["lb-1"].Backends); got != 2 {
+		t.Errorf("backends = %d, want 2", got)
+	}
+}
+
+func TestController_ExternalTrafficPolicyLocal(t *testing.T) {
+	svc := testService()
+	svc.Spec.ExternalTrafficPolicy = k8s.ExternalTrafficPolicyLocal
+	n2 := "n2"
+	ready := true
+	kube := &fakeKube{
+		services: []k8s.Service{svc},
+		nodes:    []k8s.Node{testNode("n1", "10.0.0.1", true), testNode("n2", "10.0.0.2", true)},
+		slices:   []k8s.EndpointSlice{{Endpoints: []k8s.Endpoint{{NodeName: &n2, Conditions: k8s.EndpointConditions{Ready: &ready}}}}},
+	}
+	vpsie := newFakeVPSie()
+
+	if err := NewController(kube, vpsie).Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	backends := vpsie.lbs["lb-1"].Backends
+	if len(backends) != 1 || backends[0].Address != "10.0.0.2" {
+		t.Errorf("backends = %+v, want only the node with an endpoint", backends)
+	}
+}
+
+func TestController_RemovedPortIsDeleted(t *testing.T) {
+	svc := testService()
+	svc.Metadata.Finalizers = []string{Finalizer}
+	svc.Spec.Ports = append(svc.Spec.Ports, k8s.ServicePort{Protocol: "TCP", Port: 443, NodePort: 30443})
+	kube := &fakeKube{services: []k8s.Service{svc}, nodes: []k8s.Node{testNode("n1", "10.0.0.1", true)}}
+	vpsie := newFakeVPSie()
+	c := NewController(kube, vpsie)
+
+	if err := c.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(vpsie.lbs) != 2 {
+		t.Fatalf("load balancers = %d, want 2", len(vpsie.lbs))
+	}
+
+	kube.services[0].Spec.Ports = kube.services[0].Spec.Ports[:1]
+	if err := c.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(vpsie.lbs) != 1 || len(vpsie.deleted) != 1 {
+		t.Errorf("load balancers = %v, deleted = %v", vpsie.lbs, vpsie.deleted)
+	}
+}
+
+func TestController_Cleanup(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*k8s.Service)
+	}{
+		{name: "service deleted", mutate: func(s *k8s.Service) { now := time.Now(); s.Metadata.DeletionTimestamp = &now }},
+		{name: "type changed", mutate: func(s *k8s.Service) { s.Spec.Type = "ClusterIP" }},
+		{name: "other load balancer class", mutate: func(s *k8s.Service) { class := "example.com/other"; s.Spec.LoadBalancerClass = &class }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := testService()
+			svc.Metadata.Finalizers = []string{"example.com/keep", Finalizer}
+			kube := &fakeKube{services: []k8s.Service{svc}, nodes: []k8s.Node{testNode("n1", "10.0.0.1", true)}}
+			vpsie := newFakeVPSie()
+			c := NewController(kube, vpsie)
+			if err := c.Reconcile(context.Background()); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			tt.mutate(&kube.services[0])
+			kube.patches = nil
+			if err := c.Reconcile(context.Background()); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			if len(vpsie.lbs) != 0 {
+				t.Errorf("load balancers left: %v", vpsie.lbs)
+			}
+			if len(kube.patches) != 1 {
+				t.Fatalf("patches = %v, want the finalizer removal", kube.patches)
+			}
+			finalizers := kube.patches[0].(map[string]interface{})["metadata"].(map[string]interface{})["finalizers"].([]string)
+			if len(finalizers) != 1 || finalizers[0] != "example.com/keep" {
+				t.Errorf("finalizers = %v, want other finalizers kept", finalizers)
+			}
+		})
+	}
+}
+
+func TestController_IgnoresUnmanagedServices(t *testing.T) {
+	svc := testService()
+	svc.Spec.Type = "ClusterIP"
+	kube := &fakeKube{services: []k8s.Service{svc}, nodes: []k8s.Node{testNode("n1", "10.0.0.1", true)}}
+	vpsie := newFakeVPSie()
+
+	if err := NewController(kube, vpsie).Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if vpsie.created != 0 || len(kube.patches) != 0 {
+		t.Errorf("unmanaged service was touched")
+	}
+}
+
+func TestDesiredLoadBalancer_Annotations(t *testing.T) {
+	nodes := []k8s.Node{testNode("n1", "10.0.0.1", true)}
+	port := k8s.ServicePort{Port: 80, NodePort: 30080}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		port        k8s.ServicePort
+		wantProto   models.Protocol
+		wantAlgo    models.LoadBalancingAlgo
+		wantErr     bool
+	}{
+		{name: "defaults", port: port, wantProto: models.ProtocolTCP, wantAlgo: models.AlgoRoundRobin},
+		{name: "http least request", port: port, annotations: map[string]string{AnnotationProtocol: "http", AnnotationAlgorithm: "least_request"},
+			wantProto: models.ProtocolHTTP, wantAlgo: models.AlgoLeastRequest},
+		{name: "https unsupported", port: port, annotations: map[string]string{AnnotationProtocol: "https"}, wantErr: true},
+		{name: "invalid algorithm", port: port, annotations: map[string]string{AnnotationAlgorithm: "fastest"}, wantErr: true},
+		{name: "no node port", port: k8s.ServicePort{Port: 80}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := testService()
+			svc.Metadata.Annotations = tt.annotations
+			lb, err := desiredLoadBalancer(&svc, tt.port, nodes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("desiredLoadBalancer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if lb.Protocol != tt.wantProto || lb.Algorithm != tt.wantAlgo {
+				t.Errorf("protocol = %v, algorithm = %v", lb.Protocol, lb.Algorithm)
+			}
+		})
+	}
+}
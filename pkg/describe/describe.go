@@ -0,0 +1,719 @@
+// Package describe renders a load balancer model as a human-readable summary
+// (Markdown or HTML) for audits and handoffs, without reading raw Envoy YAML.
+package describe
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"html/template"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// Field is a single name/value fact
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Table is a tabular listing, e.g. backends
+type Table struct {
+	Headers []string
+	Rows    [][]string
+}
+
+// Section groups related facts under a heading
+type Section struct {
+	Table  *Table
+	Title  string
+	Fields []Field
+}
+
+// Summary is the structured description of a load balancer
+type Summary struct {
+	Title    string
+	Sections []Section
+}
+
+// Summarize builds the summary of a load balancer
+func Summarize(lb *models.LoadBalancer) *Summary {
+	s := &Summary{Title: fmt.Sprintf("Load Balancer %s (%s)", lb.Name, lb.ID)}
+
+	general := Section{Title: "General", Fields: []Field{
+		{"ID", lb.ID},
+		{"Name", lb.Name},
+		{"Protocol", string(lb.Protocol)},
+		{"Algorithm", string(lb.Algorithm)},
+	}}
+	if lb.MaxConnections > 0 {
+		general.Fields = append(general.Fields, Field{"Max connections", strconv.Itoa(lb.MaxConnections)})
+	}
+	if !lb.UpdatedAt.IsZero() {
+		general.Fields = append(general.Fields, Field{"Last updated", lb.UpdatedAt.UTC().Format("2006-01-02T15:04:05Z")})
+	}
+	s.Sections = append(s.Sections, general)
+
+	listener := Section{Title: "Listener", Fields: []Field{
+		{"Address", listenAddresses(lb)},
+		{"Protocol", string(lb.Protocol)},
+	}}
+	if lb.TCPProtocolHint != "" {
+		listener.Fields = append(listener.Fields, Field{"TCP protocol hint", string(lb.TCPProtocolHint)})
+	}
+	if r := lb.PortRange; r != nil {
+		listener.Fields = append(listener.Fields, Field{"Port range", rangeLabel(*r)})
+	}
+	if len(lb.Ports) > 0 || lb.Helper != "" && lb.PortRange == nil {
+		listener.Fields = append(listener.Fields, Field{"Additional ports", portsLabel(lb)})
+	}
+	if lb.Helper != "" {
+		listener.Fields = append(listener.Fields, Field{"Helper", string(lb.Helper)})
+	}
+	if lb.Timeouts != nil {
+		listener.Fields = append(listener.Fields,
+			Field{"Idle timeout", seconds(lb.Timeouts.Idle)},
+			Field{"Request timeout", seconds(lb.Timeouts.Request)})
+	}
+	if lb.Admission != nil {
+		listener.Fields = append(listener.Fields, Field{"Admission control", string(lb.Admission.Type)})
+	}
+	if lb.ClientIP != nil {
+		listener.Fields = append(listener.Fields, Field{"Client IP", clientIPLabel(lb.ClientIP)})
+	}
+	if t := lb.Tracing; t != nil {
+		rate := t.SamplingRate
+		if rate == 0 {
+			rate = 100
+		}
+		listener.Fields = append(listener.Fields, Field{"Tracing", fmt.Sprintf("%s to %s, %g%% sampled", t.Provider, t.Collector, rate)})
+	}
+	if lb.WAF != nil {
+		listener.Fields = append(listener.Fields, Field{"WAF", wafLabel(lb.WAF)})
+	}
+	if lb.JWTAuth != nil {
+		names := make([]string, 0, len(lb.JWTAuth.Providers))
+		for _, p := range lb.JWTAuth.Providers {
+			names = append(names, p.Name)
+		}
+		listener.Fields = append(listener.Fields, Field{"JWT providers", strings.Join(names, ", ")})
+	}
+	if len(lb.CustomFilters) > 0 {
+		filters := make([]string, 0, len(lb.CustomFilters))
+		for _, f := range lb.CustomFilters {
+			label := fmt.Sprintf("%s %s", f.Type, f.Name)
+			if !f.Enabled {
+				label += " (disabled)"
+			}
+			filters = append(filters, label)
+		}
+		listener.Fields = append(listener.Fields, Field{"Custom filters", strings.Join(filters, ", ")})
+	}
+	if a := lb.Authorization; a != nil {
+		failure := "fails closed"
+		if a.FailureMode == models.AuthorizationFailOpen {
+			failure = "fails open"
+		}
+		listener.Fields = append(listener.Fields, Field{"Authorization", fmt.Sprintf("%s service %s, %s", a.Protocol, a.Service, failure)})
+	}
+	if lb.Listener != nil {
+		if label := listenerTuningLabel(lb.Listener); label != "" {
+			listener.Fields = append(listener.Fields, Field{"Socket tuning", label})
+		}
+	}
+	if b := lb.BandwidthLimit; b != nil {
+		var parts []string
+		if b.IngressBytesPerSecond > 0 {
+			parts = append(parts, "ingress "+bytesPerSecond(b.IngressBytesPerSecond))
+		}
+		if b.EgressBytesPerSecond > 0 {
+			parts = append(parts, "egress "+bytesPerSecond(b.EgressBytesPerSecond))
+		}
+		listener.Fields = append(listener.Fields, Field{"Bandwidth limit", strings.Join(parts, ", ")})
+	}
+	if lb.DDoS != nil {
+		if label := ddosLabel(lb.DDoS); label != "" {
+			listener.Fields = append(listener.Fields, Field{"DDoS protection", label})
+		}
+	}
+	if lb.Maintenance.Active() {
+		listener.Fields = append(listener.Fields, Field{"Maintenance", fmt.Sprintf("enabled, status %d", maintenanceStatus(lb.Maintenance))})
+	}
+	s.Sections = append(s.Sections, listener)
+
+	if lb.Protocol != models.ProtocolTCP {
+		s.Sections = append(s.Sections, routesSection(lb))
+	} else if lb.TLSPassthrough != nil {
+		s.Sections = append(s.Sections, passthroughSection(lb))
+	}
+	if lb.HasDefaultPool() {
+		section := poolSection(lb)
+		if lb.Discovery != nil {
+			section.Fields = append(section.Fields, Field{"Discovery", discoveryLabel(lb.Discovery)})
+		}
+		s.Sections = append(s.Sections, section)
+	}
+	for _, pool := range lb.Pools {
+		section := poolSection(lb)
+		section.Title = "Backend Pool: " + pool.Name
+		if pool.Discovery != nil {
+			section.Fields = append(section.Fields, Field{"Discovery", discoveryLabel(pool.Discovery)})
+		}
+		section.Table = backendTable(pool.Backends)
+		s.Sections = append(s.Sections, section)
+	}
+	if lb.HealthCheck != nil {
+		s.Sections = append(s.Sections, healthCheckSection(lb.HealthCheck))
+	}
+	if lb.TLSConfig != nil {
+		s.Sections = append(s.Sections, tlsSection(lb.TLSConfig))
+	}
+
+	return s
+}
+
+func routesSection(lb *models.LoadBalancer) Section {
+	retries := retriesLabel(lb.RetryPolicy)
+	timeout := routeTimeoutLabel(lb, nil)
+
+	table := &Table{Headers: []string{"Domains", "Path", "Target", "Retries", "Timeout"}}
+	for _, r := range lb.Routes {
+		domains := "*"
+		if len(r.Hosts) > 0 {
+			domains = strings.Join(r.Hosts, ", ")
+		}
+		path := r.Path
+		if r.PathMatch == models.PathMatchExact {
+			path += " (exact)"
+		}
+		if conditions := conditionsLabel(&r); conditions != "" {
+			path += " if " + conditions
+		}
+		target := routeTarget(&r)
+		if m := routeMaintenance(lb, r.Maintenance); m != nil {
+			target = maintenanceLabel(m)
+		}
+		if access := routeAccess(&r); access != "" {
+			target += " (" + access + ")"
+		}
+		if f := r.FaultInjection; f != nil {
+			target += " [" + faultLabel(f) + "]"
+		}
+		routeRetries := retries
+		if r.RetryPolicy != nil {
+			routeRetries = retriesLabel(r.RetryPolicy)
+		}
+		table.Rows = append(table.Rows, []string{domains, path, target, routeRetries, routeTimeoutLabel(lb, r.Timeouts)})
+	}
+	if lb.HasDefaultPool() {
+		target := poolLabel("")
+		if lb.Maintenance.Active() {
+			target = maintenanceLabel(lb.Maintenance)
+		}
+		table.Rows = append(table.Rows, []string{"*", "/", target, retries, timeout})
+	}
+	return Section{Title: "Routes", Table: table}
+}
+
+// conditionsLabel describes the header, cookie and query parameter
+// conditions of a route
+func conditionsLabel(r *models.Route) string {
+	var parts []string
+	for _, kind := range []struct {
+		label      string
+		conditions []models.MatchCondition
+	}{{"header", r.Headers}, {"cookie", r.Cookies}, {"query", r.QueryParams}} {
+		for _, c := range kind.conditions {
+			switch c.Type() {
+			case models.MatchPresent:
+				parts = append(parts, fmt.Sprintf("%s %s present", kind.label, c.Name))
+			case models.MatchRegex:
+				parts = append(parts, fmt.Sprintf("%s %s ~ %s", kind.label, c.Name, c.Value))
+			default:
+				parts = append(parts, fmt.Sprintf("%s %s=%s", kind.label, c.Name, c.Value))
+			}
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// retriesLabel describes the retries of a route
+func retriesLabel(rp *models.RetryPolicy) string {
+	if rp == nil || rp.NumRetries == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d retries", rp.NumRetries)
+}
+
+// routeTimeoutLabel describes the request timeout of a route and its idle
+// timeout when it overrides the load balancer's
+func routeTimeoutLabel(lb *models.LoadBalancer, t *models.RouteTimeouts) string {
+	request := 0
+	if lb.Timeouts != nil {
+		request = lb.Timeouts.Request
+	}
+	if t != nil && t.Request > 0 {
+		request = t.Request
+	}
+	label := "default"
+	if request > 0 {
+		label = seconds(request)
+	}
+	if t != nil && t.Idle > 0 {
+		label += ", idle " + seconds(t.Idle)
+	}
+	return label
+}
+
+// passthroughSection lists where TLS connections go by server name
+func passthroughSection(lb *models.LoadBalancer) Section {
+	table := &Table{Headers: []string{"Server names", "Target"}}
+	for _, r := range lb.TLSPassthrough.Routes {
+		table.Rows = append(table.Rows, []string{strings.Join(r.ServerNames, ", "), poolLabel(r.Pool)})
+	}
+	target := "closed"
+	if lb.HasDefaultPool() {
+		target = poolLabel("")
+	}
+	table.Rows = append(table.Rows, []string{"*", target})
+	return Section{Title: "TLS Passthrough", Table: table}
+}
+
+// routeTarget describes where a route sends traffic, including split weights
+func routeTarget(r *models.Route) string {
+	if r.Split == nil {
+		return poolLabel(r.Pool)
+	}
+	targets := make([]string, 0, len(r.Split.Targets))
+	for _, t := range r.Split.Targets {
+		targets = append(targets, fmt.Sprintf("%s %d%%", poolLabel(t.Pool), t.Weight))
+	}
+	return strings.Join(targets, ", ")
+}
+
+// routeAccess describes the credentials and client ranges a route requires,
+// or "" when it is open to any client
+func routeAccess(r *models.Route) string {
+	var parts []string
+	if r.BasicAuth != nil {
+		parts = append(parts, "basic auth")
+	}
+	if len(r.AllowedCIDRs) > 0 {
+		parts = append(parts, "from "+strings.Join(r.AllowedCIDRs, ", "))
+	}
+	return strings.Join(parts, " ")
+}
+
+// faultLabel describes the delays and aborts a route injects
+func faultLabel(f *models.FaultInjection) string {
+	var parts []string
+	if f.DelayPercent > 0 {
+		parts = append(parts, fmt.Sprintf("%d%% delayed %dms", f.DelayPercent, f.DelayMs))
+	}
+	if f.AbortPercent > 0 {
+		parts = append(parts, fmt.Sprintf("%d%% aborted with %d", f.AbortPercent, f.AbortStatus))
+	}
+	return "faults: " + strings.Join(parts, ", ")
+}
+
+// wafLabel describes the rules and mode of a WAF
+func wafLabel(w *models.WAF) string {
+	var label string
+	if w.RuleSet == models.WAFRuleSetCustom {
+		label = "custom rules " + w.RulesPath
+	} else {
+		paranoia := w.ParanoiaLevel
+		if paranoia == 0 {
+			paranoia = 1
+		}
+		label = fmt.Sprintf("OWASP CRS, paranoia level %d", paranoia)
+	}
+	if w.Mode == models.WAFDetect {
+		label += ", detect only"
+	} else {
+		label += ", blocking"
+	}
+	if n := len(w.ExcludedRules); n > 0 {
+		label += fmt.Sprintf("; rules excluded: %d", n)
+	}
+	return label
+}
+
+// clientIPLabel describes how the client address is detected and forwarded
+func clientIPLabel(c *models.ClientIP) string {
+	if c.PreserveSource {
+		return "original source address"
+	}
+	mode := c.XFFMode
+	if mode == "" {
+		mode = models.XFFAppend
+	}
+	parts := []string{"X-Forwarded-For " + string(mode)}
+	if len(c.TrustedCIDRs) > 0 {
+		parts = append(parts, "trusted proxies "+strings.Join(c.TrustedCIDRs, ", "))
+	} else {
+		parts = append(parts, fmt.Sprintf("%d trusted hops", c.XFFNumTrustedHops))
+	}
+	if c.SetRealIP {
+		parts = append(parts, "X-Real-IP")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// listenerTuningLabel describes the listener socket options that differ from Envoy's defaults
+func listenerTuningLabel(t *models.ListenerTuning) string {
+	var parts []string
+	if t.ReusePort != nil && !*t.ReusePort {
+		parts = append(parts, "SO_REUSEPORT off")
+	}
+	if t.TCPFastOpenQueue > 0 {
+		parts = append(parts, fmt.Sprintf("TCP Fast Open queue %d", t.TCPFastOpenQueue))
+	}
+	if t.Backlog > 0 {
+		parts = append(parts, fmt.Sprintf("backlog %d", t.Backlog))
+	}
+	if t.BufferLimit > 0 {
+		parts = append(parts, fmt.Sprintf("buffer limit %d bytes", t.BufferLimit))
+	}
+	if t.IdleTimeout > 0 {
+		parts = append(parts, "connection idle timeout "+seconds(t.IdleTimeout))
+	}
+	if t.MaxConnectionDuration > 0 {
+		parts = append(parts, "max connection duration "+seconds(t.MaxConnectionDuration))
+	}
+	if t.DrainType == models.DrainModifyOnly {
+		parts = append(parts, "drained on listener changes only")
+	}
+	if k := t.TCPKeepalive; k != nil {
+		parts = append(parts, "TCP keepalive"+keepaliveLabel(k))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// keepaliveLabel describes the keepalive settings that differ from the kernel defaults
+// portsLabel describes the additional ports of a load balancer, e.g.
+// "30000-30099, 2121" or "465, 587"
+func portsLabel(lb *models.LoadBalancer) string {
+	if len(lb.Ports) == 0 {
+		ports := make([]string, 0, len(lb.AdditionalPorts()))
+		for _, port := range lb.AdditionalPorts() {
+			ports = append(ports, strconv.Itoa(port))
+		}
+		return strings.Join(ports, ", ")
+	}
+	ranges := make([]string, 0, len(lb.Ports))
+	for _, r := range lb.Ports {
+		ranges = append(ranges, rangeLabel(r))
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// rangeLabel describes a port range, e.g. "30000-30099" or "2121"
+func rangeLabel(r models.PortRange) string {
+	if r.To == 0 || r.To == r.From {
+		return strconv.Itoa(r.From)
+	}
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+func keepaliveLabel(k *models.TCPKeepalive) string {
+	var parts []string
+	if k.Time > 0 {
+		parts = append(parts, "after "+seconds(k.Time))
+	}
+	if k.Interval > 0 {
+		parts = append(parts, "every "+seconds(k.Interval))
+	}
+	if k.Probes > 0 {
+		parts = append(parts, fmt.Sprintf("%d probes", k.Probes))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+func ddosLabel(d *models.DDoSProtection) string {
+	var parts []string
+	if d.ConnectionRate > 0 {
+		parts = append(parts, fmt.Sprintf("%d new connections/s (burst %d)", d.ConnectionRate, d.Burst()))
+	}
+	if d.MaxConnectionsPerIP > 0 {
+		parts = append(parts, fmt.Sprintf("%d connections per source", d.MaxConnectionsPerIP))
+	}
+	if d.AttackThreshold > 0 {
+		parts = append(parts, fmt.Sprintf("above %d/s limit sources to %d/s", d.AttackThreshold, d.SourceRateLimit))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// routeMaintenance returns the maintenance settings in effect for a route:
+// its own, else the load balancer's, or nil when it is not in maintenance
+func routeMaintenance(lb *models.LoadBalancer, m *models.Maintenance) *models.Maintenance {
+	if m.Active() {
+		return m
+	}
+	if lb.Maintenance.Active() {
+		return lb.Maintenance
+	}
+	return nil
+}
+
+// maintenanceLabel describes a static maintenance response as a route target
+func maintenanceLabel(m *models.Maintenance) string {
+	return fmt.Sprintf("maintenance (%d)", maintenanceStatus(m))
+}
+
+// maintenanceStatus returns the status code of a maintenance response
+func maintenanceStatus(m *models.Maintenance) int {
+	if m.StatusCode == 0 {
+		return models.DefaultMaintenanceStatus
+	}
+	return m.StatusCode
+}
+
+// poolLabel names a route target; the empty pool is the load balancer's own backends
+func poolLabel(pool string) string {
+	if pool == "" {
+		return "backend pool"
+	}
+	return "pool " + pool
+}
+
+func poolSection(lb *models.LoadBalancer) Section {
+	connectTimeout := 5
+	if lb.Timeouts != nil && lb.Timeouts.Connect > 0 {
+		connectTimeout = lb.Timeouts.Connect
+	}
+	section := Section{Title: "Backend Pool", Fields: []Field{
+		{"Connect timeout", seconds(connectTimeout)},
+	}}
+	if pool := lb.ConnectionPool; pool != nil {
+		if pool.MaxConnectionsPerHost > 0 {
+			section.Fields = append(section.Fields, Field{"Max connections per host", strconv.Itoa(pool.MaxConnectionsPerHost)})
+		}
+		if pool.HTTP2 {
+			section.Fields = append(section.Fields, Field{"Upstream protocol", "HTTP/2"})
+		}
+	}
+	if p := lb.Prewarm; p != nil {
+		var warmup []string
+		if p.Window > 0 {
+			warmup = append(warmup, fmt.Sprintf("%s slow start", seconds(p.Window)))
+		}
+		if p.PreconnectRatio > 0 {
+			warmup = append(warmup, fmt.Sprintf("%g connections open per connection in use", p.PreconnectRatio))
+		}
+		section.Fields = append(section.Fields, Field{"Warm-up", strings.Join(warmup, ", ")})
+	}
+
+	section.Table = backendTable(lb.Backends)
+	return section
+}
+
+// listenAddresses lists the addresses the listener binds as host:port
+func listenAddresses(lb *models.LoadBalancer) string {
+	addrs := lb.ListenAddresses()
+	labels := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		labels = append(labels, net.JoinHostPort(addr, strconv.Itoa(lb.ListenPort())))
+	}
+	return strings.Join(labels, ", ")
+}
+
+// discoveryLabel describes where a pool's discovered backends come from
+func discoveryLabel(d *models.Discovery) string {
+	label := fmt.Sprintf("VPSie servers tagged %s", d.Tag)
+	if d.Type == models.DiscoveryConsul {
+		label = fmt.Sprintf("Consul service %s", d.Service)
+		if d.Tag != "" {
+			label += fmt.Sprintf(" (tag %s)", d.Tag)
+		}
+		if d.Datacenter != "" {
+			label += fmt.Sprintf(" in %s", d.Datacenter)
+		}
+	}
+	if d.Port > 0 {
+		label += fmt.Sprintf(", port %d", d.Port)
+	}
+	return label
+}
+
+// backendTable lists backends
+func backendTable(backends []models.Backend) *Table {
+	table := &Table{Headers: []string{"ID", "Address", "Port", "Weight", "Enabled"}}
+	for _, b := range backends {
+		table.Rows = append(table.Rows, []string{
+			b.ID, b.Address, strconv.Itoa(b.Port), strconv.Itoa(b.Weight), strconv.FormatBool(b.Enabled),
+		})
+	}
+	return table
+}
+
+func healthCheckSection(hc *models.HealthCheck) Section {
+	section := Section{Title: "Health Check", Fields: []Field{
+		{"Type", string(hc.Type)},
+		{"Interval", seconds(hc.Interval)},
+		{"Timeout", seconds(hc.Timeout)},
+		{"Healthy threshold", strconv.Itoa(hc.HealthyThreshold)},
+		{"Unhealthy threshold", strconv.Itoa(hc.UnhealthyThreshold)},
+	}}
+	if hc.IsHTTPBased() {
+		section.Fields = append(section.Fields, Field{"Path", hc.Path})
+		if len(hc.ExpectedStatus) > 0 {
+			codes := make([]string, 0, len(hc.ExpectedStatus))
+			for _, code := range hc.ExpectedStatus {
+				codes = append(codes, strconv.Itoa(code))
+			}
+			section.Fields = append(section.Fields, Field{"Expected status", strings.Join(codes, ", ")})
+		}
+	}
+	return section
+}
+
+func tlsSection(tls *models.TLSConfig) Section {
+	maxVersion := tls.MaxVersion
+	if maxVersion == "" {
+		maxVersion = "(Envoy default)"
+	}
+	section := Section{Title: "TLS", Fields: []Field{
+		{"Certificate", tls.CertificatePath},
+		{"Private key", tls.PrivateKeyPath},
+		{"Minimum version", tls.MinVersion},
+		{"Maximum version", maxVersion},
+	}}
+	if len(tls.ALPN) > 0 {
+		section.Fields = append(section.Fields, Field{"ALPN", strings.Join(tls.ALPN, ", ")})
+	}
+	if tls.SessionTimeout > 0 {
+		section.Fields = append(section.Fields, Field{"Session timeout", fmt.Sprintf("%ds", tls.SessionTimeout)})
+	}
+	if tls.DisableSessionTickets {
+		section.Fields = append(section.Fields, Field{"Session tickets", "disabled"})
+	}
+	section.Fields = append(section.Fields, certificateFacts(tls.CertificatePath)...)
+	return section
+}
+
+// certificateFacts reads the certificate, if available locally, and reports its subject and validity
+func certificateFacts(path string) []Field {
+	// #nosec G304 -- path was validated to be within the certificate directory
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []Field{{"Certificate details", "unavailable (" + err.Error() + ")"}}
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return []Field{{"Certificate details", "unavailable (no PEM data)"}}
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return []Field{{"Certificate details", "unavailable (" + err.Error() + ")"}}
+	}
+
+	fields := []Field{
+		{"Subject", cert.Subject.String()},
+		{"Issuer", cert.Issuer.String()},
+		{"Not after", cert.NotAfter.UTC().Format("2006-01-02T15:04:05Z")},
+	}
+	if len(cert.DNSNames) > 0 {
+		fields = append(fields, Field{"DNS names", strings.Join(cert.DNSNames, ", ")})
+	}
+	return fields
+}
+
+// bytesPerSecond renders a rate in the largest binary unit it is a whole
+// multiple of
+func bytesPerSecond(n int64) string {
+	for _, unit := range []struct {
+		name string
+		size int64
+	}{{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+		if n%unit.size == 0 {
+			return fmt.Sprintf("%d %s/s", n/unit.size, unit.name)
+		}
+	}
+	return fmt.Sprintf("%d B/s", n)
+}
+
+func seconds(n int) string {
+	if n == 0 {
+		return "not set"
+	}
+	return fmt.Sprintf("%ds", n)
+}
+
+// Markdown renders the summary as Markdown
+func (s *Summary) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", s.Title)
+
+	for _, section := range s.Sections {
+		fmt.Fprintf(&b, "\n## %s\n\n", section.Title)
+		for _, f := range section.Fields {
+			fmt.Fprintf(&b, "- **%s:** %s\n", f.Name, escapeMarkdown(f.Value))
+		}
+		if section.Table != nil {
+			if len(section.Fields) > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "| %s |\n", strings.Join(section.Table.Headers, " | "))
+			fmt.Fprintf(&b, "|%s\n", strings.Repeat(" --- |", len(section.Table.Headers)))
+			for _, row := range section.Table.Rows {
+				cells := make([]string, len(row))
+				for i, cell := range row {
+					cells[i] = escapeMarkdown(cell)
+				}
+				fmt.Fprintf(&b, "| %s |\n", strings.Join(cells, " | "))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// escapeMarkdown escapes characters that would break Markdown tables or emphasis
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("|", "\\|", "*", "\\*", "_", "\\_", "\n", " ").Replace(s)
+}
+
+var htmlTemplate = template.Must(template.New("summary").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{ .Title }}</title></head>
+<body>
+<h1>{{ .Title }}</h1>
+{{- range .Sections }}
+<h2>{{ .Title }}</h2>
+{{- if .Fields }}
+<dl>
+{{- range .Fields }}
+<dt>{{ .Name }}</dt><dd>{{ .Value }}</dd>
+{{- end }}
+</dl>
+{{- end }}
+{{- if .Table }}
+<table>
+<tr>{{ range .Table.Headers }}<th>{{ . }}</th>{{ end }}</tr>
+{{- range .Table.Rows }}
+<tr>{{ range . }}<td>{{ . }}</td>{{ end }}</tr>
+{{- end }}
+</table>
+{{- end }}
+{{- end }}
+</body>
+</html>
+`))
+
+// HTML renders the summary as a standalone HTML page
+func (s *Summary) HTML() (string, error) {
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, s); err != nil {
+		return "", fmt.Errorf("failed to render HTML summary: %w", err)
+	}
+	return buf.String(), nil
+}
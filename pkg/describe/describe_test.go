@@ -0,0 +1,402 @@
+package describe
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func testLoadBalancer() *models.LoadBalancer {
+	return &models.LoadBalancer{
+		ID:        "lb-1",
+		Name:      "shop",
+		Protocol:  models.ProtocolHTTPS,
+		Algorithm: models.AlgoLeastRequest,
+		Port:      443,
+		Backends: []models.Backend{
+			{ID: "be-1", Address: "10.0.0.1", Port: 8080, Weight: 100, Enabled: true},
+			{ID: "be-2", Address: "10.0.0.2", Port: 8080, Weight: 50, Enabled: false},
+		},
+		HealthCheck: &models.HealthCheck{
+			Type: models.HealthCheckHTTP, Path: "/health", Interval: 10, Timeout: 5,
+			HealthyThreshold: 2, UnhealthyThreshold: 3, ExpectedStatus: []int{200, 204},
+		},
+		TLSConfig: &models.TLSConfig{
+			CertificatePath: "/nonexistent/cert.pem",
+			PrivateKeyPath:  "/nonexistent/key.pem",
+			MinVersion:      "TLSv1.2",
+			ALPN:            []string{"h2", "http/1.1"},
+		},
+		Timeouts: &models.Timeouts{Connect: 3, Idle: 60, Request: 30},
+	}
+}
+
+func TestSummary_Markdown(t *testing.T) {
+	md := Summarize(testLoadBalancer()).Markdown()
+
+	for _, want := range []string{
+		"# Load Balancer shop (lb-1)",
+		"## Listener",
+		"- **Address:** 0.0.0.0:443",
+		"## Routes",
+		"## Backend Pool",
+		"- **Connect timeout:** 3s",
+		"| be-2 | 10.0.0.2 | 8080 | 50 | false |",
+		"- **Expected status:** 200, 204",
+		"- **Minimum version:** TLSv1.2",
+		"- **Certificate details:** unavailable",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown() missing %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestSummary_Markdown_Prewarm(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.Prewarm = &models.Prewarm{Window: 60, PreconnectRatio: 1.5}
+
+	md := Summarize(lb).Markdown()
+	if want := "- **Warm-up:** 60s slow start, 1.5 connections open per connection in use"; !strings.Contains(md, want) {
+		t.Errorf("Markdown() missing %q:\n%s", want, md)
+	}
+}
+
+func TestSummary_Markdown_TCPHasNoRoutes(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.Protocol = models.ProtocolTCP
+	lb.TLSConfig = nil
+
+	md := Summarize(lb).Markdown()
+	if strings.Contains(md, "## Routes") || strings.Contains(md, "## TLS") {
+		t.Errorf("TCP summary must not list routes or TLS:\n%s", md)
+	}
+}
+
+func TestSummary_Markdown_RouteOverrides(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.RetryPolicy = &models.RetryPolicy{NumRetries: 2}
+	lb.Routes = []models.Route{
+		{Name: "checkout", Path: "/checkout", RetryPolicy: &models.RetryPolicy{NumRetries: 0}},
+		{Name: "search", Path: "/search", Timeouts: &models.RouteTimeouts{Request: 3, Idle: 2}},
+	}
+
+	md := Summarize(lb).Markdown()
+	for _, want := range []string{
+		"| \\* | /checkout | backend pool | none |",
+		"| \\* | /search | backend pool | 2 retries | 3s, idle 2s |",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown() missing %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestSummary_Markdown_RouteConditions(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.Routes = []models.Route{{
+		Name: "beta", Path: "/",
+		Cookies:     []models.MatchCondition{{Name: "ab_group", Value: "b"}},
+		Headers:     []models.MatchCondition{{Name: "x-internal", Match: models.MatchPresent}},
+		QueryParams: []models.MatchCondition{{Name: "v", Match: models.MatchRegex, Value: "2"}},
+	}}
+
+	md := Summarize(lb).Markdown()
+	if want := "| / if header x-internal present, cookie ab\\_group=b, query v ~ 2 |"; !strings.Contains(md, want) {
+		t.Errorf("Markdown() missing %q:\n%s", want, md)
+	}
+}
+
+func TestSummary_Markdown_TLSPassthrough(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.Protocol = models.ProtocolTCP
+	lb.TLSConfig = nil
+	lb.Backends = nil
+	lb.Pools = []models.BackendPool{
+		{Name: "api", Backends: []models.Backend{{ID: "api-1", Address: "10.0.1.1", Port: 443, Enabled: true}}},
+	}
+	lb.TLSPassthrough = &models.TLSPassthrough{Routes: []models.SNIRoute{
+		{ServerNames: []string{"api.example.com", "*.api.example.com"}, Pool: "api"},
+	}}
+
+	md := Summarize(lb).Markdown()
+	for _, want := range []string{
+		"## TLS Passthrough",
+		`| api.example.com, \*.api.example.com | pool api |`,
+		`| \* | closed |`,
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown() missing %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestSummary_Markdown_RoutesAndPools(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.Pools = []models.BackendPool{
+		{Name: "api", Backends: []models.Backend{{ID: "api-1", Address: "10.0.1.1", Port: 9000, Enabled: true}}},
+	}
+	lb.Routes = []models.Route{
+		{Name: "api", Hosts: []string{"api.example.com"}, Path: "/v1", Pool: "api"},
+		{Name: "health", Path: "/healthz", PathMatch: models.PathMatchExact, Pool: "api"},
+		{Name: "canary", Path: "/shop", Split: &models.TrafficSplit{Targets: []models.SplitTarget{
+			{Weight: 90}, {Pool: "api", Weight: 10},
+		}}},
+	}
+
+	md := Summarize(lb).Markdown()
+	for _, want := range []string{
+		"| api.example.com | /v1 | pool api | none |",
+		"| \\* | /healthz (exact) | pool api | none |",
+		"| \\* | / | backend pool | none |",
+		"| \\* | /shop | backend pool 90%, pool api 10% | none |",
+		"## Backend Pool: api",
+		"| api-1 | 10.0.1.1 | 9000 | 0 | true |",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown() missing %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestSummary_Markdown_RouteAccess(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.Routes = []models.Route{
+		{Name: "staging", Hosts: []string{"staging.example.com"}, Path: "/", BasicAuth: &models.BasicAuth{UsersFile: "/etc/vpsie-lb/auth/staging.htpasswd"}, AllowedCIDRs: []string{"203.0.113.0/24"}},
+		{Name: "admin", Path: "/admin", AllowedCIDRs: []string{"10.0.0.0/8", "192.168.0.0/16"}},
+	}
+
+	md := Summarize(lb).Markdown()
+	for _, want := range []string{
+		"| staging.example.com | / | backend pool (basic auth from 203.0.113.0/24) | none |",
+		"| \\* | /admin | backend pool (from 10.0.0.0/8, 192.168.0.0/16) | none |",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown() missing %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestSummary_Markdown_Maintenance(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.Pools = []models.BackendPool{
+		{Name: "api", Backends: []models.Backend{{ID: "api-1", Address: "10.0.1.1", Port: 9000, Enabled: true}}},
+	}
+	lb.Routes = []models.Route{
+		{Name: "api", Path: "/v1", Pool: "api", Maintenance: &models.Maintenance{Enabled: true, StatusCode: 200}},
+	}
+
+	md := Summarize(lb).Markdown()
+	if !strings.Contains(md, "| \\* | /v1 | maintenance (200) | none |") || !strings.Contains(md, "| \\* | / | backend pool | none |") {
+		t.Errorf("Markdown() must show the route in maintenance only:\n%s", md)
+	}
+
+	lb.Maintenance = &models.Maintenance{Enabled: true}
+	md = Summarize(lb).Markdown()
+	for _, want := range []string{
+		"- **Maintenance:** enabled, status 503",
+		"| \\* | /v1 | maintenance (200) | none |",
+		"| \\* | / | maintenance (503) | none |",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown() missing %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestSummary_Markdown_ClientIP(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.ClientIP = &models.ClientIP{XFFNumTrustedHops: 1, XFFMode: models.XFFOverwrite, SetRealIP: true}
+
+	md := Summarize(lb).Markdown()
+	if want := "- **Client IP:** X-Forwarded-For overwrite; 1 trusted hops; X-Real-IP"; !strings.Contains(md, want) {
+		t.Errorf("Markdown() missing %q:\n%s", want, md)
+	}
+}
+
+func TestSummary_HTML(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.Backends[0].Address = "<script>"
+
+	page, err := Summarize(lb).HTML()
+	if err != nil {
+		t.Fatalf("HTML() error = %v", err)
+	}
+	if !strings.Contains(page, "<h2>Backend Pool</h2>") {
+		t.Errorf("HTML() missing backend pool section:\n%s", page)
+	}
+	if strings.Contains(page, "<script>") {
+		t.Error("HTML() must escape values")
+	}
+}
+
+func TestSummary_Markdown_Addresses(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.Addresses = []string{"203.0.113.10", "2001:db8::10"}
+
+	md := Summarize(lb).Markdown()
+	if want := "203.0.113.10:443, [2001:db8::10]:443"; !strings.Contains(md, want) {
+		t.Errorf("Markdown() missing %q:\n%s", want, md)
+	}
+}
+
+func TestSummary_Markdown_SocketTuning(t *testing.T) {
+	lb := testLoadBalancer()
+	reusePort := false
+	lb.Listener = &models.ListenerTuning{ReusePort: &reusePort, Backlog: 4096}
+
+	md := Summarize(lb).Markdown()
+	if want := `- **Socket tuning:** SO\_REUSEPORT off; backlog 4096`; !strings.Contains(md, want) {
+		t.Errorf("Markdown() missing %q:\n%s", want, md)
+	}
+
+	lb.Listener = &models.ListenerTuning{MaxConnectionDuration: 3600, DrainType: models.DrainModifyOnly}
+	md = Summarize(lb).Markdown()
+	if want := "- **Socket tuning:** max connection duration 3600s; drained on listener changes only"; !strings.Contains(md, want) {
+		t.Errorf("Markdown() missing %q:\n%s", want, md)
+	}
+
+	lb.Listener = &models.ListenerTuning{TCPKeepalive: &models.TCPKeepalive{Time: 60, Probes: 5}}
+	md = Summarize(lb).Markdown()
+	if want := "- **Socket tuning:** TCP keepalive (after 60s, 5 probes)"; !strings.Contains(md, want) {
+		t.Errorf("Markdown() missing %q:\n%s", want, md)
+	}
+}
+
+func TestSummary_Markdown_BandwidthLimit(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.BandwidthLimit = &models.BandwidthLimit{IngressBytesPerSecond: 512 << 10, EgressBytesPerSecond: 5000000}
+
+	md := Summarize(lb).Markdown()
+	if want := "- **Bandwidth limit:** ingress 512 KiB/s, egress 5000000 B/s"; !strings.Contains(md, want) {
+		t.Errorf("Markdown() missing %q:\n%s", want, md)
+	}
+}
+
+func TestSummary_Markdown_TCPProtocolHint(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.Protocol = models.ProtocolTCP
+	lb.TCPProtocolHint = models.TCPProtocolMySQL
+
+	md := Summarize(lb).Markdown()
+	if want := "- **TCP protocol hint:** mysql"; !strings.Contains(md, want) {
+		t.Errorf("Markdown() missing %q:\n%s", want, md)
+	}
+}
+
+func TestSummary_Markdown_Ports(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.Protocol = models.ProtocolTCP
+	lb.Port = 21
+	lb.Helper = models.TCPHelperFTP
+	lb.Ports = []models.PortRange{{From: 30000, To: 30099}, {From: 2121}}
+
+	md := Summarize(lb).Markdown()
+	for _, want := range []string{"- **Additional ports:** 30000-30099, 2121", "- **Helper:** ftp"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown() missing %q:\n%s", want, md)
+		}
+	}
+
+	lb.Port = 25
+	lb.Helper = models.TCPHelperSMTP
+	lb.Ports = nil
+	if want := "- **Additional ports:** 465, 587"; !strings.Contains(Summarize(lb).Markdown(), want) {
+		t.Errorf("Markdown() missing %q", want)
+	}
+
+	lb.Port = 0
+	lb.Helper = ""
+	lb.PortRange = &models.PortRange{From: 27015, To: 27030}
+	md = Summarize(lb).Markdown()
+	for _, want := range []string{"- **Port range:** 27015-27030", ":27015"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown() missing %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestSummary_Markdown_DDoSProtection(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.DDoS = &models.DDoSProtection{ConnectionRate: 200, MaxConnectionsPerIP: 50, AttackThreshold: 2000, SourceRateLimit: 20}
+
+	md := Summarize(lb).Markdown()
+	if want := "- **DDoS protection:** 200 new connections/s (burst 200); 50 connections per source; above 2000/s limit sources to 20/s"; !strings.Contains(md, want) {
+		t.Errorf("Markdown() missing %q:\n%s", want, md)
+	}
+}
+
+func TestSummary_Markdown_Tracing(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.Tracing = &models.Tracing{Provider: models.TracingZipkin, Collector: "zipkin.internal:9411", SamplingRate: 2.5}
+
+	md := Summarize(lb).Markdown()
+	if want := "- **Tracing:** zipkin to zipkin.internal:9411, 2.5% sampled"; !strings.Contains(md, want) {
+		t.Errorf("Markdown() missing %q:\n%s", want, md)
+	}
+}
+
+func TestSummary_Markdown_Authorization(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.Authorization = &models.Authorization{Protocol: models.AuthorizationGRPC, Service: "opa.internal:9191", FailureMode: models.AuthorizationFailOpen}
+
+	md := Summarize(lb).Markdown()
+	if want := "- **Authorization:** grpc service opa.internal:9191, fails open"; !strings.Contains(md, want) {
+		t.Errorf("Markdown() missing %q:\n%s", want, md)
+	}
+}
+
+func TestSummary_Markdown_JWTAuth(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.JWTAuth = &models.JWTAuth{Providers: []models.JWTProvider{{Name: "auth0"}, {Name: "keycloak"}}}
+
+	md := Summarize(lb).Markdown()
+	if want := "- **JWT providers:** auth0, keycloak"; !strings.Contains(md, want) {
+		t.Errorf("Markdown() missing %q:\n%s", want, md)
+	}
+}
+
+func TestSummary_Markdown_CustomFilters(t *testing.T) {
+	lb := testLoadBalancer()
+	lb.CustomFilters = []models.CustomFilter{
+		{Name: "tag", Type: models.CustomFilterLua, Enabled: true},
+		{Name: "geoip", Type: models.CustomFilterWASM},
+	}
+
+	md := Summarize(lb).Markdown()
+	if want := "- **Custom filters:** lua tag, wasm geoip (disabled)"; !strings.Contains(md, want) {
+		t.Errorf("Markdown() missing %q:\n%s", want, md)
+	}
+}
+
+func TestSummary_Markdown_WAF(t *testing.T) {
+	tests := []struct {
+		name string
+		waf  models.WAF
+		want string
+	}{
+		{
+			name: "crs",
+			waf:  models.WAF{Mode: models.WAFBlock, ParanoiaLevel: 2, ExcludedRules: []int{920350}},
+			want: "- **WAF:** OWASP CRS, paranoia level 2, blocking; rules excluded: 1",
+		},
+		{
+			name: "custom rules",
+			waf:  models.WAF{Mode: models.WAFDetect, RuleSet: models.WAFRuleSetCustom, RulesPath: "/etc/vpsie-lb/waf/rules.conf"},
+			want: "- **WAF:** custom rules /etc/vpsie-lb/waf/rules.conf, detect only",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := testLoadBalancer()
+			lb.WAF = &tt.waf
+
+			md := Summarize(lb).Markdown()
+			if !strings.Contains(md, tt.want) {
+				t.Errorf("Markdown() missing %q:\n%s", tt.want, md)
+			}
+		})
+	}
+}
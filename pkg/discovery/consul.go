@@ -0,0 +1,118 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+const (
+	// consulTimeout bounds one Consul health query
+	consulTimeout = 10 * time.Second
+
+	// maxConsulResponseSize limits Consul responses read into memory (8 MiB)
+	maxConsulResponseSize = 8 * 1024 * 1024
+)
+
+// ConsulProvider discovers the instances of a Consul service whose health
+// checks are passing
+type ConsulProvider struct {
+	httpClient *http.Client
+	address    string
+	token      string
+}
+
+// NewConsulProvider creates a provider for the Consul agent at address,
+// e.g. http://127.0.0.1:8500. token is the ACL token, empty for none.
+func NewConsulProvider(address, token string) (*ConsulProvider, error) {
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Consul address: %w", err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid Consul address %q: must be http(s)://host:port", address)
+	}
+	return &ConsulProvider{
+		httpClient: &http.Client{Timeout: consulTimeout},
+		address:    strings.TrimSuffix(address, "/"),
+		token:      token,
+	}, nil
+}
+
+// consulServiceEntry is the subset of a /v1/health/service entry used here
+type consulServiceEntry struct {
+	Node struct {
+		Node    string `json:"Node"`
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		ID      string `json:"ID"`
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+}
+
+// Discover returns a backend for each passing instance of query.Service
+func (p *ConsulProvider) Discover(ctx context.Context, query *models.Discovery) ([]models.Backend, error) {
+	params := url.Values{"passing": {"true"}}
+	if query.Tag != "" {
+		params.Set("tag", query.Tag)
+	}
+	if query.Datacenter != "" {
+		params.Set("dc", query.Datacenter)
+	}
+	reqURL := fmt.Sprintf("%s/v1/health/service/%s?%s", p.address, url.PathEscape(query.Service), params.Encode())
+
+	ctx, cancel := context.WithTimeout(ctx, consulTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if p.token != "" {
+		req.Header.Set("X-Consul-Token", p.token)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Consul: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("consul returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var entries []consulServiceEntry
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxConsulResponseSize)).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode Consul response: %w", err)
+	}
+
+	backends := make([]models.Backend, 0, len(entries))
+	for _, entry := range entries {
+		// Services registered without an address are reachable at their node's
+		address := entry.Service.Address
+		if address == "" {
+			address = entry.Node.Address
+		}
+		port := entry.Service.Port
+		if query.Port > 0 {
+			port = query.Port
+		}
+		backends = append(backends, models.Backend{
+			ID:      "consul-" + entry.Node.Node + "-" + entry.Service.ID,
+			Address: address,
+			Port:    port,
+			Enabled: true,
+		})
+	}
+	return backends, nil
+}
@@ -0,0 +1,94 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestConsulProvider_Discover(t *testing.T) {
+	var gotPath, gotQuery, gotToken string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery, gotToken = r.URL.Path, r.URL.RawQuery, r.Header.Get("X-Consul-Token")
+		_, _ = w.Write([]byte(`[
+			{"Node": {"Node": "node-1", "Address": "10.0.0.1"}, "Service": {"ID": "web-1", "Address": "", "Port": 8080}},
+			{"Node": {"Node": "node-2", "Address": "10.0.0.2"}, "Service": {"ID": "web-2", "Address": "10.0.1.2", "Port": 8081}}
+		]`))
+	}))
+	defer server.Close()
+
+	provider, err := NewConsulProvider(server.URL+"/", "secret")
+	if err != nil {
+		t.Fatalf("NewConsulProvider() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		query     models.Discovery
+		wantQuery string
+		wantPorts []int
+	}{
+		{
+			name:      "registered ports",
+			query:     models.Discovery{Type: models.DiscoveryConsul, Service: "web"},
+			wantQuery: "passing=true",
+			wantPorts: []int{8080, 8081},
+		},
+		{
+			name:      "tag, datacenter and port override",
+			query:     models.Discovery{Type: models.DiscoveryConsul, Service: "web", Tag: "v2", Datacenter: "fra1", Port: 9000},
+			wantQuery: "dc=fra1&passing=true&tag=v2",
+			wantPorts: []int{9000, 9000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends, err := provider.Discover(context.Background(), &tt.query)
+			if err != nil {
+				t.Fatalf("Discover() error = %v", err)
+			}
+			if gotPath != "/v1/health/service/web" || gotQuery != tt.wantQuery || gotToken != "secret" {
+				t.Errorf("request = %s?%s (token %q), want /v1/health/service/web?%s with the token", gotPath, gotQuery, gotToken, tt.wantQuery)
+			}
+			if len(backends) != 2 {
+				t.Fatalf("Discover() = %d backends, want 2", len(backends))
+			}
+			// Instances without a service address are reached on their node
+			if backends[0].Address != "10.0.0.1" || backends[1].Address != "10.0.1.2" {
+				t.Errorf("addresses = %s, %s, want 10.0.0.1, 10.0.1.2", backends[0].Address, backends[1].Address)
+			}
+			for i, b := range backends {
+				if b.Port != tt.wantPorts[i] || !b.Enabled || b.ID == "" {
+					t.Errorf("backend %d = %+v, want enabled on port %d", i, b, tt.wantPorts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConsulProvider_Discover_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	provider, err := NewConsulProvider(server.URL, "")
+	if err != nil {
+		t.Fatalf("NewConsulProvider() error = %v", err)
+	}
+	if _, err = provider.Discover(context.Background(), &models.Discovery{Type: models.DiscoveryConsul, Service: "web"}); err == nil {
+		t.Error("Discover() error = nil, want the 403")
+	}
+}
+
+func TestNewConsulProvider_InvalidAddress(t *testing.T) {
+	for _, address := range []string{"", "127.0.0.1:8500", "ftp://consul"} {
+		if _, err := NewConsulProvider(address, ""); err == nil {
+			t.Errorf("NewConsulProvider(%q) error = nil, want an error", address)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Package discovery adds backends found by service discovery (VPSie server
+// tags, Consul services) to a load balancer configuration. Discovered
+// backends are merged with the configured ones before Envoy configuration is
+// generated, so scaling groups join and leave the load balancer on their own.
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// Provider answers discovery queries of one type
+type Provider interface {
+	Discover(ctx context.Context, query *models.Discovery) ([]models.Backend, error)
+}
+
+// ProviderFunc adapts a function to a Provider
+type ProviderFunc func(ctx context.Context, query *models.Discovery) ([]models.Backend, error)
+
+// Discover calls f
+func (f ProviderFunc) Discover(ctx context.Context, query *models.Discovery) ([]models.Backend, error) {
+	return f(ctx, query)
+}
+
+// Resolver merges discovered backends into load balancer configurations. It
+// remembers the last successful answer to each query and keeps using it
+// while the provider is unavailable, so an outage of Consul or the VPSie API
+// does not empty the load balancer.
+type Resolver struct {
+	providers map[models.DiscoveryType]Provider
+	mu        sync.Mutex
+	last      map[string][]models.Backend // keyed by the serialized query
+}
+
+// NewResolver creates a resolver answering queries with providers
+func NewResolver(providers map[models.DiscoveryType]Provider) *Resolver {
+	return &Resolver{
+		providers: providers,
+		last:      make(map[string][]models.Backend),
+	}
+}
+
+// Uses reports whether lb or one of its pools discovers backends
+func Uses(lb *models.LoadBalancer) bool {
+	if lb == nil {
+		return false
+	}
+	if lb.Discovery != nil {
+		return true
+	}
+	for i := range lb.Pools {
+		if lb.Pools[i].Discovery != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve adds the discovered backends to lb and its pools. A configured
+// backend takes precedence over a discovered one with the same address and
+// port. It fails only when a query has never been answered.
+func (r *Resolver) Resolve(ctx context.Context, lb *models.LoadBalancer) error {
+	if lb.Discovery != nil {
+		discovered, err := r.discover(ctx, lb.Discovery)
+		if err != nil {
+			return err
+		}
+		lb.Backends = merge(lb.Backends, discovered)
+	}
+	for i := range lb.Pools {
+		pool := &lb.Pools[i]
+		if pool.Discovery == nil {
+			continue
+		}
+		discovered, err := r.discover(ctx, pool.Discovery)
+		if err != nil {
+			return fmt.Errorf("pool %s: %w", pool.Name, err)
+		}
+		pool.Backends = merge(pool.Backends, discovered)
+	}
+	return nil
+}
+
+// discover answers query, falling back to the last successful answer
+func (r *Resolver) discover(ctx context.Context, query *models.Discovery) ([]models.Backend, error) {
+	key, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode discovery query: %w", err)
+	}
+
+	provider, ok := r.providers[query.Type]
+	if !ok {
+		return nil, fmt.Errorf("%s discovery is not available", query.Type)
+	}
+	found, err := provider.Discover(ctx, query)
+	if err != nil {
+		r.mu.Lock()
+		last, ok := r.last[string(key)]
+		r.mu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("%s discovery failed: %w", query.Type, err)
+		}
+		log.Printf("Warning: %s discovery failed, keeping %d previously discovered backends: %v", query.Type, len(last), err)
+		return last, nil
+	}
+
+	backends := make([]models.Backend, 0, len(found))
+	for _, backend := range found {
+		if query.Weight > 0 {
+			backend.Weight = query.Weight
+		}
+		if err = backend.Validate(); err != nil {
+			log.Printf("Warning: Ignoring discovered backend %s (%s:%d): %v", backend.ID, backend.Address, backend.Port, err)
+			continue
+		}
+		backends = append(backends, backend)
+	}
+	// Providers list instances in no particular order; sort them so an
+	// unchanged membership produces an unchanged configuration
+	sort.Slice(backends, func(i, j int) bool {
+		if backends[i].Address != backends[j].Address {
+			return backends[i].Address < backends[j].Address
+		}
+		return backends[i].Port < backends[j].Port
+	})
+
+	r.mu.Lock()
+	r.last[string(key)] = backends
+	r.mu.Unlock()
+	return backends, nil
+}
+
+// merge appends the discovered backends whose address and port are not
+// already configured
+func merge(configured, discovered []models.Backend) []models.Backend {
+	merged := make([]models.Backend, 0, len(configured)+len(discovered))
+	seen := make(map[string]bool, len(configured)+len(discovered))
+	for _, backend := range configured {
+		seen[hostPort(backend)] = true
+		merged = append(merged, backend)
+	}
+	for _, backend := range discovered {
+		if seen[hostPort(backend)] {
+			continue
+		}
+		seen[hostPort(backend)] = true
+		merged = append(merged, backend)
+	}
+	return merged
+}
+
+func hostPort(b models.Backend) string {
+	return net.JoinHostPort(b.Address, strconv.Itoa(b.Port))
+}
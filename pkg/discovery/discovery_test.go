@@ -0,0 +1,101 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// fakeProvider answers every query with backends, or err when set
+type fakeProvider struct {
+	backends []models.Backend
+	err      error
+}
+
+func (p *fakeProvider) Discover(context.Context, *models.Discovery) ([]models.Backend, error) {
+	return p.backends, p.err
+}
+
+func addresses(backends []models.Backend) []string {
+	var out []string
+	for _, b := range backends {
+		out = append(out, b.Address)
+	}
+	return out
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	provider := &fakeProvider{backends: []models.Backend{
+		{ID: "consul-b", Address: "10.0.0.3", Port: 8080, Enabled: true},
+		{ID: "consul-a", Address: "10.0.0.2", Port: 8080, Enabled: true},
+		{ID: "consul-dup", Address: "10.0.0.1", Port: 8080, Enabled: true},
+		{ID: "consul-bad", Address: "", Port: 8080, Enabled: true},
+	}}
+	resolver := NewResolver(map[models.DiscoveryType]Provider{models.DiscoveryConsul: provider})
+
+	lb := &models.LoadBalancer{
+		Backends:  []models.Backend{{ID: "static", Address: "10.0.0.1", Port: 8080, Weight: 10, Enabled: true}},
+		Discovery: &models.Discovery{Type: models.DiscoveryConsul, Service: "web", Weight: 5},
+		Pools: []models.BackendPool{
+			{Name: "api", Discovery: &models.Discovery{Type: models.DiscoveryConsul, Service: "api"}},
+			{Name: "static", Backends: []models.Backend{{ID: "s", Address: "10.0.1.1", Port: 80, Enabled: true}}},
+		},
+	}
+	if err := resolver.Resolve(context.Background(), lb); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	// Configured backends come first and win over discovered duplicates
+	if got, want := addresses(lb.Backends), []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Backends = %v, want %v", got, want)
+	}
+	if lb.Backends[0].ID != "static" || lb.Backends[0].Weight != 10 || lb.Backends[1].Weight != 5 {
+		t.Errorf("Backends = %+v, want the configured backend kept and weight 5 on discovered ones", lb.Backends)
+	}
+	if got := addresses(lb.Pools[0].Backends); len(got) != 3 {
+		t.Errorf("pool api backends = %v, want the 3 valid discovered ones", got)
+	}
+	if got := addresses(lb.Pools[1].Backends); !reflect.DeepEqual(got, []string{"10.0.1.1"}) {
+		t.Errorf("pool static backends = %v, want it unchanged", got)
+	}
+}
+
+func TestResolver_Resolve_ProviderFailure(t *testing.T) {
+	provider := &fakeProvider{err: errors.New("connection refused")}
+	resolver := NewResolver(map[models.DiscoveryType]Provider{models.DiscoveryConsul: provider})
+	newLB := func() *models.LoadBalancer {
+		return &models.LoadBalancer{Discovery: &models.Discovery{Type: models.DiscoveryConsul, Service: "web"}}
+	}
+
+	// Without an earlier answer there is nothing to fall back to
+	if err := resolver.Resolve(context.Background(), newLB()); err == nil {
+		t.Fatal("Resolve() error = nil, want the provider failure")
+	}
+
+	provider.err = nil
+	provider.backends = []models.Backend{{ID: "consul-a", Address: "10.0.0.2", Port: 8080, Enabled: true}}
+	if err := resolver.Resolve(context.Background(), newLB()); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	// Later failures keep the last discovered backends
+	provider.err = errors.New("connection refused")
+	lb := newLB()
+	if err := resolver.Resolve(context.Background(), lb); err != nil {
+		t.Fatalf("Resolve() error = %v, want the cached answer", err)
+	}
+	if got := addresses(lb.Backends); !reflect.DeepEqual(got, []string{"10.0.0.2"}) {
+		t.Errorf("Backends = %v, want the cached [10.0.0.2]", got)
+	}
+}
+
+func TestResolver_Resolve_UnavailableProvider(t *testing.T) {
+	resolver := NewResolver(nil)
+	lb := &models.LoadBalancer{Discovery: &models.Discovery{Type: models.DiscoveryVPSieTag, Tag: "web", Port: 80}}
+	if err := resolver.Resolve(context.Background(), lb); err == nil {
+		t.Error("Resolve() error = nil, want vpsie_tag discovery to be unavailable")
+	}
+}
@@ -0,0 +1,233 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/events"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// DefaultPinInterval is how often pinned hostnames are resolved again when
+// dns.refresh_rate is not set
+const DefaultPinInterval = 30 * time.Second
+
+// Lookup resolves a hostname to its addresses
+type Lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+// Pinner resolves backend hostnames when the Envoy configuration is
+// generated and pins their addresses in the clusters, for load balancers
+// with dns.pin. Envoy then never resolves them itself. Hostnames are resolved
+// again every refresh interval; a changed answer is reported and applied with
+// a sync.
+type Pinner struct {
+	lookup   Lookup
+	events   events.Func // reports changed addresses of a pinned hostname
+	changed  func()      // called when a pinned hostname resolves differently
+	mu       sync.Mutex
+	hosts    map[string][]string // sorted addresses of each pinned hostname
+	interval time.Duration       // of the last applied configuration
+}
+
+// NewPinner creates a pinner resolving hostnames with lookup
+func NewPinner(lookup Lookup, onEvent events.Func, changed func()) *Pinner {
+	return &Pinner{
+		lookup:  lookup,
+		events:  onEvent,
+		changed: changed,
+		hosts:   make(map[string][]string),
+	}
+}
+
+// Pins reports whether lb pins the addresses of its backend hostnames
+func Pins(lb *models.LoadBalancer) bool {
+	return lb != nil && lb.DNS != nil && lb.DNS.Pin
+}
+
+// Apply replaces every enabled hostname backend of lb and its pools with one
+// backend per pinned address, when lb pins hostnames. A hostname is looked up
+// the first time it is seen; after that its last answer is used until
+// Refresh finds another. It fails when a new hostname cannot be resolved.
+func (p *Pinner) Apply(ctx context.Context, lb *models.LoadBalancer) error {
+	used := make(map[string]bool)
+	if Pins(lb) {
+		backends, err := p.pin(ctx, lb.Backends, used)
+		if err != nil {
+			return err
+		}
+		lb.Backends = backends
+		for i := range lb.Pools {
+			pool := &lb.Pools[i]
+			if pool.Backends, err = p.pin(ctx, pool.Backends, used); err != nil {
+				return fmt.Errorf("pool %s: %w", pool.Name, err)
+			}
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for host := range p.hosts {
+		if !used[host] {
+			delete(p.hosts, host)
+		}
+	}
+	p.interval = DefaultPinInterval
+	if Pins(lb) && lb.DNS.RefreshRate > 0 {
+		p.interval = time.Duration(lb.DNS.RefreshRate) * time.Second
+	}
+	return nil
+}
+
+// pin returns backends with their enabled hostnames replaced by their
+// addresses, and marks the hostnames as used
+func (p *Pinner) pin(ctx context.Context, backends []models.Backend, used map[string]bool) ([]models.Backend, error) {
+	pinned := make([]models.Backend, 0, len(backends))
+	for _, backend := range backends {
+		if !backend.Enabled || net.ParseIP(backend.Address) != nil {
+			pinned = append(pinned, backend)
+			continue
+		}
+		used[backend.Address] = true
+		addresses, err := p.addresses(ctx, backend.Address)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range selectFamily(addresses, backend.DiscoverAll) {
+			b := backend
+			b.Address = address
+			b.DiscoverAll = false
+			pinned = append(pinned, b)
+		}
+	}
+	return pinned, nil
+}
+
+// addresses returns the pinned addresses of host, looking it up when it is
+// not pinned yet
+func (p *Pinner) addresses(ctx context.Context, host string) ([]string, error) {
+	p.mu.Lock()
+	addresses, ok := p.hosts[host]
+	p.mu.Unlock()
+	if ok {
+		return addresses, nil
+	}
+
+	addresses, err := p.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.hosts[host] = addresses
+	p.mu.Unlock()
+	return addresses, nil
+}
+
+// resolve looks up host and returns its addresses sorted
+func (p *Pinner) resolve(ctx context.Context, host string) ([]string, error) {
+	found, err := p.lookup(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve backend hostname %s: %w", host, err)
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("backend hostname %s has no addresses", host)
+	}
+	addresses := make([]string, 0, len(found))
+	for _, addr := range found {
+		addresses = append(addresses, addr.IP.String())
+	}
+	slices.Sort(addresses)
+	return slices.Compact(addresses), nil
+}
+
+// selectFamily returns every address for discover_all backends. Others get
+// the IPv4 addresses, or the IPv6 ones when there are none, as Envoy resolves
+// hostnames by default.
+func selectFamily(addresses []string, all bool) []string {
+	if all {
+		return addresses
+	}
+	var v4, v6 []string
+	for _, address := range addresses {
+		if net.ParseIP(address).To4() != nil {
+			v4 = append(v4, address)
+		} else {
+			v6 = append(v6, address)
+		}
+	}
+	if len(v4) > 0 {
+		return v4
+	}
+	return v6
+}
+
+// Refresh resolves every pinned hostname again. Changed answers are reported
+// and applied; a failed lookup keeps the last answer.
+func (p *Pinner) Refresh(ctx context.Context) {
+	p.mu.Lock()
+	hosts := make([]string, 0, len(p.hosts))
+	for host := range p.hosts {
+		hosts = append(hosts, host)
+	}
+	p.mu.Unlock()
+	slices.Sort(hosts)
+
+	changed := false
+	for _, host := range hosts {
+		addresses, err := p.resolve(ctx, host)
+		if err != nil {
+			log.Printf("Warning: Keeping the pinned addresses of %s: %v", host, err)
+			continue
+		}
+		p.mu.Lock()
+		previous, ok := p.hosts[host]
+		if ok {
+			p.hosts[host] = addresses
+		}
+		p.mu.Unlock()
+		if !ok || slices.Equal(previous, addresses) {
+			continue
+		}
+
+		changed = true
+		message := fmt.Sprintf("Backend hostname %s now resolves to %s (was %s)", host, strings.Join(addresses, ", "), strings.Join(previous, ", "))
+		log.Print(message)
+		p.events(ctx, events.BackendDNSChanged, message, map[string]interface{}{
+			"hostname":  host,
+			"addresses": addresses,
+			"previous":  previous,
+		})
+	}
+	if changed {
+		p.changed()
+	}
+}
+
+// Run resolves the pinned hostnames again every refresh interval until ctx
+// is cancelled
+func (p *Pinner) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.refreshInterval()):
+			p.Refresh(ctx)
+		}
+	}
+}
+
+// refreshInterval returns the refresh interval of the last applied
+// configuration
+func (p *Pinner) refreshInterval() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.interval == 0 {
+		return DefaultPinInterval
+	}
+	return p.interval
+}
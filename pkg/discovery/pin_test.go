@@ -0,0 +1,143 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/events"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// fakeDNS answers lookups from records, or fails for hosts in failing
+type fakeDNS struct {
+	records map[string][]string
+	failing map[string]bool
+	lookups int
+}
+
+func (d *fakeDNS) lookup(_ context.Context, host string) ([]net.IPAddr, error) {
+	d.lookups++
+	if d.failing[host] {
+		return nil, errors.New("no such host")
+	}
+	var addrs []net.IPAddr
+	for _, address := range d.records[host] {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(address)})
+	}
+	return addrs, nil
+}
+
+func pinnedLB() *models.LoadBalancer {
+	return &models.LoadBalancer{
+		DNS: &models.DNSDiscovery{Pin: true, RefreshRate: 60},
+		Backends: []models.Backend{
+			{ID: "static", Address: "10.0.0.1", Port: 80, Enabled: true},
+			{ID: "web", Address: "web.internal", Port: 8080, Weight: 5, Enabled: true},
+			{ID: "off", Address: "off.internal", Port: 8080},
+		},
+		Pools: []models.BackendPool{{Name: "api", Backends: []models.Backend{
+			{ID: "api", Address: "api.internal", Port: 9000, DiscoverAll: true, Enabled: true},
+		}}},
+	}
+}
+
+func TestPinner_Apply(t *testing.T) {
+	dns := &fakeDNS{records: map[string][]string{
+		"web.internal": {"10.0.1.2", "fd00::1", "10.0.1.1", "10.0.1.2"},
+		"api.internal": {"fd00::2", "10.0.2.1"},
+	}}
+	p := NewPinner(dns.lookup, func(context.Context, events.Type, string, map[string]interface{}) {}, func() {})
+
+	lb := pinnedLB()
+	if err := p.Apply(context.Background(), lb); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	// IPv4 only, sorted and without duplicates; every address of discover_all
+	if got, want := addresses(lb.Backends), []string{"10.0.0.1", "10.0.1.1", "10.0.1.2", "off.internal"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backends = %v, want %v", got, want)
+	}
+	if b := lb.Backends[2]; b.ID != "web" || b.Port != 8080 || b.Weight != 5 {
+		t.Errorf("pinned backend = %+v, want the settings of web", b)
+	}
+	if got, want := addresses(lb.Pools[0].Backends), []string{"10.0.2.1", "fd00::2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pool backends = %v, want %v", got, want)
+	}
+	if lb.Pools[0].Backends[0].DiscoverAll {
+		t.Error("a pinned address still discovers all addresses")
+	}
+	if p.refreshInterval() != time.Minute {
+		t.Errorf("refreshInterval() = %s, want dns.refresh_rate", p.refreshInterval())
+	}
+
+	// Pinned answers are used until Refresh
+	dns.records["web.internal"] = []string{"10.0.1.9"}
+	lookups := dns.lookups
+	if err := p.Apply(context.Background(), pinnedLB()); err != nil || dns.lookups != lookups {
+		t.Errorf("Apply() = %v after %d lookups, want the pinned answers", err, dns.lookups-lookups)
+	}
+
+	// Without pin, backends are left to Envoy and the pins forgotten
+	lb, want := pinnedLB(), pinnedLB()
+	lb.DNS.Pin, want.DNS.Pin = false, false
+	if err := p.Apply(context.Background(), lb); err != nil || !reflect.DeepEqual(lb, want) {
+		t.Errorf("Apply() without pin = %v, backends %v", err, addresses(lb.Backends))
+	}
+	if len(p.hosts) != 0 || p.refreshInterval() != DefaultPinInterval {
+		t.Errorf("pins = %v, interval %s after pinning was turned off", p.hosts, p.refreshInterval())
+	}
+
+	// A hostname that never resolved fails the sync
+	dns.failing = map[string]bool{"api.internal": true}
+	if err := p.Apply(context.Background(), pinnedLB()); err == nil {
+		t.Error("Apply() with an unresolvable hostname succeeded")
+	}
+}
+
+func TestPinner_Refresh(t *testing.T) {
+	dns := &fakeDNS{records: map[string][]string{
+		"web.internal": {"10.0.1.1"},
+		"api.internal": {"10.0.2.1"},
+	}}
+	var reported []map[string]interface{}
+	changes := 0
+	p := NewPinner(dns.lookup, func(_ context.Context, eventType events.Type, _ string, metadata map[string]interface{}) {
+		if eventType != events.BackendDNSChanged {
+			t.Errorf("event type = %s, want backend_dns_changed", eventType)
+		}
+		reported = append(reported, metadata)
+	}, func() { changes++ })
+	if err := p.Apply(context.Background(), pinnedLB()); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	p.Refresh(context.Background())
+	if len(reported) != 0 || changes != 0 {
+		t.Fatalf("events = %v after %d changes, want none for unchanged answers", reported, changes)
+	}
+
+	// A failed lookup keeps the pin; a changed answer is reported and applied
+	dns.failing = map[string]bool{"api.internal": true}
+	dns.records["web.internal"] = []string{"10.0.1.2", "10.0.1.1"}
+	p.Refresh(context.Background())
+	if len(reported) != 1 || reported[0]["hostname"] != "web.internal" || changes != 1 {
+		t.Fatalf("events = %v after %d changes, want web.internal changed once", reported, changes)
+	}
+	if got := reported[0]["addresses"]; !reflect.DeepEqual(got, []string{"10.0.1.1", "10.0.1.2"}) {
+		t.Errorf("addresses = %v, want both", got)
+	}
+
+	lb := pinnedLB()
+	if err := p.Apply(context.Background(), lb); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if got, want := addresses(lb.Backends), []string{"10.0.0.1", "10.0.1.1", "10.0.1.2", "off.internal"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backends = %v, want %v", got, want)
+	}
+	if got := addresses(lb.Pools[0].Backends); !reflect.DeepEqual(got, []string{"10.0.2.1"}) {
+		t.Errorf("pool backends = %v, want the last answer for api.internal", got)
+	}
+}
@@ -0,0 +1,18 @@
+package envoy
+
+// AccessLogServiceCluster is the cluster Envoy streams access logs to the
+// agent's gRPC access log service through
+const AccessLogServiceCluster = "access_log_service"
+
+// SetAccessLogService streams the access logs of HTTP listeners to the gRPC
+// access log service at address (host:port), in addition to the access log
+// file. An empty address disables streaming.
+func (g *Generator) SetAccessLogService(address string) {
+	g.accessLogService = address
+}
+
+// accessLogServiceData is the gRPC access logger of an HTTP listener
+type accessLogServiceData struct {
+	ClusterName string
+	LogName     string // identifies the listener in the log stream
+}
@@ -0,0 +1,156 @@
+package envoy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Envoy server states reported by /server_info
+const (
+	ServerStateLive            = "LIVE"
+	ServerStateDraining        = "DRAINING"
+	ServerStatePreInitializing = "PRE_INITIALIZING"
+	ServerStateInitializing    = "INITIALIZING"
+)
+
+// AdminClient queries the Envoy admin interface
+type AdminClient struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+// NewAdminClient creates a client for the Envoy admin interface at adminAddress (host:port)
+func NewAdminClient(adminAddress string) *AdminClient {
+	return &AdminClient{
+		baseURL:    "http://" + adminAddress,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// ServerInfo describes the running Envoy process
+type ServerInfo struct {
+	Version            string
+	State              string
+	HotRestartVersion  string
+	RestartEpoch       int
+	UptimeCurrentEpoch time.Duration
+	UptimeAllEpochs    time.Duration
+}
+
+// serverInfoResponse is the subset of GET /server_info used here. Durations
+// are protobuf JSON strings such as "3600s".
+type serverInfoResponse struct {
+	Version            string `json:"version"`
+	State              string `json:"state"`
+	HotRestartVersion  string `json:"hot_restart_version"`
+	UptimeCurrentEpoch string `json:"uptime_current_epoch"`
+	UptimeAllEpochs    string `json:"uptime_all_epochs"`
+	CommandLineOptions struct {
+		RestartEpoch json.Number `json:"restart_epoch"`
+	} `json:"command_line_options"`
+}
+
+// ServerInfo returns the version, state, restart epoch and uptime of the running Envoy
+func (c *AdminClient) ServerInfo(ctx context.Context) (*ServerInfo, error) {
+	var body serverInfoResponse
+	if err := c.getJSON(ctx, "/server_info", &body); err != nil {
+		return nil, fmt.Errorf("failed to query Envoy server info: %w", err)
+	}
+
+	info := &ServerInfo{
+		Version:           body.Version,
+		State:             body.State,
+		HotRestartVersion: body.HotRestartVersion,
+	}
+	if body.CommandLineOptions.RestartEpoch != "" {
+		epoch, err := strconv.Atoi(body.CommandLineOptions.RestartEpoch.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid restart epoch %q: %w", body.CommandLineOptions.RestartEpoch, err)
+		}
+		info.RestartEpoch = epoch
+	}
+	// Uptimes are informational; unparseable values are left at zero
+	info.UptimeCurrentEpoch, _ = time.ParseDuration(body.UptimeCurrentEpoch)
+	info.UptimeAllEpochs, _ = time.ParseDuration(body.UptimeAllEpochs)
+	return info, nil
+}
+
+// DrainListeners gracefully drains all listeners: Envoy stops accepting
+// connections and asks HTTP clients to close theirs
+func (c *AdminClient) DrainListeners(ctx context.Context) error {
+	return c.post(ctx, "/drain_listeners?graceful")
+}
+
+// Quit asks Envoy to exit
+func (c *AdminClient) Quit(ctx context.Context) error {
+	return c.post(ctx, "/quitquitquit")
+}
+
+// Get sends a GET request for path with query to the admin interface and
+// returns the response as is. The caller closes the body.
+func (c *AdminClient) Get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	reqURL := c.baseURL + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	return c.httpClient.Do(req)
+}
+
+// post sends a POST request without body to the admin interface
+func (c *AdminClient) post(ctx context.Context, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("envoy admin returned status %d for %s", resp.StatusCode, path)
+	}
+	return nil
+}
+
+// getJSON fetches path from the admin interface and decodes the JSON response into v
+func (c *AdminClient) getJSON(ctx context.Context, path string, v interface{}) error {
+	return c.getJSONLimit(ctx, path, v, 1<<20)
+}
+
+// getJSONLimit is getJSON for responses of up to limit bytes
+func (c *AdminClient) getJSONLimit(ctx context.Context, path string, v interface{}, limit int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("envoy admin returned status %d", resp.StatusCode)
+	}
+
+	if err = json.NewDecoder(io.LimitReader(resp.Body, limit)).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package envoy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminClient_ServerInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/server_info" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{
+			"version": "abc/1.31.0/Clean/RELEASE/BoringSSL",
+			"state": "LIVE",
+			"hot_restart_version": "11.104",
+			"command_line_options": {"restart_epoch": 5, "concurrency": 2},
+			"uptime_current_epoch": "90s",
+			"uptime_all_epochs": "7200.500s"
+		}`))
+	}))
+	defer server.Close()
+
+	info, err := NewAdminClient(strings.TrimPrefix(server.URL, "http://")).ServerInfo(context.Background())
+	if err != nil {
+		t.Fatalf("ServerInfo() error = %v", err)
+	}
+	want := ServerInfo{
+		Version:            "abc/1.31.0/Clean/RELEASE/BoringSSL",
+		State:              ServerStateLive,
+		HotRestartVersion:  "11.104",
+		RestartEpoch:       5,
+		UptimeCurrentEpoch: 90 * time.Second,
+		UptimeAllEpochs:    7200500 * time.Millisecond,
+	}
+	if *info != want {
+		t.Errorf("ServerInfo() = %+v, want %+v", *info, want)
+	}
+}
+
+func TestAdminClient_DrainAndQuit(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		if r.URL.Path == "/quitquitquit" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	client := NewAdminClient(strings.TrimPrefix(server.URL, "http://"))
+	if err := client.DrainListeners(context.Background()); err != nil {
+		t.Errorf("DrainListeners() error = %v", err)
+	}
+	if err := client.Quit(context.Background()); err == nil || !strings.Contains(err.Error(), "405") {
+		t.Errorf("Quit() error = %v, want status 405", err)
+	}
+
+	want := []string{"POST /drain_listeners?graceful", "POST /quitquitquit"}
+	if strings.Join(requests, ",") != strings.Join(want, ",") {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
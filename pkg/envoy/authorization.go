@@ -0,0 +1,85 @@
+package envoy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// defaultAuthorizationTimeoutMs bounds an authorization check when the load
+// balancer sets no timeout, matching Envoy's default
+const defaultAuthorizationTimeoutMs = 200
+
+// authorizationData is the external authorization filter of an HTTP listener
+type authorizationData struct {
+	Protocol        string
+	ClusterName     string // the authorization service cluster
+	URI             string // http only
+	PathPrefix      string // http only
+	Timeout         string
+	FailOpen        bool     // pass requests unauthorized when the service fails
+	RequestHeaders  []string // http only, lower case
+	UpstreamHeaders []string // http only, lower case
+}
+
+// authorizationClusterName returns the name of the authorization service
+// cluster of a load balancer
+func authorizationClusterName(lb *models.LoadBalancer) string {
+	return fmt.Sprintf("authz_%s", lb.ID)
+}
+
+// newAuthorizationData prepares the external authorization filter, applying
+// defaults
+func newAuthorizationData(lb *models.LoadBalancer) *authorizationData {
+	a := lb.Authorization
+	timeoutMs := a.TimeoutMs
+	if timeoutMs == 0 {
+		timeoutMs = defaultAuthorizationTimeoutMs
+	}
+	data := &authorizationData{
+		Protocol:    string(a.Protocol),
+		ClusterName: authorizationClusterName(lb),
+		Timeout:     fmt.Sprintf("%.3fs", float64(timeoutMs)/1000),
+		FailOpen:    a.FailureMode == models.AuthorizationFailOpen,
+	}
+	if a.Protocol == models.AuthorizationHTTP {
+		data.URI = "http://" + a.Service
+		data.PathPrefix = a.PathPrefix
+		data.RequestHeaders = lowerHeaders(a.RequestHeaders)
+		data.UpstreamHeaders = lowerHeaders(a.UpstreamHeaders)
+	}
+	return data
+}
+
+// lowerHeaders returns header names in the lower case Envoy matches them in
+func lowerHeaders(names []string) []string {
+	if len(names) == 0 {
+		return nil
+	}
+	lower := make([]string, len(names))
+	for i, name := range names {
+		lower[i] = strings.ToLower(name)
+	}
+	return lower
+}
+
+// newAuthorizationClusterData prepares the cluster of the authorization
+// service. The gRPC API needs HTTP/2.
+func newAuthorizationClusterData(lb *models.LoadBalancer) (*clusterData, error) {
+	host, port := lb.Authorization.ServiceAddress()
+	if err := validateAddress(host); err != nil {
+		return nil, fmt.Errorf("invalid authorization service: %w", err)
+	}
+	data := &clusterData{
+		Name:              authorizationClusterName(lb),
+		ConnectTimeout:    defaultConnectTimeout,
+		Type:              "STRICT_DNS",
+		LoadBalancingAlgo: string(models.AlgoRoundRobin),
+		Localities:        []localityData{{Endpoints: []endpointData{{Address: host, Port: port}}}},
+	}
+	if lb.Authorization.Protocol == models.AuthorizationGRPC {
+		data.ProtocolOptions = &protocolOptionsData{HTTP2: true}
+	}
+	return data, nil
+}
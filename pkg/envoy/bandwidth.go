@@ -0,0 +1,44 @@
+package envoy
+
+import "github.com/vpsie/vpsie-loadbalancer/pkg/models"
+
+// Bandwidth limit filter directions
+const (
+	bandwidthIngress = "REQUEST"
+	bandwidthEgress  = "RESPONSE"
+)
+
+// bandwidthLimitData is one direction of an HTTP listener's bandwidth limit.
+// Envoy keeps one token bucket per filter, shared by all streams of the
+// listener, so each direction gets a filter of its own.
+type bandwidthLimitData struct {
+	Name       string // HTTP filter name
+	StatPrefix string
+	Mode       string // REQUEST or RESPONSE
+	KiBps      int64
+}
+
+// newBandwidthLimitsData prepares the ingress and egress limits of lb
+func newBandwidthLimitsData(lb *models.LoadBalancer, statPrefix string) []bandwidthLimitData {
+	var limits []bandwidthLimitData
+	directions := []struct {
+		name  string
+		mode  string
+		limit int64
+	}{
+		{"ingress", bandwidthIngress, lb.BandwidthLimit.IngressBytesPerSecond},
+		{"egress", bandwidthEgress, lb.BandwidthLimit.EgressBytesPerSecond},
+	}
+	for _, d := range directions {
+		if d.limit == 0 {
+			continue
+		}
+		limits = append(limits, bandwidthLimitData{
+			Name:       "bandwidth_limit_" + d.name,
+			StatPrefix: statPrefix + "_bandwidth_" + d.name,
+			Mode:       d.mode,
+			KiBps:      models.KiBPerSecond(d.limit),
+		})
+	}
+	return limits
+}
@@ -0,0 +1,59 @@
+package envoy
+
+import (
+	"sort"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// basicAuthData is the credentials a route requires
+type basicAuthData struct {
+	Users []string // htpasswd entries
+	File  string   // htpasswd file; replaces Users
+}
+
+// routeAccessData restricts a route to clients presenting the required token
+// claims from the allowed address ranges. Both must match.
+type routeAccessData struct {
+	Claims []jwtClaimData // ordered by name
+	CIDRs  []cidrData
+}
+
+// newBasicAuthData returns the credentials route requires, or nil
+func newBasicAuthData(route *models.Route) *basicAuthData {
+	if route.BasicAuth == nil {
+		return nil
+	}
+	return &basicAuthData{Users: route.BasicAuth.Users, File: route.BasicAuth.UsersFile}
+}
+
+// newRouteAccessData returns the client restrictions of route, or nil when
+// any client may use it
+func newRouteAccessData(lb *models.LoadBalancer, route *models.Route) *routeAccessData {
+	data := &routeAccessData{CIDRs: newCIDRData(route.AllowedCIDRs)}
+	if lb.JWTAuth != nil && route.JWT != nil && !route.JWT.Disabled {
+		for name, value := range route.JWT.RequiredClaims {
+			data.Claims = append(data.Claims, jwtClaimData{Name: name, Value: value})
+		}
+		sort.Slice(data.Claims, func(i, j int) bool { return data.Claims[i].Name < data.Claims[j].Name })
+	}
+	if len(data.Claims) == 0 && len(data.CIDRs) == 0 {
+		return nil
+	}
+	return data
+}
+
+// routeFilters reports whether any route needs the RBAC filter for client
+// restrictions or the basic auth filter for credentials
+func routeFilters(lb *models.LoadBalancer) (rbac, basicAuth bool) {
+	for i := range lb.Routes {
+		route := &lb.Routes[i]
+		if newRouteAccessData(lb, route) != nil {
+			rbac = true
+		}
+		if route.BasicAuth != nil {
+			basicAuth = true
+		}
+	}
+	return rbac, basicAuth
+}
@@ -0,0 +1,1733 @@
+package envoy
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+// The structured builders turn the prepared configuration into typed Envoy
+// API resources and marshal them, so values never have to be escaped by hand.
+
+const (
+	typeConnectionLimit       = "type.googleapis.com/envoy.extensions.filters.network.connection_limit.v3.ConnectionLimit"
+	typeNetworkLocalRateLimit = "type.googleapis.com/envoy.extensions.filters.network.local_ratelimit.v3.LocalRateLimit"
+	typeMySQLProxy            = "type.googleapis.com/envoy.extensions.filters.network.mysql_proxy.v3.MySQLProxy"
+	typePostgresProxy         = "type.googleapis.com/envoy.extensions.filters.network.postgres_proxy.v3alpha.PostgresProxy"
+	typeRedisProxy            = "type.googleapis.com/envoy.extensions.filters.network.redis_proxy.v3.RedisProxy"
+	typeRedisHealthCheck      = "type.googleapis.com/envoy.extensions.health_checkers.redis.v3.Redis"
+	typeTLSInspector          = "type.googleapis.com/envoy.extensions.filters.listener.tls_inspector.v3.TlsInspector"
+	typeHTTPConnectionManager = "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager"
+	typeTCPProxy              = "type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy"
+	typeOriginalSrc           = "type.googleapis.com/envoy.extensions.filters.listener.original_src.v3.OriginalSrc"
+	typeXffConfig             = "type.googleapis.com/envoy.extensions.http.original_ip_detection.xff.v3.XffConfig"
+	typeFileAccessLog         = "type.googleapis.com/envoy.extensions.access_loggers.file.v3.FileAccessLog"
+	typeHTTPGrpcAccessLog     = "type.googleapis.com/envoy.extensions.access_loggers.grpc.v3.HttpGrpcAccessLogConfig"
+	typeAdaptiveConcurrency   = "type.googleapis.com/envoy.extensions.filters.http.adaptive_concurrency.v3.AdaptiveConcurrency"
+	typeAdmissionControl      = "type.googleapis.com/envoy.extensions.filters.http.admission_control.v3.AdmissionControl"
+	typeBandwidthLimit        = "type.googleapis.com/envoy.extensions.filters.http.bandwidth_limit.v3.BandwidthLimit"
+	typeRouter                = "type.googleapis.com/envoy.extensions.filters.http.router.v3.Router"
+	typeExternalProcessor     = "type.googleapis.com/envoy.extensions.filters.http.ext_proc.v3.ExternalProcessor"
+	typeExtAuthz              = "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthz"
+	typeJWTAuthentication     = "type.googleapis.com/envoy.extensions.filters.http.jwt_authn.v3.JwtAuthentication"
+	typeJWTPerRoute           = "type.googleapis.com/envoy.extensions.filters.http.jwt_authn.v3.PerRouteConfig"
+	typeRBAC                  = "type.googleapis.com/envoy.extensions.filters.http.rbac.v3.RBAC"
+	typeRBACPerRoute          = "type.googleapis.com/envoy.extensions.filters.http.rbac.v3.RBACPerRoute"
+	typeBasicAuth             = "type.googleapis.com/envoy.extensions.filters.http.basic_auth.v3.BasicAuth"
+	typeBasicAuthPerRoute     = "type.googleapis.com/envoy.extensions.filters.http.basic_auth.v3.BasicAuthPerRoute"
+	typeHTTPFault             = "type.googleapis.com/envoy.extensions.filters.http.fault.v3.HTTPFault"
+	typeLua                   = "type.googleapis.com/envoy.extensions.filters.http.lua.v3.Lua"
+	typeWasm                  = "type.googleapis.com/envoy.extensions.filters.http.wasm.v3.Wasm"
+	typeStringValue           = "type.googleapis.com/google.protobuf.StringValue"
+	typeUpstreamTLSContext    = "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext"
+	typeDownstreamTLSContext  = "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.DownstreamTlsContext"
+	typeHTTPProtocolOptions   = "type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions"
+	typeDownstreamConnections = "type.googleapis.com/envoy.extensions.resource_monitors.downstream_connections.v3.DownstreamConnectionsConfig"
+	typeFixedHeap             = "type.googleapis.com/envoy.extensions.resource_monitors.fixed_heap.v3.FixedHeapConfig"
+	typeOpenTelemetryConfig   = "type.googleapis.com/envoy.config.trace.v3.OpenTelemetryConfig"
+	typeZipkinConfig          = "type.googleapis.com/envoy.config.trace.v3.ZipkinConfig"
+
+	// httpProtocolOptionsExtension is the typed_extension_protocol_options key
+	// of the upstream HTTP protocol options
+	httpProtocolOptionsExtension = "envoy.extensions.upstreams.http.v3.HttpProtocolOptions"
+
+	fixedHeapMonitor = "envoy.resource_monitors.fixed_heap"
+
+	jwtAuthnFilter  = "envoy.filters.http.jwt_authn"
+	rbacFilter      = "envoy.filters.http.rbac"
+	basicAuthFilter = "envoy.filters.http.basic_auth"
+)
+
+// lbPolicies maps load balancing algorithms to Envoy cluster lb_policy values
+var lbPolicies = map[string]string{
+	string(models.AlgoRoundRobin):   "ROUND_ROBIN",
+	string(models.AlgoLeastRequest): "LEAST_REQUEST",
+	string(models.AlgoRandom):       "RANDOM",
+	string(models.AlgoRingHash):     "RING_HASH",
+}
+
+// tlsVersions maps TLS versions to Envoy TLS protocol values
+var tlsVersions = map[string]string{
+	"TLSv1.2": "TLSv1_2",
+	"TLSv1.3": "TLSv1_3",
+}
+
+// marshalYAML encodes v with the two-space indentation used in the Envoy docs
+func marshalYAML(v interface{}) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+// seconds formats a duration in seconds as an Envoy duration
+func seconds(s int) string {
+	return strconv.Itoa(s) + "s"
+}
+
+// quoted is a string written double-quoted, as Envoy's docs write command
+// operators such as %START_TIME%
+type quoted string
+
+// MarshalYAML implements yaml.Marshaler
+func (q quoted) MarshalYAML() (interface{}, error) {
+	return &yaml.Node{Kind: yaml.ScalarNode, Style: yaml.DoubleQuotedStyle, Value: string(q)}, nil
+}
+
+// Shared resources
+
+type typedConfig struct {
+	Type string `yaml:"@type"`
+}
+
+type namedConfig struct {
+	Name        string      `yaml:"name"`
+	Disabled    bool        `yaml:"disabled,omitempty"` // HTTP filters enabled by per-route config only
+	TypedConfig interface{} `yaml:"typed_config,omitempty"`
+}
+
+type address struct {
+	SocketAddress socketAddress `yaml:"socket_address"`
+}
+
+type socketAddress struct {
+	Address   string `yaml:"address"`
+	PortValue int    `yaml:"port_value"`
+}
+
+type dataSource struct {
+	Filename     string `yaml:"filename,omitempty"`
+	InlineString string `yaml:"inline_string,omitempty"`
+}
+
+type percent struct {
+	Value float64 `yaml:"value"`
+}
+
+type fileAccessLog struct {
+	Type      string     `yaml:"@type"`
+	Path      string     `yaml:"path"`
+	LogFormat *logFormat `yaml:"log_format,omitempty"`
+}
+
+type logFormat struct {
+	JSONFormat interface{} `yaml:"json_format"`
+}
+
+type httpAccessLogFormat struct {
+	Timestamp               quoted `yaml:"timestamp"`
+	DurationMs              quoted `yaml:"duration_ms"`
+	Method                  quoted `yaml:"method"`
+	Path                    quoted `yaml:"path"`
+	Protocol                quoted `yaml:"protocol"`
+	ResponseCode            quoted `yaml:"response_code"`
+	ResponseFlags           quoted `yaml:"response_flags"`
+	BytesReceived           quoted `yaml:"bytes_received"`
+	BytesSent               quoted `yaml:"bytes_sent"`
+	DownstreamRemoteAddress quoted `yaml:"downstream_remote_address"`
+	UpstreamHost            quoted `yaml:"upstream_host"`
+	RequestID               quoted `yaml:"request_id"`
+}
+
+type tcpAccessLogFormat struct {
+	Timestamp               quoted `yaml:"timestamp"`
+	DurationMs              quoted `yaml:"duration_ms"`
+	BytesReceived           quoted `yaml:"bytes_received"`
+	BytesSent               quoted `yaml:"bytes_sent"`
+	ResponseFlags           quoted `yaml:"response_flags"`
+	DownstreamRemoteAddress quoted `yaml:"downstream_remote_address"`
+	UpstreamHost            quoted `yaml:"upstream_host"`
+}
+
+// accessLog is a file access log with the given JSON format, or the default
+// format when format is nil
+func accessLog(path string, format interface{}) []namedConfig {
+	config := fileAccessLog{Type: typeFileAccessLog, Path: path}
+	if format != nil {
+		config.LogFormat = &logFormat{JSONFormat: format}
+	}
+	return []namedConfig{{Name: "envoy.access_loggers.file", TypedConfig: config}}
+}
+
+type httpGrpcAccessLog struct {
+	Type         string                    `yaml:"@type"`
+	CommonConfig commonGrpcAccessLogConfig `yaml:"common_config"`
+}
+
+type commonGrpcAccessLogConfig struct {
+	LogName             string      `yaml:"log_name"`
+	GrpcService         grpcService `yaml:"grpc_service"`
+	TransportAPIVersion string      `yaml:"transport_api_version"`
+}
+
+// grpcAccessLog is an access logger streaming to a gRPC access log service
+func grpcAccessLog(als *accessLogServiceData) namedConfig {
+	return namedConfig{Name: "envoy.access_loggers.http_grpc", TypedConfig: httpGrpcAccessLog{
+		Type: typeHTTPGrpcAccessLog,
+		CommonConfig: commonGrpcAccessLogConfig{
+			LogName:             als.LogName,
+			GrpcService:         grpcService{EnvoyGrpc: envoyGrpc{ClusterName: als.ClusterName}},
+			TransportAPIVersion: "V3",
+		},
+	}}
+}
+
+// Listener resources
+
+type listener struct {
+	Name                string              `yaml:"name"`
+	Address             address             `yaml:"address"`
+	AdditionalAddresses []additionalAddress `yaml:"additional_addresses,omitempty"`
+	Freebind            bool                `yaml:"freebind,omitempty"`
+	EnableReusePort     *bool               `yaml:"enable_reuse_port,omitempty"`
+	FastOpenQueueLength int                 `yaml:"tcp_fast_open_queue_length,omitempty"`
+	TCPBacklogSize      int                 `yaml:"tcp_backlog_size,omitempty"`
+	BufferLimitBytes    int                 `yaml:"per_connection_buffer_limit_bytes,omitempty"`
+	SocketOptions       []socketOption      `yaml:"socket_options,omitempty"`
+	DrainType           string              `yaml:"drain_type,omitempty"`
+	ListenerFilters     []namedConfig       `yaml:"listener_filters,omitempty"`
+	FilterChains        []filterChain       `yaml:"filter_chains"`
+}
+
+// socketOption is set on the listening socket before bind; accepted
+// connections inherit it
+type socketOption struct {
+	Description string `yaml:"description"`
+	Level       int    `yaml:"level"`
+	Name        int    `yaml:"name"`
+	IntValue    int    `yaml:"int_value"`
+	State       string `yaml:"state"`
+}
+
+// Linux socket option levels and names of TCP keepalive
+const (
+	solSocket    = 1
+	soKeepalive  = 9
+	ipprotoTCP   = 6
+	tcpKeepidle  = 4
+	tcpKeepintvl = 5
+	tcpKeepcnt   = 6
+)
+
+type additionalAddress struct {
+	Address address `yaml:"address"`
+}
+
+type filterChain struct {
+	Filters          []namedConfig     `yaml:"filters"`
+	FilterChainMatch *filterChainMatch `yaml:"filter_chain_match,omitempty"`
+	TransportSocket  *namedConfig      `yaml:"transport_socket,omitempty"`
+}
+
+type filterChainMatch struct {
+	ServerNames []string `yaml:"server_names"`
+}
+
+type connectionLimit struct {
+	Type           string `yaml:"@type"`
+	StatPrefix     string `yaml:"stat_prefix"`
+	MaxConnections int    `yaml:"max_connections"`
+}
+
+type networkLocalRateLimit struct {
+	Type        string      `yaml:"@type"`
+	StatPrefix  string      `yaml:"stat_prefix"`
+	TokenBucket tokenBucket `yaml:"token_bucket"`
+}
+
+type tokenBucket struct {
+	MaxTokens     int    `yaml:"max_tokens"`
+	TokensPerFill int    `yaml:"tokens_per_fill"`
+	FillInterval  string `yaml:"fill_interval"`
+}
+
+// protocolDecoder is a network filter decoding an application protocol for
+// statistics, ahead of the TCP proxy
+type protocolDecoder struct {
+	Type       string `yaml:"@type"`
+	StatPrefix string `yaml:"stat_prefix"`
+}
+
+type redisProxy struct {
+	Type         string            `yaml:"@type"`
+	StatPrefix   string            `yaml:"stat_prefix"`
+	Settings     redisSettings     `yaml:"settings"`
+	PrefixRoutes redisPrefixRoutes `yaml:"prefix_routes"`
+}
+
+type redisSettings struct {
+	OpTimeout string `yaml:"op_timeout"`
+}
+
+type redisPrefixRoutes struct {
+	CatchAllRoute redisRoute `yaml:"catch_all_route"`
+}
+
+type redisRoute struct {
+	Cluster string `yaml:"cluster"`
+}
+
+type originalSrc struct {
+	Type string `yaml:"@type"`
+	Mark int    `yaml:"mark"`
+}
+
+type tcpProxy struct {
+	Type               string        `yaml:"@type"`
+	StatPrefix         string        `yaml:"stat_prefix"`
+	Cluster            string        `yaml:"cluster"`
+	MaxConnectAttempts int           `yaml:"max_connect_attempts,omitempty"`
+	HashPolicy         []hashPolicy  `yaml:"hash_policy,omitempty"`
+	AccessLog          []namedConfig `yaml:"access_log"`
+	IdleTimeout        string        `yaml:"idle_timeout,omitempty"`
+	MaxDuration        string        `yaml:"max_downstream_connection_duration,omitempty"`
+}
+
+type hashPolicy struct {
+	SourceIP struct{} `yaml:"source_ip"`
+}
+
+type httpConnectionManager struct {
+	Type                          string                     `yaml:"@type"`
+	StatPrefix                    string                     `yaml:"stat_prefix"`
+	CodecType                     string                     `yaml:"codec_type"`
+	OriginalIPDetectionExtensions []namedConfig              `yaml:"original_ip_detection_extensions,omitempty"`
+	UseRemoteAddress              bool                       `yaml:"use_remote_address,omitempty"`
+	XffNumTrustedHops             *int                       `yaml:"xff_num_trusted_hops,omitempty"`
+	SkipXffAppend                 *bool                      `yaml:"skip_xff_append,omitempty"`
+	AccessLog                     []namedConfig              `yaml:"access_log"`
+	RouteConfig                   *routeConfiguration        `yaml:"route_config,omitempty"`
+	HTTPFilters                   []namedConfig              `yaml:"http_filters"`
+	StreamIdleTimeout             string                     `yaml:"stream_idle_timeout,omitempty"`
+	RequestTimeout                string                     `yaml:"request_timeout,omitempty"`
+	CommonHTTPProtocolOptions     *commonHTTPProtocolOptions `yaml:"common_http_protocol_options,omitempty"`
+	Tracing                       *tracing                   `yaml:"tracing,omitempty"`
+}
+
+type externalProcessor struct {
+	Type             string         `yaml:"@type"`
+	GrpcService      grpcService    `yaml:"grpc_service"`
+	FailureModeAllow bool           `yaml:"failure_mode_allow"`
+	ProcessingMode   processingMode `yaml:"processing_mode"`
+	MessageTimeout   string         `yaml:"message_timeout"`
+}
+
+type processingMode struct {
+	RequestHeaderMode  string `yaml:"request_header_mode"`
+	ResponseHeaderMode string `yaml:"response_header_mode"`
+	RequestBodyMode    string `yaml:"request_body_mode"`
+}
+
+type extAuthz struct {
+	Type                string       `yaml:"@type"`
+	TransportAPIVersion string       `yaml:"transport_api_version"`
+	GrpcService         *grpcService `yaml:"grpc_service,omitempty"`
+	HTTPService         *httpService `yaml:"http_service,omitempty"`
+	FailureModeAllow    bool         `yaml:"failure_mode_allow"`
+}
+
+type httpService struct {
+	ServerURI             httpURI                `yaml:"server_uri"`
+	PathPrefix            string                 `yaml:"path_prefix,omitempty"`
+	AuthorizationRequest  *authorizationRequest  `yaml:"authorization_request,omitempty"`
+	AuthorizationResponse *authorizationResponse `yaml:"authorization_response,omitempty"`
+}
+
+type httpURI struct {
+	URI     string `yaml:"uri"`
+	Cluster string `yaml:"cluster"`
+	Timeout string `yaml:"timeout"`
+}
+
+type authorizationRequest struct {
+	AllowedHeaders listStringMatcher `yaml:"allowed_headers"`
+}
+
+type authorizationResponse struct {
+	AllowedUpstreamHeaders listStringMatcher `yaml:"allowed_upstream_headers"`
+}
+
+type listStringMatcher struct {
+	Patterns []stringMatcher `yaml:"patterns"`
+}
+
+type stringMatcher struct {
+	Exact      string `yaml:"exact"`
+	IgnoreCase bool   `yaml:"ignore_case,omitempty"`
+}
+
+type jwtAuthentication struct {
+	Type           string                    `yaml:"@type"`
+	Providers      map[string]jwtProvider    `yaml:"providers"`
+	RequirementMap map[string]jwtRequirement `yaml:"requirement_map"`
+}
+
+type jwtProvider struct {
+	Issuer            string     `yaml:"issuer"`
+	Audiences         []string   `yaml:"audiences,omitempty"`
+	RemoteJWKS        remoteJWKS `yaml:"remote_jwks"`
+	Forward           bool       `yaml:"forward"`
+	PayloadInMetadata string     `yaml:"payload_in_metadata"`
+}
+
+type remoteJWKS struct {
+	HTTPURI       httpURI `yaml:"http_uri"`
+	CacheDuration string  `yaml:"cache_duration"`
+}
+
+type jwtRequirement struct {
+	ProviderName string              `yaml:"provider_name,omitempty"`
+	RequiresAny  *jwtRequirementList `yaml:"requires_any,omitempty"`
+}
+
+type jwtRequirementList struct {
+	Requirements []jwtRequirement `yaml:"requirements"`
+}
+
+type jwtPerRoute struct {
+	Type            string `yaml:"@type"`
+	Disabled        bool   `yaml:"disabled,omitempty"`
+	RequirementName string `yaml:"requirement_name,omitempty"`
+}
+
+type rbacPerRoute struct {
+	Type string `yaml:"@type"`
+	RBAC struct {
+		Rules rbacRules `yaml:"rules"`
+	} `yaml:"rbac"`
+}
+
+type rbacRules struct {
+	Action   string                `yaml:"action"`
+	Policies map[string]rbacPolicy `yaml:"policies"`
+}
+
+type rbacPolicy struct {
+	Permissions []rbacPermission `yaml:"permissions"`
+	Principals  []rbacPrincipal  `yaml:"principals"`
+}
+
+type rbacPermission struct {
+	Any bool `yaml:"any"`
+}
+
+type rbacPrincipal struct {
+	AndIDs   *rbacPrincipalSet `yaml:"and_ids,omitempty"`
+	OrIDs    *rbacPrincipalSet `yaml:"or_ids,omitempty"`
+	Metadata *metadataMatcher  `yaml:"metadata,omitempty"`
+	RemoteIP *cidrRange        `yaml:"remote_ip,omitempty"`
+}
+
+type rbacPrincipalSet struct {
+	IDs []rbacPrincipal `yaml:"ids"`
+}
+
+type luaFilter struct {
+	Type              string     `yaml:"@type"`
+	DefaultSourceCode dataSource `yaml:"default_source_code"`
+}
+
+type wasmFilter struct {
+	Type   string           `yaml:"@type"`
+	Config wasmPluginConfig `yaml:"config"`
+}
+
+type wasmPluginConfig struct {
+	Name          string       `yaml:"name"`
+	VMConfig      wasmVMConfig `yaml:"vm_config"`
+	Configuration *stringValue `yaml:"configuration,omitempty"`
+}
+
+type wasmVMConfig struct {
+	Runtime string `yaml:"runtime"`
+	Code    struct {
+		Local dataSource `yaml:"local"`
+	} `yaml:"code"`
+}
+
+type stringValue struct {
+	Type  string `yaml:"@type"`
+	Value string `yaml:"value"`
+}
+
+// httpFault is both the fault filter, empty, and a route's faults
+type httpFault struct {
+	Type  string      `yaml:"@type"`
+	Delay *faultDelay `yaml:"delay,omitempty"`
+	Abort *faultAbort `yaml:"abort,omitempty"`
+}
+
+type faultDelay struct {
+	FixedDelay string            `yaml:"fixed_delay"`
+	Percentage fractionalPercent `yaml:"percentage"`
+}
+
+type faultAbort struct {
+	HTTPStatus int               `yaml:"http_status"`
+	Percentage fractionalPercent `yaml:"percentage"`
+}
+
+type fractionalPercent struct {
+	Numerator   int    `yaml:"numerator"`
+	Denominator string `yaml:"denominator"`
+}
+
+type basicAuthPerRoute struct {
+	Type  string     `yaml:"@type"`
+	Users dataSource `yaml:"users"`
+}
+
+type metadataMatcher struct {
+	Filter string            `yaml:"filter"`
+	Path   []metadataPathKey `yaml:"path"`
+	Value  struct {
+		StringMatch stringMatcher `yaml:"string_match"`
+	} `yaml:"value"`
+}
+
+type metadataPathKey struct {
+	Key string `yaml:"key"`
+}
+
+type tracing struct {
+	RandomSampling percent     `yaml:"random_sampling"`
+	Provider       namedConfig `yaml:"provider"`
+}
+
+type openTelemetryConfig struct {
+	Type        string      `yaml:"@type"`
+	GrpcService grpcService `yaml:"grpc_service"`
+	ServiceName string      `yaml:"service_name"`
+}
+
+type grpcService struct {
+	EnvoyGrpc envoyGrpc `yaml:"envoy_grpc"`
+	Timeout   string    `yaml:"timeout,omitempty"`
+}
+
+type envoyGrpc struct {
+	ClusterName string `yaml:"cluster_name"`
+}
+
+type zipkinConfig struct {
+	Type                     string `yaml:"@type"`
+	CollectorCluster         string `yaml:"collector_cluster"`
+	CollectorEndpoint        string `yaml:"collector_endpoint"`
+	CollectorEndpointVersion string `yaml:"collector_endpoint_version"`
+}
+
+type xffConfig struct {
+	Type            string     `yaml:"@type"`
+	XffTrustedCIDRs cidrRanges `yaml:"xff_trusted_cidrs"`
+	SkipXffAppend   bool       `yaml:"skip_xff_append"`
+}
+
+type cidrRanges struct {
+	CIDRs []cidrRange `yaml:"cidrs"`
+}
+
+type cidrRange struct {
+	AddressPrefix string `yaml:"address_prefix"`
+	PrefixLen     int    `yaml:"prefix_len"`
+}
+
+type routeConfiguration struct {
+	Name                string              `yaml:"name"`
+	RequestHeadersToAdd []headerValueOption `yaml:"request_headers_to_add,omitempty"`
+	VirtualHosts        []virtualHost       `yaml:"virtual_hosts"`
+}
+
+type headerValueOption struct {
+	Header       headerValue `yaml:"header"`
+	AppendAction string      `yaml:"append_action"`
+}
+
+type headerValue struct {
+	Key   string `yaml:"key"`
+	Value quoted `yaml:"value"`
+}
+
+// overwriteHeader sets a header, replacing any value already present
+func overwriteHeader(key, value string) headerValueOption {
+	return headerValueOption{Header: headerValue{Key: key, Value: quoted(value)}, AppendAction: "OVERWRITE_IF_EXISTS_OR_ADD"}
+}
+
+type virtualHost struct {
+	Name    string   `yaml:"name"`
+	Domains []string `yaml:"domains,flow"`
+	Routes  []route  `yaml:"routes"`
+}
+
+type route struct {
+	Name                 string                 `yaml:"name,omitempty"`
+	Match                routeMatch             `yaml:"match"`
+	DirectResponse       *directResponseAction  `yaml:"direct_response,omitempty"`
+	ResponseHeadersToAdd []headerValueOption    `yaml:"response_headers_to_add,omitempty"`
+	Route                *routeAction           `yaml:"route,omitempty"`
+	StatPrefix           string                 `yaml:"stat_prefix,omitempty"`
+	TypedPerFilterConfig map[string]interface{} `yaml:"typed_per_filter_config,omitempty"`
+}
+
+type routeMatch struct {
+	Path            string         `yaml:"path,omitempty"`
+	Prefix          string         `yaml:"prefix,omitempty"`
+	Headers         []valueMatcher `yaml:"headers,omitempty"`
+	QueryParameters []valueMatcher `yaml:"query_parameters,omitempty"`
+}
+
+// valueMatcher matches a request header or query parameter
+type valueMatcher struct {
+	Name         string      `yaml:"name"`
+	StringMatch  *valueMatch `yaml:"string_match,omitempty"`
+	PresentMatch bool        `yaml:"present_match,omitempty"`
+}
+
+type valueMatch struct {
+	Exact     string        `yaml:"exact,omitempty"`
+	SafeRegex *regexMatcher `yaml:"safe_regex,omitempty"`
+}
+
+type regexMatcher struct {
+	Regex string `yaml:"regex"`
+}
+
+type directResponseAction struct {
+	Status int        `yaml:"status"`
+	Body   dataSource `yaml:"body"`
+}
+
+type routeAction struct {
+	Cluster          string              `yaml:"cluster,omitempty"`
+	WeightedClusters *weightedClusterSet `yaml:"weighted_clusters,omitempty"`
+	Timeout          string              `yaml:"timeout,omitempty"`
+	IdleTimeout      string              `yaml:"idle_timeout,omitempty"`
+	RetryPolicy      *retryPolicy        `yaml:"retry_policy,omitempty"`
+}
+
+type weightedClusterSet struct {
+	Clusters []clusterWeight `yaml:"clusters"`
+}
+
+type clusterWeight struct {
+	Name   string `yaml:"name"`
+	Weight int    `yaml:"weight"`
+}
+
+type retryPolicy struct {
+	RetryOn       string `yaml:"retry_on"`
+	NumRetries    int    `yaml:"num_retries"`
+	PerTryTimeout string `yaml:"per_try_timeout,omitempty"`
+}
+
+type adaptiveConcurrency struct {
+	Type                     string                   `yaml:"@type"`
+	GradientControllerConfig gradientControllerConfig `yaml:"gradient_controller_config"`
+}
+
+type gradientControllerConfig struct {
+	SampleAggregatePercentile percent                `yaml:"sample_aggregate_percentile"`
+	ConcurrencyLimitParams    concurrencyLimitParams `yaml:"concurrency_limit_params"`
+	MinRTTCalcParams          minRTTCalcParams       `yaml:"min_rtt_calc_params"`
+}
+
+type concurrencyLimitParams struct {
+	ConcurrencyUpdateInterval string `yaml:"concurrency_update_interval"`
+	MaxConcurrencyLimit       int    `yaml:"max_concurrency_limit,omitempty"`
+}
+
+type minRTTCalcParams struct {
+	Interval     string `yaml:"interval"`
+	RequestCount int    `yaml:"request_count"`
+	FixedValue   string `yaml:"fixed_value,omitempty"`
+}
+
+type bandwidthLimit struct {
+	Type       string `yaml:"@type"`
+	StatPrefix string `yaml:"stat_prefix"`
+	EnableMode string `yaml:"enable_mode"`
+	LimitKbps  int64  `yaml:"limit_kbps"` // KiB/s
+}
+
+type admissionControl struct {
+	Type            string          `yaml:"@type"`
+	SuccessCriteria successCriteria `yaml:"success_criteria"`
+	SamplingWindow  string          `yaml:"sampling_window"`
+	SrThreshold     runtimePercent  `yaml:"sr_threshold"`
+	RpsThreshold    runtimeUInt32   `yaml:"rps_threshold"`
+}
+
+type successCriteria struct {
+	HTTPCriteria struct{} `yaml:"http_criteria"`
+}
+
+type runtimePercent struct {
+	DefaultValue percent `yaml:"default_value"`
+	RuntimeKey   string  `yaml:"runtime_key"`
+}
+
+type runtimeUInt32 struct {
+	DefaultValue int    `yaml:"default_value"`
+	RuntimeKey   string `yaml:"runtime_key"`
+}
+
+type downstreamTLSContext struct {
+	Type                              string             `yaml:"@type"`
+	CommonTLSContext                  commonTLSContext   `yaml:"common_tls_context"`
+	SessionTicketKeys                 *sessionTicketKeys `yaml:"session_ticket_keys,omitempty"`
+	DisableStatelessSessionResumption bool               `yaml:"disable_stateless_session_resumption,omitempty"`
+	SessionTimeout                    string             `yaml:"session_timeout,omitempty"`
+}
+
+type sessionTicketKeys struct {
+	Keys []dataSource `yaml:"keys"`
+}
+
+type commonTLSContext struct {
+	TLSCertificates []tlsCertificate `yaml:"tls_certificates"`
+	ALPNProtocols   []string         `yaml:"alpn_protocols,omitempty"`
+	TLSParams       *tlsParameters   `yaml:"tls_params,omitempty"`
+}
+
+type tlsCertificate struct {
+	CertificateChain dataSource `yaml:"certificate_chain"`
+	PrivateKey       dataSource `yaml:"private_key"`
+}
+
+type tlsParameters struct {
+	MinimumProtocolVersion string `yaml:"tls_minimum_protocol_version,omitempty"`
+	MaximumProtocolVersion string `yaml:"tls_maximum_protocol_version,omitempty"`
+}
+
+// keepaliveSocketOptions enables TCP keepalive with k's settings
+func keepaliveSocketOptions(k *models.TCPKeepalive) []socketOption {
+	options := []socketOption{{Description: "SO_KEEPALIVE", Level: solSocket, Name: soKeepalive, IntValue: 1, State: "STATE_PREBIND"}}
+	for _, option := range []struct {
+		description string
+		name, value int
+	}{
+		{"TCP_KEEPIDLE", tcpKeepidle, k.Time},
+		{"TCP_KEEPINTVL", tcpKeepintvl, k.Interval},
+		{"TCP_KEEPCNT", tcpKeepcnt, k.Probes},
+	} {
+		if option.value > 0 {
+			options = append(options, socketOption{Description: option.description, Level: ipprotoTCP, Name: option.name, IntValue: option.value, State: "STATE_PREBIND"})
+		}
+	}
+	return options
+}
+
+// buildListener builds the listener for a protocol
+func buildListener(protocol models.Protocol, data *listenerData) listener {
+	l := listener{
+		Name:                data.Name,
+		Address:             address{SocketAddress: socketAddress{Address: data.Addresses[0], PortValue: data.Port}},
+		Freebind:            data.Freebind,
+		EnableReusePort:     data.ReusePort,
+		FastOpenQueueLength: data.FastOpenQueue,
+		TCPBacklogSize:      data.Backlog,
+		BufferLimitBytes:    data.BufferLimit,
+	}
+	if data.Keepalive != nil {
+		l.SocketOptions = keepaliveSocketOptions(data.Keepalive)
+	}
+	if data.DrainModifyOnly {
+		l.DrainType = "MODIFY_ONLY"
+	}
+	for _, addr := range data.Addresses[1:] {
+		l.AdditionalAddresses = append(l.AdditionalAddresses, additionalAddress{
+			Address: address{SocketAddress: socketAddress{Address: addr, PortValue: data.Port}},
+		})
+	}
+
+	var filters []namedConfig
+	if data.ConnectionLimit > 0 {
+		filters = append(filters, namedConfig{
+			Name: "envoy.filters.network.connection_limit",
+			TypedConfig: connectionLimit{
+				Type:           typeConnectionLimit,
+				StatPrefix:     data.StatPrefix + "_connection_limit",
+				MaxConnections: data.ConnectionLimit,
+			},
+		})
+	}
+	if data.ConnectionRate != nil {
+		filters = append(filters, namedConfig{
+			Name: "envoy.filters.network.local_ratelimit",
+			TypedConfig: networkLocalRateLimit{
+				Type:       typeNetworkLocalRateLimit,
+				StatPrefix: data.StatPrefix + "_connection_rate",
+				TokenBucket: tokenBucket{
+					MaxTokens:     data.ConnectionRate.Burst,
+					TokensPerFill: data.ConnectionRate.Rate,
+					FillInterval:  "1s",
+				},
+			},
+		})
+	}
+
+	if protocol == models.ProtocolTCP {
+		if data.TLSInspector {
+			l.ListenerFilters = append(l.ListenerFilters, namedConfig{
+				Name:        "envoy.filters.listener.tls_inspector",
+				TypedConfig: typedConfig{Type: typeTLSInspector},
+			})
+		}
+		if data.SourceMark > 0 {
+			l.ListenerFilters = append(l.ListenerFilters, namedConfig{
+				Name:        "envoy.filters.listener.original_src",
+				TypedConfig: originalSrc{Type: typeOriginalSrc, Mark: data.SourceMark},
+			})
+		}
+		for _, c := range data.TCPChains {
+			chain := filterChain{Filters: append(append([]namedConfig(nil), filters...), buildTCPFilters(data, c.Cluster)...)}
+			if len(c.ServerNames) > 0 {
+				chain.FilterChainMatch = &filterChainMatch{ServerNames: c.ServerNames}
+			}
+			l.FilterChains = append(l.FilterChains, chain)
+		}
+		return l
+	}
+
+	filters = append(filters, namedConfig{Name: "envoy.filters.network.http_connection_manager", TypedConfig: buildHTTPConnectionManager(data)})
+	chain := filterChain{Filters: filters}
+	if protocol == models.ProtocolHTTPS && data.TLSConfig != nil {
+		chain.TransportSocket = &namedConfig{Name: "envoy.transport_sockets.tls", TypedConfig: buildTLSContext(data.TLSConfig)}
+	}
+	l.FilterChains = []filterChain{chain}
+	return l
+}
+
+// buildTCPFilters builds the filters of a TCP filter chain after the
+// connection limits: the protocol decoder, if any, and the proxy to cluster
+func buildTCPFilters(data *listenerData, cluster string) []namedConfig {
+	var filters []namedConfig
+	switch models.TCPProtocolHint(data.ProtocolHint) {
+	case models.TCPProtocolMySQL:
+		filters = append(filters, namedConfig{Name: "envoy.filters.network.mysql_proxy", TypedConfig: protocolDecoder{Type: typeMySQLProxy, StatPrefix: data.StatPrefix}})
+	case models.TCPProtocolPostgres:
+		filters = append(filters, namedConfig{Name: "envoy.filters.network.postgres_proxy", TypedConfig: protocolDecoder{Type: typePostgresProxy, StatPrefix: data.StatPrefix}})
+	}
+	if data.Redis != nil {
+		return append(filters, namedConfig{Name: "envoy.filters.network.redis_proxy", TypedConfig: redisProxy{
+			Type:         typeRedisProxy,
+			StatPrefix:   data.StatPrefix,
+			Settings:     redisSettings{OpTimeout: seconds(data.Redis.OpTimeout)},
+			PrefixRoutes: redisPrefixRoutes{CatchAllRoute: redisRoute{Cluster: cluster}},
+		}})
+	}
+	return append(filters, namedConfig{Name: "envoy.filters.network.tcp_proxy", TypedConfig: buildTCPProxy(data, cluster)})
+}
+
+// buildTCPProxy builds the TCP proxy filter to cluster
+func buildTCPProxy(data *listenerData, cluster string) tcpProxy {
+	proxy := tcpProxy{
+		Type:               typeTCPProxy,
+		StatPrefix:         data.StatPrefix,
+		Cluster:            cluster,
+		MaxConnectAttempts: data.MaxConnectAttempts,
+		AccessLog: accessLog(data.AccessLogPath, tcpAccessLogFormat{
+			Timestamp:               "%START_TIME(%Y-%m-%dT%H:%M:%E9SZ)%",
+			DurationMs:              "%DURATION%",
+			BytesReceived:           "%BYTES_RECEIVED%",
+			BytesSent:               "%BYTES_SENT%",
+			ResponseFlags:           "%RESPONSE_FLAGS%",
+			DownstreamRemoteAddress: "%DOWNSTREAM_REMOTE_ADDRESS%",
+			UpstreamHost:            "%UPSTREAM_HOST%",
+		}),
+	}
+	if data.IdleTimeout > 0 {
+		proxy.IdleTimeout = seconds(data.IdleTimeout)
+	} else if data.Timeouts != nil {
+		proxy.IdleTimeout = seconds(data.Timeouts.Idle)
+	}
+	if data.MaxDuration > 0 {
+		proxy.MaxDuration = seconds(data.MaxDuration)
+	}
+	if data.HashSourceIP {
+		proxy.HashPolicy = []hashPolicy{{}}
+	}
+	return proxy
+}
+
+// buildHTTPConnectionManager builds the HTTP connection manager filter
+func buildHTTPConnectionManager(data *listenerData) httpConnectionManager {
+	hcm := httpConnectionManager{
+		Type:       typeHTTPConnectionManager,
+		StatPrefix: data.StatPrefix,
+		CodecType:  "AUTO",
+		AccessLog: accessLog(data.AccessLogPath, httpAccessLogFormat{
+			Timestamp:               "%START_TIME(%Y-%m-%dT%H:%M:%E9SZ)%",
+			DurationMs:              "%DURATION%",
+			Method:                  "%REQ(:METHOD)%",
+			Path:                    "%REQ(X-ENVOY-ORIGINAL-PATH?:PATH)%",
+			Protocol:                "%PROTOCOL%",
+			ResponseCode:            "%RESPONSE_CODE%",
+			ResponseFlags:           "%RESPONSE_FLAGS%",
+			BytesReceived:           "%BYTES_RECEIVED%",
+			BytesSent:               "%BYTES_SENT%",
+			DownstreamRemoteAddress: "%DOWNSTREAM_REMOTE_ADDRESS%",
+			UpstreamHost:            "%UPSTREAM_HOST%",
+			RequestID:               "%REQ(X-REQUEST-ID)%",
+		}),
+	}
+	if data.AccessLogService != nil {
+		hcm.AccessLog = append(hcm.AccessLog, grpcAccessLog(data.AccessLogService))
+	}
+
+	if ip := data.ClientIP; ip != nil {
+		if len(ip.TrustedCIDRs) > 0 {
+			cidrs := make([]cidrRange, 0, len(ip.TrustedCIDRs))
+			for _, cidr := range ip.TrustedCIDRs {
+				cidrs = append(cidrs, cidrRange{AddressPrefix: cidr.Prefix, PrefixLen: cidr.Length})
+			}
+			hcm.OriginalIPDetectionExtensions = []namedConfig{{
+				Name: "envoy.http.original_ip_detection.xff",
+				TypedConfig: xffConfig{
+					Type:            typeXffConfig,
+					XffTrustedCIDRs: cidrRanges{CIDRs: cidrs},
+					SkipXffAppend:   ip.SkipXFFAppend,
+				},
+			}}
+		} else {
+			hops, skip := ip.NumTrustedHops, ip.SkipXFFAppend
+			hcm.UseRemoteAddress = true
+			hcm.XffNumTrustedHops = &hops
+			hcm.SkipXffAppend = &skip
+		}
+	}
+
+	if data.RouteConfig != nil {
+		hcm.RouteConfig = buildRouteConfiguration(data)
+	}
+
+	// The WAF inspects requests before anything else acts on them
+	if waf := data.WAF; waf != nil {
+		hcm.HTTPFilters = append(hcm.HTTPFilters, namedConfig{Name: "envoy.filters.http.ext_proc", TypedConfig: externalProcessor{
+			Type:             typeExternalProcessor,
+			GrpcService:      grpcService{EnvoyGrpc: envoyGrpc{ClusterName: waf.ClusterName}},
+			FailureModeAllow: waf.FailOpen,
+			ProcessingMode:   processingMode{RequestHeaderMode: "SEND", ResponseHeaderMode: "SKIP", RequestBodyMode: "BUFFERED_PARTIAL"},
+			MessageTimeout:   wafMessageTimeout,
+		}})
+	}
+
+	// Tokens are validated before the authorization service sees the request
+	if jwt := data.JWTAuth; jwt != nil {
+		hcm.HTTPFilters = append(hcm.HTTPFilters, namedConfig{Name: jwtAuthnFilter, TypedConfig: buildJWTAuthentication(jwt)})
+	}
+
+	// Without rules the RBAC filter allows every request; routes restricted
+	// to required claims or client ranges override it. It follows the JWT
+	// filter, whose verified payload the claims are matched in.
+	if data.RBAC {
+		hcm.HTTPFilters = append(hcm.HTTPFilters, namedConfig{Name: rbacFilter, TypedConfig: typedConfig{Type: typeRBAC}})
+	}
+	if data.BasicAuth {
+		hcm.HTTPFilters = append(hcm.HTTPFilters, namedConfig{Name: basicAuthFilter, Disabled: true, TypedConfig: typedConfig{Type: typeBasicAuth}})
+	}
+
+	// Unauthorized requests are rejected before they count towards admission control
+	if data.Authorization != nil {
+		hcm.HTTPFilters = append(hcm.HTTPFilters, namedConfig{Name: "envoy.filters.http.ext_authz", TypedConfig: buildExtAuthz(data.Authorization)})
+	}
+
+	// Custom filters only see requests that passed access control
+	for i := range data.CustomFilters {
+		hcm.HTTPFilters = append(hcm.HTTPFilters, namedConfig{Name: data.CustomFilters[i].Name, TypedConfig: buildCustomFilter(&data.CustomFilters[i])})
+	}
+
+	if ac := data.Admission; ac != nil {
+		if ac.Type == string(models.AdmissionAdaptiveConcurrency) {
+			config := adaptiveConcurrency{Type: typeAdaptiveConcurrency}
+			config.GradientControllerConfig.SampleAggregatePercentile.Value = 90
+			config.GradientControllerConfig.ConcurrencyLimitParams = concurrencyLimitParams{
+				ConcurrencyUpdateInterval: "0.1s",
+				MaxConcurrencyLimit:       ac.MaxConcurrency,
+			}
+			config.GradientControllerConfig.MinRTTCalcParams = minRTTCalcParams{Interval: "60s", RequestCount: 50}
+			if ac.TargetLatencyMs > 0 {
+				config.GradientControllerConfig.MinRTTCalcParams.FixedValue = ac.TargetLatency
+			}
+			hcm.HTTPFilters = append(hcm.HTTPFilters, namedConfig{Name: "envoy.filters.http.adaptive_concurrency", TypedConfig: config})
+		} else {
+			hcm.HTTPFilters = append(hcm.HTTPFilters, namedConfig{
+				Name: "envoy.filters.http.admission_control",
+				TypedConfig: admissionControl{
+					Type:           typeAdmissionControl,
+					SamplingWindow: seconds(ac.SamplingWindow),
+					SrThreshold: runtimePercent{
+						DefaultValue: percent{Value: ac.SuccessRateThreshold},
+						RuntimeKey:   "admission_control.sr_threshold",
+					},
+					RpsThreshold: runtimeUInt32{DefaultValue: ac.MinRPS, RuntimeKey: "admission_control.rps_threshold"},
+				},
+			})
+		}
+	}
+
+	// Bodies are shaped last, once a request is certain to be proxied
+	for _, limit := range data.BandwidthLimits {
+		hcm.HTTPFilters = append(hcm.HTTPFilters, namedConfig{
+			Name: limit.Name,
+			TypedConfig: bandwidthLimit{
+				Type:       typeBandwidthLimit,
+				StatPrefix: limit.StatPrefix,
+				EnableMode: limit.Mode,
+				LimitKbps:  limit.KiBps,
+			},
+		})
+	}
+
+	// Injected faults stand in for the backend, right before the router
+	if data.Fault {
+		hcm.HTTPFilters = append(hcm.HTTPFilters, namedConfig{Name: faultFilter, TypedConfig: httpFault{Type: typeHTTPFault}})
+	}
+	hcm.HTTPFilters = append(hcm.HTTPFilters, namedConfig{Name: "envoy.filters.http.router", TypedConfig: typedConfig{Type: typeRouter}})
+
+	if data.Timeouts != nil {
+		hcm.StreamIdleTimeout = seconds(data.Timeouts.Idle)
+		hcm.RequestTimeout = seconds(data.Timeouts.Request)
+	}
+	if data.IdleTimeout > 0 || data.MaxDuration > 0 {
+		hcm.CommonHTTPProtocolOptions = &commonHTTPProtocolOptions{}
+		if data.IdleTimeout > 0 {
+			hcm.CommonHTTPProtocolOptions.IdleTimeout = seconds(data.IdleTimeout)
+		}
+		if data.MaxDuration > 0 {
+			hcm.CommonHTTPProtocolOptions.MaxConnectionDuration = seconds(data.MaxDuration)
+		}
+	}
+	if data.Tracing != nil {
+		hcm.Tracing = buildTracing(data.Tracing)
+	}
+	return hcm
+}
+
+// buildJWTAuthentication builds the JWT authentication filter. Verified
+// payloads are kept in the dynamic metadata for the claim checks.
+func buildJWTAuthentication(jwt *jwtAuthData) jwtAuthentication {
+	config := jwtAuthentication{
+		Type:           typeJWTAuthentication,
+		Providers:      make(map[string]jwtProvider, len(jwt.Providers)),
+		RequirementMap: make(map[string]jwtRequirement, len(jwt.Requirements)),
+	}
+	for _, p := range jwt.Providers {
+		config.Providers[p.Name] = jwtProvider{
+			Issuer:    p.Issuer,
+			Audiences: p.Audiences,
+			RemoteJWKS: remoteJWKS{
+				HTTPURI:       httpURI{URI: p.URI, Cluster: p.ClusterName, Timeout: seconds(jwksFetchTimeout)},
+				CacheDuration: seconds(p.CacheDuration),
+			},
+			Forward:           p.Forward,
+			PayloadInMetadata: jwtPayloadMetadata,
+		}
+	}
+	for _, r := range jwt.Requirements {
+		if len(r.Providers) == 1 {
+			config.RequirementMap[r.Name] = jwtRequirement{ProviderName: r.Providers[0]}
+			continue
+		}
+		list := &jwtRequirementList{}
+		for _, name := range r.Providers {
+			list.Requirements = append(list.Requirements, jwtRequirement{ProviderName: name})
+		}
+		config.RequirementMap[r.Name] = jwtRequirement{RequiresAny: list}
+	}
+	return config
+}
+
+// routeFilterConfig builds the per-route token requirement, credentials and
+// the RBAC policy matching the required claims and client ranges
+func routeFilterConfig(r *routeData) map[string]interface{} {
+	config := make(map[string]interface{})
+	if jwt := r.JWT; jwt != nil {
+		config[jwtAuthnFilter] = jwtPerRoute{Type: typeJWTPerRoute, Disabled: jwt.Disabled, RequirementName: jwt.Requirement}
+	}
+	if ba := r.BasicAuth; ba != nil {
+		users := dataSource{Filename: ba.File}
+		if ba.File == "" {
+			users.InlineString = strings.Join(ba.Users, "\n")
+		}
+		config[basicAuthFilter] = basicAuthPerRoute{Type: typeBasicAuthPerRoute, Users: users}
+	}
+	if f := r.Fault; f != nil {
+		fault := httpFault{Type: typeHTTPFault}
+		if f.DelayPercent > 0 {
+			fault.Delay = &faultDelay{FixedDelay: f.Delay, Percentage: fractionalPercent{Numerator: f.DelayPercent, Denominator: "HUNDRED"}}
+		}
+		if f.AbortPercent > 0 {
+			fault.Abort = &faultAbort{HTTPStatus: f.AbortStatus, Percentage: fractionalPercent{Numerator: f.AbortPercent, Denominator: "HUNDRED"}}
+		}
+		config[faultFilter] = fault
+	}
+	if access := r.Access; access != nil {
+		principal := rbacPrincipalSet{}
+		for _, claim := range access.Claims {
+			matcher := &metadataMatcher{Filter: jwtAuthnFilter, Path: []metadataPathKey{{Key: jwtPayloadMetadata}, {Key: claim.Name}}}
+			matcher.Value.StringMatch = stringMatcher{Exact: claim.Value}
+			principal.IDs = append(principal.IDs, rbacPrincipal{Metadata: matcher})
+		}
+		if len(access.CIDRs) > 0 {
+			ranges := &rbacPrincipalSet{}
+			for _, cidr := range access.CIDRs {
+				ranges.IDs = append(ranges.IDs, rbacPrincipal{RemoteIP: &cidrRange{AddressPrefix: cidr.Prefix, PrefixLen: cidr.Length}})
+			}
+			principal.IDs = append(principal.IDs, rbacPrincipal{OrIDs: ranges})
+		}
+		rbac := rbacPerRoute{Type: typeRBACPerRoute}
+		rbac.RBAC.Rules = rbacRules{
+			Action: "ALLOW",
+			Policies: map[string]rbacPolicy{"route_access": {
+				Permissions: []rbacPermission{{Any: true}},
+				Principals:  []rbacPrincipal{{AndIDs: &principal}},
+			}},
+		}
+		config[rbacFilter] = rbac
+	}
+	if len(config) == 0 {
+		return nil
+	}
+	return config
+}
+
+// buildCustomFilter builds a Lua filter running the inline source, or a WASM
+// filter loading the local module in the V8 runtime
+func buildCustomFilter(f *customFilterData) interface{} {
+	if f.Type == string(models.CustomFilterLua) {
+		return luaFilter{Type: typeLua, DefaultSourceCode: dataSource{InlineString: f.Source}}
+	}
+	config := wasmPluginConfig{Name: f.Name, VMConfig: wasmVMConfig{Runtime: "envoy.wasm.runtime.v8"}}
+	config.VMConfig.Code.Local = dataSource{Filename: f.Module}
+	if f.Config != "" {
+		config.Configuration = &stringValue{Type: typeStringValue, Value: f.Config}
+	}
+	return wasmFilter{Type: typeWasm, Config: config}
+}
+
+// buildExtAuthz builds the external authorization filter for the service's protocol
+func buildExtAuthz(a *authorizationData) extAuthz {
+	config := extAuthz{Type: typeExtAuthz, TransportAPIVersion: "V3", FailureModeAllow: a.FailOpen}
+	if a.Protocol == string(models.AuthorizationGRPC) {
+		config.GrpcService = &grpcService{EnvoyGrpc: envoyGrpc{ClusterName: a.ClusterName}, Timeout: a.Timeout}
+		return config
+	}
+	config.HTTPService = &httpService{
+		ServerURI:  httpURI{URI: a.URI, Cluster: a.ClusterName, Timeout: a.Timeout},
+		PathPrefix: a.PathPrefix,
+	}
+	if len(a.RequestHeaders) > 0 {
+		config.HTTPService.AuthorizationRequest = &authorizationRequest{AllowedHeaders: headerMatchers(a.RequestHeaders)}
+	}
+	if len(a.UpstreamHeaders) > 0 {
+		config.HTTPService.AuthorizationResponse = &authorizationResponse{AllowedUpstreamHeaders: headerMatchers(a.UpstreamHeaders)}
+	}
+	return config
+}
+
+// headerMatchers matches each of the header names exactly, ignoring case
+func headerMatchers(names []string) listStringMatcher {
+	var matchers listStringMatcher
+	for _, name := range names {
+		matchers.Patterns = append(matchers.Patterns, stringMatcher{Exact: name, IgnoreCase: true})
+	}
+	return matchers
+}
+
+// buildTracing builds the HTTP tracing configuration for the collector's provider
+func buildTracing(t *tracingData) *tracing {
+	if t.Provider == string(models.TracingZipkin) {
+		return &tracing{
+			RandomSampling: percent{Value: t.SamplingRate},
+			Provider: namedConfig{Name: "envoy.tracers.zipkin", TypedConfig: zipkinConfig{
+				Type:                     typeZipkinConfig,
+				CollectorCluster:         t.ClusterName,
+				CollectorEndpoint:        t.Path,
+				CollectorEndpointVersion: "HTTP_JSON",
+			}},
+		}
+	}
+	return &tracing{
+		RandomSampling: percent{Value: t.SamplingRate},
+		Provider: namedConfig{Name: "envoy.tracers.opentelemetry", TypedConfig: openTelemetryConfig{
+			Type:        typeOpenTelemetryConfig,
+			GrpcService: grpcService{EnvoyGrpc: envoyGrpc{ClusterName: t.ClusterName}},
+			ServiceName: t.ServiceName,
+		}},
+	}
+}
+
+// buildRouteConfiguration builds the virtual hosts and routes
+func buildRouteConfiguration(data *listenerData) *routeConfiguration {
+	rc := &routeConfiguration{Name: data.RouteConfig.Name}
+	if data.ClientIP != nil {
+		for _, key := range data.ClientIP.RequestHeaders {
+			rc.RequestHeadersToAdd = append(rc.RequestHeadersToAdd, overwriteHeader(key, "%DOWNSTREAM_REMOTE_ADDRESS_WITHOUT_PORT%"))
+		}
+	}
+
+	for _, vh := range data.VirtualHosts {
+		host := virtualHost{Name: vh.Name, Domains: vh.Domains}
+		for _, r := range vh.Routes {
+			entry := route{Name: r.Name, StatPrefix: r.StatPrefix, TypedPerFilterConfig: routeFilterConfig(&r)}
+			if r.Exact {
+				entry.Match.Path = r.Path
+			} else {
+				entry.Match.Prefix = r.Path
+			}
+			entry.Match.Headers = buildValueMatchers(r.Headers)
+			entry.Match.QueryParameters = buildValueMatchers(r.QueryParams)
+
+			if dr := r.DirectResponse; dr != nil {
+				entry.DirectResponse = &directResponseAction{Status: dr.Status, Body: dataSource{InlineString: dr.Body}}
+				entry.ResponseHeadersToAdd = []headerValueOption{overwriteHeader("content-type", dr.ContentType)}
+				if dr.RetryAfter > 0 {
+					entry.ResponseHeadersToAdd = append(entry.ResponseHeadersToAdd, overwriteHeader("retry-after", strconv.Itoa(dr.RetryAfter)))
+				}
+				host.Routes = append(host.Routes, entry)
+				continue
+			}
+
+			action := &routeAction{}
+			if len(r.WeightedClusters) > 0 {
+				set := &weightedClusterSet{}
+				for _, wc := range r.WeightedClusters {
+					set.Clusters = append(set.Clusters, clusterWeight{Name: wc.Name, Weight: wc.Weight})
+				}
+				action.WeightedClusters = set
+			} else {
+				action.Cluster = r.Cluster
+			}
+			if r.Timeout > 0 {
+				action.Timeout = seconds(r.Timeout)
+			}
+			if r.IdleTimeout > 0 {
+				action.IdleTimeout = seconds(r.IdleTimeout)
+			}
+			if rp := r.RetryPolicy; rp != nil {
+				action.RetryPolicy = &retryPolicy{RetryOn: rp.RetryOn, NumRetries: rp.NumRetries}
+				if rp.PerTryTimeout > 0 {
+					action.RetryPolicy.PerTryTimeout = seconds(rp.PerTryTimeout)
+				}
+			}
+			entry.Route = action
+			host.Routes = append(host.Routes, entry)
+		}
+		rc.VirtualHosts = append(rc.VirtualHosts, host)
+	}
+	return rc
+}
+
+// buildValueMatchers builds header or query parameter matchers
+func buildValueMatchers(conditions []matchData) []valueMatcher {
+	var matchers []valueMatcher
+	for _, c := range conditions {
+		m := valueMatcher{Name: c.Name}
+		switch {
+		case c.Present:
+			m.PresentMatch = true
+		case c.Regex:
+			m.StringMatch = &valueMatch{SafeRegex: &regexMatcher{Regex: c.Value}}
+		default:
+			m.StringMatch = &valueMatch{Exact: c.Value}
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers
+}
+
+// buildTLSContext builds the downstream TLS transport socket configuration
+func buildTLSContext(tls *tlsData) downstreamTLSContext {
+	ctx := downstreamTLSContext{
+		Type: typeDownstreamTLSContext,
+		CommonTLSContext: commonTLSContext{
+			TLSCertificates: []tlsCertificate{{
+				CertificateChain: dataSource{Filename: tls.CertificatePath},
+				PrivateKey:       dataSource{Filename: tls.PrivateKeyPath},
+			}},
+			ALPNProtocols: tls.ALPN,
+		},
+	}
+	params := tlsParameters{
+		MinimumProtocolVersion: tlsVersions[tls.MinVersion],
+		MaximumProtocolVersion: tlsVersions[tls.MaxVersion],
+	}
+	if params != (tlsParameters{}) {
+		ctx.CommonTLSContext.TLSParams = &params
+	}
+	if len(tls.SessionTicketKeys) > 0 {
+		ctx.SessionTicketKeys = &sessionTicketKeys{}
+		for _, path := range tls.SessionTicketKeys {
+			ctx.SessionTicketKeys.Keys = append(ctx.SessionTicketKeys.Keys, dataSource{Filename: path})
+		}
+	}
+	ctx.DisableStatelessSessionResumption = tls.DisableSessionTickets
+	if tls.SessionTimeout > 0 {
+		ctx.SessionTimeout = seconds(tls.SessionTimeout)
+	}
+	return ctx
+}
+
+// Cluster resources
+
+type cluster struct {
+	Name                          string                         `yaml:"name"`
+	ConnectTimeout                string                         `yaml:"connect_timeout"`
+	Type                          string                         `yaml:"type"`
+	LbPolicy                      string                         `yaml:"lb_policy,omitempty"`
+	RoundRobinLbConfig            *lbPolicyConfig                `yaml:"round_robin_lb_config,omitempty"`
+	LeastRequestLbConfig          *lbPolicyConfig                `yaml:"least_request_lb_config,omitempty"`
+	CommonLbConfig                *commonLbConfig                `yaml:"common_lb_config,omitempty"`
+	DNSLookupFamily               string                         `yaml:"dns_lookup_family,omitempty"`
+	DNSRefreshRate                string                         `yaml:"dns_refresh_rate,omitempty"`
+	RespectDNSTTL                 bool                           `yaml:"respect_dns_ttl,omitempty"`
+	LoadAssignment                loadAssignment                 `yaml:"load_assignment"`
+	HealthChecks                  []healthCheck                  `yaml:"health_checks,omitempty"`
+	TypedExtensionProtocolOptions map[string]httpProtocolOptions `yaml:"typed_extension_protocol_options,omitempty"`
+	CircuitBreakers               *circuitBreakers               `yaml:"circuit_breakers,omitempty"`
+	PreconnectPolicy              *preconnectPolicy              `yaml:"preconnect_policy,omitempty"`
+	TransportSocket               *namedConfig                   `yaml:"transport_socket,omitempty"`
+}
+
+// lbPolicyConfig is the round robin or least request balancer configuration
+type lbPolicyConfig struct {
+	SlowStartConfig slowStartConfig `yaml:"slow_start_config"`
+}
+
+type commonLbConfig struct {
+	ConsistentHashingLbConfig consistentHashingLbConfig `yaml:"consistent_hashing_lb_config"`
+}
+
+type consistentHashingLbConfig struct {
+	UseHostnameForHashing bool `yaml:"use_hostname_for_hashing"`
+}
+
+type slowStartConfig struct {
+	SlowStartWindow string         `yaml:"slow_start_window"`
+	Aggression      *runtimeDouble `yaml:"aggression,omitempty"`
+}
+
+type runtimeDouble struct {
+	DefaultValue float64 `yaml:"default_value"`
+	RuntimeKey   string  `yaml:"runtime_key"`
+}
+
+type preconnectPolicy struct {
+	PerUpstreamPreconnectRatio float64 `yaml:"per_upstream_preconnect_ratio"`
+}
+
+type upstreamTLSContext struct {
+	Type             string `yaml:"@type"`
+	SNI              string `yaml:"sni"`
+	CommonTLSContext struct {
+		ValidationContext certificateValidationContext `yaml:"validation_context"`
+	} `yaml:"common_tls_context"`
+}
+
+type certificateValidationContext struct {
+	TrustedCA                 dataSource              `yaml:"trusted_ca"`
+	MatchTypedSubjectAltNames []subjectAltNameMatcher `yaml:"match_typed_subject_alt_names"`
+}
+
+type subjectAltNameMatcher struct {
+	SanType string        `yaml:"san_type"`
+	Matcher stringMatcher `yaml:"matcher"`
+}
+
+type loadAssignment struct {
+	ClusterName string                `yaml:"cluster_name"`
+	Endpoints   []localityLbEndpoints `yaml:"endpoints"`
+	Policy      *assignmentPolicy     `yaml:"policy,omitempty"`
+}
+
+type localityLbEndpoints struct {
+	Locality    *locality    `yaml:"locality,omitempty"`
+	LbEndpoints []lbEndpoint `yaml:"lb_endpoints"`
+	Priority    int          `yaml:"priority,omitempty"`
+}
+
+type locality struct {
+	Region string `yaml:"region,omitempty"`
+	Zone   string `yaml:"zone,omitempty"`
+}
+
+type assignmentPolicy struct {
+	OverprovisioningFactor int `yaml:"overprovisioning_factor"`
+}
+
+type lbEndpoint struct {
+	Endpoint            endpoint `yaml:"endpoint"`
+	LoadBalancingWeight int      `yaml:"load_balancing_weight,omitempty"`
+}
+
+type endpoint struct {
+	Address           address            `yaml:"address"`
+	HealthCheckConfig *healthCheckConfig `yaml:"health_check_config,omitempty"`
+	Hostname          string             `yaml:"hostname,omitempty"`
+}
+
+type healthCheckConfig struct {
+	PortValue int `yaml:"port_value"`
+}
+
+type healthCheck struct {
+	Timeout            string           `yaml:"timeout"`
+	Interval           string           `yaml:"interval"`
+	UnhealthyThreshold int              `yaml:"unhealthy_threshold"`
+	HealthyThreshold   int              `yaml:"healthy_threshold"`
+	TCPHealthCheck     *tcpHealthCheck  `yaml:"tcp_health_check,omitempty"`
+	HTTPHealthCheck    *httpHealthCheck `yaml:"http_health_check,omitempty"`
+	CustomHealthCheck  *namedConfig     `yaml:"custom_health_check,omitempty"`
+}
+
+type tcpHealthCheck struct {
+	Receive []healthCheckPayload `yaml:"receive,omitempty"`
+}
+
+type healthCheckPayload struct {
+	Text string `yaml:"text"` // hex
+}
+
+type httpHealthCheck struct {
+	Path             string        `yaml:"path"`
+	ExpectedStatuses []statusRange `yaml:"expected_statuses,omitempty"`
+}
+
+type statusRange struct {
+	Start int `yaml:"start"`
+	End   int `yaml:"end"`
+}
+
+type httpProtocolOptions struct {
+	Type                      string                     `yaml:"@type"`
+	CommonHTTPProtocolOptions *commonHTTPProtocolOptions `yaml:"common_http_protocol_options,omitempty"`
+	ExplicitHTTPConfig        explicitHTTPConfig         `yaml:"explicit_http_config"`
+}
+
+type commonHTTPProtocolOptions struct {
+	IdleTimeout              string `yaml:"idle_timeout,omitempty"`
+	MaxConnectionDuration    string `yaml:"max_connection_duration,omitempty"`
+	MaxRequestsPerConnection int    `yaml:"max_requests_per_connection,omitempty"`
+}
+
+type explicitHTTPConfig struct {
+	HTTPProtocolOptions  *struct{}             `yaml:"http_protocol_options,omitempty"`
+	HTTP2ProtocolOptions *http2ProtocolOptions `yaml:"http2_protocol_options,omitempty"`
+}
+
+type http2ProtocolOptions struct {
+	MaxConcurrentStreams int `yaml:"max_concurrent_streams,omitempty"`
+}
+
+type circuitBreakers struct {
+	Thresholds        []thresholds       `yaml:"thresholds"`
+	PerHostThresholds []perHostThreshold `yaml:"per_host_thresholds,omitempty"`
+}
+
+type thresholds struct {
+	Priority           string       `yaml:"priority"`
+	MaxConnections     int          `yaml:"max_connections"`
+	MaxPendingRequests int          `yaml:"max_pending_requests"`
+	MaxRequests        int          `yaml:"max_requests"`
+	MaxRetries         int          `yaml:"max_retries"`
+	RetryBudget        *retryBudget `yaml:"retry_budget,omitempty"`
+}
+
+type perHostThreshold struct {
+	Priority       string `yaml:"priority"`
+	MaxConnections int    `yaml:"max_connections"`
+}
+
+type retryBudget struct {
+	BudgetPercent       *percent `yaml:"budget_percent,omitempty"`
+	MinRetryConcurrency int      `yaml:"min_retry_concurrency,omitempty"`
+}
+
+// buildCluster builds one upstream cluster
+func buildCluster(data *clusterData) cluster {
+	c := cluster{
+		Name:            data.Name,
+		ConnectTimeout:  seconds(data.ConnectTimeout),
+		Type:            data.Type,
+		LbPolicy:        lbPolicies[data.LoadBalancingAlgo],
+		DNSLookupFamily: data.DNSLookupFamily,
+		RespectDNSTTL:   data.RespectDNSTTL,
+	}
+	if data.DNSRefreshRate > 0 {
+		c.DNSRefreshRate = seconds(data.DNSRefreshRate)
+	}
+	if data.HashByHostname {
+		c.CommonLbConfig = &commonLbConfig{ConsistentHashingLbConfig: consistentHashingLbConfig{UseHostnameForHashing: true}}
+	}
+
+	c.LoadAssignment = loadAssignment{ClusterName: data.Name}
+	for _, l := range data.Localities {
+		endpoints := make([]lbEndpoint, 0, len(l.Endpoints))
+		for _, ep := range l.Endpoints {
+			e := endpoint{Address: address{SocketAddress: socketAddress{Address: ep.Address, PortValue: ep.Port}}}
+			if ep.HealthCheckPort > 0 {
+				e.HealthCheckConfig = &healthCheckConfig{PortValue: ep.HealthCheckPort}
+			}
+			if data.HashByHostname {
+				e.Hostname = ep.Hostname
+			}
+			endpoints = append(endpoints, lbEndpoint{Endpoint: e, LoadBalancingWeight: ep.Weight})
+		}
+		group := localityLbEndpoints{LbEndpoints: endpoints, Priority: l.Priority}
+		if l.Region != "" || l.Zone != "" {
+			group.Locality = &locality{Region: l.Region, Zone: l.Zone}
+		}
+		c.LoadAssignment.Endpoints = append(c.LoadAssignment.Endpoints, group)
+	}
+	if data.OverprovisioningFactor > 0 {
+		c.LoadAssignment.Policy = &assignmentPolicy{OverprovisioningFactor: data.OverprovisioningFactor}
+	}
+
+	if hc := data.HealthCheck; hc != nil {
+		check := healthCheck{
+			Timeout:            seconds(hc.Timeout),
+			Interval:           seconds(hc.Interval),
+			UnhealthyThreshold: hc.UnhealthyThreshold,
+			HealthyThreshold:   hc.HealthyThreshold,
+		}
+		switch models.HealthCheckType(hc.Type) {
+		case models.HealthCheckTCP:
+			if hc.Redis {
+				check.CustomHealthCheck = &namedConfig{Name: "envoy.health_checkers.redis", TypedConfig: typedConfig{Type: typeRedisHealthCheck}}
+				break
+			}
+			check.TCPHealthCheck = &tcpHealthCheck{}
+			for _, payload := range hc.Receive {
+				check.TCPHealthCheck.Receive = append(check.TCPHealthCheck.Receive, healthCheckPayload{Text: payload})
+			}
+		case models.HealthCheckHTTP, models.HealthCheckHTTPS:
+			check.HTTPHealthCheck = &httpHealthCheck{Path: hc.Path}
+			for _, status := range hc.ExpectedStatus {
+				check.HTTPHealthCheck.ExpectedStatuses = append(check.HTTPHealthCheck.ExpectedStatuses, statusRange{Start: status, End: status})
+			}
+		}
+		c.HealthChecks = []healthCheck{check}
+	}
+
+	if po := data.ProtocolOptions; po != nil {
+		options := httpProtocolOptions{Type: typeHTTPProtocolOptions}
+		if po.IdleTimeout > 0 || po.MaxRequestsPerConnection > 0 {
+			options.CommonHTTPProtocolOptions = &commonHTTPProtocolOptions{MaxRequestsPerConnection: po.MaxRequestsPerConnection}
+			if po.IdleTimeout > 0 {
+				options.CommonHTTPProtocolOptions.IdleTimeout = seconds(po.IdleTimeout)
+			}
+		}
+		if po.HTTP2 {
+			options.ExplicitHTTPConfig.HTTP2ProtocolOptions = &http2ProtocolOptions{MaxConcurrentStreams: po.MaxConcurrentStreams}
+		} else {
+			options.ExplicitHTTPConfig.HTTPProtocolOptions = &struct{}{}
+		}
+		c.TypedExtensionProtocolOptions = map[string]httpProtocolOptions{httpProtocolOptionsExtension: options}
+	}
+
+	if cb := data.CircuitBreakers; cb != nil {
+		limits := thresholds{
+			Priority:           "DEFAULT",
+			MaxConnections:     cb.MaxConnections,
+			MaxPendingRequests: cb.MaxPendingRequests,
+			MaxRequests:        cb.MaxRequests,
+			MaxRetries:         cb.MaxRetries,
+		}
+		if budget := cb.RetryBudget; budget != nil {
+			limits.RetryBudget = &retryBudget{MinRetryConcurrency: budget.MinRetryConcurrency}
+			if budget.BudgetPercent > 0 {
+				limits.RetryBudget.BudgetPercent = &percent{Value: budget.BudgetPercent}
+			}
+		}
+		c.CircuitBreakers = &circuitBreakers{Thresholds: []thresholds{limits}}
+		if cb.MaxConnectionsPerHost > 0 {
+			c.CircuitBreakers.PerHostThresholds = []perHostThreshold{{Priority: "DEFAULT", MaxConnections: cb.MaxConnectionsPerHost}}
+		}
+	}
+
+	if ss := data.SlowStart; ss != nil {
+		policy := &lbPolicyConfig{SlowStartConfig: slowStartConfig{SlowStartWindow: seconds(ss.Window)}}
+		if ss.Aggression > 0 {
+			policy.SlowStartConfig.Aggression = &runtimeDouble{DefaultValue: ss.Aggression, RuntimeKey: "upstream.slow_start_aggression"}
+		}
+		if data.LoadBalancingAlgo == string(models.AlgoLeastRequest) {
+			c.LeastRequestLbConfig = policy
+		} else {
+			c.RoundRobinLbConfig = policy
+		}
+	}
+	if data.PreconnectRatio > 0 {
+		c.PreconnectPolicy = &preconnectPolicy{PerUpstreamPreconnectRatio: data.PreconnectRatio}
+	}
+
+	if tls := data.UpstreamTLS; tls != nil {
+		ctx := upstreamTLSContext{Type: typeUpstreamTLSContext, SNI: tls.ServerName}
+		ctx.CommonTLSContext.ValidationContext = certificateValidationContext{
+			TrustedCA:                 dataSource{Filename: tls.CAFile},
+			MatchTypedSubjectAltNames: []subjectAltNameMatcher{{SanType: tls.SANType, Matcher: stringMatcher{Exact: tls.ServerName}}},
+		}
+		c.TransportSocket = &namedConfig{Name: "envoy.transport_sockets.tls", TypedConfig: ctx}
+	}
+	return c
+}
+
+// Bootstrap resources
+
+type bootstrap struct {
+	Node             node             `yaml:"node"`
+	StaticResources  staticResources  `yaml:"static_resources"`
+	DynamicResources dynamicResources `yaml:"dynamic_resources"`
+	StatsConfig      statsConfig      `yaml:"stats_config"`
+	Admin            admin            `yaml:"admin"`
+	OverloadManager  overloadManager  `yaml:"overload_manager"`
+	LayeredRuntime   layeredRuntime   `yaml:"layered_runtime"`
+}
+
+type node struct {
+	ID       string    `yaml:"id"`
+	Cluster  string    `yaml:"cluster"`
+	Locality *locality `yaml:"locality,omitempty"`
+}
+
+type staticResources struct {
+	Listeners []listener `yaml:"listeners"`
+	Clusters  []cluster  `yaml:"clusters"`
+}
+
+type dynamicResources struct {
+	LdsConfig configSource `yaml:"lds_config"`
+	CdsConfig configSource `yaml:"cds_config"`
+}
+
+type configSource struct {
+	Path string `yaml:"path"`
+}
+
+type admin struct {
+	Address   address       `yaml:"address"`
+	AccessLog []namedConfig `yaml:"access_log"`
+}
+
+type statsConfig struct {
+	StatsTags []statsTag `yaml:"stats_tags"`
+}
+
+type statsTag struct {
+	TagName    string `yaml:"tag_name"`
+	Regex      string `yaml:"regex,omitempty"`
+	FixedValue string `yaml:"fixed_value,omitempty"`
+}
+
+type overloadManager struct {
+	RefreshInterval  string            `yaml:"refresh_interval"`
+	ResourceMonitors []namedConfig     `yaml:"resource_monitors"`
+	Actions          []overloadTrigger `yaml:"actions,omitempty"`
+}
+
+type downstreamConnectionsConfig struct {
+	Type                           string `yaml:"@type"`
+	MaxActiveDownstreamConnections int    `yaml:"max_active_downstream_connections"`
+}
+
+type fixedHeapConfig struct {
+	Type             string `yaml:"@type"`
+	MaxHeapSizeBytes uint64 `yaml:"max_heap_size_bytes"`
+}
+
+type overloadTrigger struct {
+	Name     string    `yaml:"name"`
+	Triggers []trigger `yaml:"triggers"`
+}
+
+type trigger struct {
+	Name      string  `yaml:"name"`
+	Threshold percent `yaml:"threshold"`
+}
+
+type layeredRuntime struct {
+	Layers []runtimeLayer `yaml:"layers"`
+}
+
+type runtimeLayer struct {
+	Name        string   `yaml:"name"`
+	StaticLayer struct{} `yaml:"static_layer"`
+}
+
+// buildBootstrap builds the bootstrap configuration. Listeners and clusters
+// are loaded from files next to it.
+func buildBootstrap(data *bootstrapData) bootstrap {
+	b := bootstrap{
+		Node:            node{ID: data.NodeID, Cluster: "vpsie-loadbalancers"},
+		StaticResources: staticResources{Listeners: []listener{}, Clusters: []cluster{}},
+		DynamicResources: dynamicResources{
+			LdsConfig: configSource{Path: data.ConfigPath + "/listeners.yaml"},
+			CdsConfig: configSource{Path: data.ConfigPath + "/clusters.yaml"},
+		},
+		Admin: admin{
+			Address:   address{SocketAddress: socketAddress{Address: data.AdminAddress, PortValue: data.AdminPort}},
+			AccessLog: accessLog("/var/log/envoy/admin.log", nil),
+		},
+		OverloadManager: overloadManager{
+			RefreshInterval: "0.25s",
+			ResourceMonitors: []namedConfig{{
+				Name: "envoy.resource_monitors.global_downstream_max_connections",
+				TypedConfig: downstreamConnectionsConfig{
+					Type:                           typeDownstreamConnections,
+					MaxActiveDownstreamConnections: data.MaxConnections,
+				},
+			}},
+		},
+		LayeredRuntime: layeredRuntime{Layers: []runtimeLayer{{Name: "static_layer"}}},
+	}
+	for _, tag := range data.StatsTags {
+		b.StatsConfig.StatsTags = append(b.StatsConfig.StatsTags, statsTag{TagName: tag.Name, Regex: tag.Regex, FixedValue: tag.FixedValue})
+	}
+	if l := data.Locality; l != nil {
+		b.Node.Locality = &locality{Region: l.Region, Zone: l.Zone}
+	}
+
+	if overload := data.Overload; overload != nil {
+		b.OverloadManager.ResourceMonitors = append(b.OverloadManager.ResourceMonitors, namedConfig{
+			Name:        fixedHeapMonitor,
+			TypedConfig: fixedHeapConfig{Type: typeFixedHeap, MaxHeapSizeBytes: overload.MaxHeapBytes},
+		})
+		for _, action := range overload.Actions {
+			b.OverloadManager.Actions = append(b.OverloadManager.Actions, overloadTrigger{
+				Name:     action.Name,
+				Triggers: []trigger{{Name: fixedHeapMonitor, Threshold: percent{Value: action.Threshold}}},
+			})
+		}
+	}
+	return b
+}
@@ -0,0 +1,87 @@
+package envoy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Host health states reported by HostStatuses
+const (
+	HostHealthy   = "healthy"
+	HostUnhealthy = "unhealthy" // failed active health checks
+	HostEjected   = "ejected"   // ejected by outlier detection
+	HostPending   = "pending"   // waiting for its first active health check
+	HostDraining  = "draining"  // removed from the configuration, still serving connections
+)
+
+// HostStatus is the health of one upstream host as Envoy sees it
+type HostStatus struct {
+	Cluster  string
+	Address  string // host:port
+	Hostname string // DNS name the address was resolved from, if any
+	Health   string
+}
+
+// clustersResponse is the subset of GET /clusters?format=json used here
+type clustersResponse struct {
+	ClusterStatuses []struct {
+		Name         string `json:"name"`
+		HostStatuses []struct {
+			Address struct {
+				SocketAddress struct {
+					Address   string `json:"address"`
+					PortValue int    `json:"port_value"`
+				} `json:"socket_address"`
+			} `json:"address"`
+			Hostname     string `json:"hostname"`
+			HealthStatus struct {
+				FailedActiveHealthCheck  bool   `json:"failed_active_health_check"`
+				FailedOutlierCheck       bool   `json:"failed_outlier_check"`
+				PendingActiveHealthCheck bool   `json:"pending_active_hc"`
+				PendingDynamicRemoval    bool   `json:"pending_dynamic_removal"`
+				EDSHealthStatus          string `json:"eds_health_status"`
+			} `json:"health_status"`
+		} `json:"host_statuses"`
+	} `json:"cluster_statuses"`
+}
+
+// maxClustersSize bounds a /clusters response
+const maxClustersSize = 8 << 20
+
+// HostStatuses returns the health of every upstream host of every cluster
+func (c *AdminClient) HostStatuses(ctx context.Context) ([]HostStatus, error) {
+	var body clustersResponse
+	if err := c.getJSONLimit(ctx, "/clusters?format=json", &body, maxClustersSize); err != nil {
+		return nil, fmt.Errorf("failed to query Envoy clusters: %w", err)
+	}
+
+	var hosts []HostStatus
+	for _, cluster := range body.ClusterStatuses {
+		for _, host := range cluster.HostStatuses {
+			status := HostStatus{
+				Cluster:  cluster.Name,
+				Address:  net.JoinHostPort(host.Address.SocketAddress.Address, strconv.Itoa(host.Address.SocketAddress.PortValue)),
+				Hostname: host.Hostname,
+				Health:   HostHealthy,
+			}
+			health := host.HealthStatus
+			switch {
+			case health.PendingDynamicRemoval:
+				status.Health = HostDraining
+			case health.FailedActiveHealthCheck:
+				status.Health = HostUnhealthy
+			case health.PendingActiveHealthCheck:
+				status.Health = HostPending
+			case health.FailedOutlierCheck:
+				status.Health = HostEjected
+			case health.EDSHealthStatus != "" && health.EDSHealthStatus != "HEALTHY":
+				status.Health = strings.ToLower(health.EDSHealthStatus)
+			}
+			hosts = append(hosts, status)
+		}
+	}
+	return hosts, nil
+}
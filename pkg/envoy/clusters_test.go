@@ -0,0 +1,42 @@
+package envoy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAdminClient_HostStatuses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/clusters" || r.URL.Query().Get("format") != "json" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"cluster_statuses": [{"name": "cluster_lb-1", "host_statuses": [
+			{"address": {"socket_address": {"address": "10.0.0.1", "port_value": 8080}}, "health_status": {"eds_health_status": "HEALTHY"}},
+			{"address": {"socket_address": {"address": "10.0.0.2", "port_value": 8080}}, "health_status": {"failed_active_health_check": true, "eds_health_status": "HEALTHY"}},
+			{"address": {"socket_address": {"address": "10.0.0.3", "port_value": 8080}}, "health_status": {"failed_outlier_check": true}},
+			{"address": {"socket_address": {"address": "10.0.0.4", "port_value": 8080}}, "hostname": "app.internal", "health_status": {"pending_active_hc": true}},
+			{"address": {"socket_address": {"address": "10.0.0.5", "port_value": 8080}}, "health_status": {"eds_health_status": "DEGRADED"}}
+		]}]}`))
+	}))
+	defer server.Close()
+
+	hosts, err := NewAdminClient(strings.TrimPrefix(server.URL, "http://")).HostStatuses(context.Background())
+	if err != nil {
+		t.Fatalf("HostStatuses() error = %v", err)
+	}
+	want := []HostStatus{
+		{Cluster: "cluster_lb-1", Address: "10.0.0.1:8080", Health: HostHealthy},
+		{Cluster: "cluster_lb-1", Address: "10.0.0.2:8080", Health: HostUnhealthy},
+		{Cluster: "cluster_lb-1", Address: "10.0.0.3:8080", Health: HostEjected},
+		{Cluster: "cluster_lb-1", Address: "10.0.0.4:8080", Hostname: "app.internal", Health: HostPending},
+		{Cluster: "cluster_lb-1", Address: "10.0.0.5:8080", Health: "degraded"},
+	}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Errorf("HostStatuses() = %+v, want %+v", hosts, want)
+	}
+}
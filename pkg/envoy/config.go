@@ -1,12 +1,22 @@
 package envoy
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
+// Files written in snapshot output mode
+const (
+	// SnapshotFile is the xDS snapshot
+	SnapshotFile = "xds-snapshot.json"
+	// SnapshotDeltaFile holds the changes from the previous snapshot
+	SnapshotDeltaFile = "xds-delta.json"
+)
+
 // ConfigManager manages Envoy configuration files
 type ConfigManager struct {
 	validator *Validator
@@ -80,10 +90,84 @@ func (cm *ConfigManager) WriteClusters(data []byte) error {
 	return cm.writeConfigFile("clusters.yaml", data)
 }
 
+// BootstrapPath returns the bootstrap file Envoy is started with, next to the config directory
+func (cm *ConfigManager) BootstrapPath() string {
+	return filepath.Join(cm.baseDir, "bootstrap.yaml")
+}
+
+// Files returns the files Envoy reads: the bootstrap and the dynamic
+// listener and cluster configuration
+func (cm *ConfigManager) Files() []string {
+	return []string{
+		cm.BootstrapPath(),
+		filepath.Join(cm.configDir, "listeners.yaml"),
+		filepath.Join(cm.configDir, "clusters.yaml"),
+	}
+}
+
 // WriteBootstrap writes the bootstrap configuration to file
 func (cm *ConfigManager) WriteBootstrap(data []byte) error {
-	bootstrapPath := filepath.Join(filepath.Dir(cm.configDir), "bootstrap.yaml")
-	return cm.atomicWrite(bootstrapPath, data)
+	return cm.atomicWrite(cm.BootstrapPath(), data)
+}
+
+// UpdateBootstrap replaces the bootstrap file with data if it differs. The
+// new bootstrap is validated with Envoy before it replaces the old one. It
+// reports whether the file changed; Envoy only reads the bootstrap when it
+// starts, so a change needs a restart.
+func (cm *ConfigManager) UpdateBootstrap(data []byte) (bool, error) {
+	current, err := os.ReadFile(cm.BootstrapPath())
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read bootstrap: %w", err)
+	}
+	if err == nil && bytes.Equal(current, data) {
+		return false, nil
+	}
+
+	candidate := cm.BootstrapPath() + ".new"
+	if err = cm.atomicWrite(candidate, data); err != nil {
+		return false, err
+	}
+	defer func() { _ = os.Remove(candidate) }()
+
+	if err = cm.validator.ValidateBootstrap(candidate); err != nil {
+		return false, err
+	}
+	if err = cm.WriteBootstrap(data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WriteSnapshot writes an xDS snapshot for external control planes
+func (cm *ConfigManager) WriteSnapshot(snapshot *Snapshot) error {
+	data, err := snapshot.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	return cm.writeConfigFile(SnapshotFile, data)
+}
+
+// ReadSnapshot reads the xDS snapshot last written
+func (cm *ConfigManager) ReadSnapshot() (*Snapshot, error) {
+	// #nosec G304 -- the config directory comes from the agent configuration
+	data, err := os.ReadFile(filepath.Join(cm.configDir, SnapshotFile))
+	if err != nil {
+		return nil, err
+	}
+	var snapshot Snapshot
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// WriteSnapshotDelta writes the changes from the previous xDS snapshot
+func (cm *ConfigManager) WriteSnapshotDelta(delta *SnapshotDelta) error {
+	data, err := delta.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot delta: %w", err)
+	}
+	return cm.writeConfigFile(SnapshotDeltaFile, data)
 }
 
 // ApplyConfig applies a complete Envoy configuration
@@ -3,6 +3,7 @@ package envoy
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -303,3 +304,77 @@ func TestConfigManager_AtomicWrite_CreatesDirectory(t *testing.T) {
 		t.Errorf("File content = %v, want %v", string(content), string(data))
 	}
 }
+
+func TestConfigManager_WriteSnapshot(t *testing.T) {
+	tmpDir := t.TempDir()
+	cm, err := NewConfigManager(tmpDir, nil)
+	if err != nil {
+		t.Fatalf("NewConfigManager() error = %v", err)
+	}
+
+	snapshot := &Snapshot{
+		Version: "v1",
+		Resources: map[string][]map[string]interface{}{
+			ClusterTypeURL: {{"@type": ClusterTypeURL, "name": "cluster_lb-1"}},
+		},
+	}
+	if err = cm.WriteSnapshot(snapshot); err != nil {
+		t.Fatalf("WriteSnapshot() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, SnapshotFile))
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+	if !strings.Contains(string(data), "cluster_lb-1") {
+		t.Errorf("snapshot file missing cluster resource: %s", data)
+	}
+}
+
+func TestConfigManager_UpdateBootstrap(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     string
+		validate    string // fake envoy exit status
+		wantChanged bool
+		wantErr     bool
+		wantContent string
+	}{
+		{name: "missing bootstrap is written", validate: "exit 0", wantChanged: true, wantContent: "new"},
+		{name: "changed bootstrap is replaced", current: "old", validate: "exit 0", wantChanged: true, wantContent: "new"},
+		{name: "unchanged bootstrap is kept", current: "new", validate: "exit 1", wantContent: "new"},
+		{name: "invalid bootstrap is rejected", current: "old", validate: "exit 1", wantErr: true, wantContent: "old"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseDir := t.TempDir()
+			cm, err := NewConfigManager(filepath.Join(baseDir, "dynamic"), NewValidator(fakeEnvoy(t, tt.validate)))
+			if err != nil {
+				t.Fatalf("NewConfigManager() error = %v", err)
+			}
+			if cm.BootstrapPath() != filepath.Join(baseDir, "bootstrap.yaml") {
+				t.Fatalf("BootstrapPath() = %s, want bootstrap.yaml next to the config directory", cm.BootstrapPath())
+			}
+			if tt.current != "" {
+				if err = os.WriteFile(cm.BootstrapPath(), []byte(tt.current), 0600); err != nil {
+					t.Fatalf("failed to write bootstrap: %v", err)
+				}
+			}
+
+			changed, err := cm.UpdateBootstrap([]byte("new"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateBootstrap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("UpdateBootstrap() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if content, _ := os.ReadFile(cm.BootstrapPath()); string(content) != tt.wantContent {
+				t.Errorf("bootstrap = %q, want %q", content, tt.wantContent)
+			}
+			if _, err = os.Stat(cm.BootstrapPath() + ".new"); !os.IsNotExist(err) {
+				t.Error("candidate bootstrap was left behind")
+			}
+		})
+	}
+}
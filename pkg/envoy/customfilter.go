@@ -0,0 +1,67 @@
+package envoy
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// SetWASMModuleDir sets the directory the agent stores the WASM modules of
+// custom filters in, named by their checksum
+func (g *Generator) SetWASMModuleDir(dir string) {
+	g.wasmModuleDir = dir
+}
+
+// customFilterData is a Lua or WASM filter of an HTTP listener
+type customFilterData struct {
+	Name   string // HTTP filter name
+	Type   string
+	Source string // lua only
+	Module string // wasm only, local file of the module
+	Config string // wasm only
+}
+
+// QuotedSource returns the Lua source as a JSON string, which YAML accepts
+// as a double-quoted scalar
+func (d *customFilterData) QuotedSource() string {
+	quoted, _ := json.Marshal(d.Source)
+	return string(quoted)
+}
+
+// QuotedConfig returns the WASM plugin configuration as a JSON string
+func (d *customFilterData) QuotedConfig() string {
+	quoted, _ := json.Marshal(d.Config)
+	return string(quoted)
+}
+
+// customFilterName returns the HTTP filter name of a custom filter
+func customFilterName(name string) string {
+	return "custom_" + name
+}
+
+// newCustomFiltersData prepares the enabled custom filters in order. WASM
+// modules are loaded from the module directory, where the agent stores them
+// before the configuration is applied.
+func (g *Generator) newCustomFiltersData(lb *models.LoadBalancer) ([]customFilterData, error) {
+	var filters []customFilterData
+	for i := range lb.CustomFilters {
+		f := &lb.CustomFilters[i]
+		if !f.Enabled {
+			continue
+		}
+		data := customFilterData{Name: customFilterName(f.Name), Type: string(f.Type)}
+		if f.Type == models.CustomFilterLua {
+			data.Source = f.Source
+		} else {
+			if g.wasmModuleDir == "" {
+				return nil, fmt.Errorf("load balancer %s uses WASM filter %s but no WASM module directory is configured", lb.ID, f.Name)
+			}
+			data.Module = filepath.Join(g.wasmModuleDir, f.ModuleFile())
+			data.Config = f.Config
+		}
+		filters = append(filters, data)
+	}
+	return filters, nil
+}
@@ -0,0 +1,264 @@
+package envoy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// diffContext is the number of unchanged lines around each change
+	diffContext = 3
+	// maxDiffEdits bounds the work of the line diff; beyond it the whole
+	// file is shown as replaced
+	maxDiffEdits = 2000
+)
+
+// htpasswdDigestRegex matches the SHA-1 digest of an inline basic auth user.
+// The digests are unsalted, so diffs never show them.
+var htpasswdDigestRegex = regexp.MustCompile(`\{SHA\}[A-Za-z0-9+/]{27}=`)
+
+// Diff returns a unified diff from the listeners and clusters on disk to
+// config, empty when nothing changed. A missing file diffs as empty. Basic
+// auth digests are redacted; a file whose only changes are digests is
+// reported as changed without a diff.
+func (cm *ConfigManager) Diff(config *EnvoyConfig) (string, error) {
+	var diff strings.Builder
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{"listeners.yaml", config.Listeners},
+		{"clusters.yaml", config.Clusters},
+	} {
+		current, err := os.ReadFile(filepath.Join(cm.configDir, file.name))
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read %s: %w", file.name, err)
+		}
+		fileDiff := UnifiedDiff("a/"+file.name, "b/"+file.name, redactDigests(current), redactDigests(file.data))
+		if fileDiff == "" && !bytes.Equal(current, file.data) {
+			fileDiff = fmt.Sprintf("Redacted credentials in a/%s and b/%s differ\n", file.name, file.name)
+		}
+		diff.WriteString(fileDiff)
+	}
+	return diff.String(), nil
+}
+
+// redactDigests replaces the basic auth digests in data
+func redactDigests(data []byte) []byte {
+	return htpasswdDigestRegex.ReplaceAll(data, []byte("{SHA}<redacted>"))
+}
+
+// Changed reports which of the listeners and clusters on disk differ from
+// config. A missing file differs from any configuration.
+func (cm *ConfigManager) Changed(config *EnvoyConfig) (listeners, clusters bool, err error) {
+	changed := func(name string, data []byte) (bool, error) {
+		current, readErr := os.ReadFile(filepath.Join(cm.configDir, name))
+		if os.IsNotExist(readErr) {
+			return true, nil
+		}
+		if readErr != nil {
+			return false, fmt.Errorf("failed to read %s: %w", name, readErr)
+		}
+		return !bytes.Equal(current, data), nil
+	}
+	if listeners, err = changed("listeners.yaml", config.Listeners); err != nil {
+		return false, false, err
+	}
+	if clusters, err = changed("clusters.yaml", config.Clusters); err != nil {
+		return false, false, err
+	}
+	return listeners, clusters, nil
+}
+
+// UnifiedDiff returns the changes from old to new in unified diff format,
+// or an empty string when they are equal
+func UnifiedDiff(oldName, newName string, old, new []byte) string {
+	if string(old) == string(new) {
+		return ""
+	}
+	ops := diffLines(splitLines(old), splitLines(new))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(ops); {
+		// Find the next change and extend the hunk while changes are close
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				last = i
+			} else if i-last > 2*diffContext {
+				break
+			}
+		}
+		from := max(first-diffContext, start)
+		to := min(last+diffContext+1, len(ops))
+		writeHunk(&out, ops, from, to)
+		start = to
+	}
+	return out.String()
+}
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed, '+' added
+type diffOp struct {
+	kind    byte
+	line    string
+	oldLine int // 1-based line number in old, for kept and removed lines
+	newLine int // 1-based line number in new, for kept and added lines
+}
+
+// writeHunk writes ops[from:to] as one hunk
+func writeHunk(out *strings.Builder, ops []diffOp, from, to int) {
+	var oldStart, newStart, oldCount, newCount int
+	for _, op := range ops[from:to] {
+		if op.kind != '+' {
+			if oldCount == 0 {
+				oldStart = op.oldLine
+			}
+			oldCount++
+		}
+		if op.kind != '-' {
+			if newCount == 0 {
+				newStart = op.newLine
+			}
+			newCount++
+		}
+	}
+	// An empty range is written as the line before it
+	if oldCount == 0 {
+		oldStart = linesBefore(ops, from, '+')
+	}
+	if newCount == 0 {
+		newStart = linesBefore(ops, from, '-')
+	}
+
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+	for _, op := range ops[from:to] {
+		out.WriteByte(op.kind)
+		out.WriteString(op.line)
+		out.WriteByte('\n')
+	}
+}
+
+// linesBefore counts the lines of one side that precede ops[from]; skip is
+// the kind of operation that does not belong to that side
+func linesBefore(ops []diffOp, from int, skip byte) int {
+	count := 0
+	for _, op := range ops[:from] {
+		if op.kind != skip {
+			count++
+		}
+	}
+	return count
+}
+
+// hunkRange formats a hunk range; a single line omits the count
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits data into lines without their line breaks
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// diffLines computes a shortest edit script from a to b with Myers'
+// algorithm. Inputs needing more than maxDiffEdits edits are shown as
+// entirely replaced.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	// trace[d] holds the furthest x reached on diagonals -d-1..d+1 before step d
+	var trace [][]int
+	limit := min(n+m, maxDiffEdits)
+	offset := limit + 1 // v[k+offset] is the furthest x on diagonal k
+	v := make([]int, 2*limit+3)
+	found := false
+	for d := 0; d <= limit && !found; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+				x = v[k+1+offset]
+			} else {
+				x = v[k-1+offset] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+offset] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return replaceAll(a, b)
+	}
+
+	// Walk back from the end to recover the edits
+	var reversed []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		at := func(k int) int { return trace[d][k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffOp{kind: ' ', line: a[x-1], oldLine: x, newLine: y})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, diffOp{kind: '+', line: b[y-1], newLine: y})
+			} else {
+				reversed = append(reversed, diffOp{kind: '-', line: a[x-1], oldLine: x})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	ops := make([]diffOp, len(reversed))
+	for i, op := range reversed {
+		ops[len(reversed)-1-i] = op
+	}
+	return ops
+}
+
+// replaceAll is the edit script removing all of a and adding all of b
+func replaceAll(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for i, line := range a {
+		ops = append(ops, diffOp{kind: '-', line: line, oldLine: i + 1})
+	}
+	for i, line := range b {
+		ops = append(ops, diffOp{kind: '+', line: line, newLine: i + 1})
+	}
+	return ops
+}
@@ -0,0 +1,174 @@
+package envoy
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(n int) string {
+		var b strings.Builder
+		for i := 1; i <= n; i++ {
+			fmt.Fprintf(&b, "line %d\n", i)
+		}
+		return b.String()
+	}
+
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want string
+	}{
+		{name: "equal", old: "a\nb\n", new: "a\nb\n", want: ""},
+		{
+			name: "new file",
+			old:  "",
+			new:  "a\nb\n",
+			want: "--- a/f\n+++ b/f\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "removed file",
+			old:  "a\n",
+			new:  "",
+			want: "--- a/f\n+++ b/f\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name: "changed line with context",
+			old:  lines(10),
+			new:  strings.Replace(lines(10), "line 5\n", "line five\n", 1),
+			want: "--- a/f\n+++ b/f\n@@ -2,7 +2,7 @@\n line 2\n line 3\n line 4\n-line 5\n+line five\n line 6\n line 7\n line 8\n",
+		},
+		{
+			name: "separate hunks",
+			old:  lines(20),
+			new:  strings.Replace(strings.Replace(lines(20), "line 2\n", "", 1), "line 18\n", "line 18\nadded\n", 1),
+			want: "--- a/f\n+++ b/f\n@@ -1,5 +1,4 @@\n line 1\n-line 2\n line 3\n line 4\n line 5\n" +
+				"@@ -16,5 +15,6 @@\n line 16\n line 17\n line 18\n+added\n line 19\n line 20\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnifiedDiff("a/f", "b/f", []byte(tt.old), []byte(tt.new)); got != tt.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff_Applies(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		old := randomLines(rng)
+		new := randomLines(rng)
+		diff := UnifiedDiff("a/f", "b/f", []byte(old), []byte(new))
+		if got := applyDiff(t, old, diff); got != new {
+			t.Fatalf("applying the diff of\n%q\nto\n%q\ngives %q:\n%s", old, new, got, diff)
+		}
+	}
+}
+
+func TestConfigManager_Diff(t *testing.T) {
+	dir := t.TempDir()
+	cm, err := NewConfigManager(filepath.Join(dir, "dynamic"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &EnvoyConfig{Listeners: []byte("- name: l\n"), Clusters: []byte("- name: c\n")}
+	diff, err := cm.Diff(config)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	for _, want := range []string{"+++ b/listeners.yaml\n@@ -0,0 +1 @@\n+- name: l\n", "+++ b/clusters.yaml\n@@ -0,0 +1 @@\n+- name: c\n"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("Diff() missing %q:\n%s", want, diff)
+		}
+	}
+
+	if err = cm.ApplyConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if diff, err = cm.Diff(config); err != nil || diff != "" {
+		t.Errorf("Diff() of the applied config = %q, %v; want no changes", diff, err)
+	}
+
+	listeners, clusters, err := cm.Changed(&EnvoyConfig{Listeners: config.Listeners, Clusters: []byte("- name: c2\n")})
+	if err != nil || listeners || !clusters {
+		t.Errorf("Changed() = %v, %v, %v; want the clusters only", listeners, clusters, err)
+	}
+
+	// Basic auth digests never appear in a diff
+	const (
+		oldUser = "qa:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="
+		newUser = "qa:{SHA}fEqNCco3Yq9h5ZUglD3CZJT4lBs="
+	)
+	withUsers := &EnvoyConfig{Listeners: []byte("- name: l\n  users: " + oldUser + "\n"), Clusters: config.Clusters}
+	if diff, err = cm.Diff(withUsers); err != nil || strings.Contains(diff, "W6ph5Mm5") || !strings.Contains(diff, "+  users: qa:{SHA}<redacted>\n") {
+		t.Errorf("Diff() adding a user = %q, %v; want the digest redacted", diff, err)
+	}
+	if err = cm.ApplyConfig(withUsers); err != nil {
+		t.Fatal(err)
+	}
+	rotated := &EnvoyConfig{Listeners: []byte("- name: l\n  users: " + newUser + "\n"), Clusters: config.Clusters}
+	if diff, err = cm.Diff(rotated); err != nil || diff != "Redacted credentials in a/listeners.yaml and b/listeners.yaml differ\n" {
+		t.Errorf("Diff() changing a password = %q, %v; want the change reported without digests", diff, err)
+	}
+}
+
+// randomLines returns up to 30 lines drawn from a small alphabet, so that
+// inputs share lines
+func randomLines(rng *rand.Rand) string {
+	var b strings.Builder
+	for i := rng.Intn(30); i > 0; i-- {
+		b.WriteString(strconv.Itoa(rng.Intn(5)))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// applyDiff applies a unified diff produced by UnifiedDiff to old
+func applyDiff(t *testing.T, old, diff string) string {
+	t.Helper()
+	if diff == "" {
+		return old
+	}
+	src := splitLines([]byte(old))
+	var out []string
+	next := 0 // next unconsumed line of src
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "+++ "):
+		case strings.HasPrefix(line, "@@ "):
+			var start int
+			if _, err := fmt.Sscanf(line, "@@ -%d", &start); err != nil {
+				t.Fatalf("bad hunk header %q", line)
+			}
+			if !strings.HasPrefix(line, fmt.Sprintf("@@ -%d,0 ", start)) {
+				start-- // to a 0-based index, unless the range is empty
+			}
+			out = append(out, src[next:start]...)
+			next = start
+		case line[0] == ' ' || line[0] == '-':
+			if next >= len(src) || src[next] != line[1:] {
+				t.Fatalf("context %q does not match old line %d", line, next+1)
+			}
+			if line[0] == ' ' {
+				out = append(out, line[1:])
+			}
+			next++
+		case line[0] == '+':
+			out = append(out, line[1:])
+		}
+	}
+	out = append(out, src[next:]...)
+	if len(out) == 0 {
+		return ""
+	}
+	return strings.Join(out, "\n") + "\n"
+}
@@ -0,0 +1,31 @@
+package envoy
+
+import (
+	"fmt"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// faultFilter is the HTTP filter injecting delays and aborts
+const faultFilter = "envoy.filters.http.fault"
+
+// faultData is the delay and abort a route injects
+type faultData struct {
+	DelayPercent int
+	Delay        string // Envoy duration, empty without delay
+	AbortPercent int
+	AbortStatus  int
+}
+
+// newFaultData returns the faults route injects, or nil
+func newFaultData(route *models.Route) *faultData {
+	f := route.FaultInjection
+	if f == nil {
+		return nil
+	}
+	data := &faultData{DelayPercent: f.DelayPercent, AbortPercent: f.AbortPercent, AbortStatus: f.AbortStatus}
+	if f.DelayPercent > 0 {
+		data.Delay = fmt.Sprintf("%.3fs", float64(f.DelayMs)/1000)
+	}
+	return data
+}
@@ -1,17 +1,44 @@
 package envoy
 
 import (
-	"bytes"
-	_ "embed"
+	"encoding/json"
 	"fmt"
 	"net"
 	"regexp"
-	"text/template"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
 	"gopkg.in/yaml.v3"
 )
 
+// accessLogPath is where listeners write their JSON access logs. Access log
+// timestamps use RFC3339 UTC with nanosecond precision, matching agent events.
+const accessLogPath = "/var/log/envoy/access.log"
+
+// defaultConnectTimeout is the upstream connect timeout (seconds) when the load balancer does not set one
+const defaultConnectTimeout = 5
+
+// strictFailoverFactor is the overprovisioning factor (percent) of clusters
+// with backend priorities: one healthy host out of up to 1000 keeps its
+// priority fully loaded
+const strictFailoverFactor = 100000
+
+// defaultRetryOn is the retry condition used when a retry policy does not list any
+const defaultRetryOn = "connect-failure,refused-stream,reset"
+
+// originalSourceMark is the socket mark of upstream connections made from the
+// client's address; policy routing must send marked replies back to Envoy
+const originalSourceMark = 123
+
+// defaultMaintenanceBody is served by routes in maintenance without a custom body
+const defaultMaintenanceBody = `<!DOCTYPE html><html><head><title>Down for maintenance</title></head>` +
+	`<body><h1>Down for maintenance</h1><p>We will be back shortly.</p></body></html>`
+
+// defaultMaintenanceContentType is the content type of maintenance responses without one
+const defaultMaintenanceContentType = "text/html; charset=utf-8"
+
 var healthCheckPathRegex = regexp.MustCompile(`^/[a-zA-Z0-9/_\-.]*$`)
 
 // validateHealthCheckPath validates that a health check path is safe for template rendering
@@ -44,28 +71,22 @@ func validateAddress(addr string) error {
 	return nil
 }
 
-//go:embed templates/listener_http.yaml.tmpl
-var listenerHTTPTemplate string
-
-//go:embed templates/listener_https.yaml.tmpl
-var listenerHTTPSTemplate string
-
-//go:embed templates/listener_tcp.yaml.tmpl
-var listenerTCPTemplate string
-
-//go:embed templates/cluster.yaml.tmpl
-var clusterTemplate string
-
-//go:embed templates/bootstrap.yaml.tmpl
-var bootstrapTemplate string
-
 // Generator generates Envoy configuration from load balancer models
 type Generator struct {
-	nodeID         string
-	configPath     string
-	adminAddress   string
-	adminPort      int
-	maxConnections int
+	nodeID           string
+	configPath       string
+	adminAddress     string
+	adminPort        int
+	maxConnections   int
+	overload         OverloadConfig
+	locality         Locality
+	statsTags        map[string]string
+	accessLogService string   // host:port of the agent's access log service
+	wafService       string   // host:port of the WAF sidecar
+	wasmModuleDir    string   // where the agent stores WASM modules
+	ticketKeys       []string // session ticket key files, the first one encrypts
+	legacyTemplates  bool
+	xdsEndpoints     bool // snapshots carry endpoints as EDS resources
 }
 
 // NewGenerator creates a new Envoy config generator
@@ -79,179 +100,916 @@ func NewGenerator(nodeID, configPath, adminAddress string, adminPort, maxConnect
 	}
 }
 
+// SetLegacyTemplates renders configuration with the text templates instead
+// of the structured builders. Both produce the same configuration; the
+// templates are kept as a fallback.
+func (g *Generator) SetLegacyTemplates(enabled bool) {
+	g.legacyTemplates = enabled
+}
+
 // GenerateBootstrap generates the Envoy bootstrap configuration
 func (g *Generator) GenerateBootstrap() ([]byte, error) {
-	tmpl, err := template.New("bootstrap").Parse(bootstrapTemplate)
+	data := g.newBootstrapData()
+	if g.legacyTemplates {
+		return renderTemplate(bootstrapTmpl, data)
+	}
+	return marshalYAML(buildBootstrap(data))
+}
+
+// GenerateListener generates an Envoy listener configuration
+func (g *Generator) GenerateListener(lb *models.LoadBalancer) ([]byte, error) {
+	data, err := newListenerData(lb)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse bootstrap template: %w", err)
+		return nil, err
+	}
+	if g.accessLogService != "" && lb.Protocol != models.ProtocolTCP {
+		data.AccessLogService = &accessLogServiceData{ClusterName: AccessLogServiceCluster, LogName: data.Name}
+	}
+	if data.TLSConfig != nil && !data.TLSConfig.DisableSessionTickets {
+		data.TLSConfig.SessionTicketKeys = g.ticketKeys
 	}
+	if lb.WAF != nil && lb.Protocol != models.ProtocolTCP {
+		if data.WAF, err = g.newWAFData(lb); err != nil {
+			return nil, err
+		}
+	}
+	if lb.Protocol != models.ProtocolTCP {
+		if data.CustomFilters, err = g.newCustomFiltersData(lb); err != nil {
+			return nil, err
+		}
+	}
+	listeners := append([]*listenerData{data}, newPortListenersData(lb, data)...)
+	if g.legacyTemplates {
+		return renderListenerTemplates(lb.Protocol, listeners)
+	}
+	built := make([]listener, 0, len(listeners))
+	for _, data := range listeners {
+		built = append(built, buildListener(lb.Protocol, data))
+	}
+	return marshalYAML(built)
+}
 
-	data := map[string]interface{}{
-		"NodeID":         g.nodeID,
-		"ConfigPath":     g.configPath,
-		"AdminAddress":   g.adminAddress,
-		"AdminPort":      g.adminPort,
-		"MaxConnections": g.maxConnections,
+// GenerateCluster generates the Envoy cluster configuration: one cluster for
+// the load balancer's own backends (if any), one per additional port, one
+// per backend pool, one for the trace collector, one per JWT provider's
+// signing keys, one for the authorization service, one for the agent's access
+// log service and one for the WAF sidecar
+func (g *Generator) GenerateCluster(lb *models.LoadBalancer) ([]byte, error) {
+	var clusters []*clusterData
+	if lb.HasDefaultPool() {
+		data, err := newClusterData(lb, nil, ClusterName(lb, ""), lb.Backends, g.locality)
+		if err != nil {
+			return nil, err
+		}
+		if lb.PortRange != nil {
+			forwardToPort(data, lb.ListenPort())
+		}
+		clusters = append(clusters, data)
+	}
+	portClusters, err := newPortClustersData(lb, g.locality)
+	if err != nil {
+		return nil, err
+	}
+	clusters = append(clusters, portClusters...)
+	for i := range lb.Pools {
+		pool := &lb.Pools[i]
+		data, err := newClusterData(lb, pool, ClusterName(lb, pool.Name), pool.Backends, g.locality)
+		if err != nil {
+			return nil, fmt.Errorf("pool %s: %w", pool.Name, err)
+		}
+		clusters = append(clusters, data)
+	}
+	if lb.Tracing != nil && lb.Protocol != models.ProtocolTCP {
+		data, err := newTracingClusterData(lb)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, data)
+	}
+	if lb.JWTAuth != nil && lb.Protocol != models.ProtocolTCP {
+		for i := range lb.JWTAuth.Providers {
+			data, err := newJWKSClusterData(lb, &lb.JWTAuth.Providers[i])
+			if err != nil {
+				return nil, err
+			}
+			clusters = append(clusters, data)
+		}
+	}
+	if lb.Authorization != nil && lb.Protocol != models.ProtocolTCP {
+		data, err := newAuthorizationClusterData(lb)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, data)
+	}
+	if g.accessLogService != "" && lb.Protocol != models.ProtocolTCP {
+		data, err := newGRPCServiceClusterData(AccessLogServiceCluster, g.accessLogService)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, data)
+	}
+	if lb.WAF != nil && lb.Protocol != models.ProtocolTCP && g.wafService != "" {
+		data, err := newGRPCServiceClusterData(WAFCluster, g.wafService)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, data)
 	}
 
-	var buf bytes.Buffer
-	if err = tmpl.Execute(&buf, data); err != nil {
-		return nil, fmt.Errorf("failed to execute bootstrap template: %w", err)
+	if g.legacyTemplates {
+		return renderClusterTemplate(clusters)
 	}
+	built := make([]cluster, 0, len(clusters))
+	for _, data := range clusters {
+		built = append(built, buildCluster(data))
+	}
+	return marshalYAML(built)
+}
 
-	return buf.Bytes(), nil
+// bootstrapData is the bootstrap configuration derived from the agent settings
+type bootstrapData struct {
+	NodeID         string
+	ConfigPath     string
+	AdminAddress   string // host only; the port is AdminPort
+	AdminPort      int
+	MaxConnections int
+	Overload       *overloadData
+	Locality       *Locality // nil when the node has no locality
+	StatsTags      []statsTagData
 }
 
-// GenerateListener generates an Envoy listener configuration
-func (g *Generator) GenerateListener(lb *models.LoadBalancer) ([]byte, error) {
-	var tmpl *template.Template
-	var err error
+// newBootstrapData prepares the bootstrap configuration
+func (g *Generator) newBootstrapData() *bootstrapData {
+	// The admin address is configured as host:port for the agent's admin client
+	adminHost := g.adminAddress
+	if host, _, err := net.SplitHostPort(g.adminAddress); err == nil {
+		adminHost = host
+	}
+	var locality *Locality
+	if g.locality != (Locality{}) {
+		locality = &g.locality
+	}
+	return &bootstrapData{
+		NodeID:         g.nodeID,
+		ConfigPath:     g.configPath,
+		AdminAddress:   adminHost,
+		AdminPort:      g.adminPort,
+		MaxConnections: g.maxConnections,
+		Overload:       g.newOverloadData(),
+		Locality:       locality,
+		StatsTags:      g.newStatsTagsData(),
+	}
+}
+
+// listenerData is the listener configuration of a load balancer
+type listenerData struct {
+	Name               string
+	Addresses          []string // the first is the listener address, the rest additional addresses
+	Freebind           bool     // bind addresses that are not (yet) assigned locally, e.g. floating IPs
+	ReusePort          *bool    // nil keeps Envoy's default
+	FastOpenQueue      int
+	Backlog            int
+	BufferLimit        int
+	IdleTimeout        int                  // seconds, client connections; overrides timeouts.idle for TCP
+	MaxDuration        int                  // seconds, client connections
+	DrainModifyOnly    bool                 // drain only on updates of this listener
+	Keepalive          *models.TCPKeepalive // client connections; zero fields keep the kernel defaults
+	Port               int
+	StatPrefix         string
+	ClusterName        string
+	AccessLogPath      string
+	RouteConfig        *routeConfigData // HTTP and HTTPS only
+	VirtualHosts       []virtualHostData
+	TLSConfig          *tlsData
+	MaxConnectAttempts int // TCP only
+	ConnectionLimit    int
+	ConnectionRate     *connectionRateData
+	SourceMark         int                   // TCP only
+	TLSInspector       bool                  // TCP only, reads the server name of TLS passthrough connections
+	TCPChains          []tcpChainData        // TCP only, in match order
+	HashSourceIP       bool                  // TCP only, hashes connections by client address
+	ProtocolHint       string                // TCP only, the protocol filter before the proxy
+	Redis              *redisData            // TCP only, replaces the TCP proxy
+	ClientIP           *clientIPData         // HTTP and HTTPS only
+	Admission          *admissionData        // HTTP and HTTPS only
+	Tracing            *tracingData          // HTTP and HTTPS only
+	AccessLogService   *accessLogServiceData // HTTP and HTTPS only
+	WAF                *wafData              // HTTP and HTTPS only
+	Authorization      *authorizationData    // HTTP and HTTPS only
+	JWTAuth            *jwtAuthData          // HTTP and HTTPS only
+	RBAC               bool                  // some route restricts its clients
+	BasicAuth          bool                  // some route requires basic authentication
+	Fault              bool                  // some route injects faults
+	CustomFilters      []customFilterData    // HTTP and HTTPS only
+	BandwidthLimits    []bandwidthLimitData  // HTTP and HTTPS only
+	Timeouts           *timeoutData
+}
 
-	// Select template based on protocol
+// connectionRateData is the token bucket of new listener connections,
+// refilled every second
+type connectionRateData struct {
+	Rate  int
+	Burst int
+}
+
+// routeConfigData names the route configuration of an HTTP listener
+type routeConfigData struct {
+	Name string
+}
+
+// virtualHostData is an Envoy virtual host and its routes in match order
+type virtualHostData struct {
+	Name    string
+	Domains []string
+	Routes  []routeData
+}
+
+// routeData is one route: to a cluster, a weighted split, or a direct response
+type routeData struct {
+	Name             string // empty for the default route
+	Path             string
+	Exact            bool
+	Headers          []matchData // cookies are matched as the cookie header
+	QueryParams      []matchData
+	Cluster          string
+	WeightedClusters []weightedClusterData
+	DirectResponse   *directResponseData
+	StatPrefix       string           // empty emits no per-route stats
+	Timeout          int              // seconds, 0 keeps Envoy's route timeout
+	IdleTimeout      int              // seconds, 0 keeps the listener's stream idle timeout
+	RetryPolicy      *retryData       // nil without retries
+	JWT              *routeJWTData    // nil without JWT authentication
+	BasicAuth        *basicAuthData   // nil without basic authentication
+	Access           *routeAccessData // nil when any client may use the route
+	Fault            *faultData       // nil without fault injection
+}
+
+// weightedClusterData is one target of a traffic split
+type weightedClusterData struct {
+	Name   string
+	Weight int
+}
+
+// directResponseData is a static maintenance response
+type directResponseData struct {
+	Status      int
+	Body        string
+	ContentType string
+	RetryAfter  int
+}
+
+// tlsData is the downstream TLS configuration of an HTTPS listener
+type tlsData struct {
+	CertificatePath       string
+	PrivateKeyPath        string
+	MinVersion            string
+	MaxVersion            string
+	ALPN                  []string
+	SessionTimeout        int      // seconds, 0 keeps Envoy's default
+	DisableSessionTickets bool     // stateless resumption off
+	SessionTicketKeys     []string // key files, empty lets Envoy generate its own
+}
+
+// retryData is the route retry policy
+type retryData struct {
+	RetryOn       string
+	NumRetries    int
+	PerTryTimeout int
+}
+
+// newRetryData prepares a route retry policy, nil without retries
+func newRetryData(rp *models.RetryPolicy) *retryData {
+	if rp == nil || rp.NumRetries == 0 {
+		return nil
+	}
+	retryOn := defaultRetryOn
+	if len(rp.RetryOn) > 0 {
+		retryOn = strings.Join(rp.RetryOn, ",")
+	}
+	return &retryData{RetryOn: retryOn, NumRetries: rp.NumRetries, PerTryTimeout: rp.PerTryTimeout}
+}
+
+// timeoutData are the listener timeouts in seconds
+type timeoutData struct {
+	Idle    int
+	Request int
+}
+
+// newListenerData prepares the listener configuration of lb
+func newListenerData(lb *models.LoadBalancer) (*listenerData, error) {
 	switch lb.Protocol {
-	case models.ProtocolHTTP:
-		tmpl, err = template.New("listener").Parse(listenerHTTPTemplate)
-	case models.ProtocolHTTPS:
-		tmpl, err = template.New("listener").Parse(listenerHTTPSTemplate)
-	case models.ProtocolTCP:
-		tmpl, err = template.New("listener").Parse(listenerTCPTemplate)
+	case models.ProtocolHTTP, models.ProtocolHTTPS, models.ProtocolTCP:
 	default:
 		return nil, fmt.Errorf("unsupported protocol: %s", lb.Protocol)
 	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse listener template: %w", err)
+	data := &listenerData{
+		Name:          fmt.Sprintf("listener_%s_%d", lb.Protocol, lb.ListenPort()),
+		Addresses:     lb.ListenAddresses(),
+		Freebind:      len(lb.Addresses) > 0,
+		Port:          lb.ListenPort(),
+		StatPrefix:    listenerStatPrefix(lb),
+		ClusterName:   fmt.Sprintf("cluster_%s", lb.ID),
+		AccessLogPath: accessLogPath,
 	}
 
-	// Prepare template data
-	data := map[string]interface{}{
-		"Name":        fmt.Sprintf("listener_%s_%d", lb.Protocol, lb.Port),
-		"Port":        lb.Port,
-		"StatPrefix":  fmt.Sprintf("%s_%d", lb.Protocol, lb.Port),
-		"ClusterName": fmt.Sprintf("cluster_%s", lb.ID),
+	// Tune the listener sockets
+	if t := lb.Listener; t != nil {
+		data.ReusePort = t.ReusePort
+		data.FastOpenQueue = t.TCPFastOpenQueue
+		data.Backlog = t.Backlog
+		data.BufferLimit = t.BufferLimit
+		data.IdleTimeout = t.IdleTimeout
+		data.MaxDuration = t.MaxConnectionDuration
+		data.DrainModifyOnly = t.DrainType == models.DrainModifyOnly
+		data.Keepalive = t.TCPKeepalive
 	}
 
 	// Add route config for HTTP/HTTPS
 	if lb.Protocol == models.ProtocolHTTP || lb.Protocol == models.ProtocolHTTPS {
-		data["RouteConfig"] = map[string]string{
-			"Name":        "local_route",
-			"VirtualHost": "backend",
-		}
+		data.RouteConfig = &routeConfigData{Name: "local_route"}
+		data.VirtualHosts = virtualHosts(lb)
 	}
 
 	// Add TLS config for HTTPS
 	if lb.Protocol == models.ProtocolHTTPS && lb.TLSConfig != nil {
-		tlsData := map[string]interface{}{
-			"CertificatePath": lb.TLSConfig.CertificatePath,
-			"PrivateKeyPath":  lb.TLSConfig.PrivateKeyPath,
-			"MinVersion":      lb.TLSConfig.MinVersion,
+		data.TLSConfig = &tlsData{
+			CertificatePath:       lb.TLSConfig.CertificatePath,
+			PrivateKeyPath:        lb.TLSConfig.PrivateKeyPath,
+			MinVersion:            lb.TLSConfig.MinVersion,
+			MaxVersion:            lb.TLSConfig.MaxVersion,
+			ALPN:                  lb.TLSConfig.ALPN,
+			SessionTimeout:        lb.TLSConfig.SessionTimeout,
+			DisableSessionTickets: lb.TLSConfig.DisableSessionTickets,
 		}
+	}
 
-		if lb.TLSConfig.MaxVersion != "" {
-			tlsData["MaxVersion"] = lb.TLSConfig.MaxVersion
-		}
+	// Add connect attempts for TCP; HTTP routes carry their retry policy
+	if lb.RetryPolicy != nil && lb.RetryPolicy.NumRetries > 0 && lb.Protocol == models.ProtocolTCP {
+		data.MaxConnectAttempts = lb.RetryPolicy.NumRetries + 1
+	}
 
-		if len(lb.TLSConfig.ALPN) > 0 {
-			tlsData["ALPN"] = lb.TLSConfig.ALPN
+	// Limit concurrent connections to this listener; Envoy closes connections over the limit
+	if lb.MaxConnections > 0 {
+		data.ConnectionLimit = lb.MaxConnections
+	}
+
+	// Limit the rate of new connections; Envoy closes connections once the bucket is empty
+	if lb.DDoS != nil && lb.DDoS.ConnectionRate > 0 {
+		data.ConnectionRate = &connectionRateData{Rate: lb.DDoS.ConnectionRate, Burst: lb.DDoS.Burst()}
+	}
+
+	// Add client address handling: X-Forwarded-For for HTTP, original source for TCP
+	if lb.ClientIP != nil {
+		if lb.Protocol == models.ProtocolTCP {
+			if lb.ClientIP.PreserveSource {
+				data.SourceMark = originalSourceMark
+			}
+		} else {
+			data.ClientIP = newClientIPData(lb.ClientIP)
 		}
+	}
+
+	// Decode the application protocol of TCP load balancers
+	applyTCPProtocolHint(lb, data)
 
-		data["TLSConfig"] = tlsData
+	// Route TLS connections of TCP load balancers by server name
+	if lb.Protocol == models.ProtocolTCP {
+		data.TLSInspector = lb.TLSPassthrough != nil
+		data.TCPChains = newTCPChainsData(lb)
+	}
+
+	// Add load shedding filter for HTTP/HTTPS
+	if lb.Admission != nil && lb.Protocol != models.ProtocolTCP {
+		data.Admission = newAdmissionData(lb.Admission)
+	}
+
+	// Cap the throughput of the listener for HTTP/HTTPS
+	if lb.BandwidthLimit != nil && lb.Protocol != models.ProtocolTCP {
+		data.BandwidthLimits = newBandwidthLimitsData(lb, data.StatPrefix)
+	}
+
+	// Trace requests for HTTP/HTTPS
+	if lb.Tracing != nil && lb.Protocol != models.ProtocolTCP {
+		data.Tracing = newTracingData(lb)
+	}
+
+	// Validate JSON Web Tokens for HTTP/HTTPS
+	if lb.JWTAuth != nil && lb.Protocol != models.ProtocolTCP {
+		data.JWTAuth = newJWTAuthData(lb)
+	}
+
+	// Restrict routes to allowed clients and credentials for HTTP/HTTPS
+	if lb.Protocol != models.ProtocolTCP {
+		data.RBAC, data.BasicAuth = routeFilters(lb)
+		data.Fault = lb.HasFaultInjection()
+	}
+
+	// Check requests with the external authorization service for HTTP/HTTPS
+	if lb.Authorization != nil && lb.Protocol != models.ProtocolTCP {
+		data.Authorization = newAuthorizationData(lb)
 	}
 
 	// Add timeouts if configured
 	if lb.Timeouts != nil {
-		data["Timeouts"] = map[string]int{
-			"Idle":    lb.Timeouts.Idle,
-			"Request": lb.Timeouts.Request,
+		data.Timeouts = &timeoutData{Idle: lb.Timeouts.Idle, Request: lb.Timeouts.Request}
+	}
+
+	// Adapt TCP listeners to protocols spread over several ports
+	applyTCPHelper(lb, data)
+
+	return data, nil
+}
+
+// listenerStatPrefix returns the stat prefix of the listener: the load
+// balancer's own, or <protocol>_<port>_<id>. The ID keeps the statistics of
+// load balancers sharing a node and port apart; '-' is not allowed in the
+// stat names Envoy's tag extraction relies on, so it becomes '_'.
+func listenerStatPrefix(lb *models.LoadBalancer) string {
+	if lb.StatsPrefix != "" {
+		return lb.StatsPrefix
+	}
+	return fmt.Sprintf("%s_%d_%s", lb.Protocol, lb.ListenPort(), strings.ReplaceAll(lb.ID, "-", "_"))
+}
+
+// ClusterName returns the Envoy cluster name for a backend pool; the empty
+// pool is the load balancer's own backends
+func ClusterName(lb *models.LoadBalancer, pool string) string {
+	if pool == "" {
+		return fmt.Sprintf("cluster_%s", lb.ID)
+	}
+	return fmt.Sprintf("cluster_%s_%s", lb.ID, pool)
+}
+
+// weightedClusters renders a traffic split as Envoy weighted_clusters.
+// Targets with weight 0 are left out because they receive no traffic.
+func weightedClusters(lb *models.LoadBalancer, split *models.TrafficSplit) []weightedClusterData {
+	clusters := make([]weightedClusterData, 0, len(split.Targets))
+	for _, target := range split.Targets {
+		if target.Weight == 0 {
+			continue
+		}
+		clusters = append(clusters, weightedClusterData{Name: ClusterName(lb, target.Pool), Weight: target.Weight})
+	}
+	return clusters
+}
+
+// virtualHosts groups routes into Envoy virtual hosts: one per host named by
+// a route, plus a catch-all. Host-less routes apply to every virtual host.
+// Within a virtual host routes are ordered longest path first (exact before
+// prefix on ties) because Envoy uses the first match, and requests that match
+// no route fall through to the load balancer's own backends if it has any.
+func virtualHosts(lb *models.LoadBalancer) []virtualHostData {
+	if len(lb.Routes) == 0 {
+		return []virtualHostData{{
+			Name:    "backend",
+			Domains: []string{"*"},
+			Routes:  []routeData{defaultRoute(lb)},
+		}}
+	}
+
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, route := range lb.Routes {
+		for _, host := range route.Hosts {
+			if !seen[host] {
+				seen[host] = true
+				hosts = append(hosts, host)
+			}
 		}
 	}
 
-	var buf bytes.Buffer
-	if err = tmpl.Execute(&buf, data); err != nil {
-		return nil, fmt.Errorf("failed to execute listener template: %w", err)
+	build := func(name, host string) virtualHostData {
+		var routes []models.Route
+		for _, route := range lb.Routes {
+			if len(route.Hosts) == 0 || containsString(route.Hosts, host) {
+				routes = append(routes, route)
+			}
+		}
+		sort.SliceStable(routes, func(i, j int) bool {
+			if len(routes[i].Path) != len(routes[j].Path) {
+				return len(routes[i].Path) > len(routes[j].Path)
+			}
+			if (routes[i].PathMatch == models.PathMatchExact) != (routes[j].PathMatch == models.PathMatchExact) {
+				return routes[i].PathMatch == models.PathMatchExact
+			}
+			// Routes with conditions go before plain routes for the same path
+			return routes[i].HasConditions() && !routes[j].HasConditions()
+		})
+
+		entries := make([]routeData, 0, len(routes)+1)
+		for _, route := range routes {
+			entry := routeData{
+				Name:       route.Name,
+				Path:       route.Path,
+				Exact:      route.PathMatch == models.PathMatchExact,
+				Cluster:    ClusterName(lb, route.Pool),
+				StatPrefix: route.StatPrefix,
+				JWT:        newRouteJWTData(lb, &route),
+				BasicAuth:  newBasicAuthData(&route),
+				Access:     newRouteAccessData(lb, &route),
+				Fault:      newFaultData(&route),
+			}
+			entry.Headers, entry.QueryParams = newMatchData(&route)
+			if route.Timeouts != nil {
+				entry.Timeout, entry.IdleTimeout = route.Timeouts.Request, route.Timeouts.Idle
+			}
+			// A route's retry policy replaces the load balancer's
+			entry.RetryPolicy = newRetryData(lb.RetryPolicy)
+			if route.RetryPolicy != nil {
+				entry.RetryPolicy = newRetryData(route.RetryPolicy)
+			}
+			if route.Split != nil {
+				entry.WeightedClusters = weightedClusters(lb, route.Split)
+			}
+			if route.Maintenance.Active() {
+				entry.DirectResponse = directResponse(route.Maintenance)
+			} else if lb.Maintenance.Active() {
+				entry.DirectResponse = directResponse(lb.Maintenance)
+			}
+			entries = append(entries, entry)
+		}
+		if lb.HasDefaultPool() {
+			entries = append(entries, defaultRoute(lb))
+		}
+
+		domain := host
+		if host == "" {
+			domain = "*"
+		}
+		return virtualHostData{Name: name, Domains: []string{domain}, Routes: entries}
 	}
 
-	return buf.Bytes(), nil
+	vhosts := make([]virtualHostData, 0, len(hosts)+1)
+	for i, host := range hosts {
+		vhosts = append(vhosts, build(fmt.Sprintf("vhost_%d", i), host))
+	}
+	// Without host-less routes or default backends there is no catch-all;
+	// Envoy answers requests for unknown hosts with 404
+	if catchAll := build("backend", ""); len(catchAll.Routes) > 0 {
+		vhosts = append(vhosts, catchAll)
+	}
+	return vhosts
 }
 
-// GenerateCluster generates an Envoy cluster configuration
-func (g *Generator) GenerateCluster(lb *models.LoadBalancer) ([]byte, error) {
-	tmpl, err := template.New("cluster").Parse(clusterTemplate)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse cluster template: %w", err)
+// defaultRoute sends every request to the load balancer's own backends
+func defaultRoute(lb *models.LoadBalancer) routeData {
+	entry := routeData{Path: "/", Cluster: ClusterName(lb, ""), RetryPolicy: newRetryData(lb.RetryPolicy), JWT: newRouteJWTData(lb, nil)}
+	if lb.Maintenance.Active() {
+		entry.DirectResponse = directResponse(lb.Maintenance)
+	}
+	return entry
+}
+
+// directResponse prepares the static maintenance response, applying defaults
+func directResponse(m *models.Maintenance) *directResponseData {
+	status := m.StatusCode
+	if status == 0 {
+		status = models.DefaultMaintenanceStatus
+	}
+	body := m.Body
+	if body == "" {
+		body = defaultMaintenanceBody
+	}
+	contentType := m.ContentType
+	if contentType == "" {
+		contentType = defaultMaintenanceContentType
+	}
+	return &directResponseData{Status: status, Body: body, ContentType: contentType, RetryAfter: m.RetryAfter}
+}
+
+// QuotedBody returns the body as a JSON string, which YAML accepts as a
+// double-quoted scalar, so any text is safe in the template
+func (d *directResponseData) QuotedBody() string {
+	quoted, _ := json.Marshal(d.Body)
+	return string(quoted)
+}
+
+// QuotedContentType returns the content type as a JSON string
+func (d *directResponseData) QuotedContentType() string {
+	quoted, _ := json.Marshal(d.ContentType)
+	return string(quoted)
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
 	}
+	return false
+}
+
+// clientIPData is the X-Forwarded-For handling of an HTTP listener
+type clientIPData struct {
+	NumTrustedHops int
+	TrustedCIDRs   []cidrData
+	SkipXFFAppend  bool
+	RequestHeaders []string // set to the client address on every request
+}
+
+// cidrData is an address range
+type cidrData struct {
+	Prefix string
+	Length int
+}
+
+// newCIDRData parses address ranges, normalizing them to their network address
+func newCIDRData(cidrs []string) []cidrData {
+	data := make([]cidrData, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue // rejected by validation
+		}
+		length, _ := network.Mask.Size()
+		data = append(data, cidrData{Prefix: network.IP.String(), Length: length})
+	}
+	return data
+}
 
-	// Validate and prepare endpoints
-	endpoints := make([]map[string]interface{}, 0, len(lb.Backends))
-	for _, backend := range lb.Backends {
+// newClientIPData prepares X-Forwarded-For handling. Trusted CIDRs need
+// Envoy's xff original IP detection extension; otherwise the connection
+// manager's own remote address detection is used with the trusted hop count.
+func newClientIPData(c *models.ClientIP) *clientIPData {
+	var headers []string
+	if c.XFFMode == models.XFFOverwrite {
+		headers = append(headers, "x-forwarded-for")
+	}
+	if c.SetRealIP {
+		headers = append(headers, "x-real-ip")
+	}
+
+	return &clientIPData{
+		NumTrustedHops: c.XFFNumTrustedHops,
+		TrustedCIDRs:   newCIDRData(c.TrustedCIDRs),
+		SkipXFFAppend:  c.XFFMode == models.XFFOverwrite || c.XFFMode == models.XFFPreserve,
+		RequestHeaders: headers,
+	}
+}
+
+// admissionData is the load shedding filter of an HTTP listener
+type admissionData struct {
+	Type                 string
+	MaxConcurrency       int
+	TargetLatencyMs      int
+	TargetLatency        string
+	MinRPS               int
+	SuccessRateThreshold float64
+	SamplingWindow       int
+}
+
+// newAdmissionData prepares admission control, applying defaults
+func newAdmissionData(ac *models.AdmissionControl) *admissionData {
+	samplingWindow := ac.SamplingWindow
+	if samplingWindow == 0 {
+		samplingWindow = 30
+	}
+	successRate := ac.SuccessRateThreshold
+	if successRate == 0 {
+		successRate = 95
+	}
+	return &admissionData{
+		Type:                 string(ac.Type),
+		MaxConcurrency:       ac.MaxConcurrency,
+		TargetLatencyMs:      ac.TargetLatencyMs,
+		TargetLatency:        fmt.Sprintf("%.3fs", float64(ac.TargetLatencyMs)/1000),
+		MinRPS:               ac.MinRPS,
+		SuccessRateThreshold: successRate,
+		SamplingWindow:       samplingWindow,
+	}
+}
+
+// clusterData is one upstream cluster
+type clusterData struct {
+	Name                   string
+	ConnectTimeout         int
+	Type                   string // STRICT_DNS or LOGICAL_DNS
+	LoadBalancingAlgo      string
+	DNSLookupFamily        string // empty leaves Envoy's default
+	DNSRefreshRate         int    // seconds, 0 leaves Envoy's default
+	RespectDNSTTL          bool
+	Localities             []localityData // at least one, in ascending priority
+	OverprovisioningFactor int            // 0 leaves Envoy's default
+	HealthCheck            *healthCheckData
+	ProtocolOptions        *protocolOptionsData // HTTP and HTTPS only
+	CircuitBreakers        *circuitBreakerData
+	UpstreamTLS            *upstreamTLSData // nil connects in plain text
+	SlowStart              *slowStartData   // round robin and least request only
+	PreconnectRatio        float64          // 0 opens connections on demand
+	HashByHostname         bool             // ring hash on the endpoint hostnames instead of addresses
+}
+
+// slowStartData ramps the weight of new and recovered endpoints
+type slowStartData struct {
+	Window     int     // seconds
+	Aggression float64 // 0 leaves Envoy's default (linear)
+}
+
+// upstreamTLSData is the TLS connection of a cluster to its endpoints
+type upstreamTLSData struct {
+	ServerName string // sent as SNI and matched against the certificate
+	SANType    string // DNS, or IP_ADDRESS for an IP server name
+	CAFile     string
+}
+
+// endpointData is one enabled backend
+type endpointData struct {
+	Address         string
+	Port            int
+	Weight          int    // 0 leaves Envoy's default weight
+	Hostname        string // the backend ID, rendered only for clusters hashing by hostname
+	HealthCheckPort int    // 0 checks Port
+}
+
+// healthCheckData is the active health check of a cluster
+type healthCheckData struct {
+	Type               string
+	Timeout            int
+	Interval           int
+	UnhealthyThreshold int
+	HealthyThreshold   int
+	Path               string // HTTP based checks only
+	ExpectedStatus     []int
+	Receive            []string // TCP checks only, hex payloads the backend must send
+	Redis              bool     // TCP checks of Redis backends send PING instead
+}
+
+// protocolOptionsData are the upstream HTTP connection settings
+type protocolOptionsData struct {
+	HTTP2                    bool
+	IdleTimeout              int
+	MaxRequestsPerConnection int
+	MaxConcurrentStreams     int
+}
+
+// circuitBreakerData are the cluster's default priority thresholds
+type circuitBreakerData struct {
+	MaxConnections        int
+	MaxPendingRequests    int
+	MaxRequests           int
+	MaxRetries            int
+	RetryBudget           *retryBudgetData
+	MaxConnectionsPerHost int
+}
+
+// retryBudgetData limits retries to a share of the active requests
+type retryBudgetData struct {
+	BudgetPercent       float64
+	MinRetryConcurrency int
+}
+
+// newClusterData prepares the cluster configuration for one set of backends:
+// those of pool, or the load balancer's own when pool is nil
+func newClusterData(lb *models.LoadBalancer, pool *models.BackendPool, name string, backends []models.Backend, node Locality) (*clusterData, error) {
+	strictFailover, discoverAll := false, false
+	var enabled []models.Backend
+	for _, backend := range backends {
 		if !backend.Enabled {
 			continue
 		}
+		enabled = append(enabled, backend)
 
-		// Validate backend address to prevent template injection
+		// Validate backend address and locality to prevent template injection
 		if addrErr := validateAddress(backend.Address); addrErr != nil {
 			return nil, fmt.Errorf("invalid backend address for %s: %w", backend.ID, addrErr)
 		}
-
-		ep := map[string]interface{}{
-			"Address": backend.Address,
-			"Port":    backend.Port,
+		for _, label := range []string{backend.Region, backend.Zone} {
+			if label != "" && !models.LocalityRegex.MatchString(label) {
+				return nil, fmt.Errorf("invalid backend locality for %s: %q", backend.ID, label)
+			}
 		}
+		strictFailover = strictFailover || backend.Priority > 0
+		discoverAll = discoverAll || backend.DiscoverAll
+	}
 
-		if backend.Weight > 0 {
-			ep["Weight"] = backend.Weight
-		}
+	connectTimeout := defaultConnectTimeout
+	if lb.Timeouts != nil && lb.Timeouts.Connect > 0 {
+		connectTimeout = lb.Timeouts.Connect
+	}
+	if pool != nil && pool.ConnectTimeout > 0 {
+		connectTimeout = pool.ConnectTimeout
+	}
 
-		endpoints = append(endpoints, ep)
+	data := &clusterData{
+		Name:              name,
+		ConnectTimeout:    connectTimeout,
+		Type:              "STRICT_DNS",
+		LoadBalancingAlgo: string(lb.Algorithm),
+		Localities:        groupEndpoints(backends, node),
 	}
 
-	// Prepare template data
-	data := map[string]interface{}{
-		"Name":              fmt.Sprintf("cluster_%s", lb.ID),
-		"ConnectTimeout":    5,
-		"LoadBalancingAlgo": string(lb.Algorithm),
-		"Endpoints":         endpoints,
+	// A lone hostname is one logical host that Envoy connects to by name;
+	// other clusters track every address their hostnames resolve to
+	if len(enabled) == 1 && net.ParseIP(enabled[0].Address) == nil && !enabled[0].DiscoverAll {
+		data.Type = "LOGICAL_DNS"
+	}
+	if discoverAll {
+		data.DNSLookupFamily = "ALL"
+	}
+	if lb.DNS != nil {
+		data.DNSRefreshRate = lb.DNS.RefreshRate
+		data.RespectDNSTTL = lb.DNS.RespectTTL
+	}
+
+	// Standby backends get traffic only once no primary backend is healthy,
+	// rather than as soon as the primaries drop below 71% healthy. Without
+	// backend priorities, traffic spills over to other zones gradually.
+	if strictFailover {
+		data.OverprovisioningFactor = strictFailoverFactor
 	}
 
 	// Validate and add health check config
 	if lb.HealthCheck != nil {
+		hc := &healthCheckData{
+			Type:               string(lb.HealthCheck.Type),
+			Timeout:            lb.HealthCheck.Timeout,
+			Interval:           lb.HealthCheck.Interval,
+			UnhealthyThreshold: lb.HealthCheck.UnhealthyThreshold,
+			HealthyThreshold:   lb.HealthCheck.HealthyThreshold,
+		}
 		if lb.HealthCheck.IsHTTPBased() {
 			if pathErr := validateHealthCheckPath(lb.HealthCheck.Path); pathErr != nil {
 				return nil, fmt.Errorf("invalid health check config: %w", pathErr)
 			}
+			hc.Path = lb.HealthCheck.Path
+			hc.ExpectedStatus = lb.HealthCheck.ExpectedStatus
 		}
-		hcData := map[string]interface{}{
-			"Type":               string(lb.HealthCheck.Type),
-			"Timeout":            lb.HealthCheck.Timeout,
-			"Interval":           lb.HealthCheck.Interval,
-			"UnhealthyThreshold": lb.HealthCheck.UnhealthyThreshold,
-			"HealthyThreshold":   lb.HealthCheck.HealthyThreshold,
-		}
+		applyProtocolHealthCheck(lb, hc)
+		data.HealthCheck = hc
+	}
 
-		if lb.HealthCheck.IsHTTPBased() {
-			hcData["Path"] = lb.HealthCheck.Path
-			if len(lb.HealthCheck.ExpectedStatus) > 0 {
-				hcData["ExpectedStatus"] = lb.HealthCheck.ExpectedStatus
+	// Add circuit breakers
+	circuitBreakers := &circuitBreakerData{
+		MaxConnections:     1024,
+		MaxPendingRequests: 1024,
+		MaxRequests:        1024,
+		MaxRetries:         3,
+	}
+	if lb.RetryPolicy != nil && lb.RetryPolicy.HasBudget() {
+		circuitBreakers.RetryBudget = &retryBudgetData{
+			BudgetPercent:       lb.RetryPolicy.BudgetPercent,
+			MinRetryConcurrency: lb.RetryPolicy.MinRetryConcurrency,
+		}
+	}
+	if pool != nil && pool.RetryBudget != nil {
+		circuitBreakers.RetryBudget = &retryBudgetData{
+			BudgetPercent:       pool.RetryBudget.BudgetPercent,
+			MinRetryConcurrency: pool.RetryBudget.MinRetryConcurrency,
+		}
+	}
+	if limits := lb.PoolConnectionPool(pool); limits != nil {
+		circuitBreakers.MaxConnectionsPerHost = limits.MaxConnectionsPerHost
+		// HTTP protocol options only apply to HTTP-aware listeners
+		if lb.Protocol != models.ProtocolTCP && limits.HasHTTPOptions() {
+			data.ProtocolOptions = &protocolOptionsData{
+				HTTP2:                    limits.HTTP2,
+				IdleTimeout:              limits.IdleTimeout,
+				MaxRequestsPerConnection: limits.MaxRequestsPerConnection,
+				MaxConcurrentStreams:     limits.MaxConcurrentStreams,
 			}
 		}
-
-		data["HealthCheck"] = hcData
 	}
+	data.CircuitBreakers = circuitBreakers
 
-	// Add circuit breakers
-	data["CircuitBreakers"] = map[string]int{
-		"MaxConnections":     1024,
-		"MaxPendingRequests": 1024,
-		"MaxRequests":        1024,
-		"MaxRetries":         3,
+	if prewarm := lb.Prewarm; prewarm != nil {
+		if prewarm.Window > 0 {
+			data.SlowStart = &slowStartData{Window: prewarm.Window, Aggression: prewarm.Aggression}
+		}
+		data.PreconnectRatio = prewarm.PreconnectRatio
 	}
 
-	var buf bytes.Buffer
-	if err = tmpl.Execute(&buf, data); err != nil {
-		return nil, fmt.Errorf("failed to execute cluster template: %w", err)
-	}
+	// The FTP helper needs the same backend on every port's cluster, so the
+	// hash ring must not depend on the port
+	data.HashByHostname = lb.Helper == models.TCPHelperFTP
 
-	return buf.Bytes(), nil
+	return data, nil
+}
+
+// newGRPCServiceClusterData prepares the cluster of a gRPC service the agent
+// runs next to Envoy, at address (host:port). gRPC needs HTTP/2.
+func newGRPCServiceClusterData(name, address string) (*clusterData, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s address: %w", name, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid %s port %q", name, portStr)
+	}
+	if err = validateAddress(host); err != nil {
+		return nil, fmt.Errorf("invalid %s address: %w", name, err)
+	}
+	return &clusterData{
+		Name:              name,
+		ConnectTimeout:    defaultConnectTimeout,
+		Type:              "STRICT_DNS",
+		LoadBalancingAlgo: string(models.AlgoRoundRobin),
+		Localities:        []localityData{{Endpoints: []endpointData{{Address: host, Port: port}}}},
+		ProtocolOptions:   &protocolOptionsData{HTTP2: true},
+	}, nil
 }
 
 // GenerateFullConfig generates complete Envoy configuration (listeners + clusters)
@@ -1,10 +1,15 @@
 package envoy
 
 import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"gopkg.in/yaml.v3"
 )
 
 func TestNewGenerator(t *testing.T) {
@@ -44,6 +49,13 @@ func TestGenerator_GenerateBootstrap(t *testing.T) {
 	if dataStr == "" {
 		t.Error("Bootstrap config is empty")
 	}
+	if !strings.Contains(dataStr, "max_active_downstream_connections: 50000") {
+		t.Errorf("bootstrap does not enforce the global connection limit:\n%s", dataStr)
+	}
+	var parsed map[string]interface{}
+	if err = yaml.Unmarshal(data, &parsed); err != nil {
+		t.Errorf("invalid bootstrap YAML: %v", err)
+	}
 }
 
 func TestGenerator_GenerateListener(t *testing.T) {
@@ -191,3 +203,1762 @@ func TestGenerator_GenerateFullConfig(t *testing.T) {
 		t.Error("Clusters config is empty")
 	}
 }
+
+func TestGenerator_GenerateListener_AccessLogTimestamp(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	for _, protocol := range []models.Protocol{models.ProtocolHTTP, models.ProtocolTCP} {
+		lb := &models.LoadBalancer{
+			ID:        "lb-1",
+			Name:      "test-lb",
+			Protocol:  protocol,
+			Algorithm: models.AlgoRoundRobin,
+			Port:      8080,
+		}
+
+		data, err := gen.GenerateListener(lb)
+		if err != nil {
+			t.Fatalf("GenerateListener(%s) error = %v", protocol, err)
+		}
+		if !strings.Contains(string(data), "%START_TIME(%Y-%m-%dT%H:%M:%E9SZ)%") {
+			t.Errorf("%s listener access log missing RFC3339 nanosecond UTC timestamp", protocol)
+		}
+	}
+}
+
+func TestGenerator_AccessLogService(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol models.Protocol
+		want     bool
+	}{
+		{name: "http streams access logs", protocol: models.ProtocolHTTP, want: true},
+		{name: "tcp keeps the file log only", protocol: models.ProtocolTCP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := &models.LoadBalancer{
+				ID: "lb-1", Name: "test-lb", Protocol: tt.protocol, Algorithm: models.AlgoRoundRobin, Port: 8080,
+				Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+				Routes:   []models.Route{{Name: "api", Path: "/api"}},
+			}
+			if tt.protocol == models.ProtocolTCP {
+				lb.Routes = nil
+			}
+
+			var configs [2]*EnvoyConfig
+			for i, legacy := range []bool{false, true} {
+				gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+				gen.SetLegacyTemplates(legacy)
+				gen.SetAccessLogService("127.0.0.1:9903")
+				config, err := gen.GenerateFullConfig(lb)
+				if err != nil {
+					t.Fatalf("GenerateFullConfig(legacy=%v) error = %v", legacy, err)
+				}
+				configs[i] = config
+			}
+			checkSameConfig(t, "listeners", configs[1].Listeners, configs[0].Listeners)
+			checkSameConfig(t, "clusters", configs[1].Clusters, configs[0].Clusters)
+
+			listeners, clusters := string(configs[0].Listeners), string(configs[0].Clusters)
+			for _, want := range []string{"envoy.access_loggers.http_grpc", "log_name: listener_http_8080", "cluster_name: " + AccessLogServiceCluster, "name: api"} {
+				if got := strings.Contains(listeners, want); got != tt.want {
+					t.Errorf("listener contains %q = %v, want %v:\n%s", want, got, tt.want, listeners)
+				}
+			}
+			if got := strings.Contains(clusters, "name: "+AccessLogServiceCluster); got != tt.want {
+				t.Errorf("clusters contain %s = %v, want %v:\n%s", AccessLogServiceCluster, got, tt.want, clusters)
+			}
+		})
+	}
+}
+
+func TestGenerator_SessionTickets(t *testing.T) {
+	keys := []string{"/var/lib/vpsie-lb/session-tickets/key-0", "/var/lib/vpsie-lb/session-tickets/key-1"}
+	tests := []struct {
+		name    string
+		disable bool
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "shared keys",
+			want:    []string{"session_ticket_keys:", "filename: " + keys[0], "filename: " + keys[1]},
+			notWant: []string{"disable_stateless_session_resumption"},
+		},
+		{
+			name:    "tickets disabled",
+			disable: true,
+			want:    []string{"disable_stateless_session_resumption: true"},
+			notWant: []string{"session_ticket_keys:"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := &models.LoadBalancer{
+				ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTPS, Algorithm: models.AlgoRoundRobin, Port: 443,
+				Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+				TLSConfig: &models.TLSConfig{
+					CertificatePath:       "/etc/vpsie-lb/certs/cert.pem",
+					PrivateKeyPath:        "/etc/vpsie-lb/certs/key.pem",
+					MinVersion:            "TLSv1.2",
+					DisableSessionTickets: tt.disable,
+				},
+			}
+
+			var listeners [2][]byte
+			for i, legacy := range []bool{false, true} {
+				gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+				gen.SetLegacyTemplates(legacy)
+				gen.SetSessionTicketKeys(keys)
+				data, err := gen.GenerateListener(lb)
+				if err != nil {
+					t.Fatalf("GenerateListener(legacy=%v) error = %v", legacy, err)
+				}
+				listeners[i] = data
+			}
+			checkSameConfig(t, "listeners", listeners[1], listeners[0])
+
+			listener := string(listeners[0])
+			for _, want := range tt.want {
+				if !strings.Contains(listener, want) {
+					t.Errorf("listener missing %q:\n%s", want, listener)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(listener, notWant) {
+					t.Errorf("listener contains %q:\n%s", notWant, listener)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerator_WAF(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     models.WAFMode
+		wantOpen bool
+	}{
+		{name: "block mode fails closed", mode: models.WAFBlock},
+		{name: "detect mode fails open", mode: models.WAFDetect, wantOpen: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := &models.LoadBalancer{
+				ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 8080,
+				Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+				WAF:      &models.WAF{Mode: tt.mode},
+			}
+
+			var configs [2]*EnvoyConfig
+			for i, legacy := range []bool{false, true} {
+				gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+				gen.SetLegacyTemplates(legacy)
+				gen.SetWAFService("127.0.0.1:9904")
+				config, err := gen.GenerateFullConfig(lb)
+				if err != nil {
+					t.Fatalf("GenerateFullConfig(legacy=%v) error = %v", legacy, err)
+				}
+				configs[i] = config
+			}
+			checkSameConfig(t, "listeners", configs[1].Listeners, configs[0].Listeners)
+			checkSameConfig(t, "clusters", configs[1].Clusters, configs[0].Clusters)
+
+			listeners := string(configs[0].Listeners)
+			for _, want := range []string{"envoy.filters.http.ext_proc", "cluster_name: " + WAFCluster, fmt.Sprintf("failure_mode_allow: %v", tt.wantOpen)} {
+				if !strings.Contains(listeners, want) {
+					t.Errorf("listener does not contain %q:\n%s", want, listeners)
+				}
+			}
+			if !strings.Contains(string(configs[0].Clusters), "name: "+WAFCluster) {
+				t.Errorf("clusters do not contain %s:\n%s", WAFCluster, configs[0].Clusters)
+			}
+		})
+	}
+
+	t.Run("no sidecar", func(t *testing.T) {
+		lb := &models.LoadBalancer{
+			ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 8080,
+			Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+			WAF:      &models.WAF{Mode: models.WAFBlock},
+		}
+		gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+		if _, err := gen.GenerateFullConfig(lb); err == nil {
+			t.Error("GenerateFullConfig() error = nil, want an error without a WAF sidecar")
+		}
+	})
+}
+
+func TestGenerator_AuthorizationGRPC(t *testing.T) {
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 8080,
+		Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+		Authorization: &models.Authorization{
+			Protocol: models.AuthorizationGRPC, Service: "opa.internal:9191", TimeoutMs: 50, FailureMode: models.AuthorizationFailOpen,
+		},
+	}
+
+	var configs [2]*EnvoyConfig
+	for i, legacy := range []bool{false, true} {
+		gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+		gen.SetLegacyTemplates(legacy)
+		config, err := gen.GenerateFullConfig(lb)
+		if err != nil {
+			t.Fatalf("GenerateFullConfig(legacy=%v) error = %v", legacy, err)
+		}
+		configs[i] = config
+	}
+	checkSameConfig(t, "listeners", configs[1].Listeners, configs[0].Listeners)
+	checkSameConfig(t, "clusters", configs[1].Clusters, configs[0].Clusters)
+
+	listeners := string(configs[0].Listeners)
+	for _, want := range []string{"envoy.filters.http.ext_authz", "cluster_name: authz_lb-1", "timeout: 0.050s", "failure_mode_allow: true"} {
+		if !strings.Contains(listeners, want) {
+			t.Errorf("listener does not contain %q:\n%s", want, listeners)
+		}
+	}
+	if strings.Contains(listeners, "http_service") {
+		t.Errorf("gRPC authorization renders an http_service:\n%s", listeners)
+	}
+	if !strings.Contains(string(configs[0].Clusters), "http2_protocol_options") {
+		t.Errorf("authorization cluster does not speak HTTP/2:\n%s", configs[0].Clusters)
+	}
+}
+
+func TestGenerator_JWTAuth(t *testing.T) {
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 8080,
+		Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+		Routes:   []models.Route{{Name: "public", Path: "/public", JWT: &models.RouteJWT{Disabled: true}}},
+		JWTAuth: &models.JWTAuth{Providers: []models.JWTProvider{
+			{Name: "idp", Issuer: "https://10.0.0.9/", JWKSURI: "https://10.0.0.9/keys"},
+		}},
+	}
+
+	var configs [2]*EnvoyConfig
+	for i, legacy := range []bool{false, true} {
+		gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+		gen.SetLegacyTemplates(legacy)
+		config, err := gen.GenerateFullConfig(lb)
+		if err != nil {
+			t.Fatalf("GenerateFullConfig(legacy=%v) error = %v", legacy, err)
+		}
+		configs[i] = config
+	}
+	checkSameConfig(t, "listeners", configs[1].Listeners, configs[0].Listeners)
+	checkSameConfig(t, "clusters", configs[1].Clusters, configs[0].Clusters)
+
+	listeners, clusters := string(configs[0].Listeners), string(configs[0].Clusters)
+	for _, want := range []string{"disabled: true", "requirement_name: any_provider", "provider_name: idp"} {
+		if !strings.Contains(listeners, want) {
+			t.Errorf("listener does not contain %q:\n%s", want, listeners)
+		}
+	}
+	// Without required claims no RBAC filter is needed
+	if strings.Contains(listeners, "envoy.filters.http.rbac") {
+		t.Errorf("listener contains an RBAC filter without required claims:\n%s", listeners)
+	}
+	for _, want := range []string{"name: jwks_lb-1_idp", "sni: 10.0.0.9", "san_type: IP_ADDRESS", "port_value: 443"} {
+		if !strings.Contains(clusters, want) {
+			t.Errorf("clusters do not contain %q:\n%s", want, clusters)
+		}
+	}
+}
+
+func TestGenerator_BasicAuthFile(t *testing.T) {
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 8080,
+		Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+		Routes: []models.Route{
+			{Name: "admin", Path: "/admin", BasicAuth: &models.BasicAuth{UsersFile: "/etc/vpsie-lb/auth/admin.htpasswd"}},
+			{Name: "office", Path: "/office", AllowedCIDRs: []string{"198.51.100.7/32"}},
+		},
+	}
+
+	var configs [2]*EnvoyConfig
+	for i, legacy := range []bool{false, true} {
+		gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+		gen.SetLegacyTemplates(legacy)
+		config, err := gen.GenerateFullConfig(lb)
+		if err != nil {
+			t.Fatalf("GenerateFullConfig(legacy=%v) error = %v", legacy, err)
+		}
+		configs[i] = config
+	}
+	checkSameConfig(t, "listeners", configs[1].Listeners, configs[0].Listeners)
+
+	listeners := string(configs[0].Listeners)
+	for _, want := range []string{
+		"filename: /etc/vpsie-lb/auth/admin.htpasswd",
+		"name: envoy.filters.http.basic_auth\n                disabled: true",
+		"address_prefix: 198.51.100.7",
+		"prefix_len: 32",
+	} {
+		if !strings.Contains(listeners, want) {
+			t.Errorf("listener does not contain %q:\n%s", want, listeners)
+		}
+	}
+	// Only the restricted routes carry per-route configuration
+	if got := strings.Count(listeners, "typed_per_filter_config"); got != 2 {
+		t.Errorf("listener has %d routes with per-route configuration, want 2:\n%s", got, listeners)
+	}
+}
+
+func TestGenerator_WASMFilterWithoutModuleDir(t *testing.T) {
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 8080,
+		Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+		CustomFilters: []models.CustomFilter{{
+			Name: "geoip", Type: models.CustomFilterWASM, Enabled: true,
+			URL: "https://objects.vpsie.com/geoip.wasm", SHA256: strings.Repeat("a", 64),
+		}},
+	}
+
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+	if _, err := gen.GenerateListener(lb); err == nil {
+		t.Error("GenerateListener() error = nil, want an error without a WASM module directory")
+	}
+
+	// Disabled filters are not rendered, so their modules are not needed
+	lb.CustomFilters[0].Enabled = false
+	config, err := gen.GenerateListener(lb)
+	if err != nil {
+		t.Fatalf("GenerateListener() error = %v", err)
+	}
+	if strings.Contains(string(config), "custom_geoip") {
+		t.Errorf("listener contains the disabled filter:\n%s", config)
+	}
+}
+
+func TestGenerator_ConnectTimeoutAndRetries(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	lb := &models.LoadBalancer{
+		ID:        "lb-1",
+		Name:      "test-lb",
+		Protocol:  models.ProtocolHTTP,
+		Algorithm: models.AlgoRoundRobin,
+		Port:      80,
+		Backends: []models.Backend{
+			{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true},
+		},
+		Timeouts: &models.Timeouts{Connect: 15},
+		RetryPolicy: &models.RetryPolicy{
+			RetryOn:             []string{"5xx", "connect-failure"},
+			NumRetries:          2,
+			PerTryTimeout:       4,
+			BudgetPercent:       20,
+			MinRetryConcurrency: 5,
+		},
+	}
+
+	cluster, err := gen.GenerateCluster(lb)
+	if err != nil {
+		t.Fatalf("GenerateCluster() error = %v", err)
+	}
+	for _, want := range []string{"connect_timeout: 15s", "retry_budget:", "value: 20", "min_retry_concurrency: 5"} {
+		if !strings.Contains(string(cluster), want) {
+			t.Errorf("cluster config missing %q:\n%s", want, cluster)
+		}
+	}
+
+	listener, err := gen.GenerateListener(lb)
+	if err != nil {
+		t.Fatalf("GenerateListener() error = %v", err)
+	}
+	for _, want := range []string{"retry_on: 5xx,connect-failure", "num_retries: 2", "per_try_timeout: 4s"} {
+		if !strings.Contains(string(listener), want) {
+			t.Errorf("listener config missing %q:\n%s", want, listener)
+		}
+	}
+
+	// Default connect timeout and TCP connect attempts
+	lb.Timeouts = nil
+	lb.Protocol = models.ProtocolTCP
+	cluster, err = gen.GenerateCluster(lb)
+	if err != nil {
+		t.Fatalf("GenerateCluster() error = %v", err)
+	}
+	if !strings.Contains(string(cluster), "connect_timeout: 5s") {
+		t.Errorf("expected default connect timeout:\n%s", cluster)
+	}
+	listener, err = gen.GenerateListener(lb)
+	if err != nil {
+		t.Fatalf("GenerateListener() error = %v", err)
+	}
+	if !strings.Contains(string(listener), "max_connect_attempts: 3") {
+		t.Errorf("expected TCP max_connect_attempts:\n%s", listener)
+	}
+}
+
+func TestGenerator_PoolConnectTimeoutAndRetryBudget(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	lb := &models.LoadBalancer{
+		ID:          "lb-1",
+		Name:        "test-lb",
+		Protocol:    models.ProtocolHTTP,
+		Algorithm:   models.AlgoRoundRobin,
+		Port:        80,
+		Timeouts:    &models.Timeouts{Connect: 2},
+		RetryPolicy: &models.RetryPolicy{NumRetries: 2, BudgetPercent: 20},
+		Pools: []models.BackendPool{
+			{Name: "local", Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}}},
+			{
+				Name:           "onprem",
+				Backends:       []models.Backend{{ID: "be-2", Address: "192.0.2.10", Port: 8080, Enabled: true}},
+				ConnectTimeout: 20,
+				RetryBudget:    &models.RetryBudget{BudgetPercent: 50, MinRetryConcurrency: 10},
+			},
+		},
+		Routes: []models.Route{
+			{Name: "local", Path: "/", Pool: "local"},
+			{Name: "onprem", Path: "/legacy", Pool: "onprem"},
+		},
+	}
+
+	data, err := gen.GenerateCluster(lb)
+	if err != nil {
+		t.Fatalf("GenerateCluster() error = %v", err)
+	}
+	var clusters []map[string]interface{}
+	if err = yaml.Unmarshal(data, &clusters); err != nil {
+		t.Fatalf("invalid cluster YAML: %v\n%s", err, data)
+	}
+	byName := make(map[string]string, len(clusters))
+	for _, cluster := range clusters {
+		out, marshalErr := yaml.Marshal(cluster)
+		if marshalErr != nil {
+			t.Fatal(marshalErr)
+		}
+		byName[cluster["name"].(string)] = string(out)
+	}
+
+	tests := []struct {
+		cluster string
+		want    []string
+	}{
+		{cluster: "cluster_lb-1_local", want: []string{"connect_timeout: 2s", "value: 20"}},
+		{cluster: "cluster_lb-1_onprem", want: []string{"connect_timeout: 20s", "value: 50", "min_retry_concurrency: 10"}},
+	}
+	for _, tt := range tests {
+		for _, want := range tt.want {
+			if !strings.Contains(byName[tt.cluster], want) {
+				t.Errorf("%s missing %q:\n%s", tt.cluster, want, byName[tt.cluster])
+			}
+		}
+	}
+}
+
+func TestGenerator_GenerateCluster_ConnectionPool(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	lb := &models.LoadBalancer{
+		ID:        "lb-1",
+		Name:      "test-lb",
+		Protocol:  models.ProtocolHTTP,
+		Algorithm: models.AlgoRoundRobin,
+		Port:      80,
+		Backends: []models.Backend{
+			{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true},
+		},
+		ConnectionPool: &models.ConnectionPool{
+			MaxConnectionsPerHost: 20,
+			HTTP2:                 true,
+			MaxConcurrentStreams:  64,
+			IdleTimeout:           30,
+		},
+	}
+
+	data, err := gen.GenerateCluster(lb)
+	if err != nil {
+		t.Fatalf("GenerateCluster() error = %v", err)
+	}
+
+	var clusters []map[string]interface{}
+	if err = yaml.Unmarshal(data, &clusters); err != nil {
+		t.Fatalf("invalid cluster YAML: %v\n%s", err, data)
+	}
+
+	for _, want := range []string{"per_host_thresholds:", "max_connections: 20", "max_concurrent_streams: 64", "idle_timeout: 30s"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("cluster config missing %q:\n%s", want, data)
+		}
+	}
+
+	// HTTP protocol options are not rendered for TCP load balancers
+	lb.Protocol = models.ProtocolTCP
+	lb.ConnectionPool = &models.ConnectionPool{MaxConnectionsPerHost: 20, IdleTimeout: 30}
+	data, err = gen.GenerateCluster(lb)
+	if err != nil {
+		t.Fatalf("GenerateCluster() error = %v", err)
+	}
+	if strings.Contains(string(data), "HttpProtocolOptions") {
+		t.Errorf("TCP cluster must not have HTTP protocol options:\n%s", data)
+	}
+}
+
+func TestGenerator_PoolConnectionPool(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	lb := &models.LoadBalancer{
+		ID:             "lb-1",
+		Name:           "test-lb",
+		Protocol:       models.ProtocolHTTP,
+		Algorithm:      models.AlgoRoundRobin,
+		Port:           80,
+		ConnectionPool: &models.ConnectionPool{MaxConnectionsPerHost: 200, IdleTimeout: 30},
+		Pools: []models.BackendPool{
+			{Name: "api", Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}}},
+			{
+				Name:           "legacy",
+				Backends:       []models.Backend{{ID: "be-2", Address: "10.0.0.2", Port: 8080, Enabled: true}},
+				ConnectionPool: &models.ConnectionPool{MaxConnectionsPerHost: 8},
+			},
+		},
+		Routes: []models.Route{
+			{Name: "api", Path: "/", Pool: "api"},
+			{Name: "legacy", Path: "/legacy", Pool: "legacy"},
+		},
+	}
+
+	data, err := gen.GenerateCluster(lb)
+	if err != nil {
+		t.Fatalf("GenerateCluster() error = %v", err)
+	}
+	var clusters []map[string]interface{}
+	if err = yaml.Unmarshal(data, &clusters); err != nil {
+		t.Fatalf("invalid cluster YAML: %v\n%s", err, data)
+	}
+	byName := make(map[string]string, len(clusters))
+	for _, cluster := range clusters {
+		out, marshalErr := yaml.Marshal(cluster)
+		if marshalErr != nil {
+			t.Fatal(marshalErr)
+		}
+		byName[cluster["name"].(string)] = string(out)
+	}
+
+	// The pool's override replaces the per-host limit and keeps the idle timeout
+	tests := []struct {
+		cluster string
+		want    []string
+	}{
+		{cluster: "cluster_lb-1_api", want: []string{"max_connections: 200", "idle_timeout: 30s"}},
+		{cluster: "cluster_lb-1_legacy", want: []string{"max_connections: 8", "idle_timeout: 30s"}},
+	}
+	for _, tt := range tests {
+		for _, want := range tt.want {
+			if !strings.Contains(byName[tt.cluster], want) {
+				t.Errorf("%s missing %q:\n%s", tt.cluster, want, byName[tt.cluster])
+			}
+		}
+	}
+}
+
+func TestGenerator_GenerateCluster_Prewarm(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	tests := []struct {
+		name      string
+		algorithm models.LoadBalancingAlgo
+		prewarm   *models.Prewarm
+		want      []string
+		unwanted  []string
+	}{
+		{
+			name:      "round robin slow start",
+			algorithm: models.AlgoRoundRobin,
+			prewarm:   &models.Prewarm{Window: 30},
+			want:      []string{"round_robin_lb_config:", "slow_start_window: 30s"},
+			unwanted:  []string{"aggression:", "preconnect_policy:"},
+		},
+		{
+			name:      "least request slow start with aggression",
+			algorithm: models.AlgoLeastRequest,
+			prewarm:   &models.Prewarm{Window: 120, Aggression: 2},
+			want:      []string{"least_request_lb_config:", "slow_start_window: 120s", "default_value: 2"},
+			unwanted:  []string{"round_robin_lb_config:"},
+		},
+		{
+			name:      "preconnect only",
+			algorithm: models.AlgoRingHash,
+			prewarm:   &models.Prewarm{PreconnectRatio: 1.5},
+			want:      []string{"per_upstream_preconnect_ratio: 1.5"},
+			unwanted:  []string{"slow_start_config:"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := &models.LoadBalancer{
+				ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTP, Algorithm: tt.algorithm, Port: 80,
+				Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}},
+				Prewarm:  tt.prewarm,
+			}
+			if err := lb.Validate(); err != nil {
+				t.Fatalf("fixture is invalid: %v", err)
+			}
+			data, err := gen.GenerateCluster(lb)
+			if err != nil {
+				t.Fatalf("GenerateCluster() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("cluster config missing %q:\n%s", want, data)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(string(data), unwanted) {
+					t.Errorf("cluster config has unexpected %q:\n%s", unwanted, data)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerator_GenerateCluster_Priorities(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	tests := []struct {
+		name       string
+		backends   []models.Backend
+		priorities []int // priority of each endpoint group
+		failover   bool
+	}{
+		{
+			name:       "single priority",
+			backends:   []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+			priorities: []int{0},
+		},
+		{
+			name: "standby",
+			backends: []models.Backend{
+				{ID: "standby", Address: "10.0.1.1", Port: 80, Priority: 1, Enabled: true},
+				{ID: "primary", Address: "10.0.0.1", Port: 80, Enabled: true},
+			},
+			priorities: []int{0, 1},
+			failover:   true,
+		},
+		{
+			name: "primaries disabled",
+			backends: []models.Backend{
+				{ID: "primary", Address: "10.0.0.1", Port: 80, Enabled: false},
+				{ID: "standby", Address: "10.0.1.1", Port: 80, Priority: 1, Enabled: true},
+			},
+			priorities: []int{0}, // Envoy priorities are numbered without gaps
+			failover:   true,
+		},
+		{
+			name:       "no enabled backends",
+			backends:   []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Priority: 2, Enabled: false}},
+			priorities: []int{0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := &models.LoadBalancer{ID: "lb-1", Protocol: models.ProtocolTCP, Algorithm: models.AlgoLeastRequest, Port: 80, Backends: tt.backends}
+			data, err := gen.GenerateCluster(lb)
+			if err != nil {
+				t.Fatalf("GenerateCluster() error = %v", err)
+			}
+
+			var clusters []cluster
+			if err = yaml.Unmarshal(data, &clusters); err != nil {
+				t.Fatalf("invalid cluster YAML: %v\n%s", err, data)
+			}
+			assignment := clusters[0].LoadAssignment
+			var got []int
+			for _, group := range assignment.Endpoints {
+				got = append(got, group.Priority)
+			}
+			if !reflect.DeepEqual(got, tt.priorities) {
+				t.Errorf("endpoint priorities = %v, want %v\n%s", got, tt.priorities, data)
+			}
+			if failover := assignment.Policy != nil && assignment.Policy.OverprovisioningFactor == strictFailoverFactor; failover != tt.failover {
+				t.Errorf("strict failover policy = %v, want %v\n%s", failover, tt.failover, data)
+			}
+		})
+	}
+}
+
+func TestGenerator_GenerateCluster_DNS(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	tests := []struct {
+		name       string
+		backends   []models.Backend
+		wantType   string
+		wantFamily string
+	}{
+		{
+			name:     "IP address",
+			backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+			wantType: "STRICT_DNS",
+		},
+		{
+			name:     "lone hostname",
+			backends: []models.Backend{{ID: "be-1", Address: "api.example.com", Port: 80, Enabled: true}},
+			wantType: "LOGICAL_DNS",
+		},
+		{
+			name: "lone enabled hostname",
+			backends: []models.Backend{
+				{ID: "be-1", Address: "api.example.com", Port: 80, Enabled: true},
+				{ID: "be-2", Address: "10.0.0.1", Port: 80, Enabled: false},
+			},
+			wantType: "LOGICAL_DNS",
+		},
+		{
+			name:       "discover all",
+			backends:   []models.Backend{{ID: "be-1", Address: "api.example.com", Port: 80, DiscoverAll: true, Enabled: true}},
+			wantType:   "STRICT_DNS",
+			wantFamily: "ALL",
+		},
+		{
+			name: "several hostnames",
+			backends: []models.Backend{
+				{ID: "be-1", Address: "a.example.com", Port: 80, Enabled: true},
+				{ID: "be-2", Address: "b.example.com", Port: 80, Enabled: true},
+			},
+			wantType: "STRICT_DNS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := &models.LoadBalancer{ID: "lb-1", Protocol: models.ProtocolTCP, Algorithm: models.AlgoRoundRobin, Port: 80, Backends: tt.backends}
+			data, err := gen.GenerateCluster(lb)
+			if err != nil {
+				t.Fatalf("GenerateCluster() error = %v", err)
+			}
+			var clusters []cluster
+			if err = yaml.Unmarshal(data, &clusters); err != nil {
+				t.Fatalf("invalid cluster YAML: %v\n%s", err, data)
+			}
+			if got := clusters[0]; got.Type != tt.wantType || got.DNSLookupFamily != tt.wantFamily {
+				t.Errorf("type = %s, dns_lookup_family = %q, want %s, %q", got.Type, got.DNSLookupFamily, tt.wantType, tt.wantFamily)
+			}
+		})
+	}
+}
+
+func TestGroupEndpoints_Locality(t *testing.T) {
+	backends := []models.Backend{
+		{ID: "remote", Address: "10.2.0.1", Port: 80, Region: "us-east", Zone: "us-east-1a", Enabled: true},
+		{ID: "other-zone", Address: "10.1.0.1", Port: 80, Region: "eu-west", Zone: "eu-west-1b", Enabled: true},
+		{ID: "local", Address: "10.0.0.1", Port: 80, Region: "eu-west", Zone: "eu-west-1a", Enabled: true},
+		{ID: "unlabelled", Address: "10.0.0.2", Port: 80, Enabled: true},
+		{ID: "local-standby", Address: "10.0.0.3", Port: 80, Region: "eu-west", Zone: "eu-west-1a", Priority: 1, Enabled: true},
+	}
+
+	tests := []struct {
+		name string
+		node Locality
+		want []string // "priority region/zone addresses"
+	}{
+		{
+			name: "same zone first",
+			node: Locality{Region: "eu-west", Zone: "eu-west-1a"},
+			want: []string{
+				"0 / [10.0.0.2]",
+				"0 eu-west/eu-west-1a [10.0.0.1]",
+				"1 eu-west/eu-west-1b [10.1.0.1]",
+				"2 us-east/us-east-1a [10.2.0.1]",
+				"3 eu-west/eu-west-1a [10.0.0.3]",
+			},
+		},
+		{
+			name: "node without locality",
+			want: []string{
+				"0 / [10.0.0.2]",
+				"0 eu-west/eu-west-1a [10.0.0.1]",
+				"0 eu-west/eu-west-1b [10.1.0.1]",
+				"0 us-east/us-east-1a [10.2.0.1]",
+				"1 eu-west/eu-west-1a [10.0.0.3]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, l := range groupEndpoints(backends, tt.node) {
+				var addresses []string
+				for _, ep := range l.Endpoints {
+					addresses = append(addresses, ep.Address)
+				}
+				got = append(got, fmt.Sprintf("%d %s/%s %v", l.Priority, l.Region, l.Zone, addresses))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupEndpoints() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestGenerator_GenerateListener_AdmissionControl(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	tests := []struct {
+		admission *models.AdmissionControl
+		name      string
+		want      []string
+	}{
+		{
+			name:      "adaptive concurrency",
+			admission: &models.AdmissionControl{Type: models.AdmissionAdaptiveConcurrency, TargetLatencyMs: 250, MaxConcurrency: 400},
+			want:      []string{"envoy.filters.http.adaptive_concurrency", "fixed_value: 0.250s", "max_concurrency_limit: 400"},
+		},
+		{
+			name:      "static admission control with defaults",
+			admission: &models.AdmissionControl{Type: models.AdmissionStatic, MinRPS: 20},
+			want:      []string{"envoy.filters.http.admission_control", "sampling_window: 30s", "value: 95", "default_value: 20"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := &models.LoadBalancer{
+				ID:        "lb-1",
+				Name:      "test-lb",
+				Protocol:  models.ProtocolHTTP,
+				Algorithm: models.AlgoRoundRobin,
+				Port:      80,
+				Admission: tt.admission,
+			}
+
+			data, err := gen.GenerateListener(lb)
+			if err != nil {
+				t.Fatalf("GenerateListener() error = %v", err)
+			}
+			var listeners []map[string]interface{}
+			if err = yaml.Unmarshal(data, &listeners); err != nil {
+				t.Fatalf("invalid listener YAML: %v\n%s", err, data)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("listener config missing %q:\n%s", want, data)
+				}
+			}
+			// The load shedding filter must run before the router
+			if strings.Index(string(data), string(tt.admission.Type)) > strings.Index(string(data), "envoy.filters.http.router") {
+				t.Error("admission filter must precede the router filter")
+			}
+		})
+	}
+}
+
+func TestGenerator_RoutesAndPools(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	lb := &models.LoadBalancer{
+		ID:        "lb-1",
+		Name:      "test-lb",
+		Protocol:  models.ProtocolHTTP,
+		Algorithm: models.AlgoRoundRobin,
+		Port:      80,
+		Backends:  []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}},
+		Pools: []models.BackendPool{
+			{Name: "api", Backends: []models.Backend{{ID: "api-1", Address: "10.0.1.1", Port: 9000, Enabled: true}}},
+		},
+		Routes: []models.Route{
+			{Name: "api", Hosts: []string{"api.example.com"}, Path: "/v1", Pool: "api"},
+			{Name: "health", Path: "/healthz", PathMatch: models.PathMatchExact, Pool: "api"},
+		},
+	}
+
+	config, err := gen.GenerateFullConfig(lb)
+	if err != nil {
+		t.Fatalf("GenerateFullConfig() error = %v", err)
+	}
+
+	var clusters []map[string]interface{}
+	if err = yaml.Unmarshal(config.Clusters, &clusters); err != nil {
+		t.Fatalf("invalid cluster YAML: %v\n%s", err, config.Clusters)
+	}
+	if len(clusters) != 2 || clusters[0]["name"] != "cluster_lb-1" || clusters[1]["name"] != "cluster_lb-1_api" {
+		t.Fatalf("clusters = %v, want default and api pool clusters", clusters)
+	}
+
+	var listeners []struct {
+		FilterChains []struct {
+			Filters []struct {
+				TypedConfig struct {
+					RouteConfig struct {
+						VirtualHosts []struct {
+							Name    string   `yaml:"name"`
+							Domains []string `yaml:"domains"`
+							Routes  []struct {
+								Match map[string]string `yaml:"match"`
+								Route struct {
+									Cluster string `yaml:"cluster"`
+								} `yaml:"route"`
+							} `yaml:"routes"`
+						} `yaml:"virtual_hosts"`
+					} `yaml:"route_config"`
+				} `yaml:"typed_config"`
+			} `yaml:"filters"`
+		} `yaml:"filter_chains"`
+	}
+	if err = yaml.Unmarshal(config.Listeners, &listeners); err != nil {
+		t.Fatalf("invalid listener YAML: %v\n%s", err, config.Listeners)
+	}
+	vhosts := listeners[0].FilterChains[0].Filters[0].TypedConfig.RouteConfig.VirtualHosts
+	if len(vhosts) != 2 {
+		t.Fatalf("virtual hosts = %+v, want api.example.com and catch-all", vhosts)
+	}
+
+	type match struct{ key, path, cluster string }
+	tests := []struct {
+		domain string
+		want   []match
+	}{
+		{domain: "api.example.com", want: []match{
+			{"path", "/healthz", "cluster_lb-1_api"},
+			{"prefix", "/v1", "cluster_lb-1_api"},
+			{"prefix", "/", "cluster_lb-1"},
+		}},
+		{domain: "*", want: []match{
+			{"path", "/healthz", "cluster_lb-1_api"},
+			{"prefix", "/", "cluster_lb-1"},
+		}},
+	}
+
+	for i, tt := range tests {
+		vh := vhosts[i]
+		if len(vh.Domains) != 1 || vh.Domains[0] != tt.domain {
+			t.Errorf("vhost %d domains = %v, want [%s]", i, vh.Domains, tt.domain)
+		}
+		if len(vh.Routes) != len(tt.want) {
+			t.Fatalf("vhost %s routes = %+v, want %d", tt.domain, vh.Routes, len(tt.want))
+		}
+		for j, want := range tt.want {
+			got := vh.Routes[j]
+			if got.Match[want.key] != want.path || got.Route.Cluster != want.cluster {
+				t.Errorf("vhost %s route %d = %v -> %s, want %s %s -> %s",
+					tt.domain, j, got.Match, got.Route.Cluster, want.key, want.path, want.cluster)
+			}
+		}
+	}
+}
+
+func TestGenerator_PoolsOnly(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+		Pools: []models.BackendPool{
+			{Name: "web", Backends: []models.Backend{{ID: "web-1", Address: "10.0.1.1", Port: 80, Enabled: true}}},
+		},
+		Routes: []models.Route{{Name: "web", Hosts: []string{"www.example.com"}, Path: "/", Pool: "web"}},
+	}
+
+	config, err := gen.GenerateFullConfig(lb)
+	if err != nil {
+		t.Fatalf("GenerateFullConfig() error = %v", err)
+	}
+	if strings.Contains(string(config.Clusters), "name: cluster_lb-1\n") {
+		t.Errorf("default cluster rendered without backends:\n%s", config.Clusters)
+	}
+	if strings.Count(string(config.Listeners), "cluster: cluster_lb-1_web") != 1 || strings.Contains(string(config.Listeners), `"*"`) {
+		t.Errorf("listener should only have the www.example.com virtual host:\n%s", config.Listeners)
+	}
+}
+
+func TestGenerator_DiscoveryWithoutMembers(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	// Discovery found no servers yet: the cluster and route must still exist
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+		Discovery: &models.Discovery{Type: models.DiscoveryConsul, Service: "web"},
+	}
+
+	config, err := gen.GenerateFullConfig(lb)
+	if err != nil {
+		t.Fatalf("GenerateFullConfig() error = %v", err)
+	}
+	if !strings.Contains(string(config.Clusters), "name: cluster_lb-1\n") {
+		t.Errorf("default cluster missing:\n%s", config.Clusters)
+	}
+	if !strings.Contains(string(config.Listeners), "cluster: cluster_lb-1\n") {
+		t.Errorf("default route missing:\n%s", config.Listeners)
+	}
+}
+
+func TestGenerator_TrafficSplit(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	pool := func(name, addr string) models.BackendPool {
+		return models.BackendPool{Name: name, Backends: []models.Backend{{ID: name + "-1", Address: addr, Port: 80, Enabled: true}}}
+	}
+	tests := []struct {
+		name     string
+		protocol models.Protocol
+		targets  []models.SplitTarget
+		want     map[string]int
+	}{
+		{
+			name:     "canary",
+			protocol: models.ProtocolHTTP,
+			targets:  []models.SplitTarget{{Pool: "stable", Weight: 90}, {Pool: "canary", Weight: 10}},
+			want:     map[string]int{"cluster_lb-1_stable": 90, "cluster_lb-1_canary": 10},
+		},
+		{
+			name:     "zero weight is dropped",
+			protocol: models.ProtocolHTTP,
+			targets:  []models.SplitTarget{{Pool: "stable", Weight: 100}, {Pool: "canary", Weight: 0}},
+			want:     map[string]int{"cluster_lb-1_stable": 100},
+		},
+		{
+			name:     "https",
+			protocol: models.ProtocolHTTPS,
+			targets:  []models.SplitTarget{{Pool: "stable", Weight: 50}, {Pool: "canary", Weight: 50}},
+			want:     map[string]int{"cluster_lb-1_stable": 50, "cluster_lb-1_canary": 50},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := &models.LoadBalancer{
+				ID: "lb-1", Name: "test-lb", Protocol: tt.protocol, Algorithm: models.AlgoRoundRobin, Port: 80,
+				Pools:  []models.BackendPool{pool("stable", "10.0.1.1"), pool("canary", "10.0.2.1")},
+				Routes: []models.Route{{Name: "web", Path: "/", Split: &models.TrafficSplit{Targets: tt.targets}}},
+			}
+			if tt.protocol == models.ProtocolHTTPS {
+				lb.TLSConfig = &models.TLSConfig{CertificatePath: "/etc/vpsie-lb/certs/c.pem", PrivateKeyPath: "/etc/vpsie-lb/certs/k.pem", MinVersion: "TLSv1.2"}
+			}
+
+			listeners, err := gen.GenerateListener(lb)
+			if err != nil {
+				t.Fatalf("GenerateListener() error = %v", err)
+			}
+
+			var parsed []struct {
+				FilterChains []struct {
+					Filters []struct {
+						TypedConfig struct {
+							RouteConfig struct {
+								VirtualHosts []struct {
+									Routes []struct {
+										Route struct {
+											Cluster          string `yaml:"cluster"`
+											WeightedClusters struct {
+												Clusters []struct {
+													Name   string `yaml:"name"`
+													Weight int    `yaml:"weight"`
+												} `yaml:"clusters"`
+											} `yaml:"weighted_clusters"`
+										} `yaml:"route"`
+									} `yaml:"routes"`
+								} `yaml:"virtual_hosts"`
+							} `yaml:"route_config"`
+						} `yaml:"typed_config"`
+					} `yaml:"filters"`
+				} `yaml:"filter_chains"`
+			}
+			if err = yaml.Unmarshal(listeners, &parsed); err != nil {
+				t.Fatalf("invalid listener YAML: %v\n%s", err, listeners)
+			}
+
+			route := parsed[0].FilterChains[0].Filters[0].TypedConfig.RouteConfig.VirtualHosts[0].Routes[0].Route
+			if route.Cluster != "" {
+				t.Errorf("split route also sets cluster %q", route.Cluster)
+			}
+			got := make(map[string]int)
+			for _, c := range route.WeightedClusters.Clusters {
+				got[c.Name] = c.Weight
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("weighted clusters = %v, want %v\n%s", got, tt.want, listeners)
+			}
+		})
+	}
+}
+
+func TestGenerator_Maintenance(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	backends := []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}}
+	page := `<h1>"Upgrading"</h1>` + "\nback: soon"
+	tests := []struct {
+		name        string
+		lb          *models.LoadBalancer
+		want        []string // route name ("/" for the default route) with a direct response, in route order
+		wantStatus  int
+		wantBody    string
+		wantHeaders map[string]string
+	}{
+		{
+			name: "whole load balancer with defaults",
+			lb: &models.LoadBalancer{
+				ID: "lb-1", Name: "web", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+				Backends: backends, Maintenance: &models.Maintenance{Enabled: true},
+			},
+			want:        []string{"/"},
+			wantStatus:  503,
+			wantBody:    defaultMaintenanceBody,
+			wantHeaders: map[string]string{"content-type": "text/html; charset=utf-8"},
+		},
+		{
+			name: "single route with custom page",
+			lb: &models.LoadBalancer{
+				ID: "lb-1", Name: "web", Protocol: models.ProtocolHTTPS, Algorithm: models.AlgoRoundRobin, Port: 443,
+				Backends:  backends,
+				TLSConfig: &models.TLSConfig{CertificatePath: "/etc/vpsie-lb/certs/c.pem", PrivateKeyPath: "/etc/vpsie-lb/certs/k.pem", MinVersion: "TLSv1.2"},
+				Routes: []models.Route{{Name: "api", Path: "/api", Maintenance: &models.Maintenance{
+					Enabled: true, StatusCode: 200, Body: page, ContentType: "text/plain", RetryAfter: 300,
+				}}},
+			},
+			want:        []string{"/api"},
+			wantStatus:  200,
+			wantBody:    page,
+			wantHeaders: map[string]string{"content-type": "text/plain", "retry-after": "300"},
+		},
+		{
+			name: "disabled",
+			lb: &models.LoadBalancer{
+				ID: "lb-1", Name: "web", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+				Backends: backends, Maintenance: &models.Maintenance{Enabled: false},
+			},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listeners, err := gen.GenerateListener(tt.lb)
+			if err != nil {
+				t.Fatalf("GenerateListener() error = %v", err)
+			}
+
+			var parsed []struct {
+				FilterChains []struct {
+					Filters []struct {
+						TypedConfig struct {
+							RouteConfig struct {
+								VirtualHosts []struct {
+									Routes []struct {
+										Match struct {
+											Prefix string `yaml:"prefix"`
+										} `yaml:"match"`
+										Route          map[string]interface{} `yaml:"route"`
+										DirectResponse *struct {
+											Status int `yaml:"status"`
+											Body   struct {
+												InlineString string `yaml:"inline_string"`
+											} `yaml:"body"`
+										} `yaml:"direct_response"`
+										ResponseHeadersToAdd []struct {
+											Header struct {
+												Key   string `yaml:"key"`
+												Value string `yaml:"value"`
+											} `yaml:"header"`
+										} `yaml:"response_headers_to_add"`
+									} `yaml:"routes"`
+								} `yaml:"virtual_hosts"`
+							} `yaml:"route_config"`
+						} `yaml:"typed_config"`
+					} `yaml:"filters"`
+				} `yaml:"filter_chains"`
+			}
+			if err = yaml.Unmarshal(listeners, &parsed); err != nil {
+				t.Fatalf("invalid listener YAML: %v\n%s", err, listeners)
+			}
+
+			var got []string
+			for _, route := range parsed[0].FilterChains[0].Filters[0].TypedConfig.RouteConfig.VirtualHosts[0].Routes {
+				if route.DirectResponse == nil {
+					if route.Route == nil {
+						t.Errorf("route %s has neither route nor direct_response", route.Match.Prefix)
+					}
+					continue
+				}
+				got = append(got, route.Match.Prefix)
+				if route.Route != nil {
+					t.Errorf("route %s sets both route and direct_response", route.Match.Prefix)
+				}
+				if route.DirectResponse.Status != tt.wantStatus || route.DirectResponse.Body.InlineString != tt.wantBody {
+					t.Errorf("direct_response = %d %q, want %d %q", route.DirectResponse.Status, route.DirectResponse.Body.InlineString, tt.wantStatus, tt.wantBody)
+				}
+				headers := make(map[string]string)
+				for _, h := range route.ResponseHeadersToAdd {
+					headers[h.Header.Key] = h.Header.Value
+				}
+				if !reflect.DeepEqual(headers, tt.wantHeaders) {
+					t.Errorf("response headers = %v, want %v", headers, tt.wantHeaders)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("direct responses on %v, want %v\n%s", got, tt.want, listeners)
+			}
+		})
+	}
+}
+
+func TestGenerator_ClientIP(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	backends := []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}}
+	tests := []struct {
+		name     string
+		protocol models.Protocol
+		clientIP *models.ClientIP
+		want     []string
+		notWant  []string
+	}{
+		{
+			name:     "trusted hops, append",
+			protocol: models.ProtocolHTTP,
+			clientIP: &models.ClientIP{XFFNumTrustedHops: 2},
+			want:     []string{"use_remote_address: true", "xff_num_trusted_hops: 2", "skip_xff_append: false"},
+			notWant:  []string{"request_headers_to_add", "original_ip_detection_extensions"},
+		},
+		{
+			name:     "trusted CIDRs, overwrite with real IP",
+			protocol: models.ProtocolHTTP,
+			clientIP: &models.ClientIP{TrustedCIDRs: []string{"10.1.2.3/8"}, XFFMode: models.XFFOverwrite, SetRealIP: true},
+			want: []string{
+				"envoy.http.original_ip_detection.xff", "address_prefix: 10.0.0.0", "prefix_len: 8", "skip_xff_append: true",
+				"key: x-forwarded-for", "key: x-real-ip", `value: "%DOWNSTREAM_REMOTE_ADDRESS_WITHOUT_PORT%"`,
+			},
+			notWant: []string{"use_remote_address"},
+		},
+		{
+			name:     "tcp original source",
+			protocol: models.ProtocolTCP,
+			clientIP: &models.ClientIP{PreserveSource: true},
+			want:     []string{"envoy.filters.listener.original_src", "mark: 123"},
+		},
+		{
+			name:     "tcp without original source",
+			protocol: models.ProtocolTCP,
+			clientIP: &models.ClientIP{},
+			notWant:  []string{"listener_filters"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := &models.LoadBalancer{
+				ID: "lb-1", Name: "test-lb", Protocol: tt.protocol, Algorithm: models.AlgoRoundRobin, Port: 80,
+				Backends: backends, ClientIP: tt.clientIP,
+			}
+			listeners, err := gen.GenerateListener(lb)
+			if err != nil {
+				t.Fatalf("GenerateListener() error = %v", err)
+			}
+			var parsed []map[string]interface{}
+			if err = yaml.Unmarshal(listeners, &parsed); err != nil {
+				t.Fatalf("invalid listener YAML: %v\n%s", err, listeners)
+			}
+
+			out := string(listeners)
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("listener missing %q:\n%s", want, out)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out, notWant) {
+					t.Errorf("listener must not contain %q:\n%s", notWant, out)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerator_ConnectionLimit(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	for _, protocol := range []models.Protocol{models.ProtocolHTTP, models.ProtocolHTTPS, models.ProtocolTCP} {
+		t.Run(string(protocol), func(t *testing.T) {
+			lb := &models.LoadBalancer{
+				ID: "lb-1", Name: "test-lb", Protocol: protocol, Algorithm: models.AlgoRoundRobin, Port: 443,
+				Backends:       []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+				TLSConfig:      &models.TLSConfig{CertificatePath: "/etc/vpsie-lb/certs/c.pem", PrivateKeyPath: "/etc/vpsie-lb/certs/k.pem", MinVersion: "TLSv1.2"},
+				MaxConnections: 2000,
+			}
+			listeners, err := gen.GenerateListener(lb)
+			if err != nil {
+				t.Fatalf("GenerateListener() error = %v", err)
+			}
+
+			var parsed []struct {
+				FilterChains []struct {
+					Filters []struct {
+						Name        string `yaml:"name"`
+						TypedConfig struct {
+							MaxConnections int `yaml:"max_connections"`
+						} `yaml:"typed_config"`
+					} `yaml:"filters"`
+				} `yaml:"filter_chains"`
+			}
+			if err = yaml.Unmarshal(listeners, &parsed); err != nil {
+				t.Fatalf("invalid listener YAML: %v\n%s", err, listeners)
+			}
+			// The limit must be the first filter so excess connections are closed before any processing
+			first := parsed[0].FilterChains[0].Filters[0]
+			if first.Name != "envoy.filters.network.connection_limit" || first.TypedConfig.MaxConnections != 2000 {
+				t.Errorf("first filter = %s (max %d), want connection_limit with 2000\n%s", first.Name, first.TypedConfig.MaxConnections, listeners)
+			}
+
+			lb.MaxConnections = 0
+			if listeners, err = gen.GenerateListener(lb); err != nil {
+				t.Fatalf("GenerateListener() error = %v", err)
+			}
+			if strings.Contains(string(listeners), "connection_limit") {
+				t.Errorf("listener without max_connections has a connection limit:\n%s", listeners)
+			}
+		})
+	}
+}
+
+func TestGenerator_ConnectionRate(t *testing.T) {
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTPS, Algorithm: models.AlgoRoundRobin, Port: 443,
+		Backends:       []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+		TLSConfig:      &models.TLSConfig{CertificatePath: "/etc/vpsie-lb/certs/c.pem", PrivateKeyPath: "/etc/vpsie-lb/certs/k.pem", MinVersion: "TLSv1.2"},
+		MaxConnections: 2000,
+		DDoS:           &models.DDoSProtection{ConnectionRate: 300, MaxConnectionsPerIP: 50},
+	}
+
+	var configs [2]*EnvoyConfig
+	for i, legacy := range []bool{false, true} {
+		gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+		gen.SetLegacyTemplates(legacy)
+		config, err := gen.GenerateFullConfig(lb)
+		if err != nil {
+			t.Fatalf("GenerateFullConfig(legacy=%v) error = %v", legacy, err)
+		}
+		configs[i] = config
+	}
+	checkSameConfig(t, "listeners", configs[1].Listeners, configs[0].Listeners)
+
+	var parsed []struct {
+		FilterChains []struct {
+			Filters []struct {
+				Name        string `yaml:"name"`
+				TypedConfig struct {
+					TokenBucket struct {
+						MaxTokens     int    `yaml:"max_tokens"`
+						TokensPerFill int    `yaml:"tokens_per_fill"`
+						FillInterval  string `yaml:"fill_interval"`
+					} `yaml:"token_bucket"`
+				} `yaml:"typed_config"`
+			} `yaml:"filters"`
+		} `yaml:"filter_chains"`
+	}
+	if err := yaml.Unmarshal(configs[0].Listeners, &parsed); err != nil {
+		t.Fatalf("invalid listener YAML: %v\n%s", err, configs[0].Listeners)
+	}
+	// The rate limit follows the connection limit and precedes the connection manager
+	filters := parsed[0].FilterChains[0].Filters
+	if len(filters) != 3 || filters[1].Name != "envoy.filters.network.local_ratelimit" {
+		t.Fatalf("filters = %+v, want connection_limit, local_ratelimit, http_connection_manager", filters)
+	}
+	if bucket := filters[1].TypedConfig.TokenBucket; bucket.MaxTokens != 300 || bucket.TokensPerFill != 300 || bucket.FillInterval != "1s" {
+		t.Errorf("token bucket = %+v, want 300 tokens refilled by 300 every 1s", bucket)
+	}
+}
+
+func TestGenerator_ConnectionLifetime(t *testing.T) {
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTPS, Algorithm: models.AlgoRoundRobin, Port: 443,
+		Backends:  []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+		TLSConfig: &models.TLSConfig{CertificatePath: "/etc/vpsie-lb/certs/c.pem", PrivateKeyPath: "/etc/vpsie-lb/certs/k.pem", MinVersion: "TLSv1.2"},
+		Timeouts:  &models.Timeouts{Connect: 5, Idle: 30, Request: 60},
+		Listener:  &models.ListenerTuning{MaxConnectionDuration: 900, DrainType: models.DrainModifyOnly},
+	}
+
+	var configs [2]*EnvoyConfig
+	for i, legacy := range []bool{false, true} {
+		gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+		gen.SetLegacyTemplates(legacy)
+		config, err := gen.GenerateFullConfig(lb)
+		if err != nil {
+			t.Fatalf("GenerateFullConfig(legacy=%v) error = %v", legacy, err)
+		}
+		configs[i] = config
+	}
+	checkSameConfig(t, "listeners", configs[1].Listeners, configs[0].Listeners)
+
+	listeners := string(configs[0].Listeners)
+	for _, want := range []string{"drain_type: MODIFY_ONLY", "max_connection_duration: 900s", "stream_idle_timeout: 30s"} {
+		if !strings.Contains(listeners, want) {
+			t.Errorf("listener lacks %q:\n%s", want, listeners)
+		}
+	}
+	// The connection idle timeout keeps Envoy's default unless it is set
+	if strings.Contains(listeners, " idle_timeout:") {
+		t.Errorf("listener sets a connection idle timeout:\n%s", listeners)
+	}
+}
+
+func TestGenerator_TCPProtocolHint(t *testing.T) {
+	tcpLB := func(hint models.TCPProtocolHint, algorithm models.LoadBalancingAlgo) *models.LoadBalancer {
+		return &models.LoadBalancer{
+			ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolTCP, Algorithm: algorithm, Port: 6379,
+			Backends:        []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 6379, Enabled: true}},
+			HealthCheck:     &models.HealthCheck{Type: models.HealthCheckTCP, Interval: 10, Timeout: 5, HealthyThreshold: 2, UnhealthyThreshold: 3},
+			Timeouts:        &models.Timeouts{Connect: 5, Idle: 300, Request: 2},
+			TCPProtocolHint: hint,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		lb      *models.LoadBalancer
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "mysql",
+			lb:      tcpLB(models.TCPProtocolMySQL, models.AlgoLeastRequest),
+			want:    []string{"envoy.filters.network.mysql_proxy", "envoy.filters.network.tcp_proxy", "text: 000a"},
+			notWant: []string{"redis"},
+		},
+		{
+			name:    "redis",
+			lb:      tcpLB(models.TCPProtocolRedis, models.AlgoRingHash),
+			want:    []string{"envoy.filters.network.redis_proxy", "op_timeout: 2s", "catch_all_route", "envoy.health_checkers.redis"},
+			notWant: []string{"envoy.filters.network.tcp_proxy", "tcp_health_check"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var configs [2]*EnvoyConfig
+			for i, legacy := range []bool{false, true} {
+				gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+				gen.SetLegacyTemplates(legacy)
+				config, err := gen.GenerateFullConfig(tt.lb)
+				if err != nil {
+					t.Fatalf("GenerateFullConfig(legacy=%v) error = %v", legacy, err)
+				}
+				configs[i] = config
+			}
+			checkSameConfig(t, "listeners", configs[1].Listeners, configs[0].Listeners)
+			checkSameConfig(t, "clusters", configs[1].Clusters, configs[0].Clusters)
+
+			rendered := string(configs[0].Listeners) + string(configs[0].Clusters)
+			for _, want := range tt.want {
+				if !strings.Contains(rendered, want) {
+					t.Errorf("config lacks %q:\n%s", want, rendered)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(rendered, notWant) {
+					t.Errorf("config contains %q:\n%s", notWant, rendered)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerator_TLSPassthrough(t *testing.T) {
+	// Without own backends, unmatched server names get no filter chain
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolTCP, Algorithm: models.AlgoRoundRobin, Port: 443,
+		Pools: []models.BackendPool{
+			{Name: "api", Backends: []models.Backend{{ID: "api-1", Address: "10.0.1.1", Port: 443, Enabled: true}}},
+		},
+		TLSPassthrough: &models.TLSPassthrough{Routes: []models.SNIRoute{{ServerNames: []string{"*.example.com"}, Pool: "api"}}},
+		ClientIP:       &models.ClientIP{PreserveSource: true},
+	}
+
+	var configs [2]*EnvoyConfig
+	for i, legacy := range []bool{false, true} {
+		gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+		gen.SetLegacyTemplates(legacy)
+		config, err := gen.GenerateFullConfig(lb)
+		if err != nil {
+			t.Fatalf("GenerateFullConfig(legacy=%v) error = %v", legacy, err)
+		}
+		configs[i] = config
+	}
+	checkSameConfig(t, "listeners", configs[1].Listeners, configs[0].Listeners)
+
+	var listeners []map[string]interface{}
+	if err := yaml.Unmarshal(configs[0].Listeners, &listeners); err != nil {
+		t.Fatalf("invalid listener YAML: %v", err)
+	}
+	chains, _ := listeners[0]["filter_chains"].([]interface{})
+	if len(chains) != 1 {
+		t.Fatalf("filter chains = %d, want only the server name route:\n%s", len(chains), configs[0].Listeners)
+	}
+	// The server name is read before the original source is restored
+	out := string(configs[0].Listeners)
+	if inspector, src := strings.Index(out, "tls_inspector"), strings.Index(out, "original_src"); inspector < 0 || src < inspector {
+		t.Errorf("listener filters out of order:\n%s", out)
+	}
+	if !strings.Contains(out, "cluster: cluster_lb-1_api") || strings.Contains(out, "cluster: cluster_lb-1\n") {
+		t.Errorf("listener does not send the route to the pool only:\n%s", out)
+	}
+}
+
+func TestGenerator_RouteOverrides(t *testing.T) {
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+		Backends:    []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+		Timeouts:    &models.Timeouts{Connect: 5, Idle: 60, Request: 30},
+		RetryPolicy: &models.RetryPolicy{NumRetries: 3},
+		Routes: []models.Route{
+			{Name: "checkout", Path: "/checkout", RetryPolicy: &models.RetryPolicy{NumRetries: 0}},
+			{Name: "search", Path: "/search", Timeouts: &models.RouteTimeouts{Request: 3}},
+		},
+	}
+
+	vhosts := virtualHosts(lb)
+	if len(vhosts) != 1 || len(vhosts[0].Routes) != 3 {
+		t.Fatalf("virtualHosts() = %+v, want one host with three routes", vhosts)
+	}
+	for _, r := range vhosts[0].Routes {
+		switch r.Name {
+		case "checkout":
+			if r.RetryPolicy != nil {
+				t.Errorf("checkout retry policy = %+v, want retries disabled", r.RetryPolicy)
+			}
+		case "search", "":
+			if r.RetryPolicy == nil || r.RetryPolicy.NumRetries != 3 {
+				t.Errorf("route %q retry policy = %+v, want the load balancer's", r.Name, r.RetryPolicy)
+			}
+		}
+		if want := map[string]int{"search": 3}[r.Name]; r.Timeout != want {
+			t.Errorf("route %q timeout = %d, want %d", r.Name, r.Timeout, want)
+		}
+	}
+}
+
+func TestCookieData(t *testing.T) {
+	tests := []struct {
+		condition models.MatchCondition
+		header    string
+		want      bool
+	}{
+		{models.MatchCondition{Name: "ab_group", Value: "b"}, "ab_group=b", true},
+		{models.MatchCondition{Name: "ab_group", Value: "b"}, "session=x; ab_group=b; theme=dark", true},
+		{models.MatchCondition{Name: "ab_group", Value: "b"}, "ab_group=bb", false},
+		{models.MatchCondition{Name: "ab_group", Value: "b"}, "my_ab_group=b", false},
+		{models.MatchCondition{Name: "ab.group", Value: "b"}, "abxgroup=b", false},
+		{models.MatchCondition{Name: "ab_group", Match: models.MatchRegex, Value: "b|c"}, "theme=dark;ab_group=c", true},
+		{models.MatchCondition{Name: "beta", Match: models.MatchPresent}, "beta=", true},
+		{models.MatchCondition{Name: "beta", Match: models.MatchPresent}, "alpha=beta", false},
+	}
+
+	for _, tt := range tests {
+		data := cookieData(tt.condition)
+		if data.Name != "cookie" || !data.Regex {
+			t.Fatalf("cookieData(%+v) = %+v, want a cookie header expression", tt.condition, data)
+		}
+		// Envoy requires the whole header to match
+		re := regexp.MustCompile("^(?:" + data.Value + ")$")
+		if got := re.MatchString(tt.header); got != tt.want {
+			t.Errorf("cookie %+v on %q: match = %v, want %v (expression %s)", tt.condition, tt.header, got, tt.want, data.Value)
+		}
+	}
+}
+
+func TestGenerator_GenerateBootstrap_Overload(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+	gen.SetOverload(OverloadConfig{MaxHeapBytes: 1 << 30, ShrinkHeapPercent: 90, StopAcceptingRequestsPercent: 98})
+
+	data, err := gen.GenerateBootstrap()
+	if err != nil {
+		t.Fatalf("GenerateBootstrap() error = %v", err)
+	}
+
+	var parsed struct {
+		OverloadManager struct {
+			ResourceMonitors []struct {
+				Name string `yaml:"name"`
+			} `yaml:"resource_monitors"`
+			Actions []struct {
+				Name     string `yaml:"name"`
+				Triggers []struct {
+					Name      string `yaml:"name"`
+					Threshold struct {
+						Value float64 `yaml:"value"`
+					} `yaml:"threshold"`
+				} `yaml:"triggers"`
+			} `yaml:"actions"`
+		} `yaml:"overload_manager"`
+	}
+	if err = yaml.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("invalid bootstrap YAML: %v\n%s", err, data)
+	}
+
+	if monitors := parsed.OverloadManager.ResourceMonitors; len(monitors) != 2 || monitors[1].Name != "envoy.resource_monitors.fixed_heap" {
+		t.Errorf("resource monitors = %+v, want connections and fixed heap", monitors)
+	}
+	got := make(map[string]float64)
+	for _, action := range parsed.OverloadManager.Actions {
+		got[action.Name] = action.Triggers[0].Threshold.Value
+	}
+	want := map[string]float64{
+		"envoy.overload_actions.shrink_heap":             0.9,
+		"envoy.overload_actions.stop_accepting_requests": 0.98,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("overload actions = %v, want %v", got, want)
+	}
+}
+
+func TestGenerator_BuildersMatchTemplates(t *testing.T) {
+	backends := []models.Backend{
+		{ID: "be-1", Address: "10.0.0.1", Port: 8080, Weight: 100, Enabled: true},
+		{ID: "be-2", Address: "backend.internal", Port: 8080, Enabled: true},
+		{ID: "be-3", Address: "10.0.0.3", Port: 8080, Enabled: false},
+	}
+	pools := []models.BackendPool{
+		{Name: "stable", Backends: backends[:1]},
+		{Name: "canary", Backends: backends[1:2]},
+	}
+	tlsConfig := &models.TLSConfig{
+		CertificatePath: "/etc/vpsie-lb/certs/c.pem", PrivateKeyPath: "/etc/vpsie-lb/certs/k.pem",
+		MinVersion: "TLSv1.2", MaxVersion: "TLSv1.3", ALPN: []string{"h2", "http/1.1"},
+	}
+
+	tests := []struct {
+		name string
+		lb   *models.LoadBalancer
+	}{
+		{
+			name: "http with everything",
+			lb: &models.LoadBalancer{
+				ID: "lb-1", Name: "web", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoLeastRequest, Port: 80,
+				Backends: backends, Pools: pools, MaxConnections: 500,
+				HealthCheck: &models.HealthCheck{Type: models.HealthCheckHTTP, Path: "/health", Interval: 10, Timeout: 5,
+					HealthyThreshold: 2, UnhealthyThreshold: 3, ExpectedStatus: []int{200, 204}},
+				Timeouts:       &models.Timeouts{Connect: 3, Idle: 60, Request: 30},
+				RetryPolicy:    &models.RetryPolicy{NumRetries: 2, PerTryTimeout: 4, BudgetPercent: 20, MinRetryConcurrency: 5},
+				ConnectionPool: &models.ConnectionPool{MaxConnectionsPerHost: 20, HTTP2: true, MaxConcurrentStreams: 64, IdleTimeout: 30},
+				Prewarm:        &models.Prewarm{Window: 60, Aggression: 1.5, PreconnectRatio: 2},
+				ClientIP:       &models.ClientIP{XFFNumTrustedHops: 1, XFFMode: models.XFFOverwrite, SetRealIP: true},
+				Admission:      &models.AdmissionControl{Type: models.AdmissionStatic, MinRPS: 20},
+				Routes: []models.Route{
+					{Name: "api", Hosts: []string{"api.example.com"}, Path: "/v1", Pool: "stable"},
+					{Name: "health", Path: "/healthz", PathMatch: models.PathMatchExact, Pool: "stable"},
+					{Name: "shop", Path: "/shop", Split: &models.TrafficSplit{Targets: []models.SplitTarget{
+						{Pool: "stable", Weight: 90}, {Pool: "canary", Weight: 10},
+					}}},
+					{Name: "down", Path: "/down", Pool: "stable", Maintenance: &models.Maintenance{
+						Enabled: true, Body: "key: \"value\"\n# not a comment", RetryAfter: 120,
+					}},
+				},
+			},
+		},
+		{
+			name: "https with adaptive concurrency",
+			lb: &models.LoadBalancer{
+				ID: "lb-2", Name: "secure", Protocol: models.ProtocolHTTPS, Algorithm: models.AlgoRingHash, Port: 443,
+				Backends: backends, TLSConfig: tlsConfig,
+				HealthCheck: &models.HealthCheck{Type: models.HealthCheckTCP, Interval: 10, Timeout: 5, HealthyThreshold: 2, UnhealthyThreshold: 3},
+				ClientIP:    &models.ClientIP{TrustedCIDRs: []string{"10.0.0.0/8", "192.168.1.0/24"}, XFFMode: models.XFFPreserve},
+				Admission:   &models.AdmissionControl{Type: models.AdmissionAdaptiveConcurrency, MaxConcurrency: 400, TargetLatencyMs: 250},
+				Maintenance: &models.Maintenance{Enabled: true, StatusCode: 503},
+			},
+		},
+		{
+			name: "tcp",
+			lb: &models.LoadBalancer{
+				ID: "lb-3", Name: "db", Protocol: models.ProtocolTCP, Algorithm: models.AlgoRandom, Port: 5432,
+				Backends: backends, MaxConnections: 100,
+				Timeouts:       &models.Timeouts{Idle: 300},
+				RetryPolicy:    &models.RetryPolicy{NumRetries: 2},
+				ConnectionPool: &models.ConnectionPool{MaxConnectionsPerHost: 10},
+				Prewarm:        &models.Prewarm{PreconnectRatio: 1.5},
+				ClientIP:       &models.ClientIP{PreserveSource: true},
+			},
+		},
+	}
+
+	// decode parses generated YAML so formatting differences do not matter
+	decode := func(t *testing.T, data []byte) interface{} {
+		t.Helper()
+		var parsed interface{}
+		if err := yaml.Unmarshal(data, &parsed); err != nil {
+			t.Fatalf("invalid YAML: %v\n%s", err, data)
+		}
+		return parsed
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.lb.Validate(); err != nil {
+				t.Fatalf("fixture is invalid: %v", err)
+			}
+			builders := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+			templates := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+			templates.SetLegacyTemplates(true)
+
+			built, err := builders.GenerateFullConfig(tt.lb)
+			if err != nil {
+				t.Fatalf("builders: GenerateFullConfig() error = %v", err)
+			}
+			rendered, err := templates.GenerateFullConfig(tt.lb)
+			if err != nil {
+				t.Fatalf("templates: GenerateFullConfig() error = %v", err)
+			}
+
+			if got, want := decode(t, built.Listeners), decode(t, rendered.Listeners); !reflect.DeepEqual(got, want) {
+				t.Errorf("listeners differ\nbuilders:\n%s\ntemplates:\n%s", built.Listeners, rendered.Listeners)
+			}
+			if got, want := decode(t, built.Clusters), decode(t, rendered.Clusters); !reflect.DeepEqual(got, want) {
+				t.Errorf("clusters differ\nbuilders:\n%s\ntemplates:\n%s", built.Clusters, rendered.Clusters)
+			}
+		})
+	}
+
+	t.Run("bootstrap", func(t *testing.T) {
+		overload := OverloadConfig{MaxHeapBytes: 1 << 30, ShrinkHeapPercent: 90, DisableKeepalivePercent: 95}
+		builders := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+		builders.SetOverload(overload)
+		templates := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+		templates.SetOverload(overload)
+		templates.SetLegacyTemplates(true)
+
+		built, err := builders.GenerateBootstrap()
+		if err != nil {
+			t.Fatalf("builders: GenerateBootstrap() error = %v", err)
+		}
+		rendered, err := templates.GenerateBootstrap()
+		if err != nil {
+			t.Fatalf("templates: GenerateBootstrap() error = %v", err)
+		}
+		if got, want := decode(t, built), decode(t, rendered); !reflect.DeepEqual(got, want) {
+			t.Errorf("bootstrap differs\nbuilders:\n%s\ntemplates:\n%s", built, rendered)
+		}
+	})
+}
+
+func TestGenerator_GenerateBootstrap_AdminAddress(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+		gen.SetLegacyTemplates(legacy)
+
+		data, err := gen.GenerateBootstrap()
+		if err != nil {
+			t.Fatalf("GenerateBootstrap() error = %v", err)
+		}
+		var parsed struct {
+			Admin struct {
+				Address struct {
+					SocketAddress socketAddress `yaml:"socket_address"`
+				} `yaml:"address"`
+			} `yaml:"admin"`
+		}
+		if err = yaml.Unmarshal(data, &parsed); err != nil {
+			t.Fatalf("invalid bootstrap YAML: %v", err)
+		}
+		if got := parsed.Admin.Address.SocketAddress; got.Address != "127.0.0.1" || got.PortValue != 9901 {
+			t.Errorf("legacy templates %v: admin address = %+v, want 127.0.0.1 port 9901", legacy, got)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package envoy
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+// update rewrites the golden files instead of comparing against them:
+//
+//	go test ./pkg/envoy -run TestGolden -update
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// goldenLocality is the node locality fixtures are rendered for
+var goldenLocality = Locality{Region: "eu-west", Zone: "eu-west-1a"}
+
+// TestGolden renders every load balancer in testdata/fixtures and compares
+// the listeners and clusters with testdata/golden/<fixture>/. Review the
+// golden diff of a generator change like any other code change.
+func TestGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "fixtures", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures in testdata/fixtures")
+	}
+
+	for _, fixture := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(fixture), ".yaml")
+		t.Run(name, func(t *testing.T) {
+			lb := loadFixture(t, fixture)
+			dir := filepath.Join("testdata", "golden", name)
+
+			gen, legacyGen := goldenGenerator(false), goldenGenerator(true)
+			gen.SetLocality(goldenLocality)
+			legacyGen.SetLocality(goldenLocality)
+
+			config, err := gen.GenerateFullConfig(lb)
+			if err != nil {
+				t.Fatalf("GenerateFullConfig() error = %v", err)
+			}
+			checkGolden(t, filepath.Join(dir, "listeners.yaml"), config.Listeners)
+			checkGolden(t, filepath.Join(dir, "clusters.yaml"), config.Clusters)
+
+			// The legacy templates must render the same configuration
+			legacy, err := legacyGen.GenerateFullConfig(lb)
+			if err != nil {
+				t.Fatalf("legacy templates: GenerateFullConfig() error = %v", err)
+			}
+			checkSameConfig(t, "listeners", legacy.Listeners, config.Listeners)
+			checkSameConfig(t, "clusters", legacy.Clusters, config.Clusters)
+		})
+	}
+
+	t.Run("bootstrap", func(t *testing.T) {
+		overload := OverloadConfig{MaxHeapBytes: 2 << 30, ShrinkHeapPercent: 90, DisableKeepalivePercent: 95, StopAcceptingRequestsPercent: 98, StopAcceptingConnectionsPercent: 99}
+		for name, configure := range map[string]func(*Generator){
+			"bootstrap.yaml":          func(*Generator) {},
+			"bootstrap-overload.yaml": func(g *Generator) { g.SetOverload(overload) },
+			"bootstrap-locality.yaml": func(g *Generator) { g.SetLocality(goldenLocality) },
+			"bootstrap-stats-tags.yaml": func(g *Generator) {
+				g.SetStatsTags(map[string]string{"region": "eu-west", "node": "lb-node-1"})
+			},
+		} {
+			gen, legacyGen := goldenGenerator(false), goldenGenerator(true)
+			configure(gen)
+			configure(legacyGen)
+
+			data, err := gen.GenerateBootstrap()
+			if err != nil {
+				t.Fatalf("GenerateBootstrap() error = %v", err)
+			}
+			checkGolden(t, filepath.Join("testdata", "golden", name), data)
+
+			legacy, err := legacyGen.GenerateBootstrap()
+			if err != nil {
+				t.Fatalf("legacy templates: GenerateBootstrap() error = %v", err)
+			}
+			checkSameConfig(t, name, legacy, data)
+		}
+	})
+}
+
+// BenchmarkGenerateFullConfig renders every fixture, with the structured
+// builders and with the legacy templates:
+//
+//	go test ./pkg/envoy -run '^$' -bench GenerateFullConfig -benchmem
+func BenchmarkGenerateFullConfig(b *testing.B) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "fixtures", "*.yaml"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	lbs := make([]*models.LoadBalancer, len(fixtures))
+	for i, fixture := range fixtures {
+		lbs[i] = loadFixture(b, fixture)
+	}
+
+	for name, legacyTemplates := range map[string]bool{"builders": false, "templates": true} {
+		b.Run(name, func(b *testing.B) {
+			gen := goldenGenerator(legacyTemplates)
+			b.ReportAllocs()
+			for b.Loop() {
+				for _, lb := range lbs {
+					if _, err := gen.GenerateFullConfig(lb); err != nil {
+						b.Fatalf("GenerateFullConfig(%s) error = %v", lb.ID, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// goldenGenerator returns the generator settings used for all golden files
+func goldenGenerator(legacyTemplates bool) *Generator {
+	gen := NewGenerator("golden-node", "/etc/envoy/dynamic", "127.0.0.1:9901", 9901, 50000)
+	gen.SetLegacyTemplates(legacyTemplates)
+	gen.SetWAFService("127.0.0.1:9904")
+	gen.SetWASMModuleDir("/var/lib/vpsie-lb/wasm")
+	gen.SetSessionTicketKeys([]string{"/var/lib/vpsie-lb/session-tickets/key-0", "/var/lib/vpsie-lb/session-tickets/key-1"})
+	return gen
+}
+
+// loadFixture reads and validates a load balancer fixture
+func loadFixture(t testing.TB, path string) *models.LoadBalancer {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lb models.LoadBalancer
+	if err = yaml.Unmarshal(data, &lb); err != nil {
+		t.Fatalf("invalid fixture %s: %v", path, err)
+	}
+	if err = lb.Validate(); err != nil {
+		t.Fatalf("invalid fixture %s: %v", path, err)
+	}
+	return &lb
+}
+
+// checkGolden compares got with the golden file at path, or rewrites the
+// file with -update
+func checkGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("missing golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the generated configuration (run with -update to accept):\n%s", path, firstDifference(want, got))
+	}
+}
+
+// firstDifference describes the first line where want and got differ
+func firstDifference(want, got []byte) string {
+	wantLines := strings.Split(string(want), "\n")
+	gotLines := strings.Split(string(got), "\n")
+	for i := range max(len(wantLines), len(gotLines)) {
+		if i >= len(wantLines) || i >= len(gotLines) || wantLines[i] != gotLines[i] {
+			var w, g string
+			if i < len(wantLines) {
+				w = wantLines[i]
+			}
+			if i < len(gotLines) {
+				g = gotLines[i]
+			}
+			return fmt.Sprintf("line %d:\n- %s\n+ %s", i+1, w, g)
+		}
+	}
+	return "files differ"
+}
+
+// checkSameConfig fails unless both YAML documents decode to the same value
+func checkSameConfig(t *testing.T, name string, legacy, built []byte) {
+	t.Helper()
+	var legacyValue, builtValue interface{}
+	if err := yaml.Unmarshal(legacy, &legacyValue); err != nil {
+		t.Fatalf("legacy templates: invalid %s YAML: %v", name, err)
+	}
+	if err := yaml.Unmarshal(built, &builtValue); err != nil {
+		t.Fatalf("invalid %s YAML: %v", name, err)
+	}
+	if !reflect.DeepEqual(legacyValue, builtValue) {
+		t.Errorf("legacy templates render different %s:\n%s", name, legacy)
+	}
+}
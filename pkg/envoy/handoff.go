@@ -0,0 +1,91 @@
+package envoy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// process is an Envoy process started by the Reloader
+type process struct {
+	exited chan struct{} // closed when the process exits
+	err    error         // exit error, valid once exited is closed
+	pid    int
+}
+
+// handoff waits until the Envoy started at epoch is live and the parent it
+// took over from has exited, then records the new process in the PID file.
+// A new process that exits or does not become live within the handoff
+// timeout is stopped; the parent keeps serving until its shutdown time.
+// Without a server info source the handoff cannot be observed and the new
+// process is recorded right away.
+func (r *Reloader) handoff(child *process, epoch int32, parent int) error {
+	if r.serverInfo == nil {
+		return r.savePID(child.pid)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.handoffTimeout)
+	defer cancel()
+
+	if err := r.waitLive(ctx, child, epoch); err != nil {
+		// SIGTERM makes Envoy exit cleanly; an already exited process ignores it
+		_ = syscall.Kill(child.pid, syscall.SIGTERM)
+		return fmt.Errorf("envoy epoch %d failed to take over: %w", epoch, err)
+	}
+	if err := r.savePID(child.pid); err != nil {
+		return err
+	}
+
+	if parent > 0 && parent != child.pid {
+		if err := waitProcessExit(ctx, parent); err != nil {
+			return fmt.Errorf("envoy epoch %d is live but the previous process (PID %d) %w", epoch, parent, err)
+		}
+	}
+	return nil
+}
+
+// waitLive polls the admin interface until the process started at epoch
+// reports LIVE, which Envoy only does once its listeners accept connections
+func (r *Reloader) waitLive(ctx context.Context, child *process, epoch int32) error {
+	ticker := time.NewTicker(exitPollInterval)
+	defer ticker.Stop()
+	for {
+		info, err := r.serverInfo.ServerInfo(ctx)
+		if err == nil && info.RestartEpoch == int(epoch) && info.State == ServerStateLive {
+			return nil
+		}
+
+		select {
+		case <-child.exited:
+			return fmt.Errorf("process exited during startup: %v", child.err)
+		case <-ctx.Done():
+			return fmt.Errorf("not live within %s", r.handoffTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitProcessExit waits until the process with pid is gone
+func waitProcessExit(ctx context.Context, pid int) error {
+	ticker := time.NewTicker(exitPollInterval)
+	defer ticker.Stop()
+	for processAlive(pid) {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("did not exit")
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// savePID records the running Envoy process, which is the parent of the next
+// hot restart and the target of SIGHUP reloads
+func (r *Reloader) savePID(pid int) error {
+	if err := writeFileAtomic(r.pidFile, strconv.Itoa(pid)+"\n"); err != nil {
+		return fmt.Errorf("failed to write PID file: %w", err)
+	}
+	return nil
+}
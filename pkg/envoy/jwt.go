@@ -0,0 +1,151 @@
+package envoy
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+const (
+	// jwtPayloadMetadata is the dynamic metadata key the verified token
+	// payload is stored under, where required claims are matched
+	jwtPayloadMetadata = "jwt_payload"
+	// jwtAnyProvider is the requirement of routes accepting a token from any provider
+	jwtAnyProvider = "any_provider"
+	// defaultJWKSCacheDuration is how long signing keys are cached when the
+	// provider sets no cache duration, in seconds
+	defaultJWKSCacheDuration = 300
+	// jwksFetchTimeout bounds the fetch of a provider's signing keys, in seconds
+	jwksFetchTimeout = 5
+	// systemCAFile is the CA bundle upstream TLS certificates are verified against
+	systemCAFile = "/etc/ssl/certs/ca-certificates.crt"
+)
+
+// jwtAuthData is the JWT authentication filter of an HTTP listener
+type jwtAuthData struct {
+	Providers    []jwtProviderData
+	Requirements []jwtRequirementData // ordered by name
+}
+
+// jwtProviderData is an issuer of accepted tokens
+type jwtProviderData struct {
+	Name          string
+	Issuer        string
+	Audiences     []string
+	URI           string // of the signing keys
+	ClusterName   string // the JWKS cluster
+	Forward       bool
+	CacheDuration int
+}
+
+// jwtRequirementData accepts a token from any of the providers
+type jwtRequirementData struct {
+	Name      string
+	Providers []string
+}
+
+// routeJWTData is the token requirement of a route; required claims are
+// checked by its routeAccessData
+type routeJWTData struct {
+	Requirement string // empty when Disabled
+	Disabled    bool
+}
+
+// jwtClaimData is a claim value a route requires
+type jwtClaimData struct {
+	Name  string
+	Value string
+}
+
+// jwksClusterName returns the name of the cluster a provider's signing keys
+// are fetched from
+func jwksClusterName(lb *models.LoadBalancer, provider string) string {
+	return fmt.Sprintf("jwks_%s_%s", lb.ID, provider)
+}
+
+// routeRequirementName returns the requirement of a route accepting tokens
+// from its own providers
+func routeRequirementName(route string) string {
+	return "route_" + route
+}
+
+// newJWTAuthData prepares the JWT authentication filter, applying defaults
+func newJWTAuthData(lb *models.LoadBalancer) *jwtAuthData {
+	data := &jwtAuthData{}
+	all := make([]string, 0, len(lb.JWTAuth.Providers))
+	for _, p := range lb.JWTAuth.Providers {
+		cacheDuration := p.CacheDuration
+		if cacheDuration == 0 {
+			cacheDuration = defaultJWKSCacheDuration
+		}
+		data.Providers = append(data.Providers, jwtProviderData{
+			Name:          p.Name,
+			Issuer:        p.Issuer,
+			Audiences:     p.Audiences,
+			URI:           p.JWKSURI,
+			ClusterName:   jwksClusterName(lb, p.Name),
+			Forward:       p.Forward,
+			CacheDuration: cacheDuration,
+		})
+		all = append(all, p.Name)
+	}
+
+	data.Requirements = []jwtRequirementData{{Name: jwtAnyProvider, Providers: all}}
+	for _, route := range lb.Routes {
+		if route.JWT == nil {
+			continue
+		}
+		if len(route.JWT.Providers) > 0 {
+			data.Requirements = append(data.Requirements, jwtRequirementData{Name: routeRequirementName(route.Name), Providers: route.JWT.Providers})
+		}
+	}
+	sort.Slice(data.Requirements, func(i, j int) bool { return data.Requirements[i].Name < data.Requirements[j].Name })
+	return data
+}
+
+// newRouteJWTData returns the token requirement of route, or of the default
+// route when route is nil. It is nil without JWT authentication.
+func newRouteJWTData(lb *models.LoadBalancer, route *models.Route) *routeJWTData {
+	if lb.JWTAuth == nil {
+		return nil
+	}
+	if route == nil || route.JWT == nil {
+		return &routeJWTData{Requirement: jwtAnyProvider}
+	}
+	if route.JWT.Disabled {
+		return &routeJWTData{Disabled: true}
+	}
+
+	if len(route.JWT.Providers) > 0 {
+		return &routeJWTData{Requirement: routeRequirementName(route.Name)}
+	}
+	return &routeJWTData{Requirement: jwtAnyProvider}
+}
+
+// newJWKSClusterData prepares the cluster a provider's signing keys are
+// fetched from, over TLS verified against the system CAs for https URIs
+func newJWKSClusterData(lb *models.LoadBalancer, p *models.JWTProvider) (*clusterData, error) {
+	host, port, tls, err := p.JWKSAddress()
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwks_uri of provider %s: %w", p.Name, err)
+	}
+	if err := validateAddress(host); err != nil {
+		return nil, fmt.Errorf("invalid jwks_uri of provider %s: %w", p.Name, err)
+	}
+	data := &clusterData{
+		Name:              jwksClusterName(lb, p.Name),
+		ConnectTimeout:    defaultConnectTimeout,
+		Type:              "STRICT_DNS",
+		LoadBalancingAlgo: string(models.AlgoRoundRobin),
+		Localities:        []localityData{{Endpoints: []endpointData{{Address: host, Port: port}}}},
+	}
+	if tls {
+		data.UpstreamTLS = &upstreamTLSData{ServerName: host, SANType: "DNS", CAFile: systemCAFile}
+		if net.ParseIP(host) != nil {
+			data.UpstreamTLS.SANType = "IP_ADDRESS"
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,98 @@
+package envoy
+
+import (
+	"sort"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// Locality is the region and zone of the load balancer node or of a backend
+type Locality struct {
+	Region string
+	Zone   string
+}
+
+// SetLocality sets the region and zone of the node running Envoy. Backends
+// in other zones, then other regions, only get traffic when the closer ones
+// are unhealthy.
+func (g *Generator) SetLocality(l Locality) {
+	g.locality = l
+}
+
+// localityTier ranks a backend by its distance from the node: 0 for the same
+// zone, 1 for another zone of the region, 2 for another region. Backends are
+// assumed local when either side has no locality.
+func (l Locality) localityTier(backend Locality) int {
+	switch {
+	case l.Region != "" && backend.Region != "" && l.Region != backend.Region:
+		return 2
+	case l.Zone != "" && backend.Zone != "" && l.Zone != backend.Zone:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// localityData is the enabled backends of one Envoy priority and locality
+type localityData struct {
+	Region    string
+	Zone      string
+	Priority  int
+	Endpoints []endpointData
+}
+
+// groupEndpoints groups the enabled backends by priority and locality.
+// Envoy priorities follow the backend priority first and the locality tier
+// second, numbered from 0 without gaps. Without enabled backends a single
+// empty group is returned.
+func groupEndpoints(backends []models.Backend, node Locality) []localityData {
+	type groupKey struct {
+		priority, tier int
+		locality       Locality
+	}
+	groups := make(map[groupKey][]endpointData)
+	for _, backend := range backends {
+		if !backend.Enabled {
+			continue
+		}
+		locality := Locality{Region: backend.Region, Zone: backend.Zone}
+		key := groupKey{priority: backend.Priority, tier: node.localityTier(locality), locality: locality}
+		groups[key] = append(groups[key], endpointData{Address: backend.Address, Port: backend.Port, Weight: backend.Weight, Hostname: backend.ID})
+	}
+	if len(groups) == 0 {
+		return []localityData{{}}
+	}
+
+	keys := make([]groupKey, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.priority != b.priority {
+			return a.priority < b.priority
+		}
+		if a.tier != b.tier {
+			return a.tier < b.tier
+		}
+		if a.locality.Region != b.locality.Region {
+			return a.locality.Region < b.locality.Region
+		}
+		return a.locality.Zone < b.locality.Zone
+	})
+
+	localities := make([]localityData, 0, len(keys))
+	priority := 0
+	for i, key := range keys {
+		if i > 0 && (key.priority != keys[i-1].priority || key.tier != keys[i-1].tier) {
+			priority++
+		}
+		localities = append(localities, localityData{
+			Region:    key.locality.Region,
+			Zone:      key.locality.Zone,
+			Priority:  priority,
+			Endpoints: groups[key],
+		})
+	}
+	return localities
+}
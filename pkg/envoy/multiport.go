@@ -0,0 +1,82 @@
+package envoy
+
+import (
+	"fmt"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// PortClusterName returns the Envoy cluster name of one additional port of
+// a multi-port load balancer
+func PortClusterName(lb *models.LoadBalancer, port int) string {
+	return fmt.Sprintf("cluster_%s_port_%d", lb.ID, port)
+}
+
+// applyTCPHelper adapts the listener of a TCP load balancer to its helper.
+// FTP hashes connections by client address, so the passive data connections
+// reach the backend holding the control connection; IMAP keeps IDLE
+// connections open longer than the clients' IDLE refresh.
+func applyTCPHelper(lb *models.LoadBalancer, data *listenerData) {
+	if lb.Protocol != models.ProtocolTCP {
+		return
+	}
+	data.HashSourceIP = lb.Helper == models.TCPHelperFTP
+	if minIdle := lb.Helper.IdleTimeout(); minIdle > 0 {
+		idle := data.IdleTimeout
+		if idle == 0 && data.Timeouts != nil {
+			idle = data.Timeouts.Idle
+		}
+		// 0 keeps Envoy's default of one hour
+		if idle > 0 && idle < minIdle {
+			data.IdleTimeout = minIdle
+		}
+	}
+}
+
+// newPortListenersData prepares the listeners of the additional ports of lb
+// from the listener of its main port: each forwards to its own cluster and
+// shares the main listener's statistics, limits and tuning
+func newPortListenersData(lb *models.LoadBalancer, main *listenerData) []*listenerData {
+	ports := lb.AdditionalPorts()
+	listeners := make([]*listenerData, 0, len(ports))
+	for _, port := range ports {
+		data := *main
+		data.Name = fmt.Sprintf("listener_%s_%d", lb.Protocol, port)
+		data.Port = port
+		data.ClusterName = PortClusterName(lb, port)
+		data.TCPChains = []tcpChainData{{Cluster: data.ClusterName}}
+		listeners = append(listeners, &data)
+	}
+	return listeners
+}
+
+// newPortClustersData prepares the clusters of the additional ports of lb:
+// the load balancer's backends at each port. Backends are health checked on
+// their main port, so every port sees the same healthy backends and the FTP
+// helper's hash picks the same backend on all of them.
+func newPortClustersData(lb *models.LoadBalancer, node Locality) ([]*clusterData, error) {
+	var clusters []*clusterData
+	for _, port := range lb.AdditionalPorts() {
+		data, err := newClusterData(lb, nil, PortClusterName(lb, port), lb.Backends, node)
+		if err != nil {
+			return nil, fmt.Errorf("port %d: %w", port, err)
+		}
+		forwardToPort(data, port)
+		clusters = append(clusters, data)
+	}
+	return clusters, nil
+}
+
+// forwardToPort points the endpoints of a cluster at port, keeping the
+// health checks on the backends' own port
+func forwardToPort(data *clusterData, port int) {
+	for i := range data.Localities {
+		for j := range data.Localities[i].Endpoints {
+			ep := &data.Localities[i].Endpoints[j]
+			if data.HealthCheck != nil && ep.Port != port {
+				ep.HealthCheckPort = ep.Port
+			}
+			ep.Port = port
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package envoy
+
+// OverloadConfig configures the Envoy overload manager's heap protection.
+// Thresholds are percentages of MaxHeapBytes; 0 disables an action.
+type OverloadConfig struct {
+	MaxHeapBytes                    uint64
+	ShrinkHeapPercent               float64
+	DisableKeepalivePercent         float64
+	StopAcceptingRequestsPercent    float64
+	StopAcceptingConnectionsPercent float64
+}
+
+// overloadAction is an overload action and its heap usage threshold (0-1)
+type overloadAction struct {
+	Name      string
+	Threshold float64
+}
+
+// overloadActions maps each overload action to its threshold
+func (o *OverloadConfig) overloadActions() []overloadAction {
+	actions := make([]overloadAction, 0, 4)
+	add := func(name string, percent float64) {
+		if percent > 0 {
+			actions = append(actions, overloadAction{Name: name, Threshold: percent / 100})
+		}
+	}
+	add("envoy.overload_actions.shrink_heap", o.ShrinkHeapPercent)
+	add("envoy.overload_actions.disable_http_keepalive", o.DisableKeepalivePercent)
+	add("envoy.overload_actions.stop_accepting_requests", o.StopAcceptingRequestsPercent)
+	add("envoy.overload_actions.stop_accepting_connections", o.StopAcceptingConnectionsPercent)
+	return actions
+}
+
+// SetOverload enables heap-based overload protection in the bootstrap
+// configuration. A zero MaxHeapBytes leaves only the connection limit.
+func (g *Generator) SetOverload(o OverloadConfig) {
+	g.overload = o
+}
+
+// overloadData is the heap protection of the overload manager
+type overloadData struct {
+	MaxHeapBytes uint64
+	Actions      []overloadAction
+}
+
+// newOverloadData prepares the overload manager's heap protection, or nil
+// without a heap limit
+func (g *Generator) newOverloadData() *overloadData {
+	if g.overload.MaxHeapBytes == 0 {
+		return nil
+	}
+	return &overloadData{
+		MaxHeapBytes: g.overload.MaxHeapBytes,
+		Actions:      g.overload.overloadActions(),
+	}
+}
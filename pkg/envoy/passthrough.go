@@ -0,0 +1,27 @@
+package envoy
+
+import "github.com/vpsie/vpsie-loadbalancer/pkg/models"
+
+// tcpChainData is a filter chain of a TCP listener: the connections for its
+// server names, or without any, all other connections
+type tcpChainData struct {
+	ServerNames []string
+	Cluster     string
+}
+
+// newTCPChainsData prepares the filter chains of a TCP listener: one per TLS
+// passthrough route, ahead of the chain to the load balancer's own backends.
+// Without own backends, connections matching no route find no chain and are
+// closed by Envoy.
+func newTCPChainsData(lb *models.LoadBalancer) []tcpChainData {
+	var chains []tcpChainData
+	if lb.TLSPassthrough != nil {
+		for _, route := range lb.TLSPassthrough.Routes {
+			chains = append(chains, tcpChainData{ServerNames: route.ServerNames, Cluster: ClusterName(lb, route.Pool)})
+		}
+		if !lb.HasDefaultPool() {
+			return chains
+		}
+	}
+	return append(chains, tcpChainData{Cluster: ClusterName(lb, "")})
+}
@@ -1,51 +1,235 @@
 package envoy
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
+	"time"
 )
 
+// maxEpoch bounds restored epochs; Envoy keeps the epoch in a 32-bit field
+const maxEpoch = math.MaxInt32 - 1
+
+// Reload strategies select how a new configuration is applied to Envoy
+const (
+	// StrategyHotRestart starts a new Envoy process that takes over from the running one (default)
+	StrategyHotRestart = "hot-restart"
+	// StrategySIGHUP signals the process in the PID file, e.g. a hot restart wrapper
+	StrategySIGHUP = "sighup"
+	// StrategySystemd runs systemctl reload on the Envoy unit
+	StrategySystemd = "systemd"
+	// StrategyDrainRestart drains the listeners, stops Envoy and starts it again
+	StrategyDrainRestart = "admin-drain+restart"
+)
+
+// Strategies lists the accepted reload strategies
+var Strategies = []string{StrategyHotRestart, StrategySIGHUP, StrategySystemd, StrategyDrainRestart}
+
+const (
+	// serverInfoTimeout bounds the admin query made before each hot restart
+	serverInfoTimeout = 3 * time.Second
+	// exitTimeout bounds the wait for a stopped Envoy to exit
+	exitTimeout = 30 * time.Second
+	// exitPollInterval is how often a stopping Envoy is checked
+	exitPollInterval = 250 * time.Millisecond
+	// drainTime is how long a hot restarted parent drains its listeners
+	drainTime = 5 * time.Second
+	// parentShutdownTime is when a hot restarted parent exits, counted from the child start
+	parentShutdownTime = 10 * time.Second
+	// handoffTimeout bounds a hot restart: the child must be live and the parent gone
+	handoffTimeout = parentShutdownTime + 20*time.Second
+)
+
+// runFunc runs a command and returns its combined output
+type runFunc func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+// runCommand runs a system command
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	// #nosec G204 -- the command name is a constant and the unit name is validated by the agent configuration
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
+
+// ServerInfoSource reports the state of the running Envoy
+type ServerInfoSource interface {
+	ServerInfo(ctx context.Context) (*ServerInfo, error)
+}
+
+// Drainer drains and stops Envoy through its admin interface
+type Drainer interface {
+	ServerInfoSource
+	DrainListeners(ctx context.Context) error
+	Quit(ctx context.Context) error
+}
+
 // Reloader handles hot reloading of Envoy configuration
 type Reloader struct {
-	envoyBinary  string
-	configPath   string
-	pidFile      string
-	currentEpoch atomic.Int32
-	mu           sync.Mutex // Protects Reload() from concurrent execution
+	runtime        Runtime
+	configPath     string
+	pidFile        string
+	epochFile      string // last restart epoch, so it keeps increasing across agent restarts
+	serverInfo     ServerInfoSource
+	run            runFunc
+	handoffTimeout time.Duration
+	currentEpoch   atomic.Int32
+	mu             sync.Mutex // Protects Reload() from concurrent execution
+}
+
+// NewReloader creates a new Envoy reloader. The restart epoch is restored
+// from epochFile; a missing file starts at epoch 0 and an empty epochFile
+// disables persistence.
+func NewReloader(envoyBinary, configPath, pidFile, epochFile string) (*Reloader, error) {
+	r := &Reloader{
+		runtime:        Binary(envoyBinary),
+		configPath:     configPath,
+		pidFile:        pidFile,
+		epochFile:      epochFile,
+		run:            runCommand,
+		handoffTimeout: handoffTimeout,
+	}
+	if epochFile == "" {
+		return r, nil
+	}
+
+	// #nosec G304 -- epochFile comes from the agent configuration
+	data, err := os.ReadFile(epochFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read epoch file: %w", err)
+	}
+	epoch, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || epoch < 0 || epoch > maxEpoch {
+		return nil, fmt.Errorf("invalid restart epoch in %s: %q", epochFile, strings.TrimSpace(string(data)))
+	}
+	r.currentEpoch.Store(int32(epoch))
+	return r, nil
+}
+
+// SetRuntime makes the reloader start Envoy with rt instead of the binary
+func (r *Reloader) SetRuntime(rt Runtime) {
+	r.runtime = rt
+}
+
+// SetRemote makes the reloader reload an Envoy running on a remote host:
+// systemctl runs there over SSH. Only the systemd strategy works remotely.
+func (r *Reloader) SetRemote(remote *Remote) {
+	r.runtime = remote
+	r.run = remote.Run
+}
+
+// SetServerInfoSource makes Reload take the restart epoch from the running
+// Envoy instead of only the agent's own counter, which drifts when Envoy is
+// restarted outside the agent
+func (r *Reloader) SetServerInfoSource(src ServerInfoSource) {
+	r.serverInfo = src
 }
 
-// NewReloader creates a new Envoy reloader
-func NewReloader(envoyBinary, configPath, pidFile string) *Reloader {
-	return &Reloader{
-		envoyBinary: envoyBinary,
-		configPath:  configPath,
-		pidFile:     pidFile,
-		// currentEpoch defaults to 0 (zero value of atomic.Int32)
+// syncEpoch aligns the epoch counter with the running Envoy before a hot
+// restart. It fails while Envoy is still starting up from a previous restart,
+// because Envoy allows only one hot restart at a time.
+func (r *Reloader) syncEpoch() error {
+	if r.serverInfo == nil {
+		return nil
 	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), serverInfoTimeout)
+	defer cancel()
+	info, err := r.serverInfo.ServerInfo(ctx)
+	if err != nil {
+		// No admin answer: if the PID file names a dead process there is no
+		// parent to hand over from, so the next start is a cold start at epoch 0
+		if pid, pidErr := r.PID(); pidErr == nil && !processAlive(pid) {
+			r.currentEpoch.Store(-1)
+		}
+		return nil
+	}
+
+	if info.State == ServerStatePreInitializing || info.State == ServerStateInitializing {
+		return fmt.Errorf("envoy is %s after its last restart; try again later", info.State)
+	}
+	r.currentEpoch.Store(int32(info.RestartEpoch))
+	return nil
+}
+
+// saveEpoch persists epoch atomically so a restarted agent continues from it
+func (r *Reloader) saveEpoch(epoch int32) error {
+	if r.epochFile == "" {
+		return nil
+	}
+	if err := writeFileAtomic(r.epochFile, strconv.Itoa(int(epoch))+"\n"); err != nil {
+		return fmt.Errorf("failed to write epoch file: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data through a temporary file
+func writeFileAtomic(path, data string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(data), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
 }
 
-// Reload performs a hot restart of Envoy with the new configuration
+// Reload performs a hot restart of Envoy with the new configuration and
+// waits until the new process has taken over; see handoff
 func (r *Reloader) Reload() error {
 	// Ensure only one reload happens at a time to prevent epoch desynchronization
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if err := r.syncEpoch(); err != nil {
+		return err
+	}
+
+	// The process in the PID file is the parent the new process takes over from
+	parent, err := r.PID()
+	if err != nil {
+		parent = 0
+	}
+
 	// Increment epoch atomically
-	newEpoch := r.currentEpoch.Add(1)
+	epoch := r.currentEpoch.Add(1)
+	child, err := r.start(epoch)
+	if err != nil {
+		return err
+	}
+	return r.handoff(child, epoch, parent)
+}
+
+// start persists epoch and starts a new Envoy process with it
+func (r *Reloader) start(epoch int32) (*process, error) {
+	// Persist before starting Envoy: a crash after the start must not let the
+	// next agent reuse an epoch that is already running
+	if err := r.saveEpoch(epoch); err != nil {
+		return nil, fmt.Errorf("failed to persist restart epoch %d: %w", epoch, err)
+	}
 
 	// Build command for hot restart
-	// #nosec G204 -- envoyBinary is set at initialization, not from user input
-	cmd := exec.Command(
-		r.envoyBinary,
+	cmd := r.runtime.Command(
+		context.Background(),
+		fmt.Sprintf("epoch-%d", epoch),
 		"-c", r.configPath,
-		"--restart-epoch", strconv.Itoa(int(newEpoch)),
-		"--parent-shutdown-time-s", "10",
+		"--restart-epoch", strconv.Itoa(int(epoch)),
+		"--drain-time-s", strconv.Itoa(int(drainTime.Seconds())),
+		"--parent-shutdown-time-s", strconv.Itoa(int(parentShutdownTime.Seconds())),
 	)
 
 	// Start the new Envoy process (detached, will continue running)
@@ -54,39 +238,102 @@ func (r *Reloader) Reload() error {
 		// could cause epoch collisions if a previous Envoy process is still
 		// running with the same epoch. Instead, we leave the epoch incremented
 		// and log the error. The next reload attempt will use the next epoch.
-		return fmt.Errorf("failed to start new Envoy process (epoch %d): %w", newEpoch, err)
+		return nil, fmt.Errorf("failed to start new Envoy process (epoch %d): %w", epoch, err)
 	}
 
-	// Release the process handle - Envoy will continue running independently
-	// The hot restart mechanism will handle the transition between old and new processes
-	//nolint:errcheck // Intentionally ignore - process will continue running even if release fails
-	cmd.Process.Release()
+	// Reap the process when it exits, so a shut down parent does not linger
+	// as a zombie that still looks alive to the next hot restart
+	p := &process{pid: cmd.Process.Pid, exited: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.exited)
+	}()
+	return p, nil
+}
 
+// ReloadSystemd asks systemd to reload the unit running Envoy, for installs
+// where Envoy is managed by systemd rather than started by the agent
+func (r *Reloader) ReloadSystemd(ctx context.Context, unit string) error {
+	return r.systemctl(ctx, "reload", unit)
+}
+
+// RestartSystemd restarts the systemd unit running Envoy, which is needed
+// for bootstrap changes. Connections are dropped.
+func (r *Reloader) RestartSystemd(ctx context.Context, unit string) error {
+	return r.systemctl(ctx, "restart", unit)
+}
+
+// systemctl runs a systemctl action on unit
+func (r *Reloader) systemctl(ctx context.Context, action, unit string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if output, err := r.run(ctx, "systemctl", action, unit); err != nil {
+		return fmt.Errorf("systemctl %s %s failed: %w: %s", action, unit, err, strings.TrimSpace(string(output)))
+	}
 	return nil
 }
 
-// ReloadGraceful sends SIGHUP to the running Envoy process for graceful reload
-func (r *Reloader) ReloadGraceful() error {
-	// Read PID from file
-	pidData, err := os.ReadFile(r.pidFile)
-	if err != nil {
-		return fmt.Errorf("failed to read PID file: %w", err)
+// DrainAndRestart restarts Envoy without hot restart: it drains the
+// listeners through the admin interface, waits drainTime for connections to
+// finish, stops Envoy and starts a new process at epoch 0. Use it where hot
+// restart is unavailable, e.g. without shared memory between the processes.
+// New connections are refused between the stop and the start.
+func (r *Reloader) DrainAndRestart(ctx context.Context, admin Drainer, drainTime time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := admin.DrainListeners(ctx); err != nil {
+		return fmt.Errorf("failed to drain listeners: %w", err)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(drainTime):
 	}
 
-	// Trim whitespace and newlines to prevent injection attacks
-	pidStr := strings.TrimSpace(string(pidData))
+	if err := admin.Quit(ctx); err != nil {
+		return fmt.Errorf("failed to stop Envoy: %w", err)
+	}
+	if err := waitForExit(ctx, admin); err != nil {
+		return err
+	}
 
-	// Validate PID format (must be positive integer)
-	pid, err := strconv.Atoi(pidStr)
+	r.currentEpoch.Store(0)
+	child, err := r.start(0)
 	if err != nil {
-		return fmt.Errorf("invalid PID in file: %w", err)
+		return err
 	}
+	return r.handoff(child, 0, 0)
+}
 
-	// Validate PID range (must be positive and within reasonable bounds)
-	// Linux max PID is typically 4194304, Darwin/macOS max is 99999
-	const maxPID = 4194304
-	if pid <= 0 || pid > maxPID {
-		return fmt.Errorf("PID out of valid range: %d (must be between 1 and %d)", pid, maxPID)
+// waitForExit polls the admin interface until Envoy stops answering
+func waitForExit(ctx context.Context, admin ServerInfoSource) error {
+	ctx, cancel := context.WithTimeout(ctx, exitTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(exitPollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := admin.ServerInfo(ctx); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("envoy did not exit within %s", exitTimeout)
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("envoy did not exit within %s", exitTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReloadGraceful sends SIGHUP to the running Envoy process for graceful reload
+func (r *Reloader) ReloadGraceful() error {
+	pid, err := r.PID()
+	if err != nil {
+		return err
 	}
 
 	// Find the process
@@ -103,6 +350,38 @@ func (r *Reloader) ReloadGraceful() error {
 	return nil
 }
 
+// PID returns the Envoy process ID from the PID file
+func (r *Reloader) PID() (int, error) {
+	pidData, err := os.ReadFile(r.pidFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read PID file: %w", err)
+	}
+
+	// Trim whitespace and newlines to prevent injection attacks
+	pidStr := strings.TrimSpace(string(pidData))
+
+	// Validate PID format (must be positive integer)
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid PID in file: %w", err)
+	}
+
+	// Validate PID range (must be positive and within reasonable bounds)
+	// Linux max PID is typically 4194304, Darwin/macOS max is 99999
+	const maxPID = 4194304
+	if pid <= 0 || pid > maxPID {
+		return 0, fmt.Errorf("PID out of valid range: %d (must be between 1 and %d)", pid, maxPID)
+	}
+	return pid, nil
+}
+
+// processAlive reports whether a process with pid exists. A process owned by
+// another user answers EPERM, which still means it exists.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
 // GetCurrentEpoch returns the current restart epoch
 func (r *Reloader) GetCurrentEpoch() int {
 	return int(r.currentEpoch.Load())
@@ -1,13 +1,22 @@
 package envoy
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestReloader_EpochIncrement(t *testing.T) {
-	r := NewReloader("/nonexistent/envoy", "/tmp/envoy.yaml", "/tmp/envoy.pid")
+	r, err := NewReloader("/nonexistent/envoy", "/tmp/envoy.yaml", "/tmp/envoy.pid", "")
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
 
 	if r.GetCurrentEpoch() != 0 {
 		t.Fatalf("expected initial epoch 0, got %d", r.GetCurrentEpoch())
@@ -34,7 +43,10 @@ func TestReloader_EpochIncrement(t *testing.T) {
 }
 
 func TestReloader_ReloadGraceful_MissingPIDFile(t *testing.T) {
-	r := NewReloader("/usr/bin/envoy", "/tmp/envoy.yaml", "/nonexistent/envoy.pid")
+	r, err := NewReloader("/usr/bin/envoy", "/tmp/envoy.yaml", "/nonexistent/envoy.pid", "")
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
 
 	gracefulErr := r.ReloadGraceful()
 	if gracefulErr == nil {
@@ -52,7 +64,10 @@ func TestReloader_ReloadGraceful_NonNumericPID(t *testing.T) {
 		t.Fatalf("failed to write PID file: %v", writeErr)
 	}
 
-	r := NewReloader("/usr/bin/envoy", "/tmp/envoy.yaml", pidFile)
+	r, err := NewReloader("/usr/bin/envoy", "/tmp/envoy.yaml", pidFile, "")
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
 
 	gracefulErr := r.ReloadGraceful()
 	if gracefulErr == nil {
@@ -69,10 +84,323 @@ func TestReloader_ReloadGraceful_InvalidPIDRange(t *testing.T) {
 		t.Fatalf("failed to write PID file: %v", writeErr)
 	}
 
-	r := NewReloader("/usr/bin/envoy", "/tmp/envoy.yaml", pidFile)
+	r, err := NewReloader("/usr/bin/envoy", "/tmp/envoy.yaml", pidFile, "")
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
 
 	gracefulErr := r.ReloadGraceful()
 	if gracefulErr == nil {
 		t.Fatal("expected error for negative PID")
 	}
 }
+
+func TestReloader_EpochPersistence(t *testing.T) {
+	epochFile := filepath.Join(t.TempDir(), "state", "envoy.epoch")
+
+	r, err := NewReloader("/nonexistent/envoy", "/tmp/envoy.yaml", "/tmp/envoy.pid", epochFile)
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	if r.GetCurrentEpoch() != 0 {
+		t.Fatalf("expected initial epoch 0 without epoch file, got %d", r.GetCurrentEpoch())
+	}
+	_ = r.Reload()
+	_ = r.Reload()
+
+	// A restarted agent continues from the persisted epoch
+	restarted, err := NewReloader("/nonexistent/envoy", "/tmp/envoy.yaml", "/tmp/envoy.pid", epochFile)
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	if restarted.GetCurrentEpoch() != 2 {
+		t.Fatalf("expected restored epoch 2, got %d", restarted.GetCurrentEpoch())
+	}
+}
+
+func TestReloader_EpochFileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "not a number", content: "abc\n"},
+		{name: "negative", content: "-3\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			epochFile := filepath.Join(t.TempDir(), "envoy.epoch")
+			if err := os.WriteFile(epochFile, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("failed to write epoch file: %v", err)
+			}
+			if _, err := NewReloader("/usr/bin/envoy", "/tmp/envoy.yaml", "/tmp/envoy.pid", epochFile); err == nil {
+				t.Error("expected error for invalid epoch file")
+			}
+		})
+	}
+}
+
+// fakeServerInfo reports a fixed server info or error
+type fakeServerInfo struct {
+	info *ServerInfo
+	err  error
+}
+
+func (f *fakeServerInfo) ServerInfo(context.Context) (*ServerInfo, error) {
+	return f.info, f.err
+}
+
+func TestReloader_EpochFromServerInfo(t *testing.T) {
+	tmpDir := t.TempDir()
+	alivePID := filepath.Join(tmpDir, "alive.pid")
+	deadPID := filepath.Join(tmpDir, "dead.pid")
+	if err := os.WriteFile(alivePID, []byte(strconv.Itoa(os.Getpid())), 0600); err != nil {
+		t.Fatalf("failed to write PID file: %v", err)
+	}
+	// PID 4194304 is out of reach on typical systems but within the accepted range
+	if err := os.WriteFile(deadPID, []byte("4194304"), 0600); err != nil {
+		t.Fatalf("failed to write PID file: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		source    *fakeServerInfo
+		pidFile   string
+		wantEpoch int
+		wantErr   bool
+	}{
+		{
+			name:      "running envoy epoch wins",
+			source:    &fakeServerInfo{info: &ServerInfo{State: ServerStateLive, RestartEpoch: 7}},
+			pidFile:   alivePID,
+			wantEpoch: 8,
+		},
+		{
+			name:      "unreachable but alive keeps counter",
+			source:    &fakeServerInfo{err: errors.New("connection refused")},
+			pidFile:   alivePID,
+			wantEpoch: 4,
+		},
+		{
+			name:      "unreachable and dead starts cold",
+			source:    &fakeServerInfo{err: errors.New("connection refused")},
+			pidFile:   deadPID,
+			wantEpoch: 0,
+		},
+		{
+			name:      "still initializing",
+			source:    &fakeServerInfo{info: &ServerInfo{State: ServerStateInitializing, RestartEpoch: 3}},
+			pidFile:   alivePID,
+			wantEpoch: 3,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReloader("/nonexistent/envoy", "/tmp/envoy.yaml", tt.pidFile, "")
+			if err != nil {
+				t.Fatalf("NewReloader() error = %v", err)
+			}
+			r.currentEpoch.Store(3)
+			r.SetServerInfoSource(tt.source)
+
+			// The binary does not exist, so Reload always fails after choosing the epoch
+			err = r.Reload()
+			if tt.wantErr && (err == nil || !strings.Contains(err.Error(), "INITIALIZING")) {
+				t.Errorf("Reload() error = %v, want an initializing error", err)
+			}
+			if r.GetCurrentEpoch() != tt.wantEpoch {
+				t.Errorf("epoch = %d, want %d", r.GetCurrentEpoch(), tt.wantEpoch)
+			}
+		})
+	}
+}
+
+func TestReloader_ReloadSystemd(t *testing.T) {
+	tests := []struct {
+		name    string
+		runErr  error
+		output  string
+		wantErr string
+	}{
+		{name: "reloaded"},
+		{name: "reload fails", runErr: errors.New("exit status 1"), output: "Job for envoy.service failed.\n", wantErr: "Job for envoy.service failed."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReloader("/nonexistent/envoy", "/tmp/envoy.yaml", "/tmp/envoy.pid", "")
+			if err != nil {
+				t.Fatalf("NewReloader() error = %v", err)
+			}
+			var command []string
+			r.run = func(_ context.Context, name string, args ...string) ([]byte, error) {
+				command = append([]string{name}, args...)
+				return []byte(tt.output), tt.runErr
+			}
+
+			err = r.ReloadSystemd(context.Background(), "envoy.service")
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("ReloadSystemd() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("ReloadSystemd() error = %v, want containing %q", err, tt.wantErr)
+			}
+			if got := strings.Join(command, " "); got != "systemctl reload envoy.service" {
+				t.Errorf("ran %q, want systemctl reload envoy.service", got)
+			}
+			if r.GetCurrentEpoch() != 0 {
+				t.Errorf("epoch = %d, systemd reloads must not change it", r.GetCurrentEpoch())
+			}
+		})
+	}
+}
+
+// fakeDrainer records admin calls; Envoy stops answering once it was told to quit
+type fakeDrainer struct {
+	calls    []string
+	drainErr error
+}
+
+func (f *fakeDrainer) ServerInfo(context.Context) (*ServerInfo, error) {
+	if len(f.calls) > 0 && f.calls[len(f.calls)-1] == "quit" {
+		return nil, errors.New("connection refused")
+	}
+	return &ServerInfo{State: ServerStateDraining}, nil
+}
+
+func (f *fakeDrainer) DrainListeners(context.Context) error {
+	f.calls = append(f.calls, "drain")
+	return f.drainErr
+}
+
+func (f *fakeDrainer) Quit(context.Context) error {
+	f.calls = append(f.calls, "quit")
+	return nil
+}
+
+func TestReloader_DrainAndRestart(t *testing.T) {
+	r, err := NewReloader("/nonexistent/envoy", "/tmp/envoy.yaml", "/tmp/envoy.pid", "")
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	r.currentEpoch.Store(5)
+
+	admin := &fakeDrainer{}
+	// The binary does not exist, so only the start of the new process fails
+	err = r.DrainAndRestart(context.Background(), admin, 0)
+	if err == nil || !strings.Contains(err.Error(), "epoch 0") {
+		t.Errorf("DrainAndRestart() error = %v, want a start failure at epoch 0", err)
+	}
+	if got := strings.Join(admin.calls, ","); got != "drain,quit" {
+		t.Errorf("admin calls = %s, want drain,quit", got)
+	}
+	if r.GetCurrentEpoch() != 0 {
+		t.Errorf("epoch = %d, want 0 after a cold start", r.GetCurrentEpoch())
+	}
+
+	// A failed drain leaves the running Envoy alone
+	admin = &fakeDrainer{drainErr: errors.New("connection refused")}
+	r.currentEpoch.Store(5)
+	if err = r.DrainAndRestart(context.Background(), admin, 0); err == nil {
+		t.Error("DrainAndRestart() succeeded with a failing drain")
+	}
+	if len(admin.calls) != 1 || r.GetCurrentEpoch() != 5 {
+		t.Errorf("calls = %v, epoch = %d; want only the drain and epoch 5", admin.calls, r.GetCurrentEpoch())
+	}
+}
+
+// sequenceServerInfo reports infos in turn and then keeps reporting the last one
+type sequenceServerInfo struct {
+	infos []*ServerInfo
+	calls int
+}
+
+func (s *sequenceServerInfo) ServerInfo(context.Context) (*ServerInfo, error) {
+	info := s.infos[min(s.calls, len(s.infos)-1)]
+	s.calls++
+	return info, nil
+}
+
+// fakeEnvoy writes an executable script standing in for the Envoy binary
+func fakeEnvoy(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "envoy")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0700); err != nil {
+		t.Fatalf("failed to write fake envoy: %v", err)
+	}
+	return path
+}
+
+func TestReloader_Handoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		infos   []*ServerInfo
+		wantErr string
+	}{
+		{
+			name:   "child becomes live",
+			script: "exec sleep 30",
+			infos: []*ServerInfo{
+				{State: ServerStateLive, RestartEpoch: 2},
+				{State: ServerStateInitializing, RestartEpoch: 3},
+				{State: ServerStateLive, RestartEpoch: 3},
+			},
+		},
+		{
+			name:    "child exits during startup",
+			script:  "exit 1",
+			infos:   []*ServerInfo{{State: ServerStateLive, RestartEpoch: 2}},
+			wantErr: "exited during startup",
+		},
+		{
+			name:    "child never becomes live",
+			script:  "exec sleep 30",
+			infos:   []*ServerInfo{{State: ServerStateLive, RestartEpoch: 2}},
+			wantErr: "not live within",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The parent in the PID file is already gone
+			pidFile := filepath.Join(t.TempDir(), "envoy.pid")
+			if err := os.WriteFile(pidFile, []byte("4194304"), 0600); err != nil {
+				t.Fatalf("failed to write PID file: %v", err)
+			}
+			r, err := NewReloader(fakeEnvoy(t, tt.script), "/tmp/envoy.yaml", pidFile, "")
+			if err != nil {
+				t.Fatalf("NewReloader() error = %v", err)
+			}
+			r.SetServerInfoSource(&sequenceServerInfo{infos: tt.infos})
+			r.handoffTimeout = time.Second
+
+			err = r.Reload()
+			pid, pidErr := r.PID()
+			if pidErr == nil && pid != 4194304 {
+				t.Cleanup(func() { _ = syscall.Kill(pid, syscall.SIGKILL) })
+			}
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Reload() error = %v, want containing %q", err, tt.wantErr)
+				}
+				if pid != 4194304 {
+					t.Errorf("PID file = %d, a failed handoff must keep the parent", pid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Reload() error = %v", err)
+			}
+			if pid == 4194304 || !processAlive(pid) {
+				t.Errorf("PID file = %d, want the running child", pid)
+			}
+			if r.GetCurrentEpoch() != 3 {
+				t.Errorf("epoch = %d, want 3", r.GetCurrentEpoch())
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package envoy
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Remote runs Envoy on another host, reached over SSH, so the agent can run
+// off the data plane node. Files are delivered with scp to the same path on
+// the remote host. Host keys are always checked against KnownHostsFile and
+// SSH never prompts, so a missing key fails instead of blocking the agent.
+type Remote struct {
+	Host           string // host name or address
+	Port           int    // SSH port, 0 for the SSH default
+	User           string // remote user, empty for the SSH default
+	IdentityFile   string // private key
+	KnownHostsFile string // host keys the remote host must present
+	Binary         string // Envoy binary on the remote host
+	run            runFunc
+}
+
+// NewRemote creates a remote runtime
+func NewRemote(host string, port int, user, identityFile, knownHostsFile, binary string) *Remote {
+	return &Remote{
+		Host:           host,
+		Port:           port,
+		User:           user,
+		IdentityFile:   identityFile,
+		KnownHostsFile: knownHostsFile,
+		Binary:         binary,
+		run:            runCommand,
+	}
+}
+
+// options returns the options shared by ssh and scp
+func (rm *Remote) options() []string {
+	return []string{
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=yes",
+		"-o", "UserKnownHostsFile=" + rm.KnownHostsFile,
+		"-o", "ConnectTimeout=10",
+		"-i", rm.IdentityFile,
+	}
+}
+
+// target returns the SSH destination
+func (rm *Remote) target() string {
+	if rm.User == "" {
+		return rm.Host
+	}
+	return rm.User + "@" + rm.Host
+}
+
+// scpTarget returns the remote host for scp, which needs an IPv6 address in
+// brackets: user@[2001:db8::5]
+func (rm *Remote) scpTarget() string {
+	host := rm.Host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if rm.User == "" {
+		return host
+	}
+	return rm.User + "@" + host
+}
+
+// sshArgs returns the ssh arguments running command on the remote host.
+// SSH hands the command to the remote shell, so every word is quoted.
+func (rm *Remote) sshArgs(name string, args ...string) []string {
+	sshArgs := rm.options()
+	if rm.Port != 0 {
+		sshArgs = append(sshArgs, "-p", strconv.Itoa(rm.Port))
+	}
+	sshArgs = append(sshArgs, rm.target(), "--", shellQuote(name))
+	for _, arg := range args {
+		sshArgs = append(sshArgs, shellQuote(arg))
+	}
+	return sshArgs
+}
+
+// Command implements Runtime. Envoy runs on the remote host; the name is
+// ignored since the agent never starts a long-running remote Envoy.
+func (rm *Remote) Command(ctx context.Context, _ string, args ...string) *exec.Cmd {
+	// #nosec G204 -- the host and binary come from the agent configuration
+	return exec.CommandContext(ctx, "ssh", rm.sshArgs(rm.Binary, args...)...)
+}
+
+func (rm *Remote) String() string {
+	return fmt.Sprintf("%s on %s", rm.Binary, rm.Host)
+}
+
+// Run runs a command on the remote host and returns its combined output
+func (rm *Remote) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return rm.run(ctx, "ssh", rm.sshArgs(name, args...)...)
+}
+
+// Put copies local files to the same paths on the remote host. Each file is
+// copied next to its destination and then renamed over it, so Envoy, which
+// watches its dynamic configuration files, never reads a partial file. The
+// remote directories must exist. Paths are not quoted for scp, whose
+// protocols disagree on quoting; the agent configuration only allows paths
+// without shell metacharacters.
+func (rm *Remote) Put(ctx context.Context, paths ...string) error {
+	for _, path := range paths {
+		tmpPath := path + ".tmp"
+		scpArgs := rm.options()
+		if rm.Port != 0 {
+			scpArgs = append(scpArgs, "-P", strconv.Itoa(rm.Port))
+		}
+		scpArgs = append(scpArgs, "-q", "--", path, rm.scpTarget()+":"+tmpPath)
+		if output, err := rm.run(ctx, "scp", scpArgs...); err != nil {
+			return fmt.Errorf("failed to copy %s to %s: %w: %s", path, rm.Host, err, strings.TrimSpace(string(output)))
+		}
+		if output, err := rm.Run(ctx, "mv", "-f", tmpPath, path); err != nil {
+			return fmt.Errorf("failed to replace %s on %s: %w: %s", filepath.Base(path), rm.Host, err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
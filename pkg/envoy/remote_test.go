@@ -0,0 +1,54 @@
+package envoy
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRemote_Command(t *testing.T) {
+	rm := NewRemote("10.0.0.5", 2222, "vpsie-lb", "/etc/vpsie-lb/id_ed25519", "/etc/vpsie-lb/known_hosts", "/usr/bin/envoy")
+
+	cmd := rm.Command(context.Background(), "", "--mode", "validate", "-c", "/etc/envoy/it's.yaml")
+	want := []string{"ssh", "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=yes",
+		"-o", "UserKnownHostsFile=/etc/vpsie-lb/known_hosts", "-o", "ConnectTimeout=10", "-i", "/etc/vpsie-lb/id_ed25519",
+		"-p", "2222", "vpsie-lb@10.0.0.5", "--", "'/usr/bin/envoy'", "'--mode'", "'validate'", "'-c'", `'/etc/envoy/it'\''s.yaml'`}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Command() args = %v, want %v", cmd.Args, want)
+	}
+}
+
+func TestRemote_Put(t *testing.T) {
+	tests := []struct {
+		host, user string
+		target     string
+	}{
+		{host: "2001:db8::5", target: "[2001:db8::5]"},
+		{host: "2001:db8::5", user: "vpsie-lb", target: "vpsie-lb@[2001:db8::5]"},
+		{host: "10.0.0.5", user: "vpsie-lb", target: "vpsie-lb@10.0.0.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			var calls []string
+			rm := NewRemote(tt.host, 0, tt.user, "/etc/vpsie-lb/id_ed25519", "/etc/vpsie-lb/known_hosts", "/usr/bin/envoy")
+			rm.run = func(_ context.Context, name string, args ...string) ([]byte, error) {
+				calls = append(calls, name+" "+strings.Join(args[len(args)-2:], " "))
+				return nil, nil
+			}
+
+			if err := rm.Put(context.Background(), "/etc/envoy/dynamic/listeners.yaml"); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			// The file is copied next to its destination, then renamed over it
+			want := []string{
+				"scp /etc/envoy/dynamic/listeners.yaml " + tt.target + ":/etc/envoy/dynamic/listeners.yaml.tmp",
+				"ssh '/etc/envoy/dynamic/listeners.yaml.tmp' '/etc/envoy/dynamic/listeners.yaml'",
+			}
+			if !reflect.DeepEqual(calls, want) {
+				t.Errorf("Put() ran %v, want %v", calls, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package envoy
+
+import (
+	"encoding/json"
+	"regexp"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// matchData is a route condition on a request header or query parameter
+type matchData struct {
+	Name    string
+	Value   string // the exact value, or with Regex the RE2 expression
+	Regex   bool
+	Present bool
+}
+
+// QuotedValue returns the value as a JSON string
+func (m matchData) QuotedValue() string {
+	quoted, _ := json.Marshal(m.Value)
+	return string(quoted)
+}
+
+// newMatchData prepares the header and query parameter conditions of a
+// route. Envoy cannot match cookies, so cookie conditions become
+// expressions on the cookie header.
+func newMatchData(route *models.Route) (headers, params []matchData) {
+	for _, c := range route.Headers {
+		headers = append(headers, conditionData(c))
+	}
+	for _, c := range route.Cookies {
+		headers = append(headers, cookieData(c))
+	}
+	for _, c := range route.QueryParams {
+		params = append(params, conditionData(c))
+	}
+	return headers, params
+}
+
+// conditionData converts a header or query parameter condition
+func conditionData(c models.MatchCondition) matchData {
+	switch c.Type() {
+	case models.MatchPresent:
+		return matchData{Name: c.Name, Present: true}
+	case models.MatchRegex:
+		return matchData{Name: c.Name, Value: c.Value, Regex: true}
+	default:
+		return matchData{Name: c.Name, Value: c.Value}
+	}
+}
+
+// cookieData matches a cookie in the cookie header. Envoy matches the whole
+// header, so the expression allows other cookies before and after it.
+func cookieData(c models.MatchCondition) matchData {
+	value := ".*"
+	switch c.Type() {
+	case models.MatchExact:
+		value = regexp.QuoteMeta(c.Value)
+	case models.MatchRegex:
+		value = "(?:" + c.Value + ")"
+	}
+	return matchData{
+		Name:  "cookie",
+		Value: `(?:.*;\s*)?` + regexp.QuoteMeta(c.Name) + "=" + value + "(?:;.*)?",
+		Regex: true,
+	}
+}
@@ -0,0 +1,109 @@
+package envoy
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Runtimes select where the Envoy binary runs
+const (
+	// RuntimeBinary runs the Envoy binary installed on the host (default)
+	RuntimeBinary = "binary"
+	// RuntimeDocker runs Envoy in a Docker container
+	RuntimeDocker = "docker"
+	// RuntimePodman runs Envoy in a Podman container
+	RuntimePodman = "podman"
+)
+
+// Runtimes lists the accepted runtimes
+var Runtimes = []string{RuntimeBinary, RuntimeDocker, RuntimePodman}
+
+// Runtime runs Envoy commands, on the host or in a container
+type Runtime interface {
+	// Command returns a command running Envoy with args. Long-running Envoy
+	// processes get a name, such as their restart epoch; one-off commands
+	// like validation pass "".
+	Command(ctx context.Context, name string, args ...string) *exec.Cmd
+	String() string
+}
+
+// Binary runs the Envoy binary at its path on the host
+type Binary string
+
+// Command implements Runtime
+func (b Binary) Command(ctx context.Context, _ string, args ...string) *exec.Cmd {
+	// #nosec G204 -- the binary path comes from the agent configuration
+	return exec.CommandContext(ctx, string(b), args...)
+}
+
+func (b Binary) String() string {
+	return string(b)
+}
+
+// Container runs Envoy in a container, for hosts where Envoy cannot be
+// installed such as immutable operating systems. Containers share the host's
+// network, IPC and PID namespaces: listeners bind the host's addresses and a
+// hot restart hands over from one container to the next. The engine's client
+// stays attached to the container, so its process stands for Envoy: it
+// forwards signals and exits with the container.
+type Container struct {
+	Engine    string   // docker or podman
+	Image     string   // pinned image, e.g. envoyproxy/envoy:v1.31.2
+	Name      string   // prefix of container names
+	Mounts    []string // host directories mounted read-only at the same path
+	LogDriver string   // engine log driver, empty for the engine's default
+	run       runFunc
+}
+
+// NewContainer creates a container runtime
+func NewContainer(engine, image, name, logDriver string, mounts []string) *Container {
+	return &Container{Engine: engine, Image: image, Name: name, Mounts: mounts, LogDriver: logDriver, run: runCommand}
+}
+
+// Command implements Runtime
+func (c *Container) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	runArgs := []string{"run", "--rm", "--network", "host", "--ipc", "host", "--pid", "host"}
+	if name != "" {
+		runArgs = append(runArgs, "--name", c.Name+"-"+name)
+	}
+	if c.LogDriver != "" {
+		runArgs = append(runArgs, "--log-driver", c.LogDriver)
+	}
+	for _, dir := range c.Mounts {
+		runArgs = append(runArgs, "--volume", dir+":"+dir+":ro")
+	}
+	runArgs = append(runArgs, "--entrypoint", "envoy", c.Image)
+	// #nosec G204 -- the engine and image come from the agent configuration
+	return exec.CommandContext(ctx, c.Engine, append(runArgs, args...)...)
+}
+
+func (c *Container) String() string {
+	return fmt.Sprintf("%s image %s", c.Engine, c.Image)
+}
+
+// Pull pulls the image unless the engine already has it. A pinned image
+// never changes, so a present one is not pulled again.
+func (c *Container) Pull(ctx context.Context) error {
+	if _, err := c.run(ctx, c.Engine, "image", "inspect", c.Image); err == nil {
+		return nil
+	}
+	if output, err := c.run(ctx, c.Engine, "pull", c.Image); err != nil {
+		return fmt.Errorf("%s pull %s failed: %w: %s", c.Engine, c.Image, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Pinned reports whether image names a fixed release: a digest, or a tag
+// other than latest
+func Pinned(image string) bool {
+	if strings.Contains(image, "@sha256:") {
+		return true
+	}
+	// A colon after the last slash separates the tag; one before it belongs
+	// to a registry port
+	tag := image[strings.LastIndex(image, "/")+1:]
+	_, version, ok := strings.Cut(tag, ":")
+	return ok && version != "" && version != "latest"
+}
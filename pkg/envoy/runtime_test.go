@@ -0,0 +1,74 @@
+package envoy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContainer_Command(t *testing.T) {
+	c := NewContainer(RuntimePodman, "envoyproxy/envoy:v1.31.2", "vpsie-envoy", "journald", []string{"/etc/envoy"})
+
+	cmd := c.Command(context.Background(), "epoch-2", "-c", "/etc/envoy/envoy.yaml")
+	want := []string{"podman", "run", "--rm", "--network", "host", "--ipc", "host", "--pid", "host",
+		"--name", "vpsie-envoy-epoch-2", "--log-driver", "journald", "--volume", "/etc/envoy:/etc/envoy:ro",
+		"--entrypoint", "envoy", "envoyproxy/envoy:v1.31.2", "-c", "/etc/envoy/envoy.yaml"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Command() args = %v, want %v", cmd.Args, want)
+	}
+
+	// One-off commands get no name, so several may run at once
+	cmd = c.Command(context.Background(), "", "--version")
+	if strings.Contains(strings.Join(cmd.Args, " "), "--name") {
+		t.Errorf("Command() without a name = %v, want no --name", cmd.Args)
+	}
+}
+
+func TestContainer_Pull(t *testing.T) {
+	var calls []string
+	present := false
+	c := NewContainer(RuntimeDocker, "envoyproxy/envoy:v1.31.2", "vpsie-envoy", "", nil)
+	c.run = func(_ context.Context, name string, args ...string) ([]byte, error) {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		if args[0] == "image" && !present {
+			return nil, errors.New("no such image")
+		}
+		return nil, nil
+	}
+
+	if err := c.Pull(context.Background()); err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	want := []string{"docker image inspect envoyproxy/envoy:v1.31.2", "docker pull envoyproxy/envoy:v1.31.2"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("Pull() ran %v, want %v", calls, want)
+	}
+
+	// A present image is not pulled again
+	calls, present = nil, true
+	if err := c.Pull(context.Background()); err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	if len(calls) != 1 {
+		t.Errorf("Pull() with the image present ran %v, want only the inspection", calls)
+	}
+}
+
+func TestPinned(t *testing.T) {
+	tests := map[string]bool{
+		"envoyproxy/envoy:v1.31.2":                   true,
+		"envoyproxy/envoy@sha256:0123456789abcdef":   true,
+		"registry.example.com:5000/envoy:v1.31.2":    true,
+		"envoyproxy/envoy":                           false,
+		"envoyproxy/envoy:latest":                    false,
+		"registry.example.com:5000/envoyproxy/envoy": false,
+		"registry.example.com:5000/envoy:latest":     false,
+	}
+	for image, want := range tests {
+		if got := Pinned(image); got != want {
+			t.Errorf("Pinned(%q) = %v, want %v", image, got, want)
+		}
+	}
+}
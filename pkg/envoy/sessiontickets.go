@@ -0,0 +1,9 @@
+package envoy
+
+// SetSessionTicketKeys sets the session ticket key files of HTTPS listeners,
+// newest first: the first key encrypts new tickets, all keys decrypt. Nodes
+// sharing the keys resume each other's TLS sessions. Without keys each Envoy
+// process generates its own, which a hot restart discards.
+func (g *Generator) SetSessionTicketKeys(paths []string) {
+	g.ticketKeys = paths
+}
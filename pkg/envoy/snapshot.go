@@ -0,0 +1,238 @@
+package envoy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+// xDS resource type URLs
+const (
+	ListenerTypeURL = "type.googleapis.com/envoy.config.listener.v3.Listener"
+	ClusterTypeURL  = "type.googleapis.com/envoy.config.cluster.v3.Cluster"
+	EndpointTypeURL = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+)
+
+// dnsClusterFields are the cluster settings of DNS discovery, which EDS
+// clusters must not carry
+var dnsClusterFields = []string{"dns_lookup_family", "dns_refresh_rate", "dns_failure_refresh_rate", "respect_dns_ttl", "dns_resolvers", "typed_dns_resolver_config"}
+
+// Snapshot is a versioned set of xDS resources, in the JSON form of the
+// Envoy v3 API, for consumption by an external xDS control plane (for example
+// a go-control-plane server loading it into its snapshot cache). Resources are
+// keyed by type URL and every resource carries its "@type".
+type Snapshot struct {
+	Version   string                              `json:"version"`
+	Resources map[string][]map[string]interface{} `json:"resources"`
+}
+
+// GenerateSnapshot translates a load balancer into an xDS snapshot using the
+// same model→Envoy translation as the file-based output
+func (g *Generator) GenerateSnapshot(lb *models.LoadBalancer, version string) (*Snapshot, error) {
+	if version == "" {
+		return nil, fmt.Errorf("snapshot version must not be empty")
+	}
+
+	config, err := g.GenerateFullConfig(lb)
+	if err != nil {
+		return nil, err
+	}
+
+	listeners, err := toResources(config.Listeners, ListenerTypeURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert listeners: %w", err)
+	}
+	clusters, err := toResources(config.Clusters, ClusterTypeURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert clusters: %w", err)
+	}
+
+	snapshot := &Snapshot{
+		Version: version,
+		Resources: map[string][]map[string]interface{}{
+			ListenerTypeURL: listeners,
+			ClusterTypeURL:  clusters,
+		},
+	}
+	if g.xdsEndpoints {
+		snapshot.Resources[EndpointTypeURL] = splitEndpoints(clusters)
+	}
+	return snapshot, nil
+}
+
+// SetXDSEndpoints moves the endpoints of clusters whose backends are all IP
+// addresses out of the clusters into ClusterLoadAssignment resources,
+// discovered over ADS. A backend change then updates only the endpoints of
+// its cluster, which Envoy applies without warming the cluster again.
+func (g *Generator) SetXDSEndpoints(enabled bool) {
+	g.xdsEndpoints = enabled
+}
+
+// splitEndpoints turns the clusters with IP endpoints into EDS clusters and
+// returns their endpoints as ClusterLoadAssignment resources. Clusters with
+// hostnames keep resolving them with DNS.
+func splitEndpoints(clusters []map[string]interface{}) []map[string]interface{} {
+	var endpoints []map[string]interface{}
+	for _, cluster := range clusters {
+		if cluster["type"] != "STRICT_DNS" && cluster["type"] != "STATIC" {
+			continue
+		}
+		assignment, ok := cluster["load_assignment"].(map[string]interface{})
+		if !ok || !ipEndpoints(assignment) {
+			continue
+		}
+		delete(cluster, "load_assignment")
+		for _, field := range dnsClusterFields {
+			delete(cluster, field)
+		}
+		cluster["type"] = "EDS"
+		cluster["eds_config"] = map[string]interface{}{"ads": map[string]interface{}{}, "resource_api_version": "V3"}
+		assignment["@type"] = EndpointTypeURL
+		assignment["cluster_name"] = cluster["name"]
+		endpoints = append(endpoints, assignment)
+	}
+	return endpoints
+}
+
+// ipEndpoints reports whether every endpoint of a load assignment is an IP
+// address, as EDS does not resolve hostnames
+func ipEndpoints(assignment map[string]interface{}) bool {
+	localities, _ := assignment["endpoints"].([]interface{})
+	for _, locality := range localities {
+		lbEndpoints, _ := locality.(map[string]interface{})["lb_endpoints"].([]interface{})
+		for _, lbEndpoint := range lbEndpoints {
+			address := lookup(lbEndpoint, "endpoint", "address", "socket_address", "address")
+			if s, ok := address.(string); !ok || net.ParseIP(s) == nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lookup returns the value at path in decoded YAML maps, nil if absent
+func lookup(v interface{}, path ...string) interface{} {
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+// SnapshotDelta is what changed from one snapshot to the next, as a delta
+// xDS server sends it: the resources added or changed, and the names of the
+// resources removed, by type URL. Resources that did not change are left out,
+// so a backend added to a large pool sends the endpoints of one cluster only.
+type SnapshotDelta struct {
+	Version         string                              `json:"version"`
+	PreviousVersion string                              `json:"previous_version,omitempty"`
+	Resources       map[string][]map[string]interface{} `json:"resources"`
+	Removed         map[string][]string                 `json:"removed_resources"`
+}
+
+// Delta returns the changes from previous, nil for the first snapshot, to s
+func (s *Snapshot) Delta(previous *Snapshot) *SnapshotDelta {
+	delta := &SnapshotDelta{
+		Version:   s.Version,
+		Resources: make(map[string][]map[string]interface{}),
+		Removed:   make(map[string][]string),
+	}
+	old := make(map[string]map[string]map[string]interface{})
+	if previous != nil {
+		delta.PreviousVersion = previous.Version
+		for typeURL, resources := range previous.Resources {
+			old[typeURL] = make(map[string]map[string]interface{})
+			for _, resource := range resources {
+				old[typeURL][resourceName(resource)] = resource
+			}
+		}
+	}
+	for typeURL, resources := range s.Resources {
+		current := make(map[string]bool)
+		for _, resource := range resources {
+			name := resourceName(resource)
+			current[name] = true
+			if !sameResource(old[typeURL][name], resource) {
+				delta.Resources[typeURL] = append(delta.Resources[typeURL], resource)
+			}
+		}
+		for name := range old[typeURL] {
+			if !current[name] {
+				delta.Removed[typeURL] = append(delta.Removed[typeURL], name)
+			}
+		}
+	}
+	for typeURL, resources := range old {
+		if _, ok := s.Resources[typeURL]; ok {
+			continue
+		}
+		for name := range resources {
+			delta.Removed[typeURL] = append(delta.Removed[typeURL], name)
+		}
+	}
+	for _, names := range delta.Removed {
+		sort.Strings(names)
+	}
+	return delta
+}
+
+// Changes returns how many resources the delta adds or changes, and removes
+func (d *SnapshotDelta) Changes() (changed, removed int) {
+	for _, resources := range d.Resources {
+		changed += len(resources)
+	}
+	for _, names := range d.Removed {
+		removed += len(names)
+	}
+	return changed, removed
+}
+
+// Marshal encodes the delta as indented JSON
+func (d *SnapshotDelta) Marshal() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// sameResource compares resources by their JSON form, as a snapshot read
+// back from disk holds numbers as float64 where a generated one holds ints
+func sameResource(a, b map[string]interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aJSON, bJSON)
+}
+
+// resourceName returns the name xDS identifies a resource by
+func resourceName(resource map[string]interface{}) string {
+	if name, ok := resource["name"].(string); ok {
+		return name
+	}
+	name, _ := resource["cluster_name"].(string)
+	return name
+}
+
+// Marshal encodes the snapshot as indented JSON
+func (s *Snapshot) Marshal() ([]byte, error) {
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// toResources decodes a YAML list of resources and tags each with its type URL
+func toResources(data []byte, typeURL string) ([]map[string]interface{}, error) {
+	var resources []map[string]interface{}
+	if err := yaml.Unmarshal(data, &resources); err != nil {
+		return nil, err
+	}
+	for _, resource := range resources {
+		resource["@type"] = typeURL
+	}
+	return resources, nil
+}
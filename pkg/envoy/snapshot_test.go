@@ -0,0 +1,165 @@
+package envoy
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestGenerator_GenerateSnapshot(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	lb := &models.LoadBalancer{
+		ID:        "lb-1",
+		Name:      "test-lb",
+		Protocol:  models.ProtocolHTTP,
+		Algorithm: models.AlgoRoundRobin,
+		Port:      80,
+		Backends: []models.Backend{
+			{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true},
+		},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	snapshot, err := gen.GenerateSnapshot(lb, "v1")
+	if err != nil {
+		t.Fatalf("GenerateSnapshot() error = %v", err)
+	}
+
+	if snapshot.Version != "v1" {
+		t.Errorf("Version = %v, want v1", snapshot.Version)
+	}
+
+	listeners := snapshot.Resources[ListenerTypeURL]
+	if len(listeners) != 1 {
+		t.Fatalf("listeners = %d, want 1", len(listeners))
+	}
+	if listeners[0]["@type"] != ListenerTypeURL {
+		t.Errorf("listener @type = %v, want %v", listeners[0]["@type"], ListenerTypeURL)
+	}
+	if listeners[0]["name"] != "listener_http_80" {
+		t.Errorf("listener name = %v, want listener_http_80", listeners[0]["name"])
+	}
+
+	clusters := snapshot.Resources[ClusterTypeURL]
+	if len(clusters) != 1 || clusters[0]["name"] != "cluster_lb-1" {
+		t.Errorf("unexpected clusters: %v", clusters)
+	}
+
+	data, err := snapshot.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var decoded Snapshot
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Errorf("Marshal() produced invalid JSON: %v", err)
+	}
+}
+
+func TestGenerator_GenerateSnapshot_Errors(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+
+	if _, err := gen.GenerateSnapshot(&models.LoadBalancer{}, ""); err == nil {
+		t.Error("Expected error for empty version")
+	}
+	if _, err := gen.GenerateSnapshot(&models.LoadBalancer{}, "v1"); err == nil {
+		t.Error("Expected error for invalid load balancer")
+	}
+}
+
+func TestGenerator_GenerateSnapshot_XDSEndpoints(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+	gen.SetXDSEndpoints(true)
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+		Backends: []models.Backend{
+			{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true},
+			{ID: "be-2", Address: "10.0.0.2", Port: 8080, Enabled: true},
+		},
+	}
+
+	snapshot, err := gen.GenerateSnapshot(lb, "v1")
+	if err != nil {
+		t.Fatalf("GenerateSnapshot() error = %v", err)
+	}
+	cluster := snapshot.Resources[ClusterTypeURL][0]
+	if cluster["type"] != "EDS" || cluster["load_assignment"] != nil || cluster["eds_config"] == nil {
+		t.Errorf("cluster = %v, want an EDS cluster", cluster)
+	}
+	if _, ok := cluster["dns_lookup_family"]; ok {
+		t.Errorf("EDS cluster keeps DNS settings: %v", cluster)
+	}
+	endpoints := snapshot.Resources[EndpointTypeURL]
+	if len(endpoints) != 1 || endpoints[0]["cluster_name"] != "cluster_lb-1" || endpoints[0]["@type"] != EndpointTypeURL {
+		t.Fatalf("endpoints = %v, want the load assignment of cluster_lb-1", endpoints)
+	}
+
+	// Hostnames are left to DNS discovery
+	lb.Backends[1].Address = "app.internal"
+	snapshot, err = gen.GenerateSnapshot(lb, "v2")
+	if err != nil {
+		t.Fatalf("GenerateSnapshot() error = %v", err)
+	}
+	if cluster = snapshot.Resources[ClusterTypeURL][0]; cluster["type"] != "STRICT_DNS" || len(snapshot.Resources[EndpointTypeURL]) != 0 {
+		t.Errorf("cluster = %v, want DNS discovery of the hostname", cluster)
+	}
+}
+
+func TestSnapshot_Delta(t *testing.T) {
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+	gen.SetXDSEndpoints(true)
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+		Backends: []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}},
+	}
+	first, err := gen.GenerateSnapshot(lb, "v1")
+	if err != nil {
+		t.Fatalf("GenerateSnapshot() error = %v", err)
+	}
+
+	// The first snapshot is all new
+	if changed, removed := first.Delta(nil).Changes(); changed != 3 || removed != 0 {
+		t.Errorf("first delta changes %d and removes %d resources, want 3 and 0", changed, removed)
+	}
+
+	// The previous snapshot is read back from disk, with JSON numbers
+	cm, err := NewConfigManager(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewConfigManager() error = %v", err)
+	}
+	if err = cm.WriteSnapshot(first); err != nil {
+		t.Fatalf("WriteSnapshot() error = %v", err)
+	}
+	previous, err := cm.ReadSnapshot()
+	if err != nil {
+		t.Fatalf("ReadSnapshot() error = %v", err)
+	}
+
+	// Adding a backend only sends the endpoints of its cluster
+	lb.Backends = append(lb.Backends, models.Backend{ID: "be-2", Address: "10.0.0.2", Port: 8080, Enabled: true})
+	second, err := gen.GenerateSnapshot(lb, "v2")
+	if err != nil {
+		t.Fatalf("GenerateSnapshot() error = %v", err)
+	}
+	delta := second.Delta(previous)
+	if delta.PreviousVersion != "v1" || len(delta.Resources) != 1 || len(delta.Resources[EndpointTypeURL]) != 1 {
+		t.Errorf("delta = %+v, want the endpoints of cluster_lb-1 only", delta)
+	}
+	if err = cm.WriteSnapshotDelta(delta); err != nil {
+		t.Fatalf("WriteSnapshotDelta() error = %v", err)
+	}
+
+	// Removed resources are listed by name
+	lb.Port = 8080
+	third, err := gen.GenerateSnapshot(lb, "v3")
+	if err != nil {
+		t.Fatalf("GenerateSnapshot() error = %v", err)
+	}
+	delta = third.Delta(second)
+	if removed := delta.Removed[ListenerTypeURL]; len(removed) != 1 || removed[0] != "listener_http_80" {
+		t.Errorf("removed listeners = %v, want listener_http_80", removed)
+	}
+}
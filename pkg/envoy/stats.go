@@ -0,0 +1,140 @@
+package envoy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ClusterStats are the upstream request statistics of one Envoy cluster.
+// Counters are cumulative since Envoy started; hot restarts carry them over.
+type ClusterStats struct {
+	RequestsTotal     uint64
+	RequestsCompleted uint64
+	Requests5xx       uint64
+	ActiveConnections uint64  // gauge
+	HealthyMembers    uint64  // gauge
+	TotalMembers      uint64  // gauge
+	P99LatencyMs      float64 // cumulative p99 of upstream_rq_time, 0 when no request completed
+}
+
+// statsResponse is the subset of GET /stats?format=json used here
+type statsResponse struct {
+	Stats []struct {
+		Name       string          `json:"name"`
+		Value      json.RawMessage `json:"value"`
+		Histograms *struct {
+			SupportedQuantiles []float64           `json:"supported_quantiles"`
+			ComputedQuantiles  []computedQuantiles `json:"computed_quantiles"`
+		} `json:"histograms"`
+	} `json:"stats"`
+}
+
+// computedQuantiles are the quantile values of one histogram, in the order of
+// the supported quantiles
+type computedQuantiles struct {
+	Name   string `json:"name"`
+	Values []struct {
+		Cumulative *float64 `json:"cumulative"`
+	} `json:"values"`
+}
+
+// ClusterStats returns the upstream request statistics of cluster
+func (c *AdminClient) ClusterStats(ctx context.Context, cluster string) (*ClusterStats, error) {
+	prefix := "cluster." + cluster + "."
+	query := url.Values{
+		"format": {"json"},
+		"filter": {"^" + regexp.QuoteMeta(prefix) + "(upstream_rq_total|upstream_rq_completed|upstream_rq_5xx|upstream_rq_time|upstream_cx_active|membership_healthy|membership_total)$"},
+	}
+
+	var body statsResponse
+	if err := c.getJSON(ctx, "/stats?"+query.Encode(), &body); err != nil {
+		return nil, fmt.Errorf("failed to query Envoy stats: %w", err)
+	}
+
+	stats := &ClusterStats{}
+	for _, stat := range body.Stats {
+		if stat.Histograms != nil {
+			stats.P99LatencyMs = p99(stat.Histograms.SupportedQuantiles, stat.Histograms.ComputedQuantiles, prefix+"upstream_rq_time")
+			continue
+		}
+
+		var value uint64
+		if len(stat.Value) > 0 {
+			if err := json.Unmarshal(stat.Value, &value); err != nil {
+				continue
+			}
+		}
+		switch strings.TrimPrefix(stat.Name, prefix) {
+		case "upstream_rq_total":
+			stats.RequestsTotal = value
+		case "upstream_rq_completed":
+			stats.RequestsCompleted = value
+		case "upstream_rq_5xx":
+			stats.Requests5xx = value
+		case "upstream_cx_active":
+			stats.ActiveConnections = value
+		case "membership_healthy":
+			stats.HealthyMembers = value
+		case "membership_total":
+			stats.TotalMembers = value
+		}
+	}
+	return stats, nil
+}
+
+// CDSUpdates counts the cluster configuration updates Envoy accepted and
+// rejected since it started
+type CDSUpdates struct {
+	Success  uint64
+	Rejected uint64
+}
+
+// CDSUpdates returns the cluster discovery update counters. With clusters
+// read from a file, an update is counted each time Envoy reloads the file.
+func (c *AdminClient) CDSUpdates(ctx context.Context) (CDSUpdates, error) {
+	query := url.Values{
+		"format": {"json"},
+		"filter": {`^cluster_manager\.cds\.(update_success|update_rejected)$`},
+	}
+	var body statsResponse
+	if err := c.getJSON(ctx, "/stats?"+query.Encode(), &body); err != nil {
+		return CDSUpdates{}, fmt.Errorf("failed to query Envoy stats: %w", err)
+	}
+	var updates CDSUpdates
+	for _, stat := range body.Stats {
+		var value uint64
+		if err := json.Unmarshal(stat.Value, &value); err != nil {
+			continue
+		}
+		switch stat.Name {
+		case "cluster_manager.cds.update_success":
+			updates.Success = value
+		case "cluster_manager.cds.update_rejected":
+			updates.Rejected = value
+		}
+	}
+	return updates, nil
+}
+
+// p99 returns the cumulative 99th percentile of the named histogram
+func p99(quantiles []float64, histograms []computedQuantiles, name string) float64 {
+	index := -1
+	for i, q := range quantiles {
+		if q == 99 {
+			index = i
+		}
+	}
+	if index < 0 {
+		return 0
+	}
+	for _, h := range histograms {
+		if h.Name == name && index < len(h.Values) && h.Values[index].Cumulative != nil {
+			return *h.Values[index].Cumulative
+		}
+	}
+	return 0
+}
@@ -0,0 +1,40 @@
+package envoy
+
+import "sort"
+
+// RouteStatsTag is the tag per-route statistics carry their route's
+// stat_prefix in, e.g. vhost.backend.route.checkout.upstream_rq_2xx becomes
+// vhost.route.upstream_rq_2xx{route="checkout"}
+const RouteStatsTag = "route"
+
+// routeStatsTagRegex extracts RouteStatsTag; the outer group is removed from
+// the stat name and the inner group is the tag value
+const routeStatsTagRegex = `^vhost\.[\w-]+\.route\.((\w+)\.)`
+
+// SetStatsTags adds fixed tags to every statistic Envoy emits, so metrics
+// scraped from several load balancer nodes can be told apart
+func (g *Generator) SetStatsTags(tags map[string]string) {
+	g.statsTags = tags
+}
+
+// statsTagData is a tag extracted from stat names by Regex, or added to
+// every stat with FixedValue
+type statsTagData struct {
+	Name       string
+	Regex      string
+	FixedValue string
+}
+
+// newStatsTagsData returns the route tag followed by the fixed tags in name order
+func (g *Generator) newStatsTagsData() []statsTagData {
+	tags := []statsTagData{{Name: RouteStatsTag, Regex: routeStatsTagRegex}}
+	names := make([]string, 0, len(g.statsTags))
+	for name := range g.statsTags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tags = append(tags, statsTagData{Name: name, FixedValue: g.statsTags[name]})
+	}
+	return tags
+}
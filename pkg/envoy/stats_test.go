@@ -0,0 +1,141 @@
+package envoy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestAdminClient_ClusterStats(t *testing.T) {
+	var gotFilter string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stats" || r.URL.Query().Get("format") != "json" {
+			http.NotFound(w, r)
+			return
+		}
+		gotFilter = r.URL.Query().Get("filter")
+		_, _ = w.Write([]byte(`{"stats": [
+			{"name": "cluster.cluster_lb-1_canary.upstream_rq_5xx", "value": 3},
+			{"name": "cluster.cluster_lb-1_canary.upstream_rq_completed", "value": 120},
+			{"name": "cluster.cluster_lb-1_canary.upstream_rq_total", "value": 125},
+			{"name": "cluster.cluster_lb-1_canary.upstream_cx_active", "value": 7},
+			{"name": "cluster.cluster_lb-1_canary.membership_healthy", "value": 2},
+			{"name": "cluster.cluster_lb-1_canary.membership_total", "value": 3},
+			{"histograms": {
+				"supported_quantiles": [0, 25, 50, 75, 90, 95, 99, 99.5, 99.9, 100],
+				"computed_quantiles": [{"name": "cluster.cluster_lb-1_canary.upstream_rq_time", "values": [
+					{"interval": null, "cumulative": 1}, {"interval": null, "cumulative": 2},
+					{"interval": null, "cumulative": 3}, {"interval": null, "cumulative": 4},
+					{"interval": null, "cumulative": 5}, {"interval": null, "cumulative": 6},
+					{"interval": null, "cumulative": 250}, {"interval": null, "cumulative": 300},
+					{"interval": null, "cumulative": 310}, {"interval": null, "cumulative": 320}
+				]}]
+			}}
+		]}`))
+	}))
+	defer server.Close()
+
+	client := NewAdminClient(strings.TrimPrefix(server.URL, "http://"))
+	stats, err := client.ClusterStats(context.Background(), "cluster_lb-1_canary")
+	if err != nil {
+		t.Fatalf("ClusterStats() error = %v", err)
+	}
+
+	if stats.RequestsCompleted != 120 || stats.Requests5xx != 3 || stats.P99LatencyMs != 250 {
+		t.Errorf("ClusterStats() = %+v, want 120 completed, 3 5xx, p99 250ms", stats)
+	}
+	if stats.RequestsTotal != 125 || stats.ActiveConnections != 7 || stats.HealthyMembers != 2 || stats.TotalMembers != 3 {
+		t.Errorf("ClusterStats() = %+v, want 125 total, 7 active connections, 2 of 3 members healthy", stats)
+	}
+	if !strings.Contains(gotFilter, `cluster\.cluster_lb-1_canary\.`) {
+		t.Errorf("filter = %q, want the escaped cluster prefix", gotFilter)
+	}
+}
+
+func TestAdminClient_ClusterStats_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewAdminClient(strings.TrimPrefix(server.URL, "http://"))
+	if _, err := client.ClusterStats(context.Background(), "cluster_lb-1"); err == nil {
+		t.Error("ClusterStats() error = nil, want error for non-200 response")
+	}
+}
+
+func TestAdminClient_CDSUpdates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("filter") == "" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"stats": [
+			{"name": "cluster_manager.cds.update_success", "value": 4},
+			{"name": "cluster_manager.cds.update_rejected", "value": 1}
+		]}`))
+	}))
+	defer server.Close()
+
+	client := NewAdminClient(strings.TrimPrefix(server.URL, "http://"))
+	updates, err := client.CDSUpdates(context.Background())
+	if err != nil {
+		t.Fatalf("CDSUpdates() error = %v", err)
+	}
+	if updates != (CDSUpdates{Success: 4, Rejected: 1}) {
+		t.Errorf("CDSUpdates() = %+v", updates)
+	}
+}
+
+func TestNewStatsMapping(t *testing.T) {
+	backends := []models.Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}}
+	tests := []struct {
+		name string
+		lb   *models.LoadBalancer
+		want StatsMapping
+	}{
+		{
+			name: "generated prefix",
+			lb:   &models.LoadBalancer{ID: "lb-7f3a", Name: "db", Protocol: models.ProtocolTCP, Port: 5432, Backends: backends},
+			want: StatsMapping{
+				LoadBalancerID:  "lb-7f3a",
+				Name:            "db",
+				StatPrefix:      "tcp_5432_lb_7f3a",
+				PrometheusLabel: map[string]string{"envoy_tcp_prefix": "tcp_5432_lb_7f3a"},
+				Clusters:        map[string]string{"cluster_lb-7f3a": ""},
+			},
+		},
+		{
+			name: "own prefix, pools and routes",
+			lb: &models.LoadBalancer{
+				ID: "lb-1", Name: "shop", Protocol: models.ProtocolHTTP, Port: 80, StatsPrefix: "shop",
+				Pools: []models.BackendPool{{Name: "v1", Backends: backends}, {Name: "v2", Backends: backends}},
+				Routes: []models.Route{
+					{Name: "checkout", Path: "/checkout", Pool: "v2", StatPrefix: "checkout"},
+					{Name: "catalog", Path: "/", Pool: "v1"},
+				},
+			},
+			want: StatsMapping{
+				LoadBalancerID:  "lb-1",
+				Name:            "shop",
+				StatPrefix:      "shop",
+				PrometheusLabel: map[string]string{"envoy_http_conn_manager_prefix": "shop"},
+				Clusters:        map[string]string{"cluster_lb-1_v1": "v1", "cluster_lb-1_v2": "v2"},
+				Routes:          map[string]string{"checkout": "checkout"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewStatsMapping(tt.lb); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewStatsMapping() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package envoy
+
+import (
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// Prometheus labels Envoy's default tags extract the listener stat prefix into
+const (
+	httpStatsLabel = "envoy_http_conn_manager_prefix"
+	tcpStatsLabel  = "envoy_tcp_prefix"
+)
+
+// StatsMapping names the statistics Envoy emits for one load balancer, so
+// metrics scraped from a node shared by several load balancers can be
+// attributed to each of them
+type StatsMapping struct {
+	LoadBalancerID  string            `json:"loadbalancer_id"`
+	Name            string            `json:"name"`
+	StatPrefix      string            `json:"stat_prefix"`      // http.<prefix>.* or tcp.<prefix>.*
+	PrometheusLabel map[string]string `json:"prometheus_label"` // label and value selecting the listener statistics
+	Clusters        map[string]string `json:"clusters"`         // cluster (envoy_cluster_name) to its pool, empty for the load balancer's own backends
+	Routes          map[string]string `json:"routes,omitempty"` // route label value to the route name
+}
+
+// NewStatsMapping returns the statistics names of lb
+func NewStatsMapping(lb *models.LoadBalancer) StatsMapping {
+	prefix := listenerStatPrefix(lb)
+	label := httpStatsLabel
+	if lb.Protocol == models.ProtocolTCP {
+		label = tcpStatsLabel
+	}
+	m := StatsMapping{
+		LoadBalancerID:  lb.ID,
+		Name:            lb.Name,
+		StatPrefix:      prefix,
+		PrometheusLabel: map[string]string{label: prefix},
+		Clusters:        make(map[string]string, len(lb.Pools)+1),
+	}
+	if lb.HasDefaultPool() {
+		m.Clusters[ClusterName(lb, "")] = ""
+	}
+	for i := range lb.Pools {
+		m.Clusters[ClusterName(lb, lb.Pools[i].Name)] = lb.Pools[i].Name
+	}
+	for _, route := range lb.Routes {
+		if route.StatPrefix == "" {
+			continue
+		}
+		if m.Routes == nil {
+			m.Routes = make(map[string]string)
+		}
+		m.Routes[route.StatPrefix] = route.Name
+	}
+	return m
+}
@@ -0,0 +1,46 @@
+package envoy
+
+import "github.com/vpsie/vpsie-loadbalancer/pkg/models"
+
+// defaultRedisOpTimeout bounds a Redis command when timeouts.request is unset
+const defaultRedisOpTimeout = 5
+
+// mysqlGreeting is the start of the handshake a MySQL server sends on
+// connect, in hex: sequence id 0 followed by protocol version 10. Error
+// packets, e.g. of a server refusing connections, carry 0xff instead.
+const mysqlGreeting = "000a"
+
+// redisData configures the Redis proxy that replaces the TCP proxy
+type redisData struct {
+	OpTimeout int // seconds
+}
+
+// applyTCPProtocolHint adds the protocol filter of a TCP load balancer's
+// protocol hint to the listener
+func applyTCPProtocolHint(lb *models.LoadBalancer, data *listenerData) {
+	if lb.Protocol != models.ProtocolTCP {
+		return
+	}
+	data.ProtocolHint = string(lb.TCPProtocolHint)
+	if lb.TCPProtocolHint == models.TCPProtocolRedis {
+		data.Redis = &redisData{OpTimeout: defaultRedisOpTimeout}
+		if lb.Timeouts != nil && lb.Timeouts.Request > 0 {
+			data.Redis.OpTimeout = lb.Timeouts.Request
+		}
+	}
+}
+
+// applyProtocolHealthCheck checks backends in the protocol of a TCP load
+// balancer's protocol hint. PostgreSQL servers answer a connect with
+// silence, so their checks stay connect-only.
+func applyProtocolHealthCheck(lb *models.LoadBalancer, hc *healthCheckData) {
+	if hc.Type != string(models.HealthCheckTCP) {
+		return
+	}
+	switch lb.TCPProtocolHint {
+	case models.TCPProtocolRedis:
+		hc.Redis = true
+	case models.TCPProtocolMySQL:
+		hc.Receive = []string{mysqlGreeting}
+	}
+}
@@ -0,0 +1,135 @@
+package envoy
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"sync"
+	"text/template"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// The text templates are the legacy renderer, kept as a fallback for the
+// structured builders; see Generator.SetLegacyTemplates.
+
+//go:embed templates/listener_http.yaml.tmpl
+var listenerHTTPTemplate string
+
+//go:embed templates/listener_https.yaml.tmpl
+var listenerHTTPSTemplate string
+
+//go:embed templates/listener_tcp.yaml.tmpl
+var listenerTCPTemplate string
+
+//go:embed templates/cluster.yaml.tmpl
+var clusterTemplate string
+
+//go:embed templates/bootstrap.yaml.tmpl
+var bootstrapTemplate string
+
+// parsedTemplate is a template parsed once, on first use, and shared by all
+// generators; executing a parsed template is safe for concurrent use
+type parsedTemplate struct {
+	name  string
+	parse func() (*template.Template, error)
+}
+
+func newParsedTemplate(name, text string) *parsedTemplate {
+	return &parsedTemplate{
+		name:  name,
+		parse: sync.OnceValues(func() (*template.Template, error) { return template.New(name).Parse(text) }),
+	}
+}
+
+var (
+	listenerHTTPTmpl  = newParsedTemplate("listener", listenerHTTPTemplate)
+	listenerHTTPSTmpl = newParsedTemplate("listener", listenerHTTPSTemplate)
+	listenerTCPTmpl   = newParsedTemplate("listener", listenerTCPTemplate)
+	clusterTmpl       = newParsedTemplate("cluster", clusterTemplate)
+	bootstrapTmpl     = newParsedTemplate("bootstrap", bootstrapTemplate)
+)
+
+// maxPooledBuffer is the largest buffer returned to bufferPool, so one huge
+// configuration does not stay in memory
+const maxPooledBuffer = 1 << 20
+
+// bufferPool holds the buffers configuration is rendered into
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns buf to the pool; its contents must not be used after
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// executeTemplate executes one template, appending the output to buf
+func executeTemplate(buf *bytes.Buffer, t *parsedTemplate, data interface{}) error {
+	tmpl, err := t.parse()
+	if err != nil {
+		return fmt.Errorf("failed to parse %s template: %w", t.name, err)
+	}
+	if err = tmpl.Execute(buf, data); err != nil {
+		return fmt.Errorf("failed to execute %s template: %w", t.name, err)
+	}
+	return nil
+}
+
+// renderTemplate executes one template
+func renderTemplate(t *parsedTemplate, data interface{}) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := executeTemplate(buf, t, data); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+// listenerTemplate returns the listener template for a protocol
+func listenerTemplate(protocol models.Protocol) (*parsedTemplate, error) {
+	switch protocol {
+	case models.ProtocolHTTP:
+		return listenerHTTPTmpl, nil
+	case models.ProtocolHTTPS:
+		return listenerHTTPSTmpl, nil
+	case models.ProtocolTCP:
+		return listenerTCPTmpl, nil
+	default:
+		return nil, fmt.Errorf("unsupported protocol: %s", protocol)
+	}
+}
+
+// renderListenerTemplates renders each listener and joins them into one list
+func renderListenerTemplates(protocol models.Protocol, listeners []*listenerData) ([]byte, error) {
+	t, err := listenerTemplate(protocol)
+	if err != nil {
+		return nil, err
+	}
+	return renderTemplateList(t, listeners)
+}
+
+// renderClusterTemplate renders each cluster and joins them into one list
+func renderClusterTemplate(clusters []*clusterData) ([]byte, error) {
+	return renderTemplateList(clusterTmpl, clusters)
+}
+
+// renderTemplateList executes a template for each item, separated by newlines
+func renderTemplateList[T any](t *parsedTemplate, items []T) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	for _, data := range items {
+		if err := executeTemplate(buf, t, data); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
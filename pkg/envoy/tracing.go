@@ -0,0 +1,70 @@
+package envoy
+
+import (
+	"fmt"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// defaultSamplingRate is the percent of requests traced when the load
+// balancer does not set a sampling rate
+const defaultSamplingRate = 100
+
+// tracingData is the tracing configuration of an HTTP listener
+type tracingData struct {
+	Provider     string
+	ClusterName  string // the collector cluster
+	SamplingRate float64
+	ServiceName  string // OpenTelemetry only
+	Path         string // Zipkin only
+}
+
+// tracingClusterName returns the name of the collector cluster of a load balancer
+func tracingClusterName(lb *models.LoadBalancer) string {
+	return fmt.Sprintf("tracing_%s", lb.ID)
+}
+
+// newTracingData prepares the tracing configuration, applying defaults
+func newTracingData(lb *models.LoadBalancer) *tracingData {
+	t := lb.Tracing
+	data := &tracingData{
+		Provider:     string(t.Provider),
+		ClusterName:  tracingClusterName(lb),
+		SamplingRate: t.SamplingRate,
+	}
+	if data.SamplingRate == 0 {
+		data.SamplingRate = defaultSamplingRate
+	}
+	if t.Provider == models.TracingZipkin {
+		data.Path = t.Path
+		if data.Path == "" {
+			data.Path = models.DefaultZipkinPath
+		}
+	} else {
+		data.ServiceName = t.ServiceName
+		if data.ServiceName == "" {
+			data.ServiceName = lb.ID
+		}
+	}
+	return data
+}
+
+// newTracingClusterData prepares the cluster of the trace collector. OTLP
+// is exported over gRPC and needs HTTP/2.
+func newTracingClusterData(lb *models.LoadBalancer) (*clusterData, error) {
+	host, port := lb.Tracing.CollectorAddress()
+	if err := validateAddress(host); err != nil {
+		return nil, fmt.Errorf("invalid tracing collector: %w", err)
+	}
+	data := &clusterData{
+		Name:              tracingClusterName(lb),
+		ConnectTimeout:    defaultConnectTimeout,
+		Type:              "STRICT_DNS",
+		LoadBalancingAlgo: string(models.AlgoRoundRobin),
+		Localities:        []localityData{{Endpoints: []endpointData{{Address: host, Port: port}}}},
+	}
+	if lb.Tracing.Provider == models.TracingOpenTelemetry {
+		data.ProtocolOptions = &protocolOptionsData{HTTP2: true}
+	}
+	return data, nil
+}
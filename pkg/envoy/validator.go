@@ -1,27 +1,40 @@
 package envoy
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
 )
 
 // Validator validates Envoy configuration files
 type Validator struct {
 	envoyBinary string
+	runtime     Runtime
 }
 
 // NewValidator creates a new Envoy config validator
 func NewValidator(envoyBinary string) *Validator {
 	return &Validator{
 		envoyBinary: envoyBinary,
+		runtime:     Binary(envoyBinary),
 	}
 }
 
-// ValidateConfig validates an Envoy configuration file
+// SetRuntime makes the validator run Envoy with rt instead of the binary
+func (v *Validator) SetRuntime(rt Runtime) {
+	v.runtime = rt
+}
+
+// ValidateConfig validates an Envoy configuration file. A remote Envoy
+// validates a copy of the file at the same path on its host.
 func (v *Validator) ValidateConfig(configPath string) error {
+	if remote, ok := v.runtime.(*Remote); ok {
+		if err := remote.Put(context.Background(), configPath); err != nil {
+			return fmt.Errorf("config validation failed: %w", err)
+		}
+	}
+
 	// Run envoy with --mode validate
-	// #nosec G204 -- envoyBinary is set at initialization, not from user input
-	cmd := exec.Command(v.envoyBinary, "--mode", "validate", "-c", configPath)
+	cmd := v.runtime.Command(context.Background(), "", "--mode", "validate", "-c", configPath)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
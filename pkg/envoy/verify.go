@@ -0,0 +1,164 @@
+package envoy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ActiveConfig is the part of an Envoy configuration checked after an apply:
+// the listener names and the endpoints of each cluster
+type ActiveConfig struct {
+	Listeners []string            // sorted
+	Endpoints map[string][]string // cluster name to sorted host:port endpoints
+}
+
+// listenerResource is the subset of a listener read for verification, in
+// both the generated YAML and the config dump JSON
+type listenerResource struct {
+	Name string `json:"name" yaml:"name"`
+}
+
+// clusterResource is the subset of a cluster read for verification
+type clusterResource struct {
+	Name           string `json:"name" yaml:"name"`
+	LoadAssignment struct {
+		Endpoints []struct {
+			LBEndpoints []struct {
+				Endpoint struct {
+					Address struct {
+						SocketAddress struct {
+							Address   string `json:"address" yaml:"address"`
+							PortValue int    `json:"port_value" yaml:"port_value"`
+						} `json:"socket_address" yaml:"socket_address"`
+					} `json:"address" yaml:"address"`
+				} `json:"endpoint" yaml:"endpoint"`
+			} `json:"lb_endpoints" yaml:"lb_endpoints"`
+		} `json:"endpoints" yaml:"endpoints"`
+	} `json:"load_assignment" yaml:"load_assignment"`
+}
+
+// configDumpResponse is GET /config_dump?resource=... for the dynamic
+// listeners or clusters
+type configDumpResponse struct {
+	Configs []struct {
+		Name        string `json:"name"`
+		ActiveState *struct {
+			Listener listenerResource `json:"listener"`
+		} `json:"active_state"`
+		Cluster *clusterResource `json:"cluster"`
+	} `json:"configs"`
+}
+
+// ActiveConfig returns the configuration the generated files describe
+func (c *EnvoyConfig) ActiveConfig() (*ActiveConfig, error) {
+	var listeners []listenerResource
+	if err := yaml.Unmarshal(c.Listeners, &listeners); err != nil {
+		return nil, fmt.Errorf("failed to parse listeners: %w", err)
+	}
+	var clusters []clusterResource
+	if err := yaml.Unmarshal(c.Clusters, &clusters); err != nil {
+		return nil, fmt.Errorf("failed to parse clusters: %w", err)
+	}
+
+	active := &ActiveConfig{Endpoints: make(map[string][]string)}
+	for _, listener := range listeners {
+		active.Listeners = append(active.Listeners, listener.Name)
+	}
+	for i := range clusters {
+		active.addCluster(&clusters[i])
+	}
+	sort.Strings(active.Listeners)
+	return active, nil
+}
+
+// ActiveConfig returns the listeners and clusters Envoy is running, from its
+// config dump. Listeners still warming up are not counted.
+func (c *AdminClient) ActiveConfig(ctx context.Context) (*ActiveConfig, error) {
+	var listeners, clusters configDumpResponse
+	if err := c.getJSONLimit(ctx, "/config_dump?resource=dynamic_active_listeners", &listeners, maxConfigDumpSize); err != nil {
+		return nil, fmt.Errorf("failed to query Envoy listeners: %w", err)
+	}
+	if err := c.getJSONLimit(ctx, "/config_dump?resource=dynamic_active_clusters", &clusters, maxConfigDumpSize); err != nil {
+		return nil, fmt.Errorf("failed to query Envoy clusters: %w", err)
+	}
+
+	active := &ActiveConfig{Endpoints: make(map[string][]string)}
+	for _, config := range listeners.Configs {
+		if config.ActiveState != nil {
+			active.Listeners = append(active.Listeners, config.Name)
+		}
+	}
+	for _, config := range clusters.Configs {
+		if config.Cluster != nil {
+			active.addCluster(config.Cluster)
+		}
+	}
+	sort.Strings(active.Listeners)
+	return active, nil
+}
+
+// maxConfigDumpSize bounds a config dump response
+const maxConfigDumpSize = 32 << 20
+
+// addCluster records the endpoints of cluster
+func (a *ActiveConfig) addCluster(cluster *clusterResource) {
+	endpoints := []string{}
+	for _, locality := range cluster.LoadAssignment.Endpoints {
+		for _, lbEndpoint := range locality.LBEndpoints {
+			address := lbEndpoint.Endpoint.Address.SocketAddress
+			endpoints = append(endpoints, net.JoinHostPort(address.Address, strconv.Itoa(address.PortValue)))
+		}
+	}
+	sort.Strings(endpoints)
+	a.Endpoints[cluster.Name] = endpoints
+}
+
+// Divergence lists how running differs from the intended configuration a,
+// empty when they match
+func (a *ActiveConfig) Divergence(running *ActiveConfig) []string {
+	var diffs []string
+	for _, name := range a.Listeners {
+		if !slices.Contains(running.Listeners, name) {
+			diffs = append(diffs, fmt.Sprintf("listener %s is not active", name))
+		}
+	}
+	for _, name := range running.Listeners {
+		if !slices.Contains(a.Listeners, name) {
+			diffs = append(diffs, fmt.Sprintf("listener %s is active but not configured", name))
+		}
+	}
+
+	clusters := make([]string, 0, len(a.Endpoints))
+	for name := range a.Endpoints {
+		clusters = append(clusters, name)
+	}
+	sort.Strings(clusters)
+	for _, name := range clusters {
+		got, ok := running.Endpoints[name]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("cluster %s is not active", name))
+		case !slices.Equal(a.Endpoints[name], got):
+			diffs = append(diffs, fmt.Sprintf("cluster %s has endpoints [%s], want [%s]",
+				name, strings.Join(got, ", "), strings.Join(a.Endpoints[name], ", ")))
+		}
+	}
+	extra := []string{}
+	for name := range running.Endpoints {
+		if _, ok := a.Endpoints[name]; !ok {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		diffs = append(diffs, fmt.Sprintf("cluster %s is active but not configured", name))
+	}
+	return diffs
+}
@@ -0,0 +1,106 @@
+package envoy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestEnvoyConfig_ActiveConfig(t *testing.T) {
+	lb := &models.LoadBalancer{
+		ID: "lb-1", Name: "test-lb", Protocol: models.ProtocolHTTP, Algorithm: models.AlgoRoundRobin, Port: 80,
+		Backends: []models.Backend{
+			{ID: "be-2", Address: "10.0.0.2", Port: 8080, Enabled: true},
+			{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true},
+		},
+	}
+	gen := NewGenerator("test-node", "/etc/envoy", "127.0.0.1:9901", 9901, 50000)
+	config, err := gen.GenerateFullConfig(lb)
+	if err != nil {
+		t.Fatalf("GenerateFullConfig() error = %v", err)
+	}
+
+	active, err := config.ActiveConfig()
+	if err != nil {
+		t.Fatalf("ActiveConfig() error = %v", err)
+	}
+	if len(active.Listeners) != 1 {
+		t.Fatalf("Listeners = %v, want one", active.Listeners)
+	}
+	if got := active.Endpoints[ClusterName(lb, "")]; !reflect.DeepEqual(got, []string{"10.0.0.1:8080", "10.0.0.2:8080"}) {
+		t.Errorf("Endpoints = %v", active.Endpoints)
+	}
+}
+
+func TestAdminClient_ActiveConfig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("resource") {
+		case "dynamic_active_listeners":
+			_, _ = w.Write([]byte(`{"configs": [
+				{"name": "listener_http_80", "active_state": {"version_info": "1", "listener": {"name": "listener_http_80"}}},
+				{"name": "listener_warming", "warming_state": {"listener": {"name": "listener_warming"}}}]}`))
+		case "dynamic_active_clusters":
+			_, _ = w.Write([]byte(`{"configs": [{"version_info": "1", "cluster": {"name": "cluster_lb-1",
+				"load_assignment": {"endpoints": [{"lb_endpoints": [
+					{"endpoint": {"address": {"socket_address": {"address": "10.0.0.2", "port_value": 8080}}}},
+					{"endpoint": {"address": {"socket_address": {"address": "10.0.0.1", "port_value": 8080}}}}]}]}}}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	active, err := NewAdminClient(strings.TrimPrefix(server.URL, "http://")).ActiveConfig(context.Background())
+	if err != nil {
+		t.Fatalf("ActiveConfig() error = %v", err)
+	}
+	want := &ActiveConfig{
+		Listeners: []string{"listener_http_80"},
+		Endpoints: map[string][]string{"cluster_lb-1": {"10.0.0.1:8080", "10.0.0.2:8080"}},
+	}
+	if !reflect.DeepEqual(active, want) {
+		t.Errorf("ActiveConfig() = %+v, want %+v", active, want)
+	}
+}
+
+func TestActiveConfig_Divergence(t *testing.T) {
+	want := &ActiveConfig{
+		Listeners: []string{"listener_a", "listener_b"},
+		Endpoints: map[string][]string{"cluster_a": {"10.0.0.1:80"}, "cluster_b": {"10.0.0.2:80"}},
+	}
+
+	tests := []struct {
+		name    string
+		running *ActiveConfig
+		want    []string
+	}{
+		{name: "match", running: want},
+		{
+			name: "old configuration still active",
+			running: &ActiveConfig{
+				Listeners: []string{"listener_a", "listener_old"},
+				Endpoints: map[string][]string{"cluster_a": {"10.0.0.9:80"}, "cluster_old": {}},
+			},
+			want: []string{
+				"listener listener_b is not active",
+				"listener listener_old is active but not configured",
+				"cluster cluster_a has endpoints [10.0.0.9:80], want [10.0.0.1:80]",
+				"cluster cluster_b is not active",
+				"cluster cluster_old is active but not configured",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := want.Divergence(tt.running); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Divergence() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package envoy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// Version is an Envoy release version
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// MinVersion is the oldest Envoy release the generated configuration works
+// with; older releases lack append_action on response headers
+var MinVersion = Version{Major: 1, Minor: 22}
+
+// versionPattern finds the release in `envoy --version` output and in the
+// admin server_info version, both "<commit>/1.28.0/Clean/RELEASE/BoringSSL"
+var versionPattern = regexp.MustCompile(`(?:^|[/\s])(\d+)\.(\d+)\.(\d+)(?:[/\s-]|$)`)
+
+// ParseVersion extracts the Envoy release from a version string
+func ParseVersion(s string) (Version, error) {
+	m := versionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, fmt.Errorf("no Envoy version in %q", strings.TrimSpace(s))
+	}
+	var v Version
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+	return v, nil
+}
+
+// String returns the version as "1.28.0"
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less reports whether v is an older release than other
+func (v Version) Less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+// versionedFeature is a load balancer feature that needs a newer Envoy than
+// MinVersion
+type versionedFeature struct {
+	name  string
+	since Version
+	used  func(lb *models.LoadBalancer) bool
+}
+
+// versionedFeatures lists the features rendered only for Envoy releases that
+// support them
+var versionedFeatures = []versionedFeature{
+	{
+		name:  "routes[].stat_prefix",
+		since: Version{Major: 1, Minor: 23},
+		used: func(lb *models.LoadBalancer) bool {
+			for _, route := range lb.Routes {
+				if route.StatPrefix != "" {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		name:  "multiple addresses",
+		since: Version{Major: 1, Minor: 24},
+		used:  func(lb *models.LoadBalancer) bool { return len(lb.Addresses) > 1 },
+	},
+	{
+		name:  "tracing.provider opentelemetry",
+		since: Version{Major: 1, Minor: 25},
+		used: func(lb *models.LoadBalancer) bool {
+			return lb.Tracing != nil && lb.Tracing.Provider == models.TracingOpenTelemetry && lb.Protocol != models.ProtocolTCP
+		},
+	},
+	{
+		name:  "client_ip.trusted_cidrs",
+		since: Version{Major: 1, Minor: 28},
+		used: func(lb *models.LoadBalancer) bool {
+			return lb.ClientIP != nil && len(lb.ClientIP.TrustedCIDRs) > 0 && lb.Protocol != models.ProtocolTCP
+		},
+	},
+	{
+		name:  "routes[].basic_auth",
+		since: Version{Major: 1, Minor: 31},
+		used: func(lb *models.LoadBalancer) bool {
+			for _, route := range lb.Routes {
+				if route.BasicAuth != nil {
+					return true
+				}
+			}
+			return false
+		},
+	},
+}
+
+// IncompatibleError reports load balancer features the installed Envoy does
+// not support
+type IncompatibleError struct {
+	Version  Version
+	Features []string // "feature (Envoy 1.28.0+)"
+}
+
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("Envoy %s does not support %s", e.Version, strings.Join(e.Features, ", "))
+}
+
+// CheckCompatibility returns an *IncompatibleError when Envoy v is older
+// than MinVersion or lacks a feature the load balancer uses
+func CheckCompatibility(lb *models.LoadBalancer, v Version) error {
+	if v.Less(MinVersion) {
+		return &IncompatibleError{
+			Version:  v,
+			Features: []string{fmt.Sprintf("the generated configuration (Envoy %s+)", MinVersion)},
+		}
+	}
+	var unsupported []string
+	for _, f := range versionedFeatures {
+		if v.Less(f.since) && f.used(lb) {
+			unsupported = append(unsupported, fmt.Sprintf("%s (Envoy %s+)", f.name, f.since))
+		}
+	}
+	if len(unsupported) > 0 {
+		return &IncompatibleError{Version: v, Features: unsupported}
+	}
+	return nil
+}
+
+// Version runs `envoy --version` and returns the installed release
+func (v *Validator) Version(ctx context.Context) (Version, error) {
+	output, err := v.runtime.Command(ctx, "", "--version").CombinedOutput()
+	if err != nil {
+		return Version{}, fmt.Errorf("failed to run %s --version: %w", v.runtime, err)
+	}
+	return ParseVersion(string(output))
+}
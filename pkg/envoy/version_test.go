@@ -0,0 +1,113 @@
+package envoy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Version
+		wantErr bool
+	}{
+		{name: "envoy --version", input: "\nenvoy  version: 816188b86a0a52095b116b107f576324082c7c02/1.28.0/Clean/RELEASE/BoringSSL\n\n", want: Version{1, 28, 0}},
+		{name: "server_info", input: "abc/1.31.2/Clean/RELEASE/BoringSSL", want: Version{1, 31, 2}},
+		{name: "dev build", input: "envoy  version: abc/1.32.0-dev/Modified/DEBUG/BoringSSL", want: Version{1, 32, 0}},
+		{name: "no version", input: "envoy: command not found", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVersion(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseVersion() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersion_Less(t *testing.T) {
+	tests := []struct {
+		a, b Version
+		want bool
+	}{
+		{Version{1, 27, 9}, Version{1, 28, 0}, true},
+		{Version{1, 28, 0}, Version{1, 28, 0}, false},
+		{Version{1, 28, 1}, Version{1, 28, 0}, false},
+		{Version{0, 99, 0}, Version{1, 0, 0}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Less(tt.b); got != tt.want {
+			t.Errorf("%s.Less(%s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	trustedCIDRs := func(protocol models.Protocol) *models.LoadBalancer {
+		return &models.LoadBalancer{Protocol: protocol, ClientIP: &models.ClientIP{TrustedCIDRs: []string{"10.0.0.0/8"}}}
+	}
+
+	tests := []struct {
+		name    string
+		lb      *models.LoadBalancer
+		version Version
+		want    string // substring of the error, "" for compatible
+	}{
+		{name: "plain", lb: &models.LoadBalancer{Protocol: models.ProtocolHTTP}, version: MinVersion},
+		{name: "below minimum", lb: &models.LoadBalancer{Protocol: models.ProtocolHTTP}, version: Version{1, 21, 4}, want: "Envoy 1.21.4 does not support the generated configuration (Envoy 1.22.0+)"},
+		{name: "trusted CIDRs supported", lb: trustedCIDRs(models.ProtocolHTTP), version: Version{1, 28, 0}},
+		{name: "trusted CIDRs unsupported", lb: trustedCIDRs(models.ProtocolHTTPS), version: Version{1, 27, 3}, want: "client_ip.trusted_cidrs (Envoy 1.28.0+)"},
+		{name: "trusted CIDRs not rendered for TCP", lb: trustedCIDRs(models.ProtocolTCP), version: Version{1, 27, 3}},
+		{name: "single address", lb: &models.LoadBalancer{Protocol: models.ProtocolTCP, Addresses: []string{"10.0.0.5"}}, version: MinVersion},
+		{name: "multiple addresses unsupported", lb: &models.LoadBalancer{Protocol: models.ProtocolTCP, Addresses: []string{"10.0.0.5", "10.0.0.6"}}, version: Version{1, 23, 0}, want: "multiple addresses (Envoy 1.24.0+)"},
+		{name: "route stats unsupported", lb: &models.LoadBalancer{Protocol: models.ProtocolHTTP, Routes: []models.Route{{Name: "shop", Path: "/shop", StatPrefix: "shop"}}}, version: Version{1, 22, 9}, want: "routes[].stat_prefix (Envoy 1.23.0+)"},
+		{name: "basic auth unsupported", lb: &models.LoadBalancer{Protocol: models.ProtocolHTTP, Routes: []models.Route{{Name: "staging", Path: "/", BasicAuth: &models.BasicAuth{UsersFile: "/etc/vpsie-lb/auth/staging.htpasswd"}}}}, version: Version{1, 30, 4}, want: "routes[].basic_auth (Envoy 1.31.0+)"},
+		{name: "zipkin tracing", lb: &models.LoadBalancer{Protocol: models.ProtocolHTTP, Tracing: &models.Tracing{Provider: models.TracingZipkin}}, version: MinVersion},
+		{name: "OpenTelemetry tracing unsupported", lb: &models.LoadBalancer{Protocol: models.ProtocolHTTP, Tracing: &models.Tracing{Provider: models.TracingOpenTelemetry}}, version: Version{1, 24, 2}, want: "tracing.provider opentelemetry (Envoy 1.25.0+)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckCompatibility(tt.lb, tt.version)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("CheckCompatibility() error = %v, want none", err)
+				}
+				return
+			}
+			var incompatible *IncompatibleError
+			if !errors.As(err, &incompatible) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("CheckCompatibility() error = %v, want IncompatibleError containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidator_Version(t *testing.T) {
+	binary := filepath.Join(t.TempDir(), "envoy")
+	script := "#!/bin/sh\necho\necho 'envoy  version: 816188b/1.28.0/Clean/RELEASE/BoringSSL'\n"
+	if err := os.WriteFile(binary, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := NewValidator(binary).Version(context.Background())
+	if err != nil || got != (Version{1, 28, 0}) {
+		t.Errorf("Version() = %s, %v, want 1.28.0", got, err)
+	}
+
+	if _, err = NewValidator("/nonexistent/envoy").Version(context.Background()); err == nil {
+		t.Error("Version() with a missing binary: want error")
+	}
+}
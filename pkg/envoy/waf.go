@@ -0,0 +1,35 @@
+package envoy
+
+import (
+	"fmt"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// WAFCluster is the cluster of the WAF sidecar Envoy sends requests to for
+// inspection
+const WAFCluster = "waf"
+
+// wafMessageTimeout bounds how long a request waits for the WAF verdict
+const wafMessageTimeout = "0.5s"
+
+// SetWAFService sets the address (host:port) of the WAF sidecar that
+// inspects the requests of load balancers with a WAF
+func (g *Generator) SetWAFService(address string) {
+	g.wafService = address
+}
+
+// wafData is the external processing filter of an HTTP listener with a WAF
+type wafData struct {
+	ClusterName string
+	FailOpen    bool // pass requests uninspected when the sidecar fails
+}
+
+// newWAFData prepares the WAF filter. Detect mode never blocks, so requests
+// also pass when the sidecar is down; block mode fails closed.
+func (g *Generator) newWAFData(lb *models.LoadBalancer) (*wafData, error) {
+	if g.wafService == "" {
+		return nil, fmt.Errorf("load balancer %s uses a WAF but no WAF sidecar is configured", lb.ID)
+	}
+	return &wafData{ClusterName: WAFCluster, FailOpen: lb.WAF.Mode == models.WAFDetect}, nil
+}
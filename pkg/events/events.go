@@ -0,0 +1,41 @@
+// Package events names the events the agent and its subsystems report. The
+// agent classifies and delivers them; subsystems such as canary rollouts and
+// autoscaling report theirs through a Func, naming them with the constants
+// below so a misspelled event type does not compile.
+package events
+
+import "context"
+
+// Type identifies what an event reports
+type Type string
+
+// Event types reported by subsystems outside the agent package
+const (
+	// pkg/discovery
+	BackendDNSChanged Type = "backend_dns_changed"
+
+	// pkg/gslb
+	GSLBRegionChanged Type = "gslb_region_status_changed"
+
+	// pkg/canary
+	CanaryStarted    Type = "canary_started"
+	CanaryStep       Type = "canary_step"
+	CanaryPromoted   Type = "canary_promoted"
+	CanaryRolledBack Type = "canary_rolled_back"
+
+	// pkg/autoscale
+	AutoscaleOut    Type = "autoscale_out"
+	AutoscaleIn     Type = "autoscale_in"
+	AutoscaleFailed Type = "autoscale_failed"
+
+	// pkg/slowbackend
+	WeightReduced  Type = "backend_weight_reduced"
+	WeightRestored Type = "backend_weight_restored"
+
+	// pkg/firewall
+	AttackStarted Type = "ddos_attack_started"
+	AttackEnded   Type = "ddos_attack_ended"
+)
+
+// Func reports an event of a subsystem
+type Func func(ctx context.Context, eventType Type, message string, metadata map[string]interface{})
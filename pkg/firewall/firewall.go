@@ -0,0 +1,248 @@
+// Package firewall programs the host firewall rules that protect the load
+// balancer against connection floods: a limit of concurrent connections per
+// source address, and, while an attack is under way, a limit of new
+// connections per second per source address. It also counts the SYNs to the
+// listener port, which the attack guard turns into a connection rate.
+//
+// The rules live in a table (nftables) or chain (iptables) of their own and
+// are always replaced as a whole, so the rest of the host firewall is left
+// alone.
+package firewall
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Backend is the firewall the rules are programmed with
+type Backend string
+
+const (
+	// BackendNFTables programs the inet vpsie_lb table with nft
+	BackendNFTables Backend = "nftables"
+	// BackendIPTables programs the VPSIE_LB chain with iptables and ip6tables
+	BackendIPTables Backend = "iptables"
+)
+
+// Names of the rules programmed on the host
+const (
+	nftTable   = "vpsie_lb"
+	nftCounter = "new_connections"
+	ipChain    = "VPSIE_LB"
+)
+
+// sourceBurst is how many times its rate a source may send at once
+const sourceBurst = 2
+
+// Rules are the firewall rules of the listener port. The zero value removes
+// all rules.
+type Rules struct {
+	Port                int
+	MaxConnectionsPerIP int // 0 = unlimited
+	SourceRateLimit     int // SYNs per second per source address, 0 = unlimited
+}
+
+// Runner runs a firewall command with stdin and returns its output
+type Runner interface {
+	Run(ctx context.Context, stdin string, name string, args ...string) (string, error)
+}
+
+// execRunner runs commands on the host
+type execRunner struct{}
+
+func (execRunner) Run(ctx context.Context, stdin string, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// Firewall programs the rules with one backend
+type Firewall struct {
+	backend Backend
+	runner  Runner
+}
+
+// New creates a firewall programming rules with backend on the host
+func New(backend Backend) (*Firewall, error) {
+	return NewWithRunner(backend, execRunner{})
+}
+
+// NewWithRunner creates a firewall running its commands with runner
+func NewWithRunner(backend Backend, runner Runner) (*Firewall, error) {
+	switch backend {
+	case BackendNFTables, BackendIPTables:
+	default:
+		return nil, fmt.Errorf("unknown firewall backend %q", backend)
+	}
+	return &Firewall{backend: backend, runner: runner}, nil
+}
+
+// Apply replaces the programmed rules with rules. Replacing the rules resets
+// the connection counter.
+func (f *Firewall) Apply(ctx context.Context, rules Rules) error {
+	if f.backend == BackendNFTables {
+		if _, err := f.runner.Run(ctx, nftRuleset(rules), "nft", "-f", "-"); err != nil {
+			return fmt.Errorf("failed to apply nftables rules: %w", err)
+		}
+		return nil
+	}
+
+	for _, family := range ipFamilies {
+		if _, err := f.runner.Run(ctx, ipRuleset(rules, family), family.restore, "-w", "--noflush"); err != nil {
+			return fmt.Errorf("failed to apply %s rules: %w", family.command, err)
+		}
+		// Jump to the chain from INPUT once; the chain itself is replaced above
+		if _, err := f.runner.Run(ctx, "", family.command, "-w", "-C", "INPUT", "-j", ipChain); err != nil {
+			if _, err := f.runner.Run(ctx, "", family.command, "-w", "-I", "INPUT", "1", "-j", ipChain); err != nil {
+				return fmt.Errorf("failed to jump to %s from INPUT: %w", ipChain, err)
+			}
+		}
+	}
+	return nil
+}
+
+// NewConnections returns the number of SYNs to the listener port since the
+// rules were last applied
+func (f *Firewall) NewConnections(ctx context.Context) (uint64, error) {
+	if f.backend == BackendNFTables {
+		out, err := f.runner.Run(ctx, "", "nft", "-j", "list", "counter", "inet", nftTable, nftCounter)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read nftables counter: %w", err)
+		}
+		return parseNFTCounter(out)
+	}
+
+	var total uint64
+	for _, family := range ipFamilies {
+		// The first rule of the chain only counts
+		out, err := f.runner.Run(ctx, "", family.command, "-w", "-xnvL", ipChain, "1")
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s counter: %w", family.command, err)
+		}
+		packets, err := parseIPTablesCounter(out)
+		if err != nil {
+			return 0, err
+		}
+		total += packets
+	}
+	return total, nil
+}
+
+// synMatch matches packets opening a TCP connection
+const synMatch = "tcp flags & (fin|syn|rst|ack) == syn"
+
+// nftRuleset renders the nftables script replacing the vpsie_lb table. The
+// table is created before it is deleted so the script also works the first
+// time.
+func nftRuleset(rules Rules) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "table inet %s\n", nftTable)
+	fmt.Fprintf(&b, "delete table inet %s\n", nftTable)
+	if rules.Port == 0 {
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "table inet %s {\n", nftTable)
+	fmt.Fprintf(&b, "\tcounter %s {\n\t}\n", nftCounter)
+	for _, v := range []string{"4", "6"} {
+		if rules.MaxConnectionsPerIP > 0 {
+			fmt.Fprintf(&b, "\tset conn_per_ip%s {\n\t\ttype ipv%s_addr\n\t\tsize 65535\n\t\tflags dynamic\n\t}\n", v, v)
+		}
+		if rules.SourceRateLimit > 0 {
+			fmt.Fprintf(&b, "\tset syn_rate%s {\n\t\ttype ipv%s_addr\n\t\tsize 65535\n\t\tflags dynamic,timeout\n\t\ttimeout 1m\n\t}\n", v, v)
+		}
+	}
+	b.WriteString("\tchain input {\n\t\ttype filter hook input priority filter - 10; policy accept;\n")
+	fmt.Fprintf(&b, "\t\ttcp dport %d %s counter name %q\n", rules.Port, synMatch, nftCounter)
+	for _, family := range []struct{ v, saddr string }{{"4", "ip saddr"}, {"6", "ip6 saddr"}} {
+		if rules.SourceRateLimit > 0 {
+			fmt.Fprintf(&b, "\t\ttcp dport %d %s update @syn_rate%s { %s limit rate over %d/second burst %d packets } drop\n",
+				rules.Port, synMatch, family.v, family.saddr, rules.SourceRateLimit, rules.SourceRateLimit*sourceBurst)
+		}
+		if rules.MaxConnectionsPerIP > 0 {
+			fmt.Fprintf(&b, "\t\ttcp dport %d ct state new add @conn_per_ip%s { %s ct count over %d } reject with tcp reset\n",
+				rules.Port, family.v, family.saddr, rules.MaxConnectionsPerIP)
+		}
+	}
+	b.WriteString("\t}\n}\n")
+	return b.String()
+}
+
+// ipFamily is the iptables command set of one address family
+type ipFamily struct {
+	command string
+	restore string
+	mask    int // bits of a source address
+}
+
+var ipFamilies = []ipFamily{
+	{command: "iptables", restore: "iptables-restore", mask: 32},
+	{command: "ip6tables", restore: "ip6tables-restore", mask: 128},
+}
+
+// ipRuleset renders the iptables-restore input replacing the VPSIE_LB chain.
+// Declaring the chain flushes it, even with --noflush.
+func ipRuleset(rules Rules, family ipFamily) string {
+	var b strings.Builder
+	b.WriteString("*filter\n")
+	fmt.Fprintf(&b, ":%s - [0:0]\n", ipChain)
+	if rules.Port > 0 {
+		match := fmt.Sprintf("-A %s -p tcp --dport %d --syn", ipChain, rules.Port)
+		fmt.Fprintf(&b, "%s -m comment --comment %s\n", match, nftCounter)
+		if rules.SourceRateLimit > 0 {
+			fmt.Fprintf(&b, "%s -m hashlimit --hashlimit-above %d/sec --hashlimit-burst %d --hashlimit-mode srcip --hashlimit-name vpsie_lb_syn -j DROP\n",
+				match, rules.SourceRateLimit, rules.SourceRateLimit*sourceBurst)
+		}
+		if rules.MaxConnectionsPerIP > 0 {
+			fmt.Fprintf(&b, "%s -m connlimit --connlimit-above %d --connlimit-mask %d -j REJECT --reject-with tcp-reset\n",
+				match, rules.MaxConnectionsPerIP, family.mask)
+		}
+	}
+	b.WriteString("COMMIT\n")
+	return b.String()
+}
+
+// parseNFTCounter reads the packets of the counter in nft -j output
+func parseNFTCounter(out string) (uint64, error) {
+	var body struct {
+		NFTables []struct {
+			Counter *struct {
+				Packets uint64 `json:"packets"`
+			} `json:"counter"`
+		} `json:"nftables"`
+	}
+	if err := json.Unmarshal([]byte(out), &body); err != nil {
+		return 0, fmt.Errorf("invalid nft output: %w", err)
+	}
+	for _, object := range body.NFTables {
+		if object.Counter != nil {
+			return object.Counter.Packets, nil
+		}
+	}
+	return 0, fmt.Errorf("counter %s not found", nftCounter)
+}
+
+// parseIPTablesCounter reads the packets of the rule listed by iptables -xnvL
+func parseIPTablesCounter(out string) (uint64, error) {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if packets, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			return packets, nil
+		}
+	}
+	return 0, fmt.Errorf("counter rule of %s not found", ipChain)
+}
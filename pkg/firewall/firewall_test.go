@@ -0,0 +1,150 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// call is one command run by the fake runner
+type call struct {
+	stdin string
+	args  string // command and arguments joined by spaces
+}
+
+// fakeRunner records commands and answers them from outputs, keyed by the
+// joined command line. Commands in fail return an error.
+type fakeRunner struct {
+	calls   []call
+	outputs map[string]string
+	fail    map[string]bool
+}
+
+func (r *fakeRunner) Run(_ context.Context, stdin string, name string, args ...string) (string, error) {
+	line := strings.Join(append([]string{name}, args...), " ")
+	r.calls = append(r.calls, call{stdin: stdin, args: line})
+	if r.fail[line] {
+		return "", errors.New("exit status 1")
+	}
+	return r.outputs[line], nil
+}
+
+func TestFirewall_ApplyNFTables(t *testing.T) {
+	runner := &fakeRunner{}
+	fw, err := NewWithRunner(BackendNFTables, runner)
+	if err != nil {
+		t.Fatalf("NewWithRunner() error = %v", err)
+	}
+
+	if err := fw.Apply(context.Background(), Rules{Port: 443, MaxConnectionsPerIP: 100, SourceRateLimit: 20}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(runner.calls) != 1 || runner.calls[0].args != "nft -f -" {
+		t.Fatalf("calls = %+v, want one nft -f -", runner.calls)
+	}
+	script := runner.calls[0].stdin
+	for _, want := range []string{
+		"table inet vpsie_lb\ndelete table inet vpsie_lb\n",
+		`tcp dport 443 tcp flags & (fin|syn|rst|ack) == syn counter name "new_connections"`,
+		"tcp dport 443 ct state new add @conn_per_ip4 { ip saddr ct count over 100 } reject with tcp reset",
+		"tcp dport 443 ct state new add @conn_per_ip6 { ip6 saddr ct count over 100 } reject with tcp reset",
+		"update @syn_rate6 { ip6 saddr limit rate over 20/second burst 40 packets } drop",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script lacks %q:\n%s", want, script)
+		}
+	}
+
+	// Without a port the table is only removed
+	runner.calls = nil
+	if err := fw.Apply(context.Background(), Rules{}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if got := runner.calls[0].stdin; got != "table inet vpsie_lb\ndelete table inet vpsie_lb\n" {
+		t.Errorf("script = %q, want the table removed", got)
+	}
+}
+
+func TestFirewall_ApplyIPTables(t *testing.T) {
+	runner := &fakeRunner{fail: map[string]bool{"ip6tables -w -C INPUT -j VPSIE_LB": true}}
+	fw, err := NewWithRunner(BackendIPTables, runner)
+	if err != nil {
+		t.Fatalf("NewWithRunner() error = %v", err)
+	}
+
+	if err := fw.Apply(context.Background(), Rules{Port: 80, MaxConnectionsPerIP: 50}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	var lines []string
+	for _, c := range runner.calls {
+		lines = append(lines, c.args)
+	}
+	want := []string{
+		"iptables-restore -w --noflush",
+		"iptables -w -C INPUT -j VPSIE_LB",
+		"ip6tables-restore -w --noflush",
+		"ip6tables -w -C INPUT -j VPSIE_LB",
+		"ip6tables -w -I INPUT 1 -j VPSIE_LB", // the jump only exists for IPv4
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	if v4 := runner.calls[0].stdin; !strings.Contains(v4, "-A VPSIE_LB -p tcp --dport 80 --syn -m connlimit --connlimit-above 50 --connlimit-mask 32 -j REJECT") ||
+		strings.Contains(v4, "hashlimit") {
+		t.Errorf("IPv4 rules:\n%s", v4)
+	}
+	if v6 := runner.calls[2].stdin; !strings.Contains(v6, "--connlimit-mask 128") {
+		t.Errorf("IPv6 rules:\n%s", v6)
+	}
+}
+
+func TestFirewall_NewConnections(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend Backend
+		outputs map[string]string
+		want    uint64
+		wantErr bool
+	}{
+		{
+			name:    "nftables counter",
+			backend: BackendNFTables,
+			outputs: map[string]string{
+				"nft -j list counter inet vpsie_lb new_connections": `{"nftables": [{"metainfo": {"version": "1.0.6"}}, {"counter": {"family": "inet", "name": "new_connections", "table": "vpsie_lb", "handle": 1, "packets": 4242, "bytes": 254520}}]}`,
+			},
+			want: 4242,
+		},
+		{
+			name:    "iptables counters of both families",
+			backend: BackendIPTables,
+			outputs: map[string]string{
+				"iptables -w -xnvL VPSIE_LB 1":  "    1200    72000            tcp  --  *      *       0.0.0.0/0            0.0.0.0/0            tcp dpt:443 flags:0x17/0x02 /* new_connections */\n",
+				"ip6tables -w -xnvL VPSIE_LB 1": "      34     2720            tcp      *      *       ::/0                 ::/0                 tcp dpt:443 flags:0x17/0x02 /* new_connections */\n",
+			},
+			want: 1234,
+		},
+		{
+			name:    "missing counter",
+			backend: BackendNFTables,
+			outputs: map[string]string{"nft -j list counter inet vpsie_lb new_connections": `{"nftables": [{"metainfo": {}}]}`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw, err := NewWithRunner(tt.backend, &fakeRunner{outputs: tt.outputs})
+			if err != nil {
+				t.Fatalf("NewWithRunner() error = %v", err)
+			}
+			got, err := fw.NewConnections(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewConnections() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NewConnections() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
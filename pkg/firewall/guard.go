@@ -0,0 +1,224 @@
+package firewall
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/events"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// RuleSet programs firewall rules and counts new connections
+type RuleSet interface {
+	Apply(ctx context.Context, rules Rules) error
+	NewConnections(ctx context.Context) (uint64, error)
+}
+
+// Status describes the connection flood protection of the load balancer
+type Status struct {
+	Port            int       `json:"port,omitempty"`
+	ConnectionRate  float64   `json:"connection_rate"` // new connections per second at the last sample
+	Attack          bool      `json:"attack"`
+	AttackStartedAt time.Time `json:"attack_started_at,omitempty"`
+	LastAttackAt    time.Time `json:"last_attack_at,omitempty"` // last sample above the threshold
+}
+
+// Guard keeps the firewall rules of the active load balancer configuration
+// and switches attack mode: while new connections arrive faster than the
+// attack threshold, every source address is limited to the source rate.
+// Attack mode ends after the rate stayed below the threshold for the
+// cooldown. State is kept in memory, so a restarted agent starts out of
+// attack mode.
+type Guard struct {
+	mu        sync.Mutex
+	rules     RuleSet
+	events    events.Func // reports attack mode changes
+	now       func() time.Time
+	policy    *models.DDoSProtection // nil without firewall rules
+	applied   bool                   // the rules of policy are programmed
+	status    Status
+	sample    uint64
+	sampledAt time.Time // zero until the first sample after the rules were applied
+}
+
+// NewGuard creates a guard programming rules
+func NewGuard(rules RuleSet, onEvent events.Func) *Guard {
+	return &Guard{rules: rules, events: onEvent, now: time.Now}
+}
+
+// Apply programs the firewall rules of lb. Attack mode survives the update
+// while the port stays the same and the policy still has an attack threshold.
+func (g *Guard) Apply(ctx context.Context, lb *models.LoadBalancer) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var policy *models.DDoSProtection
+	if lb.DDoS != nil && lb.DDoS.NeedsFirewall() {
+		p := *lb.DDoS
+		policy = &p
+	}
+	samePort := g.status.Port == lb.Port
+	if g.applied && samePolicy(g.policy, policy) && (policy == nil || samePort) {
+		return nil
+	}
+
+	status := Status{}
+	if policy != nil {
+		status.Port = lb.Port
+		if g.status.Attack && policy.AttackThreshold > 0 && samePort {
+			status.Attack = true
+			status.AttackStartedAt = g.status.AttackStartedAt
+			status.LastAttackAt = g.status.LastAttackAt
+		}
+	}
+	g.policy, g.status = policy, status
+	// Program the rules again on the next update when this fails
+	err := g.program(ctx)
+	g.applied = err == nil
+	return err
+}
+
+// samePolicy reports whether a and b program the same rules
+func samePolicy(a, b *models.DDoSProtection) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// program applies the rules of the policy and attack mode. The caller holds
+// the lock.
+func (g *Guard) program(ctx context.Context) error {
+	var rules Rules
+	if g.policy != nil {
+		rules = Rules{Port: g.status.Port, MaxConnectionsPerIP: g.policy.MaxConnectionsPerIP}
+		if g.status.Attack {
+			rules.SourceRateLimit = g.policy.SourceRateLimit
+		}
+	}
+	// Applying resets the counter, so rates start from a new sample
+	g.sampledAt = time.Time{}
+	return g.rules.Apply(ctx, rules)
+}
+
+// Run samples the connection rate every interval until ctx is cancelled.
+// While active returns false (e.g. on a passive HA node) attack mode is not
+// switched.
+func (g *Guard) Run(ctx context.Context, interval time.Duration, active func() bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if active() {
+				g.Evaluate(ctx)
+			}
+		}
+	}
+}
+
+// attackEvent is an attack mode change, reported once the lock is released
+type attackEvent struct {
+	eventType events.Type
+	message   string
+	metadata  map[string]interface{}
+}
+
+// Evaluate samples the connection rate and enters or leaves attack mode
+func (g *Guard) Evaluate(ctx context.Context) {
+	g.mu.Lock()
+	e := g.evaluate(ctx)
+	g.mu.Unlock()
+
+	if e == nil {
+		return
+	}
+	log.Printf("Connection flood protection: %s", e.message)
+	if g.events != nil {
+		g.events(ctx, e.eventType, e.message, e.metadata)
+	}
+}
+
+// evaluate takes a sample and returns the attack mode change it calls for,
+// or nil. The caller holds the lock.
+func (g *Guard) evaluate(ctx context.Context) *attackEvent {
+	if g.policy == nil || g.policy.AttackThreshold == 0 {
+		return nil
+	}
+	count, err := g.rules.NewConnections(ctx)
+	if err != nil {
+		log.Printf("Warning: Connection flood protection: %v", err)
+		return nil
+	}
+	now := g.now()
+	previous, previousAt := g.sample, g.sampledAt
+	g.sample, g.sampledAt = count, now
+
+	// Rates need two samples; the counter only goes down when the rules
+	// were replaced outside the agent
+	if previousAt.IsZero() || count < previous || !now.After(previousAt) {
+		return nil
+	}
+	rate := float64(count-previous) / now.Sub(previousAt).Seconds()
+	g.status.ConnectionRate = rate
+
+	if rate > float64(g.policy.AttackThreshold) {
+		g.status.LastAttackAt = now
+		if g.status.Attack {
+			return nil
+		}
+		g.status.Attack = true
+		g.status.AttackStartedAt = now
+		if err := g.program(ctx); err != nil {
+			log.Printf("Warning: Failed to enter attack mode: %v", err)
+			g.status.Attack, g.status.AttackStartedAt = false, time.Time{}
+			return nil
+		}
+		return g.newEvent(events.AttackStarted, fmt.Sprintf("%.0f new connections/s on port %d exceed %d, limiting sources to %d/s",
+			rate, g.status.Port, g.policy.AttackThreshold, g.policy.SourceRateLimit), rate)
+	}
+
+	cooldown := time.Duration(models.DefaultAttackCooldown) * time.Second
+	if g.policy.AttackCooldown > 0 {
+		cooldown = time.Duration(g.policy.AttackCooldown) * time.Second
+	}
+	if !g.status.Attack || now.Sub(g.status.LastAttackAt) < cooldown {
+		return nil
+	}
+	g.status.Attack = false
+	if err := g.program(ctx); err != nil {
+		log.Printf("Warning: Failed to leave attack mode: %v", err)
+		g.status.Attack = true
+		return nil
+	}
+	g.status.AttackStartedAt = time.Time{}
+	return g.newEvent(events.AttackEnded, fmt.Sprintf("new connections on port %d below %d/s for %s, source limits lifted",
+		g.status.Port, g.policy.AttackThreshold, cooldown), rate)
+}
+
+// newEvent describes an attack mode change. The caller holds the lock.
+func (g *Guard) newEvent(eventType events.Type, message string, rate float64) *attackEvent {
+	return &attackEvent{
+		eventType: eventType,
+		message:   message,
+		metadata: map[string]interface{}{
+			"port":              g.status.Port,
+			"connection_rate":   rate,
+			"attack_threshold":  g.policy.AttackThreshold,
+			"source_rate_limit": g.policy.SourceRateLimit,
+		},
+	}
+}
+
+// Status returns the state of the connection flood protection
+func (g *Guard) Status() Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.status
+}
@@ -0,0 +1,108 @@
+package firewall
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/events"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// fakeRuleSet records applied rules and serves a settable counter
+type fakeRuleSet struct {
+	applied []Rules
+	count   uint64
+}
+
+func (f *fakeRuleSet) Apply(_ context.Context, rules Rules) error {
+	f.applied = append(f.applied, rules)
+	f.count = 0
+	return nil
+}
+
+func (f *fakeRuleSet) NewConnections(context.Context) (uint64, error) {
+	return f.count, nil
+}
+
+func TestGuard_AttackMode(t *testing.T) {
+	rules := &fakeRuleSet{}
+	var reported []events.Type
+	guard := NewGuard(rules, func(_ context.Context, eventType events.Type, _ string, _ map[string]interface{}) {
+		reported = append(reported, eventType)
+	})
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	guard.now = func() time.Time { return now }
+
+	lb := &models.LoadBalancer{
+		Port: 443,
+		DDoS: &models.DDoSProtection{MaxConnectionsPerIP: 100, AttackThreshold: 1000, SourceRateLimit: 20, AttackCooldown: 60},
+	}
+	ctx := context.Background()
+	if err := guard.Apply(ctx, lb); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	// An unchanged policy is not programmed again
+	if err := guard.Apply(ctx, lb); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if want := (Rules{Port: 443, MaxConnectionsPerIP: 100}); len(rules.applied) != 1 || rules.applied[0] != want {
+		t.Fatalf("applied = %+v, want %+v once", rules.applied, want)
+	}
+
+	// sample advances the clock by 10s with rate new connections per second
+	sample := func(rate uint64) {
+		rules.count += rate * 10
+		now = now.Add(10 * time.Second)
+		guard.Evaluate(ctx)
+	}
+
+	guard.Evaluate(ctx) // first sample
+	sample(500)
+	if guard.Status().Attack {
+		t.Fatal("attack mode below the threshold")
+	}
+
+	sample(5000)
+	status := guard.Status()
+	if !status.Attack || status.ConnectionRate != 5000 {
+		t.Fatalf("status = %+v, want attack mode at 5000/s", status)
+	}
+	if want := (Rules{Port: 443, MaxConnectionsPerIP: 100, SourceRateLimit: 20}); rules.applied[len(rules.applied)-1] != want {
+		t.Errorf("attack rules = %+v, want %+v", rules.applied[len(rules.applied)-1], want)
+	}
+
+	// The counter was reset with the new rules, so the next sample only starts a rate
+	guard.Evaluate(ctx)
+	sample(10)
+	sample(10)
+	sample(10)
+	if !guard.Status().Attack {
+		t.Fatal("attack mode ended before the cooldown")
+	}
+	// Configuration updates keep attack mode
+	if err := guard.Apply(ctx, lb); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	sample(10)
+	sample(10)
+	sample(10)
+	if guard.Status().Attack {
+		t.Fatal("attack mode outlasted the cooldown")
+	}
+	if want := (Rules{Port: 443, MaxConnectionsPerIP: 100}); rules.applied[len(rules.applied)-1] != want {
+		t.Errorf("rules after the attack = %+v, want %+v", rules.applied[len(rules.applied)-1], want)
+	}
+	if len(reported) != 2 || reported[0] != events.AttackStarted || reported[1] != events.AttackEnded {
+		t.Errorf("events = %v, want attack started and ended", reported)
+	}
+
+	// Dropping the protection removes the rules
+	lb.DDoS = nil
+	if err := guard.Apply(ctx, lb); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if got := rules.applied[len(rules.applied)-1]; got != (Rules{}) {
+		t.Errorf("rules without protection = %+v, want none", got)
+	}
+}
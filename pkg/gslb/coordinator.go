@@ -0,0 +1,287 @@
+// Package gslb coordinates load balancers serving one name from several
+// regions. The agent of each region publishes a healthy or degraded status
+// for its region through the VPSie API, which VPSie DNS steering uses to send
+// clients to healthy regions, and reads the statuses the other regions
+// published.
+//
+// The published status follows the health checks with hysteresis: a region
+// is only marked degraded after several failed checks in a row, and healthy
+// again after several passed ones, so a single bad check does not move
+// traffic back and forth.
+package gslb
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/events"
+)
+
+// State is the published status of a region
+type State string
+
+const (
+	// StateHealthy regions receive traffic
+	StateHealthy State = "healthy"
+	// StateDegraded regions are steered around while another region is healthy
+	StateDegraded State = "degraded"
+)
+
+// staleIntervals is after how many check intervals without an update a peer
+// region's summary is considered stale
+const staleIntervals = 3
+
+// Summary is the health summary a region publishes
+type Summary struct {
+	Region         string    `json:"region"`
+	LoadBalancerID string    `json:"loadbalancer_id"`
+	Status         State     `json:"status"`
+	Weight         int       `json:"weight"` // percent of backends healthy
+	Reason         string    `json:"reason,omitempty"`
+	Since          time.Time `json:"since"` // when Status last changed
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Peer is the summary of another region
+type Peer struct {
+	Summary
+	Stale bool `json:"stale"` // not updated for several check intervals
+}
+
+// Exchange publishes the summary of this region and returns the summaries of
+// all regions of a group
+type Exchange interface {
+	PublishRegionHealth(ctx context.Context, group string, summary *Summary) error
+	RegionHealth(ctx context.Context, group string) ([]Summary, error)
+}
+
+// Observation is the outcome of one health check of this region
+type Observation struct {
+	Weight int    // percent of backends healthy
+	Reason string // why the region is unhealthy, empty when it is healthy
+}
+
+// Settings configure a coordinator
+type Settings struct {
+	Group          string
+	Region         string
+	LoadBalancerID string
+	Rise           int // passed checks in a row that mark a degraded region healthy
+	Fall           int // failed checks in a row that mark a healthy region degraded
+}
+
+// Status describes the coordination state of this region
+type Status struct {
+	Group     string   `json:"group"`
+	Region    string   `json:"region"`
+	Local     *Summary `json:"local,omitempty"` // nil until enough checks agree on a status
+	Streak    int      `json:"streak"`          // checks in a row disagreeing with the published status
+	Peers     []Peer   `json:"peers"`
+	LastError string   `json:"last_error,omitempty"`
+}
+
+// Coordinator publishes the status of this region and tracks the other
+// regions. State is kept in memory, so a restarted agent publishes again
+// once enough checks agree.
+type Coordinator struct {
+	settings Settings
+	exchange Exchange
+	events   events.Func // reports region status changes
+	now      func() time.Time
+
+	mu        sync.Mutex
+	local     *Summary
+	streak    int  // checks in a row disagreeing with local, or agreeing on a first status
+	streakOK  bool // whether the streak is of passed checks
+	peers     []Peer
+	lastError string
+	interval  time.Duration
+}
+
+// NewCoordinator creates a coordinator publishing through exchange
+func NewCoordinator(settings Settings, exchange Exchange, onEvent events.Func) *Coordinator {
+	return &Coordinator{settings: settings, exchange: exchange, events: onEvent, now: time.Now}
+}
+
+// Run checks the health of this region every interval until ctx is
+// cancelled. While active returns false (e.g. on a passive HA node) nothing
+// is published; the active node speaks for the region.
+func (c *Coordinator) Run(ctx context.Context, interval time.Duration, active func() bool, check func(ctx context.Context) Observation) {
+	c.mu.Lock()
+	c.interval = interval
+	c.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if active() {
+			c.Observe(ctx, check(ctx))
+			c.Sync(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// statusChange is a published status change, reported once the lock is released
+type statusChange struct {
+	message  string
+	metadata map[string]interface{}
+}
+
+// Observe records a health check and moves the published status once enough
+// checks in a row agree
+func (c *Coordinator) Observe(ctx context.Context, obs Observation) {
+	c.mu.Lock()
+	change := c.observe(obs)
+	c.mu.Unlock()
+
+	if change == nil {
+		return
+	}
+	log.Printf("GSLB: %s", change.message)
+	if c.events != nil {
+		c.events(ctx, events.GSLBRegionChanged, change.message, change.metadata)
+	}
+}
+
+// observe applies obs and returns the status change it causes, or nil. The
+// caller holds the lock.
+func (c *Coordinator) observe(obs Observation) *statusChange {
+	now := c.now()
+	ok := obs.Reason == ""
+	if c.local != nil {
+		c.local.Weight, c.local.UpdatedAt = obs.Weight, now
+		if ok == (c.local.Status == StateHealthy) {
+			c.streak, c.local.Reason = 0, obs.Reason
+			return nil
+		}
+	}
+
+	if c.streak == 0 || c.streakOK != ok {
+		c.streak, c.streakOK = 0, ok
+	}
+	c.streak++
+	needed := c.settings.Fall
+	if ok {
+		needed = c.settings.Rise
+	}
+	if c.streak < needed {
+		return nil
+	}
+
+	previous := State("unknown")
+	if c.local != nil {
+		previous = c.local.Status
+	}
+	state := StateDegraded
+	if ok {
+		state = StateHealthy
+	}
+	c.local = &Summary{
+		Region:         c.settings.Region,
+		LoadBalancerID: c.settings.LoadBalancerID,
+		Status:         state,
+		Weight:         obs.Weight,
+		Reason:         obs.Reason,
+		Since:          now,
+		UpdatedAt:      now,
+	}
+	c.streak = 0
+
+	message := fmt.Sprintf("region %s is %s after %d checks in a row", c.settings.Region, state, needed)
+	if !ok {
+		message += ": " + obs.Reason
+	}
+	return &statusChange{
+		message: message,
+		metadata: map[string]interface{}{
+			"group":    c.settings.Group,
+			"region":   c.settings.Region,
+			"previous": string(previous),
+			"status":   string(state),
+			"weight":   obs.Weight,
+			"reason":   obs.Reason,
+		},
+	}
+}
+
+// Sync publishes the status of this region, once there is one, and reads
+// the statuses of the other regions
+func (c *Coordinator) Sync(ctx context.Context) {
+	c.mu.Lock()
+	var local *Summary
+	if c.local != nil {
+		s := *c.local
+		local = &s
+	}
+	c.mu.Unlock()
+
+	var errs []string
+	if local != nil {
+		if err := c.exchange.PublishRegionHealth(ctx, c.settings.Group, local); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to publish region health: %v", err))
+		}
+	}
+	summaries, err := c.exchange.RegionHealth(ctx, c.settings.Group)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("failed to read region health: %v", err))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastError = ""
+	if len(errs) > 0 {
+		c.lastError = errs[0]
+		for _, e := range errs {
+			log.Printf("Warning: GSLB: %s", e)
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	previous := make(map[string]State, len(c.peers))
+	for _, p := range c.peers {
+		previous[p.Region] = p.Status
+	}
+	now := c.now()
+	peers := make([]Peer, 0, len(summaries))
+	for _, s := range summaries {
+		if s.Region == c.settings.Region {
+			continue
+		}
+		stale := c.interval > 0 && now.Sub(s.UpdatedAt) > staleIntervals*c.interval
+		peers = append(peers, Peer{Summary: s, Stale: stale})
+		if state, ok := previous[s.Region]; ok && state != s.Status {
+			log.Printf("GSLB: region %s changed from %s to %s", s.Region, state, s.Status)
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Region < peers[j].Region })
+	c.peers = peers
+}
+
+// Status returns the coordination state of this region
+func (c *Coordinator) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := Status{
+		Group:     c.settings.Group,
+		Region:    c.settings.Region,
+		Streak:    c.streak,
+		Peers:     append([]Peer{}, c.peers...),
+		LastError: c.lastError,
+	}
+	if c.local != nil {
+		s := *c.local
+		status.Local = &s
+	}
+	return status
+}
@@ -0,0 +1,126 @@
+package gslb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/events"
+)
+
+// fakeExchange records published summaries and serves the group's summaries
+type fakeExchange struct {
+	published []Summary
+	regions   []Summary
+	err       error
+}
+
+func (f *fakeExchange) PublishRegionHealth(_ context.Context, _ string, summary *Summary) error {
+	f.published = append(f.published, *summary)
+	return f.err
+}
+
+func (f *fakeExchange) RegionHealth(context.Context, string) ([]Summary, error) {
+	return f.regions, f.err
+}
+
+func TestCoordinator_Hysteresis(t *testing.T) {
+	var reported []string
+	c := NewCoordinator(Settings{Group: "shop", Region: "eu-west", LoadBalancerID: "lb-1", Rise: 3, Fall: 2}, &fakeExchange{},
+		func(_ context.Context, _ events.Type, message string, _ map[string]interface{}) {
+			reported = append(reported, message)
+		})
+	ctx := context.Background()
+	healthy := Observation{Weight: 100}
+	failing := Observation{Weight: 0, Reason: "no healthy backends"}
+
+	state := func() State {
+		if local := c.Status().Local; local != nil {
+			return local.Status
+		}
+		return ""
+	}
+
+	steps := []struct {
+		obs  Observation
+		want State
+	}{
+		{healthy, ""},
+		{healthy, ""},
+		{failing, ""}, // a disagreeing check starts the streak over
+		{healthy, ""},
+		{healthy, ""},
+		{healthy, StateHealthy},
+		{failing, StateHealthy},
+		{healthy, StateHealthy}, // the failure did not last
+		{failing, StateHealthy},
+		{failing, StateDegraded},
+		{healthy, StateDegraded},
+		{healthy, StateDegraded},
+		{healthy, StateHealthy},
+	}
+	for i, step := range steps {
+		c.Observe(ctx, step.obs)
+		if got := state(); got != step.want {
+			t.Fatalf("after check %d: status = %q, want %q", i+1, got, step.want)
+		}
+	}
+
+	want := []string{
+		"region eu-west is healthy after 3 checks in a row",
+		"region eu-west is degraded after 2 checks in a row: no healthy backends",
+		"region eu-west is healthy after 3 checks in a row",
+	}
+	if len(reported) != len(want) {
+		t.Fatalf("events = %q, want %q", reported, want)
+	}
+	for i := range want {
+		if reported[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, reported[i], want[i])
+		}
+	}
+}
+
+func TestCoordinator_Sync(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	exchange := &fakeExchange{regions: []Summary{
+		{Region: "us-east", Status: StateDegraded, UpdatedAt: now.Add(-10 * time.Second)},
+		{Region: "eu-west", Status: StateHealthy, UpdatedAt: now},
+		{Region: "ap-south", Status: StateHealthy, UpdatedAt: now.Add(-time.Hour)},
+	}}
+	c := NewCoordinator(Settings{Group: "shop", Region: "eu-west", LoadBalancerID: "lb-1", Rise: 1, Fall: 1}, exchange, nil)
+	c.now = func() time.Time { return now }
+	c.interval = 15 * time.Second
+	ctx := context.Background()
+
+	// Nothing is published before the checks agree on a status
+	c.Sync(ctx)
+	if len(exchange.published) != 0 {
+		t.Fatalf("published = %+v before the first status", exchange.published)
+	}
+
+	c.Observe(ctx, Observation{Weight: 75})
+	c.Sync(ctx)
+	if len(exchange.published) != 1 {
+		t.Fatalf("published %d summaries, want 1", len(exchange.published))
+	}
+	if got := exchange.published[0]; got.Region != "eu-west" || got.LoadBalancerID != "lb-1" || got.Status != StateHealthy || got.Weight != 75 {
+		t.Errorf("published = %+v, want eu-west healthy at weight 75", got)
+	}
+
+	status := c.Status()
+	if len(status.Peers) != 2 || status.Peers[0].Region != "ap-south" || status.Peers[1].Region != "us-east" {
+		t.Fatalf("peers = %+v, want ap-south and us-east", status.Peers)
+	}
+	if !status.Peers[0].Stale || status.Peers[1].Stale {
+		t.Errorf("peers = %+v, want only ap-south stale", status.Peers)
+	}
+
+	// Failures keep the last known peers
+	exchange.err = errors.New("API returned status 503")
+	c.Sync(ctx)
+	if status := c.Status(); len(status.Peers) != 2 || status.LastError == "" {
+		t.Errorf("status = %+v, want the last peers and an error", status)
+	}
+}
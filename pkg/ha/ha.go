@@ -0,0 +1,45 @@
+// Package ha coordinates active/passive load balancer pairs. An Elector
+// decides which node is active; only the active node reports status to VPSie
+// and owns the floating IP, while the passive node keeps its Envoy
+// configuration in sync so it can take over immediately.
+package ha
+
+import (
+	"context"
+	"strings"
+)
+
+// Role is the HA role of this node
+type Role string
+
+const (
+	// RoleActive is the node serving traffic and reporting status
+	RoleActive Role = "active"
+	// RolePassive is the standby node
+	RolePassive Role = "passive"
+	// RoleFault means the node is unfit to serve (e.g. VRRP FAULT)
+	RoleFault Role = "fault"
+	// RoleUnknown is the role before the elector has decided
+	RoleUnknown Role = "unknown"
+)
+
+// Elector determines the role of this node. Run blocks until ctx is
+// cancelled, calling onChange whenever the role changes (including the first
+// decision).
+type Elector interface {
+	Run(ctx context.Context, onChange func(Role)) error
+}
+
+// ParseVRRPState maps a keepalived VRRP state name to a Role
+func ParseVRRPState(state string) Role {
+	switch strings.ToUpper(strings.TrimSpace(state)) {
+	case "MASTER":
+		return RoleActive
+	case "BACKUP":
+		return RolePassive
+	case "FAULT", "STOP":
+		return RoleFault
+	default:
+		return RoleUnknown
+	}
+}
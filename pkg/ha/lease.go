@@ -0,0 +1,91 @@
+package ha
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// releaseTimeout bounds the lease release on shutdown
+const releaseTimeout = 5 * time.Second
+
+// LeaseClient acquires a lease on the load balancer. AcquireLease both takes
+// a free lease and renews one already held by holder; it returns false when
+// another holder owns the lease.
+type LeaseClient interface {
+	AcquireLease(ctx context.Context, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, holder string) error
+}
+
+// LeaseElector makes the holder of a time-limited lease the active node. It
+// protects against two agents reconciling the same load balancer: the one
+// that does not hold the lease stands by until the lease expires.
+type LeaseElector struct {
+	client LeaseClient
+	holder string
+	ttl    time.Duration
+}
+
+// NewLeaseElector creates an elector competing for the lease as holder
+func NewLeaseElector(client LeaseClient, holder string, ttl time.Duration) (*LeaseElector, error) {
+	if holder == "" {
+		return nil, fmt.Errorf("lease holder must not be empty")
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("lease TTL must be positive, got %s", ttl)
+	}
+	return &LeaseElector{client: client, holder: holder, ttl: ttl}, nil
+}
+
+// Run acquires and renews the lease every third of its TTL until ctx is
+// cancelled, then releases it so the other node can take over without
+// waiting for expiry
+func (e *LeaseElector) Run(ctx context.Context, onChange func(Role)) error {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	current := RoleUnknown
+	var lastRenewed time.Time
+	for {
+		role := current
+		held, err := e.client.AcquireLease(ctx, e.holder, e.ttl)
+		switch {
+		case err == nil && held:
+			lastRenewed = time.Now()
+			role = RoleActive
+		case err == nil:
+			role = RolePassive
+		default:
+			log.Printf("Warning: Failed to renew HA lease: %v", err)
+			// Ride out short API outages, but step down before the lease
+			// can expire on the server and be taken by the other node
+			if current != RoleActive || time.Since(lastRenewed) >= e.ttl*2/3 {
+				role = RolePassive
+			}
+		}
+
+		if role != current {
+			current = role
+			onChange(role)
+		}
+
+		select {
+		case <-ctx.Done():
+			if current == RoleActive {
+				e.release()
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// release gives up the lease on shutdown
+func (e *LeaseElector) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	if err := e.client.ReleaseLease(ctx, e.holder); err != nil {
+		log.Printf("Warning: Failed to release HA lease: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package ha
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLeaseClient is a single shared lease with a scripted failure mode
+type fakeLeaseClient struct {
+	mu       sync.Mutex
+	holder   string
+	fail     bool
+	released []string
+}
+
+func (f *fakeLeaseClient) AcquireLease(_ context.Context, holder string, _ time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return false, errors.New("api unavailable")
+	}
+	if f.holder == "" {
+		f.holder = holder
+	}
+	return f.holder == holder, nil
+}
+
+func (f *fakeLeaseClient) ReleaseLease(_ context.Context, holder string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.holder == holder {
+		f.holder = ""
+	}
+	f.released = append(f.released, holder)
+	return nil
+}
+
+func (f *fakeLeaseClient) setFail(fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = fail
+}
+
+// roleRecorder collects role changes from an elector
+type roleRecorder struct {
+	mu    sync.Mutex
+	roles []Role
+}
+
+func (r *roleRecorder) record(role Role) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.roles = append(r.roles, role)
+}
+
+func (r *roleRecorder) waitFor(t *testing.T, want Role) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		n := len(r.roles)
+		last := RoleUnknown
+		if n > 0 {
+			last = r.roles[n-1]
+		}
+		r.mu.Unlock()
+		if last == want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("role did not become %v", want)
+}
+
+func TestNewLeaseElector(t *testing.T) {
+	tests := []struct {
+		name    string
+		holder  string
+		ttl     time.Duration
+		wantErr bool
+	}{
+		{name: "valid", holder: "lb-a", ttl: 15 * time.Second},
+		{name: "empty holder", holder: "", ttl: 15 * time.Second, wantErr: true},
+		{name: "zero ttl", holder: "lb-a", ttl: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLeaseElector(&fakeLeaseClient{}, tt.holder, tt.ttl)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewLeaseElector() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLeaseElector_SingleLeader(t *testing.T) {
+	client := &fakeLeaseClient{}
+	ttl := 30 * time.Millisecond
+
+	a, _ := NewLeaseElector(client, "lb-a", ttl)
+	b, _ := NewLeaseElector(client, "lb-b", ttl)
+
+	var ra, rb roleRecorder
+	ctxA, cancelA := context.WithCancel(context.Background())
+	doneA := make(chan struct{})
+	go func() { defer close(doneA); _ = a.Run(ctxA, ra.record) }()
+	ra.waitFor(t, RoleActive)
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	doneB := make(chan struct{})
+	go func() { defer close(doneB); _ = b.Run(ctxB, rb.record) }()
+	rb.waitFor(t, RolePassive)
+
+	// Stopping the leader releases the lease and the standby takes over
+	cancelA()
+	<-doneA
+	rb.waitFor(t, RoleActive)
+
+	cancelB()
+	<-doneB
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if len(client.released) != 2 {
+		t.Errorf("released = %v, want both holders to release", client.released)
+	}
+}
+
+func TestLeaseElector_StepsDownBeforeExpiryOnErrors(t *testing.T) {
+	client := &fakeLeaseClient{}
+	ttl := 120 * time.Millisecond
+	e, _ := NewLeaseElector(client, "lb-a", ttl)
+
+	var r roleRecorder
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = e.Run(ctx, r.record) }()
+	r.waitFor(t, RoleActive)
+
+	client.setFail(true)
+	start := time.Now()
+	r.waitFor(t, RolePassive)
+	elapsed := time.Since(start)
+	if elapsed < ttl/4 {
+		t.Errorf("stepped down after %s, want to ride out the first failed renewals", elapsed)
+	}
+	if elapsed >= ttl {
+		t.Errorf("stepped down after %s, want before the lease TTL (%s)", elapsed, ttl)
+	}
+}
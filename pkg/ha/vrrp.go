@@ -0,0 +1,69 @@
+package ha
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// defaultVRRPPollInterval is how often the VRRP state file is checked
+const defaultVRRPPollInterval = time.Second
+
+// VRRPElector follows the VRRP state decided by keepalived. keepalived's
+// notify script writes the state (MASTER, BACKUP, FAULT) to a file, which the
+// elector polls; keepalived itself moves the floating IP.
+type VRRPElector struct {
+	stateFile    string
+	pollInterval time.Duration
+}
+
+// NewVRRPElector creates an elector reading the keepalived state file
+func NewVRRPElector(stateFile string, pollInterval time.Duration) (*VRRPElector, error) {
+	if stateFile == "" {
+		return nil, fmt.Errorf("VRRP state file must not be empty")
+	}
+	if pollInterval <= 0 {
+		pollInterval = defaultVRRPPollInterval
+	}
+	return &VRRPElector{stateFile: stateFile, pollInterval: pollInterval}, nil
+}
+
+// Run polls the state file and reports role changes until ctx is cancelled
+func (e *VRRPElector) Run(ctx context.Context, onChange func(Role)) error {
+	ticker := time.NewTicker(e.pollInterval)
+	defer ticker.Stop()
+
+	current := RoleUnknown
+	for {
+		role := e.readRole()
+		if role != current {
+			current = role
+			onChange(role)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// readRole reads the current role. A missing or unreadable file means
+// keepalived has not reported yet and the node must not act as active.
+func (e *VRRPElector) readRole() Role {
+	data, err := os.ReadFile(e.stateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: Failed to read VRRP state file: %v", err)
+		}
+		return RolePassive
+	}
+	role := ParseVRRPState(string(data))
+	if role == RoleUnknown {
+		return RolePassive
+	}
+	return role
+}
@@ -0,0 +1,99 @@
+package ha
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseVRRPState(t *testing.T) {
+	tests := []struct {
+		state string
+		want  Role
+	}{
+		{"MASTER", RoleActive},
+		{"master\n", RoleActive},
+		{"BACKUP", RolePassive},
+		{"FAULT", RoleFault},
+		{"STOP", RoleFault},
+		{"garbage", RoleUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			if got := ParseVRRPState(tt.state); got != tt.want {
+				t.Errorf("ParseVRRPState(%q) = %v, want %v", tt.state, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewVRRPElector_EmptyPath(t *testing.T) {
+	if _, err := NewVRRPElector("", 0); err == nil {
+		t.Error("Expected error for empty state file")
+	}
+}
+
+func TestVRRPElector_Run(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "vrrp-state")
+	elector, err := NewVRRPElector(stateFile, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewVRRPElector() error = %v", err)
+	}
+
+	var mu sync.Mutex
+	var roles []Role
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = elector.Run(ctx, func(r Role) {
+			mu.Lock()
+			roles = append(roles, r)
+			mu.Unlock()
+		})
+	}()
+
+	waitFor := func(want Role) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			mu.Lock()
+			last := RoleUnknown
+			if len(roles) > 0 {
+				last = roles[len(roles)-1]
+			}
+			mu.Unlock()
+			if last == want {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("role did not become %v", want)
+	}
+
+	// No state file yet: passive
+	waitFor(RolePassive)
+
+	if err = os.WriteFile(stateFile, []byte("MASTER\n"), 0600); err != nil {
+		t.Fatalf("Failed to write state: %v", err)
+	}
+	waitFor(RoleActive)
+
+	if err = os.WriteFile(stateFile, []byte("FAULT\n"), 0600); err != nil {
+		t.Fatalf("Failed to write state: %v", err)
+	}
+	waitFor(RoleFault)
+
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(roles) != 3 {
+		t.Errorf("role changes = %v, want exactly 3 transitions", roles)
+	}
+}
@@ -0,0 +1,227 @@
+// Package haproxy generates, validates and reloads HAProxy configuration for
+// load balancers on hosts that cannot run Envoy
+package haproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/proxy"
+)
+
+// Name is the name of the HAProxy driver
+const Name = "haproxy"
+
+// maxWeight is the highest server weight HAProxy accepts
+const maxWeight = 256
+
+// Defaults of the generated timeouts, in seconds
+const (
+	defaultConnectTimeout = 5
+	defaultIdleTimeout    = 3600
+)
+
+// algorithms maps load balancing algorithms to HAProxy balance directives
+var algorithms = map[models.LoadBalancingAlgo]string{
+	models.AlgoRoundRobin:   "roundrobin",
+	models.AlgoLeastRequest: "leastconn",
+	models.AlgoRandom:       "random",
+	models.AlgoRingHash:     "source",
+}
+
+// features lists what HAProxy lacks besides the features only Envoy provides
+var features = []proxy.Feature{
+	{Name: fmt.Sprintf("backend weights above %d", maxWeight), Used: func(lb *models.LoadBalancer) bool {
+		for _, b := range proxy.Backends(lb) {
+			if b.Weight > maxWeight {
+				return true
+			}
+		}
+		return false
+	}},
+	// HAProxy reads the key from the certificate file or from <certificate>.key
+	{Name: "tls_config.private_key_path other than certificate_path or <certificate_path>.key", Used: func(lb *models.LoadBalancer) bool {
+		tls := lb.TLSConfig
+		return lb.Protocol == models.ProtocolHTTPS && tls != nil &&
+			tls.PrivateKeyPath != tls.CertificatePath && tls.PrivateKeyPath != tls.CertificatePath+".key"
+	}},
+}
+
+// Driver generates HAProxy configuration and applies it to HAProxy run by
+// systemd
+type Driver struct {
+	configPath     string
+	maxConnections int
+	service        *proxy.Service
+}
+
+// NewDriver creates a HAProxy driver writing configPath, checked with binary
+// and applied by reloading unit. maxConnections is the global connection
+// limit.
+func NewDriver(binary, unit, configPath string, maxConnections int) *Driver {
+	return &Driver{
+		configPath:     configPath,
+		maxConnections: maxConnections,
+		service:        proxy.NewService(binary, unit),
+	}
+}
+
+// Name returns the name of the proxy
+func (d *Driver) Name() string {
+	return Name
+}
+
+// ConfigPath returns the configuration file HAProxy reads
+func (d *Driver) ConfigPath() string {
+	return d.configPath
+}
+
+// Validate checks a configuration file with haproxy -c
+func (d *Driver) Validate(ctx context.Context, path string) error {
+	return d.service.Check(ctx, "-c", "-q", "-f", path)
+}
+
+// Reload makes HAProxy load its configuration file again
+func (d *Driver) Reload(ctx context.Context) error {
+	return d.service.Reload(ctx)
+}
+
+// Generate returns the HAProxy configuration serving lb, or a
+// *proxy.UnsupportedError when lb uses features HAProxy cannot provide
+func (d *Driver) Generate(lb *models.LoadBalancer) ([]byte, error) {
+	if err := proxy.Check(Name, lb, features...); err != nil {
+		return nil, err
+	}
+
+	connect, idle := defaultConnectTimeout, defaultIdleTimeout
+	server := 0
+	if t := lb.Timeouts; t != nil {
+		if t.Connect > 0 {
+			connect = t.Connect
+		}
+		if t.Idle > 0 {
+			idle = t.Idle
+		}
+		server = t.Request
+	}
+	if server == 0 || lb.Protocol == models.ProtocolTCP {
+		server = idle
+	}
+	mode := "http"
+	if lb.Protocol == models.ProtocolTCP {
+		mode = "tcp"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by the VPSie load balancer agent for %s, do not edit\n", lb.ID)
+	b.WriteString("global\n")
+	fmt.Fprintf(&b, "    maxconn %d\n", d.maxConnections)
+	b.WriteString("\ndefaults\n")
+	fmt.Fprintf(&b, "    mode %s\n", mode)
+	fmt.Fprintf(&b, "    timeout connect %ds\n", connect)
+	fmt.Fprintf(&b, "    timeout client %ds\n", idle)
+	fmt.Fprintf(&b, "    timeout server %ds\n", server)
+	if mode == "http" {
+		b.WriteString("    option forwardfor\n")
+	}
+
+	fmt.Fprintf(&b, "\nfrontend lb_%s\n", lb.ID)
+	addresses := lb.Addresses
+	if len(addresses) == 0 {
+		addresses = []string{""}
+	}
+	for _, addr := range addresses {
+		fmt.Fprintf(&b, "    bind %s%s\n", hostPort(addr, lb.ListenPort()), bindTLS(lb))
+	}
+	if lb.MaxConnections > 0 {
+		fmt.Fprintf(&b, "    maxconn %d\n", lb.MaxConnections)
+	}
+	fmt.Fprintf(&b, "    default_backend backends_%s\n", lb.ID)
+
+	fmt.Fprintf(&b, "\nbackend backends_%s\n", lb.ID)
+	algorithm := algorithms[lb.Algorithm]
+	if algorithm == "" {
+		algorithm = algorithms[models.AlgoRoundRobin]
+	}
+	fmt.Fprintf(&b, "    balance %s\n", algorithm)
+	if lb.Algorithm == models.AlgoRingHash {
+		b.WriteString("    hash-type consistent\n")
+	}
+	check := ""
+	if hc := lb.HealthCheck; hc != nil {
+		check = " check"
+		if hc.IsHTTPBased() {
+			fmt.Fprintf(&b, "    option httpchk GET %s\n", hc.Path)
+			if len(hc.ExpectedStatus) > 0 {
+				fmt.Fprintf(&b, "    http-check expect rstatus ^(%s)$\n", joinInts(hc.ExpectedStatus, "|"))
+			}
+		}
+		fmt.Fprintf(&b, "    default-server inter %ds fall %d rise %d", hc.Interval, hc.UnhealthyThreshold, hc.HealthyThreshold)
+		if hc.Type == models.HealthCheckHTTPS {
+			b.WriteString(" check-ssl verify none")
+		}
+		b.WriteString("\n")
+	}
+	for _, backend := range proxy.Backends(lb) {
+		weight := backend.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		fmt.Fprintf(&b, "    server %s %s weight %d%s", backend.ID, hostPort(backend.Address, backend.Port), weight, check)
+		if backend.Priority > 0 {
+			b.WriteString(" backup")
+		}
+		b.WriteString("\n")
+	}
+	return []byte(b.String()), nil
+}
+
+// bindTLS returns the TLS options of the frontend bind lines
+func bindTLS(lb *models.LoadBalancer) string {
+	tls := lb.TLSConfig
+	if lb.Protocol != models.ProtocolHTTPS || tls == nil {
+		return ""
+	}
+	opts := " ssl crt " + tls.CertificatePath
+	if tls.CACertPath != "" {
+		opts += " ca-file " + tls.CACertPath + " verify required"
+	}
+	if tls.MinVersion != "" {
+		opts += " ssl-min-ver " + tls.MinVersion
+	}
+	if tls.MaxVersion != "" {
+		opts += " ssl-max-ver " + tls.MaxVersion
+	}
+	if len(tls.CipherSuites) > 0 {
+		opts += " ciphers " + strings.Join(tls.CipherSuites, ":")
+	}
+	if len(tls.ALPN) > 0 {
+		opts += " alpn " + strings.Join(tls.ALPN, ",")
+	}
+	if tls.DisableSessionTickets {
+		opts += " no-tls-tickets"
+	}
+	return opts
+}
+
+// hostPort returns an address and port as HAProxy reads them; IPv6
+// addresses get the ipv6@ prefix, and an empty address binds every address
+func hostPort(addr string, port int) string {
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+		return "ipv6@" + addr + ":" + strconv.Itoa(port)
+	}
+	return addr + ":" + strconv.Itoa(port)
+}
+
+// joinInts joins numbers with sep
+func joinInts(numbers []int, sep string) string {
+	parts := make([]string, len(numbers))
+	for i, n := range numbers {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, sep)
+}
@@ -0,0 +1,82 @@
+package haproxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/proxy"
+)
+
+func TestDriver_Generate(t *testing.T) {
+	lb := &models.LoadBalancer{
+		ID:        "lb-1",
+		Protocol:  models.ProtocolHTTPS,
+		Port:      443,
+		Algorithm: models.AlgoLeastRequest,
+		Addresses: []string{"203.0.113.10", "2001:db8::10"},
+		TLSConfig: &models.TLSConfig{
+			CertificatePath: "/etc/vpsie-lb/certs/shop.pem",
+			PrivateKeyPath:  "/etc/vpsie-lb/certs/shop.pem.key",
+			MinVersion:      "TLSv1.2",
+			ALPN:            []string{"h2", "http/1.1"},
+		},
+		HealthCheck: &models.HealthCheck{Type: models.HealthCheckHTTP, Path: "/healthz", ExpectedStatus: []int{200, 204},
+			Interval: 10, Timeout: 5, UnhealthyThreshold: 3, HealthyThreshold: 2},
+		Timeouts:       &models.Timeouts{Request: 30},
+		MaxConnections: 1000,
+		Backends: []models.Backend{
+			{ID: "web-1", Address: "10.0.0.11", Port: 8080, Weight: 2, Enabled: true},
+			{ID: "web-2", Address: "10.0.0.12", Port: 8080, Priority: 1, Enabled: true},
+			{ID: "web-3", Address: "10.0.0.13", Port: 8080},
+		},
+	}
+
+	got, err := NewDriver("/usr/sbin/haproxy", "haproxy.service", "/etc/haproxy/haproxy.cfg", 50000).Generate(lb)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	want := `# Generated by the VPSie load balancer agent for lb-1, do not edit
+global
+    maxconn 50000
+
+defaults
+    mode http
+    timeout connect 5s
+    timeout client 3600s
+    timeout server 30s
+    option forwardfor
+
+frontend lb_lb-1
+    bind 203.0.113.10:443 ssl crt /etc/vpsie-lb/certs/shop.pem ssl-min-ver TLSv1.2 alpn h2,http/1.1
+    bind ipv6@2001:db8::10:443 ssl crt /etc/vpsie-lb/certs/shop.pem ssl-min-ver TLSv1.2 alpn h2,http/1.1
+    maxconn 1000
+    default_backend backends_lb-1
+
+backend backends_lb-1
+    balance leastconn
+    option httpchk GET /healthz
+    http-check expect rstatus ^(200|204)$
+    default-server inter 10s fall 3 rise 2
+    server web-1 10.0.0.11:8080 weight 2 check
+    server web-2 10.0.0.12:8080 weight 1 check backup
+`
+	if string(got) != want {
+		t.Errorf("Generate() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDriver_GenerateUnsupported(t *testing.T) {
+	lb := &models.LoadBalancer{
+		ID:        "lb-1",
+		Protocol:  models.ProtocolHTTPS,
+		Port:      443,
+		TLSConfig: &models.TLSConfig{CertificatePath: "/etc/ssl/shop.crt", PrivateKeyPath: "/etc/ssl/private/shop.key"},
+		Backends:  []models.Backend{{ID: "web-1", Address: "10.0.0.11", Port: 8080, Weight: 1000, Enabled: true}},
+	}
+	_, err := NewDriver("/usr/sbin/haproxy", "haproxy.service", "/etc/haproxy/haproxy.cfg", 50000).Generate(lb)
+	var unsupported *proxy.UnsupportedError
+	if !errors.As(err, &unsupported) || len(unsupported.Features) != 2 {
+		t.Errorf("Generate() error = %v, want the weight and the separate key refused", err)
+	}
+}
@@ -0,0 +1,155 @@
+package healthdns
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"strings"
+)
+
+// DNS message constants (RFC 1035, RFC 3596)
+const (
+	headerLen    = 12
+	maxUDPLen    = 512 // without EDNS, UDP answers are truncated beyond this
+	maxLabelLen  = 63
+	maxNameLen   = 255
+	namePointer  = 0xc000 | headerLen // compression pointer to the question name
+	flagResponse = 0x8000
+	flagAuth     = 0x0400
+	flagTrunc    = 0x0200
+	flagRecurse  = 0x0100
+	opcodeMask   = 0x7800
+)
+
+// Record types and class answered
+const (
+	typeA    uint16 = 1
+	typeTXT  uint16 = 16
+	typeAAAA uint16 = 28
+	typeANY  uint16 = 255
+	classIN  uint16 = 1
+	classANY uint16 = 255
+)
+
+// Response codes
+const (
+	rcodeSuccess = 0
+	rcodeFormErr = 1
+	rcodeNotImp  = 4
+	rcodeRefused = 5
+)
+
+// errMalformed is returned for messages that cannot be parsed
+var errMalformed = errors.New("malformed DNS message")
+
+// question is the single question of a query
+type question struct {
+	name  string // lower case, without the trailing dot
+	qtype uint16
+	class uint16
+	end   int // offset after the question in the query
+}
+
+// parseQuestion reads the question of a query. The header has been checked
+// by the caller.
+func parseQuestion(msg []byte) (question, error) {
+	var labels []string
+	off, length := headerLen, 0
+	for {
+		if off >= len(msg) {
+			return question{}, errMalformed
+		}
+		n := int(msg[off])
+		off++
+		if n == 0 {
+			break
+		}
+		// Queries carry one name, so compression pointers are not expected
+		if n > maxLabelLen || off+n > len(msg) {
+			return question{}, errMalformed
+		}
+		length += n + 1
+		if length > maxNameLen {
+			return question{}, errMalformed
+		}
+		labels = append(labels, strings.ToLower(string(msg[off:off+n])))
+		off += n
+	}
+	if off+4 > len(msg) {
+		return question{}, errMalformed
+	}
+	return question{
+		name:  strings.Join(labels, "."),
+		qtype: binary.BigEndian.Uint16(msg[off:]),
+		class: binary.BigEndian.Uint16(msg[off+2:]),
+		end:   off + 4,
+	}, nil
+}
+
+// record is one resource record of an answer
+type record struct {
+	rtype uint16
+	data  []byte
+}
+
+// addressRecord returns the A or AAAA record of addr
+func addressRecord(addr netip.Addr) record {
+	if addr.Is4() {
+		b := addr.As4()
+		return record{rtype: typeA, data: b[:]}
+	}
+	b := addr.As16()
+	return record{rtype: typeAAAA, data: b[:]}
+}
+
+// txtRecord returns a TXT record of one string, cut at 255 bytes
+func txtRecord(text string) record {
+	if len(text) > 255 {
+		text = text[:255]
+	}
+	return record{rtype: typeTXT, data: append([]byte{byte(len(text))}, text...)}
+}
+
+// buildResponse answers query with rcode and the records, which are all
+// owned by the question name. Answers to UDP queries that do not fit 512
+// bytes are sent without records and with the truncated flag, so the client
+// retries over TCP.
+func buildResponse(query []byte, q question, rcode int, ttl uint32, records []record, udp bool) []byte {
+	flags := binary.BigEndian.Uint16(query[2:])
+	respFlags := flagResponse | flagAuth | flags&(opcodeMask|flagRecurse) | uint16(rcode)
+
+	size := q.end
+	for _, r := range records {
+		size += 12 + len(r.data)
+	}
+	if udp && size > maxUDPLen {
+		respFlags |= flagTrunc
+		records = nil
+	}
+
+	resp := make([]byte, headerLen, size)
+	copy(resp, query[:2]) // ID
+	binary.BigEndian.PutUint16(resp[2:], respFlags)
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(records)))
+	resp = append(resp, query[headerLen:q.end]...)
+	for _, r := range records {
+		resp = binary.BigEndian.AppendUint16(resp, namePointer)
+		resp = binary.BigEndian.AppendUint16(resp, r.rtype)
+		resp = binary.BigEndian.AppendUint16(resp, classIN)
+		resp = binary.BigEndian.AppendUint32(resp, ttl)
+		resp = binary.BigEndian.AppendUint16(resp, uint16(len(r.data)))
+		resp = append(resp, r.data...)
+	}
+	return resp
+}
+
+// errorResponse answers a query whose question could not be used with rcode
+// and no question
+func errorResponse(query []byte, rcode int) []byte {
+	flags := binary.BigEndian.Uint16(query[2:])
+	resp := make([]byte, headerLen)
+	copy(resp, query[:2])
+	binary.BigEndian.PutUint16(resp[2:], flagResponse|flags&(opcodeMask|flagRecurse)|uint16(rcode))
+	return resp
+}
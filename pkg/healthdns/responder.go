@@ -0,0 +1,247 @@
+// Package healthdns exports the health of the load balancer as DNS: a small
+// authoritative responder answers queries for one name with the virtual IPs
+// of the load balancer while it is healthy, and with an empty answer while it
+// is not. A GSLB or DNS failover service probing the responders of several
+// regions, or a zone delegating the name to them, then only hands out the
+// addresses of healthy regions.
+//
+// A TXT query for the name returns the health and the weight, the percent of
+// healthy backends, for weighted GSLB policies.
+package healthdns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tcpTimeout bounds a TCP connection from a client
+const tcpTimeout = 10 * time.Second
+
+// Check is the outcome of one health check of the load balancer node
+type Check struct {
+	Problem         string // why the node cannot serve traffic, e.g. Envoy is down; empty when it can
+	HealthyBackends uint64
+	TotalBackends   uint64
+}
+
+// Evaluate returns the weight of the check, the percent of healthy backends,
+// and why the load balancer is unhealthy with less than minHealthyPercent of
+// its backends, and at least one, healthy. The reason is empty when it is
+// healthy.
+func (c Check) Evaluate(minHealthyPercent int) (weight int, reason string) {
+	if c.TotalBackends > 0 {
+		weight = int(c.HealthyBackends * 100 / c.TotalBackends)
+	}
+	switch {
+	case c.Problem != "":
+		return weight, c.Problem
+	case c.HealthyBackends == 0:
+		return weight, "no healthy backends"
+	case weight < minHealthyPercent:
+		return weight, fmt.Sprintf("%d%% of backends healthy, below %d%%", weight, minHealthyPercent)
+	}
+	return weight, ""
+}
+
+// Status is the health signal exported by the responder
+type Status struct {
+	Healthy   bool      `json:"healthy"`
+	Weight    int       `json:"weight"` // percent of backends healthy
+	Reason    string    `json:"reason,omitempty"`
+	Addresses []string  `json:"addresses"` // answered while healthy
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+}
+
+// Responder answers DNS queries for one name from the last health check. It
+// starts unhealthy until the first check.
+type Responder struct {
+	name              string // lower case, without the trailing dot
+	ttl               uint32
+	minHealthyPercent int
+	now               func() time.Time
+
+	mu        sync.RWMutex
+	status    Status
+	addresses []netip.Addr // answered while healthy
+}
+
+// NewResponder creates a responder for name answering with ttl. The load
+// balancer is healthy while at least minHealthyPercent of its backends, and
+// at least one, are healthy.
+func NewResponder(name string, ttl time.Duration, minHealthyPercent int) *Responder {
+	return &Responder{
+		name:              strings.ToLower(strings.TrimSuffix(name, ".")),
+		ttl:               uint32(ttl / time.Second),
+		minHealthyPercent: minHealthyPercent,
+		now:               time.Now,
+		status:            Status{Reason: "not checked yet", Addresses: []string{}},
+	}
+}
+
+// Update records a health check. Addresses are answered while the load
+// balancer is healthy. It returns the new status and whether the health
+// changed.
+func (r *Responder) Update(check Check, addresses []netip.Addr) (Status, bool) {
+	status := Status{Addresses: make([]string, 0, len(addresses)), CheckedAt: r.now()}
+	for _, addr := range addresses {
+		status.Addresses = append(status.Addresses, addr.String())
+	}
+	status.Weight, status.Reason = check.Evaluate(r.minHealthyPercent)
+	if status.Reason == "" && len(addresses) == 0 {
+		status.Reason = "no addresses to answer with"
+	}
+	status.Healthy = status.Reason == ""
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := r.status.Healthy != status.Healthy
+	r.status, r.addresses = status, addresses
+	return status, changed
+}
+
+// Status returns the last health signal
+func (r *Responder) Status() Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.status
+}
+
+// Answer returns the response to a DNS query, or nil when the message is
+// not a query worth answering. Queries for other names are refused.
+func (r *Responder) Answer(query []byte, udp bool) []byte {
+	if len(query) < headerLen {
+		return nil
+	}
+	flags := binary.BigEndian.Uint16(query[2:])
+	if flags&flagResponse != 0 {
+		return nil
+	}
+	if flags&opcodeMask != 0 {
+		return errorResponse(query, rcodeNotImp)
+	}
+	if binary.BigEndian.Uint16(query[4:]) != 1 {
+		return errorResponse(query, rcodeFormErr)
+	}
+	q, err := parseQuestion(query)
+	if err != nil {
+		return errorResponse(query, rcodeFormErr)
+	}
+	if q.name != r.name || (q.class != classIN && q.class != classANY) {
+		return buildResponse(query, q, rcodeRefused, 0, nil, udp)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var records []record
+	switch q.qtype {
+	case typeA, typeAAAA, typeANY:
+		if !r.status.Healthy {
+			break
+		}
+		for _, addr := range r.addresses {
+			rec := addressRecord(addr)
+			if q.qtype == typeANY || q.qtype == rec.rtype {
+				records = append(records, rec)
+			}
+		}
+	case typeTXT:
+		records = append(records, txtRecord(fmt.Sprintf("healthy=%t weight=%d", r.status.Healthy, r.status.Weight)))
+	}
+	// Empty answers carry no SOA, so resolvers do not cache them and pick up
+	// the load balancer again as soon as it is healthy
+	return buildResponse(query, q, rcodeSuccess, r.ttl, records, udp)
+}
+
+// Serve answers queries over UDP and TCP on addr until ctx is cancelled
+func (r *Responder) Serve(ctx context.Context, addr string) error {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on udp %s: %w", addr, err)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		pc.Close()
+		return fmt.Errorf("failed to listen on tcp %s: %w", addr, err)
+	}
+	go func() {
+		<-ctx.Done()
+		pc.Close()
+		ln.Close()
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		r.serveUDP(pc)
+	}()
+	go func() {
+		defer wg.Done()
+		r.serveTCP(ln)
+	}()
+	wg.Wait()
+	return nil
+}
+
+// serveUDP answers datagrams until pc is closed
+func (r *Responder) serveUDP(pc net.PacketConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Warning: Health DNS stopped on udp: %v", err)
+			}
+			return
+		}
+		if resp := r.Answer(buf[:n], true); resp != nil {
+			_, _ = pc.WriteTo(resp, from)
+		}
+	}
+}
+
+// serveTCP accepts connections until ln is closed
+func (r *Responder) serveTCP(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Warning: Health DNS stopped on tcp: %v", err)
+			}
+			return
+		}
+		go r.serveConn(conn)
+	}
+}
+
+// serveConn answers the length-prefixed queries of one TCP connection
+func (r *Responder) serveConn(conn net.Conn) {
+	defer conn.Close()
+	var length [2]byte
+	for {
+		_ = conn.SetDeadline(time.Now().Add(tcpTimeout))
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		resp := r.Answer(query, false)
+		if resp == nil {
+			return
+		}
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...)); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package healthdns
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newQuery builds a query with one question
+func newQuery(id uint16, name string, qtype uint16) []byte {
+	msg := binary.BigEndian.AppendUint16(nil, id)
+	msg = binary.BigEndian.AppendUint16(msg, flagRecurse)
+	msg = append(msg, 0, 1, 0, 0, 0, 0, 0, 0)
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	return binary.BigEndian.AppendUint16(msg, classIN)
+}
+
+// answer is a parsed response
+type answer struct {
+	id        uint16
+	rcode     int
+	truncated bool
+	ttl       uint32
+	records   []string // addresses or TXT strings
+}
+
+// parseAnswer reads a response to a query built by newQuery
+func parseAnswer(t *testing.T, resp []byte, query []byte) answer {
+	t.Helper()
+	if len(resp) < len(query) {
+		t.Fatalf("response of %d bytes is shorter than the query", len(resp))
+	}
+	flags := binary.BigEndian.Uint16(resp[2:])
+	if flags&flagResponse == 0 {
+		t.Fatal("response flag not set")
+	}
+	a := answer{id: binary.BigEndian.Uint16(resp), rcode: int(flags & 0xf), truncated: flags&flagTrunc != 0}
+	count := int(binary.BigEndian.Uint16(resp[6:]))
+	off := len(query)
+	for i := 0; i < count; i++ {
+		rtype := binary.BigEndian.Uint16(resp[off+2:])
+		a.ttl = binary.BigEndian.Uint32(resp[off+6:])
+		length := int(binary.BigEndian.Uint16(resp[off+10:]))
+		data := resp[off+12 : off+12+length]
+		switch rtype {
+		case typeA, typeAAAA:
+			addr, _ := netip.AddrFromSlice(data)
+			a.records = append(a.records, addr.String())
+		case typeTXT:
+			a.records = append(a.records, string(data[1:]))
+		}
+		off += 12 + length
+	}
+	if off != len(resp) {
+		t.Fatalf("response has %d trailing bytes", len(resp)-off)
+	}
+	return a
+}
+
+func TestResponder_Update(t *testing.T) {
+	addrs := []netip.Addr{netip.MustParseAddr("203.0.113.10")}
+	tests := []struct {
+		name        string
+		check       Check
+		addresses   []netip.Addr
+		wantHealthy bool
+		wantWeight  int
+		wantReason  string
+	}{
+		{
+			name:        "all backends healthy",
+			check:       Check{HealthyBackends: 4, TotalBackends: 4},
+			addresses:   addrs,
+			wantHealthy: true,
+			wantWeight:  100,
+		},
+		{
+			name:        "half the backends at the minimum",
+			check:       Check{HealthyBackends: 2, TotalBackends: 4},
+			addresses:   addrs,
+			wantHealthy: true,
+			wantWeight:  50,
+		},
+		{
+			name:       "below the minimum",
+			check:      Check{HealthyBackends: 1, TotalBackends: 4},
+			addresses:  addrs,
+			wantWeight: 25,
+			wantReason: "25% of backends healthy, below 50%",
+		},
+		{
+			name:       "node problem",
+			check:      Check{Problem: "Envoy is not running", HealthyBackends: 4, TotalBackends: 4},
+			addresses:  addrs,
+			wantWeight: 100,
+			wantReason: "Envoy is not running",
+		},
+		{
+			name:       "no backends",
+			addresses:  addrs,
+			wantReason: "no healthy backends",
+		},
+		{
+			name:       "no addresses",
+			check:      Check{HealthyBackends: 4, TotalBackends: 4},
+			wantWeight: 100,
+			wantReason: "no addresses to answer with",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewResponder("lb.example.com", 30*time.Second, 50)
+			status, changed := r.Update(tt.check, tt.addresses)
+			if status.Healthy != tt.wantHealthy || status.Weight != tt.wantWeight || status.Reason != tt.wantReason {
+				t.Errorf("Update() = %+v, want healthy %t, weight %d, reason %q", status, tt.wantHealthy, tt.wantWeight, tt.wantReason)
+			}
+			// Responders start unhealthy
+			if changed != tt.wantHealthy {
+				t.Errorf("Update() changed = %t, want %t", changed, tt.wantHealthy)
+			}
+		})
+	}
+}
+
+func TestResponder_Answer(t *testing.T) {
+	r := NewResponder("LB.example.com.", 30*time.Second, 0)
+	r.Update(Check{HealthyBackends: 3, TotalBackends: 4}, []netip.Addr{
+		netip.MustParseAddr("203.0.113.10"),
+		netip.MustParseAddr("2001:db8::10"),
+	})
+
+	tests := []struct {
+		name      string
+		qname     string
+		qtype     uint16
+		wantRcode int
+		want      []string
+	}{
+		{name: "A", qname: "lb.example.com", qtype: typeA, want: []string{"203.0.113.10"}},
+		{name: "AAAA in upper case", qname: "LB.EXAMPLE.COM.", qtype: typeAAAA, want: []string{"2001:db8::10"}},
+		{name: "ANY", qname: "lb.example.com", qtype: typeANY, want: []string{"203.0.113.10", "2001:db8::10"}},
+		{name: "TXT weight", qname: "lb.example.com", qtype: typeTXT, want: []string{"healthy=true weight=75"}},
+		{name: "other type", qname: "lb.example.com", qtype: 15},
+		{name: "other name", qname: "www.example.com", qtype: typeA, wantRcode: rcodeRefused},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := newQuery(0x1234, tt.qname, tt.qtype)
+			got := parseAnswer(t, r.Answer(query, true), query)
+			if got.id != 0x1234 || got.rcode != tt.wantRcode {
+				t.Fatalf("id %#x rcode %d, want %#x rcode %d", got.id, got.rcode, 0x1234, tt.wantRcode)
+			}
+			if strings.Join(got.records, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("records = %v, want %v", got.records, tt.want)
+			}
+			if len(got.records) > 0 && got.ttl != 30 {
+				t.Errorf("ttl = %d, want 30", got.ttl)
+			}
+		})
+	}
+
+	// An unhealthy load balancer answers without addresses
+	r.Update(Check{Problem: "node is passive"}, []netip.Addr{netip.MustParseAddr("203.0.113.10")})
+	query := newQuery(1, "lb.example.com", typeA)
+	if got := parseAnswer(t, r.Answer(query, true), query); got.rcode != rcodeSuccess || len(got.records) != 0 {
+		t.Errorf("unhealthy answer = %+v, want an empty answer", got)
+	}
+}
+
+func TestResponder_AnswerMalformed(t *testing.T) {
+	r := NewResponder("lb.example.com", 30*time.Second, 0)
+
+	if resp := r.Answer([]byte{1, 2, 3}, true); resp != nil {
+		t.Errorf("Answer(short message) = %v, want no response", resp)
+	}
+	response := newQuery(1, "lb.example.com", typeA)
+	response[2] |= flagResponse >> 8
+	if resp := r.Answer(response, true); resp != nil {
+		t.Errorf("Answer(response) = %v, want no response", resp)
+	}
+	truncated := newQuery(1, "lb.example.com", typeA)
+	truncated = truncated[:len(truncated)-3]
+	if resp := r.Answer(truncated, true); len(resp) != headerLen || resp[3]&0xf != rcodeFormErr {
+		t.Errorf("Answer(truncated question) = %v, want FORMERR", resp)
+	}
+}
+
+func TestResponder_AnswerTruncated(t *testing.T) {
+	r := NewResponder("lb.example.com", 30*time.Second, 0)
+	var addrs []netip.Addr
+	for i := 1; i <= 20; i++ {
+		addrs = append(addrs, netip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, 15: byte(i)}))
+	}
+	r.Update(Check{HealthyBackends: 1, TotalBackends: 1}, addrs)
+
+	query := newQuery(1, "lb.example.com", typeAAAA)
+	if got := parseAnswer(t, r.Answer(query, true), query); !got.truncated || len(got.records) != 0 {
+		t.Errorf("UDP answer = %+v, want truncated", got)
+	}
+	if got := parseAnswer(t, r.Answer(query, false), query); got.truncated || len(got.records) != 20 {
+		t.Errorf("TCP answer has %d records, want 20", len(got.records))
+	}
+}
+
+func TestResponder_Serve(t *testing.T) {
+	// Reserve a port free for both UDP and TCP
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := pc.LocalAddr().String()
+	pc.Close()
+
+	r := NewResponder("lb.example.com", 30*time.Second, 0)
+	r.Update(Check{HealthyBackends: 1, TotalBackends: 1}, []netip.Addr{netip.MustParseAddr("203.0.113.10")})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- r.Serve(ctx, addr) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	}()
+
+	query := newQuery(7, "lb.example.com", typeA)
+	var resp []byte
+	for attempt := 0; attempt < 50 && resp == nil; attempt++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			time.Sleep(20 * time.Millisecond)
+			continue
+		}
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...)); err != nil {
+			t.Fatal(err)
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			t.Fatal(err)
+		}
+		resp = make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+	if got := parseAnswer(t, resp, query); len(got.records) != 1 || got.records[0] != "203.0.113.10" {
+		t.Errorf("TCP answer = %+v, want 203.0.113.10", got)
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(query); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, maxUDPLen)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parseAnswer(t, buf[:n], query); len(got.records) != 1 {
+		t.Errorf("UDP answer = %+v, want one address", got)
+	}
+}
@@ -0,0 +1,132 @@
+// Package ingress translates Kubernetes Ingress resources into a load balancer
+// with host and path routes, so the agent can serve HTTP routing managed with
+// standard Kubernetes objects.
+package ingress
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/k8s"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// Backend targets
+const (
+	// BackendTargetNodePort sends traffic to the Service's node port on every ready node (default)
+	BackendTargetNodePort = "node_port"
+	// BackendTargetPod sends traffic directly to ready pod endpoints
+	BackendTargetPod = "pod"
+)
+
+// DefaultIngressClass is the class handled when none is configured
+const DefaultIngressClass = "vpsie"
+
+// watchedCollections trigger a re-sync whenever they change
+var watchedCollections = []string{
+	"/apis/networking.k8s.io/v1/ingresses",
+	"/api/v1/services",
+	"/api/v1/nodes",
+	"/apis/discovery.k8s.io/v1/endpointslices",
+}
+
+// KubernetesAPI is the subset of the Kubernetes API used by the source
+type KubernetesAPI interface {
+	ListIngresses(ctx context.Context) (*k8s.IngressList, error)
+	ListServices(ctx context.Context) (*k8s.ServiceList, error)
+	ListNodes(ctx context.Context) (*k8s.NodeList, error)
+	ListEndpointSlices(ctx context.Context, namespace, service string) (*k8s.EndpointSliceList, error)
+}
+
+// watcher is implemented by Kubernetes clients that can stream changes
+type watcher interface {
+	WatchLoop(ctx context.Context, path string, onEvent func())
+}
+
+// Options configures the generated load balancer
+type Options struct {
+	LoadBalancerID string // ID and name of the generated load balancer
+	IngressClass   string // only Ingresses of this class are served
+	Port           int    // HTTP listener port
+	BackendTarget  string // node_port (default) or pod
+}
+
+// Source is an agent configuration source backed by Kubernetes Ingresses
+type Source struct {
+	kube KubernetesAPI
+	opts Options
+}
+
+// NewSource creates an Ingress source
+func NewSource(kube KubernetesAPI, opts Options) *Source {
+	if opts.IngressClass == "" {
+		opts.IngressClass = DefaultIngressClass
+	}
+	if opts.Port == 0 {
+		opts.Port = 80
+	}
+	if opts.BackendTarget == "" {
+		opts.BackendTarget = BackendTargetNodePort
+	}
+	if opts.LoadBalancerID == "" {
+		opts.LoadBalancerID = "ingress-" + opts.IngressClass
+	}
+	return &Source{kube: kube, opts: opts}
+}
+
+// GetLoadBalancerConfig builds the load balancer from the current Ingresses
+func (s *Source) GetLoadBalancerConfig(ctx context.Context) (*models.LoadBalancer, error) {
+	ingressList, err := s.kube.ListIngresses(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingresses: %w", err)
+	}
+	var ingresses []k8s.Ingress
+	for _, ing := range ingressList.Items {
+		if ing.Metadata.DeletionTimestamp == nil && s.handles(&ing) {
+			ingresses = append(ingresses, ing)
+		}
+	}
+
+	serviceList, err := s.kube.ListServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	services := make(map[string]*k8s.Service, len(serviceList.Items))
+	for i := range serviceList.Items {
+		svc := &serviceList.Items[i]
+		services[svc.Metadata.Namespace+"/"+svc.Metadata.Name] = svc
+	}
+
+	t := &translator{kube: s.kube, opts: s.opts, services: services}
+	if s.opts.BackendTarget == BackendTargetNodePort {
+		nodeList, err := s.kube.ListNodes(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list nodes: %w", err)
+		}
+		t.nodes = nodeList.Items
+	}
+
+	return t.translate(ctx, ingresses)
+}
+
+// handles reports whether ing belongs to the configured ingress class
+func (s *Source) handles(ing *k8s.Ingress) bool {
+	if ing.Spec.IngressClassName != nil {
+		return *ing.Spec.IngressClassName == s.opts.IngressClass
+	}
+	return ing.Metadata.Annotations[k8s.AnnotationIngressClass] == s.opts.IngressClass
+}
+
+// Watch calls onChange whenever Ingresses, Services, Nodes or EndpointSlices
+// change, until ctx is cancelled
+func (s *Source) Watch(ctx context.Context, onChange func()) error {
+	w, ok := s.kube.(watcher)
+	if !ok {
+		return fmt.Errorf("kubernetes client does not support watches")
+	}
+	for _, path := range watchedCollections {
+		go w.WatchLoop(ctx, path, onChange)
+	}
+	<-ctx.Done()
+	return nil
+}
@@ -0,0 +1,237 @@
+package ingress
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/k8s"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// fakeKube serves a fixed cluster snapshot
+type fakeKube struct {
+	ingresses []k8s.Ingress
+	services  []k8s.Service
+	nodes     []k8s.Node
+	slices    map[string][]k8s.EndpointSlice // keyed by namespace/service
+}
+
+func (f *fakeKube) ListIngresses(context.Context) (*k8s.IngressList, error) {
+	return &k8s.IngressList{Items: append([]k8s.Ingress(nil), f.ingresses...)}, nil
+}
+
+func (f *fakeKube) ListServices(context.Context) (*k8s.ServiceList, error) {
+	return &k8s.ServiceList{Items: f.services}, nil
+}
+
+func (f *fakeKube) ListNodes(context.Context) (*k8s.NodeList, error) {
+	return &k8s.NodeList{Items: f.nodes}, nil
+}
+
+func (f *fakeKube) ListEndpointSlices(_ context.Context, namespace, service string) (*k8s.EndpointSliceList, error) {
+	return &k8s.EndpointSliceList{Items: f.slices[namespace+"/"+service]}, nil
+}
+
+func strPtr(s string) *string { return &s }
+func intPtr(i int) *int       { return &i }
+func boolPtr(b bool) *bool    { return &b }
+
+func readyNode(name, ip string) k8s.Node {
+	return k8s.Node{
+		Metadata: k8s.ObjectMeta{Name: name},
+		Status: k8s.NodeStatus{
+			Addresses:  []k8s.NodeAddress{{Type: k8s.NodeInternalIP, Address: ip}},
+			Conditions: []k8s.NodeCondition{{Type: k8s.NodeReady, Status: "True"}},
+		},
+	}
+}
+
+func service(ns, name string, ports ...k8s.ServicePort) k8s.Service {
+	return k8s.Service{Metadata: k8s.ObjectMeta{Namespace: ns, Name: name}, Spec: k8s.ServiceSpec{Ports: ports}}
+}
+
+func path(p, pathType, svc string, port k8s.ServiceBackendPort) k8s.HTTPIngressPath {
+	return k8s.HTTPIngressPath{
+		Path:     p,
+		PathType: pathType,
+		Backend:  k8s.IngressBackend{Service: &k8s.IngressServiceBackend{Name: svc, Port: port}},
+	}
+}
+
+func testCluster() *fakeKube {
+	return &fakeKube{
+		services: []k8s.Service{
+			service("shop", "web", k8s.ServicePort{Name: "http", Port: 80, NodePort: 30080}),
+			service("shop", "api", k8s.ServicePort{Name: "http", Port: 8080, NodePort: 30081}),
+			service("shop", "internal", k8s.ServicePort{Name: "http", Port: 80}),
+		},
+		nodes: []k8s.Node{
+			readyNode("node-b", "10.0.0.2"),
+			readyNode("node-a", "10.0.0.1"),
+			{Metadata: k8s.ObjectMeta{Name: "node-c"}, Spec: k8s.NodeSpec{Unschedulable: true}},
+		},
+		ingresses: []k8s.Ingress{
+			{
+				Metadata: k8s.ObjectMeta{Namespace: "shop", Name: "main"},
+				Spec: k8s.IngressSpec{
+					IngressClassName: strPtr("vpsie"),
+					DefaultBackend:   &k8s.IngressBackend{Service: &k8s.IngressServiceBackend{Name: "web", Port: k8s.ServiceBackendPort{Number: 80}}},
+					Rules: []k8s.IngressRule{{
+						Host: "shop.example.com",
+						HTTP: &k8s.HTTPIngressRuleValue{Paths: []k8s.HTTPIngressPath{
+							path("/api", k8s.PathTypePrefix, "api", k8s.ServiceBackendPort{Name: "http"}),
+							path("/healthz", k8s.PathTypeExact, "api", k8s.ServiceBackendPort{Number: 8080}),
+							path("/internal", k8s.PathTypePrefix, "internal", k8s.ServiceBackendPort{Number: 80}),
+							path("/missing", k8s.PathTypePrefix, "missing", k8s.ServiceBackendPort{Number: 80}),
+						}},
+					}},
+				},
+			},
+			{
+				Metadata: k8s.ObjectMeta{Namespace: "other", Name: "ignored"},
+				Spec: k8s.IngressSpec{
+					IngressClassName: strPtr("nginx"),
+					DefaultBackend:   &k8s.IngressBackend{Service: &k8s.IngressServiceBackend{Name: "web", Port: k8s.ServiceBackendPort{Number: 80}}},
+				},
+			},
+		},
+	}
+}
+
+func TestSource_GetLoadBalancerConfig_NodePort(t *testing.T) {
+	src := NewSource(testCluster(), Options{})
+
+	lb, err := src.GetLoadBalancerConfig(context.Background())
+	if err != nil {
+		t.Fatalf("GetLoadBalancerConfig() error = %v", err)
+	}
+
+	if lb.ID != "ingress-vpsie" || lb.Protocol != models.ProtocolHTTP || lb.Port != 80 {
+		t.Errorf("load balancer = %s %s:%d, want ingress-vpsie http:80", lb.ID, lb.Protocol, lb.Port)
+	}
+	if len(lb.Backends) != 2 || lb.Backends[0].Address != "10.0.0.1" || lb.Backends[0].Port != 30080 {
+		t.Errorf("default backends = %+v, want the web node port on both ready nodes", lb.Backends)
+	}
+
+	// The routes to the Service without a node port and to the missing Service are skipped
+	if len(lb.Routes) != 2 {
+		t.Fatalf("routes = %+v, want 2", lb.Routes)
+	}
+	tests := []struct {
+		path      string
+		pathMatch models.PathMatch
+	}{
+		{"/api", models.PathMatchPrefix},
+		{"/healthz", models.PathMatchExact},
+	}
+	for i, tt := range tests {
+		route := lb.Routes[i]
+		if route.Path != tt.path || route.PathMatch != tt.pathMatch || route.Pool != "shop-api-8080" {
+			t.Errorf("route %d = %+v, want %s (%s) to shop-api-8080", i, route, tt.path, tt.pathMatch)
+		}
+		if len(route.Hosts) != 1 || route.Hosts[0] != "shop.example.com" {
+			t.Errorf("route %d hosts = %v, want [shop.example.com]", i, route.Hosts)
+		}
+	}
+
+	if len(lb.Pools) != 1 || lb.Pools[0].Name != "shop-api-8080" || len(lb.Pools[0].Backends) != 2 {
+		t.Errorf("pools = %+v, want only shop-api-8080 with 2 backends", lb.Pools)
+	}
+}
+
+func TestSource_GetLoadBalancerConfig_Pod(t *testing.T) {
+	kube := testCluster()
+	kube.slices = map[string][]k8s.EndpointSlice{
+		"shop/api": {{
+			Ports: []k8s.EndpointPort{{Name: strPtr("http"), Port: intPtr(9000)}},
+			Endpoints: []k8s.Endpoint{
+				{Addresses: []string{"192.168.1.10"}, Conditions: k8s.EndpointConditions{Ready: boolPtr(true)}},
+				{Addresses: []string{"192.168.1.11"}, Conditions: k8s.EndpointConditions{Ready: boolPtr(false)}},
+			},
+		}},
+		"shop/internal": {{
+			Ports:     []k8s.EndpointPort{{Name: strPtr("http"), Port: intPtr(8000)}},
+			Endpoints: []k8s.Endpoint{{Addresses: []string{"192.168.1.20"}}},
+		}},
+	}
+
+	lb, err := NewSource(kube, Options{BackendTarget: BackendTargetPod, Port: 8080}).GetLoadBalancerConfig(context.Background())
+	if err != nil {
+		t.Fatalf("GetLoadBalancerConfig() error = %v", err)
+	}
+
+	// web has no endpoints, so there is no default backend
+	if len(lb.Backends) != 0 {
+		t.Errorf("default backends = %+v, want none", lb.Backends)
+	}
+	if len(lb.Routes) != 3 {
+		t.Fatalf("routes = %+v, want 3", lb.Routes)
+	}
+
+	pools := make(map[string][]models.Backend)
+	for _, pool := range lb.Pools {
+		pools[pool.Name] = pool.Backends
+	}
+	if got := pools["shop-api-8080"]; len(got) != 1 || got[0].Address != "192.168.1.10" || got[0].Port != 9000 {
+		t.Errorf("shop-api-8080 backends = %+v, want only the ready pod on 9000", got)
+	}
+	if got := pools["shop-internal-80"]; len(got) != 1 || got[0].Port != 8000 {
+		t.Errorf("shop-internal-80 backends = %+v, want the pod on 8000", got)
+	}
+}
+
+func TestSource_GetLoadBalancerConfig_NoUsableIngress(t *testing.T) {
+	kube := testCluster()
+	kube.ingresses = kube.ingresses[1:]
+
+	if _, err := NewSource(kube, Options{}).GetLoadBalancerConfig(context.Background()); err == nil {
+		t.Error("GetLoadBalancerConfig() error = nil, want error when no Ingress matches the class")
+	}
+}
+
+func TestSource_LegacyClassAnnotation(t *testing.T) {
+	src := NewSource(&fakeKube{}, Options{IngressClass: "public"})
+
+	tests := []struct {
+		name string
+		ing  k8s.Ingress
+		want bool
+	}{
+		{"class name", k8s.Ingress{Spec: k8s.IngressSpec{IngressClassName: strPtr("public")}}, true},
+		{"other class name", k8s.Ingress{Spec: k8s.IngressSpec{IngressClassName: strPtr("nginx")}}, false},
+		{"annotation", k8s.Ingress{Metadata: k8s.ObjectMeta{Annotations: map[string]string{k8s.AnnotationIngressClass: "public"}}}, true},
+		{"no class", k8s.Ingress{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := src.handles(&tt.ing); got != tt.want {
+				t.Errorf("handles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []string
+		want  string
+	}{
+		{"simple", []string{"shop", "api", "80"}, "shop-api-80"},
+		{"dots", []string{"shop", "api.v2", "80"}, "shop-api-v2-80"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := identifier(tt.parts...); got != tt.want {
+				t.Errorf("identifier() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	long := identifier(strings.Repeat("a", 63), strings.Repeat("b", 63), "80")
+	other := identifier(strings.Repeat("a", 63), strings.Repeat("b", 63), "81")
+	if len(long) != maxIdentifierLength || long == other {
+		t.Errorf("identifier() of long names = %q and %q, want distinct %d-character names", long, other, maxIdentifierLength)
+	}
+}
@@ -0,0 +1,287 @@
+package ingress
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/k8s"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// maxIdentifierLength is the longest pool or route name the models accept
+const maxIdentifierLength = 64
+
+// translator builds one load balancer from a snapshot of the cluster state
+type translator struct {
+	kube     KubernetesAPI
+	opts     Options
+	services map[string]*k8s.Service // keyed by namespace/name
+	nodes    []k8s.Node
+	pools    map[string]*models.BackendPool
+}
+
+// translate converts the Ingresses into a load balancer with one backend pool
+// per referenced Service port and one route per Ingress path. Paths whose
+// backend cannot be resolved or has no ready endpoints are skipped with a
+// warning so a single broken Ingress does not take down the others.
+func (t *translator) translate(ctx context.Context, ingresses []k8s.Ingress) (*models.LoadBalancer, error) {
+	t.pools = make(map[string]*models.BackendPool)
+
+	// Process Ingresses in a stable order so the generated configuration,
+	// and the default backend when several Ingresses set one, is deterministic
+	sort.Slice(ingresses, func(i, j int) bool {
+		a, b := ingresses[i].Metadata, ingresses[j].Metadata
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	lb := &models.LoadBalancer{
+		ID:        t.opts.LoadBalancerID,
+		Name:      t.opts.LoadBalancerID,
+		Protocol:  models.ProtocolHTTP,
+		Algorithm: models.AlgoRoundRobin,
+		Port:      t.opts.Port,
+		HealthCheck: &models.HealthCheck{
+			Type:               models.HealthCheckTCP,
+			Interval:           10,
+			Timeout:            5,
+			UnhealthyThreshold: 3,
+			HealthyThreshold:   2,
+		},
+	}
+
+	for i := range ingresses {
+		ing := &ingresses[i]
+		ns, name := ing.Metadata.Namespace, ing.Metadata.Name
+		if len(ing.Spec.TLS) > 0 {
+			log.Printf("Warning: Ingress %s/%s: TLS is not supported yet, serving plain HTTP", ns, name)
+		}
+
+		if ing.Spec.DefaultBackend != nil && len(lb.Backends) == 0 {
+			pool, err := t.pool(ctx, ns, ing.Spec.DefaultBackend)
+			if err != nil {
+				log.Printf("Warning: Ingress %s/%s: skipping default backend: %v", ns, name, err)
+			} else {
+				lb.Backends = pool.Backends
+			}
+		}
+
+		for r, rule := range ing.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for p, path := range rule.HTTP.Paths {
+				route, err := t.route(ctx, ns, rule.Host, path)
+				if err != nil {
+					log.Printf("Warning: Ingress %s/%s: skipping rule %d path %q: %v", ns, name, r, path.Path, err)
+					continue
+				}
+				route.Name = identifier(ns, name, strconv.Itoa(r), strconv.Itoa(p))
+				lb.Routes = append(lb.Routes, *route)
+			}
+		}
+	}
+
+	// Only pools used by a route become clusters; the default backend is
+	// served from the load balancer's own backends
+	used := make(map[string]bool)
+	for _, route := range lb.Routes {
+		if !used[route.Pool] {
+			used[route.Pool] = true
+			lb.Pools = append(lb.Pools, *t.pools[route.Pool])
+		}
+	}
+	sort.Slice(lb.Pools, func(i, j int) bool { return lb.Pools[i].Name < lb.Pools[j].Name })
+
+	if len(lb.Routes) == 0 && len(lb.Backends) == 0 {
+		return nil, fmt.Errorf("no Ingress of class %q has a usable backend", t.opts.IngressClass)
+	}
+	if err := lb.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid load balancer: %w", err)
+	}
+	return lb, nil
+}
+
+// route translates one Ingress path
+func (t *translator) route(ctx context.Context, namespace, host string, path k8s.HTTPIngressPath) (*models.Route, error) {
+	route := &models.Route{Path: path.Path, PathMatch: models.PathMatchPrefix}
+	if route.Path == "" {
+		route.Path = "/"
+	}
+	if path.PathType == k8s.PathTypeExact {
+		route.PathMatch = models.PathMatchExact
+	}
+	if host != "" {
+		route.Hosts = []string{host}
+	}
+
+	pool, err := t.pool(ctx, namespace, &path.Backend)
+	if err != nil {
+		return nil, err
+	}
+	route.Pool = pool.Name
+
+	// Check the route on its own; the name is assigned by the caller
+	check := *route
+	check.Name = "check"
+	if err := check.Validate(); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// pool returns the backend pool of a Service port, resolving it on first use
+func (t *translator) pool(ctx context.Context, namespace string, backend *k8s.IngressBackend) (*models.BackendPool, error) {
+	if backend.Service == nil {
+		return nil, fmt.Errorf("only Service backends are supported")
+	}
+	ref := backend.Service
+	svc, ok := t.services[namespace+"/"+ref.Name]
+	if !ok {
+		return nil, fmt.Errorf("service %s/%s not found", namespace, ref.Name)
+	}
+
+	port, err := servicePort(svc, ref.Port)
+	if err != nil {
+		return nil, err
+	}
+
+	name := identifier(namespace, ref.Name, strconv.Itoa(port.Port))
+	if pool, ok := t.pools[name]; ok {
+		return pool, nil
+	}
+
+	var backends []models.Backend
+	switch t.opts.BackendTarget {
+	case BackendTargetPod:
+		backends, err = t.podBackends(ctx, svc, port)
+	default:
+		backends, err = t.nodePortBackends(port)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("service %s/%s port %d has no ready backends", namespace, ref.Name, port.Port)
+	}
+
+	pool := &models.BackendPool{Name: name, Backends: backends}
+	t.pools[name] = pool
+	return pool, nil
+}
+
+// servicePort finds the Service port an Ingress backend refers to
+func servicePort(svc *k8s.Service, ref k8s.ServiceBackendPort) (*k8s.ServicePort, error) {
+	for i := range svc.Spec.Ports {
+		port := &svc.Spec.Ports[i]
+		if (ref.Name != "" && port.Name == ref.Name) || (ref.Name == "" && port.Port == ref.Number) {
+			return port, nil
+		}
+	}
+	if ref.Name != "" {
+		return nil, fmt.Errorf("service %s/%s has no port named %q", svc.Metadata.Namespace, svc.Metadata.Name, ref.Name)
+	}
+	return nil, fmt.Errorf("service %s/%s has no port %d", svc.Metadata.Namespace, svc.Metadata.Name, ref.Number)
+}
+
+// nodePortBackends targets the Service's node port on every ready, schedulable node
+func (t *translator) nodePortBackends(port *k8s.ServicePort) ([]models.Backend, error) {
+	if port.NodePort == 0 {
+		return nil, fmt.Errorf("port %d has no node port; use a NodePort or LoadBalancer Service, or backend_target %q",
+			port.Port, BackendTargetPod)
+	}
+
+	var backends []models.Backend
+	for i := range t.nodes {
+		node := &t.nodes[i]
+		if node.Spec.Unschedulable || !node.IsReady() || node.InternalIP() == "" {
+			continue
+		}
+		backends = append(backends, models.Backend{
+			ID:      "node-" + strings.ReplaceAll(node.Metadata.Name, ".", "-"),
+			Address: node.InternalIP(),
+			Port:    port.NodePort,
+			Weight:  1,
+			Enabled: true,
+		})
+	}
+	sort.Slice(backends, func(i, j int) bool { return backends[i].ID < backends[j].ID })
+	return backends, nil
+}
+
+// podBackends targets the ready pod endpoints of the Service port directly.
+// This requires the pod network to be routable from the load balancer.
+func (t *translator) podBackends(ctx context.Context, svc *k8s.Service, port *k8s.ServicePort) ([]models.Backend, error) {
+	slices, err := t.kube.ListEndpointSlices(ctx, svc.Metadata.Namespace, svc.Metadata.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list endpoint slices: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var backends []models.Backend
+	for _, slice := range slices.Items {
+		target := 0
+		for _, p := range slice.Ports {
+			name := ""
+			if p.Name != nil {
+				name = *p.Name
+			}
+			if name == port.Name && p.Port != nil {
+				target = *p.Port
+			}
+		}
+		if target == 0 {
+			continue
+		}
+
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			for _, addr := range ep.Addresses {
+				key := addr + ":" + strconv.Itoa(target)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				backends = append(backends, models.Backend{
+					ID:      identifier("pod", strings.NewReplacer(".", "-", ":", "-").Replace(addr), strconv.Itoa(target)),
+					Address: addr,
+					Port:    target,
+					Weight:  1,
+					Enabled: true,
+				})
+			}
+		}
+	}
+	sort.Slice(backends, func(i, j int) bool { return backends[i].ID < backends[j].ID })
+	return backends, nil
+}
+
+// identifier joins parts into a name accepted by the models. Characters that
+// are not allowed become "-"; names that are too long are shortened and made
+// unique with a hash suffix.
+func identifier(parts ...string) string {
+	joined := strings.Join(parts, "-")
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, joined)
+	if len(name) <= maxIdentifierLength {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(joined))
+	suffix := hex.EncodeToString(sum[:])[:8]
+	return name[:maxIdentifierLength-len(suffix)-1] + "-" + suffix
+}
@@ -0,0 +1,280 @@
+package ipvs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/proxy"
+)
+
+// idleInterval is how often Run looks for health checks to run when the
+// rules have none
+const idleInterval = 5 * time.Second
+
+// driverFeatures lists what the driver lacks besides what IPVS lacks: it
+// checks real servers by opening TCP connections only
+var driverFeatures = []proxy.Feature{
+	{Name: "http health checks", Used: func(lb *models.LoadBalancer) bool {
+		return lb.HealthCheck != nil && lb.HealthCheck.IsHTTPBased()
+	}},
+}
+
+// Rules is the configuration file of the driver: the virtual services of a
+// load balancer, and how their real servers are health checked
+type Rules struct {
+	Services    []Service    `json:"services"`
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+}
+
+// HealthCheck opens a TCP connection to every real server each interval
+type HealthCheck struct {
+	Interval           int `json:"interval"` // seconds
+	Timeout            int `json:"timeout"`  // seconds
+	HealthyThreshold   int `json:"healthy_threshold"`
+	UnhealthyThreshold int `json:"unhealthy_threshold"`
+}
+
+// hostHealth is the health check state of one real server
+type hostHealth struct {
+	failing   bool
+	successes int // consecutive
+	failures  int // consecutive
+}
+
+// Driver serves load balancers with IPVS alone, as an alternative to Envoy.
+// Its configuration file holds the rules as JSON; the driver health checks
+// the real servers itself, since IPVS does not.
+type Driver struct {
+	configPath string
+	ipvs       *IPVS
+	dial       func(ctx context.Context, network, address string) (net.Conn, error)
+
+	mu     sync.Mutex
+	rules  Rules
+	health map[string]*hostHealth // by host:port
+}
+
+// NewDriver creates an IPVS driver writing configPath and programming the
+// kernel with the ipvsadm binary and forwarding method
+func NewDriver(binary, configPath string, method Method) *Driver {
+	dialer := &net.Dialer{}
+	return &Driver{
+		configPath: configPath,
+		ipvs:       &IPVS{method: method, binary: binary, runner: execRunner{}},
+		dial:       dialer.DialContext,
+		health:     make(map[string]*hostHealth),
+	}
+}
+
+// IPVS returns the IPVS the driver programs
+func (d *Driver) IPVS() *IPVS {
+	return d.ipvs
+}
+
+// Name returns the name of the driver
+func (d *Driver) Name() string {
+	return Name
+}
+
+// ConfigPath returns the rules file of the driver
+func (d *Driver) ConfigPath() string {
+	return d.configPath
+}
+
+// Generate returns the rules serving lb, or a *proxy.UnsupportedError when
+// lb uses features the driver cannot provide
+func (d *Driver) Generate(lb *models.LoadBalancer) ([]byte, error) {
+	services, err := Services(lb, d.ipvs.method, driverFeatures...)
+	if err != nil {
+		return nil, err
+	}
+	rules := Rules{Services: services}
+	if hc := lb.HealthCheck; hc != nil {
+		rules.HealthCheck = &HealthCheck{
+			Interval:           hc.Interval,
+			Timeout:            hc.Timeout,
+			HealthyThreshold:   hc.HealthyThreshold,
+			UnhealthyThreshold: hc.UnhealthyThreshold,
+		}
+	}
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Validate checks a rules file
+func (d *Driver) Validate(_ context.Context, path string) error {
+	_, err := readRules(path)
+	return err
+}
+
+// Reload programs IPVS with the rules file. Real servers keep their health
+// across reloads.
+func (d *Driver) Reload(ctx context.Context) error {
+	rules, err := readRules(d.configPath)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.rules = rules
+	current := make(map[string]*hostHealth)
+	for _, s := range rules.Services {
+		for _, r := range s.Reals {
+			if h := d.health[r.HostPort()]; h != nil {
+				current[r.HostPort()] = h
+			}
+		}
+	}
+	d.health = current
+	d.mu.Unlock()
+	return d.apply(ctx)
+}
+
+// apply programs IPVS with the current rules and health
+func (d *Driver) apply(ctx context.Context) error {
+	d.mu.Lock()
+	services := d.rules.Services
+	failing := make(map[string]bool)
+	for hostPort, h := range d.health {
+		failing[hostPort] = h.failing
+	}
+	d.mu.Unlock()
+	return d.ipvs.Apply(ctx, services, func(hostPort string) bool { return failing[hostPort] })
+}
+
+// Run health checks the real servers until ctx is cancelled and takes
+// failing ones out of IPVS. The rules file is applied first, so the
+// services are back under watch when the agent restarts.
+func (d *Driver) Run(ctx context.Context) {
+	if err := d.Reload(ctx); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Warning: Failed to apply the IPVS rules: %v", err)
+	}
+	timer := time.NewTimer(d.interval())
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			if d.check(ctx) {
+				if err := d.apply(ctx); err != nil {
+					log.Printf("Warning: Failed to apply backend health to IPVS: %v", err)
+				}
+			}
+			timer.Reset(d.interval())
+		}
+	}
+}
+
+// interval returns the time until the next health check
+func (d *Driver) interval() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if hc := d.rules.HealthCheck; hc != nil && hc.Interval > 0 {
+		return time.Duration(hc.Interval) * time.Second
+	}
+	return idleInterval
+}
+
+// check connects to every real server once and reports whether a real
+// server failed or recovered. Real servers start healthy.
+func (d *Driver) check(ctx context.Context) bool {
+	d.mu.Lock()
+	hc := d.rules.HealthCheck
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, s := range d.rules.Services {
+		for _, r := range s.Reals {
+			if !seen[r.HostPort()] {
+				seen[r.HostPort()] = true
+				hosts = append(hosts, r.HostPort())
+			}
+		}
+	}
+	d.mu.Unlock()
+	if hc == nil {
+		return false
+	}
+
+	up := make([]bool, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dialCtx, cancel := context.WithTimeout(ctx, time.Duration(hc.Timeout)*time.Second)
+			defer cancel()
+			if conn, err := d.dial(dialCtx, "tcp", host); err == nil {
+				_ = conn.Close()
+				up[i] = true
+			}
+		}()
+	}
+	wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	changed := false
+	for i, host := range hosts {
+		h := d.health[host]
+		if h == nil {
+			h = &hostHealth{}
+			d.health[host] = h
+		}
+		if up[i] {
+			h.successes, h.failures = h.successes+1, 0
+			if h.failing && h.successes >= hc.HealthyThreshold {
+				h.failing, changed = false, true
+				log.Printf("IPVS real server %s is healthy", host)
+			}
+			continue
+		}
+		h.successes, h.failures = 0, h.failures+1
+		if !h.failing && h.failures >= hc.UnhealthyThreshold {
+			h.failing, changed = true, true
+			log.Printf("IPVS real server %s is unhealthy", host)
+		}
+	}
+	return changed
+}
+
+// readRules reads and checks a rules file
+func readRules(path string) (Rules, error) {
+	var rules Rules
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rules, err
+	}
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return rules, fmt.Errorf("invalid IPVS rules %s: %w", path, err)
+	}
+	for _, s := range rules.Services {
+		if net.ParseIP(s.Address) == nil || !validPort(s.Port) || s.Scheduler == "" {
+			return rules, fmt.Errorf("invalid IPVS rules %s: service %s:%d", path, s.Address, s.Port)
+		}
+		for _, r := range s.Reals {
+			if net.ParseIP(r.Address) == nil || !validPort(r.Port) || r.Weight < 0 {
+				return rules, fmt.Errorf("invalid IPVS rules %s: real server %s of %s:%d", path, r.HostPort(), s.Address, s.Port)
+			}
+		}
+	}
+	if hc := rules.HealthCheck; hc != nil && (hc.Interval <= 0 || hc.Timeout <= 0 || hc.HealthyThreshold <= 0 || hc.UnhealthyThreshold <= 0) {
+		return rules, fmt.Errorf("invalid IPVS rules %s: health check", path)
+	}
+	return rules, nil
+}
+
+// validPort reports whether port is a TCP port
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
@@ -0,0 +1,137 @@
+package ipvs
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/proxy"
+)
+
+// testDriver returns a driver writing to a temporary directory, with a fake
+// ipvsadm and connections to the hosts in down refused
+func testDriver(t *testing.T, down map[string]bool) (*Driver, *fakeRunner) {
+	t.Helper()
+	runner := &fakeRunner{}
+	d := NewDriver("ipvsadm", filepath.Join(t.TempDir(), "ipvs.json"), MethodNAT)
+	d.ipvs.runner = runner
+	d.dial = func(_ context.Context, _, address string) (net.Conn, error) {
+		if down[address] {
+			return nil, errors.New("connection refused")
+		}
+		client, server := net.Pipe()
+		_ = server.Close()
+		return client, nil
+	}
+	return d, runner
+}
+
+func TestDriver_GenerateAndReload(t *testing.T) {
+	d, runner := testDriver(t, nil)
+	lb := testLB()
+	lb.HealthCheck = &models.HealthCheck{Type: models.HealthCheckTCP, Interval: 5, Timeout: 2, HealthyThreshold: 2, UnhealthyThreshold: 3}
+
+	data, err := d.Generate(lb)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if err := os.WriteFile(d.ConfigPath(), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Validate(context.Background(), d.ConfigPath()); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if err := d.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	want := "-A -t 10.0.0.1:5432 -s wlc\n" +
+		"-a -t 10.0.0.1:5432 -r 192.168.1.10:5432 -m -w 2 -x 500\n" +
+		"-a -t 10.0.0.1:5432 -r 192.168.1.11:5432 -m -w 1 -x 500\n" +
+		"-a -t 10.0.0.1:5432 -r 192.168.1.12:5432 -m -w 0 -x 500\n"
+	if len(runner.calls) != 2 || runner.calls[1].stdin != want {
+		t.Errorf("calls = %+v, want the rules programmed", runner.calls)
+	}
+}
+
+func TestDriver_GenerateUnsupported(t *testing.T) {
+	d, _ := testDriver(t, nil)
+	lb := testLB()
+	lb.HealthCheck = &models.HealthCheck{Type: models.HealthCheckHTTP, Path: "/health", Interval: 5, Timeout: 2, HealthyThreshold: 2, UnhealthyThreshold: 3}
+
+	_, err := d.Generate(lb)
+	var unsupported *proxy.UnsupportedError
+	if !errors.As(err, &unsupported) || unsupported.Features[0] != "http health checks" {
+		t.Errorf("Generate() error = %v, want http health checks unsupported", err)
+	}
+}
+
+func TestDriver_ValidateRejects(t *testing.T) {
+	d, _ := testDriver(t, nil)
+	path := filepath.Join(t.TempDir(), "ipvs.json")
+	for _, rules := range []string{
+		`{"services": [`,
+		`{"services": [{"address": "lb.example.com", "port": 80, "scheduler": "wrr"}]}`,
+		`{"services": [{"address": "10.0.0.1", "port": 80, "scheduler": "wrr", "reals": [{"address": "10.0.1.1", "port": 0, "weight": 1}]}]}`,
+		`{"services": [], "health_check": {"interval": 0, "timeout": 1, "healthy_threshold": 1, "unhealthy_threshold": 1}}`,
+	} {
+		if err := os.WriteFile(path, []byte(rules), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Validate(context.Background(), path); err == nil {
+			t.Errorf("Validate(%s) accepted invalid rules", rules)
+		}
+	}
+}
+
+func TestDriver_Check(t *testing.T) {
+	down := map[string]bool{}
+	d, _ := testDriver(t, down)
+	d.rules = Rules{
+		Services: []Service{{Address: "10.0.0.1", Port: 5432, Scheduler: "wrr", Reals: []Real{
+			{Address: "192.168.1.10", Port: 5432, Weight: 1},
+		}}},
+		HealthCheck: &HealthCheck{Interval: 1, Timeout: 1, HealthyThreshold: 2, UnhealthyThreshold: 2},
+	}
+	ctx := context.Background()
+
+	// Failures and recoveries count only once the thresholds are reached
+	steps := []struct {
+		down    bool
+		changed bool
+	}{
+		{false, false},
+		{true, false},
+		{true, true},
+		{true, false},
+		{false, false},
+		{false, true},
+	}
+	for i, step := range steps {
+		down["192.168.1.10:5432"] = step.down
+		if changed := d.check(ctx); changed != step.changed {
+			t.Fatalf("step %d: check() = %v, want %v", i, changed, step.changed)
+		}
+	}
+	if d.health["192.168.1.10:5432"].failing {
+		t.Error("real server still failing after recovering")
+	}
+}
+
+func TestDriver_RunWithoutRules(t *testing.T) {
+	d, runner := testDriver(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A missing rules file is not an error: nothing was applied yet
+	d.Run(ctx)
+	for _, c := range runner.calls {
+		if strings.HasSuffix(c.args, "-R") {
+			t.Errorf("Run() programmed IPVS without rules: %+v", c)
+		}
+	}
+}
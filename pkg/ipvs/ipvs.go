@@ -0,0 +1,287 @@
+// Package ipvs programs the kernel's IP Virtual Server with ipvsadm, so the
+// kernel forwards the connections of plain TCP load balancers to the
+// backends without copying them through a proxy. It serves as the fast path
+// in front of Envoy, driven by Envoy's backend health, and as a proxy
+// driver of its own that health checks the backends itself.
+//
+// Only the virtual services the load balancer asks for are touched; other
+// virtual services on the host are left alone. The rules are reconciled
+// rather than replaced, so established connections survive every change.
+package ipvs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Name is the name of the fast path in unsupported feature errors
+const Name = "ipvs"
+
+// Method is how IPVS forwards packets to the real servers
+type Method string
+
+const (
+	// MethodNAT rewrites the destination; replies must be routed back
+	// through the load balancer
+	MethodNAT Method = "nat"
+	// MethodDirect rewrites the MAC address; real servers must share the
+	// network of the load balancer and accept the virtual address
+	MethodDirect Method = "dr"
+	// MethodTunnel encapsulates packets in IPIP; real servers must
+	// decapsulate them and accept the virtual address
+	MethodTunnel Method = "tunnel"
+)
+
+// methodFlags maps forwarding methods to the ipvsadm flags
+var methodFlags = map[Method]string{
+	MethodNAT:    "-m",
+	MethodDirect: "-g",
+	MethodTunnel: "-i",
+}
+
+// Methods lists the supported forwarding methods
+var Methods = []Method{MethodNAT, MethodDirect, MethodTunnel}
+
+// Service is a TCP virtual service and its real servers
+type Service struct {
+	Address        string `json:"address"`
+	Port           int    `json:"port"`
+	Scheduler      string `json:"scheduler"`                 // ipvsadm scheduler: wrr, wlc or sh
+	MaxConnections int    `json:"max_connections,omitempty"` // split across the real servers receiving connections, 0 = unlimited
+	Reals          []Real `json:"reals"`
+}
+
+// Real is a real server of a virtual service
+type Real struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	Weight  int    `json:"weight"`
+	Backup  bool   `json:"backup,omitempty"` // only gets connections while every other real server is failing
+}
+
+// HostPort returns the address of the real server as host:port
+func (r Real) HostPort() string {
+	return hostPort(r.Address, r.Port)
+}
+
+// Runner runs an ipvsadm command with stdin and returns its output
+type Runner interface {
+	Run(ctx context.Context, stdin string, name string, args ...string) (string, error)
+}
+
+// execRunner runs commands on the host
+type execRunner struct{}
+
+func (execRunner) Run(ctx context.Context, stdin string, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// IPVS programs virtual services with one forwarding method
+type IPVS struct {
+	method Method
+	binary string
+	runner Runner
+
+	mu      sync.Mutex
+	managed []string // virtual services last applied, host:port
+}
+
+// New creates an IPVS programming the host's kernel
+func New(method Method) (*IPVS, error) {
+	return NewWithRunner(method, execRunner{})
+}
+
+// NewWithRunner creates an IPVS running its commands with runner
+func NewWithRunner(method Method, runner Runner) (*IPVS, error) {
+	if _, ok := methodFlags[method]; !ok {
+		return nil, fmt.Errorf("unknown IPVS forwarding method %q", method)
+	}
+	return &IPVS{method: method, binary: "ipvsadm", runner: runner}, nil
+}
+
+// Apply makes services the virtual services of the load balancer. Real
+// servers for which failing returns true get no new connections; failing
+// receives host:port and may be nil. Services applied before and no longer
+// wanted are removed, nil removes them all. Nothing is run when the kernel
+// already matches.
+func (v *IPVS) Apply(ctx context.Context, services []Service, failing func(hostPort string) bool) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	out, err := v.runner.Run(ctx, "", v.binary, "-S", "-n")
+	if err != nil {
+		return fmt.Errorf("failed to list IPVS services: %w", err)
+	}
+	script := v.changes(parseRules(out), services, failing)
+	if script != "" {
+		if _, err := v.runner.Run(ctx, script, v.binary, "-R"); err != nil {
+			return fmt.Errorf("failed to program IPVS services: %w", err)
+		}
+	}
+
+	v.managed = v.managed[:0]
+	for _, s := range services {
+		v.managed = append(v.managed, hostPort(s.Address, s.Port))
+	}
+	return nil
+}
+
+// rule is a virtual service as listed by ipvsadm -S
+type rule struct {
+	scheduler string
+	reals     map[string]string // host:port to the options of the real server
+}
+
+// programmed returns the options of the real servers of s as programmed,
+// by host:port. Failing real servers, and backups while another real server
+// is up, get weight 0; the others share the connection limit.
+func (v *IPVS) programmed(s Service, failing func(string) bool) ([]string, map[string]string) {
+	down := func(r Real) bool { return failing != nil && failing(r.HostPort()) }
+	primaryUp := slices.ContainsFunc(s.Reals, func(r Real) bool { return !r.Backup && !down(r) })
+
+	weights := make([]int, len(s.Reals))
+	active := 0
+	for i, r := range s.Reals {
+		if !down(r) && (!r.Backup || !primaryUp) {
+			weights[i] = r.Weight
+			active++
+		}
+	}
+	threshold := 0
+	if s.MaxConnections > 0 && active > 0 {
+		threshold = (s.MaxConnections + active - 1) / active
+	}
+
+	servers := make([]string, 0, len(s.Reals))
+	options := make(map[string]string, len(s.Reals))
+	for i, r := range s.Reals {
+		server := hostPort(r.Address, r.Port)
+		servers = append(servers, server)
+		options[server] = fmt.Sprintf("%s -w %d", methodFlags[v.method], weights[i])
+		if threshold > 0 {
+			options[server] += fmt.Sprintf(" -x %d", threshold)
+		}
+	}
+	return servers, options
+}
+
+// changes returns the ipvsadm -R input turning current into services. Each
+// line holds the arguments of one ipvsadm command.
+func (v *IPVS) changes(current map[string]*rule, services []Service, failing func(string) bool) string {
+	var b strings.Builder
+	wanted := make(map[string]bool, len(services))
+	for _, s := range services {
+		service := hostPort(s.Address, s.Port)
+		wanted[service] = true
+		cur := current[service]
+		switch {
+		case cur == nil:
+			fmt.Fprintf(&b, "-A -t %s -s %s\n", service, s.Scheduler)
+			cur = &rule{}
+		case cur.scheduler != s.Scheduler:
+			fmt.Fprintf(&b, "-E -t %s -s %s\n", service, s.Scheduler)
+		}
+
+		servers, options := v.programmed(s, failing)
+		for _, server := range servers {
+			previous, ok := cur.reals[server]
+			switch {
+			case !ok:
+				fmt.Fprintf(&b, "-a -t %s -r %s %s\n", service, server, options[server])
+			case previous != options[server]:
+				fmt.Fprintf(&b, "-e -t %s -r %s %s\n", service, server, options[server])
+			}
+		}
+		for _, server := range slices.Sorted(maps.Keys(cur.reals)) {
+			if _, ok := options[server]; !ok {
+				fmt.Fprintf(&b, "-d -t %s -r %s\n", service, server)
+			}
+		}
+	}
+
+	for _, service := range v.managed {
+		if !wanted[service] && current[service] != nil {
+			fmt.Fprintf(&b, "-D -t %s\n", service)
+		}
+	}
+	return b.String()
+}
+
+// parseRules reads the TCP virtual services listed by ipvsadm -S -n
+func parseRules(out string) map[string]*rule {
+	rules := make(map[string]*rule)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != "-t" {
+			continue
+		}
+		service := normalize(fields[2])
+		switch fields[0] {
+		case "-A":
+			rules[service] = &rule{scheduler: option(fields, "-s"), reals: make(map[string]string)}
+		case "-a":
+			r := rules[service]
+			if r == nil {
+				continue
+			}
+			var options []string
+			for _, flag := range []string{"-m", "-g", "-i"} {
+				if slices.Contains(fields, flag) {
+					options = append(options, flag)
+				}
+			}
+			options = append(options, "-w", option(fields, "-w"))
+			if x := option(fields, "-x"); x != "" && x != "0" {
+				options = append(options, "-x", x)
+			}
+			r.reals[normalize(option(fields, "-r"))] = strings.Join(options, " ")
+		}
+	}
+	return rules
+}
+
+// option returns the value following flag in fields
+func option(fields []string, flag string) string {
+	i := slices.Index(fields, flag)
+	if i < 0 || i+1 >= len(fields) {
+		return ""
+	}
+	return fields[i+1]
+}
+
+// hostPort returns an address and port as ipvsadm -n lists them
+func hostPort(addr string, port int) string {
+	if ip := net.ParseIP(addr); ip != nil {
+		addr = ip.String()
+	}
+	return net.JoinHostPort(addr, strconv.Itoa(port))
+}
+
+// normalize returns a host:port listed by ipvsadm in the form of hostPort
+func normalize(s string) string {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return s
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return s
+	}
+	return hostPort(host, n)
+}
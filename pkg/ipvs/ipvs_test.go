@@ -0,0 +1,132 @@
+package ipvs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// call is one command run by the fake runner
+type call struct {
+	stdin string
+	args  string // command and arguments joined by spaces
+}
+
+// fakeRunner records commands, lists rules and fails ipvsadm -R on demand
+type fakeRunner struct {
+	calls   []call
+	rules   string // output of ipvsadm -S -n
+	restore error
+}
+
+func (r *fakeRunner) Run(_ context.Context, stdin string, name string, args ...string) (string, error) {
+	line := strings.Join(append([]string{name}, args...), " ")
+	r.calls = append(r.calls, call{stdin: stdin, args: line})
+	if line == "ipvsadm -R" {
+		return "", r.restore
+	}
+	return r.rules, nil
+}
+
+func TestIPVS_Apply(t *testing.T) {
+	runner := &fakeRunner{}
+	v, err := NewWithRunner(MethodNAT, runner)
+	if err != nil {
+		t.Fatalf("NewWithRunner() error = %v", err)
+	}
+
+	services := []Service{{Address: "10.0.0.1", Port: 5432, Scheduler: "wrr", Reals: []Real{
+		{Address: "192.168.1.10", Port: 5432, Weight: 1},
+		{Address: "192.168.1.11", Port: 5432, Weight: 3, Backup: true},
+	}}}
+	if err := v.Apply(context.Background(), services, nil); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	want := "-A -t 10.0.0.1:5432 -s wrr\n" +
+		"-a -t 10.0.0.1:5432 -r 192.168.1.10:5432 -m -w 1\n" +
+		"-a -t 10.0.0.1:5432 -r 192.168.1.11:5432 -m -w 0\n"
+	if len(runner.calls) != 2 || runner.calls[1].stdin != want {
+		t.Fatalf("calls = %+v, want the service and its reals added", runner.calls)
+	}
+
+	// Only what differs is changed: the backup takes over from the failing
+	// primary with the whole connection limit, and a real that is no longer
+	// wanted goes
+	runner.calls = nil
+	runner.rules = "-A -t 10.0.0.1:5432 -s wrr\n" +
+		"-a -t 10.0.0.1:5432 -r 192.168.1.10:5432 -m -w 0 -x 500\n" +
+		"-a -t 10.0.0.1:5432 -r 192.168.1.11:5432 -m -w 0\n" +
+		"-a -t 10.0.0.1:5432 -r 192.168.1.12:5432 -m -w 1\n" +
+		"-A -t 10.0.0.9:80 -s rr\n"
+	services[0].MaxConnections = 500
+	failing := func(hostPort string) bool { return hostPort == "192.168.1.10:5432" }
+	if err := v.Apply(context.Background(), services, failing); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	want = "-e -t 10.0.0.1:5432 -r 192.168.1.11:5432 -m -w 3 -x 500\n" +
+		"-d -t 10.0.0.1:5432 -r 192.168.1.12:5432\n"
+	if len(runner.calls) != 2 || runner.calls[1].stdin != want {
+		t.Fatalf("calls = %+v, want only the changes", runner.calls)
+	}
+
+	// Nothing runs when the kernel matches
+	runner.calls = nil
+	runner.rules = "-A -t 10.0.0.1:5432 -s wrr\n" +
+		"-a -t 10.0.0.1:5432 -r 192.168.1.10:5432 -m -w 0 -x 500 -y 0\n" +
+		"-a -t 10.0.0.1:5432 -r 192.168.1.11:5432 -m -w 3 -x 500 -y 0\n"
+	if err := v.Apply(context.Background(), services, failing); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(runner.calls) != 1 {
+		t.Fatalf("calls = %+v, want only the listing", runner.calls)
+	}
+
+	// nil removes the services applied before, and only those
+	runner.calls = nil
+	runner.rules += "-A -t 10.0.0.9:80 -s rr\n"
+	if err := v.Apply(context.Background(), nil, nil); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(runner.calls) != 2 || runner.calls[1].stdin != "-D -t 10.0.0.1:5432\n" {
+		t.Fatalf("calls = %+v, want the service deleted", runner.calls)
+	}
+}
+
+func TestIPVS_ApplyIPv6(t *testing.T) {
+	runner := &fakeRunner{rules: "-A -t [2001:db8::1]:443 -s wlc\n" +
+		"-a -t [2001:db8::1]:443 -r [2001:db8::10]:443 -g -w 1\n"}
+	v, err := NewWithRunner(MethodDirect, runner)
+	if err != nil {
+		t.Fatalf("NewWithRunner() error = %v", err)
+	}
+
+	// Addresses written differently match the listing
+	services := []Service{{Address: "2001:0db8::1", Port: 443, Scheduler: "wlc", Reals: []Real{
+		{Address: "2001:db8:0::10", Port: 443, Weight: 1},
+	}}}
+	if err := v.Apply(context.Background(), services, nil); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(runner.calls) != 1 {
+		t.Errorf("calls = %+v, want only the listing", runner.calls)
+	}
+}
+
+func TestIPVS_ApplyFails(t *testing.T) {
+	runner := &fakeRunner{restore: errors.New("exit status 2")}
+	v, err := NewWithRunner(MethodTunnel, runner)
+	if err != nil {
+		t.Fatalf("NewWithRunner() error = %v", err)
+	}
+	err = v.Apply(context.Background(), []Service{{Address: "10.0.0.1", Port: 25, Scheduler: "sh"}}, nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to program IPVS services") {
+		t.Errorf("Apply() error = %v, want the failed restore", err)
+	}
+}
+
+func TestNewWithRunner_UnknownMethod(t *testing.T) {
+	if _, err := NewWithRunner("fullnat", &fakeRunner{}); err == nil {
+		t.Error("NewWithRunner() accepted an unknown method")
+	}
+}
@@ -0,0 +1,72 @@
+package ipvs
+
+import (
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/proxy"
+)
+
+// schedulers maps load balancing algorithms to IPVS schedulers
+var schedulers = map[models.LoadBalancingAlgo]string{
+	models.AlgoRoundRobin:   "wrr",
+	models.AlgoLeastRequest: "wlc",
+	models.AlgoRingHash:     "sh",
+}
+
+// features lists what IPVS lacks besides the features only Envoy provides,
+// with forwarding method
+func features(method Method) []proxy.Feature {
+	features := []proxy.Feature{
+		{Name: "protocols other than tcp", Used: func(lb *models.LoadBalancer) bool { return lb.Protocol != models.ProtocolTCP }},
+		{Name: "listening on every address", Used: func(lb *models.LoadBalancer) bool { return len(lb.Addresses) == 0 }},
+		{Name: "the random algorithm", Used: func(lb *models.LoadBalancer) bool { return lb.Algorithm == models.AlgoRandom }},
+		{Name: "backend hostnames", Used: func(lb *models.LoadBalancer) bool {
+			return slices.ContainsFunc(proxy.Backends(lb), func(b models.Backend) bool { return net.ParseIP(b.Address) == nil })
+		}},
+	}
+	if method != MethodNAT {
+		// Only NAT rewrites the destination port
+		features = append(features, proxy.Feature{Name: fmt.Sprintf("backend ports other than the listener port with method %s", method), Used: func(lb *models.LoadBalancer) bool {
+			return slices.ContainsFunc(proxy.Backends(lb), func(b models.Backend) bool { return b.Port != lb.ListenPort() })
+		}})
+	}
+	return features
+}
+
+// Services returns the virtual services serving lb with forwarding method,
+// or a *proxy.UnsupportedError when IPVS cannot serve it or lb uses one of
+// the extra features. The enabled backends are the real servers of every
+// address of lb; backends with priority 1 are backups.
+func Services(lb *models.LoadBalancer, method Method, extra ...proxy.Feature) ([]Service, error) {
+	if err := proxy.Check(Name, lb, slices.Concat(features(method), extra)...); err != nil {
+		return nil, err
+	}
+
+	backends := proxy.Backends(lb)
+	reals := make([]Real, 0, len(backends))
+	for _, b := range backends {
+		weight := b.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		reals = append(reals, Real{Address: b.Address, Port: b.Port, Weight: weight, Backup: b.Priority > 0})
+	}
+	scheduler := schedulers[lb.Algorithm]
+	if scheduler == "" {
+		scheduler = schedulers[models.AlgoRoundRobin]
+	}
+	services := make([]Service, 0, len(lb.Addresses))
+	for _, addr := range lb.Addresses {
+		services = append(services, Service{
+			Address:        addr,
+			Port:           lb.ListenPort(),
+			Scheduler:      scheduler,
+			MaxConnections: lb.MaxConnections,
+			Reals:          reals,
+		})
+	}
+	return services, nil
+}
@@ -0,0 +1,70 @@
+package ipvs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/proxy"
+)
+
+// testLB returns a TCP load balancer IPVS can serve
+func testLB() *models.LoadBalancer {
+	return &models.LoadBalancer{
+		ID:             "lb-1",
+		Protocol:       models.ProtocolTCP,
+		Algorithm:      models.AlgoLeastRequest,
+		Port:           5432,
+		MaxConnections: 1000,
+		Addresses:      []string{"10.0.0.1"},
+		Backends: []models.Backend{
+			{ID: "b1", Address: "192.168.1.10", Port: 5432, Weight: 2, Enabled: true},
+			{ID: "b2", Address: "192.168.1.11", Port: 5432, Enabled: true},
+			{ID: "b3", Address: "192.168.1.12", Port: 5432, Priority: 1, Enabled: true},
+			{ID: "b4", Address: "192.168.1.13", Port: 5432},
+		},
+	}
+}
+
+func TestServices(t *testing.T) {
+	services, err := Services(testLB(), MethodNAT)
+	if err != nil {
+		t.Fatalf("Services() error = %v", err)
+	}
+	want := []Service{{Address: "10.0.0.1", Port: 5432, Scheduler: "wlc", MaxConnections: 1000, Reals: []Real{
+		{Address: "192.168.1.10", Port: 5432, Weight: 2},
+		{Address: "192.168.1.11", Port: 5432, Weight: 1},
+		{Address: "192.168.1.12", Port: 5432, Weight: 1, Backup: true},
+	}}}
+	if !reflect.DeepEqual(services, want) {
+		t.Errorf("services = %+v, want %+v", services, want)
+	}
+}
+
+func TestServices_Unsupported(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  Method
+		modify  func(lb *models.LoadBalancer)
+		feature string
+	}{
+		{"http", MethodNAT, func(lb *models.LoadBalancer) { lb.Protocol = models.ProtocolHTTP }, "protocols other than tcp"},
+		{"all addresses", MethodNAT, func(lb *models.LoadBalancer) { lb.Addresses = nil }, "listening on every address"},
+		{"random", MethodNAT, func(lb *models.LoadBalancer) { lb.Algorithm = models.AlgoRandom }, "the random algorithm"},
+		{"hostname", MethodNAT, func(lb *models.LoadBalancer) { lb.Backends[0].Address = "db.internal" }, "backend hostnames"},
+		{"envoy only", MethodNAT, func(lb *models.LoadBalancer) { lb.TCPProtocolHint = models.TCPProtocolPostgres }, "tcp_protocol_hint"},
+		{"port remapped with dr", MethodDirect, func(lb *models.LoadBalancer) { lb.Backends[1].Port = 6432 }, "backend ports other than the listener port with method dr"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := testLB()
+			tt.modify(lb)
+			_, err := Services(lb, tt.method)
+			var unsupported *proxy.UnsupportedError
+			if !errors.As(err, &unsupported) || len(unsupported.Features) != 1 || unsupported.Features[0] != tt.feature {
+				t.Errorf("Services() error = %v, want only %q unsupported", err, tt.feature)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package ipvs
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SyncState is the role of the kernel's connection synchronization daemon
+type SyncState string
+
+const (
+	// SyncMaster multicasts the connections of this host
+	SyncMaster SyncState = "master"
+	// SyncBackup receives the connections of the master, so they survive a
+	// failover to this host
+	SyncBackup SyncState = "backup"
+)
+
+// syncDaemon is a running synchronization daemon
+type syncDaemon struct {
+	iface  string
+	syncID int
+}
+
+// daemonPattern matches a daemon listed by ipvsadm -L --daemon, e.g.
+// "master sync daemon (mcast=eth0, syncid=1)"
+var daemonPattern = regexp.MustCompile(`^(master|backup) sync daemon \(mcast=([^,]+), syncid=(\d+)`)
+
+// Sync runs the connection synchronization daemon in state on multicast
+// interface iface, and stops the daemon in the other state. A daemon
+// already running with the same settings is left alone.
+func (v *IPVS) Sync(ctx context.Context, state SyncState, iface string, syncID int) error {
+	running, err := v.daemons(ctx)
+	if err != nil {
+		return err
+	}
+	want := syncDaemon{iface: iface, syncID: syncID}
+	for _, s := range []SyncState{SyncMaster, SyncBackup} {
+		current, ok := running[s]
+		if !ok || (s == state && current == want) {
+			continue
+		}
+		if err := v.run(ctx, "--stop-daemon", string(s)); err != nil {
+			return fmt.Errorf("failed to stop the IPVS %s sync daemon: %w", s, err)
+		}
+	}
+	if current, ok := running[state]; ok && current == want {
+		return nil
+	}
+	if err := v.run(ctx, "--start-daemon", string(state), "--mcast-interface", iface, "--syncid", strconv.Itoa(syncID)); err != nil {
+		return fmt.Errorf("failed to start the IPVS %s sync daemon: %w", state, err)
+	}
+	return nil
+}
+
+// SyncStates returns the states of the synchronization daemons running
+func (v *IPVS) SyncStates(ctx context.Context) ([]SyncState, error) {
+	running, err := v.daemons(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var states []SyncState
+	for _, s := range []SyncState{SyncMaster, SyncBackup} {
+		if _, ok := running[s]; ok {
+			states = append(states, s)
+		}
+	}
+	return states, nil
+}
+
+// daemons returns the synchronization daemons running, by state
+func (v *IPVS) daemons(ctx context.Context) (map[SyncState]syncDaemon, error) {
+	out, err := v.runner.Run(ctx, "", v.binary, "-L", "--daemon")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list IPVS sync daemons: %w", err)
+	}
+	running := make(map[SyncState]syncDaemon)
+	for _, line := range strings.Split(out, "\n") {
+		m := daemonPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		syncID, _ := strconv.Atoi(m[3])
+		running[SyncState(m[1])] = syncDaemon{iface: m[2], syncID: syncID}
+	}
+	return running, nil
+}
+
+// run runs ipvsadm with args
+func (v *IPVS) run(ctx context.Context, args ...string) error {
+	_, err := v.runner.Run(ctx, "", v.binary, args...)
+	return err
+}
+
+// Connections counts the connections IPVS tracks for a set of services
+type Connections struct {
+	Active   int // established TCP connections
+	Inactive int // TCP connections in other states, such as closing
+}
+
+// Connections returns the connections to the services last applied, as
+// listed by ipvsadm -L -n
+func (v *IPVS) Connections(ctx context.Context) (Connections, error) {
+	v.mu.Lock()
+	managed := slices.Clone(v.managed)
+	v.mu.Unlock()
+
+	out, err := v.runner.Run(ctx, "", v.binary, "-L", "-n")
+	if err != nil {
+		return Connections{}, fmt.Errorf("failed to list IPVS connections: %w", err)
+	}
+	var total Connections
+	counting := false
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 2 && fields[0] == "TCP":
+			counting = slices.Contains(managed, normalize(fields[1]))
+		case counting && len(fields) == 6 && fields[0] == "->":
+			active, _ := strconv.Atoi(fields[4])
+			inactive, _ := strconv.Atoi(fields[5])
+			total.Active += active
+			total.Inactive += inactive
+		case len(fields) > 0 && fields[0] != "->":
+			counting = false
+		}
+	}
+	return total, nil
+}
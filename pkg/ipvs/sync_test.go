@@ -0,0 +1,94 @@
+package ipvs
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestIPVS_Sync(t *testing.T) {
+	runner := &fakeRunner{rules: "master sync daemon (mcast=eth0, syncid=7)\n"}
+	v, err := NewWithRunner(MethodNAT, runner)
+	if err != nil {
+		t.Fatalf("NewWithRunner() error = %v", err)
+	}
+
+	// A node turning passive stops sending and starts receiving
+	if err := v.Sync(context.Background(), SyncBackup, "eth0", 7); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	want := []string{
+		"ipvsadm -L --daemon",
+		"ipvsadm --stop-daemon master",
+		"ipvsadm --start-daemon backup --mcast-interface eth0 --syncid 7",
+	}
+	if got := callArgs(runner.calls); !slices.Equal(got, want) {
+		t.Fatalf("calls = %q, want %q", got, want)
+	}
+
+	// A daemon already running with the same settings is left alone
+	runner.calls = nil
+	runner.rules = "backup sync daemon (mcast=eth0, syncid=7, maxlen=1472, group=224.0.0.81, port=8848, ttl=1)\n"
+	if err := v.Sync(context.Background(), SyncBackup, "eth0", 7); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := callArgs(runner.calls); len(got) != 1 {
+		t.Errorf("calls = %q, want only the listing", got)
+	}
+
+	// Other settings restart it
+	runner.calls = nil
+	if err := v.Sync(context.Background(), SyncBackup, "eth1", 7); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	want = []string{
+		"ipvsadm -L --daemon",
+		"ipvsadm --stop-daemon backup",
+		"ipvsadm --start-daemon backup --mcast-interface eth1 --syncid 7",
+	}
+	if got := callArgs(runner.calls); !slices.Equal(got, want) {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+
+	states, err := v.SyncStates(context.Background())
+	if err != nil || len(states) != 1 || states[0] != SyncBackup {
+		t.Errorf("SyncStates() = %v, %v, want backup", states, err)
+	}
+}
+
+func TestIPVS_Connections(t *testing.T) {
+	runner := &fakeRunner{}
+	v, err := NewWithRunner(MethodNAT, runner)
+	if err != nil {
+		t.Fatalf("NewWithRunner() error = %v", err)
+	}
+	if err := v.Apply(context.Background(), []Service{{Address: "10.0.0.1", Port: 5432, Scheduler: "wlc"}}, nil); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	runner.rules = `IP Virtual Server version 1.2.1 (size=4096)
+Prot LocalAddress:Port Scheduler Flags
+  -> RemoteAddress:Port           Forward Weight ActiveConn InActConn
+TCP  10.0.0.1:5432 wlc
+  -> 192.168.1.10:5432            Masq    2      12         3
+  -> 192.168.1.11:5432            Masq    1      5          1
+TCP  10.0.0.9:80 rr
+  -> 192.168.2.10:80              Masq    1      100        100
+`
+	conns, err := v.Connections(context.Background())
+	if err != nil {
+		t.Fatalf("Connections() error = %v", err)
+	}
+	if conns != (Connections{Active: 17, Inactive: 4}) {
+		t.Errorf("Connections() = %+v, want only those of the applied service", conns)
+	}
+}
+
+// callArgs returns the command lines of calls
+func callArgs(calls []call) []string {
+	args := make([]string, len(calls))
+	for i, c := range calls {
+		args[i] = c.args
+	}
+	return args
+}
@@ -0,0 +1,288 @@
+// Package k8s is a minimal Kubernetes API client for the VPSie controllers.
+// It talks to the API server over plain HTTPS and covers only the resources
+// the controllers need, which keeps client-go out of the agent's dependencies.
+package k8s
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// serviceAccountDir holds the in-cluster credentials
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// maxResponseSize limits API responses read into memory (32 MiB)
+	maxResponseSize = 32 * 1024 * 1024
+
+	// requestTimeout bounds non-watch requests
+	requestTimeout = 30 * time.Second
+
+	// watchTimeoutSeconds asks the API server to end watches after this long
+	watchTimeoutSeconds = 300
+)
+
+// Client is a Kubernetes API client
+type Client struct {
+	httpClient *http.Client
+	token      func() (string, error)
+	baseURL    string
+}
+
+// NewInClusterClient creates a client from the pod's service account. The
+// token is re-read for every request because projected tokens are rotated.
+func NewInClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set")
+	}
+
+	caPEM, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA: %w", err)
+	}
+
+	tokenFile := serviceAccountDir + "/token"
+	token := func() (string, error) {
+		data, readErr := os.ReadFile(tokenFile)
+		if readErr != nil {
+			return "", fmt.Errorf("failed to read service account token: %w", readErr)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	return newClient("https://"+net.JoinHostPort(host, port), token, caPEM)
+}
+
+// NewClient creates a client for server authenticating with a bearer token.
+// caPEM may be nil to use the system roots.
+func NewClient(server, token string, caPEM []byte) (*Client, error) {
+	return newClient(server, func() (string, error) { return token, nil }, caPEM)
+}
+
+func newClient(server string, token func() (string, error), caPEM []byte) (*Client, error) {
+	u, err := url.Parse(server)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid API server URL %q", server)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(caPEM) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no valid certificates in API server CA")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &Client{
+		baseURL: strings.TrimSuffix(server, "/"),
+		token:   token,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig:     tlsConfig,
+				MaxIdleConnsPerHost: 10,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+	}, nil
+}
+
+// do sends a request and decodes a successful JSON response into out
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	resp, err := c.send(ctx, method, path, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return apiError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+// send builds and executes an authenticated request
+func (c *Client) send(ctx context.Context, method, path, contentType string, body []byte) (*http.Response, error) {
+	token, err := c.token()
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	return resp, nil
+}
+
+// apiError turns an unsuccessful response into an error
+func apiError(resp *http.Response) error {
+	var status struct {
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if json.Unmarshal(data, &status) == nil && status.Message != "" {
+		return fmt.Errorf("kubernetes API returned status %d: %s", resp.StatusCode, status.Message)
+	}
+	return fmt.Errorf("kubernetes API returned status %d", resp.StatusCode)
+}
+
+// ListServices lists Services in all namespaces
+func (c *Client) ListServices(ctx context.Context) (*ServiceList, error) {
+	var list ServiceList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/services", "", nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// ListNodes lists all Nodes
+func (c *Client) ListNodes(ctx context.Context) (*NodeList, error) {
+	var list NodeList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/nodes", "", nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// ListIngresses lists Ingresses in all namespaces
+func (c *Client) ListIngresses(ctx context.Context) (*IngressList, error) {
+	var list IngressList
+	if err := c.do(ctx, http.MethodGet, "/apis/networking.k8s.io/v1/ingresses", "", nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// ListEndpointSlices lists the EndpointSlices of a Service
+func (c *Client) ListEndpointSlices(ctx context.Context, namespace, service string) (*EndpointSliceList, error) {
+	path := fmt.Sprintf("/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?labelSelector=%s",
+		url.PathEscape(namespace), url.QueryEscape(LabelServiceName+"="+service))
+	var list EndpointSliceList
+	if err := c.do(ctx, http.MethodGet, path, "", nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// PatchService applies a JSON merge patch to a Service
+func (c *Client) PatchService(ctx context.Context, namespace, name string, patch interface{}) error {
+	return c.patch(ctx, fmt.Sprintf("/api/v1/namespaces/%s/services/%s", url.PathEscape(namespace), url.PathEscape(name)), patch)
+}
+
+// PatchServiceStatus applies a JSON merge patch to a Service's status
+func (c *Client) PatchServiceStatus(ctx context.Context, namespace, name string, patch interface{}) error {
+	return c.patch(ctx, fmt.Sprintf("/api/v1/namespaces/%s/services/%s/status", url.PathEscape(namespace), url.PathEscape(name)), patch)
+}
+
+func (c *Client) patch(ctx context.Context, path string, patch interface{}) error {
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal patch: %w", err)
+	}
+	return c.do(ctx, http.MethodPatch, path, "application/merge-patch+json", body, nil)
+}
+
+// Watch streams changes to the collection at path (e.g. /api/v1/services)
+// and calls onEvent for each one. It returns when the server ends the watch,
+// the stream fails or ctx is cancelled; callers re-list and watch again.
+func (c *Client) Watch(ctx context.Context, path string, onEvent func()) error {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	watchPath := fmt.Sprintf("%s%swatch=1&timeoutSeconds=%d", path, sep, watchTimeoutSeconds)
+
+	resp, err := c.send(ctx, http.MethodGet, watchPath, "", nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return apiError(resp)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxResponseSize)
+	for scanner.Scan() {
+		var event struct {
+			Type string `json:"type"`
+		}
+		if err = json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("failed to decode watch event: %w", err)
+		}
+		if event.Type == "ERROR" {
+			return fmt.Errorf("watch %s ended with an error event", path)
+		}
+		if event.Type != "BOOKMARK" {
+			onEvent()
+		}
+	}
+	if err = scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("watch %s failed: %w", path, err)
+	}
+	return nil
+}
+
+// WatchLoop keeps a watch on path open until ctx is cancelled, re-establishing
+// it with exponential backoff (up to a minute) when it fails
+func (c *Client) WatchLoop(ctx context.Context, path string, onEvent func()) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		err := c.Watch(ctx, path, onEvent)
+		if err == nil {
+			backoff = time.Second
+			continue
+		}
+
+		log.Printf("Warning: Watch %s failed, retrying in %s: %v", path, backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(server.URL, "test-token", nil)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func TestClient_ListServices(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/services" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		_, _ = io.WriteString(w, `{"metadata":{"resourceVersion":"42"},"items":[
+			{"metadata":{"name":"web","namespace":"default","uid":"u1"},
+			 "spec":{"type":"LoadBalancer","ports":[{"port":80,"nodePort":30080,"protocol":"TCP"}]},
+			 "status":{"loadBalancer":{}}}]}`)
+	})
+
+	list, err := client.ListServices(context.Background())
+	if err != nil {
+		t.Fatalf("ListServices() error = %v", err)
+	}
+	if list.Metadata.ResourceVersion != "42" || len(list.Items) != 1 {
+		t.Fatalf("list = %+v", list)
+	}
+	svc := list.Items[0]
+	if svc.Metadata.Name != "web" || svc.Spec.Type != ServiceTypeLoadBalancer || svc.Spec.Ports[0].NodePort != 30080 {
+		t.Errorf("service = %+v", svc)
+	}
+}
+
+func TestClient_ListEndpointSlices(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/prod/endpointslices" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("labelSelector"); got != "kubernetes.io/service-name=web" {
+			t.Errorf("labelSelector = %q", got)
+		}
+		_, _ = io.WriteString(w, `{"items":[{"endpoints":[{"nodeName":"n1","conditions":{"ready":true}}]}]}`)
+	})
+
+	list, err := client.ListEndpointSlices(context.Background(), "prod", "web")
+	if err != nil {
+		t.Fatalf("ListEndpointSlices() error = %v", err)
+	}
+	if len(list.Items) != 1 || *list.Items[0].Endpoints[0].NodeName != "n1" {
+		t.Errorf("list = %+v", list)
+	}
+}
+
+func TestClient_PatchServiceStatus(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.URL.Path != "/api/v1/namespaces/default/services/web/status" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/merge-patch+json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		var patch map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			t.Errorf("invalid patch: %v", err)
+		}
+		_, _ = io.WriteString(w, `{}`)
+	})
+
+	patch := map[string]interface{}{"status": map[string]interface{}{"loadBalancer": map[string]interface{}{
+		"ingress": []LoadBalancerIngress{{IP: "203.0.113.1"}},
+	}}}
+	if err := client.PatchServiceStatus(context.Background(), "default", "web", patch); err != nil {
+		t.Errorf("PatchServiceStatus() error = %v", err)
+	}
+}
+
+func TestClient_APIError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `{"kind":"Status","message":"services is forbidden"}`)
+	})
+
+	_, err := client.ListServices(context.Background())
+	if err == nil || err.Error() != "kubernetes API returned status 403: services is forbidden" {
+		t.Errorf("ListServices() error = %v", err)
+	}
+}
+
+func TestClient_Watch(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") != "1" {
+			t.Errorf("watch query missing: %s", r.URL.RawQuery)
+		}
+		for _, typ := range []string{"ADDED", "BOOKMARK", "MODIFIED", "DELETED"} {
+			_, _ = fmt.Fprintf(w, "{\"type\":%q,\"object\":{}}\n", typ)
+		}
+	})
+
+	events := 0
+	if err := client.Watch(context.Background(), "/api/v1/services", func() { events++ }); err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	if events != 3 {
+		t.Errorf("events = %d, want 3 (bookmarks are skipped)", events)
+	}
+}
+
+func TestClient_WatchErrorEvent(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `{"type":"ERROR","object":{"code":410}}`+"\n")
+	})
+
+	if err := client.Watch(context.Background(), "/api/v1/nodes", func() {}); err == nil {
+		t.Error("Expected error for ERROR watch event")
+	}
+}
+
+func TestNewClient_InvalidServer(t *testing.T) {
+	if _, err := NewClient("not a url", "", nil); err == nil {
+		t.Error("Expected error for invalid server URL")
+	}
+	if _, err := NewClient("https://k8s.example.com", "", []byte("not a certificate")); err == nil {
+		t.Error("Expected error for invalid CA")
+	}
+}
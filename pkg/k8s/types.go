@@ -0,0 +1,254 @@
+package k8s
+
+import "time"
+
+// The types below mirror the subset of the Kubernetes core/v1 and
+// discovery/v1 API objects used by the VPSie controllers. Unknown fields are
+// ignored when decoding.
+
+// ObjectMeta is the standard object metadata
+type ObjectMeta struct {
+	DeletionTimestamp *time.Time        `json:"deletionTimestamp,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace,omitempty"`
+	UID               string            `json:"uid,omitempty"`
+	ResourceVersion   string            `json:"resourceVersion,omitempty"`
+	Finalizers        []string          `json:"finalizers,omitempty"`
+}
+
+// HasFinalizer reports whether the object carries finalizer
+func (m *ObjectMeta) HasFinalizer(finalizer string) bool {
+	for _, f := range m.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// ListMeta is the standard list metadata
+type ListMeta struct {
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// Service types
+const (
+	ServiceTypeLoadBalancer = "LoadBalancer"
+
+	// ExternalTrafficPolicyLocal only routes to nodes running a ready endpoint
+	ExternalTrafficPolicyLocal = "Local"
+)
+
+// Service is a core/v1 Service
+type Service struct {
+	Metadata ObjectMeta    `json:"metadata"`
+	Spec     ServiceSpec   `json:"spec"`
+	Status   ServiceStatus `json:"status"`
+}
+
+// ServiceSpec is the subset of the Service spec used by the controllers
+type ServiceSpec struct {
+	LoadBalancerClass     *string       `json:"loadBalancerClass,omitempty"`
+	Type                  string        `json:"type"`
+	ExternalTrafficPolicy string        `json:"externalTrafficPolicy,omitempty"`
+	Ports                 []ServicePort `json:"ports"`
+}
+
+// ServicePort is a port exposed by a Service
+type ServicePort struct {
+	Name     string `json:"name,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	Port     int    `json:"port"`
+	NodePort int    `json:"nodePort,omitempty"`
+}
+
+// ServiceStatus is the Service status
+type ServiceStatus struct {
+	LoadBalancer LoadBalancerStatus `json:"loadBalancer"`
+}
+
+// LoadBalancerStatus lists the load balancer ingress points of a Service
+type LoadBalancerStatus struct {
+	Ingress []LoadBalancerIngress `json:"ingress"`
+}
+
+// LoadBalancerIngress is one load balancer ingress point
+type LoadBalancerIngress struct {
+	IP       string `json:"ip,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// ServiceList is a list of Services
+type ServiceList struct {
+	Metadata ListMeta  `json:"metadata"`
+	Items    []Service `json:"items"`
+}
+
+// Node address types and conditions
+const (
+	NodeInternalIP = "InternalIP"
+	NodeReady      = "Ready"
+)
+
+// Node is a core/v1 Node
+type Node struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     NodeSpec   `json:"spec"`
+	Status   NodeStatus `json:"status"`
+}
+
+// NodeSpec is the subset of the Node spec used by the controllers
+type NodeSpec struct {
+	Unschedulable bool `json:"unschedulable,omitempty"`
+}
+
+// NodeStatus is the Node status
+type NodeStatus struct {
+	Addresses  []NodeAddress   `json:"addresses"`
+	Conditions []NodeCondition `json:"conditions"`
+}
+
+// NodeAddress is one address of a Node
+type NodeAddress struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+// NodeCondition is one condition of a Node
+type NodeCondition struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+// InternalIP returns the node's internal IP, or "" if it has none
+func (n *Node) InternalIP() string {
+	for _, addr := range n.Status.Addresses {
+		if addr.Type == NodeInternalIP {
+			return addr.Address
+		}
+	}
+	return ""
+}
+
+// IsReady reports whether the node's Ready condition is True
+func (n *Node) IsReady() bool {
+	for _, cond := range n.Status.Conditions {
+		if cond.Type == NodeReady {
+			return cond.Status == "True"
+		}
+	}
+	return false
+}
+
+// NodeList is a list of Nodes
+type NodeList struct {
+	Metadata ListMeta `json:"metadata"`
+	Items    []Node   `json:"items"`
+}
+
+// EndpointSlice is a discovery/v1 EndpointSlice
+type EndpointSlice struct {
+	Metadata    ObjectMeta     `json:"metadata"`
+	AddressType string         `json:"addressType,omitempty"`
+	Endpoints   []Endpoint     `json:"endpoints"`
+	Ports       []EndpointPort `json:"ports,omitempty"`
+}
+
+// Endpoint is one endpoint of an EndpointSlice
+type Endpoint struct {
+	NodeName   *string            `json:"nodeName,omitempty"`
+	Conditions EndpointConditions `json:"conditions"`
+	Addresses  []string           `json:"addresses,omitempty"`
+}
+
+// EndpointPort is a port served by the endpoints of an EndpointSlice
+type EndpointPort struct {
+	Name *string `json:"name,omitempty"`
+	Port *int    `json:"port,omitempty"`
+}
+
+// EndpointConditions is the state of an endpoint
+type EndpointConditions struct {
+	Ready *bool `json:"ready,omitempty"`
+}
+
+// EndpointSliceList is a list of EndpointSlices
+type EndpointSliceList struct {
+	Metadata ListMeta        `json:"metadata"`
+	Items    []EndpointSlice `json:"items"`
+}
+
+// LabelServiceName is the EndpointSlice label naming the owning Service
+const LabelServiceName = "kubernetes.io/service-name"
+
+// Ingress is a networking/v1 Ingress
+type Ingress struct {
+	Metadata ObjectMeta  `json:"metadata"`
+	Spec     IngressSpec `json:"spec"`
+}
+
+// IngressSpec is the subset of the Ingress spec used by the controllers
+type IngressSpec struct {
+	IngressClassName *string         `json:"ingressClassName,omitempty"`
+	DefaultBackend   *IngressBackend `json:"defaultBackend,omitempty"`
+	Rules            []IngressRule   `json:"rules,omitempty"`
+	TLS              []IngressTLS    `json:"tls,omitempty"`
+}
+
+// IngressRule routes the requests for one host
+type IngressRule struct {
+	HTTP *HTTPIngressRuleValue `json:"http,omitempty"`
+	Host string                `json:"host,omitempty"`
+}
+
+// HTTPIngressRuleValue lists the paths of a rule
+type HTTPIngressRuleValue struct {
+	Paths []HTTPIngressPath `json:"paths"`
+}
+
+// Ingress path types
+const (
+	PathTypeExact  = "Exact"
+	PathTypePrefix = "Prefix"
+)
+
+// HTTPIngressPath routes one path to a backend
+type HTTPIngressPath struct {
+	Path     string         `json:"path,omitempty"`
+	PathType string         `json:"pathType,omitempty"`
+	Backend  IngressBackend `json:"backend"`
+}
+
+// IngressBackend is the target of an Ingress path
+type IngressBackend struct {
+	Service *IngressServiceBackend `json:"service,omitempty"`
+}
+
+// IngressServiceBackend references a Service port
+type IngressServiceBackend struct {
+	Name string             `json:"name"`
+	Port ServiceBackendPort `json:"port"`
+}
+
+// ServiceBackendPort is a Service port referenced by name or number
+type ServiceBackendPort struct {
+	Name   string `json:"name,omitempty"`
+	Number int    `json:"number,omitempty"`
+}
+
+// IngressTLS is a TLS configuration of an Ingress
+type IngressTLS struct {
+	Hosts      []string `json:"hosts,omitempty"`
+	SecretName string   `json:"secretName,omitempty"`
+}
+
+// IngressList is a list of Ingresses
+type IngressList struct {
+	Metadata ListMeta  `json:"metadata"`
+	Items    []Ingress `json:"items"`
+}
+
+// AnnotationIngressClass is the legacy annotation selecting an Ingress controller
+const AnnotationIngressClass = "kubernetes.io/ingress.class"
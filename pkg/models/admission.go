@@ -0,0 +1,39 @@
+package models
+
+// AdmissionControlType selects the Envoy load-shedding filter
+type AdmissionControlType string
+
+const (
+	// AdmissionAdaptiveConcurrency limits concurrency based on observed latency
+	AdmissionAdaptiveConcurrency AdmissionControlType = "adaptive_concurrency"
+	// AdmissionStatic rejects requests probabilistically when the success rate drops
+	AdmissionStatic AdmissionControlType = "admission_control"
+)
+
+// AdmissionControl configures early load shedding so the load balancer
+// rejects excess requests when backends degrade instead of queueing them
+// until they time out. HTTP and HTTPS load balancers only.
+type AdmissionControl struct {
+	Type                 AdmissionControlType `json:"type" yaml:"type"`
+	TargetLatencyMs      int                  `json:"target_latency_ms,omitempty" yaml:"target_latency_ms,omitempty"`           // adaptive: fixed latency target, 0 = measured
+	MaxConcurrency       int                  `json:"max_concurrency,omitempty" yaml:"max_concurrency,omitempty"`               // adaptive: concurrency ceiling
+	MinRPS               int                  `json:"min_rps,omitempty" yaml:"min_rps,omitempty"`                               // static: no shedding below this request rate
+	SuccessRateThreshold float64              `json:"success_rate_threshold,omitempty" yaml:"success_rate_threshold,omitempty"` // static: percent
+	SamplingWindow       int                  `json:"sampling_window,omitempty" yaml:"sampling_window,omitempty"`               // static: seconds
+}
+
+// Validate validates the admission control settings
+func (a *AdmissionControl) Validate() error {
+	switch a.Type {
+	case AdmissionAdaptiveConcurrency, AdmissionStatic:
+	default:
+		return ErrInvalidAdmissionControl
+	}
+	if a.TargetLatencyMs < 0 || a.MaxConcurrency < 0 || a.MinRPS < 0 || a.SamplingWindow < 0 {
+		return ErrInvalidAdmissionControl
+	}
+	if a.SuccessRateThreshold < 0 || a.SuccessRateThreshold > 100 {
+		return ErrInvalidAdmissionControl
+	}
+	return nil
+}
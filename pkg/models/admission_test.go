@@ -0,0 +1,46 @@
+package models
+
+import "testing"
+
+func TestAdmissionControl_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantErr   error
+		admission AdmissionControl
+	}{
+		{
+			name:      "valid adaptive concurrency",
+			admission: AdmissionControl{Type: AdmissionAdaptiveConcurrency, TargetLatencyMs: 250, MaxConcurrency: 500},
+			wantErr:   nil,
+		},
+		{
+			name:      "valid static admission control",
+			admission: AdmissionControl{Type: AdmissionStatic, MinRPS: 10, SuccessRateThreshold: 95, SamplingWindow: 30},
+			wantErr:   nil,
+		},
+		{
+			name:      "unknown type",
+			admission: AdmissionControl{Type: "token_bucket"},
+			wantErr:   ErrInvalidAdmissionControl,
+		},
+		{
+			name:      "negative target latency",
+			admission: AdmissionControl{Type: AdmissionAdaptiveConcurrency, TargetLatencyMs: -1},
+			wantErr:   ErrInvalidAdmissionControl,
+		},
+		{
+			name:      "success rate over 100",
+			admission: AdmissionControl{Type: AdmissionStatic, SuccessRateThreshold: 101},
+			wantErr:   ErrInvalidAdmissionControl,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.admission.Validate()
+			if err != tt.wantErr {
+				t.Errorf("AdmissionControl.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+)
+
+// AuthorizationProtocol selects how the authorization service is called
+type AuthorizationProtocol string
+
+const (
+	// AuthorizationGRPC calls the Envoy external authorization gRPC API
+	AuthorizationGRPC AuthorizationProtocol = "grpc"
+	// AuthorizationHTTP sends the request headers to an HTTP service, which
+	// allows the request with a 2xx response
+	AuthorizationHTTP AuthorizationProtocol = "http"
+)
+
+// AuthorizationFailureMode selects what happens to requests while the
+// authorization service is unreachable
+type AuthorizationFailureMode string
+
+const (
+	// AuthorizationFailClosed rejects requests with 403
+	AuthorizationFailClosed AuthorizationFailureMode = "closed"
+	// AuthorizationFailOpen passes requests unauthorized
+	AuthorizationFailOpen AuthorizationFailureMode = "open"
+)
+
+// Authorization limits
+const (
+	MaxAuthorizationHeaders   = 32
+	MaxAuthorizationTimeoutMs = 10000
+)
+
+// headerNameRegex restricts header names to HTTP tokens that are safe to render
+var headerNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,127}$`)
+
+// Authorization asks an external service whether each request may proceed
+// before it is routed, e.g. an OAuth proxy or Open Policy Agent. HTTP and
+// HTTPS load balancers only.
+type Authorization struct {
+	Protocol        AuthorizationProtocol    `json:"protocol" yaml:"protocol"`                                     // grpc or http
+	Service         string                   `json:"service" yaml:"service"`                                       // host:port of the authorization service
+	PathPrefix      string                   `json:"path_prefix,omitempty" yaml:"path_prefix,omitempty"`           // http only, prepended to the request path
+	TimeoutMs       int                      `json:"timeout_ms,omitempty" yaml:"timeout_ms,omitempty"`             // default 200
+	FailureMode     AuthorizationFailureMode `json:"failure_mode,omitempty" yaml:"failure_mode,omitempty"`         // closed (default) or open
+	RequestHeaders  []string                 `json:"request_headers,omitempty" yaml:"request_headers,omitempty"`   // http only: client headers sent to the service besides Authorization, Host and Path
+	UpstreamHeaders []string                 `json:"upstream_headers,omitempty" yaml:"upstream_headers,omitempty"` // http only: response headers of the service added to the request sent to the backend
+}
+
+// Validate validates the authorization settings
+func (a *Authorization) Validate() error {
+	if a.Protocol != AuthorizationGRPC && a.Protocol != AuthorizationHTTP {
+		return ErrInvalidAuthorizationProtocol
+	}
+	host, port, err := net.SplitHostPort(a.Service)
+	if err != nil || (net.ParseIP(host) == nil && !HostnameRegex.MatchString(host)) {
+		return ErrInvalidAuthorization
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return ErrInvalidAuthorization
+	}
+	if a.TimeoutMs < 0 || a.TimeoutMs > MaxAuthorizationTimeoutMs {
+		return ErrInvalidAuthorization
+	}
+	if a.FailureMode != "" && a.FailureMode != AuthorizationFailClosed && a.FailureMode != AuthorizationFailOpen {
+		return ErrInvalidAuthorization
+	}
+	// gRPC services receive every request header and set the headers
+	// forwarded to the backend themselves
+	if a.Protocol == AuthorizationGRPC && (a.PathPrefix != "" || len(a.RequestHeaders) > 0 || len(a.UpstreamHeaders) > 0) {
+		return ErrInvalidAuthorization
+	}
+	if a.PathPrefix != "" && !routePathRegex.MatchString(a.PathPrefix) {
+		return ErrInvalidAuthorization
+	}
+	if len(a.RequestHeaders) > MaxAuthorizationHeaders || len(a.UpstreamHeaders) > MaxAuthorizationHeaders {
+		return ErrInvalidAuthorization
+	}
+	for _, headers := range [][]string{a.RequestHeaders, a.UpstreamHeaders} {
+		for _, name := range headers {
+			if !headerNameRegex.MatchString(name) {
+				return ErrInvalidAuthorization
+			}
+		}
+	}
+	return nil
+}
+
+// ServiceAddress returns the authorization service host and port
+func (a *Authorization) ServiceAddress() (string, int) {
+	host, port, _ := net.SplitHostPort(a.Service)
+	p, _ := strconv.Atoi(port)
+	return host, p
+}
+
+func (lb *LoadBalancer) validateAuthorization() error {
+	if lb.Authorization == nil {
+		return nil
+	}
+	if lb.Protocol == ProtocolTCP {
+		return ErrAuthorizationRequiresHTTP
+	}
+	return lb.Authorization.Validate()
+}
@@ -0,0 +1,78 @@
+package models
+
+import "testing"
+
+func TestAuthorization_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr error
+		authz   Authorization
+	}{
+		{
+			name:  "grpc service",
+			authz: Authorization{Protocol: AuthorizationGRPC, Service: "opa.internal:9191", FailureMode: AuthorizationFailOpen},
+		},
+		{
+			name: "http service with headers",
+			authz: Authorization{
+				Protocol: AuthorizationHTTP, Service: "10.0.0.5:4180", PathPrefix: "/oauth2/auth", TimeoutMs: 500,
+				RequestHeaders: []string{"Cookie", "x-api-key"}, UpstreamHeaders: []string{"X-Auth-Request-User"},
+			},
+		},
+		{
+			name:    "unknown protocol",
+			authz:   Authorization{Protocol: "ldap", Service: "ldap.internal:389"},
+			wantErr: ErrInvalidAuthorizationProtocol,
+		},
+		{
+			name:    "service without port",
+			authz:   Authorization{Protocol: AuthorizationGRPC, Service: "opa.internal"},
+			wantErr: ErrInvalidAuthorization,
+		},
+		{
+			name:    "timeout too long",
+			authz:   Authorization{Protocol: AuthorizationGRPC, Service: "opa.internal:9191", TimeoutMs: 60000},
+			wantErr: ErrInvalidAuthorization,
+		},
+		{
+			name:    "unknown failure mode",
+			authz:   Authorization{Protocol: AuthorizationGRPC, Service: "opa.internal:9191", FailureMode: "ignore"},
+			wantErr: ErrInvalidAuthorization,
+		},
+		{
+			name:    "headers for a grpc service",
+			authz:   Authorization{Protocol: AuthorizationGRPC, Service: "opa.internal:9191", RequestHeaders: []string{"cookie"}},
+			wantErr: ErrInvalidAuthorization,
+		},
+		{
+			name:    "invalid header name",
+			authz:   Authorization{Protocol: AuthorizationHTTP, Service: "10.0.0.5:4180", UpstreamHeaders: []string{"x-user: admin"}},
+			wantErr: ErrInvalidAuthorization,
+		},
+		{
+			name:    "invalid path prefix",
+			authz:   Authorization{Protocol: AuthorizationHTTP, Service: "10.0.0.5:4180", PathPrefix: "auth"},
+			wantErr: ErrInvalidAuthorization,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.authz.Validate()
+			if err != tt.wantErr {
+				t.Errorf("Authorization.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_Validate_AuthorizationProtocol(t *testing.T) {
+	lb := &LoadBalancer{
+		ID: "lb-1", Name: "lb", Protocol: ProtocolTCP, Algorithm: AlgoRoundRobin, Port: 5432,
+		Backends:      []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 5432, Enabled: true}},
+		Authorization: &Authorization{Protocol: AuthorizationGRPC, Service: "opa.internal:9191"},
+	}
+	if err := lb.Validate(); err != ErrAuthorizationRequiresHTTP {
+		t.Errorf("Validate() error = %v, wantErr %v", err, ErrAuthorizationRequiresHTTP)
+	}
+}
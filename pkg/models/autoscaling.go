@@ -0,0 +1,55 @@
+package models
+
+// Autoscaling asks VPSie to add or remove backend servers when the load on a
+// backend pool crosses its thresholds. Each threshold is per healthy backend;
+// at least one must be set.
+type Autoscaling struct {
+	Group                    string  `json:"group,omitempty" yaml:"group,omitempty"`                                             // VPSie scaling group to resize; empty only reports events
+	MaxRPSPerBackend         float64 `json:"max_rps_per_backend,omitempty" yaml:"max_rps_per_backend,omitempty"`                 // requests per second
+	MaxConnectionsPerBackend int     `json:"max_connections_per_backend,omitempty" yaml:"max_connections_per_backend,omitempty"` // active upstream connections
+	MaxSaturation            int     `json:"max_saturation,omitempty" yaml:"max_saturation,omitempty"`                           // percent of connection_pool.max_connections_per_host in use
+	ScaleInPercent           int     `json:"scale_in_percent,omitempty" yaml:"scale_in_percent,omitempty"`                       // scale in when every metric is below this percent of its threshold, 0 = never
+	Cooldown                 int     `json:"cooldown,omitempty" yaml:"cooldown,omitempty"`                                       // seconds between scaling requests (default 300)
+}
+
+// Validate validates the autoscaling policy
+func (a *Autoscaling) Validate() error {
+	if a.Group != "" && !safeIdentifierRegex.MatchString(a.Group) {
+		return ErrInvalidAutoscaling
+	}
+	if a.MaxRPSPerBackend < 0 || a.MaxConnectionsPerBackend < 0 || a.MaxSaturation < 0 || a.MaxSaturation > 100 {
+		return ErrInvalidAutoscaling
+	}
+	if a.MaxRPSPerBackend == 0 && a.MaxConnectionsPerBackend == 0 && a.MaxSaturation == 0 {
+		return ErrInvalidAutoscaling
+	}
+	if a.ScaleInPercent < 0 || a.ScaleInPercent >= 100 || a.Cooldown < 0 {
+		return ErrInvalidAutoscaling
+	}
+	return nil
+}
+
+func (lb *LoadBalancer) validateAutoscaling() error {
+	pools := []*BackendPool{nil}
+	for i := range lb.Pools {
+		pools = append(pools, &lb.Pools[i])
+	}
+	for _, pool := range pools {
+		policy := lb.Autoscaling
+		if pool != nil {
+			policy = pool.Autoscaling
+		}
+		if policy == nil {
+			continue
+		}
+		if err := policy.Validate(); err != nil {
+			return err
+		}
+		// Saturation is measured against the per-host connection limit
+		limits := lb.PoolConnectionPool(pool)
+		if policy.MaxSaturation > 0 && (limits == nil || limits.MaxConnectionsPerHost == 0) {
+			return ErrSaturationNeedsConnectionLimit
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package models
+
+import "testing"
+
+func TestAutoscaling_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr error
+		policy  Autoscaling
+	}{
+		{name: "requests per backend", policy: Autoscaling{Group: "web-asg", MaxRPSPerBackend: 100, ScaleInPercent: 30, Cooldown: 600}},
+		{name: "events only", policy: Autoscaling{MaxConnectionsPerBackend: 50}},
+		{name: "no threshold", policy: Autoscaling{Group: "web-asg"}, wantErr: ErrInvalidAutoscaling},
+		{name: "unsafe group", policy: Autoscaling{Group: "web/asg", MaxRPSPerBackend: 100}, wantErr: ErrInvalidAutoscaling},
+		{name: "negative threshold", policy: Autoscaling{MaxRPSPerBackend: -1}, wantErr: ErrInvalidAutoscaling},
+		{name: "saturation above 100", policy: Autoscaling{MaxSaturation: 120}, wantErr: ErrInvalidAutoscaling},
+		{name: "scale in at 100 percent", policy: Autoscaling{MaxRPSPerBackend: 100, ScaleInPercent: 100}, wantErr: ErrInvalidAutoscaling},
+		{name: "negative cooldown", policy: Autoscaling{MaxRPSPerBackend: 100, Cooldown: -1}, wantErr: ErrInvalidAutoscaling},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); err != tt.wantErr {
+				t.Errorf("Autoscaling.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_Validate_AutoscalingSaturation(t *testing.T) {
+	lb := &LoadBalancer{
+		ID: "lb-1", Name: "web", Protocol: ProtocolHTTP, Algorithm: AlgoRoundRobin, Port: 80,
+		Backends: []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+		Pools: []BackendPool{{
+			Name:        "api",
+			Backends:    []Backend{{ID: "api-1", Address: "10.0.1.1", Port: 80, Enabled: true}},
+			Autoscaling: &Autoscaling{MaxSaturation: 80},
+		}},
+	}
+	if err := lb.Validate(); err != ErrSaturationNeedsConnectionLimit {
+		t.Errorf("Validate() error = %v, want %v", err, ErrSaturationNeedsConnectionLimit)
+	}
+
+	lb.ConnectionPool = &ConnectionPool{MaxConnectionsPerHost: 100}
+	if err := lb.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
@@ -8,16 +8,32 @@ import (
 var (
 	// HostnameRegex validates hostnames according to RFC 1123
 	HostnameRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+	// LocalityRegex validates region and zone names such as eu-west-1a
+	LocalityRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._-]{0,62})$`)
+
+	// StatsNameRegex validates stat prefixes and stats tag names; dots would
+	// split Envoy stat names and break tag extraction
+	StatsNameRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,63}$`)
 )
 
+// MaxBackendPriority is the lowest backend priority (highest number)
+const MaxBackendPriority = 9
+
 // Backend represents a backend server
 type Backend struct {
-	ID      string `json:"id" yaml:"id"`
-	Address string `json:"address" yaml:"address"`                   // IP or hostname
-	Status  string `json:"status,omitempty" yaml:"status,omitempty"` // up, down, unknown
-	Port    int    `json:"port" yaml:"port"`
-	Weight  int    `json:"weight,omitempty" yaml:"weight,omitempty"`
-	Enabled bool   `json:"enabled" yaml:"enabled"`
+	ID          string `json:"id" yaml:"id"`
+	Address     string `json:"address" yaml:"address"`                   // IP or hostname
+	Status      string `json:"status,omitempty" yaml:"status,omitempty"` // up, down, unknown
+	Region      string `json:"region,omitempty" yaml:"region,omitempty"`
+	Zone        string `json:"zone,omitempty" yaml:"zone,omitempty"` // backends in the load balancer's zone are preferred
+	Port        int    `json:"port" yaml:"port"`
+	Weight      int    `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Priority    int    `json:"priority,omitempty" yaml:"priority,omitempty"` // 0 = primary; higher priorities only get traffic when all lower ones are unhealthy
+	Enabled     bool   `json:"enabled" yaml:"enabled"`
+	DiscoverAll bool   `json:"discover_all,omitempty" yaml:"discover_all,omitempty"` // hostname: use every A and AAAA record as a backend
+
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"` // e.g. version: v2, matched by pool selectors
 }
 
 // Validate validates the backend configuration
@@ -41,13 +57,26 @@ func (b *Backend) Validate() error {
 		}
 	}
 
+	// Only hostnames resolve to more than one address
+	if b.DiscoverAll && net.ParseIP(b.Address) != nil {
+		return ErrDiscoverAllNeedsName
+	}
+
 	if b.Port <= 0 || b.Port > 65535 {
 		return ErrInvalidBackendPort
 	}
 	if b.Weight < 0 {
 		return ErrInvalidBackendWeight
 	}
-	return nil
+	if b.Priority < 0 || b.Priority > MaxBackendPriority {
+		return ErrInvalidBackendPriority
+	}
+	for _, label := range []string{b.Region, b.Zone} {
+		if label != "" && !LocalityRegex.MatchString(label) {
+			return ErrInvalidBackendLocality
+		}
+	}
+	return validateLabels(b.Labels)
 }
 
 // IsHealthy returns true if the backend is in healthy state
@@ -101,6 +101,84 @@ func TestBackend_Validate(t *testing.T) {
 			},
 			wantErr: ErrInvalidBackendWeight,
 		},
+		{
+			name: "valid standby priority",
+			backend: Backend{
+				ID:       "be-1",
+				Address:  "10.0.0.1",
+				Port:     8080,
+				Priority: 1,
+				Enabled:  true,
+			},
+			wantErr: nil,
+		},
+		{
+			name: "valid locality",
+			backend: Backend{
+				ID:      "be-1",
+				Address: "10.0.0.1",
+				Port:    8080,
+				Region:  "eu-west-1",
+				Zone:    "eu-west-1a",
+				Enabled: true,
+			},
+			wantErr: nil,
+		},
+		{
+			name: "invalid zone",
+			backend: Backend{
+				ID:      "be-1",
+				Address: "10.0.0.1",
+				Port:    8080,
+				Zone:    "zone a: {}",
+				Enabled: true,
+			},
+			wantErr: ErrInvalidBackendLocality,
+		},
+		{
+			name: "invalid priority - negative",
+			backend: Backend{
+				ID:       "be-1",
+				Address:  "10.0.0.1",
+				Port:     8080,
+				Priority: -1,
+				Enabled:  true,
+			},
+			wantErr: ErrInvalidBackendPriority,
+		},
+		{
+			name: "invalid priority - too high",
+			backend: Backend{
+				ID:       "be-1",
+				Address:  "10.0.0.1",
+				Port:     8080,
+				Priority: MaxBackendPriority + 1,
+				Enabled:  true,
+			},
+			wantErr: ErrInvalidBackendPriority,
+		},
+		{
+			name: "valid backend with labels",
+			backend: Backend{
+				ID:      "be-1",
+				Address: "10.0.0.1",
+				Port:    80,
+				Enabled: true,
+				Labels:  map[string]string{"version": "v2", "example.com/tier": "premium", "canary": ""},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "invalid label value",
+			backend: Backend{
+				ID:      "be-1",
+				Address: "10.0.0.1",
+				Port:    80,
+				Enabled: true,
+				Labels:  map[string]string{"version": "v2 beta"},
+			},
+			wantErr: ErrInvalidBackendLabels,
+		},
 		{
 			name: "edge case - port 1",
 			backend: Backend{
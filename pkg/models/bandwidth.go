@@ -0,0 +1,44 @@
+package models
+
+// Bandwidth limit bounds, in bytes per second
+const (
+	MinBandwidthLimit = 1024     // Envoy limits in KiB/s
+	MaxBandwidthLimit = 10 << 30 // 10 GiB/s
+)
+
+// BandwidthLimit caps the throughput of a load balancer, e.g. to the limits
+// of its plan. All connections of the listener share each limit. HTTP and
+// HTTPS load balancers only.
+type BandwidthLimit struct {
+	IngressBytesPerSecond int64 `json:"ingress_bytes_per_second,omitempty" yaml:"ingress_bytes_per_second,omitempty"` // request bodies from clients, 0 = unlimited
+	EgressBytesPerSecond  int64 `json:"egress_bytes_per_second,omitempty" yaml:"egress_bytes_per_second,omitempty"`   // response bodies to clients, 0 = unlimited
+}
+
+// Validate validates the bandwidth limit
+func (b *BandwidthLimit) Validate() error {
+	if b.IngressBytesPerSecond == 0 && b.EgressBytesPerSecond == 0 {
+		return ErrInvalidBandwidthLimit
+	}
+	for _, limit := range []int64{b.IngressBytesPerSecond, b.EgressBytesPerSecond} {
+		if limit != 0 && (limit < MinBandwidthLimit || limit > MaxBandwidthLimit) {
+			return ErrInvalidBandwidthLimit
+		}
+	}
+	return nil
+}
+
+// KiBPerSecond converts a limit in bytes per second to the KiB/s Envoy
+// enforces, rounding up
+func KiBPerSecond(bytesPerSecond int64) int64 {
+	return (bytesPerSecond + 1023) / 1024
+}
+
+func (lb *LoadBalancer) validateBandwidthLimit() error {
+	if lb.BandwidthLimit == nil {
+		return nil
+	}
+	if lb.Protocol == ProtocolTCP {
+		return ErrBandwidthLimitRequiresHTTP
+	}
+	return lb.BandwidthLimit.Validate()
+}
@@ -0,0 +1,65 @@
+package models
+
+import "testing"
+
+func TestLoadBalancer_Validate_BandwidthLimit(t *testing.T) {
+	limitLB := func(protocol Protocol, limit *BandwidthLimit) *LoadBalancer {
+		return &LoadBalancer{
+			ID: "lb-1", Name: "lb", Protocol: protocol, Algorithm: AlgoRoundRobin, Port: 80,
+			Backends:       []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+			BandwidthLimit: limit,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		lb      *LoadBalancer
+		wantErr error
+	}{
+		{
+			name: "both directions",
+			lb:   limitLB(ProtocolHTTP, &BandwidthLimit{IngressBytesPerSecond: 1 << 20, EgressBytesPerSecond: 10 << 20}),
+		},
+		{
+			name: "egress only",
+			lb:   limitLB(ProtocolHTTP, &BandwidthLimit{EgressBytesPerSecond: 5000}),
+		},
+		{
+			name:    "no limit",
+			lb:      limitLB(ProtocolHTTP, &BandwidthLimit{}),
+			wantErr: ErrInvalidBandwidthLimit,
+		},
+		{
+			name:    "below 1 KiB/s",
+			lb:      limitLB(ProtocolHTTP, &BandwidthLimit{IngressBytesPerSecond: 512}),
+			wantErr: ErrInvalidBandwidthLimit,
+		},
+		{
+			name:    "negative",
+			lb:      limitLB(ProtocolHTTP, &BandwidthLimit{IngressBytesPerSecond: 1 << 20, EgressBytesPerSecond: -1}),
+			wantErr: ErrInvalidBandwidthLimit,
+		},
+		{
+			name:    "tcp",
+			lb:      limitLB(ProtocolTCP, &BandwidthLimit{EgressBytesPerSecond: 1 << 20}),
+			wantErr: ErrBandwidthLimitRequiresHTTP,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.lb.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKiBPerSecond(t *testing.T) {
+	tests := map[int64]int64{1024: 1, 1025: 2, 5000: 5, 10 << 20: 10240}
+	for bytes, want := range tests {
+		if got := KiBPerSecond(bytes); got != want {
+			t.Errorf("KiBPerSecond(%d) = %d, want %d", bytes, got, want)
+		}
+	}
+}
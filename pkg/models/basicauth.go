@@ -0,0 +1,81 @@
+package models
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Route access limits
+const (
+	MaxBasicAuthUsers   = 64
+	MaxAllowedCIDRs     = 64
+	defaultBasicAuthDir = "/etc/vpsie-lb/auth"
+)
+
+// htpasswdRegex matches an htpasswd entry with a SHA-1 digest, the only
+// format Envoy's basic auth filter verifies
+var htpasswdRegex = regexp.MustCompile(`^[a-zA-Z0-9._@-]{1,64}:\{SHA\}[A-Za-z0-9+/]{27}=$`)
+
+// BasicAuth requires HTTP basic authentication on a route, e.g. to keep a
+// staging hostname private. Credentials come inline or from an htpasswd file;
+// entries are "name:{SHA}digest" as written by `htpasswd -s`.
+type BasicAuth struct {
+	Users     []string `json:"users,omitempty" yaml:"users,omitempty"`           // htpasswd entries
+	UsersFile string   `json:"users_file,omitempty" yaml:"users_file,omitempty"` // htpasswd file under /etc/vpsie-lb/auth; replaces users
+}
+
+// Validate validates the credentials
+func (b *BasicAuth) Validate() error {
+	if (len(b.Users) == 0) == (b.UsersFile == "") || len(b.Users) > MaxBasicAuthUsers {
+		return ErrInvalidBasicAuth
+	}
+	names := make(map[string]bool, len(b.Users))
+	for _, user := range b.Users {
+		if !htpasswdRegex.MatchString(user) {
+			return ErrInvalidBasicAuth
+		}
+		name := user[:strings.IndexByte(user, ':')]
+		if names[name] {
+			return ErrInvalidBasicAuth
+		}
+		names[name] = true
+	}
+	if b.UsersFile != "" {
+		if err := validateTLSFilePath(b.UsersFile, defaultBasicAuthDir); err != nil {
+			return ErrInvalidBasicAuth
+		}
+	}
+	return nil
+}
+
+// validateAccess validates the route's client restrictions
+func (r *Route) validateAccess() error {
+	if len(r.AllowedCIDRs) > MaxAllowedCIDRs {
+		return ErrInvalidAllowedCIDRs
+	}
+	for _, cidr := range r.AllowedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return ErrInvalidAllowedCIDRs
+		}
+	}
+	if r.BasicAuth != nil {
+		return r.BasicAuth.Validate()
+	}
+	return nil
+}
+
+// validateRouteAccess checks that basic auth routes do not also require a
+// token: both are sent in the Authorization header
+func (lb *LoadBalancer) validateRouteAccess() error {
+	if lb.JWTAuth == nil {
+		return nil
+	}
+	for i := range lb.Routes {
+		route := &lb.Routes[i]
+		if route.BasicAuth != nil && (route.JWT == nil || !route.JWT.Disabled) {
+			return ErrBasicAuthWithJWT
+		}
+	}
+	return nil
+}
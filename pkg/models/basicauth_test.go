@@ -0,0 +1,85 @@
+package models
+
+import "testing"
+
+// staging is an htpasswd entry for the password "password"
+const staging = "staging:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="
+
+func accessLoadBalancer(route Route) *LoadBalancer {
+	route.Name, route.Path = "staging", "/"
+	return &LoadBalancer{
+		ID: "lb-1", Name: "lb", Protocol: ProtocolHTTP, Algorithm: AlgoRoundRobin, Port: 80,
+		Backends: []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+		Routes:   []Route{route},
+	}
+}
+
+func TestLoadBalancer_Validate_RouteAccess(t *testing.T) {
+	withJWT := func(route Route) *LoadBalancer {
+		lb := accessLoadBalancer(route)
+		lb.JWTAuth = &JWTAuth{Providers: []JWTProvider{{Name: "auth0", Issuer: "auth0", JWKSURI: "https://auth0.example.com/keys"}}}
+		return lb
+	}
+
+	tests := []struct {
+		name    string
+		lb      *LoadBalancer
+		wantErr error
+	}{
+		{
+			name: "inline users from the office",
+			lb:   accessLoadBalancer(Route{BasicAuth: &BasicAuth{Users: []string{staging}}, AllowedCIDRs: []string{"203.0.113.0/24", "2001:db8::/32"}}),
+		},
+		{
+			name: "users file",
+			lb:   accessLoadBalancer(Route{BasicAuth: &BasicAuth{UsersFile: "/etc/vpsie-lb/auth/staging.htpasswd"}}),
+		},
+		{
+			name: "basic auth with jwt disabled on the route",
+			lb:   withJWT(Route{BasicAuth: &BasicAuth{Users: []string{staging}}, JWT: &RouteJWT{Disabled: true}}),
+		},
+		{
+			name:    "basic auth on a route requiring a token",
+			lb:      withJWT(Route{BasicAuth: &BasicAuth{Users: []string{staging}}}),
+			wantErr: ErrBasicAuthWithJWT,
+		},
+		{
+			name:    "no credentials",
+			lb:      accessLoadBalancer(Route{BasicAuth: &BasicAuth{}}),
+			wantErr: ErrInvalidBasicAuth,
+		},
+		{
+			name:    "users and a users file",
+			lb:      accessLoadBalancer(Route{BasicAuth: &BasicAuth{Users: []string{staging}, UsersFile: "/etc/vpsie-lb/auth/staging.htpasswd"}}),
+			wantErr: ErrInvalidBasicAuth,
+		},
+		{
+			name:    "bcrypt digest",
+			lb:      accessLoadBalancer(Route{BasicAuth: &BasicAuth{Users: []string{"staging:$2y$05$c4WoMPo3SXsafkva.HHa6uXQZWr7oboPiC2bT/r7q1BB8I2s0BRqC"}}}),
+			wantErr: ErrInvalidBasicAuth,
+		},
+		{
+			name:    "duplicate user",
+			lb:      accessLoadBalancer(Route{BasicAuth: &BasicAuth{Users: []string{staging, staging}}}),
+			wantErr: ErrInvalidBasicAuth,
+		},
+		{
+			name:    "users file outside the auth directory",
+			lb:      accessLoadBalancer(Route{BasicAuth: &BasicAuth{UsersFile: "/etc/passwd"}}),
+			wantErr: ErrInvalidBasicAuth,
+		},
+		{
+			name:    "allowed address without a prefix length",
+			lb:      accessLoadBalancer(Route{AllowedCIDRs: []string{"203.0.113.7"}}),
+			wantErr: ErrInvalidAllowedCIDRs,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.lb.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
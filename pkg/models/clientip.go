@@ -0,0 +1,72 @@
+package models
+
+import "net"
+
+// XFFMode selects how an HTTP load balancer treats the X-Forwarded-For header
+type XFFMode string
+
+const (
+	// XFFAppend appends the client address to X-Forwarded-For (default)
+	XFFAppend XFFMode = "append"
+	// XFFOverwrite replaces X-Forwarded-For with the detected client address
+	XFFOverwrite XFFMode = "overwrite"
+	// XFFPreserve passes X-Forwarded-For to backends unchanged
+	XFFPreserve XFFMode = "preserve"
+)
+
+// maxTrustedHops bounds xff_num_trusted_hops; longer proxy chains are unusual
+const maxTrustedHops = 10
+
+// ClientIP configures how the client address is detected and passed on, so
+// backends see the real client behind chained proxies. The X-Forwarded-For
+// settings apply to HTTP and HTTPS load balancers, PreserveSource to TCP.
+type ClientIP struct {
+	XFFNumTrustedHops int      `json:"xff_num_trusted_hops,omitempty" yaml:"xff_num_trusted_hops,omitempty"` // proxies in front of the load balancer whose X-Forwarded-For entries are trusted
+	TrustedCIDRs      []string `json:"trusted_cidrs,omitempty" yaml:"trusted_cidrs,omitempty"`               // trust X-Forwarded-For entries added by these proxies; replaces xff_num_trusted_hops
+	XFFMode           XFFMode  `json:"xff_mode,omitempty" yaml:"xff_mode,omitempty"`                         // append (default), overwrite or preserve
+	SetRealIP         bool     `json:"set_real_ip,omitempty" yaml:"set_real_ip,omitempty"`                   // send the detected client address as X-Real-IP
+	PreserveSource    bool     `json:"preserve_source,omitempty" yaml:"preserve_source,omitempty"`           // TCP: connect to backends from the client's address
+}
+
+// Validate validates the client IP settings on their own
+func (c *ClientIP) Validate() error {
+	if c.XFFNumTrustedHops < 0 || c.XFFNumTrustedHops > maxTrustedHops {
+		return ErrInvalidClientIP
+	}
+	// Envoy trusts either a hop count or a set of proxy ranges, not both
+	if c.XFFNumTrustedHops > 0 && len(c.TrustedCIDRs) > 0 {
+		return ErrInvalidClientIP
+	}
+	for _, cidr := range c.TrustedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return ErrInvalidClientIP
+		}
+	}
+	switch c.XFFMode {
+	case "", XFFAppend, XFFOverwrite, XFFPreserve:
+	default:
+		return ErrInvalidClientIP
+	}
+	return nil
+}
+
+// HasHTTPOptions returns true if any X-Forwarded-For or X-Real-IP option is set
+func (c *ClientIP) HasHTTPOptions() bool {
+	return c.XFFNumTrustedHops > 0 || len(c.TrustedCIDRs) > 0 || c.XFFMode != "" || c.SetRealIP
+}
+
+func (lb *LoadBalancer) validateClientIP() error {
+	if lb.ClientIP == nil {
+		return nil
+	}
+	if err := lb.ClientIP.Validate(); err != nil {
+		return err
+	}
+	if lb.Protocol == ProtocolTCP && lb.ClientIP.HasHTTPOptions() {
+		return ErrForwardedHeadersRequireHTTP
+	}
+	if lb.Protocol != ProtocolTCP && lb.ClientIP.PreserveSource {
+		return ErrPreserveSourceRequiresTCP
+	}
+	return nil
+}
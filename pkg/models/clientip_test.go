@@ -0,0 +1,77 @@
+package models
+
+import "testing"
+
+func TestClientIP_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantErr  error
+		clientIP ClientIP
+	}{
+		{
+			name:     "trusted hops and overwrite",
+			clientIP: ClientIP{XFFNumTrustedHops: 1, XFFMode: XFFOverwrite, SetRealIP: true},
+			wantErr:  nil,
+		},
+		{
+			name:     "trusted CIDRs",
+			clientIP: ClientIP{TrustedCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"}},
+			wantErr:  nil,
+		},
+		{
+			name:     "too many hops",
+			clientIP: ClientIP{XFFNumTrustedHops: 11},
+			wantErr:  ErrInvalidClientIP,
+		},
+		{
+			name:     "hops and CIDRs",
+			clientIP: ClientIP{XFFNumTrustedHops: 1, TrustedCIDRs: []string{"10.0.0.0/8"}},
+			wantErr:  ErrInvalidClientIP,
+		},
+		{
+			name:     "invalid CIDR",
+			clientIP: ClientIP{TrustedCIDRs: []string{"10.0.0.1"}},
+			wantErr:  ErrInvalidClientIP,
+		},
+		{
+			name:     "unknown mode",
+			clientIP: ClientIP{XFFMode: "strip"},
+			wantErr:  ErrInvalidClientIP,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.clientIP.Validate()
+			if err != tt.wantErr {
+				t.Errorf("ClientIP.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_Validate_ClientIPProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol Protocol
+		wantErr  error
+		clientIP ClientIP
+	}{
+		{name: "tcp preserve source", protocol: ProtocolTCP, clientIP: ClientIP{PreserveSource: true}},
+		{name: "tcp xff", protocol: ProtocolTCP, clientIP: ClientIP{XFFNumTrustedHops: 1}, wantErr: ErrForwardedHeadersRequireHTTP},
+		{name: "http preserve source", protocol: ProtocolHTTP, clientIP: ClientIP{PreserveSource: true}, wantErr: ErrPreserveSourceRequiresTCP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := &LoadBalancer{
+				ID: "lb-1", Name: "lb", Protocol: tt.protocol, Algorithm: AlgoRoundRobin, Port: 8080,
+				Backends: []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}},
+				ClientIP: &tt.clientIP,
+			}
+			if err := lb.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
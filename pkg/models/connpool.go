@@ -0,0 +1,71 @@
+package models
+
+// ConnectionPool defines upstream connection pool sizing for the backend pool,
+// for backends with strict connection limits. A pool's connection_pool
+// overrides the fields it sets.
+type ConnectionPool struct {
+	MaxConnectionsPerHost    int  `json:"max_connections_per_host,omitempty" yaml:"max_connections_per_host,omitempty"`
+	MaxRequestsPerConnection int  `json:"max_requests_per_connection,omitempty" yaml:"max_requests_per_connection,omitempty"`
+	MaxConcurrentStreams     int  `json:"max_concurrent_streams,omitempty" yaml:"max_concurrent_streams,omitempty"` // HTTP/2 only
+	IdleTimeout              int  `json:"idle_timeout,omitempty" yaml:"idle_timeout,omitempty"`                     // seconds
+	HTTP2                    bool `json:"http2,omitempty" yaml:"http2,omitempty"`                                   // speak HTTP/2 to backends
+}
+
+// Validate validates the connection pool settings
+func (p *ConnectionPool) Validate() error {
+	if p.MaxConnectionsPerHost < 0 || p.MaxRequestsPerConnection < 0 || p.MaxConcurrentStreams < 0 {
+		return ErrInvalidConnectionPool
+	}
+	if p.MaxConcurrentStreams > 0 && !p.HTTP2 {
+		return ErrConcurrentStreamsNeedHTTP2
+	}
+	// HTTP/2 allows at most 2^31-1 concurrent streams
+	if p.MaxConcurrentStreams > 2147483647 {
+		return ErrInvalidConnectionPool
+	}
+	if p.IdleTimeout < 0 {
+		return ErrInvalidTimeout
+	}
+	return nil
+}
+
+// HasHTTPOptions returns true if any HTTP-level upstream protocol option is set
+func (p *ConnectionPool) HasHTTPOptions() bool {
+	return p.HTTP2 || p.IdleTimeout > 0 || p.MaxRequestsPerConnection > 0
+}
+
+// Merge returns p with the non-zero fields of override replacing its own.
+// Either may be nil.
+func (p *ConnectionPool) Merge(override *ConnectionPool) *ConnectionPool {
+	if override == nil {
+		return p
+	}
+	if p == nil {
+		return override
+	}
+	merged := *p
+	if override.MaxConnectionsPerHost != 0 {
+		merged.MaxConnectionsPerHost = override.MaxConnectionsPerHost
+	}
+	if override.MaxRequestsPerConnection != 0 {
+		merged.MaxRequestsPerConnection = override.MaxRequestsPerConnection
+	}
+	if override.MaxConcurrentStreams != 0 {
+		merged.MaxConcurrentStreams = override.MaxConcurrentStreams
+	}
+	if override.IdleTimeout != 0 {
+		merged.IdleTimeout = override.IdleTimeout
+	}
+	merged.HTTP2 = merged.HTTP2 || override.HTTP2
+	return &merged
+}
+
+// PoolConnectionPool returns the connection pool settings of pool: the load
+// balancer's, with the pool's overrides. A nil pool stands for the load
+// balancer's own backends.
+func (lb *LoadBalancer) PoolConnectionPool(pool *BackendPool) *ConnectionPool {
+	if pool == nil {
+		return lb.ConnectionPool
+	}
+	return lb.ConnectionPool.Merge(pool.ConnectionPool)
+}
@@ -0,0 +1,101 @@
+package models
+
+import "testing"
+
+func TestConnectionPool_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr error
+		pool    ConnectionPool
+	}{
+		{
+			name:    "valid HTTP/1.1 pool",
+			pool:    ConnectionPool{MaxConnectionsPerHost: 50, MaxRequestsPerConnection: 1000, IdleTimeout: 60},
+			wantErr: nil,
+		},
+		{
+			name:    "valid HTTP/2 pool",
+			pool:    ConnectionPool{HTTP2: true, MaxConcurrentStreams: 100},
+			wantErr: nil,
+		},
+		{
+			name:    "negative per-host connections",
+			pool:    ConnectionPool{MaxConnectionsPerHost: -1},
+			wantErr: ErrInvalidConnectionPool,
+		},
+		{
+			name:    "concurrent streams without HTTP/2",
+			pool:    ConnectionPool{MaxConcurrentStreams: 100},
+			wantErr: ErrConcurrentStreamsNeedHTTP2,
+		},
+		{
+			name:    "negative idle timeout",
+			pool:    ConnectionPool{IdleTimeout: -5},
+			wantErr: ErrInvalidTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.pool.Validate()
+			if err != tt.wantErr {
+				t.Errorf("ConnectionPool.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_Validate_HTTP2RequiresHTTP(t *testing.T) {
+	lb := LoadBalancer{
+		ID:             "lb-1",
+		Name:           "tcp-lb",
+		Protocol:       ProtocolTCP,
+		Algorithm:      AlgoRoundRobin,
+		Port:           3306,
+		Backends:       []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 3306, Enabled: true}},
+		ConnectionPool: &ConnectionPool{HTTP2: true},
+	}
+
+	if err := lb.Validate(); err != ErrHTTP2RequiresHTTPProtocol {
+		t.Errorf("Validate() error = %v, want %v", err, ErrHTTP2RequiresHTTPProtocol)
+	}
+}
+
+func TestLoadBalancer_PoolConnectionPool(t *testing.T) {
+	lb := LoadBalancer{
+		ConnectionPool: &ConnectionPool{MaxConnectionsPerHost: 100, IdleTimeout: 60},
+		Pools: []BackendPool{
+			{Name: "api"},
+			{Name: "legacy", ConnectionPool: &ConnectionPool{MaxConnectionsPerHost: 4}},
+		},
+	}
+
+	if got := lb.PoolConnectionPool(nil); got != lb.ConnectionPool {
+		t.Errorf("PoolConnectionPool(nil) = %+v, want the load balancer's", got)
+	}
+	if got := lb.PoolConnectionPool(&lb.Pools[0]); *got != *lb.ConnectionPool {
+		t.Errorf("PoolConnectionPool(api) = %+v, want the load balancer's", got)
+	}
+	want := ConnectionPool{MaxConnectionsPerHost: 4, IdleTimeout: 60}
+	if got := lb.PoolConnectionPool(&lb.Pools[1]); *got != want {
+		t.Errorf("PoolConnectionPool(legacy) = %+v, want %+v", got, want)
+	}
+	if lb.ConnectionPool.MaxConnectionsPerHost != 100 {
+		t.Errorf("the override changed the load balancer's pool: %+v", lb.ConnectionPool)
+	}
+
+	// Overrides are validated merged with the load balancer's settings
+	lb = LoadBalancer{
+		ID: "lb-1", Name: "web", Protocol: ProtocolHTTP, Algorithm: AlgoRoundRobin, Port: 80,
+		Backends:       []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}},
+		ConnectionPool: &ConnectionPool{HTTP2: true},
+		Pools:          []BackendPool{{Name: "grpc", Selector: "tier=grpc", ConnectionPool: &ConnectionPool{MaxConcurrentStreams: 100}}},
+	}
+	if err := lb.Validate(); err != nil {
+		t.Errorf("Validate() error = %v, want streams allowed over the load balancer's HTTP/2", err)
+	}
+	lb.Pools[0].ConnectionPool.MaxConnectionsPerHost = -1
+	if err := lb.Validate(); err != ErrInvalidConnectionPool {
+		t.Errorf("Validate() error = %v, want %v", err, ErrInvalidConnectionPool)
+	}
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// CustomFilterType selects how a custom filter is implemented
+type CustomFilterType string
+
+const (
+	// CustomFilterLua runs an inline Lua script
+	CustomFilterLua CustomFilterType = "lua"
+	// CustomFilterWASM runs a WebAssembly module fetched from object storage
+	CustomFilterWASM CustomFilterType = "wasm"
+)
+
+// Custom filter limits
+const (
+	MaxCustomFilters   = 8
+	MaxLuaSourceBytes  = 64 << 10
+	MaxWASMModuleBytes = 32 << 20
+	MaxWASMConfigBytes = 16 << 10
+)
+
+var (
+	// luaHandlerRegex matches the definition of an Envoy Lua entry point
+	luaHandlerRegex = regexp.MustCompile(`\bfunction\s+envoy_on_(request|response)\s*\(`)
+	// luaUnsafeRegex matches the Lua libraries and loaders that reach the
+	// host or escape the checks, which scripts running inside Envoy must not
+	// use; fields and methods of other values (t.load, handle:load()) are fine
+	luaUnsafeRegex = regexp.MustCompile(`(^|[^.:\w])(os|io|debug|package|ffi|jit|_G|_ENV|require|dofile|loadfile|loadstring|load|setfenv|getfenv|rawget|rawset)\b`)
+	// sha256Regex matches a hex SHA-256 digest
+	sha256Regex = regexp.MustCompile(`^[a-f0-9]{64}$`)
+)
+
+// CustomFilter is an escape hatch for advanced users: a Lua script or WASM
+// module added to the HTTP filter chain after the access control filters.
+// Filters run in the order they are listed.
+type CustomFilter struct {
+	Name    string           `json:"name" yaml:"name"`
+	Type    CustomFilterType `json:"type" yaml:"type"`                         // lua or wasm
+	Enabled bool             `json:"enabled" yaml:"enabled"`                   // disabled filters are kept but not rendered
+	Source  string           `json:"source,omitempty" yaml:"source,omitempty"` // lua only, defines envoy_on_request and/or envoy_on_response
+	URL     string           `json:"url,omitempty" yaml:"url,omitempty"`       // wasm only, https URL of the module on VPSie object storage
+	SHA256  string           `json:"sha256,omitempty" yaml:"sha256,omitempty"` // wasm only, hex checksum of the module
+	Config  string           `json:"config,omitempty" yaml:"config,omitempty"` // wasm only, plugin configuration passed to the module
+}
+
+// Validate validates the custom filter on its own
+func (f *CustomFilter) Validate() error {
+	if f.Name == "" || !safeIdentifierRegex.MatchString(f.Name) || len(f.Name) > 64 {
+		return ErrInvalidCustomFilter
+	}
+	switch f.Type {
+	case CustomFilterLua:
+		if f.URL != "" || f.SHA256 != "" || f.Config != "" {
+			return ErrInvalidCustomFilter
+		}
+		if f.Source == "" || len(f.Source) > MaxLuaSourceBytes || !utf8.ValidString(f.Source) {
+			return ErrInvalidCustomFilter
+		}
+		code := luaCode(f.Source)
+		if !luaHandlerRegex.MatchString(code) || luaUnsafeRegex.MatchString(code) {
+			return ErrUnsafeLuaSource
+		}
+	case CustomFilterWASM:
+		if f.Source != "" || !sha256Regex.MatchString(f.SHA256) {
+			return ErrInvalidCustomFilter
+		}
+		if len(f.Config) > MaxWASMConfigBytes || !utf8.ValidString(f.Config) {
+			return ErrInvalidCustomFilter
+		}
+		if _, err := f.ModuleHost(); err != nil {
+			return err
+		}
+	default:
+		return ErrInvalidCustomFilter
+	}
+	return nil
+}
+
+// luaCode blanks the comments and string literals of a Lua script, so only
+// code is checked for unsafe names
+func luaCode(src string) string {
+	out := []byte(src)
+	blank := func(from, to int) {
+		for k := from; k < to && k < len(out); k++ {
+			if out[k] != '\n' {
+				out[k] = ' '
+			}
+		}
+	}
+	for i := 0; i < len(src); {
+		switch {
+		case strings.HasPrefix(src[i:], "--"):
+			end := len(src)
+			if n := luaLongBracketEnd(src, i+2); n > 0 {
+				end = n
+			} else if nl := strings.IndexByte(src[i:], '\n'); nl >= 0 {
+				end = i + nl
+			}
+			blank(i, end)
+			i = end
+		case src[i] == '[' && luaLongBracketEnd(src, i) > 0:
+			end := luaLongBracketEnd(src, i)
+			blank(i, end)
+			i = end
+		case src[i] == '"' || src[i] == '\'':
+			end := i + 1
+			for end < len(src) && src[end] != src[i] && src[end] != '\n' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(src))
+			blank(i, end)
+			i = end
+		default:
+			i++
+		}
+	}
+	return string(out)
+}
+
+// luaLongBracketEnd returns the index after the long bracket ([[...]] or
+// [==[...]==]) starting at i, len(src) when it is not closed, or 0 when no
+// long bracket starts at i
+func luaLongBracketEnd(src string, i int) int {
+	if i >= len(src) || src[i] != '[' {
+		return 0
+	}
+	level := 0
+	for i+1+level < len(src) && src[i+1+level] == '=' {
+		level++
+	}
+	if i+1+level >= len(src) || src[i+1+level] != '[' {
+		return 0
+	}
+	closing := "]" + strings.Repeat("=", level) + "]"
+	if n := strings.Index(src[i+2+level:], closing); n >= 0 {
+		return i + 2 + level + n + len(closing)
+	}
+	return len(src)
+}
+
+// ModuleHost returns the host a WASM module is fetched from
+func (f *CustomFilter) ModuleHost() (string, error) {
+	u, err := url.Parse(f.URL)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Fragment != "" {
+		return "", ErrInvalidModuleURL
+	}
+	host := u.Hostname()
+	if net.ParseIP(host) == nil && !HostnameRegex.MatchString(host) {
+		return "", ErrInvalidModuleURL
+	}
+	return host, nil
+}
+
+// ModuleFile returns the file name a WASM module is stored under, which
+// changes with its checksum
+func (f *CustomFilter) ModuleFile() string {
+	return f.SHA256 + ".wasm"
+}
+
+func (lb *LoadBalancer) validateCustomFilters() error {
+	if len(lb.CustomFilters) == 0 {
+		return nil
+	}
+	if lb.Protocol == ProtocolTCP {
+		return ErrCustomFiltersRequireHTTP
+	}
+	if len(lb.CustomFilters) > MaxCustomFilters {
+		return ErrInvalidCustomFilter
+	}
+	names := make(map[string]bool, len(lb.CustomFilters))
+	for i := range lb.CustomFilters {
+		f := &lb.CustomFilters[i]
+		if err := f.Validate(); err != nil {
+			return err
+		}
+		if names[f.Name] {
+			return ErrInvalidCustomFilter
+		}
+		names[f.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+const luaAddHeader = `-- Tag responses for the load test
+function envoy_on_response(response_handle)
+  response_handle:headers():add("x-served-by", "lb")
+end
+`
+
+const moduleSHA256 = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestLoadBalancer_Validate_CustomFilters(t *testing.T) {
+	filterLB := func(protocol Protocol, filters ...CustomFilter) *LoadBalancer {
+		return &LoadBalancer{
+			ID: "lb-1", Name: "lb", Protocol: protocol, Algorithm: AlgoRoundRobin, Port: 80,
+			Backends:      []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+			CustomFilters: filters,
+		}
+	}
+	lua := func(source string) CustomFilter {
+		return CustomFilter{Name: "tag", Type: CustomFilterLua, Enabled: true, Source: source}
+	}
+	wasm := func(url string) CustomFilter {
+		return CustomFilter{Name: "geoip", Type: CustomFilterWASM, URL: url, SHA256: moduleSHA256, Config: `{"db":"city"}`}
+	}
+
+	tests := []struct {
+		name    string
+		lb      *LoadBalancer
+		wantErr error
+	}{
+		{
+			name: "lua and wasm",
+			lb:   filterLB(ProtocolHTTP, lua(luaAddHeader), wasm("https://objects.vpsie.com/filters/geoip.wasm")),
+		},
+		{
+			name: "unsafe names in comments and strings",
+			lb:   filterLB(ProtocolHTTP, lua("-- no os.execute here\nfunction envoy_on_request(h)\n  h:logInfo([[load io]] .. 'debug')\nend\n")),
+		},
+		{
+			name: "method named like a library",
+			lb:   filterLB(ProtocolHTTP, lua("function envoy_on_request(h)\n  local t = {}\n  t.load = h:headers():get(\"x-load\")\nend\n")),
+		},
+		{
+			name:    "custom filters on tcp",
+			lb:      filterLB(ProtocolTCP, lua(luaAddHeader)),
+			wantErr: ErrCustomFiltersRequireHTTP,
+		},
+		{
+			name:    "lua without an entry point",
+			lb:      filterLB(ProtocolHTTP, lua("local x = 1\n")),
+			wantErr: ErrUnsafeLuaSource,
+		},
+		{
+			name:    "lua running commands",
+			lb:      filterLB(ProtocolHTTP, lua("function envoy_on_request(h)\n  os.execute('id')\nend\n")),
+			wantErr: ErrUnsafeLuaSource,
+		},
+		{
+			name:    "lua reaching globals",
+			lb:      filterLB(ProtocolHTTP, lua("function envoy_on_request(h)\n  _G['o'..'s'].exit()\nend\n")),
+			wantErr: ErrUnsafeLuaSource,
+		},
+		{
+			name:    "lua above the size limit",
+			lb:      filterLB(ProtocolHTTP, lua(luaAddHeader+strings.Repeat("-", MaxLuaSourceBytes))),
+			wantErr: ErrInvalidCustomFilter,
+		},
+		{
+			name:    "wasm over plain http",
+			lb:      filterLB(ProtocolHTTP, wasm("http://objects.vpsie.com/filters/geoip.wasm")),
+			wantErr: ErrInvalidModuleURL,
+		},
+		{
+			name: "wasm without a checksum",
+			lb: filterLB(ProtocolHTTP, CustomFilter{
+				Name: "geoip", Type: CustomFilterWASM, URL: "https://objects.vpsie.com/filters/geoip.wasm",
+			}),
+			wantErr: ErrInvalidCustomFilter,
+		},
+		{
+			name:    "duplicate name",
+			lb:      filterLB(ProtocolHTTP, lua(luaAddHeader), lua(luaAddHeader)),
+			wantErr: ErrInvalidCustomFilter,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.lb.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
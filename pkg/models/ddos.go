@@ -0,0 +1,66 @@
+package models
+
+// Connection flood protection bounds
+const (
+	MaxConnectionRate     = 1000000 // new connections per second
+	MaxConnectionsPerIP   = 65535
+	MaxAttackCooldown     = 3600 // seconds
+	DefaultAttackCooldown = 300  // seconds
+)
+
+// DDoSProtection limits connection floods. The connection rate is enforced by
+// Envoy; the per-source limits need the agent to program the host firewall,
+// which counts new connections and enters attack mode while they arrive
+// faster than the attack threshold.
+type DDoSProtection struct {
+	ConnectionRate      int `json:"connection_rate,omitempty" yaml:"connection_rate,omitempty"`               // new connections per second the listener accepts, 0 = unlimited
+	ConnectionBurst     int `json:"connection_burst,omitempty" yaml:"connection_burst,omitempty"`             // connections accepted at once, at least connection_rate (default connection_rate)
+	MaxConnectionsPerIP int `json:"max_connections_per_ip,omitempty" yaml:"max_connections_per_ip,omitempty"` // concurrent connections per source address, 0 = unlimited
+	AttackThreshold     int `json:"attack_threshold,omitempty" yaml:"attack_threshold,omitempty"`             // new connections per second that start attack mode, 0 = never
+	SourceRateLimit     int `json:"source_rate_limit,omitempty" yaml:"source_rate_limit,omitempty"`           // attack mode: SYNs per second per source address
+	AttackCooldown      int `json:"attack_cooldown,omitempty" yaml:"attack_cooldown,omitempty"`               // seconds below the threshold before attack mode ends (default 300)
+}
+
+// Validate validates the connection flood protection
+func (d *DDoSProtection) Validate() error {
+	if d.ConnectionRate < 0 || d.ConnectionRate > MaxConnectionRate {
+		return ErrInvalidDDoSProtection
+	}
+	if d.ConnectionBurst != 0 && (d.ConnectionRate == 0 || d.ConnectionBurst < d.ConnectionRate || d.ConnectionBurst > MaxConnectionRate) {
+		return ErrInvalidDDoSProtection
+	}
+	if d.MaxConnectionsPerIP < 0 || d.MaxConnectionsPerIP > MaxConnectionsPerIP {
+		return ErrInvalidDDoSProtection
+	}
+	if d.AttackThreshold < 0 || d.AttackThreshold > MaxConnectionRate || d.SourceRateLimit < 0 || d.SourceRateLimit > MaxConnectionRate {
+		return ErrInvalidDDoSProtection
+	}
+	// Attack mode is nothing without a limit to apply, and the other way round
+	if (d.AttackThreshold > 0) != (d.SourceRateLimit > 0) {
+		return ErrInvalidDDoSProtection
+	}
+	if d.AttackCooldown < 0 || d.AttackCooldown > MaxAttackCooldown {
+		return ErrInvalidDDoSProtection
+	}
+	return nil
+}
+
+// Burst returns the number of connections the listener accepts at once
+func (d *DDoSProtection) Burst() int {
+	if d.ConnectionBurst > 0 {
+		return d.ConnectionBurst
+	}
+	return d.ConnectionRate
+}
+
+// NeedsFirewall reports whether the protection relies on host firewall rules
+func (d *DDoSProtection) NeedsFirewall() bool {
+	return d.MaxConnectionsPerIP > 0 || d.AttackThreshold > 0
+}
+
+func (lb *LoadBalancer) validateDDoSProtection() error {
+	if lb.DDoS == nil {
+		return nil
+	}
+	return lb.DDoS.Validate()
+}
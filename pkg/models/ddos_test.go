@@ -0,0 +1,69 @@
+package models
+
+import "testing"
+
+func TestLoadBalancer_Validate_DDoSProtection(t *testing.T) {
+	ddosLB := func(protocol Protocol, ddos *DDoSProtection) *LoadBalancer {
+		return &LoadBalancer{
+			ID: "lb-1", Name: "lb", Protocol: protocol, Algorithm: AlgoRoundRobin, Port: 443,
+			Backends: []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 443, Enabled: true}},
+			DDoS:     ddos,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		lb      *LoadBalancer
+		wantErr error
+	}{
+		{
+			name: "all knobs",
+			lb: ddosLB(ProtocolHTTP, &DDoSProtection{
+				ConnectionRate: 500, ConnectionBurst: 1000, MaxConnectionsPerIP: 100,
+				AttackThreshold: 5000, SourceRateLimit: 20, AttackCooldown: 60,
+			}),
+		},
+		{
+			name: "connection rate on tcp",
+			lb:   ddosLB(ProtocolTCP, &DDoSProtection{ConnectionRate: 500}),
+		},
+		{
+			name:    "burst without a rate",
+			lb:      ddosLB(ProtocolTCP, &DDoSProtection{ConnectionBurst: 100}),
+			wantErr: ErrInvalidDDoSProtection,
+		},
+		{
+			name:    "burst below the rate",
+			lb:      ddosLB(ProtocolTCP, &DDoSProtection{ConnectionRate: 500, ConnectionBurst: 100}),
+			wantErr: ErrInvalidDDoSProtection,
+		},
+		{
+			name:    "negative per-source limit",
+			lb:      ddosLB(ProtocolTCP, &DDoSProtection{MaxConnectionsPerIP: -1}),
+			wantErr: ErrInvalidDDoSProtection,
+		},
+		{
+			name:    "attack threshold without a source rate limit",
+			lb:      ddosLB(ProtocolTCP, &DDoSProtection{AttackThreshold: 5000}),
+			wantErr: ErrInvalidDDoSProtection,
+		},
+		{
+			name:    "source rate limit without an attack threshold",
+			lb:      ddosLB(ProtocolTCP, &DDoSProtection{SourceRateLimit: 20}),
+			wantErr: ErrInvalidDDoSProtection,
+		},
+		{
+			name:    "cooldown above the limit",
+			lb:      ddosLB(ProtocolTCP, &DDoSProtection{AttackThreshold: 5000, SourceRateLimit: 20, AttackCooldown: MaxAttackCooldown + 1}),
+			wantErr: ErrInvalidDDoSProtection,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.lb.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package models
+
+import "regexp"
+
+// DiscoveryType selects where discovered backends come from
+type DiscoveryType string
+
+const (
+	// DiscoveryVPSieTag adds the VPSie servers carrying a tag
+	DiscoveryVPSieTag DiscoveryType = "vpsie_tag"
+	// DiscoveryConsul adds the passing instances of a Consul service
+	DiscoveryConsul DiscoveryType = "consul"
+)
+
+// discoveryNameRegex validates tags, service names and datacenters, which
+// end up in API query strings
+var discoveryNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._:-]{0,127}$`)
+
+// Discovery adds backends found by querying VPSie or Consul to the
+// configured ones. The agent refreshes the query periodically, so servers
+// joining or leaving a scaling group join or leave the load balancer without
+// a configuration change.
+type Discovery struct {
+	Type       DiscoveryType `json:"type" yaml:"type"`
+	Tag        string        `json:"tag,omitempty" yaml:"tag,omitempty"`               // vpsie_tag: servers with this tag; consul: only instances with this tag
+	Service    string        `json:"service,omitempty" yaml:"service,omitempty"`       // consul service name
+	Datacenter string        `json:"datacenter,omitempty" yaml:"datacenter,omitempty"` // consul datacenter, empty = the agent's
+	Port       int           `json:"port,omitempty" yaml:"port,omitempty"`             // backend port; required for vpsie_tag, overrides the registered port for consul
+	Weight     int           `json:"weight,omitempty" yaml:"weight,omitempty"`         // weight of every discovered backend
+}
+
+// Validate validates the discovery query
+func (d *Discovery) Validate() error {
+	switch d.Type {
+	case DiscoveryVPSieTag:
+		if d.Tag == "" || d.Port == 0 || d.Service != "" || d.Datacenter != "" {
+			return ErrInvalidDiscovery
+		}
+	case DiscoveryConsul:
+		if d.Service == "" {
+			return ErrInvalidDiscovery
+		}
+	default:
+		return ErrInvalidDiscoveryType
+	}
+	for _, name := range []string{d.Tag, d.Service, d.Datacenter} {
+		if name != "" && !discoveryNameRegex.MatchString(name) {
+			return ErrInvalidDiscovery
+		}
+	}
+	if d.Port < 0 || d.Port > 65535 || d.Weight < 0 {
+		return ErrInvalidDiscovery
+	}
+	return nil
+}
+
+func (lb *LoadBalancer) validateDiscovery() error {
+	if lb.Discovery == nil {
+		return nil
+	}
+	return lb.Discovery.Validate()
+}
+
+// HasDefaultPool reports whether the load balancer has backends of its own,
+// configured or discovered, besides its named pools
+func (lb *LoadBalancer) HasDefaultPool() bool {
+	return len(lb.Backends) > 0 || lb.Discovery != nil
+}
@@ -0,0 +1,46 @@
+package models
+
+import "testing"
+
+func TestDiscovery_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantErr   error
+		discovery Discovery
+	}{
+		{name: "vpsie tag", discovery: Discovery{Type: DiscoveryVPSieTag, Tag: "web-asg", Port: 8080}},
+		{name: "consul service", discovery: Discovery{Type: DiscoveryConsul, Service: "web", Tag: "v2", Datacenter: "fra1"}},
+		{name: "unknown type", discovery: Discovery{Type: "etcd", Service: "web"}, wantErr: ErrInvalidDiscoveryType},
+		{name: "vpsie tag without port", discovery: Discovery{Type: DiscoveryVPSieTag, Tag: "web-asg"}, wantErr: ErrInvalidDiscovery},
+		{name: "vpsie tag with service", discovery: Discovery{Type: DiscoveryVPSieTag, Tag: "web", Service: "web", Port: 80}, wantErr: ErrInvalidDiscovery},
+		{name: "consul without service", discovery: Discovery{Type: DiscoveryConsul}, wantErr: ErrInvalidDiscovery},
+		{name: "unsafe service name", discovery: Discovery{Type: DiscoveryConsul, Service: "web?passing=false"}, wantErr: ErrInvalidDiscovery},
+		{name: "port out of range", discovery: Discovery{Type: DiscoveryConsul, Service: "web", Port: 70000}, wantErr: ErrInvalidDiscovery},
+		{name: "negative weight", discovery: Discovery{Type: DiscoveryConsul, Service: "web", Weight: -1}, wantErr: ErrInvalidDiscovery},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.discovery.Validate(); err != tt.wantErr {
+				t.Errorf("Discovery.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_Validate_DiscoveryOnly(t *testing.T) {
+	lb := &LoadBalancer{
+		ID: "lb-1", Name: "web", Protocol: ProtocolHTTP, Algorithm: AlgoRoundRobin, Port: 80,
+		Discovery: &Discovery{Type: DiscoveryConsul, Service: "web"},
+		Pools:     []BackendPool{{Name: "api", Discovery: &Discovery{Type: DiscoveryVPSieTag, Tag: "api", Port: 9000}}},
+		Routes:    []Route{{Name: "api", Path: "/api", Pool: "api"}, {Name: "root", Path: "/"}},
+	}
+	if err := lb.Validate(); err != nil {
+		t.Errorf("Validate() error = %v, want discovered backends to count as backends", err)
+	}
+
+	lb.Pools[0].Discovery = &Discovery{Type: DiscoveryVPSieTag, Tag: "api"}
+	if err := lb.Validate(); err != ErrInvalidDiscovery {
+		t.Errorf("Validate() error = %v, want %v for the pool's query", err, ErrInvalidDiscovery)
+	}
+}
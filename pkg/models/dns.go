@@ -0,0 +1,32 @@
+package models
+
+// MaxDNSRefreshRate bounds dns.refresh_rate (seconds)
+const MaxDNSRefreshRate = 3600
+
+// DNSDiscovery configures how backend hostnames are resolved. Envoy resolves
+// them itself and follows address changes without a configuration update,
+// unless Pin is set.
+type DNSDiscovery struct {
+	RefreshRate int  `json:"refresh_rate,omitempty" yaml:"refresh_rate,omitempty"` // seconds between lookups, 0 = Envoy's default of 5, or 30 when pinned
+	RespectTTL  bool `json:"respect_ttl,omitempty" yaml:"respect_ttl,omitempty"`   // refresh when the records' TTL expires instead
+	Pin         bool `json:"pin,omitempty" yaml:"pin,omitempty"`                   // the agent resolves hostnames and gives Envoy the addresses
+}
+
+// Validate validates the DNS discovery settings
+func (d *DNSDiscovery) Validate() error {
+	if d.RefreshRate < 0 || d.RefreshRate > MaxDNSRefreshRate {
+		return ErrInvalidDNSDiscovery
+	}
+	// The agent's resolver does not see record TTLs
+	if d.Pin && d.RespectTTL {
+		return ErrDNSPinRespectTTL
+	}
+	return nil
+}
+
+func (lb *LoadBalancer) validateDNS() error {
+	if lb.DNS == nil {
+		return nil
+	}
+	return lb.DNS.Validate()
+}
@@ -0,0 +1,47 @@
+package models
+
+import "testing"
+
+func TestDNSDiscovery_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr error
+		dns     DNSDiscovery
+	}{
+		{name: "defaults", dns: DNSDiscovery{}},
+		{name: "refresh rate and TTL", dns: DNSDiscovery{RefreshRate: 30, RespectTTL: true}},
+		{name: "negative refresh rate", dns: DNSDiscovery{RefreshRate: -1}, wantErr: ErrInvalidDNSDiscovery},
+		{name: "refresh rate too long", dns: DNSDiscovery{RefreshRate: MaxDNSRefreshRate + 1}, wantErr: ErrInvalidDNSDiscovery},
+		{name: "pinned", dns: DNSDiscovery{RefreshRate: 60, Pin: true}},
+		{name: "pinned with TTL", dns: DNSDiscovery{Pin: true, RespectTTL: true}, wantErr: ErrDNSPinRespectTTL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.dns.Validate(); err != tt.wantErr {
+				t.Errorf("DNSDiscovery.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBackend_Validate_DiscoverAll(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		wantErr error
+	}{
+		{name: "hostname", address: "web.internal"},
+		{name: "IPv4 address", address: "10.0.0.1", wantErr: ErrDiscoverAllNeedsName},
+		{name: "IPv6 address", address: "fd00::1", wantErr: ErrDiscoverAllNeedsName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := Backend{ID: "be-1", Address: tt.address, Port: 80, DiscoverAll: true, Enabled: true}
+			if err := backend.Validate(); err != tt.wantErr {
+				t.Errorf("Backend.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
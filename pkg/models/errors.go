@@ -12,14 +12,20 @@ var (
 	ErrInvalidAlgorithm = errors.New("invalid load balancing algorithm")
 	ErrMissingTLSConfig = errors.New("HTTPS protocol requires TLS configuration")
 	ErrInvalidTimeout   = errors.New("timeout values must be non-negative")
+	ErrInvalidMaxConns  = errors.New("max_connections must be non-negative")
+	ErrInvalidAddresses = errors.New("addresses must be up to 16 distinct IPs, or a single wildcard")
 )
 
 // Backend validation errors
 var (
-	ErrInvalidBackendID      = errors.New("invalid backend ID")
-	ErrInvalidBackendAddress = errors.New("invalid backend address")
-	ErrInvalidBackendPort    = errors.New("invalid backend port")
-	ErrInvalidBackendWeight  = errors.New("invalid backend weight")
+	ErrInvalidBackendID       = errors.New("invalid backend ID")
+	ErrInvalidBackendAddress  = errors.New("invalid backend address")
+	ErrInvalidBackendPort     = errors.New("invalid backend port")
+	ErrInvalidBackendWeight   = errors.New("invalid backend weight")
+	ErrInvalidBackendPriority = errors.New("invalid backend priority")
+	ErrInvalidBackendLocality = errors.New("invalid backend region or zone")
+	ErrInvalidBackendLabels   = errors.New("invalid backend labels")
+	ErrDiscoverAllNeedsName   = errors.New("discover_all requires a backend hostname")
 )
 
 // Health check validation errors
@@ -33,9 +39,186 @@ var (
 	ErrMissingHealthCheckPath     = errors.New("HTTP/HTTPS health check requires path")
 )
 
+// Retry policy errors
+var (
+	ErrInvalidRetryCount  = errors.New("retry count must be between 0 and 10")
+	ErrInvalidRetryOn     = errors.New("invalid retry_on condition")
+	ErrInvalidRetryBudget = errors.New("retry budget percent must be between 0 and 100")
+)
+
+// Connection pool errors
+var (
+	ErrInvalidConnectionPool      = errors.New("connection pool limits must be non-negative")
+	ErrConcurrentStreamsNeedHTTP2 = errors.New("max_concurrent_streams requires http2 upstreams")
+	ErrHTTP2RequiresHTTPProtocol  = errors.New("http2 upstreams require an HTTP or HTTPS load balancer")
+)
+
+// Tracing errors
+var (
+	ErrInvalidTracingProvider = errors.New("tracing provider must be opentelemetry or zipkin")
+	ErrInvalidTracing         = errors.New("invalid tracing configuration")
+	ErrTracingRequiresHTTP    = errors.New("tracing requires an HTTP or HTTPS load balancer")
+)
+
+// WAF errors
+var (
+	ErrInvalidWAFMode  = errors.New("waf mode must be block or detect")
+	ErrInvalidWAF      = errors.New("invalid waf configuration")
+	ErrWAFRequiresHTTP = errors.New("waf requires an HTTP or HTTPS load balancer")
+)
+
+// Authorization errors
+var (
+	ErrInvalidAuthorizationProtocol = errors.New("authorization protocol must be grpc or http")
+	ErrInvalidAuthorization         = errors.New("invalid authorization configuration")
+	ErrAuthorizationRequiresHTTP    = errors.New("authorization requires an HTTP or HTTPS load balancer")
+)
+
+// JWT errors
+var (
+	ErrInvalidJWTAuth      = errors.New("invalid jwt_auth configuration")
+	ErrInvalidJWKSURI      = errors.New("jwks_uri must be an http or https URL without credentials, query or fragment")
+	ErrJWTRequiresHTTP     = errors.New("jwt_auth requires an HTTP or HTTPS load balancer")
+	ErrInvalidRouteJWT     = errors.New("invalid route jwt configuration")
+	ErrRouteJWTWithoutAuth = errors.New("route jwt settings require jwt_auth")
+	ErrUnknownJWTProvider  = errors.New("route jwt references an undefined provider")
+)
+
+// Route access errors
+var (
+	ErrInvalidBasicAuth    = errors.New("basic_auth needs either users or users_file, with unique name:{SHA}digest entries")
+	ErrInvalidAllowedCIDRs = errors.New("invalid route allowed_cidrs")
+	ErrBasicAuthWithJWT    = errors.New("basic_auth routes must disable jwt: both use the Authorization header")
+)
+
+// Custom filter errors
+var (
+	ErrInvalidCustomFilter      = errors.New("invalid custom filter")
+	ErrUnsafeLuaSource          = errors.New("lua source must define envoy_on_request or envoy_on_response and may not use os, io, debug, package, ffi, jit, _G or loaders")
+	ErrInvalidModuleURL         = errors.New("wasm module url must be an https URL without credentials or fragment")
+	ErrCustomFiltersRequireHTTP = errors.New("custom filters require an HTTP or HTTPS load balancer")
+)
+
+// Connection flood protection errors
+var (
+	ErrInvalidDDoSProtection = errors.New("invalid ddos_protection: rates and limits must be in range, connection_burst needs connection_rate, attack_threshold and source_rate_limit go together")
+)
+
+// Bandwidth limit errors
+var (
+	ErrInvalidBandwidthLimit      = errors.New("bandwidth_limit needs an ingress or egress limit between 1 KiB/s and 10 GiB/s")
+	ErrBandwidthLimitRequiresHTTP = errors.New("bandwidth_limit requires an HTTP or HTTPS load balancer")
+)
+
+// TCP protocol hint errors
+var (
+	ErrInvalidTCPProtocolHint     = errors.New("tcp_protocol_hint must be mysql, postgres or redis")
+	ErrTCPProtocolHintRequiresTCP = errors.New("tcp_protocol_hint requires a TCP load balancer")
+	ErrRedisHintConflict          = errors.New("tcp_protocol_hint redis requires algorithm ring_hash and cannot preserve the client address or bound connection lifetimes")
+)
+
+// TLS passthrough errors
+var (
+	ErrInvalidTLSPassthrough     = errors.New("tls_passthrough needs 1-100 routes, each with valid server names that appear only once")
+	ErrTLSPassthroughRequiresTCP = errors.New("tls_passthrough requires a TCP load balancer")
+	ErrTLSPassthroughConflict    = errors.New("tls_passthrough cannot be combined with tcp_protocol_hint")
+)
+
+// Multi-port errors
+var (
+	ErrInvalidPortRange = errors.New("ports must be ranges within 1-65535, up to 1000 ports in total, none repeated or equal to port")
+	ErrInvalidTCPHelper = errors.New("helper must be ftp, smtp or imap")
+	ErrPortsRequireTCP  = errors.New("ports, port_range and helper require a TCP load balancer")
+	ErrPortsConflict    = errors.New("ports, port_range and helper need the load balancer's own backends and cannot be combined with pools, tls_passthrough, tcp_protocol_hint or firewall-based ddos_protection")
+	ErrFTPHelper        = errors.New("helper ftp requires the passive port range in ports and algorithm ring_hash")
+)
+
+// Statistics errors
+var (
+	ErrInvalidStatsPrefix = errors.New("stat prefix must start with a letter and contain only letters, digits and '_' (max 64)")
+)
+
+// Listener tuning errors
+var (
+	ErrInvalidListenerTuning = errors.New("listener tuning: tcp_fast_open_queue and backlog must be 0-65535, buffer_limit 1KiB-64MiB, idle_timeout and max_connection_duration 0-7 days, drain_type default or modify_only, tcp_keepalive time and interval 0-32767 seconds and probes 0-127")
+)
+
+// Backend warm-up errors
+var (
+	ErrInvalidPrewarm   = errors.New("prewarm needs a window of 1-3600 seconds or a preconnect_ratio of 1-3; aggression (0-10) needs a window")
+	ErrPrewarmAlgorithm = errors.New("prewarm window requires algorithm round_robin or least_request")
+)
+
+// Admission control errors
+var (
+	ErrInvalidAdmissionControl      = errors.New("invalid admission control configuration")
+	ErrAdmissionControlRequiresHTTP = errors.New("admission control requires an HTTP or HTTPS load balancer")
+)
+
+// Maintenance errors
+var (
+	ErrInvalidMaintenance      = errors.New("invalid maintenance configuration")
+	ErrMaintenanceRequiresHTTP = errors.New("maintenance mode requires an HTTP or HTTPS load balancer")
+)
+
+// DNS discovery errors
+var (
+	ErrInvalidDNSDiscovery = errors.New("dns refresh_rate must be between 0 and 3600 seconds")
+	ErrDNSPinRespectTTL    = errors.New("dns respect_ttl cannot be combined with pin")
+)
+
+// Service discovery errors
+var (
+	ErrInvalidDiscoveryType = errors.New("invalid discovery type")
+	ErrInvalidDiscovery     = errors.New("invalid discovery query")
+)
+
+// Autoscaling errors
+var (
+	ErrInvalidAutoscaling             = errors.New("invalid autoscaling policy")
+	ErrSaturationNeedsConnectionLimit = errors.New("autoscaling max_saturation requires connection_pool.max_connections_per_host")
+)
+
+// Client IP errors
+var (
+	ErrInvalidClientIP             = errors.New("invalid client IP configuration")
+	ErrForwardedHeadersRequireHTTP = errors.New("X-Forwarded-For and X-Real-IP settings require an HTTP or HTTPS load balancer")
+	ErrPreserveSourceRequiresTCP   = errors.New("preserve_source requires a TCP load balancer")
+)
+
+// Routing errors
+var (
+	ErrInvalidPool       = errors.New("invalid or duplicate backend pool name")
+	ErrInvalidRoute      = errors.New("invalid or duplicate route name")
+	ErrInvalidRoutePath  = errors.New("invalid route path")
+	ErrInvalidRouteHost  = errors.New("invalid route host")
+	ErrUnknownPool       = errors.New("route targets an unknown backend pool")
+	ErrRoutesRequireHTTP = errors.New("routes require an HTTP or HTTPS load balancer")
+	ErrInvalidSplit      = errors.New("traffic split needs at least two distinct pools with weights summing to 100")
+	ErrInvalidRollout    = errors.New("invalid canary rollout")
+	ErrInvalidSelector   = errors.New("invalid backend pool selector")
+)
+
+// Fault injection errors
+var (
+	ErrInvalidFaultInjection = errors.New("fault_injection needs delay_percent with delay_ms, or abort_percent with abort_status")
+)
+
+// Route match errors
+var (
+	ErrInvalidRouteMatch = errors.New("route headers, cookies and query_params need valid names and an exact value, RE2 regex or match present (max 16 conditions)")
+)
+
+// Route override errors
+var (
+	ErrRouteTimeoutExceedsListener = errors.New("route timeouts and per_try_timeout must not exceed the load balancer timeouts")
+	ErrRouteRetryBudget            = errors.New("retry budgets apply to the whole backend pool and cannot be set per route")
+)
+
 // TLS configuration errors
 var (
-	ErrMissingCertificate = errors.New("missing certificate path")
-	ErrMissingPrivateKey  = errors.New("missing private key path")
-	ErrInvalidTLSVersion  = errors.New("invalid TLS version")
+	ErrMissingCertificate    = errors.New("missing certificate path")
+	ErrMissingPrivateKey     = errors.New("missing private key path")
+	ErrInvalidTLSVersion     = errors.New("invalid TLS version")
+	ErrInvalidSessionTimeout = errors.New("session_timeout must be between 0 and 86400 seconds")
 )
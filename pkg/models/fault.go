@@ -0,0 +1,41 @@
+package models
+
+// MaxFaultDelayMs bounds the delay fault injection adds to a request
+const MaxFaultDelayMs = 60000
+
+// FaultInjection delays or aborts a share of a route's requests inside the
+// load balancer, so teams can test how clients cope with slow or failing
+// backends. Agents only apply it on nodes configured as staging.
+type FaultInjection struct {
+	DelayPercent int `json:"delay_percent,omitempty" yaml:"delay_percent,omitempty"` // percent of requests delayed
+	DelayMs      int `json:"delay_ms,omitempty" yaml:"delay_ms,omitempty"`           // added before the request is proxied
+	AbortPercent int `json:"abort_percent,omitempty" yaml:"abort_percent,omitempty"` // percent of requests answered with abort_status
+	AbortStatus  int `json:"abort_status,omitempty" yaml:"abort_status,omitempty"`   // HTTP status of aborted requests
+}
+
+// Validate validates the fault injection settings
+func (f *FaultInjection) Validate() error {
+	if f.DelayPercent < 0 || f.DelayPercent > 100 || f.AbortPercent < 0 || f.AbortPercent > 100 {
+		return ErrInvalidFaultInjection
+	}
+	if f.DelayPercent == 0 && f.AbortPercent == 0 {
+		return ErrInvalidFaultInjection
+	}
+	if f.DelayPercent > 0 && (f.DelayMs < 1 || f.DelayMs > MaxFaultDelayMs) {
+		return ErrInvalidFaultInjection
+	}
+	if f.AbortPercent > 0 && (f.AbortStatus < 200 || f.AbortStatus > 599) {
+		return ErrInvalidFaultInjection
+	}
+	return nil
+}
+
+// HasFaultInjection reports whether any route of lb injects faults
+func (lb *LoadBalancer) HasFaultInjection() bool {
+	for i := range lb.Routes {
+		if lb.Routes[i].FaultInjection != nil {
+			return true
+		}
+	}
+	return false
+}
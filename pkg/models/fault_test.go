@@ -0,0 +1,56 @@
+package models
+
+import "testing"
+
+func TestFaultInjection_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr error
+		fault   FaultInjection
+	}{
+		{
+			name:    "delay",
+			fault:   FaultInjection{DelayPercent: 10, DelayMs: 250},
+			wantErr: nil,
+		},
+		{
+			name:    "delay and abort",
+			fault:   FaultInjection{DelayPercent: 10, DelayMs: 250, AbortPercent: 5, AbortStatus: 503},
+			wantErr: nil,
+		},
+		{
+			name:    "nothing injected",
+			fault:   FaultInjection{},
+			wantErr: ErrInvalidFaultInjection,
+		},
+		{
+			name:    "percent above 100",
+			fault:   FaultInjection{AbortPercent: 101, AbortStatus: 503},
+			wantErr: ErrInvalidFaultInjection,
+		},
+		{
+			name:    "delay without duration",
+			fault:   FaultInjection{DelayPercent: 10},
+			wantErr: ErrInvalidFaultInjection,
+		},
+		{
+			name:    "delay too long",
+			fault:   FaultInjection{DelayPercent: 10, DelayMs: MaxFaultDelayMs + 1},
+			wantErr: ErrInvalidFaultInjection,
+		},
+		{
+			name:    "abort without status",
+			fault:   FaultInjection{AbortPercent: 5},
+			wantErr: ErrInvalidFaultInjection,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.fault.Validate()
+			if err != tt.wantErr {
+				t.Errorf("FaultInjection.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
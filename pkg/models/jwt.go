@@ -0,0 +1,179 @@
+package models
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+// JWT limits
+const (
+	MaxJWTProviders      = 8
+	MaxJWTAudiences      = 16
+	MaxJWTRequiredClaims = 16
+	MaxJWKSCacheDuration = 86400
+	defaultJWKSHTTPSPort = 443
+	defaultJWKSHTTPPort  = 80
+)
+
+var (
+	// jwtValueRegex restricts issuers, audiences and claim values to
+	// printable characters that are safe to render unescaped
+	jwtValueRegex = regexp.MustCompile(`^[a-zA-Z0-9_.:/@+=~-][a-zA-Z0-9_.:/@+=~ -]{0,255}$`)
+	// jwtClaimRegex restricts claim names
+	jwtClaimRegex = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.:-]{0,63}$`)
+)
+
+// JWTAuth validates the JSON Web Token in the Authorization header of each
+// request before it is routed. Every route requires a token from any of the
+// providers unless the route's jwt settings say otherwise. HTTP and HTTPS
+// load balancers only.
+type JWTAuth struct {
+	Providers []JWTProvider `json:"providers" yaml:"providers"`
+}
+
+// JWTProvider is an issuer of accepted tokens
+type JWTProvider struct {
+	Name          string   `json:"name" yaml:"name"`
+	Issuer        string   `json:"issuer" yaml:"issuer"`                                     // the iss claim tokens must carry
+	JWKSURI       string   `json:"jwks_uri" yaml:"jwks_uri"`                                 // http(s) URL of the issuer's signing keys
+	Audiences     []string `json:"audiences,omitempty" yaml:"audiences,omitempty"`           // accepted aud claims; empty accepts any
+	Forward       bool     `json:"forward,omitempty" yaml:"forward,omitempty"`               // keep the token in the request sent to the backend
+	CacheDuration int      `json:"cache_duration,omitempty" yaml:"cache_duration,omitempty"` // seconds the signing keys are cached (default 300)
+}
+
+// RouteJWT overrides the token requirement of one route
+type RouteJWT struct {
+	Disabled       bool              `json:"disabled,omitempty" yaml:"disabled,omitempty"`               // the route needs no token
+	Providers      []string          `json:"providers,omitempty" yaml:"providers,omitempty"`             // accept tokens from these providers only
+	RequiredClaims map[string]string `json:"required_claims,omitempty" yaml:"required_claims,omitempty"` // claim name to the exact value tokens must carry
+}
+
+// Validate validates the JWT providers
+func (j *JWTAuth) Validate() error {
+	if len(j.Providers) == 0 || len(j.Providers) > MaxJWTProviders {
+		return ErrInvalidJWTAuth
+	}
+	seen := make(map[string]bool, len(j.Providers))
+	for i := range j.Providers {
+		p := &j.Providers[i]
+		if seen[p.Name] {
+			return ErrInvalidJWTAuth
+		}
+		seen[p.Name] = true
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate validates the JWT provider
+func (p *JWTProvider) Validate() error {
+	if p.Name == "" || !safeIdentifierRegex.MatchString(p.Name) || len(p.Name) > 64 {
+		return ErrInvalidJWTAuth
+	}
+	if !jwtValueRegex.MatchString(p.Issuer) {
+		return ErrInvalidJWTAuth
+	}
+	if _, _, _, err := p.JWKSAddress(); err != nil {
+		return ErrInvalidJWKSURI
+	}
+	if len(p.Audiences) > MaxJWTAudiences {
+		return ErrInvalidJWTAuth
+	}
+	for _, aud := range p.Audiences {
+		if !jwtValueRegex.MatchString(aud) {
+			return ErrInvalidJWTAuth
+		}
+	}
+	if p.CacheDuration < 0 || p.CacheDuration > MaxJWKSCacheDuration {
+		return ErrInvalidJWTAuth
+	}
+	return nil
+}
+
+// JWKSAddress returns the host and port of the JWKS URI and whether it is
+// fetched over TLS
+func (p *JWTProvider) JWKSAddress() (host string, port int, tls bool, err error) {
+	u, err := url.Parse(p.JWKSURI)
+	if err != nil {
+		return "", 0, false, err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", 0, false, ErrInvalidJWKSURI
+	}
+	if u.Path != "" && !routePathRegex.MatchString(u.Path) {
+		return "", 0, false, ErrInvalidJWKSURI
+	}
+	host = u.Hostname()
+	if net.ParseIP(host) == nil && !HostnameRegex.MatchString(host) {
+		return "", 0, false, ErrInvalidJWKSURI
+	}
+	tls = u.Scheme == "https"
+	port = defaultJWKSHTTPPort
+	if tls {
+		port = defaultJWKSHTTPSPort
+	}
+	if u.Port() != "" {
+		if port, err = strconv.Atoi(u.Port()); err != nil || port < 1 || port > 65535 {
+			return "", 0, false, ErrInvalidJWKSURI
+		}
+	}
+	return host, port, tls, nil
+}
+
+// Validate validates the route's token requirement on its own; provider
+// references are checked by the load balancer
+func (r *RouteJWT) Validate() error {
+	if r.Disabled && (len(r.Providers) > 0 || len(r.RequiredClaims) > 0) {
+		return ErrInvalidRouteJWT
+	}
+	if len(r.RequiredClaims) > MaxJWTRequiredClaims {
+		return ErrInvalidRouteJWT
+	}
+	for name, value := range r.RequiredClaims {
+		if !jwtClaimRegex.MatchString(name) || !jwtValueRegex.MatchString(value) {
+			return ErrInvalidRouteJWT
+		}
+	}
+	return nil
+}
+
+func (lb *LoadBalancer) validateJWTAuth() error {
+	if lb.JWTAuth == nil {
+		for i := range lb.Routes {
+			if lb.Routes[i].JWT != nil {
+				return ErrRouteJWTWithoutAuth
+			}
+		}
+		return nil
+	}
+	if lb.Protocol == ProtocolTCP {
+		return ErrJWTRequiresHTTP
+	}
+	if err := lb.JWTAuth.Validate(); err != nil {
+		return err
+	}
+
+	providers := make(map[string]bool, len(lb.JWTAuth.Providers))
+	for _, p := range lb.JWTAuth.Providers {
+		providers[p.Name] = true
+	}
+	for i := range lb.Routes {
+		jwt := lb.Routes[i].JWT
+		if jwt == nil {
+			continue
+		}
+		if err := jwt.Validate(); err != nil {
+			return err
+		}
+		for _, name := range jwt.Providers {
+			if !providers[name] {
+				return ErrUnknownJWTProvider
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package models
+
+import "testing"
+
+func jwtLoadBalancer(routeJWT *RouteJWT, providers ...JWTProvider) *LoadBalancer {
+	if len(providers) == 0 {
+		providers = []JWTProvider{{Name: "auth0", Issuer: "https://shop.eu.auth0.com/", JWKSURI: "https://shop.eu.auth0.com/.well-known/jwks.json"}}
+	}
+	return &LoadBalancer{
+		ID: "lb-1", Name: "lb", Protocol: ProtocolHTTP, Algorithm: AlgoRoundRobin, Port: 80,
+		Backends: []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true}},
+		Routes:   []Route{{Name: "admin", Path: "/admin", JWT: routeJWT}},
+		JWTAuth:  &JWTAuth{Providers: providers},
+	}
+}
+
+func TestLoadBalancer_Validate_JWTAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		lb      *LoadBalancer
+		wantErr error
+	}{
+		{
+			name: "provider with required claims on a route",
+			lb:   jwtLoadBalancer(&RouteJWT{Providers: []string{"auth0"}, RequiredClaims: map[string]string{"role": "admin"}}),
+		},
+		{
+			name: "route without a token",
+			lb:   jwtLoadBalancer(&RouteJWT{Disabled: true}),
+		},
+		{
+			name: "keys over plain http on a custom port",
+			lb:   jwtLoadBalancer(nil, JWTProvider{Name: "keycloak", Issuer: "http://10.0.0.9:8080/realms/shop", JWKSURI: "http://10.0.0.9:8080/realms/shop/protocol/openid-connect/certs", Audiences: []string{"api"}}),
+		},
+		{
+			name:    "jwks uri with a query",
+			lb:      jwtLoadBalancer(nil, JWTProvider{Name: "idp", Issuer: "idp", JWKSURI: "https://idp.example.com/keys?format=jwks"}),
+			wantErr: ErrInvalidJWKSURI,
+		},
+		{
+			name:    "jwks uri over ftp",
+			lb:      jwtLoadBalancer(nil, JWTProvider{Name: "idp", Issuer: "idp", JWKSURI: "ftp://idp.example.com/keys"}),
+			wantErr: ErrInvalidJWKSURI,
+		},
+		{
+			name:    "issuer with a quote",
+			lb:      jwtLoadBalancer(nil, JWTProvider{Name: "idp", Issuer: `idp"`, JWKSURI: "https://idp.example.com/keys"}),
+			wantErr: ErrInvalidJWTAuth,
+		},
+		{
+			name: "duplicate provider",
+			lb: jwtLoadBalancer(nil,
+				JWTProvider{Name: "idp", Issuer: "a", JWKSURI: "https://a.example.com/keys"},
+				JWTProvider{Name: "idp", Issuer: "b", JWKSURI: "https://b.example.com/keys"}),
+			wantErr: ErrInvalidJWTAuth,
+		},
+		{
+			name:    "undefined provider on a route",
+			lb:      jwtLoadBalancer(&RouteJWT{Providers: []string{"okta"}}),
+			wantErr: ErrUnknownJWTProvider,
+		},
+		{
+			name:    "disabled route with claims",
+			lb:      jwtLoadBalancer(&RouteJWT{Disabled: true, RequiredClaims: map[string]string{"role": "admin"}}),
+			wantErr: ErrInvalidRouteJWT,
+		},
+		{
+			name:    "invalid claim name",
+			lb:      jwtLoadBalancer(&RouteJWT{RequiredClaims: map[string]string{"role name": "admin"}}),
+			wantErr: ErrInvalidRouteJWT,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.lb.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_Validate_RouteJWTWithoutAuth(t *testing.T) {
+	lb := jwtLoadBalancer(&RouteJWT{Disabled: true})
+	lb.JWTAuth = nil
+	if err := lb.Validate(); err != ErrRouteJWTWithoutAuth {
+		t.Errorf("Validate() error = %v, wantErr %v", err, ErrRouteJWTWithoutAuth)
+	}
+
+	lb = jwtLoadBalancer(nil)
+	lb.Protocol, lb.Routes = ProtocolTCP, nil
+	if err := lb.Validate(); err != ErrJWTRequiresHTTP {
+		t.Errorf("Validate() error = %v, wantErr %v", err, ErrJWTRequiresHTTP)
+	}
+}
+
+func TestJWTProvider_JWKSAddress(t *testing.T) {
+	tests := []struct {
+		uri      string
+		wantHost string
+		wantPort int
+		wantTLS  bool
+	}{
+		{uri: "https://shop.eu.auth0.com/.well-known/jwks.json", wantHost: "shop.eu.auth0.com", wantPort: 443, wantTLS: true},
+		{uri: "http://10.0.0.9:8080/certs", wantHost: "10.0.0.9", wantPort: 8080},
+	}
+	for _, tt := range tests {
+		p := &JWTProvider{JWKSURI: tt.uri}
+		host, port, tls, err := p.JWKSAddress()
+		if err != nil || host != tt.wantHost || port != tt.wantPort || tls != tt.wantTLS {
+			t.Errorf("JWKSAddress(%s) = %s, %d, %v, %v; want %s, %d, %v", tt.uri, host, port, tls, err, tt.wantHost, tt.wantPort, tt.wantTLS)
+		}
+	}
+}
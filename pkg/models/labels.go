@@ -0,0 +1,198 @@
+package models
+
+import (
+	"maps"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Label limits enforced by Validate
+const (
+	MaxBackendLabels  = 32
+	MaxSelectorLength = 512
+)
+
+var (
+	// labelKeyRegex validates backend label keys such as version or
+	// app.example.com/tier
+	labelKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._/-]{0,62})$`)
+
+	// labelValueRegex validates backend label values; they may be empty
+	labelValueRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]{0,63}$`)
+)
+
+// validateLabels checks the keys and values of backend labels
+func validateLabels(labels map[string]string) error {
+	if len(labels) > MaxBackendLabels {
+		return ErrInvalidBackendLabels
+	}
+	for key, value := range labels {
+		if !labelKeyRegex.MatchString(key) || !labelValueRegex.MatchString(value) {
+			return ErrInvalidBackendLabels
+		}
+	}
+	return nil
+}
+
+// SelectorOp is how a selector requirement compares a label
+type SelectorOp string
+
+// Selector requirement operators
+const (
+	SelectorEquals    SelectorOp = "="
+	SelectorNotEquals SelectorOp = "!="
+	SelectorIn        SelectorOp = "in"
+	SelectorNotIn     SelectorOp = "notin"
+	SelectorExists    SelectorOp = "exists"
+	SelectorNotExists SelectorOp = "!exists"
+)
+
+// SelectorRequirement is one condition of a label selector
+type SelectorRequirement struct {
+	Key    string
+	Op     SelectorOp
+	Values []string // one for = and !=, none for exists and !exists
+}
+
+// Matches reports whether labels meet the requirement. A missing label
+// meets != and notin.
+func (r *SelectorRequirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Op {
+	case SelectorEquals, SelectorIn:
+		return ok && slices.Contains(r.Values, value)
+	case SelectorNotEquals, SelectorNotIn:
+		return !ok || !slices.Contains(r.Values, value)
+	case SelectorExists:
+		return ok
+	default:
+		return !ok
+	}
+}
+
+// Selector selects backends by their labels: every requirement must match
+type Selector []SelectorRequirement
+
+// Matches reports whether labels meet every requirement of the selector
+func (s Selector) Matches(labels map[string]string) bool {
+	for i := range s {
+		if !s[i].Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseSelector parses a label selector expression: comma-separated
+// requirements of the forms key=value, key==value, key!=value,
+// key in (a,b), key notin (a,b), key (label present) and !key (label absent).
+// For example "version=v2,tier in (premium,gold),!canary".
+func ParseSelector(expr string) (Selector, error) {
+	if strings.TrimSpace(expr) == "" || len(expr) > MaxSelectorLength {
+		return nil, ErrInvalidSelector
+	}
+	var selector Selector
+	for _, term := range splitSelector(expr) {
+		requirement, err := parseRequirement(strings.TrimSpace(term))
+		if err != nil {
+			return nil, err
+		}
+		selector = append(selector, requirement)
+	}
+	return selector, nil
+}
+
+// splitSelector splits a selector at the commas outside parentheses
+func splitSelector(expr string) []string {
+	var terms []string
+	depth, start := 0, 0
+	for i, c := range expr {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, expr[start:])
+}
+
+// parseRequirement parses one selector requirement
+func parseRequirement(term string) (SelectorRequirement, error) {
+	var r SelectorRequirement
+	switch {
+	case strings.HasPrefix(term, "!") && !strings.Contains(term, "="):
+		r = SelectorRequirement{Key: strings.TrimSpace(term[1:]), Op: SelectorNotExists}
+	case strings.Contains(term, "!="):
+		key, value, _ := strings.Cut(term, "!=")
+		r = SelectorRequirement{Key: strings.TrimSpace(key), Op: SelectorNotEquals, Values: []string{strings.TrimSpace(value)}}
+	case strings.Contains(term, "="):
+		key, value, _ := strings.Cut(term, "=")
+		value = strings.TrimPrefix(value, "=")
+		r = SelectorRequirement{Key: strings.TrimSpace(key), Op: SelectorEquals, Values: []string{strings.TrimSpace(value)}}
+	case strings.HasSuffix(term, ")"):
+		open := strings.Index(term, "(")
+		fields := strings.Fields(term[:max(open, 0)])
+		if open < 0 || len(fields) != 2 || (fields[1] != string(SelectorIn) && fields[1] != string(SelectorNotIn)) {
+			return r, ErrInvalidSelector
+		}
+		r = SelectorRequirement{Key: fields[0], Op: SelectorOp(fields[1])}
+		for _, value := range strings.Split(term[open+1:len(term)-1], ",") {
+			r.Values = append(r.Values, strings.TrimSpace(value))
+		}
+	default:
+		r = SelectorRequirement{Key: term, Op: SelectorExists}
+	}
+
+	if !labelKeyRegex.MatchString(r.Key) {
+		return r, ErrInvalidSelector
+	}
+	for _, value := range r.Values {
+		if !labelValueRegex.MatchString(value) || strings.ContainsAny(value, "()") {
+			return r, ErrInvalidSelector
+		}
+	}
+	return r, nil
+}
+
+// SelectBackends adds the backends of the load balancer matching the
+// selector of each pool that has one to the pool. Backends the pool already
+// has, by address and port, are not added again, so selecting twice changes
+// nothing. Selectors are checked by Validate; invalid ones select nothing.
+func (lb *LoadBalancer) SelectBackends() {
+	for i := range lb.Pools {
+		pool := &lb.Pools[i]
+		if pool.Selector == "" {
+			continue
+		}
+		selector, err := ParseSelector(pool.Selector)
+		if err != nil {
+			continue
+		}
+		seen := make(map[string]bool, len(pool.Backends))
+		for _, backend := range pool.Backends {
+			seen[backendHostPort(backend)] = true
+		}
+		for _, backend := range lb.Backends {
+			if !selector.Matches(backend.Labels) || seen[backendHostPort(backend)] {
+				continue
+			}
+			seen[backendHostPort(backend)] = true
+			backend.Labels = maps.Clone(backend.Labels)
+			pool.Backends = append(pool.Backends, backend)
+		}
+	}
+}
+
+// backendHostPort returns the address and port of a backend
+func backendHostPort(b Backend) string {
+	return net.JoinHostPort(b.Address, strconv.Itoa(b.Port))
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    Selector
+		wantErr bool
+	}{
+		{expr: "version=v2", want: Selector{{Key: "version", Op: SelectorEquals, Values: []string{"v2"}}}},
+		{expr: "version == v2", want: Selector{{Key: "version", Op: SelectorEquals, Values: []string{"v2"}}}},
+		{expr: "tier!=free", want: Selector{{Key: "tier", Op: SelectorNotEquals, Values: []string{"free"}}}},
+		{
+			expr: "tier in (premium, gold),zone notin (a),canary,!legacy",
+			want: Selector{
+				{Key: "tier", Op: SelectorIn, Values: []string{"premium", "gold"}},
+				{Key: "zone", Op: SelectorNotIn, Values: []string{"a"}},
+				{Key: "canary", Op: SelectorExists},
+				{Key: "legacy", Op: SelectorNotExists},
+			},
+		},
+		{expr: "", wantErr: true},
+		{expr: "version=v2,", wantErr: true},
+		{expr: "tier in premium", wantErr: true},
+		{expr: "tier within (premium)", wantErr: true},
+		{expr: "version=v 2", wantErr: true},
+		{expr: "bad key=v2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSelector(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSelector(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSelector(%q) = %+v, want %+v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestSelector_Matches(t *testing.T) {
+	labels := map[string]string{"version": "v2", "tier": "premium"}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"version=v2", true},
+		{"version=v1", false},
+		{"version!=v1", true},
+		{"zone!=a", true}, // missing labels meet != and notin
+		{"tier in (gold,premium)", true},
+		{"tier notin (gold,premium)", false},
+		{"tier", true},
+		{"!tier", false},
+		{"version=v2,tier=free", false},
+	}
+
+	for _, tt := range tests {
+		selector, err := ParseSelector(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q) error = %v", tt.expr, err)
+		}
+		if got := selector.Matches(labels); got != tt.want {
+			t.Errorf("%q matches %v = %v, want %v", tt.expr, labels, got, tt.want)
+		}
+	}
+}
+
+func TestLoadBalancer_SelectBackends(t *testing.T) {
+	lb := &LoadBalancer{
+		Backends: []Backend{
+			{ID: "v1-a", Address: "10.0.0.1", Port: 80, Enabled: true, Labels: map[string]string{"version": "v1"}},
+			{ID: "v2-a", Address: "10.0.0.2", Port: 80, Enabled: true, Labels: map[string]string{"version": "v2", "tier": "premium"}},
+			{ID: "v2-b", Address: "10.0.0.3", Port: 80, Enabled: true, Labels: map[string]string{"version": "v2"}},
+			{ID: "plain", Address: "10.0.0.4", Port: 80, Enabled: true},
+		},
+		Pools: []BackendPool{
+			{Name: "v2", Selector: "version=v2"},
+			{Name: "premium", Selector: "tier=premium", Backends: []Backend{
+				{ID: "own", Address: "10.0.0.2", Port: 80, Enabled: true}, // already in the pool
+				{ID: "extra", Address: "10.0.1.1", Port: 80, Enabled: true},
+			}},
+			{Name: "static", Backends: []Backend{{ID: "static", Address: "10.0.2.1", Port: 80, Enabled: true}}},
+		},
+	}
+
+	lb.SelectBackends()
+	lb.SelectBackends() // selecting again changes nothing
+
+	ids := func(backends []Backend) []string {
+		var out []string
+		for _, b := range backends {
+			out = append(out, b.ID)
+		}
+		return out
+	}
+	for pool, want := range map[int][]string{0: {"v2-a", "v2-b"}, 1: {"own", "extra"}, 2: {"static"}} {
+		if got := ids(lb.Pools[pool].Backends); !reflect.DeepEqual(got, want) {
+			t.Errorf("pool %s backends = %v, want %v", lb.Pools[pool].Name, got, want)
+		}
+	}
+	if got := len(lb.Backends); got != 4 {
+		t.Errorf("load balancer has %d backends after selection, want 4", got)
+	}
+}
@@ -0,0 +1,95 @@
+package models
+
+// Listener socket tuning bounds
+const (
+	MaxListenBacklog = 65535    // the kernel caps the backlog at net.core.somaxconn
+	MinBufferLimit   = 1024     // bytes
+	MaxBufferLimit   = 64 << 20 // bytes
+	MaxFastOpenQueue = 65535
+	MaxConnectionAge = 7 * 24 * 3600 // seconds, bounds idle_timeout and max_connection_duration
+)
+
+// TCP keepalive bounds of the Linux kernel (MAX_TCP_KEEPIDLE, MAX_TCP_KEEPINTVL, MAX_TCP_KEEPCNT)
+const (
+	MaxKeepaliveTime   = 32767 // seconds
+	MaxKeepaliveProbes = 127
+)
+
+// ListenerDrainType selects when Envoy drains the connections of a listener
+type ListenerDrainType string
+
+const (
+	// DrainDefault drains on listener updates, hot restarts and health check failure
+	DrainDefault ListenerDrainType = "default"
+	// DrainModifyOnly drains only when the listener itself is updated or removed
+	DrainModifyOnly ListenerDrainType = "modify_only"
+)
+
+// ListenerTuning adjusts the listener sockets of high packet-rate deployments.
+// Unset fields keep Envoy's defaults.
+type ListenerTuning struct {
+	ReusePort        *bool `json:"reuse_port,omitempty" yaml:"reuse_port,omitempty"`                   // one SO_REUSEPORT socket per worker thread (Envoy default: on)
+	TCPFastOpenQueue int   `json:"tcp_fast_open_queue,omitempty" yaml:"tcp_fast_open_queue,omitempty"` // pending TCP Fast Open connections, 0 = disabled
+	Backlog          int   `json:"backlog,omitempty" yaml:"backlog,omitempty"`                         // listen() backlog, 0 = net.core.somaxconn
+	BufferLimit      int   `json:"buffer_limit,omitempty" yaml:"buffer_limit,omitempty"`               // per-connection buffer bytes, 0 = Envoy default (1 MiB)
+
+	// Client connection lifetime, e.g. to bound long-lived MySQL or MQTT connections
+	IdleTimeout           int               `json:"idle_timeout,omitempty" yaml:"idle_timeout,omitempty"`                       // seconds without traffic, 0 = timeouts.idle (TCP) or Envoy default of 1h (HTTP)
+	MaxConnectionDuration int               `json:"max_connection_duration,omitempty" yaml:"max_connection_duration,omitempty"` // seconds a connection may stay open, 0 = unbounded
+	DrainType             ListenerDrainType `json:"drain_type,omitempty" yaml:"drain_type,omitempty"`                           // default or modify_only (default: default)
+
+	TCPKeepalive *TCPKeepalive `json:"tcp_keepalive,omitempty" yaml:"tcp_keepalive,omitempty"` // probe idle client connections
+}
+
+// TCPKeepalive enables keepalive probes on client connections, so connections
+// of clients that vanished, or whose NAT mapping expired, are closed instead
+// of holding a connection slot. Zero fields keep the kernel defaults
+// (net.ipv4.tcp_keepalive_time, _intvl and _probes).
+type TCPKeepalive struct {
+	Time     int `json:"time,omitempty" yaml:"time,omitempty"`         // seconds idle before the first probe
+	Interval int `json:"interval,omitempty" yaml:"interval,omitempty"` // seconds between probes
+	Probes   int `json:"probes,omitempty" yaml:"probes,omitempty"`     // unanswered probes before the connection is closed
+}
+
+// Validate validates the keepalive settings
+func (k *TCPKeepalive) Validate() error {
+	if k.Time < 0 || k.Time > MaxKeepaliveTime || k.Interval < 0 || k.Interval > MaxKeepaliveTime {
+		return ErrInvalidListenerTuning
+	}
+	if k.Probes < 0 || k.Probes > MaxKeepaliveProbes {
+		return ErrInvalidListenerTuning
+	}
+	return nil
+}
+
+// Validate validates the listener tuning
+func (t *ListenerTuning) Validate() error {
+	if t.TCPFastOpenQueue < 0 || t.TCPFastOpenQueue > MaxFastOpenQueue {
+		return ErrInvalidListenerTuning
+	}
+	if t.Backlog < 0 || t.Backlog > MaxListenBacklog {
+		return ErrInvalidListenerTuning
+	}
+	if t.BufferLimit != 0 && (t.BufferLimit < MinBufferLimit || t.BufferLimit > MaxBufferLimit) {
+		return ErrInvalidListenerTuning
+	}
+	if t.IdleTimeout < 0 || t.IdleTimeout > MaxConnectionAge || t.MaxConnectionDuration < 0 || t.MaxConnectionDuration > MaxConnectionAge {
+		return ErrInvalidListenerTuning
+	}
+	switch t.DrainType {
+	case "", DrainDefault, DrainModifyOnly:
+	default:
+		return ErrInvalidListenerTuning
+	}
+	if t.TCPKeepalive != nil {
+		return t.TCPKeepalive.Validate()
+	}
+	return nil
+}
+
+func (lb *LoadBalancer) validateListenerTuning() error {
+	if lb.Listener == nil {
+		return nil
+	}
+	return lb.Listener.Validate()
+}
@@ -0,0 +1,84 @@
+package models
+
+import "testing"
+
+func TestListenerTuning_Validate(t *testing.T) {
+	reusePort := false
+	tests := []struct {
+		name    string
+		wantErr error
+		tuning  ListenerTuning
+	}{
+		{
+			name:    "defaults",
+			tuning:  ListenerTuning{},
+			wantErr: nil,
+		},
+		{
+			name:    "all options",
+			tuning:  ListenerTuning{ReusePort: &reusePort, TCPFastOpenQueue: 256, Backlog: 4096, BufferLimit: 32768},
+			wantErr: nil,
+		},
+		{
+			name:    "negative fast open queue",
+			tuning:  ListenerTuning{TCPFastOpenQueue: -1},
+			wantErr: ErrInvalidListenerTuning,
+		},
+		{
+			name:    "backlog above the kernel limit",
+			tuning:  ListenerTuning{Backlog: MaxListenBacklog + 1},
+			wantErr: ErrInvalidListenerTuning,
+		},
+		{
+			name:    "buffer limit too small",
+			tuning:  ListenerTuning{BufferLimit: 512},
+			wantErr: ErrInvalidListenerTuning,
+		},
+		{
+			name:    "buffer limit too large",
+			tuning:  ListenerTuning{BufferLimit: MaxBufferLimit + 1},
+			wantErr: ErrInvalidListenerTuning,
+		},
+		{
+			name:   "connection lifetime",
+			tuning: ListenerTuning{IdleTimeout: 300, MaxConnectionDuration: 86400, DrainType: DrainModifyOnly},
+		},
+		{
+			name:    "connection duration above a week",
+			tuning:  ListenerTuning{MaxConnectionDuration: MaxConnectionAge + 1},
+			wantErr: ErrInvalidListenerTuning,
+		},
+		{
+			name:    "negative idle timeout",
+			tuning:  ListenerTuning{IdleTimeout: -1},
+			wantErr: ErrInvalidListenerTuning,
+		},
+		{
+			name:   "tcp keepalive",
+			tuning: ListenerTuning{TCPKeepalive: &TCPKeepalive{Time: 60, Interval: 10, Probes: 5}},
+		},
+		{
+			name:    "keepalive time above the kernel limit",
+			tuning:  ListenerTuning{TCPKeepalive: &TCPKeepalive{Time: MaxKeepaliveTime + 1}},
+			wantErr: ErrInvalidListenerTuning,
+		},
+		{
+			name:    "too many keepalive probes",
+			tuning:  ListenerTuning{TCPKeepalive: &TCPKeepalive{Probes: MaxKeepaliveProbes + 1}},
+			wantErr: ErrInvalidListenerTuning,
+		},
+		{
+			name:    "unknown drain type",
+			tuning:  ListenerTuning{DrainType: "never"},
+			wantErr: ErrInvalidListenerTuning,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.tuning.Validate(); err != tt.wantErr {
+				t.Errorf("ListenerTuning.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
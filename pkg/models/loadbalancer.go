@@ -1,6 +1,7 @@
 package models
 
 import (
+	"net"
 	"regexp"
 	"time"
 )
@@ -36,18 +37,46 @@ type LoadBalancer struct {
 	HealthCheck    *HealthCheck      `json:"health_check,omitempty" yaml:"health_check,omitempty"`
 	TLSConfig      *TLSConfig        `json:"tls_config,omitempty" yaml:"tls_config,omitempty"`
 	Timeouts       *Timeouts         `json:"timeouts,omitempty" yaml:"timeouts,omitempty"`
+	RetryPolicy    *RetryPolicy      `json:"retry_policy,omitempty" yaml:"retry_policy,omitempty"`
+	ConnectionPool *ConnectionPool   `json:"connection_pool,omitempty" yaml:"connection_pool,omitempty"`
+	Prewarm        *Prewarm          `json:"prewarm,omitempty" yaml:"prewarm,omitempty"` // ramps traffic onto new and recovered backends
+	Admission      *AdmissionControl `json:"admission_control,omitempty" yaml:"admission_control,omitempty"`
+	Maintenance    *Maintenance      `json:"maintenance,omitempty" yaml:"maintenance,omitempty"`
+	ClientIP       *ClientIP         `json:"client_ip,omitempty" yaml:"client_ip,omitempty"`
+	DNS            *DNSDiscovery     `json:"dns,omitempty" yaml:"dns,omitempty"`
+	Discovery      *Discovery        `json:"discovery,omitempty" yaml:"discovery,omitempty"`     // adds discovered backends to Backends
+	Autoscaling    *Autoscaling      `json:"autoscaling,omitempty" yaml:"autoscaling,omitempty"` // scales the servers behind Backends
+	Listener       *ListenerTuning   `json:"listener,omitempty" yaml:"listener,omitempty"`
+	Tracing        *Tracing          `json:"tracing,omitempty" yaml:"tracing,omitempty"`
+	WAF            *WAF              `json:"waf,omitempty" yaml:"waf,omitempty"`
+	Authorization  *Authorization    `json:"authorization,omitempty" yaml:"authorization,omitempty"`
+	JWTAuth        *JWTAuth          `json:"jwt_auth,omitempty" yaml:"jwt_auth,omitempty"`
+	DDoS           *DDoSProtection   `json:"ddos_protection,omitempty" yaml:"ddos_protection,omitempty"`
+	BandwidthLimit *BandwidthLimit   `json:"bandwidth_limit,omitempty" yaml:"bandwidth_limit,omitempty"`
 	ID             string            `json:"id" yaml:"id"`
 	Name           string            `json:"name" yaml:"name"`
 	Protocol       Protocol          `json:"protocol" yaml:"protocol"`
 	Algorithm      LoadBalancingAlgo `json:"algorithm" yaml:"algorithm"`
 	Backends       []Backend         `json:"backends" yaml:"backends"`
-	Port           int               `json:"port" yaml:"port"`
-	MaxConnections int               `json:"max_connections,omitempty" yaml:"max_connections,omitempty"`
+	Pools          []BackendPool     `json:"pools,omitempty" yaml:"pools,omitempty"`
+	Routes         []Route           `json:"routes,omitempty" yaml:"routes,omitempty"`
+	Addresses      []string          `json:"addresses,omitempty" yaml:"addresses,omitempty"`             // local IPs or VIPs to listen on, empty = all addresses
+	CustomFilters  []CustomFilter    `json:"custom_filters,omitempty" yaml:"custom_filters,omitempty"`   // Lua and WASM filters, HTTP and HTTPS only
+	StatsPrefix    string            `json:"stats_prefix,omitempty" yaml:"stats_prefix,omitempty"`       // listener stat prefix, empty = <protocol>_<port>_<id>
+	Port           int               `json:"port,omitempty" yaml:"port,omitempty"`                       // required unless port_range is set
+	MaxConnections int               `json:"max_connections,omitempty" yaml:"max_connections,omitempty"` // concurrent connections to the listener, 0 = only the agent's global limit
+
+	// TCP load balancers only
+	TCPProtocolHint TCPProtocolHint `json:"tcp_protocol_hint,omitempty" yaml:"tcp_protocol_hint,omitempty"` // application protocol Envoy decodes: mysql, postgres or redis
+	TLSPassthrough  *TLSPassthrough `json:"tls_passthrough,omitempty" yaml:"tls_passthrough,omitempty"`     // route TLS connections by SNI to pools
+	PortRange       *PortRange      `json:"port_range,omitempty" yaml:"port_range,omitempty"`               // listen on a contiguous block of ports instead of port
+	Ports           []PortRange     `json:"ports,omitempty" yaml:"ports,omitempty"`                         // additional ports, forwarded to the same port of the backends
+	Helper          TCPHelper       `json:"helper,omitempty" yaml:"helper,omitempty"`                       // ftp, smtp or imap
 }
 
 // Timeouts defines timeout configuration for the load balancer
 type Timeouts struct {
-	Connect int `json:"connect" yaml:"connect"` // seconds
+	Connect int `json:"connect" yaml:"connect"` // seconds, upstream connect timeout for the backend pool (default 5)
 	Idle    int `json:"idle" yaml:"idle"`       // seconds
 	Request int `json:"request" yaml:"request"` // seconds
 }
@@ -56,10 +85,33 @@ type Timeouts struct {
 func (lb *LoadBalancer) Validate() error {
 	for _, fn := range []func() error{
 		lb.validateBasicFields,
+		lb.validateAddresses,
 		lb.validateAlgorithm,
 		lb.validateBackends,
+		lb.validateRoutes,
 		lb.validateTLSConfig,
 		lb.validateHealthCheck,
+		lb.validateRetryPolicy,
+		lb.validateConnectionPool,
+		lb.validatePrewarm,
+		lb.validateAdmissionControl,
+		lb.validateListenerTuning,
+		lb.validateDDoSProtection,
+		lb.validateBandwidthLimit,
+		lb.validateTCPProtocolHint,
+		lb.validateTLSPassthrough,
+		lb.validatePorts,
+		lb.validateMaintenance,
+		lb.validateClientIP,
+		lb.validateDNS,
+		lb.validateDiscovery,
+		lb.validateAutoscaling,
+		lb.validateTracing,
+		lb.validateWAF,
+		lb.validateAuthorization,
+		lb.validateJWTAuth,
+		lb.validateRouteAccess,
+		lb.validateCustomFilters,
 	} {
 		if err := fn(); err != nil {
 			return err
@@ -96,15 +148,57 @@ func (lb *LoadBalancer) validateBasicFields() error {
 		return ErrInvalidName
 	}
 
-	if lb.Port <= 0 || lb.Port > 65535 {
+	// A port range replaces the single port, its bounds are checked with
+	// the other ports
+	if lb.PortRange != nil {
+		if lb.Port != 0 {
+			return ErrInvalidPort
+		}
+	} else if lb.Port <= 0 || lb.Port > 65535 {
 		return ErrInvalidPort
 	}
 	if lb.Protocol != ProtocolHTTP && lb.Protocol != ProtocolHTTPS && lb.Protocol != ProtocolTCP {
 		return ErrInvalidProtocol
 	}
+	if lb.StatsPrefix != "" && !StatsNameRegex.MatchString(lb.StatsPrefix) {
+		return ErrInvalidStatsPrefix
+	}
+	if lb.MaxConnections < 0 {
+		return ErrInvalidMaxConns
+	}
 	return nil
 }
 
+// MaxListenAddresses bounds the addresses one listener binds
+const MaxListenAddresses = 16
+
+func (lb *LoadBalancer) validateAddresses() error {
+	if len(lb.Addresses) > MaxListenAddresses {
+		return ErrInvalidAddresses
+	}
+	seen := make(map[string]bool, len(lb.Addresses))
+	for _, addr := range lb.Addresses {
+		ip := net.ParseIP(addr)
+		if ip == nil || seen[ip.String()] {
+			return ErrInvalidAddresses
+		}
+		// A wildcard already covers every other address of its family
+		if ip.IsUnspecified() && len(lb.Addresses) > 1 {
+			return ErrInvalidAddresses
+		}
+		seen[ip.String()] = true
+	}
+	return nil
+}
+
+// ListenAddresses returns the addresses the listener binds
+func (lb *LoadBalancer) ListenAddresses() []string {
+	if len(lb.Addresses) == 0 {
+		return []string{"0.0.0.0"}
+	}
+	return lb.Addresses
+}
+
 func (lb *LoadBalancer) validateAlgorithm() error {
 	switch lb.Algorithm {
 	case AlgoRoundRobin, AlgoLeastRequest, AlgoRandom, AlgoRingHash:
@@ -115,7 +209,8 @@ func (lb *LoadBalancer) validateAlgorithm() error {
 }
 
 func (lb *LoadBalancer) validateBackends() error {
-	if len(lb.Backends) == 0 {
+	// Load balancers that only route to named pools need no default backends
+	if !lb.HasDefaultPool() && len(lb.Pools) == 0 {
 		return ErrNoBackends
 	}
 	for _, backend := range lb.Backends {
@@ -147,6 +242,44 @@ func (lb *LoadBalancer) validateHealthCheck() error {
 	return nil
 }
 
+func (lb *LoadBalancer) validateRetryPolicy() error {
+	if lb.RetryPolicy != nil {
+		return lb.RetryPolicy.Validate()
+	}
+	return nil
+}
+
+func (lb *LoadBalancer) validateConnectionPool() error {
+	pools := []*ConnectionPool{lb.ConnectionPool}
+	for i := range lb.Pools {
+		if lb.Pools[i].ConnectionPool != nil {
+			pools = append(pools, lb.PoolConnectionPool(&lb.Pools[i]))
+		}
+	}
+	for _, pool := range pools {
+		if pool == nil {
+			continue
+		}
+		if err := pool.Validate(); err != nil {
+			return err
+		}
+		if pool.HTTP2 && lb.Protocol == ProtocolTCP {
+			return ErrHTTP2RequiresHTTPProtocol
+		}
+	}
+	return nil
+}
+
+func (lb *LoadBalancer) validateAdmissionControl() error {
+	if lb.Admission == nil {
+		return nil
+	}
+	if lb.Protocol == ProtocolTCP {
+		return ErrAdmissionControlRequiresHTTP
+	}
+	return lb.Admission.Validate()
+}
+
 func (lb *LoadBalancer) validateTimeouts() error {
 	if lb.Timeouts != nil {
 		if lb.Timeouts.Connect < 0 || lb.Timeouts.Idle < 0 || lb.Timeouts.Request < 0 {
@@ -114,6 +114,21 @@ func TestLoadBalancer_Validate(t *testing.T) {
 			},
 			wantErr: ErrInvalidPort,
 		},
+		{
+			name: "negative max connections",
+			lb: LoadBalancer{
+				ID:             "lb-123",
+				Name:           "test-lb",
+				Protocol:       ProtocolHTTP,
+				Algorithm:      AlgoRoundRobin,
+				Port:           80,
+				MaxConnections: -1,
+				Backends: []Backend{
+					{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true},
+				},
+			},
+			wantErr: ErrInvalidMaxConns,
+		},
 		{
 			name: "invalid protocol",
 			lb: LoadBalancer{
@@ -191,6 +206,21 @@ func TestLoadBalancer_Validate(t *testing.T) {
 			},
 			wantErr: nil,
 		},
+		{
+			name: "invalid stats prefix",
+			lb: LoadBalancer{
+				ID:          "lb-123",
+				Name:        "test-lb",
+				Protocol:    ProtocolHTTP,
+				Algorithm:   AlgoRoundRobin,
+				Port:        80,
+				StatsPrefix: "shop.eu",
+				Backends: []Backend{
+					{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true},
+				},
+			},
+			wantErr: ErrInvalidStatsPrefix,
+		},
 		{
 			name: "invalid health check",
 			lb: LoadBalancer{
@@ -263,3 +293,37 @@ func TestLoadBalancingAlgoConstants(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadBalancer_ValidateAddresses(t *testing.T) {
+	tests := []struct {
+		name      string
+		addresses []string
+		wantErr   error
+	}{
+		{name: "unset"},
+		{name: "single address", addresses: []string{"203.0.113.10"}},
+		{name: "IPv4 and IPv6 VIPs", addresses: []string{"203.0.113.10", "2001:db8::10"}},
+		{name: "single wildcard", addresses: []string{"::"}},
+		{name: "hostname", addresses: []string{"lb.example.com"}, wantErr: ErrInvalidAddresses},
+		{name: "CIDR", addresses: []string{"203.0.113.10/32"}, wantErr: ErrInvalidAddresses},
+		{name: "duplicate", addresses: []string{"2001:db8::10", "2001:db8:0::10"}, wantErr: ErrInvalidAddresses},
+		{name: "wildcard with others", addresses: []string{"0.0.0.0", "203.0.113.10"}, wantErr: ErrInvalidAddresses},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := LoadBalancer{
+				ID:        "lb-123",
+				Name:      "test-lb",
+				Protocol:  ProtocolTCP,
+				Algorithm: AlgoRoundRobin,
+				Addresses: tt.addresses,
+				Port:      5432,
+				Backends:  []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 5432, Enabled: true}},
+			}
+			if err := lb.Validate(); err != tt.wantErr {
+				t.Errorf("LoadBalancer.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package models
+
+import "regexp"
+
+// DefaultMaintenanceStatus is the status code served when maintenance sets none
+const DefaultMaintenanceStatus = 503
+
+// MaxMaintenanceBodySize is Envoy's default limit for direct response bodies
+const MaxMaintenanceBodySize = 4096
+
+// contentTypeRegex restricts maintenance content types to printable ASCII
+var contentTypeRegex = regexp.MustCompile(`^[\x20-\x7e]+$`)
+
+// Maintenance answers requests with a static response instead of proxying
+// them, so backends can be taken down while clients get a friendly page.
+// HTTP and HTTPS load balancers only.
+type Maintenance struct {
+	Enabled     bool   `json:"enabled" yaml:"enabled"`
+	StatusCode  int    `json:"status_code,omitempty" yaml:"status_code,omitempty"`   // default 503
+	Body        string `json:"body,omitempty" yaml:"body,omitempty"`                 // text or HTML, at most 4096 bytes
+	ContentType string `json:"content_type,omitempty" yaml:"content_type,omitempty"` // default "text/html; charset=utf-8"
+	RetryAfter  int    `json:"retry_after,omitempty" yaml:"retry_after,omitempty"`   // seconds, sent as Retry-After; 0 omits the header
+}
+
+// Validate validates the maintenance settings
+func (m *Maintenance) Validate() error {
+	if m.StatusCode != 0 && (m.StatusCode < 200 || m.StatusCode > 599) {
+		return ErrInvalidMaintenance
+	}
+	if len(m.Body) > MaxMaintenanceBodySize || m.RetryAfter < 0 {
+		return ErrInvalidMaintenance
+	}
+	if m.ContentType != "" && !contentTypeRegex.MatchString(m.ContentType) {
+		return ErrInvalidMaintenance
+	}
+	return nil
+}
+
+// Active reports whether maintenance is configured and enabled
+func (m *Maintenance) Active() bool {
+	return m != nil && m.Enabled
+}
+
+func (lb *LoadBalancer) validateMaintenance() error {
+	if lb.Maintenance == nil {
+		return nil
+	}
+	if lb.Protocol == ProtocolTCP {
+		return ErrMaintenanceRequiresHTTP
+	}
+	return lb.Maintenance.Validate()
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMaintenance_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		wantErr     error
+		maintenance Maintenance
+	}{
+		{
+			name:        "defaults",
+			maintenance: Maintenance{Enabled: true},
+			wantErr:     nil,
+		},
+		{
+			name:        "custom page",
+			maintenance: Maintenance{Enabled: true, StatusCode: 503, Body: "<h1>Back soon</h1>", ContentType: "text/html; charset=utf-8", RetryAfter: 600},
+			wantErr:     nil,
+		},
+		{
+			name:        "status code out of range",
+			maintenance: Maintenance{Enabled: true, StatusCode: 99},
+			wantErr:     ErrInvalidMaintenance,
+		},
+		{
+			name:        "body too large",
+			maintenance: Maintenance{Enabled: true, Body: strings.Repeat("x", MaxMaintenanceBodySize+1)},
+			wantErr:     ErrInvalidMaintenance,
+		},
+		{
+			name:        "content type with newline",
+			maintenance: Maintenance{Enabled: true, ContentType: "text/plain\nx-injected: 1"},
+			wantErr:     ErrInvalidMaintenance,
+		},
+		{
+			name:        "negative retry after",
+			maintenance: Maintenance{Enabled: true, RetryAfter: -1},
+			wantErr:     ErrInvalidMaintenance,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.maintenance.Validate()
+			if err != tt.wantErr {
+				t.Errorf("Maintenance.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_Validate_MaintenanceRequiresHTTP(t *testing.T) {
+	lb := &LoadBalancer{
+		ID: "lb-1", Name: "db", Protocol: ProtocolTCP, Algorithm: AlgoRoundRobin, Port: 5432,
+		Backends:    []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 5432, Enabled: true}},
+		Maintenance: &Maintenance{Enabled: true},
+	}
+	if err := lb.Validate(); err != ErrMaintenanceRequiresHTTP {
+		t.Errorf("Validate() error = %v, want %v", err, ErrMaintenanceRequiresHTTP)
+	}
+}
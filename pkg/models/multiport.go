@@ -0,0 +1,143 @@
+package models
+
+// MaxAdditionalPorts bounds the listeners one load balancer adds for its
+// port ranges; each port is an Envoy listener and cluster
+const MaxAdditionalPorts = 1000
+
+// imapIdleTimeout is the connection idle timeout of the imap helper: IMAP
+// clients re-issue IDLE at least every 29 minutes (RFC 2177)
+const imapIdleTimeout = 31 * 60
+
+// PortRange is a range of ports a TCP load balancer listens on, in addition
+// to or instead of its port. Connections to a port are forwarded to the same
+// port of the backends.
+type PortRange struct {
+	From int `json:"from" yaml:"from"`
+	To   int `json:"to,omitempty" yaml:"to,omitempty"` // inclusive, 0 = From only
+}
+
+// TCPHelper adapts a TCP load balancer to a protocol spread over several ports
+type TCPHelper string
+
+const (
+	// TCPHelperFTP sends the passive data connections of a client to the
+	// backend holding its control connection
+	TCPHelperFTP TCPHelper = "ftp"
+	// TCPHelperSMTP listens on the SMTP submission ports too (25, 465, 587)
+	TCPHelperSMTP TCPHelper = "smtp"
+	// TCPHelperIMAP listens on IMAPS too (143, 993) and keeps IDLE
+	// connections open for 31 minutes
+	TCPHelperIMAP TCPHelper = "imap"
+)
+
+// helperPorts are the ports the mail helpers listen on without explicit ports
+var helperPorts = map[TCPHelper][]int{
+	TCPHelperSMTP: {25, 465, 587},
+	TCPHelperIMAP: {143, 993},
+}
+
+// ListenPort returns the main port of lb: Port, or the first port of its
+// port range
+func (lb *LoadBalancer) ListenPort() int {
+	if lb.PortRange != nil {
+		return lb.PortRange.From
+	}
+	return lb.Port
+}
+
+// AdditionalPorts returns the ports lb listens on besides ListenPort, in
+// order: the rest of its port range, then the configured port ranges or the
+// standard ports of a mail helper
+func (lb *LoadBalancer) AdditionalPorts() []int {
+	var ports []int
+	if r := lb.PortRange; r != nil && r.To > r.From {
+		ports = PortRange{From: r.From + 1, To: r.To}.appendPorts(ports)
+	}
+	for _, r := range lb.Ports {
+		ports = r.appendPorts(ports)
+	}
+	if len(lb.Ports) == 0 && lb.PortRange == nil {
+		for _, port := range helperPorts[lb.Helper] {
+			if port != lb.Port {
+				ports = append(ports, port)
+			}
+		}
+	}
+	return ports
+}
+
+// appendPorts appends the ports of r to ports, stopping one past
+// MaxAdditionalPorts so oversized ranges stay cheap to reject
+func (r PortRange) appendPorts(ports []int) []int {
+	to := r.To
+	if to == 0 {
+		to = r.From
+	}
+	for port := r.From; port <= to && len(ports) <= MaxAdditionalPorts; port++ {
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// valid reports whether r is a range within 1-65535
+func (r PortRange) valid() bool {
+	return r.From >= 1 && r.From <= 65535 && (r.To == 0 || r.To >= r.From && r.To <= 65535)
+}
+
+// IdleTimeout returns the connection idle timeout lb's helper needs, 0 for none
+func (h TCPHelper) IdleTimeout() int {
+	if h == TCPHelperIMAP {
+		return imapIdleTimeout
+	}
+	return 0
+}
+
+func (lb *LoadBalancer) validatePorts() error {
+	switch lb.Helper {
+	case "", TCPHelperFTP, TCPHelperSMTP, TCPHelperIMAP:
+	default:
+		return ErrInvalidTCPHelper
+	}
+	if len(lb.Ports) == 0 && lb.Helper == "" && lb.PortRange == nil {
+		return nil
+	}
+	if lb.Protocol != ProtocolTCP {
+		return ErrPortsRequireTCP
+	}
+
+	// Every port forwards to the load balancer's own backends, with the
+	// listener of its main port as the template
+	if !lb.HasDefaultPool() || len(lb.Pools) > 0 || lb.TLSPassthrough != nil || lb.TCPProtocolHint != "" {
+		return ErrPortsConflict
+	}
+	// The host firewall only protects the main port
+	if lb.DDoS != nil && lb.DDoS.NeedsFirewall() {
+		return ErrPortsConflict
+	}
+
+	if lb.PortRange != nil && !lb.PortRange.valid() {
+		return ErrInvalidPortRange
+	}
+	for _, r := range lb.Ports {
+		if !r.valid() {
+			return ErrInvalidPortRange
+		}
+	}
+	ports := lb.AdditionalPorts()
+	if len(ports) > MaxAdditionalPorts {
+		return ErrInvalidPortRange
+	}
+	seen := map[int]bool{lb.ListenPort(): true}
+	for _, port := range ports {
+		if seen[port] {
+			return ErrInvalidPortRange
+		}
+		seen[port] = true
+	}
+
+	// Passive data connections follow the control connection by client address
+	if lb.Helper == TCPHelperFTP && (len(lb.Ports) == 0 || lb.Algorithm != AlgoRingHash) {
+		return ErrFTPHelper
+	}
+	return nil
+}
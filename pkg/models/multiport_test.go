@@ -0,0 +1,188 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadBalancer_Validate_Ports(t *testing.T) {
+	portsLB := func(helper TCPHelper, ports ...PortRange) *LoadBalancer {
+		return &LoadBalancer{
+			ID: "lb-1", Name: "lb", Protocol: ProtocolTCP, Algorithm: AlgoRingHash, Port: 21,
+			Backends: []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 21, Enabled: true}},
+			Ports:    ports,
+			Helper:   helper,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		lb      *LoadBalancer
+		wantErr error
+	}{
+		{name: "range", lb: portsLB("", PortRange{From: 30000, To: 30099})},
+		{name: "single ports", lb: portsLB("", PortRange{From: 2121}, PortRange{From: 990})},
+		{name: "ftp", lb: portsLB(TCPHelperFTP, PortRange{From: 30000, To: 30099})},
+		{name: "smtp without ports", lb: portsLB(TCPHelperSMTP)},
+		{name: "imap without ports", lb: portsLB(TCPHelperIMAP)},
+		{
+			name: "port range",
+			lb: func() *LoadBalancer {
+				lb := portsLB("")
+				lb.Port, lb.PortRange = 0, &PortRange{From: 27015, To: 27030}
+				return lb
+			}(),
+		},
+		{
+			name: "port range and port",
+			lb: func() *LoadBalancer {
+				lb := portsLB("")
+				lb.PortRange = &PortRange{From: 27015, To: 27030}
+				return lb
+			}(),
+			wantErr: ErrInvalidPort,
+		},
+		{
+			name: "inverted port range",
+			lb: func() *LoadBalancer {
+				lb := portsLB("")
+				lb.Port, lb.PortRange = 0, &PortRange{From: 27030, To: 27015}
+				return lb
+			}(),
+			wantErr: ErrInvalidPortRange,
+		},
+		{
+			name: "port range too large",
+			lb: func() *LoadBalancer {
+				lb := portsLB("")
+				lb.Port, lb.PortRange = 0, &PortRange{From: 10000, To: 11001}
+				return lb
+			}(),
+			wantErr: ErrInvalidPortRange,
+		},
+		{
+			name: "port range overlapping ports",
+			lb: func() *LoadBalancer {
+				lb := portsLB("", PortRange{From: 27020})
+				lb.Port, lb.PortRange = 0, &PortRange{From: 27015, To: 27030}
+				return lb
+			}(),
+			wantErr: ErrInvalidPortRange,
+		},
+		{
+			name:    "unknown helper",
+			lb:      portsLB("pop3"),
+			wantErr: ErrInvalidTCPHelper,
+		},
+		{
+			name: "http",
+			lb: func() *LoadBalancer {
+				lb := portsLB("", PortRange{From: 8080})
+				lb.Protocol = ProtocolHTTP
+				return lb
+			}(),
+			wantErr: ErrPortsRequireTCP,
+		},
+		{
+			name:    "inverted range",
+			lb:      portsLB("", PortRange{From: 30099, To: 30000}),
+			wantErr: ErrInvalidPortRange,
+		},
+		{
+			name:    "port out of range",
+			lb:      portsLB("", PortRange{From: 65000, To: 65536}),
+			wantErr: ErrInvalidPortRange,
+		},
+		{
+			name:    "overlapping ranges",
+			lb:      portsLB("", PortRange{From: 30000, To: 30010}, PortRange{From: 30010}),
+			wantErr: ErrInvalidPortRange,
+		},
+		{
+			name:    "main port repeated",
+			lb:      portsLB("", PortRange{From: 20, To: 22}),
+			wantErr: ErrInvalidPortRange,
+		},
+		{
+			name:    "too many ports",
+			lb:      portsLB("", PortRange{From: 10000, To: 11000}),
+			wantErr: ErrInvalidPortRange,
+		},
+		{
+			name: "pools",
+			lb: func() *LoadBalancer {
+				lb := portsLB("", PortRange{From: 2121})
+				lb.Pools = []BackendPool{{Name: "api", Backends: lb.Backends}}
+				return lb
+			}(),
+			wantErr: ErrPortsConflict,
+		},
+		{
+			name: "protocol hint",
+			lb: func() *LoadBalancer {
+				lb := portsLB("", PortRange{From: 2121})
+				lb.TCPProtocolHint = TCPProtocolMySQL
+				return lb
+			}(),
+			wantErr: ErrPortsConflict,
+		},
+		{
+			name:    "ftp without passive range",
+			lb:      portsLB(TCPHelperFTP),
+			wantErr: ErrFTPHelper,
+		},
+		{
+			name: "ftp without ring hash",
+			lb: func() *LoadBalancer {
+				lb := portsLB(TCPHelperFTP, PortRange{From: 30000, To: 30099})
+				lb.Algorithm = AlgoRoundRobin
+				return lb
+			}(),
+			wantErr: ErrFTPHelper,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.lb.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_AdditionalPorts(t *testing.T) {
+	tests := []struct {
+		name string
+		lb   *LoadBalancer
+		want []int
+	}{
+		{name: "none", lb: &LoadBalancer{Port: 21}},
+		{
+			name: "ranges",
+			lb:   &LoadBalancer{Port: 21, Ports: []PortRange{{From: 30000, To: 30002}, {From: 2121}}},
+			want: []int{30000, 30001, 30002, 2121},
+		},
+		{name: "smtp", lb: &LoadBalancer{Port: 25, Helper: TCPHelperSMTP}, want: []int{465, 587}},
+		{name: "imap", lb: &LoadBalancer{Port: 143, Helper: TCPHelperIMAP}, want: []int{993}},
+		{
+			name: "port range",
+			lb:   &LoadBalancer{PortRange: &PortRange{From: 27015, To: 27017}, Ports: []PortRange{{From: 2121}}},
+			want: []int{27016, 27017, 2121},
+		},
+		{name: "single port range", lb: &LoadBalancer{PortRange: &PortRange{From: 27015}}},
+		{
+			name: "explicit ports replace the helper's",
+			lb:   &LoadBalancer{Port: 25, Helper: TCPHelperSMTP, Ports: []PortRange{{From: 587}}},
+			want: []int{587},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.lb.AdditionalPorts(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AdditionalPorts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package models
+
+// MaxSNIRoutes caps the server name routes of a TLS passthrough listener;
+// each one is a filter chain of its own
+const MaxSNIRoutes = 100
+
+// TLSPassthrough routes the TLS connections of a TCP load balancer by the
+// server name (SNI) of the client hello, without terminating TLS, so traffic
+// stays encrypted end to end. Connections whose server name matches no route
+// go to the load balancer's own backends, or are closed when it has none.
+type TLSPassthrough struct {
+	Routes []SNIRoute `json:"routes" yaml:"routes"`
+}
+
+// SNIRoute sends TLS connections for some server names to a backend pool
+type SNIRoute struct {
+	ServerNames []string `json:"server_names" yaml:"server_names"`     // "*.example.com" wildcards allowed
+	Pool        string   `json:"pool,omitempty" yaml:"pool,omitempty"` // empty targets the load balancer's own backends
+}
+
+// Validate validates the routes on their own; pool references are checked by
+// the load balancer
+func (p *TLSPassthrough) Validate() error {
+	if len(p.Routes) == 0 || len(p.Routes) > MaxSNIRoutes {
+		return ErrInvalidTLSPassthrough
+	}
+	// Envoy rejects filter chains with the same match
+	seen := make(map[string]bool)
+	for _, route := range p.Routes {
+		if len(route.ServerNames) == 0 {
+			return ErrInvalidTLSPassthrough
+		}
+		for _, name := range route.ServerNames {
+			if !validRouteHost(name) || seen[name] {
+				return ErrInvalidTLSPassthrough
+			}
+			seen[name] = true
+		}
+	}
+	return nil
+}
+
+func (lb *LoadBalancer) validateTLSPassthrough() error {
+	if lb.TLSPassthrough == nil {
+		return nil
+	}
+	if lb.Protocol != ProtocolTCP {
+		return ErrTLSPassthroughRequiresTCP
+	}
+	// The protocol filters cannot decode encrypted traffic
+	if lb.TCPProtocolHint != "" {
+		return ErrTLSPassthroughConflict
+	}
+	if err := lb.TLSPassthrough.Validate(); err != nil {
+		return err
+	}
+
+	pools := make(map[string]bool, len(lb.Pools))
+	for i := range lb.Pools {
+		pools[lb.Pools[i].Name] = true
+	}
+	for _, route := range lb.TLSPassthrough.Routes {
+		if route.Pool == "" && !lb.HasDefaultPool() || route.Pool != "" && !pools[route.Pool] {
+			return ErrUnknownPool
+		}
+	}
+	return nil
+}
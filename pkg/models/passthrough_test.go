@@ -0,0 +1,83 @@
+package models
+
+import "testing"
+
+func TestLoadBalancer_Validate_TLSPassthrough(t *testing.T) {
+	passthroughLB := func(protocol Protocol, routes ...SNIRoute) *LoadBalancer {
+		return &LoadBalancer{
+			ID: "lb-1", Name: "lb", Protocol: protocol, Algorithm: AlgoRoundRobin, Port: 443,
+			Backends:       []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 443, Enabled: true}},
+			Pools:          []BackendPool{{Name: "api", Backends: []Backend{{ID: "api-1", Address: "10.0.1.1", Port: 443, Enabled: true}}}},
+			TLSPassthrough: &TLSPassthrough{Routes: routes},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		lb      *LoadBalancer
+		wantErr error
+	}{
+		{
+			name: "pool and default backends",
+			lb: passthroughLB(ProtocolTCP,
+				SNIRoute{ServerNames: []string{"api.example.com", "*.api.example.com"}, Pool: "api"},
+				SNIRoute{ServerNames: []string{"www.example.com"}}),
+		},
+		{
+			name:    "no routes",
+			lb:      passthroughLB(ProtocolTCP),
+			wantErr: ErrInvalidTLSPassthrough,
+		},
+		{
+			name:    "route without server names",
+			lb:      passthroughLB(ProtocolTCP, SNIRoute{Pool: "api"}),
+			wantErr: ErrInvalidTLSPassthrough,
+		},
+		{
+			name:    "invalid server name",
+			lb:      passthroughLB(ProtocolTCP, SNIRoute{ServerNames: []string{"api example.com"}}),
+			wantErr: ErrInvalidTLSPassthrough,
+		},
+		{
+			name: "server name in two routes",
+			lb: passthroughLB(ProtocolTCP,
+				SNIRoute{ServerNames: []string{"api.example.com"}, Pool: "api"},
+				SNIRoute{ServerNames: []string{"api.example.com"}}),
+			wantErr: ErrInvalidTLSPassthrough,
+		},
+		{
+			name:    "unknown pool",
+			lb:      passthroughLB(ProtocolTCP, SNIRoute{ServerNames: []string{"api.example.com"}, Pool: "web"}),
+			wantErr: ErrUnknownPool,
+		},
+		{
+			name:    "passthrough on http",
+			lb:      passthroughLB(ProtocolHTTP, SNIRoute{ServerNames: []string{"api.example.com"}}),
+			wantErr: ErrTLSPassthroughRequiresTCP,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.lb.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("default backends missing", func(t *testing.T) {
+		lb := passthroughLB(ProtocolTCP, SNIRoute{ServerNames: []string{"www.example.com"}})
+		lb.Backends = nil
+		if err := lb.Validate(); err != ErrUnknownPool {
+			t.Errorf("Validate() error = %v, want %v", err, ErrUnknownPool)
+		}
+	})
+
+	t.Run("protocol hint", func(t *testing.T) {
+		lb := passthroughLB(ProtocolTCP, SNIRoute{ServerNames: []string{"db.example.com"}})
+		lb.TCPProtocolHint = TCPProtocolPostgres
+		if err := lb.Validate(); err != ErrTLSPassthroughConflict {
+			t.Errorf("Validate() error = %v, want %v", err, ErrTLSPassthroughConflict)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Plan holds the commercial limits of a load balancer's plan
+type Plan struct {
+	Name             string   `json:"name,omitempty" yaml:"name,omitempty"`
+	MaxBackends      int      `json:"max_backends,omitempty" yaml:"max_backends,omitempty"`           // enabled backends by ID, 0 = unlimited
+	MaxConnections   int      `json:"max_connections,omitempty" yaml:"max_connections,omitempty"`     // concurrent connections to the listener, 0 = unlimited
+	DisabledFeatures []string `json:"disabled_features,omitempty" yaml:"disabled_features,omitempty"` // features the plan does not include
+}
+
+// Features a plan may leave out
+const (
+	FeatureWAF            = "waf"
+	FeatureCustomFilters  = "custom_filters"
+	FeatureJWTAuth        = "jwt_auth"
+	FeatureAuthorization  = "authorization"
+	FeatureTracing        = "tracing"
+	FeatureAutoscaling    = "autoscaling"
+	FeatureDiscovery      = "discovery"
+	FeatureTrafficSplit   = "traffic_split"
+	FeatureDDoSProtection = "ddos_protection"
+)
+
+// planFeature is a feature a plan may leave out, and how to tell whether a
+// load balancer uses it
+type planFeature struct {
+	name string
+	used func(lb *LoadBalancer) bool
+}
+
+// planFeatures lists the features a plan may leave out
+var planFeatures = []planFeature{
+	{name: FeatureWAF, used: func(lb *LoadBalancer) bool { return lb.WAF != nil }},
+	{name: FeatureCustomFilters, used: func(lb *LoadBalancer) bool { return len(lb.CustomFilters) > 0 }},
+	{name: FeatureJWTAuth, used: func(lb *LoadBalancer) bool { return lb.JWTAuth != nil }},
+	{name: FeatureAuthorization, used: func(lb *LoadBalancer) bool { return lb.Authorization != nil }},
+	{name: FeatureTracing, used: func(lb *LoadBalancer) bool { return lb.Tracing != nil }},
+	{name: FeatureAutoscaling, used: func(lb *LoadBalancer) bool { return lb.Autoscaling != nil }},
+	{name: FeatureDiscovery, used: func(lb *LoadBalancer) bool { return lb.Discovery != nil }},
+	{name: FeatureTrafficSplit, used: func(lb *LoadBalancer) bool {
+		for _, route := range lb.Routes {
+			if route.Split != nil {
+				return true
+			}
+		}
+		return false
+	}},
+	{name: FeatureDDoSProtection, used: func(lb *LoadBalancer) bool { return lb.DDoS != nil }},
+}
+
+// PlanError reports what a load balancer uses beyond the limits of its plan
+type PlanError struct {
+	Plan       string
+	Violations []string // "12 backends (plan allows 10)", "feature waf"
+}
+
+func (e *PlanError) Error() string {
+	return fmt.Sprintf("plan %s does not allow %s", e.Plan, strings.Join(e.Violations, ", "))
+}
+
+// Check returns a *PlanError when lb exceeds the limits of plan p. Backends
+// are counted once per ID across the load balancer and its pools, after
+// discovery and label selection.
+func (p *Plan) Check(lb *LoadBalancer) error {
+	var violations []string
+	if backends := lb.countBackends(); p.MaxBackends > 0 && backends > p.MaxBackends {
+		violations = append(violations, fmt.Sprintf("%d backends (plan allows %d)", backends, p.MaxBackends))
+	}
+	if p.MaxConnections > 0 && lb.MaxConnections > p.MaxConnections {
+		violations = append(violations, fmt.Sprintf("max_connections %d (plan allows %d)", lb.MaxConnections, p.MaxConnections))
+	}
+	for _, f := range planFeatures {
+		if slices.Contains(p.DisabledFeatures, f.name) && f.used(lb) {
+			violations = append(violations, "feature "+f.name)
+		}
+	}
+	if len(violations) > 0 {
+		return &PlanError{Plan: p.Name, Violations: violations}
+	}
+	return nil
+}
+
+// countBackends counts the enabled backends of the load balancer and its
+// pools by ID
+func (lb *LoadBalancer) countBackends() int {
+	ids := make(map[string]bool)
+	for _, backend := range lb.Backends {
+		if backend.Enabled {
+			ids[backend.ID] = true
+		}
+	}
+	for _, pool := range lb.Pools {
+		for _, backend := range pool.Backends {
+			if backend.Enabled {
+				ids[backend.ID] = true
+			}
+		}
+	}
+	return len(ids)
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPlan_Check(t *testing.T) {
+	lb := &LoadBalancer{
+		MaxConnections: 5000,
+		Backends: []Backend{
+			{ID: "web-1", Enabled: true},
+			{ID: "web-2", Enabled: true},
+			{ID: "web-3"}, // disabled backends do not count
+		},
+		Pools: []BackendPool{{Name: "api", Backends: []Backend{
+			{ID: "web-1", Enabled: true}, // counted once
+			{ID: "api-1", Enabled: true},
+		}}},
+		Routes: []Route{{Name: "canary", Split: &TrafficSplit{}}},
+	}
+
+	tests := []struct {
+		name string
+		plan Plan
+		want []string
+	}{
+		{name: "unlimited", plan: Plan{}},
+		{name: "within limits", plan: Plan{MaxBackends: 3, MaxConnections: 5000, DisabledFeatures: []string{FeatureWAF}}},
+		{name: "too many backends", plan: Plan{MaxBackends: 2}, want: []string{"3 backends (plan allows 2)"}},
+		{name: "too many connections", plan: Plan{MaxConnections: 1000}, want: []string{"max_connections 5000 (plan allows 1000)"}},
+		{name: "disabled feature", plan: Plan{DisabledFeatures: []string{FeatureTrafficSplit, FeatureTracing}}, want: []string{"feature traffic_split"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.plan.Name = "basic"
+			err := tt.plan.Check(lb)
+			var exceeded *PlanError
+			switch {
+			case tt.want == nil && err != nil:
+				t.Errorf("Check() error = %v", err)
+			case tt.want != nil && (!errors.As(err, &exceeded) || !reflect.DeepEqual(exceeded.Violations, tt.want)):
+				t.Errorf("Check() error = %v, want violations %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+// Backend warm-up bounds
+const (
+	MaxPrewarmWindow     = 3600 // seconds
+	MaxPrewarmAggression = 10
+	MinPreconnectRatio   = 1
+	MaxPreconnectRatio   = 3 // Envoy's limit
+)
+
+// Prewarm eases traffic onto backends that were just added or became
+// healthy again, so cold backends (empty caches, JIT warm-up) are not
+// slammed with their full share at once
+type Prewarm struct {
+	Window          int     `json:"window,omitempty" yaml:"window,omitempty"`                     // seconds over which the weight of a new or recovered backend ramps up, 0 = full weight at once
+	Aggression      float64 `json:"aggression,omitempty" yaml:"aggression,omitempty"`             // shape of the ramp: 1 (default) linear, above 1 faster at first, below 1 slower
+	PreconnectRatio float64 `json:"preconnect_ratio,omitempty" yaml:"preconnect_ratio,omitempty"` // connections kept open per connection in use, 1-3, 0 = none in advance
+}
+
+// Validate validates the warm-up settings
+func (p *Prewarm) Validate() error {
+	if p.Window == 0 && p.PreconnectRatio == 0 {
+		return ErrInvalidPrewarm
+	}
+	if p.Window < 0 || p.Window > MaxPrewarmWindow {
+		return ErrInvalidPrewarm
+	}
+	if p.Aggression != 0 && (p.Window == 0 || p.Aggression < 0 || p.Aggression > MaxPrewarmAggression) {
+		return ErrInvalidPrewarm
+	}
+	if p.PreconnectRatio != 0 && (p.PreconnectRatio < MinPreconnectRatio || p.PreconnectRatio > MaxPreconnectRatio) {
+		return ErrInvalidPrewarm
+	}
+	return nil
+}
+
+func (lb *LoadBalancer) validatePrewarm() error {
+	if lb.Prewarm == nil {
+		return nil
+	}
+	if err := lb.Prewarm.Validate(); err != nil {
+		return err
+	}
+	// Envoy ramps weights only for the round robin and least request balancers
+	if lb.Prewarm.Window > 0 && lb.Algorithm != AlgoRoundRobin && lb.Algorithm != AlgoLeastRequest {
+		return ErrPrewarmAlgorithm
+	}
+	return nil
+}
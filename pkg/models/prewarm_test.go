@@ -0,0 +1,102 @@
+package models
+
+import "testing"
+
+func TestPrewarm_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr error
+		prewarm Prewarm
+	}{
+		{
+			name:    "slow start",
+			prewarm: Prewarm{Window: 60},
+			wantErr: nil,
+		},
+		{
+			name:    "slow start with aggression and preconnect",
+			prewarm: Prewarm{Window: 120, Aggression: 1.5, PreconnectRatio: 2},
+			wantErr: nil,
+		},
+		{
+			name:    "preconnect only",
+			prewarm: Prewarm{PreconnectRatio: 1},
+			wantErr: nil,
+		},
+		{
+			name:    "nothing set",
+			prewarm: Prewarm{},
+			wantErr: ErrInvalidPrewarm,
+		},
+		{
+			name:    "window too long",
+			prewarm: Prewarm{Window: MaxPrewarmWindow + 1},
+			wantErr: ErrInvalidPrewarm,
+		},
+		{
+			name:    "negative window",
+			prewarm: Prewarm{Window: -1, PreconnectRatio: 1},
+			wantErr: ErrInvalidPrewarm,
+		},
+		{
+			name:    "aggression without window",
+			prewarm: Prewarm{Aggression: 2, PreconnectRatio: 1},
+			wantErr: ErrInvalidPrewarm,
+		},
+		{
+			name:    "aggression too high",
+			prewarm: Prewarm{Window: 60, Aggression: 11},
+			wantErr: ErrInvalidPrewarm,
+		},
+		{
+			name:    "preconnect ratio below one",
+			prewarm: Prewarm{PreconnectRatio: 0.5},
+			wantErr: ErrInvalidPrewarm,
+		},
+		{
+			name:    "preconnect ratio above Envoy's limit",
+			prewarm: Prewarm{PreconnectRatio: 3.5},
+			wantErr: ErrInvalidPrewarm,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.prewarm.Validate()
+			if err != tt.wantErr {
+				t.Errorf("Prewarm.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_Validate_PrewarmAlgorithm(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm LoadBalancingAlgo
+		prewarm   *Prewarm
+		wantErr   error
+	}{
+		{name: "round robin slow start", algorithm: AlgoRoundRobin, prewarm: &Prewarm{Window: 60}},
+		{name: "least request slow start", algorithm: AlgoLeastRequest, prewarm: &Prewarm{Window: 60}},
+		{name: "ring hash slow start", algorithm: AlgoRingHash, prewarm: &Prewarm{Window: 60}, wantErr: ErrPrewarmAlgorithm},
+		{name: "random preconnect", algorithm: AlgoRandom, prewarm: &Prewarm{PreconnectRatio: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := LoadBalancer{
+				ID:        "lb-1",
+				Name:      "web",
+				Protocol:  ProtocolHTTP,
+				Algorithm: tt.algorithm,
+				Port:      80,
+				Backends:  []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}},
+				Prewarm:   tt.prewarm,
+			}
+			if err := lb.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package models
+
+// retryOnConditions are the Envoy retry_on conditions accepted in RetryPolicy
+var retryOnConditions = map[string]bool{
+	"5xx":                    true,
+	"gateway-error":          true,
+	"reset":                  true,
+	"connect-failure":        true,
+	"retriable-4xx":          true,
+	"refused-stream":         true,
+	"retriable-status-codes": true,
+	"envoy-ratelimited":      true,
+}
+
+// RetryPolicy defines how failed upstream requests are retried for the
+// backend pool, and the retry budget that caps retries under load
+type RetryPolicy struct {
+	RetryOn             []string `json:"retry_on,omitempty" yaml:"retry_on,omitempty"`               // e.g. connect-failure, 5xx
+	NumRetries          int      `json:"num_retries" yaml:"num_retries"`                             // max retries per request
+	PerTryTimeout       int      `json:"per_try_timeout,omitempty" yaml:"per_try_timeout,omitempty"` // seconds
+	BudgetPercent       float64  `json:"budget_percent,omitempty" yaml:"budget_percent,omitempty"`   // % of active requests that may be retries
+	MinRetryConcurrency int      `json:"min_retry_concurrency,omitempty" yaml:"min_retry_concurrency,omitempty"`
+}
+
+// Validate validates the retry policy
+func (r *RetryPolicy) Validate() error {
+	if r.NumRetries < 0 || r.NumRetries > 10 {
+		return ErrInvalidRetryCount
+	}
+	for _, cond := range r.RetryOn {
+		if !retryOnConditions[cond] {
+			return ErrInvalidRetryOn
+		}
+	}
+	if r.PerTryTimeout < 0 {
+		return ErrInvalidTimeout
+	}
+	if r.BudgetPercent < 0 || r.BudgetPercent > 100 || r.MinRetryConcurrency < 0 {
+		return ErrInvalidRetryBudget
+	}
+	return nil
+}
+
+// HasBudget returns true if a retry budget is configured
+func (r *RetryPolicy) HasBudget() bool {
+	return r.BudgetPercent > 0 || r.MinRetryConcurrency > 0
+}
+
+// RetryBudget caps the retries to one backend pool under load
+type RetryBudget struct {
+	BudgetPercent       float64 `json:"budget_percent,omitempty" yaml:"budget_percent,omitempty"` // % of active requests that may be retries
+	MinRetryConcurrency int     `json:"min_retry_concurrency,omitempty" yaml:"min_retry_concurrency,omitempty"`
+}
+
+// Validate validates the retry budget
+func (b *RetryBudget) Validate() error {
+	if b.BudgetPercent < 0 || b.BudgetPercent > 100 || b.MinRetryConcurrency < 0 {
+		return ErrInvalidRetryBudget
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package models
+
+import "testing"
+
+func TestRetryPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr error
+		policy  RetryPolicy
+	}{
+		{
+			name:    "valid policy with budget",
+			policy:  RetryPolicy{RetryOn: []string{"5xx", "connect-failure"}, NumRetries: 2, PerTryTimeout: 3, BudgetPercent: 20, MinRetryConcurrency: 3},
+			wantErr: nil,
+		},
+		{
+			name:    "zero retries is valid",
+			policy:  RetryPolicy{},
+			wantErr: nil,
+		},
+		{
+			name:    "negative retries",
+			policy:  RetryPolicy{NumRetries: -1},
+			wantErr: ErrInvalidRetryCount,
+		},
+		{
+			name:    "too many retries",
+			policy:  RetryPolicy{NumRetries: 11},
+			wantErr: ErrInvalidRetryCount,
+		},
+		{
+			name:    "unknown retry condition",
+			policy:  RetryPolicy{NumRetries: 1, RetryOn: []string{"5xx\ninjected: true"}},
+			wantErr: ErrInvalidRetryOn,
+		},
+		{
+			name:    "negative per-try timeout",
+			policy:  RetryPolicy{NumRetries: 1, PerTryTimeout: -1},
+			wantErr: ErrInvalidTimeout,
+		},
+		{
+			name:    "budget over 100 percent",
+			policy:  RetryPolicy{NumRetries: 1, BudgetPercent: 150},
+			wantErr: ErrInvalidRetryBudget,
+		},
+		{
+			name:    "negative min retry concurrency",
+			policy:  RetryPolicy{NumRetries: 1, MinRetryConcurrency: -1},
+			wantErr: ErrInvalidRetryBudget,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if err != tt.wantErr {
+				t.Errorf("RetryPolicy.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_HasBudget(t *testing.T) {
+	if (&RetryPolicy{NumRetries: 3}).HasBudget() {
+		t.Error("Expected no budget without budget fields")
+	}
+	if !(&RetryPolicy{BudgetPercent: 25}).HasBudget() {
+		t.Error("Expected budget when BudgetPercent is set")
+	}
+}
@@ -0,0 +1,310 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+)
+
+// routePathRegex restricts route paths to characters that are safe to render
+var routePathRegex = regexp.MustCompile(`^/[a-zA-Z0-9/_\-.~%]*$`)
+
+// PathMatch selects how a route path is compared with the request path
+type PathMatch string
+
+const (
+	// PathMatchPrefix matches requests whose path starts with the route path (default)
+	PathMatchPrefix PathMatch = "prefix"
+	// PathMatchExact matches requests whose path equals the route path
+	PathMatchExact PathMatch = "exact"
+)
+
+// BackendPool is a named group of backends that routes can target. Pools
+// share the load balancer's algorithm, health check and connection settings,
+// except for the overrides below. A pool with a selector also takes the load
+// balancer's backends whose labels match it, so subsets need no backend lists
+// of their own.
+type BackendPool struct {
+	Name        string       `json:"name" yaml:"name"`
+	Backends    []Backend    `json:"backends" yaml:"backends"`
+	Selector    string       `json:"selector,omitempty" yaml:"selector,omitempty"`       // label expression, e.g. "version=v2,tier in (premium,gold)"
+	Discovery   *Discovery   `json:"discovery,omitempty" yaml:"discovery,omitempty"`     // adds discovered backends to the pool
+	Autoscaling *Autoscaling `json:"autoscaling,omitempty" yaml:"autoscaling,omitempty"` // scales the servers behind the pool
+
+	// Overrides of the load balancer's settings for this pool, e.g. for slow
+	// on-premises backends next to fast local ones
+	ConnectTimeout int             `json:"connect_timeout,omitempty" yaml:"connect_timeout,omitempty"` // seconds; 0 keeps timeouts.connect
+	RetryBudget    *RetryBudget    `json:"retry_budget,omitempty" yaml:"retry_budget,omitempty"`       // replaces the budget of retry_policy
+	ConnectionPool *ConnectionPool `json:"connection_pool,omitempty" yaml:"connection_pool,omitempty"` // fields set replace those of connection_pool
+}
+
+// Validate validates the backend pool
+func (p *BackendPool) Validate() error {
+	if p.Name == "" || !safeIdentifierRegex.MatchString(p.Name) || len(p.Name) > 64 {
+		return ErrInvalidPool
+	}
+	if len(p.Backends) == 0 && p.Discovery == nil && p.Selector == "" {
+		return ErrNoBackends
+	}
+	if p.Selector != "" {
+		if _, err := ParseSelector(p.Selector); err != nil {
+			return err
+		}
+	}
+	if p.Discovery != nil {
+		if err := p.Discovery.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.ConnectTimeout < 0 {
+		return ErrInvalidTimeout
+	}
+	if p.RetryBudget != nil {
+		if err := p.RetryBudget.Validate(); err != nil {
+			return err
+		}
+	}
+	for i := range p.Backends {
+		if err := p.Backends[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Route sends matching HTTP requests to a backend pool. Routes are matched
+// most specific first: by host, then by longest path.
+type Route struct {
+	Name         string        `json:"name" yaml:"name"`
+	Hosts        []string      `json:"hosts,omitempty" yaml:"hosts,omitempty"` // empty matches any host; "*.example.com" wildcards allowed
+	Path         string        `json:"path" yaml:"path"`
+	PathMatch    PathMatch     `json:"path_match,omitempty" yaml:"path_match,omitempty"`       // prefix (default) or exact
+	Pool         string        `json:"pool,omitempty" yaml:"pool,omitempty"`                   // empty targets the load balancer's own backends
+	Split        *TrafficSplit `json:"traffic_split,omitempty" yaml:"traffic_split,omitempty"` // replaces pool
+	Maintenance  *Maintenance  `json:"maintenance,omitempty" yaml:"maintenance,omitempty"`     // static response for this route only
+	StatPrefix   string        `json:"stat_prefix,omitempty" yaml:"stat_prefix,omitempty"`     // emit vhost.<host>.route.<stat_prefix> stats for this route
+	JWT          *RouteJWT     `json:"jwt,omitempty" yaml:"jwt,omitempty"`                     // token requirement of this route; needs jwt_auth
+	BasicAuth    *BasicAuth    `json:"basic_auth,omitempty" yaml:"basic_auth,omitempty"`       // require HTTP basic authentication
+	AllowedCIDRs []string      `json:"allowed_cidrs,omitempty" yaml:"allowed_cidrs,omitempty"` // only clients in these ranges; others get 403
+
+	// Conditions requests must meet besides host and path, all of them
+	Headers     []MatchCondition `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Cookies     []MatchCondition `json:"cookies,omitempty" yaml:"cookies,omitempty"`
+	QueryParams []MatchCondition `json:"query_params,omitempty" yaml:"query_params,omitempty"`
+
+	// Overrides of the load balancer's settings for this route
+	Timeouts    *RouteTimeouts `json:"timeouts,omitempty" yaml:"timeouts,omitempty"`
+	RetryPolicy *RetryPolicy   `json:"retry_policy,omitempty" yaml:"retry_policy,omitempty"` // replaces retry_policy; num_retries 0 disables retries
+
+	// Resilience testing, applied on staging nodes only
+	FaultInjection *FaultInjection `json:"fault_injection,omitempty" yaml:"fault_injection,omitempty"`
+}
+
+// RouteTimeouts bound the requests of a route; 0 keeps the load balancer's
+// timeout. They may not exceed the load balancer's timeouts.
+type RouteTimeouts struct {
+	Request int `json:"request,omitempty" yaml:"request,omitempty"` // seconds until the whole request is answered
+	Idle    int `json:"idle,omitempty" yaml:"idle,omitempty"`       // seconds a request may stay without activity
+}
+
+// TrafficSplit divides a route's traffic between backend pools by percentage,
+// e.g. 90/10 for a canary or 100/0 to switch blue/green deployments
+type TrafficSplit struct {
+	Rollout *Rollout      `json:"rollout,omitempty" yaml:"rollout,omitempty"` // automate shifting traffic to a canary pool
+	Targets []SplitTarget `json:"targets" yaml:"targets"`
+}
+
+// Rollout shifts a two-way split towards the canary pool step by step while
+// the canary stays healthy, and rolls it back to 0% as soon as it is not.
+// The configured target weights are the starting point.
+type Rollout struct {
+	Canary       string  `json:"canary" yaml:"canary"`                                     // pool receiving the new version; must be a split target
+	StepWeight   int     `json:"step_weight" yaml:"step_weight"`                           // percent added per step
+	StepInterval int     `json:"step_interval,omitempty" yaml:"step_interval,omitempty"`   // seconds between steps (default 60)
+	MaxErrorRate float64 `json:"max_error_rate" yaml:"max_error_rate"`                     // percent of 5xx canary responses that triggers a rollback
+	MaxLatencyMs int     `json:"max_latency_ms,omitempty" yaml:"max_latency_ms,omitempty"` // p99 canary latency that triggers a rollback; 0 disables
+	MinRequests  int     `json:"min_requests,omitempty" yaml:"min_requests,omitempty"`     // canary requests needed before a step is judged
+}
+
+// Validate validates the rollout settings
+func (r *Rollout) Validate() error {
+	if r.Canary == "" || r.StepWeight < 1 || r.StepWeight > 100 || r.StepInterval < 0 {
+		return ErrInvalidRollout
+	}
+	if r.MaxErrorRate <= 0 || r.MaxErrorRate > 100 || r.MaxLatencyMs < 0 || r.MinRequests < 0 {
+		return ErrInvalidRollout
+	}
+	return nil
+}
+
+// SplitTarget is one pool of a traffic split
+type SplitTarget struct {
+	Pool   string `json:"pool,omitempty" yaml:"pool,omitempty"` // empty targets the load balancer's own backends
+	Weight int    `json:"weight" yaml:"weight"`                 // percent, 0-100
+}
+
+// Validate checks the weights and that each pool appears once
+func (s *TrafficSplit) Validate() error {
+	if len(s.Targets) < 2 {
+		return ErrInvalidSplit
+	}
+	total := 0
+	seen := make(map[string]bool, len(s.Targets))
+	for _, target := range s.Targets {
+		if target.Weight < 0 || target.Weight > 100 || seen[target.Pool] {
+			return ErrInvalidSplit
+		}
+		seen[target.Pool] = true
+		total += target.Weight
+	}
+	if total != 100 {
+		return ErrInvalidSplit
+	}
+	if s.Rollout != nil {
+		// A rollout moves weight between exactly one canary and one baseline
+		if len(s.Targets) != 2 || !seen[s.Rollout.Canary] {
+			return ErrInvalidRollout
+		}
+		return s.Rollout.Validate()
+	}
+	return nil
+}
+
+// Pools returns the pools the route sends traffic to
+func (r *Route) Pools() []string {
+	if r.Split == nil {
+		return []string{r.Pool}
+	}
+	pools := make([]string, 0, len(r.Split.Targets))
+	for _, target := range r.Split.Targets {
+		pools = append(pools, target.Pool)
+	}
+	return pools
+}
+
+// Validate validates the route on its own; pool references are checked by the load balancer
+func (r *Route) Validate() error {
+	if r.Name == "" || !safeIdentifierRegex.MatchString(r.Name) || len(r.Name) > 64 {
+		return ErrInvalidRoute
+	}
+	if !routePathRegex.MatchString(r.Path) {
+		return ErrInvalidRoutePath
+	}
+	if r.PathMatch != "" && r.PathMatch != PathMatchPrefix && r.PathMatch != PathMatchExact {
+		return ErrInvalidRoutePath
+	}
+	for _, host := range r.Hosts {
+		if !validRouteHost(host) {
+			return ErrInvalidRouteHost
+		}
+	}
+	if r.StatPrefix != "" && !StatsNameRegex.MatchString(r.StatPrefix) {
+		return ErrInvalidStatsPrefix
+	}
+	if r.Split != nil {
+		if r.Pool != "" {
+			return ErrInvalidSplit
+		}
+		if err := r.Split.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := r.validateConditions(); err != nil {
+		return err
+	}
+	if r.Timeouts != nil && (r.Timeouts.Request < 0 || r.Timeouts.Idle < 0) {
+		return ErrInvalidTimeout
+	}
+	if r.RetryPolicy != nil {
+		if r.RetryPolicy.HasBudget() {
+			return ErrRouteRetryBudget
+		}
+		if err := r.RetryPolicy.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := r.validateAccess(); err != nil {
+		return err
+	}
+	if r.FaultInjection != nil {
+		if err := r.FaultInjection.Validate(); err != nil {
+			return err
+		}
+	}
+	if r.Maintenance != nil {
+		return r.Maintenance.Validate()
+	}
+	return nil
+}
+
+// validRouteHost accepts a hostname, optionally with a leading "*." wildcard
+func validRouteHost(host string) bool {
+	name := strings.TrimPrefix(host, "*.")
+	return name != "" && len(name) <= 253 && HostnameRegex.MatchString(name)
+}
+
+// validateRoutes checks pools and routes and that every route targets an existing pool
+func (lb *LoadBalancer) validateRoutes() error {
+	if len(lb.Routes) > 0 && lb.Protocol == ProtocolTCP {
+		return ErrRoutesRequireHTTP
+	}
+
+	pools := make(map[string]bool, len(lb.Pools))
+	for i := range lb.Pools {
+		if err := lb.Pools[i].Validate(); err != nil {
+			return err
+		}
+		if pools[lb.Pools[i].Name] {
+			return ErrInvalidPool
+		}
+		pools[lb.Pools[i].Name] = true
+	}
+
+	names := make(map[string]bool, len(lb.Routes))
+	for i := range lb.Routes {
+		route := &lb.Routes[i]
+		if err := route.Validate(); err != nil {
+			return err
+		}
+		if names[route.Name] {
+			return ErrInvalidRoute
+		}
+		names[route.Name] = true
+		if err := lb.validateRouteTimeouts(route); err != nil {
+			return err
+		}
+
+		for _, pool := range route.Pools() {
+			if pool == "" {
+				if !lb.HasDefaultPool() {
+					return ErrUnknownPool
+				}
+			} else if !pools[pool] {
+				return ErrUnknownPool
+			}
+		}
+	}
+	return nil
+}
+
+// validateRouteTimeouts checks that a route's timeouts stay within the load
+// balancer's: Envoy's connection manager ends requests at its request timeout
+// whatever the route allows
+func (lb *LoadBalancer) validateRouteTimeouts(route *Route) error {
+	var limit, idleLimit int
+	if lb.Timeouts != nil {
+		limit, idleLimit = lb.Timeouts.Request, lb.Timeouts.Idle
+	}
+	request := limit
+	if t := route.Timeouts; t != nil {
+		if limit > 0 && t.Request > limit || idleLimit > 0 && t.Idle > idleLimit {
+			return ErrRouteTimeoutExceedsListener
+		}
+		if t.Request > 0 {
+			request = t.Request
+		}
+	}
+	if route.RetryPolicy != nil && request > 0 && route.RetryPolicy.PerTryTimeout > request {
+		return ErrRouteTimeoutExceedsListener
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package models
+
+import "testing"
+
+func TestLoadBalancer_ValidateRoutes(t *testing.T) {
+	backend := Backend{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}
+	pool := func(name string) BackendPool { return BackendPool{Name: name, Backends: []Backend{backend}} }
+
+	tests := []struct {
+		name     string
+		wantErr  error
+		protocol Protocol
+		backends []Backend
+		pools    []BackendPool
+		routes   []Route
+	}{
+		{
+			name:     "routes to pools and default backends",
+			protocol: ProtocolHTTP,
+			backends: []Backend{backend},
+			pools:    []BackendPool{pool("api"), pool("static")},
+			routes: []Route{
+				{Name: "api", Hosts: []string{"api.example.com"}, Path: "/v1", Pool: "api"},
+				{Name: "assets", Hosts: []string{"*.example.com"}, Path: "/assets/logo.png", PathMatch: PathMatchExact, Pool: "static"},
+				{Name: "fallback", Path: "/"},
+			},
+			wantErr: nil,
+		},
+		{
+			name:     "pools only",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{pool("api")},
+			routes:   []Route{{Name: "api", Path: "/", Pool: "api"}},
+			wantErr:  nil,
+		},
+		{
+			name:     "no backends and no pools",
+			protocol: ProtocolHTTP,
+			wantErr:  ErrNoBackends,
+		},
+		{
+			name:     "route to default backends without any",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{pool("api")},
+			routes:   []Route{{Name: "root", Path: "/"}},
+			wantErr:  ErrUnknownPool,
+		},
+		{
+			name:     "unknown pool",
+			protocol: ProtocolHTTP,
+			backends: []Backend{backend},
+			routes:   []Route{{Name: "api", Path: "/", Pool: "missing"}},
+			wantErr:  ErrUnknownPool,
+		},
+		{
+			name:     "duplicate pool",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{pool("api"), pool("api")},
+			wantErr:  ErrInvalidPool,
+		},
+		{
+			name:     "pool selecting backends by label",
+			protocol: ProtocolHTTP,
+			backends: []Backend{backend},
+			pools:    []BackendPool{{Name: "v2", Selector: "version=v2"}},
+			routes:   []Route{{Name: "v2", Path: "/", Pool: "v2"}},
+			wantErr:  nil,
+		},
+		{
+			name:     "invalid pool selector",
+			protocol: ProtocolHTTP,
+			backends: []Backend{backend},
+			pools:    []BackendPool{{Name: "v2", Selector: "version in v2"}},
+			wantErr:  ErrInvalidSelector,
+		},
+		{
+			name:     "empty pool",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{{Name: "api"}},
+			wantErr:  ErrNoBackends,
+		},
+		{
+			name:     "pool connect timeout and retry budget",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{{Name: "api", Backends: []Backend{backend}, ConnectTimeout: 20, RetryBudget: &RetryBudget{BudgetPercent: 50}}},
+			wantErr:  nil,
+		},
+		{
+			name:     "negative pool connect timeout",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{{Name: "api", Backends: []Backend{backend}, ConnectTimeout: -1}},
+			wantErr:  ErrInvalidTimeout,
+		},
+		{
+			name:     "pool retry budget above 100%",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{{Name: "api", Backends: []Backend{backend}, RetryBudget: &RetryBudget{BudgetPercent: 150}}},
+			wantErr:  ErrInvalidRetryBudget,
+		},
+		{
+			name:     "duplicate route",
+			protocol: ProtocolHTTP,
+			backends: []Backend{backend},
+			routes:   []Route{{Name: "r", Path: "/a"}, {Name: "r", Path: "/b"}},
+			wantErr:  ErrInvalidRoute,
+		},
+		{
+			name:     "path must be absolute",
+			protocol: ProtocolHTTP,
+			backends: []Backend{backend},
+			routes:   []Route{{Name: "r", Path: "api"}},
+			wantErr:  ErrInvalidRoutePath,
+		},
+		{
+			name:     "path injection",
+			protocol: ProtocolHTTP,
+			backends: []Backend{backend},
+			routes:   []Route{{Name: "r", Path: "/\"\n  cluster: evil"}},
+			wantErr:  ErrInvalidRoutePath,
+		},
+		{
+			name:     "unknown path match",
+			protocol: ProtocolHTTP,
+			backends: []Backend{backend},
+			routes:   []Route{{Name: "r", Path: "/", PathMatch: "regex"}},
+			wantErr:  ErrInvalidRoutePath,
+		},
+		{
+			name:     "invalid host",
+			protocol: ProtocolHTTP,
+			backends: []Backend{backend},
+			routes:   []Route{{Name: "r", Path: "/", Hosts: []string{"exa mple.com"}}},
+			wantErr:  ErrInvalidRouteHost,
+		},
+		{
+			name:     "route stats",
+			protocol: ProtocolHTTP,
+			backends: []Backend{backend},
+			routes:   []Route{{Name: "r", Path: "/", StatPrefix: "checkout_v2"}},
+		},
+		{
+			name:     "stat prefix with a dot",
+			protocol: ProtocolHTTP,
+			backends: []Backend{backend},
+			routes:   []Route{{Name: "r", Path: "/", StatPrefix: "checkout.v2"}},
+			wantErr:  ErrInvalidStatsPrefix,
+		},
+		{
+			name:     "canary split",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{pool("stable"), pool("canary")},
+			routes: []Route{{Name: "r", Path: "/", Split: &TrafficSplit{Targets: []SplitTarget{
+				{Pool: "stable", Weight: 90}, {Pool: "canary", Weight: 10},
+			}}}},
+			wantErr: nil,
+		},
+		{
+			name:     "split with default backends",
+			protocol: ProtocolHTTP,
+			backends: []Backend{backend},
+			pools:    []BackendPool{pool("green")},
+			routes: []Route{{Name: "r", Path: "/", Split: &TrafficSplit{Targets: []SplitTarget{
+				{Weight: 0}, {Pool: "green", Weight: 100},
+			}}}},
+			wantErr: nil,
+		},
+		{
+			name:     "split weights must sum to 100",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{pool("stable"), pool("canary")},
+			routes: []Route{{Name: "r", Path: "/", Split: &TrafficSplit{Targets: []SplitTarget{
+				{Pool: "stable", Weight: 90}, {Pool: "canary", Weight: 20},
+			}}}},
+			wantErr: ErrInvalidSplit,
+		},
+		{
+			name:     "split needs two pools",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{pool("stable")},
+			routes:   []Route{{Name: "r", Path: "/", Split: &TrafficSplit{Targets: []SplitTarget{{Pool: "stable", Weight: 100}}}}},
+			wantErr:  ErrInvalidSplit,
+		},
+		{
+			name:     "split pools must be distinct",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{pool("stable")},
+			routes: []Route{{Name: "r", Path: "/", Split: &TrafficSplit{Targets: []SplitTarget{
+				{Pool: "stable", Weight: 50}, {Pool: "stable", Weight: 50},
+			}}}},
+			wantErr: ErrInvalidSplit,
+		},
+		{
+			name:     "split and pool are exclusive",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{pool("stable"), pool("canary")},
+			routes: []Route{{Name: "r", Path: "/", Pool: "stable", Split: &TrafficSplit{Targets: []SplitTarget{
+				{Pool: "stable", Weight: 50}, {Pool: "canary", Weight: 50},
+			}}}},
+			wantErr: ErrInvalidSplit,
+		},
+		{
+			name:     "split to unknown pool",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{pool("stable")},
+			routes: []Route{{Name: "r", Path: "/", Split: &TrafficSplit{Targets: []SplitTarget{
+				{Pool: "stable", Weight: 50}, {Pool: "missing", Weight: 50},
+			}}}},
+			wantErr: ErrUnknownPool,
+		},
+		{
+			name:     "canary rollout",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{pool("stable"), pool("canary")},
+			routes: []Route{{Name: "r", Path: "/", Split: &TrafficSplit{
+				Targets: []SplitTarget{{Pool: "stable", Weight: 100}, {Pool: "canary", Weight: 0}},
+				Rollout: &Rollout{Canary: "canary", StepWeight: 10, MaxErrorRate: 1},
+			}}},
+			wantErr: nil,
+		},
+		{
+			name:     "rollout canary must be a target",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{pool("stable"), pool("canary")},
+			routes: []Route{{Name: "r", Path: "/", Split: &TrafficSplit{
+				Targets: []SplitTarget{{Pool: "stable", Weight: 100}, {Pool: "canary", Weight: 0}},
+				Rollout: &Rollout{Canary: "other", StepWeight: 10, MaxErrorRate: 1},
+			}}},
+			wantErr: ErrInvalidRollout,
+		},
+		{
+			name:     "rollout needs exactly two targets",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{pool("stable"), pool("canary"), pool("extra")},
+			routes: []Route{{Name: "r", Path: "/", Split: &TrafficSplit{
+				Targets: []SplitTarget{{Pool: "stable", Weight: 90}, {Pool: "canary", Weight: 5}, {Pool: "extra", Weight: 5}},
+				Rollout: &Rollout{Canary: "canary", StepWeight: 10, MaxErrorRate: 1},
+			}}},
+			wantErr: ErrInvalidRollout,
+		},
+		{
+			name:     "rollout needs an error threshold",
+			protocol: ProtocolHTTP,
+			pools:    []BackendPool{pool("stable"), pool("canary")},
+			routes: []Route{{Name: "r", Path: "/", Split: &TrafficSplit{
+				Targets: []SplitTarget{{Pool: "stable", Weight: 100}, {Pool: "canary", Weight: 0}},
+				Rollout: &Rollout{Canary: "canary", StepWeight: 10},
+			}}},
+			wantErr: ErrInvalidRollout,
+		},
+		{
+			name:     "routes on tcp",
+			protocol: ProtocolTCP,
+			backends: []Backend{backend},
+			routes:   []Route{{Name: "r", Path: "/"}},
+			wantErr:  ErrRoutesRequireHTTP,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := &LoadBalancer{
+				ID: "lb-1", Name: "web", Protocol: tt.protocol, Algorithm: AlgoRoundRobin, Port: 80,
+				Backends: tt.backends, Pools: tt.pools, Routes: tt.routes,
+			}
+			if err := lb.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_ValidateRouteOverrides(t *testing.T) {
+	lbTimeouts := &Timeouts{Connect: 5, Idle: 60, Request: 30}
+
+	tests := []struct {
+		name     string
+		timeouts *Timeouts
+		route    Route
+		wantErr  error
+	}{
+		{
+			name:     "shorter timeouts and own retries",
+			timeouts: lbTimeouts,
+			route: Route{Name: "upload", Path: "/upload", Timeouts: &RouteTimeouts{Request: 20, Idle: 10},
+				RetryPolicy: &RetryPolicy{RetryOn: []string{"connect-failure"}, NumRetries: 1, PerTryTimeout: 10}},
+		},
+		{
+			name:     "retries disabled",
+			timeouts: lbTimeouts,
+			route:    Route{Name: "checkout", Path: "/checkout", RetryPolicy: &RetryPolicy{NumRetries: 0}},
+		},
+		{
+			name:  "any timeout without load balancer limits",
+			route: Route{Name: "report", Path: "/report", Timeouts: &RouteTimeouts{Request: 600, Idle: 300}},
+		},
+		{
+			name:     "request timeout above the load balancer",
+			timeouts: lbTimeouts,
+			route:    Route{Name: "report", Path: "/report", Timeouts: &RouteTimeouts{Request: 60}},
+			wantErr:  ErrRouteTimeoutExceedsListener,
+		},
+		{
+			name:     "idle timeout above the load balancer",
+			timeouts: lbTimeouts,
+			route:    Route{Name: "stream", Path: "/stream", Timeouts: &RouteTimeouts{Idle: 120}},
+			wantErr:  ErrRouteTimeoutExceedsListener,
+		},
+		{
+			name:     "per-try timeout above the route timeout",
+			timeouts: lbTimeouts,
+			route: Route{Name: "api", Path: "/api", Timeouts: &RouteTimeouts{Request: 5},
+				RetryPolicy: &RetryPolicy{NumRetries: 2, PerTryTimeout: 10}},
+			wantErr: ErrRouteTimeoutExceedsListener,
+		},
+		{
+			name:    "negative timeout",
+			route:   Route{Name: "api", Path: "/api", Timeouts: &RouteTimeouts{Request: -1}},
+			wantErr: ErrInvalidTimeout,
+		},
+		{
+			name:    "retry budget",
+			route:   Route{Name: "api", Path: "/api", RetryPolicy: &RetryPolicy{NumRetries: 2, BudgetPercent: 20}},
+			wantErr: ErrRouteRetryBudget,
+		},
+		{
+			name:    "too many retries",
+			route:   Route{Name: "api", Path: "/api", RetryPolicy: &RetryPolicy{NumRetries: 11}},
+			wantErr: ErrInvalidRetryCount,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := &LoadBalancer{
+				ID: "lb-1", Name: "web", Protocol: ProtocolHTTP, Algorithm: AlgoRoundRobin, Port: 80,
+				Backends: []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 8080, Enabled: true}},
+				Timeouts: tt.timeouts, Routes: []Route{tt.route},
+			}
+			if err := lb.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
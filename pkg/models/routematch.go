@@ -0,0 +1,94 @@
+package models
+
+import "regexp"
+
+// Route match limits
+const (
+	MaxRouteMatchConditions = 16
+	MaxMatchValueLength     = 1024
+)
+
+var (
+	// matchNameRegex restricts header, cookie and query parameter names
+	matchNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127}$`)
+	// matchValueRegex restricts match values to printable ASCII
+	matchValueRegex = regexp.MustCompile(`^[\x20-\x7e]+$`)
+)
+
+// MatchType selects how a request header, cookie or query parameter is
+// compared
+type MatchType string
+
+const (
+	// MatchExact requires the value to equal Value (default)
+	MatchExact MatchType = "exact"
+	// MatchRegex requires the whole value to match the RE2 expression Value
+	MatchRegex MatchType = "regex"
+	// MatchPresent requires the header, cookie or parameter with any value
+	MatchPresent MatchType = "present"
+)
+
+// MatchCondition is a condition on a request header, cookie or query
+// parameter that a route additionally requires, e.g. to steer an A/B test
+// group or internal users to a preview pool
+type MatchCondition struct {
+	Name  string    `json:"name" yaml:"name"`
+	Match MatchType `json:"match,omitempty" yaml:"match,omitempty"` // exact (default), regex or present
+	Value string    `json:"value,omitempty" yaml:"value,omitempty"` // the value or expression; empty for present
+}
+
+// Type returns the match type, applying the default
+func (c *MatchCondition) Type() MatchType {
+	if c.Match == "" {
+		return MatchExact
+	}
+	return c.Match
+}
+
+// Validate validates the condition
+func (c *MatchCondition) Validate() error {
+	if !matchNameRegex.MatchString(c.Name) {
+		return ErrInvalidRouteMatch
+	}
+	switch c.Type() {
+	case MatchPresent:
+		if c.Value != "" {
+			return ErrInvalidRouteMatch
+		}
+		return nil
+	case MatchExact, MatchRegex:
+	default:
+		return ErrInvalidRouteMatch
+	}
+	if len(c.Value) > MaxMatchValueLength || !matchValueRegex.MatchString(c.Value) {
+		return ErrInvalidRouteMatch
+	}
+	// Go's regexp accepts the RE2 syntax Envoy evaluates
+	if c.Type() == MatchRegex {
+		if _, err := regexp.Compile(c.Value); err != nil {
+			return ErrInvalidRouteMatch
+		}
+	}
+	return nil
+}
+
+// HasConditions reports whether the route matches on more than host and path
+func (r *Route) HasConditions() bool {
+	return len(r.Headers)+len(r.Cookies)+len(r.QueryParams) > 0
+}
+
+// validateConditions validates the route's header, cookie and query
+// parameter conditions
+func (r *Route) validateConditions() error {
+	if len(r.Headers)+len(r.Cookies)+len(r.QueryParams) > MaxRouteMatchConditions {
+		return ErrInvalidRouteMatch
+	}
+	for _, conditions := range [][]MatchCondition{r.Headers, r.Cookies, r.QueryParams} {
+		for i := range conditions {
+			if err := conditions[i].Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRoute_Validate_Conditions(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   Route
+		wantErr error
+	}{
+		{
+			name: "header, cookie and query parameter",
+			route: Route{Name: "beta", Path: "/",
+				Headers:     []MatchCondition{{Name: "x-beta", Value: "1"}},
+				Cookies:     []MatchCondition{{Name: "ab_group", Match: MatchRegex, Value: "b|c"}},
+				QueryParams: []MatchCondition{{Name: "preview", Match: MatchPresent}}},
+		},
+		{
+			name:    "exact without a value",
+			route:   Route{Name: "beta", Path: "/", Headers: []MatchCondition{{Name: "x-beta"}}},
+			wantErr: ErrInvalidRouteMatch,
+		},
+		{
+			name:    "present with a value",
+			route:   Route{Name: "beta", Path: "/", Cookies: []MatchCondition{{Name: "beta", Match: MatchPresent, Value: "1"}}},
+			wantErr: ErrInvalidRouteMatch,
+		},
+		{
+			name:    "invalid regex",
+			route:   Route{Name: "beta", Path: "/", QueryParams: []MatchCondition{{Name: "v", Match: MatchRegex, Value: "(a"}}},
+			wantErr: ErrInvalidRouteMatch,
+		},
+		{
+			name:    "pseudo-header",
+			route:   Route{Name: "beta", Path: "/", Headers: []MatchCondition{{Name: ":authority", Value: "example.com"}}},
+			wantErr: ErrInvalidRouteMatch,
+		},
+		{
+			name:    "unknown match type",
+			route:   Route{Name: "beta", Path: "/", Headers: []MatchCondition{{Name: "x-beta", Match: "prefix", Value: "1"}}},
+			wantErr: ErrInvalidRouteMatch,
+		},
+		{
+			name:    "value with a newline",
+			route:   Route{Name: "beta", Path: "/", Headers: []MatchCondition{{Name: "x-beta", Value: "1\nx"}}},
+			wantErr: ErrInvalidRouteMatch,
+		},
+		{
+			name:    "value too long",
+			route:   Route{Name: "beta", Path: "/", Headers: []MatchCondition{{Name: "x-beta", Value: strings.Repeat("a", MaxMatchValueLength+1)}}},
+			wantErr: ErrInvalidRouteMatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.route.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaID identifies the load balancer JSON Schema
+const SchemaID = "https://schemas.vpsie.com/loadbalancer.json"
+
+// schemaRequired lists the fields that must be present in each object. Fields
+// not listed are optional and fall back to their zero value or a default.
+var schemaRequired = map[reflect.Type][]string{
+	reflect.TypeOf(LoadBalancer{}):     {"id", "name", "protocol", "algorithm"},
+	reflect.TypeOf(Backend{}):          {"id", "address", "port"},
+	reflect.TypeOf(BackendPool{}):      {"name"},
+	reflect.TypeOf(Route{}):            {"name", "path"},
+	reflect.TypeOf(TrafficSplit{}):     {"targets"},
+	reflect.TypeOf(SplitTarget{}):      {"weight"},
+	reflect.TypeOf(Rollout{}):          {"canary", "step_weight", "max_error_rate"},
+	reflect.TypeOf(HealthCheck{}):      {"type", "interval", "timeout", "unhealthy_threshold", "healthy_threshold"},
+	reflect.TypeOf(TLSConfig{}):        {"certificate_path", "private_key_path", "min_version"},
+	reflect.TypeOf(AdmissionControl{}): {"type"},
+	reflect.TypeOf(Maintenance{}):      {"enabled"},
+	reflect.TypeOf(Discovery{}):        {"type"},
+	reflect.TypeOf(Tracing{}):          {"provider", "collector"},
+	reflect.TypeOf(WAF{}):              {"mode"},
+	reflect.TypeOf(Authorization{}):    {"protocol", "service"},
+	reflect.TypeOf(JWTAuth{}):          {"providers"},
+	reflect.TypeOf(JWTProvider{}):      {"name", "issuer", "jwks_uri"},
+	reflect.TypeOf(CustomFilter{}):     {"name", "type", "enabled"},
+	reflect.TypeOf(TLSPassthrough{}):   {"routes"},
+	reflect.TypeOf(SNIRoute{}):         {"server_names"},
+	reflect.TypeOf(PortRange{}):        {"from"},
+	reflect.TypeOf(MatchCondition{}):   {"name"},
+}
+
+// schemaEnums lists the accepted values of the enumerated string types
+var schemaEnums = map[reflect.Type][]string{
+	reflect.TypeOf(Protocol("")):                 {string(ProtocolHTTP), string(ProtocolHTTPS), string(ProtocolTCP)},
+	reflect.TypeOf(LoadBalancingAlgo("")):        {string(AlgoRoundRobin), string(AlgoLeastRequest), string(AlgoRandom), string(AlgoRingHash)},
+	reflect.TypeOf(HealthCheckType("")):          {string(HealthCheckTCP), string(HealthCheckHTTP), string(HealthCheckHTTPS)},
+	reflect.TypeOf(PathMatch("")):                {string(PathMatchPrefix), string(PathMatchExact)},
+	reflect.TypeOf(MatchType("")):                {string(MatchExact), string(MatchRegex), string(MatchPresent)},
+	reflect.TypeOf(AdmissionControlType("")):     {string(AdmissionAdaptiveConcurrency), string(AdmissionStatic)},
+	reflect.TypeOf(XFFMode("")):                  {string(XFFAppend), string(XFFOverwrite), string(XFFPreserve)},
+	reflect.TypeOf(DiscoveryType("")):            {string(DiscoveryVPSieTag), string(DiscoveryConsul)},
+	reflect.TypeOf(TracingProvider("")):          {string(TracingOpenTelemetry), string(TracingZipkin)},
+	reflect.TypeOf(WAFMode("")):                  {string(WAFBlock), string(WAFDetect)},
+	reflect.TypeOf(WAFRuleSet("")):               {string(WAFRuleSetCRS), string(WAFRuleSetCustom)},
+	reflect.TypeOf(AuthorizationProtocol("")):    {string(AuthorizationGRPC), string(AuthorizationHTTP)},
+	reflect.TypeOf(CustomFilterType("")):         {string(CustomFilterLua), string(CustomFilterWASM)},
+	reflect.TypeOf(ListenerDrainType("")):        {string(DrainDefault), string(DrainModifyOnly)},
+	reflect.TypeOf(TCPProtocolHint("")):          {string(TCPProtocolMySQL), string(TCPProtocolPostgres), string(TCPProtocolRedis)},
+	reflect.TypeOf(TCPHelper("")):                {string(TCPHelperFTP), string(TCPHelperSMTP), string(TCPHelperIMAP)},
+	reflect.TypeOf(AuthorizationFailureMode("")): {string(AuthorizationFailClosed), string(AuthorizationFailOpen)},
+}
+
+// schemaFieldRules adds constraints to individual fields, keyed by
+// "<Go type>.<json name>". They mirror the checks made by Validate.
+var schemaFieldRules = map[string]map[string]interface{}{
+	"LoadBalancer.id":                         {"pattern": safeIdentifierRegex.String(), "maxLength": 64},
+	"LoadBalancer.port":                       {"minimum": 1, "maximum": 65535},
+	"LoadBalancer.max_connections":            {"minimum": 0},
+	"LoadBalancer.stats_prefix":               {"pattern": StatsNameRegex.String()},
+	"LoadBalancer.addresses":                  {"maxItems": MaxListenAddresses, "uniqueItems": true},
+	"Backend.address":                         {"maxLength": 253},
+	"Backend.port":                            {"minimum": 1, "maximum": 65535},
+	"Backend.weight":                          {"minimum": 0},
+	"Backend.priority":                        {"minimum": 0, "maximum": MaxBackendPriority},
+	"Backend.region":                          {"pattern": LocalityRegex.String()},
+	"Backend.zone":                            {"pattern": LocalityRegex.String()},
+	"Backend.labels":                          {"maxProperties": MaxBackendLabels, "propertyNames": map[string]interface{}{"pattern": labelKeyRegex.String()}, "additionalProperties": map[string]interface{}{"type": "string", "pattern": labelValueRegex.String()}},
+	"BackendPool.name":                        {"pattern": safeIdentifierRegex.String(), "maxLength": 64},
+	"BackendPool.selector":                    {"maxLength": MaxSelectorLength},
+	"BackendPool.connect_timeout":             {"minimum": 0},
+	"RetryBudget.budget_percent":              {"minimum": 0, "maximum": 100},
+	"RetryBudget.min_retry_concurrency":       {"minimum": 0},
+	"Route.name":                              {"pattern": safeIdentifierRegex.String(), "maxLength": 64},
+	"Route.stat_prefix":                       {"pattern": StatsNameRegex.String()},
+	"Route.path":                              {"pattern": routePathRegex.String()},
+	"TrafficSplit.targets":                    {"minItems": 2},
+	"Rollout.step_weight":                     {"minimum": 1, "maximum": 100},
+	"Rollout.max_error_rate":                  {"exclusiveMinimum": 0, "maximum": 100},
+	"SplitTarget.weight":                      {"minimum": 0, "maximum": 100},
+	"HealthCheck.interval":                    {"minimum": 1},
+	"HealthCheck.timeout":                     {"minimum": 1},
+	"TLSConfig.min_version":                   {"enum": tlsVersionNames()},
+	"TLSConfig.max_version":                   {"enum": tlsVersionNames()},
+	"TLSConfig.session_timeout":               {"minimum": 0, "maximum": MaxTLSSessionTimeout},
+	"RetryPolicy.num_retries":                 {"minimum": 0, "maximum": 10},
+	"RetryPolicy.retry_on":                    {"items": map[string]interface{}{"type": "string", "enum": sortedKeys(retryOnConditions)}},
+	"Timeouts.connect":                        {"minimum": 0},
+	"Timeouts.idle":                           {"minimum": 0},
+	"Timeouts.request":                        {"minimum": 0},
+	"ConnectionPool.max_connections_per_host": {"minimum": 0},
+	"Prewarm.window":                          {"minimum": 0, "maximum": MaxPrewarmWindow},
+	"Prewarm.aggression":                      {"minimum": 0, "maximum": MaxPrewarmAggression},
+	"Prewarm.preconnect_ratio":                {"minimum": 0, "maximum": MaxPreconnectRatio},
+	"ListenerTuning.tcp_fast_open_queue":      {"minimum": 0, "maximum": MaxFastOpenQueue},
+	"ListenerTuning.backlog":                  {"minimum": 0, "maximum": MaxListenBacklog},
+	"ListenerTuning.buffer_limit":             {"minimum": 0, "maximum": MaxBufferLimit},
+	"ListenerTuning.idle_timeout":             {"minimum": 0, "maximum": MaxConnectionAge},
+	"ListenerTuning.max_connection_duration":  {"minimum": 0, "maximum": MaxConnectionAge},
+	"TCPKeepalive.time":                       {"minimum": 0, "maximum": MaxKeepaliveTime},
+	"TCPKeepalive.interval":                   {"minimum": 0, "maximum": MaxKeepaliveTime},
+	"TCPKeepalive.probes":                     {"minimum": 0, "maximum": MaxKeepaliveProbes},
+	"PortRange.from":                          {"minimum": 1, "maximum": 65535},
+	"PortRange.to":                            {"minimum": 0, "maximum": 65535},
+	"DDoSProtection.connection_rate":          {"minimum": 0, "maximum": MaxConnectionRate},
+	"DDoSProtection.connection_burst":         {"minimum": 0, "maximum": MaxConnectionRate},
+	"DDoSProtection.max_connections_per_ip":   {"minimum": 0, "maximum": MaxConnectionsPerIP},
+	"DDoSProtection.attack_threshold":         {"minimum": 0, "maximum": MaxConnectionRate},
+	"DDoSProtection.source_rate_limit":        {"minimum": 0, "maximum": MaxConnectionRate},
+	"DDoSProtection.attack_cooldown":          {"minimum": 0, "maximum": MaxAttackCooldown},
+	"BandwidthLimit.ingress_bytes_per_second": {"minimum": 0, "maximum": MaxBandwidthLimit},
+	"BandwidthLimit.egress_bytes_per_second":  {"minimum": 0, "maximum": MaxBandwidthLimit},
+	"Maintenance.status_code":                 {"minimum": 200, "maximum": 599},
+	"FaultInjection.delay_percent":            {"minimum": 0, "maximum": 100},
+	"FaultInjection.delay_ms":                 {"minimum": 0, "maximum": MaxFaultDelayMs},
+	"FaultInjection.abort_percent":            {"minimum": 0, "maximum": 100},
+	"FaultInjection.abort_status":             {"minimum": 200, "maximum": 599},
+	"Maintenance.body":                        {"maxLength": MaxMaintenanceBodySize},
+	"Maintenance.retry_after":                 {"minimum": 0},
+	"ClientIP.xff_num_trusted_hops":           {"minimum": 0, "maximum": maxTrustedHops},
+	"DNSDiscovery.refresh_rate":               {"minimum": 0, "maximum": MaxDNSRefreshRate},
+	"Discovery.tag":                           {"pattern": discoveryNameRegex.String()},
+	"Discovery.service":                       {"pattern": discoveryNameRegex.String()},
+	"Discovery.datacenter":                    {"pattern": discoveryNameRegex.String()},
+	"Discovery.port":                          {"minimum": 0, "maximum": 65535},
+	"Discovery.weight":                        {"minimum": 0},
+	"Tracing.path":                            {"pattern": routePathRegex.String()},
+	"Tracing.sampling_rate":                   {"minimum": 0, "maximum": 100},
+	"Tracing.service_name":                    {"pattern": tracingServiceRegex.String()},
+	"WAF.paranoia_level":                      {"minimum": 0, "maximum": MaxParanoiaLevel},
+	"WAF.excluded_rules":                      {"maxItems": MaxWAFExclusions, "uniqueItems": true},
+	"JWTAuth.providers":                       {"minItems": 1, "maxItems": MaxJWTProviders},
+	"JWTProvider.name":                        {"pattern": safeIdentifierRegex.String(), "maxLength": 64},
+	"JWTProvider.issuer":                      {"pattern": jwtValueRegex.String()},
+	"JWTProvider.audiences":                   {"maxItems": MaxJWTAudiences, "items": map[string]interface{}{"type": "string", "pattern": jwtValueRegex.String()}},
+	"JWTProvider.cache_duration":              {"minimum": 0, "maximum": MaxJWKSCacheDuration},
+	"RouteJWT.required_claims":                {"maxProperties": MaxJWTRequiredClaims, "propertyNames": map[string]interface{}{"pattern": jwtClaimRegex.String()}},
+	"BasicAuth.users":                         {"maxItems": MaxBasicAuthUsers, "items": map[string]interface{}{"type": "string", "pattern": htpasswdRegex.String()}},
+	"Route.allowed_cidrs":                     {"maxItems": MaxAllowedCIDRs},
+	"RouteTimeouts.request":                   {"minimum": 0},
+	"MatchCondition.name":                     {"pattern": matchNameRegex.String()},
+	"MatchCondition.value":                    {"maxLength": MaxMatchValueLength},
+	"RouteTimeouts.idle":                      {"minimum": 0},
+	"TLSPassthrough.routes":                   {"minItems": 1, "maxItems": MaxSNIRoutes},
+	"SNIRoute.server_names":                   {"minItems": 1},
+	"LoadBalancer.custom_filters":             {"maxItems": MaxCustomFilters},
+	"CustomFilter.name":                       {"pattern": safeIdentifierRegex.String(), "maxLength": 64},
+	"CustomFilter.source":                     {"maxLength": MaxLuaSourceBytes},
+	"CustomFilter.sha256":                     {"pattern": sha256Regex.String()},
+	"CustomFilter.config":                     {"maxLength": MaxWASMConfigBytes},
+	"Authorization.path_prefix":               {"pattern": routePathRegex.String()},
+	"Authorization.timeout_ms":                {"minimum": 0, "maximum": MaxAuthorizationTimeoutMs},
+	"Authorization.request_headers":           {"maxItems": MaxAuthorizationHeaders, "items": map[string]interface{}{"type": "string", "pattern": headerNameRegex.String()}},
+	"Authorization.upstream_headers":          {"maxItems": MaxAuthorizationHeaders, "items": map[string]interface{}{"type": "string", "pattern": headerNameRegex.String()}},
+	"Autoscaling.group":                       {"pattern": safeIdentifierRegex.String()},
+	"Autoscaling.max_rps_per_backend":         {"minimum": 0},
+	"Autoscaling.max_connections_per_backend": {"minimum": 0},
+	"Autoscaling.max_saturation":              {"minimum": 0, "maximum": 100},
+	"Autoscaling.scale_in_percent":            {"minimum": 0, "maximum": 99},
+	"Autoscaling.cooldown":                    {"minimum": 0},
+}
+
+// Schema returns a JSON Schema (draft 2020-12) describing the LoadBalancer
+// model, for validating definitions before they are sent to the VPSie API.
+// Cross-field rules (e.g. routes must target a defined pool) are only enforced
+// by ParseLoadBalancer.
+func Schema() map[string]interface{} {
+	defs := make(map[string]interface{})
+	root := schemaFor(reflect.TypeOf(LoadBalancer{}), defs)
+
+	schema := map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     SchemaID,
+		"title":   "VPSie Load Balancer",
+		"$ref":    root["$ref"],
+		"$defs":   defs,
+	}
+	return schema
+}
+
+// schemaFor returns the schema of t, adding struct definitions to defs
+func schemaFor(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if enum, ok := schemaEnums[t]; ok {
+		return map[string]interface{}{"type": "string", "enum": enum}
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), defs)}
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+		if _, ok := defs[t.Name()]; ok {
+			return ref
+		}
+		defs[t.Name()] = structSchema(t, defs)
+		return ref
+	default:
+		panic(fmt.Sprintf("schema: unsupported kind %s for %s", t.Kind(), t))
+	}
+}
+
+// structSchema returns the object schema of a struct type
+func structSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		prop := schemaFor(field.Type, defs)
+		for k, v := range schemaFieldRules[t.Name()+"."+name] {
+			prop[k] = v
+		}
+		properties[name] = prop
+	}
+
+	obj := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if required, ok := schemaRequired[t]; ok {
+		obj["required"] = required
+	}
+	return obj
+}
+
+// ParseLoadBalancer strictly decodes a JSON load balancer definition and
+// validates it. Unknown fields, trailing data and failed validation are
+// reported as errors.
+func ParseLoadBalancer(data []byte) (*LoadBalancer, error) {
+	var lb LoadBalancer
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&lb); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("invalid JSON: unexpected data after the load balancer object")
+	}
+	if err := lb.Validate(); err != nil {
+		return nil, err
+	}
+	return &lb, nil
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	schema := Schema()
+
+	// The schema must serialize cleanly for the CLI and admin endpoint
+	if _, err := json.Marshal(schema); err != nil {
+		t.Fatalf("json.Marshal(Schema()) error = %v", err)
+	}
+	if schema["$ref"] != "#/$defs/LoadBalancer" {
+		t.Errorf("$ref = %v, want #/$defs/LoadBalancer", schema["$ref"])
+	}
+
+	defs := schema["$defs"].(map[string]interface{})
+	for _, name := range []string{"LoadBalancer", "Backend", "BackendPool", "Route", "HealthCheck", "TLSConfig",
+		"Timeouts", "RetryPolicy", "ConnectionPool", "AdmissionControl"} {
+		def, ok := defs[name].(map[string]interface{})
+		if !ok {
+			t.Errorf("$defs is missing %s", name)
+			continue
+		}
+		if def["additionalProperties"] != false {
+			t.Errorf("%s allows additional properties", name)
+		}
+	}
+
+	lb := defs["LoadBalancer"].(map[string]interface{})
+	props := lb["properties"].(map[string]interface{})
+	if got, want := len(props), reflect.TypeOf(LoadBalancer{}).NumField(); got != want {
+		t.Errorf("LoadBalancer has %d properties, want one per field (%d)", got, want)
+	}
+	if got := lb["required"]; !reflect.DeepEqual(got, []string{"id", "name", "protocol", "algorithm"}) {
+		t.Errorf("LoadBalancer required = %v", got)
+	}
+
+	protocol := props["protocol"].(map[string]interface{})
+	if !reflect.DeepEqual(protocol["enum"], []string{"http", "https", "tcp"}) {
+		t.Errorf("protocol enum = %v", protocol["enum"])
+	}
+	port := props["port"].(map[string]interface{})
+	if port["minimum"] != 1 || port["maximum"] != 65535 {
+		t.Errorf("port bounds = %v..%v, want 1..65535", port["minimum"], port["maximum"])
+	}
+	if ref := props["backends"].(map[string]interface{})["items"].(map[string]interface{})["$ref"]; ref != "#/$defs/Backend" {
+		t.Errorf("backends items $ref = %v, want #/$defs/Backend", ref)
+	}
+}
+
+func TestParseLoadBalancer(t *testing.T) {
+	valid := `{"id": "lb-1", "name": "web", "protocol": "http", "algorithm": "round_robin", "port": 80,
+		"backends": [{"id": "be-1", "address": "10.0.0.1", "port": 8080, "enabled": true}]}`
+
+	tests := []struct {
+		wantErr     error
+		name        string
+		input       string
+		errContains string
+	}{
+		{name: "valid", input: valid},
+		{
+			name:        "unknown field",
+			input:       strings.Replace(valid, `"port": 80`, `"port": 80, "listen_port": 80`, 1),
+			errContains: "unknown field",
+		},
+		{
+			name:        "trailing data",
+			input:       valid + ` {}`,
+			errContains: "unexpected data",
+		},
+		{
+			name:        "wrong type",
+			input:       strings.Replace(valid, `"port": 80`, `"port": "80"`, 1),
+			errContains: "invalid JSON",
+		},
+		{
+			name:    "fails validation",
+			input:   strings.Replace(valid, `"port": 80`, `"port": 70000`, 1),
+			wantErr: ErrInvalidPort,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb, err := ParseLoadBalancer([]byte(tt.input))
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ParseLoadBalancer() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.errContains != "":
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("ParseLoadBalancer() error = %v, want error containing %q", err, tt.errContains)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("ParseLoadBalancer() error = %v", err)
+				}
+				if lb.ID != "lb-1" || len(lb.Backends) != 1 {
+					t.Errorf("ParseLoadBalancer() = %+v", lb)
+				}
+			}
+		})
+	}
+}
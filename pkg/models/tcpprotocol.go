@@ -0,0 +1,45 @@
+package models
+
+// TCPProtocolHint names the application protocol spoken over a TCP load
+// balancer, so Envoy can decode it for per-command statistics and check the
+// backends in that protocol
+type TCPProtocolHint string
+
+const (
+	// TCPProtocolMySQL decodes MySQL traffic; health checks expect the server greeting
+	TCPProtocolMySQL TCPProtocolHint = "mysql"
+	// TCPProtocolPostgres decodes PostgreSQL traffic
+	TCPProtocolPostgres TCPProtocolHint = "postgres"
+	// TCPProtocolRedis proxies Redis commands; health checks send PING
+	TCPProtocolRedis TCPProtocolHint = "redis"
+)
+
+func (lb *LoadBalancer) validateTCPProtocolHint() error {
+	switch lb.TCPProtocolHint {
+	case "":
+		return nil
+	case TCPProtocolMySQL, TCPProtocolPostgres, TCPProtocolRedis:
+	default:
+		return ErrInvalidTCPProtocolHint
+	}
+	if lb.Protocol != ProtocolTCP {
+		return ErrTCPProtocolHintRequiresTCP
+	}
+	if lb.TCPProtocolHint != TCPProtocolRedis {
+		return nil
+	}
+
+	// Envoy's Redis proxy shards keys across the backends over a pool of
+	// shared upstream connections, so there is no client connection to carry
+	// the client address or a lifetime over to
+	if lb.Algorithm != AlgoRingHash {
+		return ErrRedisHintConflict
+	}
+	if lb.ClientIP != nil && lb.ClientIP.PreserveSource {
+		return ErrRedisHintConflict
+	}
+	if lb.Listener != nil && (lb.Listener.IdleTimeout > 0 || lb.Listener.MaxConnectionDuration > 0) {
+		return ErrRedisHintConflict
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package models
+
+import "testing"
+
+func TestLoadBalancer_Validate_TCPProtocolHint(t *testing.T) {
+	hintLB := func(protocol Protocol, algo LoadBalancingAlgo, hint TCPProtocolHint) *LoadBalancer {
+		return &LoadBalancer{
+			ID: "lb-1", Name: "lb", Protocol: protocol, Algorithm: algo, Port: 6379,
+			Backends:        []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 6379, Enabled: true}},
+			TCPProtocolHint: hint,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		lb      *LoadBalancer
+		wantErr error
+	}{
+		{name: "mysql", lb: hintLB(ProtocolTCP, AlgoLeastRequest, TCPProtocolMySQL)},
+		{name: "postgres", lb: hintLB(ProtocolTCP, AlgoRoundRobin, TCPProtocolPostgres)},
+		{name: "redis", lb: hintLB(ProtocolTCP, AlgoRingHash, TCPProtocolRedis)},
+		{
+			name:    "unknown protocol",
+			lb:      hintLB(ProtocolTCP, AlgoRoundRobin, "mongodb"),
+			wantErr: ErrInvalidTCPProtocolHint,
+		},
+		{
+			name:    "hint on http",
+			lb:      hintLB(ProtocolHTTP, AlgoRoundRobin, TCPProtocolMySQL),
+			wantErr: ErrTCPProtocolHintRequiresTCP,
+		},
+		{
+			name:    "redis without ring hash",
+			lb:      hintLB(ProtocolTCP, AlgoRoundRobin, TCPProtocolRedis),
+			wantErr: ErrRedisHintConflict,
+		},
+		{
+			name: "redis preserving the client address",
+			lb: func() *LoadBalancer {
+				lb := hintLB(ProtocolTCP, AlgoRingHash, TCPProtocolRedis)
+				lb.ClientIP = &ClientIP{PreserveSource: true}
+				return lb
+			}(),
+			wantErr: ErrRedisHintConflict,
+		},
+		{
+			name: "redis with a connection lifetime",
+			lb: func() *LoadBalancer {
+				lb := hintLB(ProtocolTCP, AlgoRingHash, TCPProtocolRedis)
+				lb.Listener = &ListenerTuning{MaxConnectionDuration: 3600}
+				return lb
+			}(),
+			wantErr: ErrRedisHintConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.lb.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
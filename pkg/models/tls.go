@@ -10,6 +10,9 @@ import (
 const (
 	// defaultTLSCertDir is the default directory for TLS certificates
 	defaultTLSCertDir = "/etc/vpsie-lb/certs"
+
+	// MaxTLSSessionTimeout bounds how long a TLS session can be resumed
+	MaxTLSSessionTimeout = 86400
 )
 
 // TLSConfig represents TLS/SSL configuration
@@ -21,6 +24,21 @@ type TLSConfig struct {
 	MaxVersion      string   `json:"max_version,omitempty" yaml:"max_version,omitempty"`
 	CipherSuites    []string `json:"cipher_suites,omitempty" yaml:"cipher_suites,omitempty"`
 	ALPN            []string `json:"alpn,omitempty" yaml:"alpn,omitempty"` // h2, http/1.1
+
+	// Session resumption
+	SessionTimeout        int  `json:"session_timeout,omitempty" yaml:"session_timeout,omitempty"`                 // seconds a session can be resumed, 0 = Envoy default (7200)
+	DisableSessionTickets bool `json:"disable_session_tickets,omitempty" yaml:"disable_session_tickets,omitempty"` // resume sessions only from Envoy's session cache
+}
+
+// tlsVersions are the accepted min_version and max_version values
+var tlsVersions = map[string]bool{
+	"TLSv1.2": true,
+	"TLSv1.3": true,
+}
+
+// tlsVersionNames returns the accepted TLS versions in order
+func tlsVersionNames() []string {
+	return sortedKeys(tlsVersions)
 }
 
 // validateTLSFilePath validates that a TLS file path is within allowed directory
@@ -86,17 +104,17 @@ func (t *TLSConfig) Validate() error {
 	}
 
 	// Validate TLS version
-	validVersions := map[string]bool{
-		"TLSv1.2": true,
-		"TLSv1.3": true,
-	}
-	if !validVersions[t.MinVersion] {
+	if !tlsVersions[t.MinVersion] {
 		return ErrInvalidTLSVersion
 	}
-	if t.MaxVersion != "" && !validVersions[t.MaxVersion] {
+	if t.MaxVersion != "" && !tlsVersions[t.MaxVersion] {
 		return ErrInvalidTLSVersion
 	}
 
+	if t.SessionTimeout < 0 || t.SessionTimeout > MaxTLSSessionTimeout {
+		return ErrInvalidSessionTimeout
+	}
+
 	return nil
 }
 
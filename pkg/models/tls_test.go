@@ -122,6 +122,27 @@ func TestTLSConfig_Validate(t *testing.T) {
 			},
 			wantErr: ErrInvalidTLSVersion,
 		},
+		{
+			name: "valid TLS config with session resumption settings",
+			tls: TLSConfig{
+				CertificatePath:       "/etc/vpsie-lb/certs/cert.pem",
+				PrivateKeyPath:        "/etc/vpsie-lb/certs/key.pem",
+				MinVersion:            "TLSv1.2",
+				SessionTimeout:        3600,
+				DisableSessionTickets: true,
+			},
+			wantErr: nil,
+		},
+		{
+			name: "session timeout too long",
+			tls: TLSConfig{
+				CertificatePath: "/etc/vpsie-lb/certs/cert.pem",
+				PrivateKeyPath:  "/etc/vpsie-lb/certs/key.pem",
+				MinVersion:      "TLSv1.2",
+				SessionTimeout:  MaxTLSSessionTimeout + 1,
+			},
+			wantErr: ErrInvalidSessionTimeout,
+		},
 		{
 			name: "invalid max version - arbitrary string",
 			tls: TLSConfig{
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+)
+
+// TracingProvider selects the tracing protocol spoken to the collector
+type TracingProvider string
+
+const (
+	// TracingOpenTelemetry exports spans over OTLP/gRPC
+	TracingOpenTelemetry TracingProvider = "opentelemetry"
+	// TracingZipkin exports spans to a Zipkin collector over HTTP
+	TracingZipkin TracingProvider = "zipkin"
+)
+
+// DefaultZipkinPath is the Zipkin collector path used when none is set
+const DefaultZipkinPath = "/api/v2/spans"
+
+// tracingServiceRegex restricts service names to characters that are safe to render
+var tracingServiceRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,127}$`)
+
+// Tracing sends spans of sampled requests to a collector. Envoy starts a
+// trace, or joins the one in the request headers, and passes the trace
+// context on to the backends. HTTP and HTTPS load balancers only.
+type Tracing struct {
+	Provider     TracingProvider `json:"provider" yaml:"provider"`                               // opentelemetry or zipkin
+	Collector    string          `json:"collector" yaml:"collector"`                             // host:port of the collector
+	Path         string          `json:"path,omitempty" yaml:"path,omitempty"`                   // Zipkin only, default /api/v2/spans
+	SamplingRate float64         `json:"sampling_rate,omitempty" yaml:"sampling_rate,omitempty"` // percent of requests traced (default 100)
+	ServiceName  string          `json:"service_name,omitempty" yaml:"service_name,omitempty"`   // OpenTelemetry only, default the load balancer ID
+}
+
+// Validate validates the tracing settings
+func (t *Tracing) Validate() error {
+	if t.Provider != TracingOpenTelemetry && t.Provider != TracingZipkin {
+		return ErrInvalidTracingProvider
+	}
+	host, port, err := net.SplitHostPort(t.Collector)
+	if err != nil || (net.ParseIP(host) == nil && !HostnameRegex.MatchString(host)) {
+		return ErrInvalidTracing
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return ErrInvalidTracing
+	}
+	if t.SamplingRate < 0 || t.SamplingRate > 100 {
+		return ErrInvalidTracing
+	}
+	if t.Path != "" && (t.Provider != TracingZipkin || !routePathRegex.MatchString(t.Path)) {
+		return ErrInvalidTracing
+	}
+	// Zipkin spans are named after the Envoy node's cluster
+	if t.ServiceName != "" && (t.Provider != TracingOpenTelemetry || !tracingServiceRegex.MatchString(t.ServiceName)) {
+		return ErrInvalidTracing
+	}
+	return nil
+}
+
+// CollectorAddress returns the collector host and port
+func (t *Tracing) CollectorAddress() (string, int) {
+	host, port, _ := net.SplitHostPort(t.Collector)
+	p, _ := strconv.Atoi(port)
+	return host, p
+}
+
+func (lb *LoadBalancer) validateTracing() error {
+	if lb.Tracing == nil {
+		return nil
+	}
+	if lb.Protocol == ProtocolTCP {
+		return ErrTracingRequiresHTTP
+	}
+	return lb.Tracing.Validate()
+}
@@ -0,0 +1,72 @@
+package models
+
+import "testing"
+
+func TestTracing_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr error
+		tracing Tracing
+	}{
+		{
+			name:    "OpenTelemetry collector",
+			tracing: Tracing{Provider: TracingOpenTelemetry, Collector: "otel-collector.internal:4317", SamplingRate: 0.5, ServiceName: "shop-lb"},
+			wantErr: nil,
+		},
+		{
+			name:    "Zipkin collector with a path",
+			tracing: Tracing{Provider: TracingZipkin, Collector: "[2001:db8::9]:9411", Path: "/api/v2/spans"},
+			wantErr: nil,
+		},
+		{
+			name:    "unknown provider",
+			tracing: Tracing{Provider: "jaeger", Collector: "10.0.0.9:6831"},
+			wantErr: ErrInvalidTracingProvider,
+		},
+		{
+			name:    "collector without a port",
+			tracing: Tracing{Provider: TracingOpenTelemetry, Collector: "10.0.0.9"},
+			wantErr: ErrInvalidTracing,
+		},
+		{
+			name:    "collector port out of range",
+			tracing: Tracing{Provider: TracingOpenTelemetry, Collector: "10.0.0.9:70000"},
+			wantErr: ErrInvalidTracing,
+		},
+		{
+			name:    "sampling rate above 100",
+			tracing: Tracing{Provider: TracingOpenTelemetry, Collector: "10.0.0.9:4317", SamplingRate: 101},
+			wantErr: ErrInvalidTracing,
+		},
+		{
+			name:    "path for OpenTelemetry",
+			tracing: Tracing{Provider: TracingOpenTelemetry, Collector: "10.0.0.9:4317", Path: "/v1/traces"},
+			wantErr: ErrInvalidTracing,
+		},
+		{
+			name:    "service name for Zipkin",
+			tracing: Tracing{Provider: TracingZipkin, Collector: "10.0.0.9:9411", ServiceName: "shop"},
+			wantErr: ErrInvalidTracing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tracing.Validate()
+			if err != tt.wantErr {
+				t.Errorf("Tracing.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_Validate_TracingProtocol(t *testing.T) {
+	lb := &LoadBalancer{
+		ID: "lb-1", Name: "lb", Protocol: ProtocolTCP, Algorithm: AlgoRoundRobin, Port: 5432,
+		Backends: []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 5432, Enabled: true}},
+		Tracing:  &Tracing{Provider: TracingOpenTelemetry, Collector: "10.0.0.9:4317"},
+	}
+	if err := lb.Validate(); err != ErrTracingRequiresHTTP {
+		t.Errorf("Validate() error = %v, wantErr %v", err, ErrTracingRequiresHTTP)
+	}
+}
@@ -0,0 +1,80 @@
+package models
+
+// WAFMode selects whether requests matching the rules are blocked
+type WAFMode string
+
+const (
+	// WAFBlock rejects requests whose anomaly score exceeds the threshold with 403
+	WAFBlock WAFMode = "block"
+	// WAFDetect only logs matching requests
+	WAFDetect WAFMode = "detect"
+)
+
+// WAFRuleSet selects the rules requests are inspected with
+type WAFRuleSet string
+
+const (
+	// WAFRuleSetCRS is the OWASP Core Rule Set bundled with the WAF sidecar
+	WAFRuleSetCRS WAFRuleSet = "owasp_crs"
+	// WAFRuleSetCustom loads a ModSecurity-compatible rules file from the load balancer node
+	WAFRuleSetCustom WAFRuleSet = "custom"
+)
+
+// WAF limits
+const (
+	MaxParanoiaLevel  = 4
+	MaxWAFExclusions  = 100
+	maxWAFRuleID      = 9999999
+	defaultWAFRuleDir = "/etc/vpsie-lb/waf"
+)
+
+// WAF inspects HTTP requests with the Coraza web application firewall
+// before they are routed. HTTP and HTTPS load balancers only.
+type WAF struct {
+	Mode          WAFMode    `json:"mode" yaml:"mode"`                                         // block or detect
+	RuleSet       WAFRuleSet `json:"rule_set,omitempty" yaml:"rule_set,omitempty"`             // owasp_crs (default) or custom
+	ParanoiaLevel int        `json:"paranoia_level,omitempty" yaml:"paranoia_level,omitempty"` // owasp_crs only, 1-4 (default 1)
+	RulesPath     string     `json:"rules_path,omitempty" yaml:"rules_path,omitempty"`         // custom only, a file under /etc/vpsie-lb/waf
+	ExcludedRules []int      `json:"excluded_rules,omitempty" yaml:"excluded_rules,omitempty"` // rule IDs removed to avoid false positives
+}
+
+// Validate validates the WAF settings
+func (w *WAF) Validate() error {
+	if w.Mode != WAFBlock && w.Mode != WAFDetect {
+		return ErrInvalidWAFMode
+	}
+	switch w.RuleSet {
+	case "", WAFRuleSetCRS:
+		if w.ParanoiaLevel < 0 || w.ParanoiaLevel > MaxParanoiaLevel || w.RulesPath != "" {
+			return ErrInvalidWAF
+		}
+	case WAFRuleSetCustom:
+		if w.RulesPath == "" || w.ParanoiaLevel != 0 {
+			return ErrInvalidWAF
+		}
+		if err := validateTLSFilePath(w.RulesPath, defaultWAFRuleDir); err != nil {
+			return ErrInvalidWAF
+		}
+	default:
+		return ErrInvalidWAF
+	}
+	if len(w.ExcludedRules) > MaxWAFExclusions {
+		return ErrInvalidWAF
+	}
+	for _, id := range w.ExcludedRules {
+		if id < 1 || id > maxWAFRuleID {
+			return ErrInvalidWAF
+		}
+	}
+	return nil
+}
+
+func (lb *LoadBalancer) validateWAF() error {
+	if lb.WAF == nil {
+		return nil
+	}
+	if lb.Protocol == ProtocolTCP {
+		return ErrWAFRequiresHTTP
+	}
+	return lb.WAF.Validate()
+}
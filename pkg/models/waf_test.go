@@ -0,0 +1,75 @@
+package models
+
+import "testing"
+
+func TestWAF_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr error
+		waf     WAF
+	}{
+		{
+			name: "core rule set",
+			waf:  WAF{Mode: WAFBlock, ParanoiaLevel: 2, ExcludedRules: []int{920350, 942100}},
+		},
+		{
+			name: "custom rules",
+			waf:  WAF{Mode: WAFDetect, RuleSet: WAFRuleSetCustom, RulesPath: "/etc/vpsie-lb/waf/shop.conf"},
+		},
+		{
+			name:    "unknown mode",
+			waf:     WAF{Mode: "prevent"},
+			wantErr: ErrInvalidWAFMode,
+		},
+		{
+			name:    "paranoia level above 4",
+			waf:     WAF{Mode: WAFBlock, ParanoiaLevel: 5},
+			wantErr: ErrInvalidWAF,
+		},
+		{
+			name:    "custom rules without a file",
+			waf:     WAF{Mode: WAFBlock, RuleSet: WAFRuleSetCustom},
+			wantErr: ErrInvalidWAF,
+		},
+		{
+			name:    "custom rules outside the rules directory",
+			waf:     WAF{Mode: WAFBlock, RuleSet: WAFRuleSetCustom, RulesPath: "/etc/vpsie-lb/waf/../agent.yaml"},
+			wantErr: ErrInvalidWAF,
+		},
+		{
+			name:    "rules file for the core rule set",
+			waf:     WAF{Mode: WAFBlock, RulesPath: "/etc/vpsie-lb/waf/shop.conf"},
+			wantErr: ErrInvalidWAF,
+		},
+		{
+			name:    "invalid excluded rule",
+			waf:     WAF{Mode: WAFBlock, ExcludedRules: []int{0}},
+			wantErr: ErrInvalidWAF,
+		},
+		{
+			name:    "unknown rule set",
+			waf:     WAF{Mode: WAFBlock, RuleSet: "comodo"},
+			wantErr: ErrInvalidWAF,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.waf.Validate()
+			if err != tt.wantErr {
+				t.Errorf("WAF.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_Validate_WAFProtocol(t *testing.T) {
+	lb := &LoadBalancer{
+		ID: "lb-1", Name: "lb", Protocol: ProtocolTCP, Algorithm: AlgoRoundRobin, Port: 5432,
+		Backends: []Backend{{ID: "be-1", Address: "10.0.0.1", Port: 5432, Enabled: true}},
+		WAF:      &WAF{Mode: WAFBlock},
+	}
+	if err := lb.Validate(); err != ErrWAFRequiresHTTP {
+		t.Errorf("Validate() error = %v, wantErr %v", err, ErrWAFRequiresHTTP)
+	}
+}
@@ -0,0 +1,123 @@
+// Package network manages the floating IP of an active/passive load balancer
+// pair: binding it to the local interface, announcing it to the segment and
+// asking VPSie to route it to this node.
+package network
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// gratuitousARPCount is the number of unsolicited ARP replies sent after binding
+const gratuitousARPCount = 3
+
+// Assigner moves a floating IP to this node through the VPSie API
+type Assigner interface {
+	AssignFloatingIP(ctx context.Context, address string) error
+}
+
+// runFunc runs a command and returns its combined output
+type runFunc func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+// runCommand runs a system command
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	// #nosec G204 -- command names are constants and arguments are validated addresses and interface names
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
+
+// FloatingIP binds a floating IP on the active node and releases it on
+// failover or shutdown. It is safe for concurrent use.
+type FloatingIP struct {
+	addr     netip.Addr
+	iface    string
+	assigner Assigner // optional; nil when the IP is routed without the API
+	run      runFunc
+
+	mu   sync.Mutex
+	held bool
+}
+
+// NewFloatingIP creates a floating IP manager for address on iface. If
+// assigner is not nil, the IP is reassigned through the VPSie API before it is
+// bound locally.
+func NewFloatingIP(address, iface string, assigner Assigner) (*FloatingIP, error) {
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid floating IP %q: %w", address, err)
+	}
+	if iface == "" || strings.ContainsAny(iface, " /") {
+		return nil, fmt.Errorf("invalid interface name %q", iface)
+	}
+	return &FloatingIP{addr: addr, iface: iface, assigner: assigner, run: runCommand}, nil
+}
+
+// Address returns the floating IP
+func (f *FloatingIP) Address() string {
+	return f.addr.String()
+}
+
+// Held reports whether the floating IP is currently bound on this node
+func (f *FloatingIP) Held() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.held
+}
+
+// prefix returns the host prefix used to bind the address
+func (f *FloatingIP) prefix() string {
+	return netip.PrefixFrom(f.addr, f.addr.BitLen()).String()
+}
+
+// Acquire routes the floating IP to this node, binds it and announces it.
+// It is idempotent.
+func (f *FloatingIP) Acquire(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.assigner != nil {
+		if err := f.assigner.AssignFloatingIP(ctx, f.addr.String()); err != nil {
+			return fmt.Errorf("failed to assign floating IP %s: %w", f.addr, err)
+		}
+	}
+
+	// "replace" succeeds whether or not the address is already bound
+	if out, err := f.run(ctx, "ip", "addr", "replace", f.prefix(), "dev", f.iface); err != nil {
+		return fmt.Errorf("failed to bind floating IP %s on %s: %w: %s", f.addr, f.iface, err, strings.TrimSpace(string(out)))
+	}
+	f.held = true
+
+	f.announce(ctx)
+	return nil
+}
+
+// announce updates neighbours' ARP caches so traffic moves over immediately.
+// IPv6 neighbours are updated by the kernel's unsolicited advertisement.
+// Failures are logged: the address is bound and caches expire eventually.
+func (f *FloatingIP) announce(ctx context.Context) {
+	if !f.addr.Is4() {
+		return
+	}
+	out, err := f.run(ctx, "arping", "-U", "-c", fmt.Sprint(gratuitousARPCount), "-I", f.iface, f.addr.String())
+	if err != nil {
+		log.Printf("Warning: Failed to send gratuitous ARP for %s: %v: %s", f.addr, err, strings.TrimSpace(string(out)))
+	}
+}
+
+// Release unbinds the floating IP. Releasing an address that is not bound
+// is not an error.
+func (f *FloatingIP) Release(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out, err := f.run(ctx, "ip", "addr", "del", f.prefix(), "dev", f.iface)
+	if err != nil && !strings.Contains(string(out), "Cannot assign requested address") {
+		return fmt.Errorf("failed to release floating IP %s on %s: %w: %s", f.addr, f.iface, err, strings.TrimSpace(string(out)))
+	}
+	f.held = false
+	return nil
+}
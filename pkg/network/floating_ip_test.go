@@ -0,0 +1,174 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeRunner records commands and fails those matching failOn
+type fakeRunner struct {
+	commands []string
+	failOn   string
+	output   string
+}
+
+func (r *fakeRunner) run(_ context.Context, name string, args ...string) ([]byte, error) {
+	cmd := strings.Join(append([]string{name}, args...), " ")
+	r.commands = append(r.commands, cmd)
+	if r.failOn != "" && strings.Contains(cmd, r.failOn) {
+		return []byte(r.output), errors.New("exit status 2")
+	}
+	return nil, nil
+}
+
+// fakeAssigner records API reassignments
+type fakeAssigner struct {
+	assigned []string
+	err      error
+}
+
+func (a *fakeAssigner) AssignFloatingIP(_ context.Context, address string) error {
+	a.assigned = append(a.assigned, address)
+	return a.err
+}
+
+func newTestFloatingIP(t *testing.T, address string, assigner Assigner) (*FloatingIP, *fakeRunner) {
+	t.Helper()
+	f, err := NewFloatingIP(address, "eth0", assigner)
+	if err != nil {
+		t.Fatalf("NewFloatingIP() error = %v", err)
+	}
+	runner := &fakeRunner{}
+	f.run = runner.run
+	return f, runner
+}
+
+func TestNewFloatingIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		iface   string
+		wantErr bool
+	}{
+		{name: "ipv4", address: "203.0.113.10", iface: "eth0"},
+		{name: "ipv6", address: "2001:db8::10", iface: "eth0"},
+		{name: "invalid address", address: "not-an-ip", iface: "eth0", wantErr: true},
+		{name: "cidr is not an address", address: "203.0.113.10/32", iface: "eth0", wantErr: true},
+		{name: "empty interface", address: "203.0.113.10", iface: "", wantErr: true},
+		{name: "interface with spaces", address: "203.0.113.10", iface: "eth0 up", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFloatingIP(tt.address, tt.iface, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewFloatingIP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFloatingIP_Acquire(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		want    []string
+	}{
+		{
+			name:    "ipv4 binds and announces",
+			address: "203.0.113.10",
+			want: []string{
+				"ip addr replace 203.0.113.10/32 dev eth0",
+				"arping -U -c 3 -I eth0 203.0.113.10",
+			},
+		},
+		{
+			name:    "ipv6 binds only",
+			address: "2001:db8::10",
+			want:    []string{"ip addr replace 2001:db8::10/128 dev eth0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, runner := newTestFloatingIP(t, tt.address, nil)
+			if err := f.Acquire(context.Background()); err != nil {
+				t.Fatalf("Acquire() error = %v", err)
+			}
+			if strings.Join(runner.commands, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("commands = %q, want %q", runner.commands, tt.want)
+			}
+			if !f.Held() {
+				t.Error("Held() = false after Acquire")
+			}
+		})
+	}
+}
+
+func TestFloatingIP_AcquireViaAPI(t *testing.T) {
+	assigner := &fakeAssigner{}
+	f, runner := newTestFloatingIP(t, "203.0.113.10", assigner)
+	if err := f.Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if len(assigner.assigned) != 1 || assigner.assigned[0] != "203.0.113.10" {
+		t.Errorf("assigned = %v", assigner.assigned)
+	}
+	if len(runner.commands) != 2 {
+		t.Errorf("commands = %q, want bind and announce", runner.commands)
+	}
+
+	// An API failure must not bind the address
+	assigner.err = errors.New("forbidden")
+	f, runner = newTestFloatingIP(t, "203.0.113.10", assigner)
+	if err := f.Acquire(context.Background()); err == nil {
+		t.Error("Expected error when the API assignment fails")
+	}
+	if len(runner.commands) != 0 || f.Held() {
+		t.Errorf("address bound despite API failure: %q", runner.commands)
+	}
+}
+
+func TestFloatingIP_AnnounceFailureIsNotFatal(t *testing.T) {
+	f, runner := newTestFloatingIP(t, "203.0.113.10", nil)
+	runner.failOn = "arping"
+	if err := f.Acquire(context.Background()); err != nil {
+		t.Errorf("Acquire() error = %v, want nil when only the announcement fails", err)
+	}
+}
+
+func TestFloatingIP_Release(t *testing.T) {
+	tests := []struct {
+		name    string
+		failOn  string
+		output  string
+		wantErr bool
+	}{
+		{name: "bound"},
+		{name: "not bound", failOn: "addr del", output: "RTNETLINK answers: Cannot assign requested address"},
+		{name: "failure", failOn: "addr del", output: "RTNETLINK answers: Operation not permitted", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, runner := newTestFloatingIP(t, "203.0.113.10", nil)
+			if err := f.Acquire(context.Background()); err != nil {
+				t.Fatalf("Acquire() error = %v", err)
+			}
+			runner.failOn, runner.output = tt.failOn, tt.output
+
+			err := f.Release(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Release() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if last := runner.commands[len(runner.commands)-1]; last != "ip addr del 203.0.113.10/32 dev eth0" {
+				t.Errorf("last command = %q", last)
+			}
+			if f.Held() == !tt.wantErr {
+				t.Errorf("Held() = %v after Release", f.Held())
+			}
+		})
+	}
+}
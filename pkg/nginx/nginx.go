@@ -0,0 +1,215 @@
+// Package nginx generates, validates and reloads Nginx configuration for
+// load balancers on hosts that cannot run Envoy
+package nginx
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/proxy"
+)
+
+// Name is the name of the Nginx driver
+const Name = "nginx"
+
+// Defaults of the generated timeouts, in seconds
+const (
+	defaultConnectTimeout = 5
+	defaultIdleTimeout    = 3600
+)
+
+// algorithms maps load balancing algorithms to Nginx upstream directives;
+// round robin is the default and needs none
+var algorithms = map[models.LoadBalancingAlgo]string{
+	models.AlgoLeastRequest: "least_conn",
+	models.AlgoRandom:       "random",
+	models.AlgoRingHash:     "hash $remote_addr consistent",
+}
+
+// features lists what Nginx lacks besides the features only Envoy provides
+var features = []proxy.Feature{
+	// Nginx refuses backup servers with the random and hash methods
+	{Name: "backend priorities with the random or ring_hash algorithm", Used: func(lb *models.LoadBalancer) bool {
+		if lb.Algorithm != models.AlgoRandom && lb.Algorithm != models.AlgoRingHash {
+			return false
+		}
+		return slices.ContainsFunc(proxy.Backends(lb), func(b models.Backend) bool { return b.Priority > 0 })
+	}},
+	{Name: "tls_config.alpn other than h2 and http/1.1", Used: func(lb *models.LoadBalancer) bool {
+		return lb.TLSConfig != nil && slices.ContainsFunc(lb.TLSConfig.ALPN, func(p string) bool { return p != "h2" && p != "http/1.1" })
+	}},
+}
+
+// Driver generates Nginx configuration and applies it to Nginx run by
+// systemd. The generated file is a complete nginx.conf.
+type Driver struct {
+	configPath     string
+	maxConnections int
+	service        *proxy.Service
+}
+
+// NewDriver creates a Nginx driver writing configPath, checked with binary
+// and applied by reloading unit. maxConnections is the global connection
+// limit.
+func NewDriver(binary, unit, configPath string, maxConnections int) *Driver {
+	return &Driver{
+		configPath:     configPath,
+		maxConnections: maxConnections,
+		service:        proxy.NewService(binary, unit),
+	}
+}
+
+// Name returns the name of the proxy
+func (d *Driver) Name() string {
+	return Name
+}
+
+// ConfigPath returns the configuration file Nginx reads
+func (d *Driver) ConfigPath() string {
+	return d.configPath
+}
+
+// Validate checks a configuration file with nginx -t
+func (d *Driver) Validate(ctx context.Context, path string) error {
+	return d.service.Check(ctx, "-t", "-q", "-c", path)
+}
+
+// Reload makes Nginx load its configuration file again
+func (d *Driver) Reload(ctx context.Context) error {
+	return d.service.Reload(ctx)
+}
+
+// Generate returns the Nginx configuration serving lb, or a
+// *proxy.UnsupportedError when lb uses features Nginx cannot provide. Open
+// source Nginx has no active health checks: a health check makes Nginx take
+// a backend out after unhealthy_threshold failed connections or requests,
+// for interval times unhealthy_threshold seconds.
+func (d *Driver) Generate(lb *models.LoadBalancer) ([]byte, error) {
+	if err := proxy.Check(Name, lb, features...); err != nil {
+		return nil, err
+	}
+
+	connect, idle := defaultConnectTimeout, defaultIdleTimeout
+	read := 0
+	if t := lb.Timeouts; t != nil {
+		if t.Connect > 0 {
+			connect = t.Connect
+		}
+		if t.Idle > 0 {
+			idle = t.Idle
+		}
+		read = t.Request
+	}
+	if read == 0 {
+		read = idle
+	}
+	block := "http"
+	if lb.Protocol == models.ProtocolTCP {
+		block = "stream"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by the VPSie load balancer agent for %s, do not edit\n", lb.ID)
+	b.WriteString("worker_processes auto;\n\n")
+	b.WriteString("events {\n")
+	fmt.Fprintf(&b, "    worker_connections %d;\n", d.maxConnections)
+	b.WriteString("}\n\n")
+	fmt.Fprintf(&b, "%s {\n", block)
+
+	fmt.Fprintf(&b, "    upstream backends_%s {\n", lb.ID)
+	if algorithm := algorithms[lb.Algorithm]; algorithm != "" {
+		fmt.Fprintf(&b, "        %s;\n", algorithm)
+	}
+	passive := ""
+	if hc := lb.HealthCheck; hc != nil {
+		passive = fmt.Sprintf(" max_fails=%d fail_timeout=%ds", hc.UnhealthyThreshold, hc.Interval*hc.UnhealthyThreshold)
+	}
+	for _, backend := range proxy.Backends(lb) {
+		weight := backend.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		fmt.Fprintf(&b, "        server %s weight=%d%s", net.JoinHostPort(backend.Address, strconv.Itoa(backend.Port)), weight, passive)
+		if backend.Priority > 0 {
+			b.WriteString(" backup")
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("    }\n\n")
+
+	if lb.MaxConnections > 0 {
+		b.WriteString("    limit_conn_zone $server_port zone=connections:1m;\n\n")
+	}
+	b.WriteString("    server {\n")
+	addresses := lb.Addresses
+	if len(addresses) == 0 {
+		addresses = []string{""}
+	}
+	for _, addr := range addresses {
+		listen := strconv.Itoa(lb.ListenPort())
+		if addr != "" {
+			listen = net.JoinHostPort(addr, listen)
+		}
+		if lb.Protocol == models.ProtocolHTTPS {
+			listen += " ssl"
+		}
+		fmt.Fprintf(&b, "        listen %s;\n", listen)
+	}
+	if lb.MaxConnections > 0 {
+		fmt.Fprintf(&b, "        limit_conn connections %d;\n", lb.MaxConnections)
+	}
+	if lb.Protocol == models.ProtocolHTTPS && lb.TLSConfig != nil {
+		writeTLS(&b, lb.TLSConfig)
+	}
+	if block == "stream" {
+		fmt.Fprintf(&b, "        proxy_pass backends_%s;\n", lb.ID)
+		fmt.Fprintf(&b, "        proxy_connect_timeout %ds;\n", connect)
+		fmt.Fprintf(&b, "        proxy_timeout %ds;\n", idle)
+	} else {
+		fmt.Fprintf(&b, "        keepalive_timeout %ds;\n", idle)
+		b.WriteString("        location / {\n")
+		fmt.Fprintf(&b, "            proxy_pass http://backends_%s;\n", lb.ID)
+		b.WriteString("            proxy_http_version 1.1;\n")
+		b.WriteString("            proxy_set_header Host $host;\n")
+		b.WriteString("            proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;\n")
+		b.WriteString("            proxy_set_header X-Forwarded-Proto $scheme;\n")
+		fmt.Fprintf(&b, "            proxy_connect_timeout %ds;\n", connect)
+		fmt.Fprintf(&b, "            proxy_read_timeout %ds;\n", read)
+		b.WriteString("        }\n")
+	}
+	b.WriteString("    }\n")
+	b.WriteString("}\n")
+	return []byte(b.String()), nil
+}
+
+// writeTLS writes the TLS directives of an HTTPS server
+func writeTLS(b *strings.Builder, tls *models.TLSConfig) {
+	fmt.Fprintf(b, "        ssl_certificate %s;\n", tls.CertificatePath)
+	fmt.Fprintf(b, "        ssl_certificate_key %s;\n", tls.PrivateKeyPath)
+	if tls.CACertPath != "" {
+		fmt.Fprintf(b, "        ssl_client_certificate %s;\n", tls.CACertPath)
+		b.WriteString("        ssl_verify_client on;\n")
+	}
+	protocols := []string{"TLSv1.2", "TLSv1.3"}
+	if tls.MinVersion == "TLSv1.3" {
+		protocols = protocols[1:]
+	}
+	if tls.MaxVersion == "TLSv1.2" {
+		protocols = protocols[:1]
+	}
+	fmt.Fprintf(b, "        ssl_protocols %s;\n", strings.Join(protocols, " "))
+	if len(tls.CipherSuites) > 0 {
+		fmt.Fprintf(b, "        ssl_ciphers %s;\n", strings.Join(tls.CipherSuites, ":"))
+	}
+	if tls.DisableSessionTickets {
+		b.WriteString("        ssl_session_tickets off;\n")
+	}
+	if slices.Contains(tls.ALPN, "h2") {
+		b.WriteString("        http2 on;\n")
+	}
+}
@@ -0,0 +1,137 @@
+package nginx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/proxy"
+)
+
+func TestDriver_Generate(t *testing.T) {
+	tests := []struct {
+		name string
+		lb   *models.LoadBalancer
+		want string
+	}{
+		{
+			name: "tcp",
+			lb: &models.LoadBalancer{
+				ID:        "lb-1",
+				Protocol:  models.ProtocolTCP,
+				Port:      5432,
+				Algorithm: models.AlgoLeastRequest,
+				HealthCheck: &models.HealthCheck{Type: models.HealthCheckTCP,
+					Interval: 10, Timeout: 5, UnhealthyThreshold: 3, HealthyThreshold: 2},
+				Backends: []models.Backend{
+					{ID: "db-1", Address: "10.0.0.21", Port: 5432, Enabled: true},
+					{ID: "db-2", Address: "fd00::22", Port: 5432, Priority: 1, Enabled: true},
+				},
+			},
+			want: `# Generated by the VPSie load balancer agent for lb-1, do not edit
+worker_processes auto;
+
+events {
+    worker_connections 50000;
+}
+
+stream {
+    upstream backends_lb-1 {
+        least_conn;
+        server 10.0.0.21:5432 weight=1 max_fails=3 fail_timeout=30s;
+        server [fd00::22]:5432 weight=1 max_fails=3 fail_timeout=30s backup;
+    }
+
+    server {
+        listen 5432;
+        proxy_pass backends_lb-1;
+        proxy_connect_timeout 5s;
+        proxy_timeout 3600s;
+    }
+}
+`,
+		},
+		{
+			name: "https",
+			lb: &models.LoadBalancer{
+				ID:        "lb-2",
+				Protocol:  models.ProtocolHTTPS,
+				Port:      443,
+				Addresses: []string{"203.0.113.10"},
+				TLSConfig: &models.TLSConfig{
+					CertificatePath:       "/etc/ssl/shop.crt",
+					PrivateKeyPath:        "/etc/ssl/private/shop.key",
+					MinVersion:            "TLSv1.3",
+					ALPN:                  []string{"h2"},
+					DisableSessionTickets: true,
+				},
+				Timeouts:       &models.Timeouts{Connect: 2, Idle: 60},
+				MaxConnections: 1000,
+				Backends:       []models.Backend{{ID: "web-1", Address: "10.0.0.11", Port: 8080, Weight: 3, Enabled: true}},
+			},
+			want: `# Generated by the VPSie load balancer agent for lb-2, do not edit
+worker_processes auto;
+
+events {
+    worker_connections 50000;
+}
+
+http {
+    upstream backends_lb-2 {
+        server 10.0.0.11:8080 weight=3;
+    }
+
+    limit_conn_zone $server_port zone=connections:1m;
+
+    server {
+        listen 203.0.113.10:443 ssl;
+        limit_conn connections 1000;
+        ssl_certificate /etc/ssl/shop.crt;
+        ssl_certificate_key /etc/ssl/private/shop.key;
+        ssl_protocols TLSv1.3;
+        ssl_session_tickets off;
+        http2 on;
+        keepalive_timeout 60s;
+        location / {
+            proxy_pass http://backends_lb-2;
+            proxy_http_version 1.1;
+            proxy_set_header Host $host;
+            proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+            proxy_set_header X-Forwarded-Proto $scheme;
+            proxy_connect_timeout 2s;
+            proxy_read_timeout 60s;
+        }
+    }
+}
+`,
+		},
+	}
+
+	driver := NewDriver("/usr/sbin/nginx", "nginx.service", "/etc/nginx/nginx.conf", 50000)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := driver.Generate(tt.lb)
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Generate() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDriver_GenerateUnsupported(t *testing.T) {
+	lb := &models.LoadBalancer{
+		ID:        "lb-1",
+		Protocol:  models.ProtocolTCP,
+		Port:      6379,
+		Algorithm: models.AlgoRingHash,
+		Backends:  []models.Backend{{ID: "cache-1", Address: "10.0.0.31", Port: 6379, Priority: 1, Enabled: true}},
+	}
+	_, err := NewDriver("/usr/sbin/nginx", "nginx.service", "/etc/nginx/nginx.conf", 50000).Generate(lb)
+	var unsupported *proxy.UnsupportedError
+	if !errors.As(err, &unsupported) {
+		t.Errorf("Generate() error = %v, want backup servers with ring_hash refused", err)
+	}
+}
@@ -0,0 +1,169 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SMTP connection security
+const (
+	// EmailSTARTTLS upgrades the connection with STARTTLS, and fails when the
+	// server does not offer it
+	EmailSTARTTLS = "starttls"
+	// EmailTLS connects with TLS from the start (SMTPS, usually port 465)
+	EmailTLS = "tls"
+	// EmailPlain sends without encryption, for a relay on the same host or
+	// network
+	EmailPlain = "none"
+)
+
+// EmailSettings configure an email sink
+type EmailSettings struct {
+	Server   string // host:port
+	Security string // starttls, tls or none
+	Username string // empty sends without authentication
+	Password string
+	From     string
+	To       []string
+	Timeout  time.Duration // for the whole delivery
+}
+
+// Email sends notifications by SMTP
+type Email struct {
+	settings EmailSettings
+}
+
+// NewEmail creates an email sink
+func NewEmail(settings EmailSettings) *Email {
+	return &Email{settings: settings}
+}
+
+// Name returns the name of the sink
+func (e *Email) Name() string {
+	return "email"
+}
+
+// Send mails n to the recipients
+func (e *Email) Send(ctx context.Context, n *Notification) error {
+	s := &e.settings
+	host, _, err := net.SplitHostPort(s.Server)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP server %q: %w", s.Server, err)
+	}
+	tlsConfig := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	if s.Security == EmailTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", s.Server)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", s.Server)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", s.Server, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to start SMTP session with %s: %w", s.Server, err)
+	}
+	defer func() { _ = client.Close() }()
+
+	if s.Security == EmailSTARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server %s does not support STARTTLS", s.Server)
+		}
+		if err = client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS with %s failed: %w", s.Server, err)
+		}
+	}
+	if s.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err = client.Mail(s.From); err != nil {
+		return fmt.Errorf("SMTP server refused sender %s: %w", s.From, err)
+	}
+	for _, to := range s.To {
+		if err = client.Rcpt(to); err != nil {
+			return fmt.Errorf("SMTP server refused recipient %s: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP server refused message: %w", err)
+	}
+	if _, err = w.Write(emailMessage(s.From, s.To, n)); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("SMTP server refused message: %w", err)
+	}
+	return client.Quit()
+}
+
+// emailMessage formats n as a plain text mail
+func emailMessage(from string, to []string, n *Notification) []byte {
+	subject := fmt.Sprintf("[%s] %s", strings.ToUpper(n.Severity), n.Type)
+	if n.LoadBalancerID != "" {
+		subject += " on load balancer " + n.LoadBalancerID
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", headerValue(subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+
+	fmt.Fprintf(&msg, "%s\r\n\r\n", n.Message)
+	fmt.Fprintf(&msg, "Event:          %s\r\n", n.Type)
+	fmt.Fprintf(&msg, "Severity:       %s\r\n", n.Severity)
+	fmt.Fprintf(&msg, "Category:       %s\r\n", n.Category)
+	if n.LoadBalancerID != "" {
+		fmt.Fprintf(&msg, "Load balancer:  %s\r\n", n.LoadBalancerID)
+	}
+	if n.Node != "" {
+		fmt.Fprintf(&msg, "Node:           %s\r\n", n.Node)
+	}
+	fmt.Fprintf(&msg, "Time:           %s\r\n", n.Time.UTC().Format(time.RFC3339))
+	if n.CorrelationID != "" {
+		fmt.Fprintf(&msg, "Correlation ID: %s\r\n", n.CorrelationID)
+	}
+	if len(n.Metadata) > 0 {
+		keys := make([]string, 0, len(n.Metadata))
+		for key := range n.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		msg.WriteString("\r\nDetails:\r\n")
+		for _, key := range keys {
+			fmt.Fprintf(&msg, "  %s: %v\r\n", key, n.Metadata[key])
+		}
+	}
+	// The SMTP data writer turns lone line feeds, e.g. of multi-line errors,
+	// into CRLF
+	return msg.Bytes()
+}
+
+// headerValue keeps a header value on one line
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
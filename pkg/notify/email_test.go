@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer accepts one message and returns the commands and data it
+// received. It offers no extensions, so clients cannot use STARTTLS.
+func fakeSMTPServer(t *testing.T) (string, <-chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []string, 1)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var lines []string
+		r := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+		reply("220 fake ESMTP")
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+			switch {
+			case inData && line == ".":
+				inData = false
+				reply("250 queued")
+			case inData:
+			case strings.HasPrefix(line, "EHLO"), strings.HasPrefix(line, "HELO"):
+				reply("250 fake")
+			case line == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case line == "QUIT":
+				reply("221 bye")
+				received <- lines
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+		received <- lines
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestEmail_Send(t *testing.T) {
+	server, received := fakeSMTPServer(t)
+	email := NewEmail(EmailSettings{
+		Server:   server,
+		Security: EmailPlain,
+		From:     "lb-agent@example.com",
+		To:       []string{"ops@example.com", "oncall@example.com"},
+		Timeout:  5 * time.Second,
+	})
+	n := &Notification{
+		Time:           time.Date(2026, 10, 16, 9, 12, 44, 0, time.UTC),
+		Type:           "backend_pool_down",
+		Severity:       SeverityCritical,
+		Category:       "health",
+		Message:        "All backends of cluster lb-123 are down",
+		Metadata:       map[string]interface{}{"cluster": "lb-123"},
+		LoadBalancerID: "lb-123",
+		Node:           "lb-a",
+	}
+	if err := email.Send(context.Background(), n); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	session := strings.Join(<-received, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<lb-agent@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"RCPT TO:<oncall@example.com>",
+		"Subject: [CRITICAL] backend_pool_down on load balancer lb-123",
+		"All backends of cluster lb-123 are down",
+		"Node:           lb-a",
+		"  cluster: lb-123",
+	} {
+		if !strings.Contains(session, want) {
+			t.Errorf("SMTP session lacks %q:\n%s", want, session)
+		}
+	}
+}
+
+func TestEmail_SendRequiresSTARTTLS(t *testing.T) {
+	server, _ := fakeSMTPServer(t)
+	email := NewEmail(EmailSettings{
+		Server:   server,
+		Security: EmailSTARTTLS,
+		From:     "lb-agent@example.com",
+		To:       []string{"ops@example.com"},
+		Timeout:  5 * time.Second,
+	})
+	err := email.Send(context.Background(), &Notification{Type: "critical_failure", Severity: SeverityCritical})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Send() error = %v, want STARTTLS unsupported", err)
+	}
+}
+
+func TestEmailMessage_HeaderInjection(t *testing.T) {
+	msg := string(emailMessage("a@example.com", []string{"b@example.com"}, &Notification{
+		Type:           "critical_failure",
+		Severity:       SeverityCritical,
+		LoadBalancerID: "lb-1\r\nBcc: attacker@example.com",
+	}))
+	headers, _, _ := strings.Cut(msg, "\r\n\r\n")
+	if strings.Contains(headers, "\r\nBcc:") {
+		t.Errorf("message has an injected header:\n%s", headers)
+	}
+}
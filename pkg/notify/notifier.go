@@ -0,0 +1,161 @@
+// Package notify sends agent events to operators directly, through webhooks
+// such as Slack or PagerDuty, so the on-call learns about failed reloads or
+// backend pools going down even while the VPSie API is unreachable.
+//
+// Notifications are queued and delivered by a single worker, so a slow or
+// failing destination never holds up the agent. Each delivery is retried a
+// few times; notifications that arrive while the queue is full are dropped.
+package notify
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Severities, in increasing order of urgency. They match the severities of
+// agent events.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityError    = "error"
+	SeverityCritical = "critical"
+)
+
+// severityRank orders the severities
+var severityRank = map[string]int{
+	SeverityInfo:     1,
+	SeverityWarning:  2,
+	SeverityError:    3,
+	SeverityCritical: 4,
+}
+
+// ValidSeverity reports whether severity is a known severity
+func ValidSeverity(severity string) bool {
+	return severityRank[severity] > 0
+}
+
+// queueSize is how many notifications wait for delivery at most
+const queueSize = 100
+
+// Delivery attempts per notification and destination, and the wait before
+// the second attempt, doubled for every further one
+const (
+	maxAttempts  = 3
+	retryBackoff = time.Second
+)
+
+// Notification is an agent event sent to operators
+type Notification struct {
+	Time           time.Time              `json:"time"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	Type           string                 `json:"type"`
+	Severity       string                 `json:"severity"`
+	Category       string                 `json:"category"`
+	Message        string                 `json:"message"`
+	CorrelationID  string                 `json:"correlation_id,omitempty"`
+	LoadBalancerID string                 `json:"loadbalancer_id,omitempty"`
+	Node           string                 `json:"node,omitempty"`
+}
+
+// Sink delivers notifications to one destination
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, n *Notification) error
+}
+
+// Target is a sink and the notifications it receives
+type Target struct {
+	Sink        Sink
+	MinSeverity string   // least severity sent, default error
+	Events      []string // event types sent; empty sends all of MinSeverity and above
+}
+
+// wants reports whether the target receives n
+func (t *Target) wants(n *Notification) bool {
+	minSeverity := t.MinSeverity
+	if minSeverity == "" {
+		minSeverity = SeverityError
+	}
+	if severityRank[n.Severity] < severityRank[minSeverity] {
+		return false
+	}
+	if len(t.Events) == 0 {
+		return true
+	}
+	for _, eventType := range t.Events {
+		if eventType == n.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Notifier delivers notifications to its targets in the background
+type Notifier struct {
+	targets []Target
+	queue   chan *Notification
+	backoff time.Duration
+}
+
+// NewNotifier creates a notifier for targets. Call Run to deliver.
+func NewNotifier(targets []Target) *Notifier {
+	return &Notifier{
+		targets: targets,
+		queue:   make(chan *Notification, queueSize),
+		backoff: retryBackoff,
+	}
+}
+
+// Notify queues n for the targets that want it without waiting for delivery
+func (n *Notifier) Notify(notification *Notification) {
+	wanted := false
+	for i := range n.targets {
+		wanted = wanted || n.targets[i].wants(notification)
+	}
+	if !wanted {
+		return
+	}
+	select {
+	case n.queue <- notification:
+	default:
+		log.Printf("Warning: Notification queue is full, dropping %s notification", notification.Type)
+	}
+}
+
+// Run delivers queued notifications until ctx is cancelled
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-n.queue:
+			for i := range n.targets {
+				if n.targets[i].wants(notification) {
+					n.deliver(ctx, n.targets[i].Sink, notification)
+				}
+			}
+		}
+	}
+}
+
+// deliver sends notification to sink, retrying failed attempts
+func (n *Notifier) deliver(ctx context.Context, sink Sink, notification *Notification) {
+	backoff := n.backoff
+	for attempt := 1; ; attempt++ {
+		err := sink.Send(ctx, notification)
+		if err == nil {
+			return
+		}
+		if attempt == maxAttempts {
+			log.Printf("Warning: Failed to send %s notification to %s: %v", notification.Type, sink.Name(), err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSink records notifications and fails the first attempts
+type fakeSink struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	received []string
+}
+
+func (s *fakeSink) Name() string { return "fake" }
+
+func (s *fakeSink) Send(_ context.Context, n *Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+	s.received = append(s.received, n.Type)
+	return nil
+}
+
+func (s *fakeSink) got() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.received...)
+}
+
+func TestTarget_Wants(t *testing.T) {
+	tests := []struct {
+		name   string
+		target Target
+		n      Notification
+		want   bool
+	}{
+		{"default threshold takes errors", Target{}, Notification{Type: "envoy_reload_failed", Severity: SeverityError}, true},
+		{"default threshold skips warnings", Target{}, Notification{Type: "ha_failover", Severity: SeverityWarning}, false},
+		{"lower threshold", Target{MinSeverity: SeverityWarning}, Notification{Type: "ha_failover", Severity: SeverityWarning}, true},
+		{"critical only", Target{MinSeverity: SeverityCritical}, Notification{Type: "config_rolled_back", Severity: SeverityError}, false},
+		{"listed event", Target{MinSeverity: SeverityInfo, Events: []string{"ha_failover"}}, Notification{Type: "ha_failover", Severity: SeverityWarning}, true},
+		{"unlisted event", Target{MinSeverity: SeverityInfo, Events: []string{"ha_failover"}}, Notification{Type: "critical_failure", Severity: SeverityCritical}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.target.wants(&tt.n); got != tt.want {
+				t.Errorf("wants() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifier_Run(t *testing.T) {
+	flaky := &fakeSink{failures: 1}
+	down := &fakeSink{failures: maxAttempts}
+	n := NewNotifier([]Target{{Sink: flaky}, {Sink: down, MinSeverity: SeverityCritical}})
+	n.backoff = time.Millisecond
+
+	n.Notify(&Notification{Type: "info_only", Severity: SeverityInfo}) // no target wants it
+	n.Notify(&Notification{Type: "envoy_reload_failed", Severity: SeverityError})
+	n.Notify(&Notification{Type: "critical_failure", Severity: SeverityCritical})
+	if len(n.queue) != 2 {
+		t.Fatalf("queued = %d, want 2", len(n.queue))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(flaky.got()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := flaky.got(); len(got) != 2 || got[0] != "envoy_reload_failed" || got[1] != "critical_failure" {
+		t.Errorf("delivered = %v, want both notifications after a retry", got)
+	}
+	down.mu.Lock()
+	defer down.mu.Unlock()
+	if down.attempts != maxAttempts || len(down.received) != 0 {
+		t.Errorf("attempts to a failing sink = %d, want %d", down.attempts, maxAttempts)
+	}
+}
+
+func TestNotifier_NotifyQueueFull(t *testing.T) {
+	n := NewNotifier([]Target{{Sink: &fakeSink{}}})
+	for i := 0; i < queueSize+5; i++ {
+		n.Notify(&Notification{Type: "critical_failure", Severity: SeverityCritical})
+	}
+	if len(n.queue) != queueSize {
+		t.Errorf("queued = %d, want %d", len(n.queue), queueSize)
+	}
+}
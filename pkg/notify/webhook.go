@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Webhook kinds
+const (
+	// WebhookGeneric posts the notification as JSON
+	WebhookGeneric = "generic"
+	// WebhookSlack posts a message to a Slack incoming webhook
+	WebhookSlack = "slack"
+	// WebhookPagerDuty triggers a PagerDuty incident through the Events API v2
+	WebhookPagerDuty = "pagerduty"
+)
+
+// PagerDutyEventsURL is the PagerDuty Events API v2 endpoint
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// maxSummaryLength is the longest summary PagerDuty accepts
+const maxSummaryLength = 1024
+
+// Webhook posts notifications to an HTTP endpoint
+type Webhook struct {
+	client     *http.Client
+	name       string
+	kind       string
+	url        string
+	routingKey string // PagerDuty integration key
+}
+
+// NewWebhook creates a webhook of kind posting to url. PagerDuty webhooks
+// need the routing key of the integration and default to the PagerDuty
+// Events API.
+func NewWebhook(name, kind, url, routingKey string, timeout time.Duration) *Webhook {
+	if kind == WebhookPagerDuty && url == "" {
+		url = PagerDutyEventsURL
+	}
+	return &Webhook{
+		client:     &http.Client{Timeout: timeout},
+		name:       name,
+		kind:       kind,
+		url:        url,
+		routingKey: routingKey,
+	}
+}
+
+// Name returns the name of the webhook
+func (w *Webhook) Name() string {
+	return w.name
+}
+
+// Send posts n
+func (w *Webhook) Send(ctx context.Context, n *Notification) error {
+	var payload interface{}
+	switch w.kind {
+	case WebhookSlack:
+		payload = map[string]string{"text": slackText(n)}
+	case WebhookPagerDuty:
+		payload = pagerDutyEvent(n, w.routingKey)
+	default:
+		payload = n
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		// The URL may hold a token; the error names it
+		return fmt.Errorf("failed to post notification: %w", redact(err, w.url))
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// slackText formats n as a Slack message
+func slackText(n *Notification) string {
+	text := fmt.Sprintf("*[%s] %s*", strings.ToUpper(n.Severity), n.Type)
+	if n.LoadBalancerID != "" {
+		text += " on load balancer " + n.LoadBalancerID
+	}
+	if n.Node != "" {
+		text += " (node " + n.Node + ")"
+	}
+	return text + "\n" + n.Message
+}
+
+// pagerDutyEvent formats n as a PagerDuty trigger event. Repeats of an event
+// type on a load balancer are grouped into one incident.
+func pagerDutyEvent(n *Notification, routingKey string) map[string]interface{} {
+	summary := fmt.Sprintf("%s: %s", n.Type, n.Message)
+	if n.LoadBalancerID != "" {
+		summary = fmt.Sprintf("%s on %s: %s", n.Type, n.LoadBalancerID, n.Message)
+	}
+	if len(summary) > maxSummaryLength {
+		summary = summary[:maxSummaryLength]
+	}
+	source := n.Node
+	if source == "" {
+		source = "vpsie-lb-agent"
+	}
+	return map[string]interface{}{
+		"routing_key":  routingKey,
+		"event_action": "trigger",
+		"dedup_key":    n.LoadBalancerID + "/" + n.Type,
+		"payload": map[string]interface{}{
+			"summary":        summary,
+			"source":         source,
+			"severity":       n.Severity, // PagerDuty uses the same four severities
+			"timestamp":      n.Time.UTC().Format(time.RFC3339),
+			"component":      n.LoadBalancerID,
+			"group":          n.Category,
+			"class":          n.Type,
+			"custom_details": n.Metadata,
+		},
+	}
+}
+
+// redact removes url from the message of err
+func redact(err error, url string) error {
+	return fmt.Errorf("%s", strings.ReplaceAll(err.Error(), url, "<webhook url>"))
+}
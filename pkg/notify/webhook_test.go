@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhook_Send(t *testing.T) {
+	n := &Notification{
+		Time:           time.Date(2026, 10, 16, 9, 12, 44, 0, time.UTC),
+		Type:           "envoy_reload_failed",
+		Severity:       SeverityError,
+		Category:       "envoy",
+		Message:        "envoy hot restart failed",
+		Metadata:       map[string]interface{}{"epoch": 4},
+		LoadBalancerID: "lb-123",
+		Node:           "lb-a",
+	}
+
+	tests := []struct {
+		kind  string
+		check func(t *testing.T, body map[string]interface{})
+	}{
+		{WebhookGeneric, func(t *testing.T, body map[string]interface{}) {
+			if body["type"] != "envoy_reload_failed" || body["loadbalancer_id"] != "lb-123" || body["severity"] != "error" {
+				t.Errorf("generic body = %v", body)
+			}
+		}},
+		{WebhookSlack, func(t *testing.T, body map[string]interface{}) {
+			text, _ := body["text"].(string)
+			if !strings.HasPrefix(text, "*[ERROR] envoy_reload_failed* on load balancer lb-123 (node lb-a)\n") {
+				t.Errorf("slack text = %q", text)
+			}
+		}},
+		{WebhookPagerDuty, func(t *testing.T, body map[string]interface{}) {
+			payload, _ := body["payload"].(map[string]interface{})
+			if body["routing_key"] != "key-1" || body["event_action"] != "trigger" || body["dedup_key"] != "lb-123/envoy_reload_failed" {
+				t.Errorf("pagerduty event = %v", body)
+			}
+			if payload["severity"] != "error" || payload["source"] != "lb-a" || payload["timestamp"] != "2026-10-16T09:12:44Z" {
+				t.Errorf("pagerduty payload = %v", payload)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("request = %s %s", r.Method, r.Header.Get("Content-Type"))
+				}
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Fatalf("invalid JSON: %v", err)
+				}
+				tt.check(t, body)
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer server.Close()
+
+			webhook := NewWebhook("ops", tt.kind, server.URL, "key-1", time.Second)
+			if err := webhook.Send(context.Background(), n); err != nil {
+				t.Errorf("Send() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWebhook_SendErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	n := &Notification{Type: "critical_failure", Severity: SeverityCritical}
+
+	if err := NewWebhook("ops", WebhookSlack, server.URL, "", time.Second).Send(context.Background(), n); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Send() error = %v, want the status", err)
+	}
+
+	// The URL of an unreachable webhook, which may hold a token, is not logged
+	secretURL := "http://127.0.0.1:1/services/T000/B000/secret-token"
+	err := NewWebhook("ops", WebhookSlack, secretURL, "", time.Second).Send(context.Background(), n)
+	if err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("Send() error = %v, want an error without the URL", err)
+	}
+}
+
+func TestNewWebhook_PagerDutyDefaultURL(t *testing.T) {
+	if w := NewWebhook("pd", WebhookPagerDuty, "", "key", time.Second); w.url != PagerDutyEventsURL {
+		t.Errorf("url = %q, want %q", w.url, PagerDutyEventsURL)
+	}
+}
@@ -0,0 +1,179 @@
+// Package proxy holds what the HAProxy and Nginx drivers share: the part of
+// the load balancer model a proxy other than Envoy can serve, and the
+// systemd service running the proxy.
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// UnsupportedError reports load balancer features a proxy cannot provide
+type UnsupportedError struct {
+	Proxy    string
+	Features []string // "routes", "backend priority 2"
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s does not support %s", e.Proxy, strings.Join(e.Features, ", "))
+}
+
+// Feature is a load balancer feature, and how to tell whether a load
+// balancer uses it
+type Feature struct {
+	Name string
+	Used func(lb *models.LoadBalancer) bool
+}
+
+// envoyOnly lists the features only the Envoy driver provides. Discovery is
+// missing on purpose: the agent resolves it into backends for every proxy.
+var envoyOnly = []Feature{
+	{Name: "retry_policy", Used: func(lb *models.LoadBalancer) bool { return lb.RetryPolicy != nil }},
+	{Name: "connection_pool", Used: func(lb *models.LoadBalancer) bool { return lb.ConnectionPool != nil }},
+	{Name: "prewarm", Used: func(lb *models.LoadBalancer) bool { return lb.Prewarm != nil }},
+	{Name: "admission_control", Used: func(lb *models.LoadBalancer) bool { return lb.Admission != nil }},
+	{Name: "maintenance", Used: func(lb *models.LoadBalancer) bool { return lb.Maintenance != nil }},
+	{Name: "client_ip", Used: func(lb *models.LoadBalancer) bool { return lb.ClientIP != nil }},
+	{Name: "dns", Used: func(lb *models.LoadBalancer) bool { return lb.DNS != nil }},
+	{Name: "autoscaling", Used: func(lb *models.LoadBalancer) bool { return lb.Autoscaling != nil }},
+	{Name: "listener", Used: func(lb *models.LoadBalancer) bool { return lb.Listener != nil }},
+	{Name: "tracing", Used: func(lb *models.LoadBalancer) bool { return lb.Tracing != nil }},
+	{Name: "waf", Used: func(lb *models.LoadBalancer) bool { return lb.WAF != nil }},
+	{Name: "authorization", Used: func(lb *models.LoadBalancer) bool { return lb.Authorization != nil }},
+	{Name: "jwt_auth", Used: func(lb *models.LoadBalancer) bool { return lb.JWTAuth != nil }},
+	{Name: "ddos_protection", Used: func(lb *models.LoadBalancer) bool { return lb.DDoS != nil }},
+	{Name: "bandwidth_limit", Used: func(lb *models.LoadBalancer) bool { return lb.BandwidthLimit != nil }},
+	{Name: "pools", Used: func(lb *models.LoadBalancer) bool { return len(lb.Pools) > 0 }},
+	{Name: "routes", Used: func(lb *models.LoadBalancer) bool { return len(lb.Routes) > 0 }},
+	{Name: "custom_filters", Used: func(lb *models.LoadBalancer) bool { return len(lb.CustomFilters) > 0 }},
+	{Name: "tcp_protocol_hint", Used: func(lb *models.LoadBalancer) bool { return lb.TCPProtocolHint != "" }},
+	{Name: "tls_passthrough", Used: func(lb *models.LoadBalancer) bool { return lb.TLSPassthrough != nil }},
+	{Name: "port_range", Used: func(lb *models.LoadBalancer) bool { return lb.PortRange != nil || len(lb.Ports) > 0 }},
+	{Name: "helper", Used: func(lb *models.LoadBalancer) bool { return lb.Helper != "" }},
+	{Name: "tls_config.session_timeout", Used: func(lb *models.LoadBalancer) bool {
+		return lb.TLSConfig != nil && lb.TLSConfig.SessionTimeout != 0
+	}},
+	{Name: "health_check.headers", Used: func(lb *models.LoadBalancer) bool {
+		return lb.HealthCheck != nil && len(lb.HealthCheck.Headers) > 0
+	}},
+	{Name: "backends.discover_all", Used: func(lb *models.LoadBalancer) bool {
+		for _, b := range Backends(lb) {
+			if b.DiscoverAll {
+				return true
+			}
+		}
+		return false
+	}},
+	// Both proxies know a single backup level
+	{Name: "backend priorities above 1", Used: func(lb *models.LoadBalancer) bool {
+		for _, b := range Backends(lb) {
+			if b.Priority > 1 {
+				return true
+			}
+		}
+		return false
+	}},
+}
+
+// Check returns an *UnsupportedError when lb uses a feature only Envoy
+// provides, one of the extra features proxy lacks, or a value that cannot be
+// written to a configuration file safely
+func Check(proxy string, lb *models.LoadBalancer, extra ...Feature) error {
+	var unsupported []string
+	for _, f := range slices.Concat(envoyOnly, extra) {
+		if f.Used(lb) {
+			unsupported = append(unsupported, f.Name)
+		}
+	}
+	for _, value := range configValues(lb) {
+		if !safe(value) {
+			unsupported = append(unsupported, fmt.Sprintf("value %q", value))
+		}
+	}
+	if len(unsupported) > 0 {
+		return &UnsupportedError{Proxy: proxy, Features: unsupported}
+	}
+	return nil
+}
+
+// configValues returns the free-form values written to the configuration
+func configValues(lb *models.LoadBalancer) []string {
+	var values []string
+	if tls := lb.TLSConfig; tls != nil {
+		values = append(values, tls.CertificatePath, tls.PrivateKeyPath, tls.CACertPath)
+		values = append(values, tls.CipherSuites...)
+		values = append(values, tls.ALPN...)
+	}
+	if lb.HealthCheck != nil {
+		values = append(values, lb.HealthCheck.Path)
+	}
+	for _, b := range Backends(lb) {
+		values = append(values, b.ID)
+	}
+	return values
+}
+
+// safe reports whether s can be written unquoted to a HAProxy or Nginx
+// configuration: no whitespace, quotes, comments or block and statement
+// delimiters
+func safe(s string) bool {
+	return !strings.ContainsFunc(s, func(r rune) bool {
+		return r <= ' ' || r == 0x7f || strings.ContainsRune(`"'#;{}\`, r)
+	})
+}
+
+// Backends returns the enabled backends of the load balancer
+func Backends(lb *models.LoadBalancer) []models.Backend {
+	var backends []models.Backend
+	for _, b := range lb.Backends {
+		if b.Enabled {
+			backends = append(backends, b)
+		}
+	}
+	return backends
+}
+
+// runFunc runs a command and returns its combined output
+type runFunc func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+// runCommand runs a system command
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	// #nosec G204 -- the binary and unit come from the agent configuration
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
+
+// Service is a proxy run by systemd: its binary checks configuration files
+// and its unit is reloaded to apply them
+type Service struct {
+	binary string
+	unit   string
+	run    runFunc
+}
+
+// NewService creates a service for the proxy binary run by systemd unit
+func NewService(binary, unit string) *Service {
+	return &Service{binary: binary, unit: unit, run: runCommand}
+}
+
+// Check runs the proxy binary with the arguments checking a configuration
+// file
+func (s *Service) Check(ctx context.Context, args ...string) error {
+	if output, err := s.run(ctx, s.binary, args...); err != nil {
+		return fmt.Errorf("config validation failed: %w\nOutput: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Reload asks systemd to reload the proxy, which keeps serving open
+// connections
+func (s *Service) Reload(ctx context.Context) error {
+	if output, err := s.run(ctx, "systemctl", "reload", s.unit); err != nil {
+		return fmt.Errorf("systemctl reload %s failed: %w: %s", s.unit, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
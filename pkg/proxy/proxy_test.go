@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestCheck(t *testing.T) {
+	lb := &models.LoadBalancer{
+		ID:          "lb-1",
+		Protocol:    models.ProtocolHTTP,
+		Backends:    []models.Backend{{ID: "web-1", Enabled: true, Priority: 1}},
+		HealthCheck: &models.HealthCheck{Type: models.HealthCheckHTTP, Path: "/healthz"},
+	}
+	if err := Check("haproxy", lb); err != nil {
+		t.Fatalf("Check() error = %v, want a plain load balancer supported", err)
+	}
+
+	lb.Routes = []models.Route{{}}
+	lb.HealthCheck.Path = "/healthz; return 200"
+	lb.Backends = append(lb.Backends, models.Backend{ID: "web-2", Enabled: true, Priority: 2})
+	lb.Backends = append(lb.Backends, models.Backend{ID: "disabled one", Priority: 2})
+	extra := Feature{Name: "custom", Used: func(*models.LoadBalancer) bool { return true }}
+
+	err := Check("haproxy", lb, extra)
+	var unsupported *UnsupportedError
+	if !errors.As(err, &unsupported) {
+		t.Fatalf("Check() error = %v, want *UnsupportedError", err)
+	}
+	want := []string{"routes", "backend priorities above 1", "custom", `value "/healthz; return 200"`}
+	if !reflect.DeepEqual(unsupported.Features, want) {
+		t.Errorf("Features = %q, want %q", unsupported.Features, want)
+	}
+}
+
+func TestService(t *testing.T) {
+	var calls []string
+	s := NewService("/usr/sbin/haproxy", "haproxy.service")
+	s.run = func(_ context.Context, name string, args ...string) ([]byte, error) {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		if name == "systemctl" {
+			return []byte("Unit haproxy.service not found.\n"), errors.New("exit status 5")
+		}
+		return nil, nil
+	}
+
+	if err := s.Check(context.Background(), "-c", "-f", "/etc/haproxy/haproxy.cfg.new"); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+	err := s.Reload(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "Unit haproxy.service not found.") {
+		t.Errorf("Reload() error = %v, want the systemctl output", err)
+	}
+	want := []string{"/usr/sbin/haproxy -c -f /etc/haproxy/haproxy.cfg.new", "systemctl reload haproxy.service"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("ran %v, want %v", calls, want)
+	}
+}
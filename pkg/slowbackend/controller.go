@@ -0,0 +1,267 @@
+// Package slowbackend is a feedback controller for backend latency: it
+// compares the p95 latency of each backend host with the median of its
+// cluster, lowers the weight of hosts that are much slower than their peers
+// and restores it once they have recovered.
+package slowbackend
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/accesslog"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/events"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// minPeers is the number of hosts of a cluster with enough requests needed to
+// judge any of them; with fewer the median says little
+const minPeers = 3
+
+// weightScale multiplies the weights of a cluster with a slow host, so a
+// reduced weight keeps its share even for backends with the default weight 1
+const weightScale = 100
+
+// LatencySource hands out the upstream latency of the backend hosts since
+// the last call
+type LatencySource interface {
+	Take() []accesslog.HostLatency
+}
+
+// Settings tune the controller
+type Settings struct {
+	LatencyMultiple   float64       // p95 above this multiple of the cluster median is slow
+	MinLatency        time.Duration // p95 at or below this is never slow
+	MinRequests       int           // requests a host needs in an interval to be judged
+	WeightPercent     int           // share of its weight a slow host keeps
+	RecoveryIntervals int           // intervals in a row a slow host must keep up before its weight is restored
+}
+
+// Status is a backend host whose weight is reduced
+type Status struct {
+	ReducedAt time.Time `json:"reduced_at"`
+	Cluster   string    `json:"cluster"`
+	Address   string    `json:"address"`
+	P95Ms     float64   `json:"p95_latency_ms"`    // at the last interval it was judged
+	MedianMs  float64   `json:"median_latency_ms"` // of its cluster at that interval
+	Recovered int       `json:"recovered_intervals"`
+}
+
+// Controller tracks backend hosts with a reduced weight. State is kept in
+// memory, so a restarted agent starts with every weight as configured.
+type Controller struct {
+	mu       sync.Mutex
+	settings Settings
+	reduced  map[string]*Status // keyed by cluster and address
+	backends map[string]bool    // hosts of the applied configuration, by cluster and address
+	latency  LatencySource
+	events   events.Func // reports weight adjustments
+	changed  func()      // called when weights change, to apply them
+	now      func() time.Time
+}
+
+// NewController creates a slow backend controller. changed is called after
+// an evaluation that reduced or restored a weight.
+func NewController(settings Settings, latency LatencySource, onEvent events.Func, changed func()) *Controller {
+	return &Controller{
+		settings: settings,
+		reduced:  make(map[string]*Status),
+		latency:  latency,
+		events:   onEvent,
+		changed:  changed,
+		now:      time.Now,
+	}
+}
+
+// Run evaluates backend latency every interval until ctx is cancelled. While
+// active returns false (e.g. on a passive HA node) latency is discarded.
+func (c *Controller) Run(ctx context.Context, interval time.Duration, active func() bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if active() {
+				c.Evaluate(ctx)
+			} else {
+				c.latency.Take()
+			}
+		}
+	}
+}
+
+// adjustment is a weight change decided while the controller lock is held
+type adjustment struct {
+	eventType events.Type
+	message   string
+	metadata  map[string]interface{}
+}
+
+// Evaluate judges the latency of every backend host since the last
+// evaluation against its cluster, and reduces or restores weights
+func (c *Controller) Evaluate(ctx context.Context) {
+	clusters := make(map[string][]accesslog.HostLatency)
+	for _, l := range c.latency.Take() {
+		clusters[l.Cluster] = append(clusters[l.Cluster], l)
+	}
+	names := make([]string, 0, len(clusters))
+	for cluster := range clusters {
+		names = append(names, cluster)
+	}
+	sort.Strings(names)
+
+	var adjustments []adjustment
+	c.mu.Lock()
+	for _, cluster := range names {
+		adjustments = append(adjustments, c.evaluate(cluster, clusters[cluster])...)
+	}
+	c.mu.Unlock()
+
+	for _, a := range adjustments {
+		log.Print(a.message)
+		c.events(ctx, a.eventType, a.message, a.metadata)
+	}
+	if len(adjustments) > 0 {
+		c.changed()
+	}
+}
+
+// evaluate judges the hosts of one cluster
+func (c *Controller) evaluate(cluster string, hosts []accesslog.HostLatency) []adjustment {
+	s := c.settings
+	var peers []float64
+	for _, h := range hosts {
+		if h.Requests >= uint64(s.MinRequests) {
+			peers = append(peers, h.P95Ms)
+		}
+	}
+	if len(peers) < minPeers {
+		return nil
+	}
+	medianMs := median(peers)
+	thresholdMs := max(medianMs*s.LatencyMultiple, float64(s.MinLatency)/float64(time.Millisecond))
+
+	var adjustments []adjustment
+	for _, h := range hosts {
+		key := cluster + "/" + h.Host
+		status, reduced := c.reduced[key]
+		// A reduced host gets fewer requests; any of them tell how it does.
+		// Hosts resolved from a hostname have no weight of their own.
+		if !reduced && (h.Requests < uint64(s.MinRequests) || !c.backends[key]) {
+			continue
+		}
+		metadata := map[string]interface{}{
+			"cluster":           cluster,
+			"address":           h.Host,
+			"p95_latency_ms":    h.P95Ms,
+			"median_latency_ms": medianMs,
+		}
+		slow := h.P95Ms > thresholdMs
+
+		switch {
+		case !reduced && slow:
+			c.reduced[key] = &Status{ReducedAt: c.now(), Cluster: cluster, Address: h.Host, P95Ms: h.P95Ms, MedianMs: medianMs}
+			metadata["weight_percent"] = s.WeightPercent
+			adjustments = append(adjustments, adjustment{
+				eventType: events.WeightReduced,
+				message: fmt.Sprintf("Backend %s of cluster %s is slow (p95 %.0fms, cluster median %.0fms): weight reduced to %d%%",
+					h.Host, cluster, h.P95Ms, medianMs, s.WeightPercent),
+				metadata: metadata,
+			})
+		case reduced && slow:
+			status.P95Ms, status.MedianMs, status.Recovered = h.P95Ms, medianMs, 0
+		case reduced:
+			status.P95Ms, status.MedianMs = h.P95Ms, medianMs
+			if status.Recovered++; status.Recovered < s.RecoveryIntervals {
+				continue
+			}
+			delete(c.reduced, key)
+			adjustments = append(adjustments, adjustment{
+				eventType: events.WeightRestored,
+				message:   fmt.Sprintf("Backend %s of cluster %s recovered (p95 %.0fms, cluster median %.0fms): weight restored", h.Host, cluster, h.P95Ms, medianMs),
+				metadata:  metadata,
+			})
+		}
+	}
+	return adjustments
+}
+
+// median returns the median of values, which it sorts
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// Apply lowers the weights of the slow backends of lb. The weights of their
+// clusters are scaled up first, so a reduced weight keeps its share even next
+// to backends with the default weight. Hosts no longer in lb are forgotten.
+func (c *Controller) Apply(lb *models.LoadBalancer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.backends = make(map[string]bool)
+	apply := func(pool string, backends []models.Backend) {
+		cluster := envoy.ClusterName(lb, pool)
+		keys := make([]string, len(backends))
+		slow := false
+		for i, backend := range backends {
+			keys[i] = cluster + "/" + net.JoinHostPort(backend.Address, strconv.Itoa(backend.Port))
+			c.backends[keys[i]] = true
+			if _, ok := c.reduced[keys[i]]; ok {
+				slow = true
+			}
+		}
+		if !slow {
+			return
+		}
+		for i := range backends {
+			weight := max(backends[i].Weight, 1) * weightScale
+			if _, ok := c.reduced[keys[i]]; ok {
+				weight = max(weight*c.settings.WeightPercent/100, 1)
+			}
+			backends[i].Weight = weight
+		}
+	}
+	apply("", lb.Backends)
+	for i := range lb.Pools {
+		apply(lb.Pools[i].Name, lb.Pools[i].Backends)
+	}
+
+	for key := range c.reduced {
+		if !c.backends[key] {
+			delete(c.reduced, key)
+		}
+	}
+}
+
+// Statuses returns the hosts whose weight is reduced, ordered by cluster and
+// address
+func (c *Controller) Statuses() []Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := make([]Status, 0, len(c.reduced))
+	for _, status := range c.reduced {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Cluster != statuses[j].Cluster {
+			return statuses[i].Cluster < statuses[j].Cluster
+		}
+		return statuses[i].Address < statuses[j].Address
+	})
+	return statuses
+}
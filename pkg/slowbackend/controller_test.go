@@ -0,0 +1,134 @@
+package slowbackend
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/accesslog"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/envoy"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/events"
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// fakeLatency hands out the configured latency on every call
+type fakeLatency struct {
+	latencies []accesslog.HostLatency
+}
+
+func (f *fakeLatency) Take() []accesslog.HostLatency {
+	return f.latencies
+}
+
+func slowLB() *models.LoadBalancer {
+	return &models.LoadBalancer{
+		ID: "lb-1",
+		Backends: []models.Backend{
+			{ID: "be-1", Address: "10.0.0.1", Port: 80, Enabled: true},
+			{ID: "be-2", Address: "10.0.0.2", Port: 80, Enabled: true, Weight: 2},
+			{ID: "be-3", Address: "10.0.0.3", Port: 80, Enabled: true},
+			{ID: "be-4", Address: "10.0.0.4", Port: 80, Enabled: true},
+		},
+	}
+}
+
+func TestController(t *testing.T) {
+	cluster := envoy.ClusterName(slowLB(), "")
+	latency := &fakeLatency{}
+	sample := func(p95 ...float64) {
+		latency.latencies = nil
+		for i, ms := range p95 {
+			latency.latencies = append(latency.latencies, accesslog.HostLatency{
+				Cluster: cluster, Host: "10.0.0." + string(rune('1'+i)) + ":80", Requests: 50, P95Ms: ms,
+			})
+		}
+	}
+	var reported []string
+	changes := 0
+	c := NewController(Settings{LatencyMultiple: 2, MinLatency: 50 * time.Millisecond, MinRequests: 20, WeightPercent: 25, RecoveryIntervals: 2},
+		latency,
+		func(_ context.Context, eventType events.Type, _ string, _ map[string]interface{}) {
+			reported = append(reported, string(eventType))
+		},
+		func() { changes++ })
+	c.Apply(slowLB())
+
+	// Slow, but below the latency floor
+	sample(10, 10, 10, 40)
+	c.Evaluate(context.Background())
+	// be-2 at five times the median
+	sample(25, 250, 25, 50)
+	c.Evaluate(context.Background())
+	if strings.Join(reported, ",") != "backend_weight_reduced" || changes != 1 {
+		t.Fatalf("events = %v after %d changes, want be-2 reduced once", reported, changes)
+	}
+
+	lb := slowLB()
+	c.Apply(lb)
+	var weights []int
+	for _, backend := range lb.Backends {
+		weights = append(weights, backend.Weight)
+	}
+	if want := []int{100, 50, 100, 100}; !reflect.DeepEqual(weights, want) {
+		t.Errorf("weights = %v, want %v", weights, want)
+	}
+	if statuses := c.Statuses(); len(statuses) != 1 || statuses[0].Address != "10.0.0.2:80" || statuses[0].MedianMs != 37.5 {
+		t.Errorf("Statuses() = %+v, want be-2 with a median of 37.5ms", statuses)
+	}
+
+	// Recovery takes two good intervals in a row
+	sample(25, 25, 25, 50)
+	c.Evaluate(context.Background())
+	sample(25, 250, 25, 50)
+	c.Evaluate(context.Background())
+	sample(25, 25, 25, 50)
+	c.Evaluate(context.Background())
+	if len(reported) != 1 {
+		t.Fatalf("events = %v, want no restore before two good intervals in a row", reported)
+	}
+	c.Evaluate(context.Background())
+	if strings.Join(reported, ",") != "backend_weight_reduced,backend_weight_restored" || changes != 2 {
+		t.Errorf("events = %v after %d changes, want be-2 restored", reported, changes)
+	}
+
+	lb = slowLB()
+	c.Apply(lb)
+	if !reflect.DeepEqual(lb, slowLB()) {
+		t.Errorf("backends = %+v, want the configured weights", lb.Backends)
+	}
+}
+
+func TestController_Peers(t *testing.T) {
+	cluster := envoy.ClusterName(slowLB(), "")
+	latency := &fakeLatency{latencies: []accesslog.HostLatency{
+		{Cluster: cluster, Host: "10.0.0.1:80", Requests: 50, P95Ms: 25},
+		{Cluster: cluster, Host: "10.0.0.2:80", Requests: 50, P95Ms: 2000},
+		{Cluster: cluster, Host: "10.0.0.3:80", Requests: 5, P95Ms: 25},  // too few requests to count
+		{Cluster: cluster, Host: "10.0.9.9:80", Requests: 50, P95Ms: 25}, // not a backend, e.g. resolved from a hostname
+		{Cluster: cluster, Host: "10.0.9.7:80", Requests: 50, P95Ms: 25},
+		{Cluster: cluster, Host: "10.0.9.8:80", Requests: 50, P95Ms: 900}, // slow, but not a backend
+	}}
+	var reported []string
+	c := NewController(Settings{LatencyMultiple: 2, MinRequests: 20, WeightPercent: 25, RecoveryIntervals: 1},
+		latency,
+		func(_ context.Context, _ events.Type, message string, _ map[string]interface{}) {
+			reported = append(reported, message)
+		},
+		func() {})
+	c.Apply(slowLB())
+	c.Evaluate(context.Background())
+
+	if len(reported) != 1 || !strings.Contains(reported[0], "10.0.0.2:80") {
+		t.Errorf("events = %v, want only be-2 reduced", reported)
+	}
+
+	// Too few peers to judge
+	latency.latencies = latency.latencies[:3]
+	c = NewController(c.settings, latency, func(context.Context, events.Type, string, map[string]interface{}) {
+		t.Error("a backend was judged without enough peers")
+	}, func() {})
+	c.Apply(slowLB())
+	c.Evaluate(context.Background())
+}
@@ -0,0 +1,45 @@
+// Package waf runs the Coraza web application firewall sidecar Envoy sends
+// the requests of load balancers with a WAF to for inspection: it renders
+// the Coraza directives from the load balancer's WAF settings and keeps the
+// sidecar process running with them.
+package waf
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// Directives renders the Coraza configuration for w. crsPath is the
+// directory of the bundled OWASP Core Rule Set.
+func Directives(w *models.WAF, crsPath string) string {
+	var b strings.Builder
+	b.WriteString("# Generated by vpsie-lb-agent; do not edit\n")
+	if w.Mode == models.WAFDetect {
+		b.WriteString("SecRuleEngine DetectionOnly\n")
+	} else {
+		b.WriteString("SecRuleEngine On\n")
+	}
+	b.WriteString("SecRequestBodyAccess On\n")
+	b.WriteString("SecResponseBodyAccess Off\n")
+
+	if w.RuleSet == models.WAFRuleSetCustom {
+		fmt.Fprintf(&b, "Include %s\n", w.RulesPath)
+	} else {
+		paranoia := w.ParanoiaLevel
+		if paranoia == 0 {
+			paranoia = 1
+		}
+		fmt.Fprintf(&b, "Include %s\n", filepath.Join(crsPath, "crs-setup.conf"))
+		fmt.Fprintf(&b, "SecAction \"id:900000,phase:1,pass,nolog,t:none,setvar:tx.blocking_paranoia_level=%d\"\n", paranoia)
+		fmt.Fprintf(&b, "Include %s\n", filepath.Join(crsPath, "rules", "*.conf"))
+	}
+
+	// Exclusions must follow the rules they remove
+	for _, id := range w.ExcludedRules {
+		fmt.Fprintf(&b, "SecRuleRemoveById %d\n", id)
+	}
+	return b.String()
+}
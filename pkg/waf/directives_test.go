@@ -0,0 +1,63 @@
+package waf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+func TestDirectives(t *testing.T) {
+	tests := []struct {
+		name    string
+		waf     models.WAF
+		want    []string
+		wantNot []string
+	}{
+		{
+			name: "crs blocking at the default paranoia level",
+			waf:  models.WAF{Mode: models.WAFBlock},
+			want: []string{
+				"SecRuleEngine On\n",
+				"Include /usr/share/coraza/coreruleset/crs-setup.conf\n",
+				"setvar:tx.blocking_paranoia_level=1",
+				"Include /usr/share/coraza/coreruleset/rules/*.conf\n",
+			},
+		},
+		{
+			name:    "crs detection with exclusions",
+			waf:     models.WAF{Mode: models.WAFDetect, ParanoiaLevel: 3, ExcludedRules: []int{920350, 942100}},
+			want:    []string{"SecRuleEngine DetectionOnly\n", "paranoia_level=3", "SecRuleRemoveById 920350\nSecRuleRemoveById 942100\n"},
+			wantNot: []string{"SecRuleEngine On"},
+		},
+		{
+			name:    "custom rules",
+			waf:     models.WAF{Mode: models.WAFBlock, RuleSet: models.WAFRuleSetCustom, RulesPath: "/etc/vpsie-lb/waf/rules.conf"},
+			want:    []string{"Include /etc/vpsie-lb/waf/rules.conf\n"},
+			wantNot: []string{"coreruleset", "paranoia_level"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Directives(&tt.waf, "/usr/share/coraza/coreruleset")
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("Directives() does not contain %q:\n%s", want, got)
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("Directives() contains %q:\n%s", unwanted, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDirectives_ExclusionsFollowRules(t *testing.T) {
+	got := Directives(&models.WAF{Mode: models.WAFBlock, ExcludedRules: []int{920350}}, "/crs")
+	if strings.Index(got, "SecRuleRemoveById") < strings.Index(got, "rules/*.conf") {
+		t.Errorf("exclusions precede the rules they remove:\n%s", got)
+	}
+}
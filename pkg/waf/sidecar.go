@@ -0,0 +1,185 @@
+package waf
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+const (
+	// defaultRestartDelay is how long a crashed sidecar waits to be restarted
+	defaultRestartDelay = 5 * time.Second
+	// stopTimeout bounds the wait for a stopped sidecar to exit before it is killed
+	stopTimeout = 10 * time.Second
+)
+
+// process is a running sidecar
+type process struct {
+	cmd    *exec.Cmd
+	exited chan struct{}
+}
+
+// Sidecar supervises the Coraza sidecar process. The sidecar runs only while
+// the applied load balancer has a WAF, is restarted when its directives
+// change and is started again when it exits on its own.
+type Sidecar struct {
+	binary         string
+	listenAddress  string
+	directivesPath string
+	crsPath        string
+	restartDelay   time.Duration
+
+	mu         sync.Mutex
+	proc       *process // nil while stopped
+	directives string   // directives proc runs with
+	stopped    bool     // Stop was called; nothing is started again
+}
+
+// NewSidecar creates a supervisor for the sidecar binary. The sidecar listens
+// for Envoy's external processing requests on listenAddress and reads its
+// directives from directivesPath; crsPath is the OWASP Core Rule Set it
+// includes.
+func NewSidecar(binary, listenAddress, directivesPath, crsPath string) *Sidecar {
+	return &Sidecar{
+		binary:         binary,
+		listenAddress:  listenAddress,
+		directivesPath: directivesPath,
+		crsPath:        crsPath,
+		restartDelay:   defaultRestartDelay,
+	}
+}
+
+// Apply runs the sidecar with the directives of w, or stops it when w is nil.
+// A running sidecar whose directives are unchanged is left alone.
+func (s *Sidecar) Apply(w *models.WAF) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return errors.New("WAF sidecar supervisor is stopped")
+	}
+	if w == nil {
+		if s.proc != nil {
+			log.Println("Stopping WAF sidecar: the load balancer has no WAF")
+		}
+		// Also cancels the restart of a crashed sidecar
+		s.stop()
+		return nil
+	}
+
+	directives := Directives(w, s.crsPath)
+	if s.proc != nil && directives == s.directives {
+		return nil
+	}
+	if err := writeFileAtomic(s.directivesPath, directives); err != nil {
+		return fmt.Errorf("failed to write WAF directives: %w", err)
+	}
+	s.stop()
+	s.directives = directives
+	return s.start()
+}
+
+// Running reports whether the sidecar process is running
+func (s *Sidecar) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.proc != nil
+}
+
+// Stop stops the sidecar for good, e.g. when the agent shuts down
+func (s *Sidecar) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	s.stop()
+}
+
+// start starts the sidecar. The caller holds s.mu.
+func (s *Sidecar) start() error {
+	// #nosec G204 -- the binary and its arguments come from the agent configuration
+	cmd := exec.Command(s.binary, "-listen", s.listenAddress, "-directives", s.directivesPath)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start WAF sidecar: %w", err)
+	}
+	log.Printf("Started WAF sidecar (pid %d) on %s", cmd.Process.Pid, s.listenAddress)
+
+	p := &process{cmd: cmd, exited: make(chan struct{})}
+	s.proc = p
+	go func() {
+		err := cmd.Wait()
+		close(p.exited)
+		s.exited(p, err)
+	}()
+	return nil
+}
+
+// exited restarts the sidecar after p exited on its own
+func (s *Sidecar) exited(p *process, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.proc != p {
+		return // stopped or replaced
+	}
+	s.proc = nil
+	log.Printf("Warning: WAF sidecar exited (%v), restarting in %s", err, s.restartDelay)
+	time.AfterFunc(s.restartDelay, s.restart)
+}
+
+// restart starts a crashed sidecar again, unless it was stopped or started
+// in the meantime
+func (s *Sidecar) restart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped || s.proc != nil || s.directives == "" {
+		return
+	}
+	if err := s.start(); err != nil {
+		log.Printf("Error restarting WAF sidecar: %v", err)
+		time.AfterFunc(s.restartDelay, s.restart)
+	}
+}
+
+// stop terminates the running sidecar and waits for it to exit. The caller
+// holds s.mu.
+func (s *Sidecar) stop() {
+	p := s.proc
+	s.proc = nil
+	s.directives = ""
+	if p == nil {
+		return
+	}
+	_ = p.cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-p.exited:
+	case <-time.After(stopTimeout):
+		log.Printf("Warning: WAF sidecar did not exit within %s, killing it", stopTimeout)
+		_ = p.cmd.Process.Kill()
+		<-p.exited
+	}
+}
+
+// writeFileAtomic replaces path with data through a temporary file
+func writeFileAtomic(path, data string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(data), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
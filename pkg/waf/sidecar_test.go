@@ -0,0 +1,105 @@
+package waf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// fakeSidecar writes a sidecar binary that records each start with its
+// arguments in the starts file and runs until it is terminated
+func fakeSidecar(t *testing.T) (binary, starts string) {
+	t.Helper()
+	dir := t.TempDir()
+	binary = filepath.Join(dir, "vpsie-lb-waf")
+	starts = filepath.Join(dir, "starts")
+	script := "#!/bin/sh\necho \"$@\" >> " + starts + "\nexec sleep 60\n"
+	if err := os.WriteFile(binary, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return binary, starts
+}
+
+// waitForStarts waits until the fake sidecar was started n times and returns
+// the recorded arguments
+func waitForStarts(t *testing.T, starts string, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(starts)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(data) > 0 && len(lines) >= n {
+			return lines
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sidecar started %d times, want %d", len(lines), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSidecar_Apply(t *testing.T) {
+	binary, starts := fakeSidecar(t)
+	directivesPath := filepath.Join(t.TempDir(), "waf", "directives.conf")
+	s := NewSidecar(binary, "127.0.0.1:9904", directivesPath, "/crs")
+	defer s.Stop()
+
+	if err := s.Apply(&models.WAF{Mode: models.WAFBlock}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	args := waitForStarts(t, starts, 1)
+	if want := "-listen 127.0.0.1:9904 -directives " + directivesPath; args[0] != want {
+		t.Errorf("sidecar arguments = %q, want %q", args[0], want)
+	}
+	data, err := os.ReadFile(directivesPath)
+	if err != nil || !strings.Contains(string(data), "SecRuleEngine On") {
+		t.Errorf("directives = %q (%v), want the blocking rule engine", data, err)
+	}
+
+	// Unchanged directives keep the sidecar running
+	if err := s.Apply(&models.WAF{Mode: models.WAFBlock}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	// Changed directives restart it
+	if err := s.Apply(&models.WAF{Mode: models.WAFDetect}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if args := waitForStarts(t, starts, 2); len(args) != 2 {
+		t.Errorf("sidecar started %d times, want 2", len(args))
+	}
+
+	if err := s.Apply(nil); err != nil {
+		t.Fatalf("Apply(nil) error = %v", err)
+	}
+	if s.Running() {
+		t.Error("Running() = true after the WAF was removed")
+	}
+}
+
+func TestSidecar_RestartsAfterCrash(t *testing.T) {
+	binary, starts := fakeSidecar(t)
+	s := NewSidecar(binary, "127.0.0.1:9904", filepath.Join(t.TempDir(), "directives.conf"), "/crs")
+	s.restartDelay = 10 * time.Millisecond
+	defer s.Stop()
+
+	if err := s.Apply(&models.WAF{Mode: models.WAFBlock}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	waitForStarts(t, starts, 1)
+
+	s.mu.Lock()
+	_ = s.proc.cmd.Process.Kill()
+	s.mu.Unlock()
+	waitForStarts(t, starts, 2)
+}
+
+func TestSidecar_StartFailure(t *testing.T) {
+	s := NewSidecar(filepath.Join(t.TempDir(), "missing"), "127.0.0.1:9904", filepath.Join(t.TempDir(), "directives.conf"), "/crs")
+	if err := s.Apply(&models.WAF{Mode: models.WAFBlock}); err == nil {
+		t.Error("Apply() error = nil, want an error for a missing sidecar binary")
+	}
+}
@@ -0,0 +1,135 @@
+// Package wasm fetches the WebAssembly modules of custom filters from VPSie
+// object storage before Envoy is configured to load them. Modules are
+// verified against their SHA-256 checksum and stored under it, so a module
+// is only downloaded once and a changed module is a new file.
+package wasm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// fetchTimeout bounds the download of one module
+const fetchTimeout = 2 * time.Minute
+
+// Fetcher downloads the modules of enabled WASM filters into a directory
+type Fetcher struct {
+	dir    string
+	hosts  []string // allowed hosts; "*.example.com" matches any subdomain
+	client *http.Client
+}
+
+// NewFetcher creates a fetcher storing modules in dir. Modules are only
+// fetched from the allowed hosts, over https.
+func NewFetcher(dir string, hosts []string) *Fetcher {
+	f := &Fetcher{dir: dir, hosts: hosts}
+	f.client = &http.Client{
+		Timeout: fetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "https" || !f.allowed(req.URL.Hostname()) {
+				return fmt.Errorf("redirect to %s is not allowed", req.URL.Host)
+			}
+			return nil
+		},
+	}
+	return f
+}
+
+// Fetch downloads the module of every enabled WASM filter that is not yet in
+// the directory
+func (f *Fetcher) Fetch(ctx context.Context, filters []models.CustomFilter) error {
+	for i := range filters {
+		filter := &filters[i]
+		if !filter.Enabled || filter.Type != models.CustomFilterWASM {
+			continue
+		}
+		path := filepath.Join(f.dir, filter.ModuleFile())
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if err := f.fetch(ctx, filter, path); err != nil {
+			return fmt.Errorf("failed to fetch WASM module of filter %s: %w", filter.Name, err)
+		}
+	}
+	return nil
+}
+
+// fetch downloads one module, verifies its size and checksum and stores it
+// at path
+func (f *Fetcher) fetch(ctx context.Context, filter *models.CustomFilter, path string) error {
+	host, err := filter.ModuleHost()
+	if err != nil {
+		return err
+	}
+	if !f.allowed(host) {
+		return fmt.Errorf("host %s is not an allowed module host", host)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, filter.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	module, err := io.ReadAll(io.LimitReader(resp.Body, models.MaxWASMModuleBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(module) > models.MaxWASMModuleBytes {
+		return fmt.Errorf("module exceeds %d bytes", models.MaxWASMModuleBytes)
+	}
+	sum := sha256.Sum256(module)
+	if got := hex.EncodeToString(sum[:]); got != filter.SHA256 {
+		return fmt.Errorf("checksum mismatch: got %s, want %s", got, filter.SHA256)
+	}
+
+	if err := os.MkdirAll(f.dir, 0755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, module, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// allowed reports whether modules may be fetched from host
+func (f *Fetcher) allowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range f.hosts {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
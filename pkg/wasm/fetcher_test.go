@@ -0,0 +1,131 @@
+package wasm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/vpsie/vpsie-loadbalancer/pkg/models"
+)
+
+// module is a minimal WebAssembly binary: the magic number and version
+var module = []byte("\x00asm\x01\x00\x00\x00")
+
+func moduleSum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// newTestFetcher serves module over TLS and returns a fetcher trusting the
+// server, and the number of requests it served
+func newTestFetcher(t *testing.T) (*Fetcher, string, *int32) {
+	var requests int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path != "/filters/geoip.wasm" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(module)
+	}))
+	t.Cleanup(srv.Close)
+
+	f := NewFetcher(t.TempDir(), []string{"127.0.0.1"})
+	f.client.Transport = srv.Client().Transport
+	return f, srv.URL, &requests
+}
+
+func TestFetcher_Fetch(t *testing.T) {
+	f, base, requests := newTestFetcher(t)
+	filters := []models.CustomFilter{
+		{Name: "geoip", Type: models.CustomFilterWASM, Enabled: true, URL: base + "/filters/geoip.wasm", SHA256: moduleSum(module)},
+		{Name: "disabled", Type: models.CustomFilterWASM, URL: base + "/filters/missing.wasm", SHA256: strings.Repeat("b", 64)},
+		{Name: "tag", Type: models.CustomFilterLua, Enabled: true, Source: "function envoy_on_request(h) end"},
+	}
+
+	if err := f.Fetch(context.Background(), filters); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(f.dir, filters[0].ModuleFile()))
+	if err != nil || string(got) != string(module) {
+		t.Fatalf("stored module = %q, %v; want the served module", got, err)
+	}
+
+	// Stored modules are not downloaded again
+	if err := f.Fetch(context.Background(), filters); err != nil {
+		t.Fatalf("second Fetch() error = %v", err)
+	}
+	if n := atomic.LoadInt32(requests); n != 1 {
+		t.Errorf("server saw %d requests, want 1", n)
+	}
+}
+
+func TestFetcher_FetchRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter func(base string) models.CustomFilter
+		want   string
+	}{
+		{
+			name: "checksum mismatch",
+			filter: func(base string) models.CustomFilter {
+				return models.CustomFilter{URL: base + "/filters/geoip.wasm", SHA256: strings.Repeat("a", 64)}
+			},
+			want: "checksum mismatch",
+		},
+		{
+			name: "host not allowed",
+			filter: func(string) models.CustomFilter {
+				return models.CustomFilter{URL: "https://evil.example.com/geoip.wasm", SHA256: moduleSum(module)}
+			},
+			want: "not an allowed module host",
+		},
+		{
+			name: "missing module",
+			filter: func(base string) models.CustomFilter {
+				return models.CustomFilter{URL: base + "/filters/other.wasm", SHA256: moduleSum(module)}
+			},
+			want: "unexpected status 404",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, base, _ := newTestFetcher(t)
+			filter := tt.filter(base)
+			filter.Name, filter.Type, filter.Enabled = "geoip", models.CustomFilterWASM, true
+
+			err := f.Fetch(context.Background(), []models.CustomFilter{filter})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Fetch() error = %v, want one containing %q", err, tt.want)
+			}
+			if _, err := os.Stat(filepath.Join(f.dir, filter.ModuleFile())); !os.IsNotExist(err) {
+				t.Errorf("module stored after a failed fetch: %v", err)
+			}
+		})
+	}
+}
+
+func TestFetcher_Allowed(t *testing.T) {
+	f := NewFetcher("", []string{"*.vpsie.com", "objects.example.net"})
+	tests := map[string]bool{
+		"objects.vpsie.com":   true,
+		"a.b.VPSie.com":       true,
+		"vpsie.com":           false,
+		"evilvpsie.com":       false,
+		"objects.example.net": true,
+		"example.net":         false,
+	}
+	for host, want := range tests {
+		if got := f.allowed(host); got != want {
+			t.Errorf("allowed(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
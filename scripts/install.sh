@@ -78,12 +78,17 @@ admin:
       address: 127.0.0.1
       port_value: 9901
 
+overload_manager:
+  resource_monitors:
+    - name: envoy.resource_monitors.global_downstream_max_connections
+      typed_config:
+        "@type": type.googleapis.com/envoy.extensions.resource_monitors.downstream_connections.v3.DownstreamConnectionsConfig
+        max_active_downstream_connections: 50000
+
 layered_runtime:
   layers:
     - name: static_layer
-      static_layer:
-        overload:
-          global_downstream_max_connections: 50000
+      static_layer: {}
 EOF
 fi
 
@@ -0,0 +1,31 @@
+#!/bin/bash
+set -e
+
+# keepalived notify script for VPSie Load Balancer HA pairs.
+# Records the VRRP state for the agent (ha.mode: vrrp).
+#
+# keepalived.conf:
+#   vrrp_instance VI_LB {
+#       ...
+#       notify /usr/local/bin/keepalived-notify.sh
+#   }
+#
+# keepalived calls it as: <script> INSTANCE|GROUP <name> <state> <priority>
+
+STATE_FILE="${VPSIE_LB_VRRP_STATE_FILE:-/var/run/vpsie-lb/vrrp-state}"
+STATE="$3"
+
+case "$STATE" in
+    MASTER|BACKUP|FAULT|STOP) ;;
+    *)
+        echo "Unknown VRRP state: $STATE" >&2
+        exit 1
+        ;;
+esac
+
+mkdir -p "$(dirname "$STATE_FILE")"
+
+# Write atomically so the agent never reads a partial state
+TMP_FILE="$(mktemp "${STATE_FILE}.XXXXXX")"
+echo "$STATE" > "$TMP_FILE"
+mv -f "$TMP_FILE" "$STATE_FILE"